@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"dmh/internal/execute"
+	"dmh/internal/state"
+)
+
+// callbackTimeout bounds single action callback request.
+const callbackTimeout = 10 * time.Second
+
+// callbackConfig controls action callbacks.
+type callbackConfig struct {
+	// JSONPost deny_private and allow guard callback URLs exactly like json_post URLs.
+	JSONPost execute.JSONPostConfig
+	// Disabled is set in execute.test_mode, test runs must not confirm delivery to downstream systems.
+	Disabled bool
+}
+
+// actionCallbacks is set from config on start.
+var actionCallbacks callbackConfig
+
+// actionCallback is posted to action on_success or on_failure URL after action run.
+type actionCallback struct {
+	UUID    string    `json:"uuid"`
+	Kind    string    `json:"kind"`
+	Comment string    `json:"comment"`
+	Result  string    `json:"result"`          // state.FiredResultSuccess or state.FiredResultFailure
+	Path    string    `json:"path"`            // delivery path, primary or fallback
+	Error   string    `json:"error,omitempty"` // run error, only for failure
+	FiredAt time.Time `json:"fired_at"`
+}
+
+// notifyActionCallback posts result of action run to OnSuccess or OnFailure of action in background,
+// so slow or failing callback never delays dispatcher. Callback failures are only logged.
+func notifyActionCallback(a *state.EncryptedAction, path string, runErr error, firedAt time.Time) {
+	callback := actionCallback{UUID: a.UUID, Kind: a.Kind, Comment: a.Comment, Result: state.FiredResultSuccess, Path: path, FiredAt: firedAt}
+	callbackURL := a.OnSuccess
+	if runErr != nil {
+		callback.Result = state.FiredResultFailure
+		callback.Error = runErr.Error()
+		callbackURL = a.OnFailure
+	}
+	if callbackURL == "" {
+		return
+	}
+	if actionCallbacks.Disabled {
+		log.Printf("skipping %s callback of action %s, execute.test_mode is enabled", callback.Result, a.UUID)
+		return
+	}
+	go func() {
+		if err := postActionCallback(callbackURL, callback); err != nil {
+			log.Printf("unable to post %s callback of action %s: %s", callback.Result, a.UUID, err)
+		}
+	}()
+}
+
+// postActionCallback sends single callback, any 2xx response is success.
+func postActionCallback(callbackURL string, callback actionCallback) error {
+	body, err := json.Marshal(callback)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, callbackURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := actionCallbacks.JSONPost.HTTPClient(callbackURL, callbackTimeout).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("received wrong status code %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"dmh/internal/execute"
+	"dmh/internal/state"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNotifyActionCallback(t *testing.T) {
+	firedAt := time.Date(2025, 3, 26, 14, 0, 0, 0, time.UTC)
+	callbacks := make(chan actionCallback, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, http.MethodPost, r.Method)
+		require.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		var callback actionCallback
+		require.Nil(t, json.NewDecoder(r.Body).Decode(&callback))
+		require.Equal(t, "/"+callback.Result, r.URL.Path)
+		callbacks <- callback
+	}))
+	defer server.Close()
+
+	a := &state.EncryptedAction{UUID: "test", Action: state.Action{Kind: "mail", Comment: "final letter", OnSuccess: server.URL + "/success", OnFailure: server.URL + "/failure"}}
+
+	tests := []struct {
+		inputAction      *state.EncryptedAction
+		inputPath        string
+		inputErr         error
+		expectedCallback *actionCallback
+	}{
+		{
+			inputAction:      a,
+			inputPath:        "primary",
+			expectedCallback: &actionCallback{UUID: "test", Kind: "mail", Comment: "final letter", Result: state.FiredResultSuccess, Path: "primary", FiredAt: firedAt},
+		},
+		{
+			inputAction:      a,
+			inputPath:        "fallback",
+			inputErr:         fmt.Errorf("smtp is down"),
+			expectedCallback: &actionCallback{UUID: "test", Kind: "mail", Comment: "final letter", Result: state.FiredResultFailure, Path: "fallback", Error: "smtp is down", FiredAt: firedAt},
+		},
+		{
+			inputAction: &state.EncryptedAction{UUID: "test", Action: state.Action{Kind: "mail", OnSuccess: server.URL + "/success"}},
+			inputPath:   "primary",
+			inputErr:    fmt.Errorf("smtp is down"),
+		},
+	}
+	for _, test := range tests {
+		notifyActionCallback(test.inputAction, test.inputPath, test.inputErr, firedAt)
+		if test.expectedCallback == nil {
+			select {
+			case callback := <-callbacks:
+				t.Fatalf("unexpected callback %v", callback)
+			case <-time.After(100 * time.Millisecond):
+			}
+			continue
+		}
+		select {
+		case callback := <-callbacks:
+			require.Equal(t, *test.expectedCallback, callback)
+		case <-time.After(time.Second):
+			t.Fatalf("callback was not posted")
+		}
+	}
+}
+
+func TestPostActionCallback(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	require.EqualError(t, postActionCallback(server.URL, actionCallback{}), "received wrong status code 502")
+	require.Error(t, postActionCallback("http://127.0.0.1:0", actionCallback{}))
+
+	redirected := false
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		redirected = true
+	}))
+	defer target.Close()
+	redirect := httptest.NewServer(http.RedirectHandler(target.URL, http.StatusFound))
+	defer redirect.Close()
+	require.EqualError(t, postActionCallback(redirect.URL, actionCallback{}), "received wrong status code 302")
+	require.False(t, redirected)
+
+	defer func() { actionCallbacks = callbackConfig{} }()
+	actionCallbacks = callbackConfig{JSONPost: execute.JSONPostConfig{DenyPrivate: true}}
+	err := postActionCallback(target.URL, actionCallback{})
+	require.ErrorIs(t, err, execute.ErrPrivateAddress)
+	require.False(t, redirected)
+}
+
+func TestNotifyActionCallbackTestMode(t *testing.T) {
+	called := make(chan bool, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called <- true
+	}))
+	defer server.Close()
+
+	defer func() { actionCallbacks = callbackConfig{} }()
+	actionCallbacks = callbackConfig{Disabled: true}
+	notifyActionCallback(&state.EncryptedAction{UUID: "test", Action: state.Action{Kind: "mail", OnSuccess: server.URL}}, "primary", nil, time.Now())
+	select {
+	case <-called:
+		t.Fatalf("callback was posted in test mode")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
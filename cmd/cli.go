@@ -2,19 +2,31 @@ package main
 
 import (
 	"bytes"
+	"cmp"
 	"context"
 	"encoding/json"
 	"fmt"
 	"io"
+	"maps"
 	"net/http"
 	"net/url"
 	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"dmh/internal/crypt"
+	"dmh/internal/execute"
 
 	"dmh/internal/state"
+	"dmh/internal/vault"
+	"dmh/internal/version"
 
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/prometheus/common/model"
 	"github.com/urfave/cli/v3"
 	"gopkg.in/yaml.v3"
 )
@@ -31,27 +43,72 @@ var (
 	newBearerToken  = crypt.NewBearerToken
 	newAge          = crypt.NewAge
 	newSignedSecret = crypt.NewSignedURLSecret
+	timeNow         = time.Now
+	userHomeDir     = os.UserHomeDir
 )
 
 const defaultServerAddr = "http://127.0.0.1:8080"
 
+// cliConfigFile is optional CLI config in user home directory with server and token keys.
+// Flags and env vars take precedence over it.
+const cliConfigFile = ".dmh-cli.yaml"
+
+// configFileValueSource looks up flag value under key of CLI config file.
+type configFileValueSource struct {
+	key string
+}
+
+// configFile returns ValueSource reading key from CLI config file.
+func configFile(key string) cli.ValueSource {
+	return &configFileValueSource{key: key}
+}
+
+// Lookup returns value of key, missing or unreadable config file is ignored.
+func (c *configFileValueSource) Lookup() (string, bool) {
+	home, err := userHomeDir()
+	if err != nil {
+		return "", false
+	}
+	path := filepath.Join(home, cliConfigFile)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", false
+	}
+	var config map[string]string
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: unable to parse %s: %v\n", path, err)
+		return "", false
+	}
+	value := config[c.key]
+	return value, value != ""
+}
+
+func (c *configFileValueSource) String() string {
+	return fmt.Sprintf("key %q from file \"~/%s\"", c.key, cliConfigFile)
+}
+
+func (c *configFileValueSource) GoString() string {
+	return fmt.Sprintf("&configFileValueSource{key:%q}", c.key)
+}
+
 func createCLI() *cli.Command {
 	return &cli.Command{
 		Name:    "dmh-client",
 		Usage:   "Manage dead-man-hand",
-		Version: "1.0.0",
+		Version: version.Get().String(),
 		Flags: []cli.Flag{
 			&cli.StringFlag{
 				Name:    "server",
 				Aliases: []string{"s"},
 				Value:   defaultServerAddr,
 				Usage:   "HTTP server address",
+				Sources: cli.NewValueSourceChain(cli.EnvVar("DMH_SERVER"), configFile("server")),
 			},
 			&cli.StringFlag{
 				Name:    "token",
-				Aliases: []string{"t"},
+				Aliases: []string{"t", "api-key"},
 				Usage:   "Bearer token used to authenticate against DMH server",
-				Sources: cli.EnvVars("DMH_TOKEN"),
+				Sources: cli.NewValueSourceChain(cli.EnvVar("DMH_TOKEN"), cli.EnvVar("DMH_API_KEY"), configFile("token")),
 			},
 		},
 		Commands: []*cli.Command{
@@ -64,7 +121,45 @@ func createCLI() *cli.Command {
 						Usage:  "Update last seen information",
 						Action: updateAlive,
 					},
+					{
+						Name:   "status",
+						Usage:  "Show last seen information and when next action will run",
+						Action: aliveStatus,
+					},
+					{
+						Name:  "gone",
+						Usage: "Mark owner as gone, all actions become due (requires admin token)",
+						Flags: []cli.Flag{
+							&cli.BoolFlag{
+								Name:  "yes",
+								Usage: "Confirm that all actions should be armed",
+							},
+						},
+						Action: markGone,
+					},
+				},
+			},
+			{
+				Name:   "metrics",
+				Usage:  "Show summary of server metrics",
+				Action: showMetrics,
+			},
+			{
+				Name:   "version",
+				Usage:  "Show client and server version",
+				Action: showVersion,
+			},
+			{
+				Name:  "schedule",
+				Usage: "Show when actions will fire if alive is not updated anymore",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "format",
+						Usage: "Output format: text, json or ics (iCalendar with reminders to update alive)",
+						Value: "text",
+					},
 				},
+				Action: showSchedule,
 			},
 			{
 				Name:  "action",
@@ -74,7 +169,40 @@ func createCLI() *cli.Command {
 						Name:    "list",
 						Aliases: []string{"ls"},
 						Usage:   "List all actions",
-						Action:  listActions,
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:  "filter-comment",
+								Usage: "Show only actions with comment containing <param> (case-insensitive)",
+							},
+							&cli.StringFlag{
+								Name:  "filter-recipient-hash",
+								Usage: "Show only actions which primary recipient has hash <param> (requires state.recipient_hash_salt)",
+							},
+							&cli.StringFlag{
+								Name:  "filter-kind",
+								Usage: "Show only actions of kind <param>",
+							},
+							&cli.IntFlag{
+								Name:  "filter-processed",
+								Usage: "Show only actions with processed state <param> (0 - pending, 1 - executed, 2 - done)",
+							},
+							&cli.TimestampFlag{
+								Name:   "since",
+								Usage:  "Show only actions which would fire at or after <param> (RFC3339) if alive is not updated anymore",
+								Config: cli.TimestampConfig{Layouts: []string{time.RFC3339}},
+							},
+							&cli.TimestampFlag{
+								Name:   "until",
+								Usage:  "Show only actions which would fire at or before <param> (RFC3339) if alive is not updated anymore",
+								Config: cli.TimestampConfig{Layouts: []string{time.RFC3339}},
+							},
+							&cli.TimestampFlag{
+								Name:   "at",
+								Usage:  "Show actions as they were stored at <param> (RFC3339), from state backup (requires state.backup_dir)",
+								Config: cli.TimestampConfig{Layouts: []string{time.RFC3339}},
+							},
+						},
+						Action: listActions,
 					},
 					{
 						Name:  "add",
@@ -105,11 +233,65 @@ func createCLI() *cli.Command {
 								Usage:   "Process action after <param> hours from last run. If min-interval > 0, action will be run FOREVER and NOT ONCE. USE WITH CAUTION!",
 								Value:   0,
 							},
+							&cli.StringFlag{
+								Name:  "process-unit",
+								Usage: "Time unit (second, minute, hour) for process-after and min-interval, overrides server action.process_unit. Ignored if --file is provided.",
+							},
+							&cli.TimestampFlag{
+								Name:   "deadline",
+								Usage:  "Run action at <param> (RFC3339) even if alive is still updated. Ignored if --file is provided.",
+								Config: cli.TimestampConfig{Layouts: []string{time.RFC3339}},
+							},
+							&cli.TimestampFlag{
+								Name:   "not-before",
+								Usage:  "Never run action before <param> (RFC3339), even if alive is not updated. Ignored if --file is provided.",
+								Config: cli.TimestampConfig{Layouts: []string{time.RFC3339}},
+							},
+							&cli.IntFlag{
+								Name:  "priority",
+								Usage: "Actions eligible at the same time run from highest priority (-100 to 100). Ignored if --file is provided.",
+							},
+							&cli.StringSliceFlag{
+								Name:  "depends-on",
+								Usage: "Run action only after action <param> (uuid) was fully processed, can be repeated. Ignored if --file is provided.",
+							},
+							&cli.IntFlag{
+								Name:  "depends-delay",
+								Usage: "Process action after <param> hours from latest depends-on action run. Ignored if --file is provided.",
+							},
+							&cli.IntFlag{
+								Name:  "dedupe-window",
+								Usage: "Skip recurring run when identical data was delivered in last <param> hours, must be greater than min-interval. Ignored if --file is provided.",
+							},
+							&cli.StringFlag{
+								Name:  "severity",
+								Usage: "Action severity (notify, destructive), destructive actions get stricter handling. Ignored if --file is provided.",
+							},
+							&cli.StringFlag{
+								Name:  "on-success",
+								Usage: "POST result to URL <param> after successful run, URL is not encrypted. Ignored if --file is provided.",
+							},
+							&cli.StringFlag{
+								Name:  "on-failure",
+								Usage: "POST result to URL <param> after failed run, URL is not encrypted. Ignored if --file is provided.",
+							},
+							&cli.StringFlag{
+								Name:  "vault-url",
+								Usage: "Store encryption key in remote vault <param> instead of remote_vault.url, vault must be listed in remote_vault.additional_urls. Ignored if --file is provided.",
+							},
+							&cli.StringFlag{
+								Name:  "recipient-passphrase",
+								Usage: "Encrypt delivered message (mail, bulksms) or content (file_write) with passphrase <param> before sending it to server, recipient decrypts it with age -d. Ignored if --file is provided.",
+							},
 							&cli.StringFlag{
 								Name:    "file",
 								Aliases: []string{"f"},
 								Usage:   "Path to YAML file containing actions to add",
 							},
+							&cli.StringFlag{
+								Name:  "from-file",
+								Usage: "Path to JSON file containing single action template (kind, data, process_after, min_interval, process_unit, deadline, not_before, priority, depends_on, depends_delay, dedupe_window, severity, on_success, on_failure, vault_url, comment). Flags provided explicitly override template values. Ignored if --file is provided.",
+							},
 						},
 						Action: addAction,
 					},
@@ -135,11 +317,108 @@ func createCLI() *cli.Command {
 							&cli.StringFlag{
 								Name:    "file",
 								Aliases: []string{"f"},
-								Usage:   "Path to YAML file containing actions to test. WARNING: ALL actions from file will be executed immediately",
+								Usage:   "Path to YAML file containing actions to test. WARNING: with --confirm-real-send ALL actions from file will be executed immediately",
+							},
+							&cli.BoolFlag{
+								Name:  "confirm-real-send",
+								Usage: "Really execute action (send mail, SMS, webhook...). Without it action is only validated and recipients which it would be delivered to are printed",
 							},
 						},
 						Action: testAction,
 					},
+					{
+						Name:  "validate",
+						Usage: "Validate action without executing it",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:    "data",
+								Aliases: []string{"d"},
+								Usage:   "Action data (json formatted). Ignored if --file is provided.",
+							},
+							&cli.StringFlag{
+								Name:    "kind",
+								Aliases: []string{"k"},
+								Usage:   "Action kind. Ignored if --file is provided.",
+							},
+							&cli.IntFlag{
+								Name:    "process-after",
+								Aliases: []string{"p"},
+								Usage:   "Process action after <param> hours from last seen. Required. Ignored if --file is provided.",
+							},
+							&cli.IntFlag{
+								Name:    "min-interval",
+								Aliases: []string{"i"},
+								Usage:   "Process action after <param> hours from last run. Ignored if --file is provided.",
+							},
+							&cli.StringFlag{
+								Name:  "process-unit",
+								Usage: "Time unit (second, minute, hour) for process-after and min-interval, overrides server action.process_unit. Ignored if --file is provided.",
+							},
+							&cli.TimestampFlag{
+								Name:   "deadline",
+								Usage:  "Run action at <param> (RFC3339) even if alive is still updated. Ignored if --file is provided.",
+								Config: cli.TimestampConfig{Layouts: []string{time.RFC3339}},
+							},
+							&cli.TimestampFlag{
+								Name:   "not-before",
+								Usage:  "Never run action before <param> (RFC3339), even if alive is not updated. Ignored if --file is provided.",
+								Config: cli.TimestampConfig{Layouts: []string{time.RFC3339}},
+							},
+							&cli.IntFlag{
+								Name:  "priority",
+								Usage: "Actions eligible at the same time run from highest priority (-100 to 100). Ignored if --file is provided.",
+							},
+							&cli.IntFlag{
+								Name:  "dedupe-window",
+								Usage: "Skip recurring run when identical data was delivered in last <param> hours, must be greater than min-interval. Ignored if --file is provided.",
+							},
+							&cli.StringFlag{
+								Name:  "severity",
+								Usage: "Action severity (notify, destructive), destructive actions get stricter handling. Ignored if --file is provided.",
+							},
+							&cli.StringFlag{
+								Name:  "on-success",
+								Usage: "POST result to URL <param> after successful run, URL is not encrypted. Ignored if --file is provided.",
+							},
+							&cli.StringFlag{
+								Name:  "on-failure",
+								Usage: "POST result to URL <param> after failed run, URL is not encrypted. Ignored if --file is provided.",
+							},
+							&cli.StringFlag{
+								Name:    "file",
+								Aliases: []string{"f"},
+								Usage:   "Path to YAML file containing actions to validate",
+							},
+						},
+						Action: validateAction,
+					},
+					{
+						Name:  "preview",
+						Usage: "Show recipients which action would be delivered to, without executing it",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:    "data",
+								Aliases: []string{"d"},
+								Usage:   "Action data (json formatted). Ignored if --file is provided.",
+							},
+							&cli.StringFlag{
+								Name:    "kind",
+								Aliases: []string{"k"},
+								Usage:   "Action kind. Ignored if --file is provided.",
+							},
+							&cli.IntFlag{
+								Name:    "process-after",
+								Aliases: []string{"p"},
+								Usage:   "Process action after <param> hours from last seen. Required. Ignored if --file is provided.",
+							},
+							&cli.StringFlag{
+								Name:    "file",
+								Aliases: []string{"f"},
+								Usage:   "Path to YAML file containing actions to preview",
+							},
+						},
+						Action: previewAction,
+					},
 					{
 						Name:  "delete",
 						Usage: "Delete a action",
@@ -152,6 +431,88 @@ func createCLI() *cli.Command {
 						},
 						Action: deleteAction,
 					},
+					{
+						Name:  "reorder",
+						Usage: "Set order in which simultaneously eligible actions run (after priority)",
+						Flags: []cli.Flag{
+							&cli.StringSliceFlag{
+								Name:     "uuid",
+								Usage:    "Action UUID, every action must be listed exactly once in new order",
+								Required: true,
+							},
+						},
+						Action: reorderActions,
+					},
+					{
+						Name:  "purge",
+						Usage: "Delete all actions and their vault secrets",
+						Flags: []cli.Flag{
+							&cli.BoolFlag{
+								Name:  "yes",
+								Usage: "Confirm that all actions should be deleted",
+							},
+							&cli.BoolFlag{
+								Name:  "keep-vault-secrets",
+								Usage: "Do not delete vault secrets of purged actions",
+							},
+						},
+						Action: purgeActions,
+					},
+					{
+						Name:  "watch",
+						Usage: "Poll action and its vault secret until action is released or fired, printing every change",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:     "uuid",
+								Usage:    "Action UUID to watch",
+								Required: true,
+							},
+							&cli.StringFlag{
+								Name:  "until",
+								Usage: "Stop when action is released (vault released key or action run) or fired (run and key deleted from vault)",
+								Value: "fired",
+							},
+							&cli.DurationFlag{
+								Name:  "timeout",
+								Usage: "Fail when action does not reach --until state in time",
+								Value: 5 * time.Minute,
+							},
+							&cli.DurationFlag{
+								Name:  "interval",
+								Usage: "Time between polls",
+								Value: 5 * time.Second,
+							},
+							&cli.StringFlag{
+								Name:    "vault-token",
+								Usage:   "Bearer token of vault secret status requests, --token is used when empty",
+								Sources: cli.NewValueSourceChain(cli.EnvVar("DMH_VAULT_TOKEN")),
+							},
+						},
+						Action: watchAction,
+					},
+				},
+			},
+			{
+				Name:  "vault",
+				Usage: "Vault operations",
+				Commands: []*cli.Command{
+					{
+						Name:  "countdown",
+						Usage: "Show how long until vault releases secret (--server is vault address)",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:     "client-uuid",
+								Usage:    "Client uuid which secret belongs to",
+								Required: true,
+							},
+							&cli.StringFlag{
+								Name:     "secret-uuid",
+								Usage:    "Secret uuid (action uuid)",
+								Required: true,
+							},
+						},
+						Action: vaultCountdown,
+					},
 				},
 			},
 			{
@@ -173,6 +534,18 @@ func createCLI() *cli.Command {
 						Usage:  "Generate a new age key (for vault.key in config)",
 						Action: genAgeKey,
 					},
+					{
+						Name:  "encrypt-value",
+						Usage: "Encrypt config value with master key (from DMH_MASTER_KEY or DMH_MASTER_KEY_FILE)",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:     "value",
+								Usage:    "Plaintext config value",
+								Required: true,
+							},
+						},
+						Action: encryptValue,
+					},
 				},
 			},
 		},
@@ -209,6 +582,28 @@ func genAgeKey(ctx context.Context, cmd *cli.Command) error {
 	fmt.Fprintf(os.Stdout, "PrivateKey: %s\n", ageInterface.GetPrivateKey())
 	return nil
 }
+
+// encryptValue encrypts config value with master key, output can be used as config value.
+func encryptValue(ctx context.Context, cmd *cli.Command) error {
+	masterKey, err := crypt.MasterKey()
+	if err != nil {
+		return err
+	}
+	if masterKey == "" {
+		return fmt.Errorf("%s or %s is not set", crypt.MasterKeyEnv, crypt.MasterKeyFileEnv)
+	}
+	ageInterface, err := newAge(masterKey)
+	if err != nil {
+		return err
+	}
+	encrypted, err := crypt.EncryptValue(ageInterface, cmd.String("value"))
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stdout, "EncryptedValue: %s\n", encrypted)
+	return nil
+}
+
 func main() {
 	cmd := createCLI()
 	if err := cmd.Run(context.Background(), os.Args); err != nil {
@@ -247,7 +642,30 @@ type actionFileEntry struct {
 	Data         actionData `yaml:"data"`
 	ProcessAfter int        `yaml:"process_after"`
 	MinInterval  int        `yaml:"min_interval"`
+	ProcessUnit  string     `yaml:"process_unit"`
+	Deadline     *time.Time `yaml:"deadline"`
+	NotBefore    *time.Time `yaml:"not_before"`
+	Priority     int        `yaml:"priority"`
+	DependsOn    []string   `yaml:"depends_on"`
+	DependsDelay int        `yaml:"depends_delay"`
+	DedupeWindow int        `yaml:"dedupe_window"`
+	Severity     string     `yaml:"severity"`
+	OnSuccess    string     `yaml:"on_success"`
+	OnFailure    string     `yaml:"on_failure"`
+	VaultURL     string     `yaml:"vault_url"`
 	Comment      string     `yaml:"comment"`
+	Fallback     *struct {
+		Kind string     `yaml:"kind"`
+		Data actionData `yaml:"data"`
+	} `yaml:"fallback"`
+}
+
+// fallback returns state fallback of entry, nil when entry has no fallback.
+func (e *actionFileEntry) fallback() *state.Fallback {
+	if e.Fallback == nil {
+		return nil
+	}
+	return &state.Fallback{Kind: e.Fallback.Kind, Data: e.Fallback.Data.Value}
 }
 
 // doRequest sends HTTP request to DMH server with optional bearer token.
@@ -303,9 +721,58 @@ func createAction(cmd *cli.Command, action *state.Action) error {
 	return sendAction(cmd, action, "store", http.StatusCreated)
 }
 
+// testActionRequest describes /api/action/test request.
+type testActionRequest struct {
+	*state.Action
+	Confirm bool `json:"confirm"`
+}
+
+// testActionResponse describes /api/action/test response when action was not executed.
+type testActionResponse struct {
+	DryRun     bool               `json:"dry_run"`
+	Recipients []previewRecipient `json:"recipients"`
+}
+
 // sendTestAction validates and sends a single action to the server for immediate execution.
+// Action is executed only with --confirm-real-send, otherwise server only validates it
+// and recipients which action would be delivered to are printed.
 func sendTestAction(cmd *cli.Command, action *state.Action) error {
-	return sendAction(cmd, action, "test", http.StatusOK)
+	if err := action.Validate(); err != nil {
+		return err
+	}
+
+	confirm := cmd.Bool("confirm-real-send")
+	payload, err := jsonMarshal(&testActionRequest{Action: action, Confirm: confirm})
+	if err != nil {
+		return fmt.Errorf("failed to marshal JSON: %w", err)
+	}
+
+	endpointAddress, err := url.JoinPath(cmd.String("server"), "api", "action", "test")
+	if err != nil {
+		return fmt.Errorf("unable to parse address: %s", err)
+	}
+
+	resp, err := doRequest(cmd, "POST", endpointAddress, payload)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("server returned status %d: %s", resp.StatusCode, string(body))
+	}
+	if confirm {
+		return nil
+	}
+
+	var result testActionResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("unable to decode response: %w", err)
+	}
+	fmt.Printf("Action %s was not run, it would be delivered to:\n", action.Kind)
+	printRecipients(result.Recipients, "  ")
+	return nil
 }
 
 // loadActionsFromFile reads a YAML file containing a list of actions.
@@ -330,7 +797,19 @@ func loadActionsFromFile(path string) ([]*state.Action, error) {
 			Data:         e.Data.Value,
 			ProcessAfter: e.ProcessAfter,
 			MinInterval:  e.MinInterval,
+			ProcessUnit:  e.ProcessUnit,
+			Deadline:     e.Deadline,
+			NotBefore:    e.NotBefore,
+			Priority:     e.Priority,
+			DependsOn:    e.DependsOn,
+			DependsDelay: e.DependsDelay,
+			DedupeWindow: e.DedupeWindow,
+			Severity:     e.Severity,
+			OnSuccess:    e.OnSuccess,
+			OnFailure:    e.OnFailure,
+			VaultURL:     e.VaultURL,
 			Comment:      e.Comment,
+			Fallback:     e.fallback(),
 		}
 		if err := a.Validate(); err != nil {
 			return nil, fmt.Errorf("action #%d: %w", i+1, err)
@@ -340,34 +819,130 @@ func loadActionsFromFile(path string) ([]*state.Action, error) {
 	return actions, nil
 }
 
-// processActionsFromFile loads actions from a YAML file and sends each one with send.
-// All file entries are validated before anything is sent to the server, but server-side
-// failures are reported per action - earlier actions are already sent when a later one fails.
-func processActionsFromFile(cmd *cli.Command, path string, send func(*cli.Command, *state.Action) error) error {
-	actions, err := loadActionsFromFile(path)
-	if err != nil {
-		return fmt.Errorf("unable to load actions from file: %w", err)
-	}
-	if len(actions) == 0 {
-		return fmt.Errorf("no actions found in file")
-	}
+// sendValidateAction validates a single action on the server without executing it.
+func sendValidateAction(cmd *cli.Command, action *state.Action) error {
+	return sendAction(cmd, action, "validate", http.StatusOK)
+}
 
-	var failed int
-	for i, action := range actions {
-		if err := send(cmd, action); err != nil {
-			fmt.Fprintf(os.Stderr, "action %d: %s\n", i+1, err)
-			failed++
-		}
-	}
+// previewRecipient describes single recipient in /api/action/preview response.
+type previewRecipient struct {
+	Type    string `json:"type"`
+	Address string `json:"address"`
+}
 
-	if failed > 0 {
-		return fmt.Errorf("%d of %d actions failed", failed, len(actions))
-	}
-	return nil
+// previewResponse describes /api/action/preview response.
+type previewResponse struct {
+	Recipients []previewRecipient `json:"recipients"`
 }
 
-func updateAlive(ctx context.Context, cmd *cli.Command) error {
-	server := cmd.String("server")
+// sendPreviewAction returns recipients which single action would be delivered to.
+func sendPreviewAction(cmd *cli.Command, action *state.Action) ([]previewRecipient, error) {
+	if err := action.Validate(); err != nil {
+		return nil, err
+	}
+
+	payload, err := jsonMarshal(action)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal JSON: %w", err)
+	}
+
+	endpointAddress, err := url.JoinPath(cmd.String("server"), "api", "action", "preview")
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse address: %s", err)
+	}
+
+	resp, err := doRequest(cmd, "POST", endpointAddress, payload)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("server returned status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var preview previewResponse
+	if err := json.NewDecoder(resp.Body).Decode(&preview); err != nil {
+		return nil, fmt.Errorf("unable to decode response: %w", err)
+	}
+	return preview.Recipients, nil
+}
+
+// printRecipients prints recipients one per line with indent.
+func printRecipients(recipients []previewRecipient, indent string) {
+	if len(recipients) == 0 {
+		fmt.Printf("%sno recipients\n", indent)
+		return
+	}
+	for _, r := range recipients {
+		fmt.Printf("%s%s: %s\n", indent, r.Type, r.Address)
+	}
+}
+
+// loadActionTemplate reads single action spec from a JSON file.
+// It accepts data as either a JSON string or a JSON object.
+func loadActionTemplate(path string) (*state.Action, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// JSON is valid YAML, this way actionData handles both data forms.
+	var entry actionFileEntry
+	if err := yaml.Unmarshal(data, &entry); err != nil {
+		return nil, err
+	}
+
+	return &state.Action{
+		Kind:         entry.Kind,
+		Data:         entry.Data.Value,
+		ProcessAfter: entry.ProcessAfter,
+		MinInterval:  entry.MinInterval,
+		ProcessUnit:  entry.ProcessUnit,
+		Deadline:     entry.Deadline,
+		NotBefore:    entry.NotBefore,
+		Priority:     entry.Priority,
+		DependsOn:    entry.DependsOn,
+		DependsDelay: entry.DependsDelay,
+		DedupeWindow: entry.DedupeWindow,
+		Severity:     entry.Severity,
+		OnSuccess:    entry.OnSuccess,
+		OnFailure:    entry.OnFailure,
+		VaultURL:     entry.VaultURL,
+		Comment:      entry.Comment,
+		Fallback:     entry.fallback(),
+	}, nil
+}
+
+// processActionsFromFile loads actions from a YAML file and sends each one with send.
+// All file entries are validated before anything is sent to the server, but server-side
+// failures are reported per action - earlier actions are already sent when a later one fails.
+func processActionsFromFile(cmd *cli.Command, path string, send func(*cli.Command, *state.Action) error) error {
+	actions, err := loadActionsFromFile(path)
+	if err != nil {
+		return fmt.Errorf("unable to load actions from file: %w", err)
+	}
+	if len(actions) == 0 {
+		return fmt.Errorf("no actions found in file")
+	}
+
+	var failed int
+	for i, action := range actions {
+		if err := send(cmd, action); err != nil {
+			fmt.Fprintf(os.Stderr, "action %d: %s\n", i+1, err)
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d actions failed", failed, len(actions))
+	}
+	return nil
+}
+
+func updateAlive(ctx context.Context, cmd *cli.Command) error {
+	server := cmd.String("server")
 	endpointAddress, err := url.JoinPath(server, "api", "alive")
 	if err != nil {
 		return fmt.Errorf("unable to parse address: %s", err)
@@ -385,12 +960,373 @@ func updateAlive(ctx context.Context, cmd *cli.Command) error {
 	return nil
 }
 
+// markGone marks owner as gone on server.
+// It requires --yes, all actions become due on next dispatcher tick.
+func markGone(ctx context.Context, cmd *cli.Command) error {
+	if !cmd.Bool("yes") {
+		return fmt.Errorf("gone arms all actions, confirm with --yes")
+	}
+
+	endpointAddress, err := url.JoinPath(cmd.String("server"), "api", "alive")
+	if err != nil {
+		return fmt.Errorf("unable to parse address: %s", err)
+	}
+	resp, err := doRequest(cmd, "DELETE", endpointAddress, nil)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("server returned status %d: %s", resp.StatusCode, string(body))
+	}
+	fmt.Println("Owner marked as gone, all actions are due")
+	return nil
+}
+
+// versionResponse describes /api/version response.
+type versionResponse struct {
+	version.Info
+	Components []string `json:"components"`
+}
+
+// showVersion prints client version and version of server, server error is returned after client version is printed.
+func showVersion(ctx context.Context, cmd *cli.Command) error {
+	fmt.Printf("Client: %s\n", version.Get())
+
+	endpointAddress, err := url.JoinPath(cmd.String("server"), "api", "version")
+	if err != nil {
+		return fmt.Errorf("unable to parse address: %s", err)
+	}
+	resp, err := doRequest(cmd, "GET", endpointAddress, nil)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("server returned status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var server versionResponse
+	if err := json.NewDecoder(resp.Body).Decode(&server); err != nil {
+		return fmt.Errorf("unable to decode response: %w", err)
+	}
+	fmt.Printf("Server: %s, components: %s\n", server.Info, strings.Join(server.Components, ", "))
+	return nil
+}
+
+// statusResponse describes /api/status response.
+type statusResponse struct {
+	LastSeen       time.Time          `json:"last_seen"`
+	NextActionAt   *time.Time         `json:"next_action_at"`
+	NextActionUUID string             `json:"next_action_uuid"`
+	ProcessUnit    string             `json:"process_unit"`
+	Maintenance    *state.Maintenance `json:"maintenance"`
+}
+
+func aliveStatus(ctx context.Context, cmd *cli.Command) error {
+	endpointAddress, err := url.JoinPath(cmd.String("server"), "api", "status")
+	if err != nil {
+		return fmt.Errorf("unable to parse address: %s", err)
+	}
+	resp, err := doRequest(cmd, "GET", endpointAddress, nil)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("server returned status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var status statusResponse
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		return fmt.Errorf("unable to decode response: %w", err)
+	}
+
+	now := timeNow()
+	fmt.Printf("Last seen: %s (%s ago)\n", status.LastSeen.Format(time.RFC3339), now.Sub(status.LastSeen).Round(time.Second))
+	if status.NextActionAt == nil {
+		fmt.Println("Next action: none scheduled")
+		return nil
+	}
+	untilNext := status.NextActionAt.Sub(now).Round(time.Second)
+	when := fmt.Sprintf("in %s", untilNext)
+	if untilNext <= 0 {
+		when = fmt.Sprintf("overdue by %s", -untilNext)
+	}
+	fmt.Printf("Next action: %s at %s (%s)\n", status.NextActionUUID, status.NextActionAt.Format(time.RFC3339), when)
+	return nil
+}
+
+// scheduleEntry is single projected action run shown by schedule command.
+type scheduleEntry struct {
+	UUID    string    `json:"uuid"`
+	Kind    string    `json:"kind"`
+	Comment string    `json:"comment,omitempty"`
+	FireAt  time.Time `json:"fire_at"`
+}
+
+// getJSON sends GET request to server path and decodes JSON response into v.
+func getJSON(cmd *cli.Command, v any, path ...string) error {
+	endpointAddress, err := url.JoinPath(cmd.String("server"), path...)
+	if err != nil {
+		return fmt.Errorf("unable to parse address: %s", err)
+	}
+	resp, err := doRequest(cmd, "GET", endpointAddress, nil)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("server returned status %d: %s", resp.StatusCode, string(body))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("unable to decode response: %w", err)
+	}
+	return nil
+}
+
+// showSchedule prints projected fire times of actions, soonest first.
+// Fire times are computed like in /api/status, from last seen, action.process_unit and maintenance.
+func showSchedule(ctx context.Context, cmd *cli.Command) error {
+	format := cmd.String("format")
+	if !slices.Contains([]string{"text", "json", "ics"}, format) {
+		return fmt.Errorf("unsupported format %s, supported are text, json, ics", format)
+	}
+
+	var status statusResponse
+	if err := getJSON(cmd, &status, "api", "status"); err != nil {
+		return err
+	}
+	processUnit, ok := vault.ProcessUnit(status.ProcessUnit)
+	if !ok {
+		return fmt.Errorf("server returned unknown process_unit %q", status.ProcessUnit)
+	}
+	var actions []*state.EncryptedAction
+	if err := getJSON(cmd, &actions, "api", "action", "store"); err != nil {
+		return err
+	}
+
+	entries := []scheduleEntry{}
+	for _, a := range actions {
+		fireAt, ok := a.NextRun(status.LastSeen, status.Maintenance.Duration(), processUnit)
+		if !ok {
+			continue
+		}
+		entries = append(entries, scheduleEntry{UUID: a.UUID, Kind: a.Kind, Comment: a.Comment, FireAt: fireAt.UTC()})
+	}
+	slices.SortFunc(entries, func(a, b scheduleEntry) int {
+		return cmp.Or(a.FireAt.Compare(b.FireAt), cmp.Compare(a.UUID, b.UUID))
+	})
+
+	switch format {
+	case "json":
+		return json.NewEncoder(os.Stdout).Encode(entries)
+	case "ics":
+		fmt.Print(scheduleICS(entries, timeNow()))
+		return nil
+	}
+	if len(entries) == 0 {
+		fmt.Println("No actions scheduled")
+		return nil
+	}
+	now := timeNow()
+	for _, e := range entries {
+		label := e.UUID
+		if e.Comment != "" {
+			label = fmt.Sprintf("'%s'", e.Comment)
+		}
+		fmt.Printf("%s  %s — %s — %s\n", e.FireAt.Format(time.RFC3339), relativeTime(e.FireAt.Sub(now)), e.Kind, label)
+	}
+	return nil
+}
+
+// relativeTime returns human readable duration rounded to days and hours (minutes below hour),
+// e.g. "in 3d 4h" or "overdue by 15m".
+func relativeTime(d time.Duration) string {
+	prefix := "in"
+	if d < 0 {
+		prefix = "overdue by"
+		d = -d
+	}
+	days := d / (24 * time.Hour)
+	hours := d % (24 * time.Hour) / time.Hour
+	minutes := d % time.Hour / time.Minute
+	switch {
+	case days > 0:
+		return fmt.Sprintf("%s %dd %dh", prefix, days, hours)
+	case hours > 0:
+		return fmt.Sprintf("%s %dh %dm", prefix, hours, minutes)
+	default:
+		return fmt.Sprintf("%s %dm", prefix, minutes)
+	}
+}
+
+// icsReminder is how long before action fires calendar reminds to update alive.
+const icsReminder = "-PT1H"
+
+// scheduleICS returns iCalendar with single event per action at its fire time.
+func scheduleICS(entries []scheduleEntry, now time.Time) string {
+	const layout = "20060102T150405Z"
+	var b strings.Builder
+	b.WriteString("BEGIN:VCALENDAR\r\nVERSION:2.0\r\nPRODID:-//dead-man-hand//dmh-cli//EN\r\nCALSCALE:GREGORIAN\r\n")
+	for _, e := range entries {
+		summary := fmt.Sprintf("DMH %s action fires", e.Kind)
+		if e.Comment != "" {
+			summary = fmt.Sprintf("DMH %s action fires: %s", e.Kind, e.Comment)
+		}
+		b.WriteString("BEGIN:VEVENT\r\n")
+		fmt.Fprintf(&b, "UID:%s@dead-man-hand\r\n", e.UUID)
+		fmt.Fprintf(&b, "DTSTAMP:%s\r\n", now.UTC().Format(layout))
+		fmt.Fprintf(&b, "DTSTART:%s\r\n", e.FireAt.UTC().Format(layout))
+		fmt.Fprintf(&b, "SUMMARY:%s\r\n", icsEscape(summary))
+		fmt.Fprintf(&b, "DESCRIPTION:%s\r\n", icsEscape(fmt.Sprintf("Update alive before this time to postpone action %s.", e.UUID)))
+		fmt.Fprintf(&b, "BEGIN:VALARM\r\nACTION:DISPLAY\r\nTRIGGER:%s\r\nDESCRIPTION:%s\r\nEND:VALARM\r\n", icsReminder, icsEscape(summary))
+		b.WriteString("END:VEVENT\r\n")
+	}
+	b.WriteString("END:VCALENDAR\r\n")
+	return b.String()
+}
+
+// icsEscape escapes iCalendar TEXT value.
+func icsEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(s)
+}
+
+// topErrorActions is number of actions with most errors shown by metrics command.
+const topErrorActions = 5
+
+// actionErrors is number of errors of single action, total and per failed step.
+type actionErrors struct {
+	uuid   string
+	total  float64
+	byStep map[string]float64
+}
+
+// showMetrics fetches /metrics and prints summary of actions, missing secrets and action errors.
+func showMetrics(ctx context.Context, cmd *cli.Command) error {
+	endpointAddress, err := url.JoinPath(cmd.String("server"), "metrics")
+	if err != nil {
+		return fmt.Errorf("unable to parse address: %s", err)
+	}
+	resp, err := doRequest(cmd, "GET", endpointAddress, nil)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("server returned status %d: %s", resp.StatusCode, string(body))
+	}
+
+	parser := expfmt.NewTextParser(model.UTF8Validation)
+	families, err := parser.TextToMetricFamilies(resp.Body)
+	if err != nil {
+		return fmt.Errorf("unable to parse metrics: %w", err)
+	}
+
+	actions := map[string]float64{}
+	for _, m := range families["dmh_actions"].GetMetric() {
+		actions[labelValue(m, "processed")] = m.GetGauge().GetValue()
+	}
+	if len(actions) == 0 {
+		fmt.Println("Actions: no data")
+	} else {
+		fmt.Printf("Actions: %d pending, %d recurring, %d fired\n", int(actions["0"]), int(actions["1"]), int(actions["2"]))
+	}
+
+	var missing []string
+	for _, m := range families["dmh_missing_secrets_total"].GetMetric() {
+		if m.GetCounter().GetValue() > 0 {
+			missing = append(missing, labelValue(m, "action"))
+		}
+	}
+	slices.Sort(missing)
+	if len(missing) == 0 {
+		fmt.Println("Missing secrets: none")
+	} else {
+		fmt.Printf("Missing secrets: %d actions\n", len(missing))
+		for _, u := range missing {
+			fmt.Printf("  %s\n", u)
+		}
+	}
+
+	errorsByAction := map[string]*actionErrors{}
+	for _, m := range families["dmh_action_errors_total"].GetMetric() {
+		u := labelValue(m, "action")
+		if errorsByAction[u] == nil {
+			errorsByAction[u] = &actionErrors{uuid: u, byStep: map[string]float64{}}
+		}
+		errorsByAction[u].total += m.GetCounter().GetValue()
+		errorsByAction[u].byStep[labelValue(m, "error")] += m.GetCounter().GetValue()
+	}
+	if len(errorsByAction) == 0 {
+		fmt.Println("Action errors: none")
+		return nil
+	}
+	top := slices.SortedFunc(maps.Values(errorsByAction), func(a, b *actionErrors) int {
+		return cmp.Or(cmp.Compare(b.total, a.total), cmp.Compare(a.uuid, b.uuid))
+	})
+	fmt.Printf("Action errors: %d actions, top %d\n", len(top), min(len(top), topErrorActions))
+	for _, e := range top[:min(len(top), topErrorActions)] {
+		steps := make([]string, 0, len(e.byStep))
+		for _, step := range slices.Sorted(maps.Keys(e.byStep)) {
+			steps = append(steps, fmt.Sprintf("%s: %d", step, int(e.byStep[step])))
+		}
+		fmt.Printf("  %s %d (%s)\n", e.uuid, int(e.total), strings.Join(steps, ", "))
+	}
+	return nil
+}
+
+// labelValue returns value of metric label, empty when label is missing.
+func labelValue(m *dto.Metric, name string) string {
+	for _, label := range m.GetLabel() {
+		if label.GetName() == name {
+			return label.GetValue()
+		}
+	}
+	return ""
+}
+
 func listActions(ctx context.Context, cmd *cli.Command) error {
 	server := cmd.String("server")
 	endpointAddress, err := url.JoinPath(server, "api", "action", "store")
 	if err != nil {
 		return fmt.Errorf("unable to parse address: %s", err)
 	}
+	query := url.Values{}
+	if comment := cmd.String("filter-comment"); comment != "" {
+		query.Set("comment", comment)
+	}
+	if recipientHash := cmd.String("filter-recipient-hash"); recipientHash != "" {
+		query.Set("recipient_hash", recipientHash)
+	}
+	if kind := cmd.String("filter-kind"); kind != "" {
+		query.Set("kind", kind)
+	}
+	if cmd.IsSet("filter-processed") {
+		query.Set("processed", strconv.Itoa(cmd.Int("filter-processed")))
+	}
+	if cmd.IsSet("since") {
+		query.Set("fires_after", cmd.Timestamp("since").Format(time.RFC3339))
+	}
+	if cmd.IsSet("until") {
+		query.Set("fires_before", cmd.Timestamp("until").Format(time.RFC3339))
+	}
+	if cmd.IsSet("at") {
+		query.Set("at", cmd.Timestamp("at").Format(time.RFC3339))
+	}
+	if len(query) > 0 {
+		endpointAddress += "?" + query.Encode()
+	}
 	resp, err := doRequest(cmd, "GET", endpointAddress, nil)
 	if err != nil {
 		return fmt.Errorf("request failed: %w", err)
@@ -407,7 +1343,7 @@ func listActions(ctx context.Context, cmd *cli.Command) error {
 }
 
 // addAction is the CLI handler. If --file is provided, reads YAML and creates each action.
-// Otherwise creates a single action from flags.
+// Otherwise creates a single action from flags, optionally on top of --from-file template.
 func addAction(ctx context.Context, cmd *cli.Command) error {
 	if filePath := cmd.String("file"); filePath != "" {
 		if err := processActionsFromFile(cmd, filePath, createAction); err != nil {
@@ -417,13 +1353,71 @@ func addAction(ctx context.Context, cmd *cli.Command) error {
 		return nil
 	}
 
-	if err := createAction(cmd, &state.Action{
-		Kind:         cmd.String("kind"),
-		Data:         cmd.String("data"),
-		ProcessAfter: cmd.Int("process-after"),
-		MinInterval:  cmd.Int("min-interval"),
-		Comment:      cmd.String("comment"),
-	}); err != nil {
+	action := &state.Action{}
+	if templatePath := cmd.String("from-file"); templatePath != "" {
+		template, err := loadActionTemplate(templatePath)
+		if err != nil {
+			return fmt.Errorf("unable to load action template: %w", err)
+		}
+		action = template
+	}
+
+	if cmd.IsSet("kind") {
+		action.Kind = cmd.String("kind")
+	}
+	if cmd.IsSet("data") {
+		action.Data = cmd.String("data")
+	}
+	if cmd.IsSet("process-after") {
+		action.ProcessAfter = cmd.Int("process-after")
+	}
+	if cmd.IsSet("min-interval") {
+		action.MinInterval = cmd.Int("min-interval")
+	}
+	if cmd.IsSet("process-unit") {
+		action.ProcessUnit = cmd.String("process-unit")
+	}
+	if cmd.IsSet("deadline") {
+		action.Deadline = timestampFlag(cmd, "deadline")
+	}
+	if cmd.IsSet("not-before") {
+		action.NotBefore = timestampFlag(cmd, "not-before")
+	}
+	if cmd.IsSet("priority") {
+		action.Priority = cmd.Int("priority")
+	}
+	if cmd.IsSet("depends-on") {
+		action.DependsOn = cmd.StringSlice("depends-on")
+	}
+	if cmd.IsSet("depends-delay") {
+		action.DependsDelay = cmd.Int("depends-delay")
+	}
+	if cmd.IsSet("dedupe-window") {
+		action.DedupeWindow = cmd.Int("dedupe-window")
+	}
+	if cmd.IsSet("severity") {
+		action.Severity = cmd.String("severity")
+	}
+	if cmd.IsSet("on-success") {
+		action.OnSuccess = cmd.String("on-success")
+	}
+	if cmd.IsSet("on-failure") {
+		action.OnFailure = cmd.String("on-failure")
+	}
+	if cmd.IsSet("vault-url") {
+		action.VaultURL = cmd.String("vault-url")
+	}
+	if cmd.IsSet("comment") {
+		action.Comment = cmd.String("comment")
+	}
+	// Payload is encrypted locally, so server never sees it in plaintext.
+	if cmd.IsSet("recipient-passphrase") {
+		if err := execute.ProtectPayload(action, cmd.String("recipient-passphrase")); err != nil {
+			return err
+		}
+	}
+
+	if err := createAction(cmd, action); err != nil {
 		return err
 	}
 
@@ -459,13 +1453,230 @@ func deleteAction(ctx context.Context, cmd *cli.Command) error {
 	return nil
 }
 
+// reorderActions sends new order of actions to server.
+func reorderActions(ctx context.Context, cmd *cli.Command) error {
+	endpointAddress, err := url.JoinPath(cmd.String("server"), "api", "action", "reorder")
+	if err != nil {
+		return fmt.Errorf("unable to parse address: %s", err)
+	}
+	payload, err := jsonMarshal(map[string][]string{"uuids": cmd.StringSlice("uuid")})
+	if err != nil {
+		return fmt.Errorf("failed to marshal JSON: %w", err)
+	}
+
+	resp, err := doRequest(cmd, "POST", endpointAddress, payload)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("server returned status %d: %s", resp.StatusCode, string(body))
+	}
+
+	fmt.Println("Actions reordered successfully")
+	return nil
+}
+
+// vaultCountdown prints whether vault secret is released, missing or how long until it is released.
+// HEAD is used, so released key is never sent over the wire.
+func vaultCountdown(ctx context.Context, cmd *cli.Command) error {
+	clientUUID := cmd.String("client-uuid")
+	secretUUID := cmd.String("secret-uuid")
+	if clientUUID == "" || secretUUID == "" {
+		return fmt.Errorf("client-uuid and secret-uuid are required")
+	}
+
+	endpointAddress, err := url.JoinPath(cmd.String("server"), "api", "vault", "store", clientUUID, secretUUID)
+	if err != nil {
+		return fmt.Errorf("unable to parse address: %s", err)
+	}
+
+	resp, err := doRequest(cmd, "HEAD", endpointAddress, nil)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		fmt.Println("Secret released")
+	case http.StatusNotFound:
+		fmt.Println("Secret missing")
+	case http.StatusLocked:
+		seconds, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+		if err != nil || seconds <= 0 {
+			fmt.Println("Secret not released")
+			return nil
+		}
+		remaining := time.Duration(seconds) * time.Second
+		fmt.Printf("Secret releases in %s (at %s)\n", remaining, timeNow().Add(remaining).Format(time.RFC3339))
+	default:
+		return fmt.Errorf("server returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// watchState is state of watched action and its vault secret.
+type watchState struct {
+	Processed int
+	Vault     string // released, locked, missing, unreachable, status <code> or - when action has no vault URL
+}
+
+func (w watchState) String() string {
+	processed := map[int]string{0: "pending", 1: "executed", 2: "done"}[w.Processed]
+	return fmt.Sprintf("processed=%s vault=%s", cmp.Or(processed, strconv.Itoa(w.Processed)), w.Vault)
+}
+
+// reached reports whether action reached until state.
+func (w watchState) reached(until string) bool {
+	if until == "released" {
+		return w.Processed > 0 || w.Vault == "released"
+	}
+	return w.Processed == 2
+}
+
+// watchAction polls action and its vault secret until action is released or fired.
+// Every change is printed, timeout is returned as error, so it can be used in scripts.
+func watchAction(ctx context.Context, cmd *cli.Command) error {
+	uuid := cmd.String("uuid")
+	if uuid == "" {
+		return fmt.Errorf("uuid is required")
+	}
+	until := cmd.String("until")
+	if until != "released" && until != "fired" {
+		return fmt.Errorf("until must be released or fired")
+	}
+	endpointAddress, err := url.JoinPath(cmd.String("server"), "api", "action", "store", uuid)
+	if err != nil {
+		return fmt.Errorf("unable to parse address: %s", err)
+	}
+
+	timeout := cmd.Duration("timeout")
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	var last *watchState
+	for {
+		current, err := pollWatchState(cmd, endpointAddress)
+		if err != nil {
+			return err
+		}
+		if last == nil || *current != *last {
+			fmt.Printf("%s %s\n", timeNow().Format(time.RFC3339), current)
+			last = current
+		}
+		if current.reached(until) {
+			fmt.Printf("Action %s %s\n", uuid, until)
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("action was not %s within %s, last state: %s", until, timeout, last)
+		case <-time.After(cmd.Duration("interval")):
+		}
+	}
+}
+
+// pollWatchState returns current state of action and its vault secret.
+// Vault secret is checked with HEAD, so released key is never transferred.
+func pollWatchState(cmd *cli.Command, endpointAddress string) (*watchState, error) {
+	resp, err := doRequest(cmd, "GET", endpointAddress, nil)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("server returned status %d: %s", resp.StatusCode, string(body))
+	}
+	var action state.EncryptedAction
+	if err := json.NewDecoder(resp.Body).Decode(&action); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	current := &watchState{Processed: action.Processed, Vault: "-"}
+	if action.EncryptionMeta.VaultURL == "" {
+		return current, nil
+	}
+	req, err := newRequest("HEAD", action.EncryptionMeta.VaultURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse vault address: %s", err)
+	}
+	if token := cmp.Or(cmd.String("vault-token"), cmd.String("token")); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	vaultResp, err := getClient(cmd).Do(req)
+	if err != nil {
+		current.Vault = "unreachable"
+		return current, nil
+	}
+	vaultResp.Body.Close()
+	switch vaultResp.StatusCode {
+	case http.StatusOK:
+		current.Vault = "released"
+	case http.StatusLocked:
+		current.Vault = "locked"
+	case http.StatusNotFound:
+		current.Vault = "missing"
+	default:
+		current.Vault = fmt.Sprintf("status %d", vaultResp.StatusCode)
+	}
+	return current, nil
+}
+
+// purgeActions deletes all actions from server.
+// It requires --yes, there is no way to recover purged actions.
+func purgeActions(ctx context.Context, cmd *cli.Command) error {
+	if !cmd.Bool("yes") {
+		return fmt.Errorf("purge deletes all actions, confirm with --yes")
+	}
+
+	endpointAddress, err := url.JoinPath(cmd.String("server"), "api", "action", "purge")
+	if err != nil {
+		return fmt.Errorf("unable to parse address: %s", err)
+	}
+	if cmd.Bool("keep-vault-secrets") {
+		endpointAddress += "?" + url.Values{"keep_vault_secrets": {"true"}}.Encode()
+	}
+
+	resp, err := doRequest(cmd, "POST", endpointAddress, nil)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusMultiStatus {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("server returned status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var result state.PurgeResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("unable to decode response: %w", err)
+	}
+
+	fmt.Printf("Deleted %d actions, %d vault deletions failed\n", result.Deleted, result.VaultDeleteFailed)
+	for _, secret := range result.VaultNotDeleted {
+		fmt.Printf("Vault secret %s of action %s was not deleted: %s\n", secret.VaultURL, secret.Action, secret.Error)
+	}
+	if result.VaultDeleteFailed > 0 {
+		return fmt.Errorf("%d vault secrets were not deleted", result.VaultDeleteFailed)
+	}
+	return nil
+}
+
 // testAction is the CLI handler. If --file is provided, reads YAML and tests each action.
-// Otherwise tests a single action from flags.
+// Otherwise tests a single action from flags. Actions are executed only with --confirm-real-send.
 func testAction(ctx context.Context, cmd *cli.Command) error {
 	if filePath := cmd.String("file"); filePath != "" {
 		if err := processActionsFromFile(cmd, filePath, sendTestAction); err != nil {
 			return err
 		}
+		if !cmd.Bool("confirm-real-send") {
+			fmt.Println("Actions validated, use --confirm-real-send to execute them")
+			return nil
+		}
 		fmt.Println("Actions tested successfully")
 		return nil
 	}
@@ -478,6 +1689,85 @@ func testAction(ctx context.Context, cmd *cli.Command) error {
 		return err
 	}
 
+	if !cmd.Bool("confirm-real-send") {
+		fmt.Println("Action validated, use --confirm-real-send to execute it")
+		return nil
+	}
 	fmt.Println("Action tested successfully")
 	return nil
 }
+
+// timestampFlag returns value of timestamp flag name, nil when flag is not set.
+func timestampFlag(cmd *cli.Command, name string) *time.Time {
+	if !cmd.IsSet(name) {
+		return nil
+	}
+	t := cmd.Timestamp(name)
+	return &t
+}
+
+// previewAction is the CLI handler. If --file is provided, reads YAML and previews each action.
+// Otherwise previews a single action from flags.
+func previewAction(ctx context.Context, cmd *cli.Command) error {
+	if filePath := cmd.String("file"); filePath != "" {
+		actions, err := loadActionsFromFile(filePath)
+		if err != nil {
+			return fmt.Errorf("unable to load actions from file: %w", err)
+		}
+		if len(actions) == 0 {
+			return fmt.Errorf("no actions found in file")
+		}
+		for i, action := range actions {
+			recipients, err := sendPreviewAction(cmd, action)
+			if err != nil {
+				return fmt.Errorf("action %d: %w", i+1, err)
+			}
+			fmt.Printf("Action %d (%s):\n", i+1, action.Kind)
+			printRecipients(recipients, "  ")
+		}
+		return nil
+	}
+
+	recipients, err := sendPreviewAction(cmd, &state.Action{
+		Kind:         cmd.String("kind"),
+		Data:         cmd.String("data"),
+		ProcessAfter: cmd.Int("process-after"),
+	})
+	if err != nil {
+		return err
+	}
+	printRecipients(recipients, "")
+	return nil
+}
+
+// validateAction is the CLI handler. If --file is provided, reads YAML and validates each action.
+// Otherwise validates a single action from flags.
+func validateAction(ctx context.Context, cmd *cli.Command) error {
+	if filePath := cmd.String("file"); filePath != "" {
+		if err := processActionsFromFile(cmd, filePath, sendValidateAction); err != nil {
+			return err
+		}
+		fmt.Println("Actions validated successfully")
+		return nil
+	}
+
+	if err := sendValidateAction(cmd, &state.Action{
+		Kind:         cmd.String("kind"),
+		Data:         cmd.String("data"),
+		ProcessAfter: cmd.Int("process-after"),
+		MinInterval:  cmd.Int("min-interval"),
+		ProcessUnit:  cmd.String("process-unit"),
+		Deadline:     timestampFlag(cmd, "deadline"),
+		NotBefore:    timestampFlag(cmd, "not-before"),
+		Priority:     cmd.Int("priority"),
+		DedupeWindow: cmd.Int("dedupe-window"),
+		Severity:     cmd.String("severity"),
+		OnSuccess:    cmd.String("on-success"),
+		OnFailure:    cmd.String("on-failure"),
+	}); err != nil {
+		return err
+	}
+
+	fmt.Println("Action validated successfully")
+	return nil
+}
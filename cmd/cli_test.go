@@ -9,11 +9,15 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"regexp"
+	"strings"
 	"testing"
+	"time"
 
 	"dmh/internal/crypt"
 	"dmh/internal/state"
+	"dmh/internal/version"
 
 	"github.com/stretchr/testify/require"
 	"github.com/urfave/cli/v3"
@@ -96,12 +100,273 @@ func TestUpdateAlive(t *testing.T) {
 	}
 }
 
+func TestAliveStatus(t *testing.T) {
+	mockNow := time.Date(2025, 3, 26, 16, 55, 40, 0, time.UTC)
+	tests := []struct {
+		mockHandler    http.HandlerFunc
+		expectedError  string
+		expectedOutput string
+	}{
+		{
+			mockHandler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusUnauthorized)
+			},
+			expectedError: "server returned status 401: ",
+		},
+		{
+			mockHandler: func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("not-json"))
+			},
+			expectedError: "unable to decode response",
+		},
+		{
+			mockHandler: func(w http.ResponseWriter, r *http.Request) {
+				require.Equal(t, "GET", r.Method)
+				require.Equal(t, "/api/status", r.URL.Path)
+				w.Write([]byte(`{"last_seen":"2025-03-26T14:55:40Z"}`))
+			},
+			expectedOutput: "Last seen: 2025-03-26T14:55:40Z (2h0m0s ago)\nNext action: none scheduled\n",
+		},
+		{
+			mockHandler: func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(`{"last_seen":"2025-03-26T14:55:40Z","next_action_at":"2025-03-26T17:25:40Z","next_action_uuid":"first"}`))
+			},
+			expectedOutput: "Last seen: 2025-03-26T14:55:40Z (2h0m0s ago)\nNext action: first at 2025-03-26T17:25:40Z (in 30m0s)\n",
+		},
+		{
+			mockHandler: func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(`{"last_seen":"2025-03-26T14:55:40Z","next_action_at":"2025-03-26T15:55:40Z","next_action_uuid":"first"}`))
+			},
+			expectedOutput: "Last seen: 2025-03-26T14:55:40Z (2h0m0s ago)\nNext action: first at 2025-03-26T15:55:40Z (overdue by 1h0m0s)\n",
+		},
+	}
+	timeNow = func() time.Time { return mockNow }
+	defer func() { timeNow = time.Now }()
+	for _, test := range tests {
+		fakeServer := httptest.NewServer(test.mockHandler)
+		defer fakeServer.Close()
+
+		output, err := captureCLIOutput(t, "dmh-cli", "alive", "status", "--server", fakeServer.URL)
+		if test.expectedError == "" {
+			require.Nil(t, err)
+			require.Equal(t, test.expectedOutput, output)
+		} else {
+			require.NotNil(t, err)
+			require.Contains(t, err.Error(), test.expectedError)
+		}
+	}
+}
+
+func TestShowVersion(t *testing.T) {
+	client := "Client: " + version.Get().String() + "\n"
+	tests := []struct {
+		mockHandler    http.HandlerFunc
+		expectedError  string
+		expectedOutput string
+	}{
+		{
+			mockHandler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusUnauthorized)
+			},
+			expectedError:  "server returned status 401: ",
+			expectedOutput: client,
+		},
+		{
+			mockHandler: func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("not-json"))
+			},
+			expectedError:  "unable to decode response",
+			expectedOutput: client,
+		},
+		{
+			mockHandler: func(w http.ResponseWriter, r *http.Request) {
+				require.Equal(t, "GET", r.Method)
+				require.Equal(t, "/api/version", r.URL.Path)
+				w.Write([]byte(`{"version":"v1.2.3","commit":"abc1234","date":"2025-03-26T14:00:00Z","go_version":"go1.25.0","components":["dmh","vault"]}`))
+			},
+			expectedOutput: client + "Server: v1.2.3 (commit abc1234, built 2025-03-26T14:00:00Z, go1.25.0), components: dmh, vault\n",
+		},
+	}
+	for _, test := range tests {
+		fakeServer := httptest.NewServer(test.mockHandler)
+		defer fakeServer.Close()
+
+		output, err := captureCLIOutput(t, "dmh-cli", "version", "--server", fakeServer.URL)
+		require.Equal(t, test.expectedOutput, output)
+		if test.expectedError == "" {
+			require.Nil(t, err)
+		} else {
+			require.NotNil(t, err)
+			require.Contains(t, err.Error(), test.expectedError)
+		}
+	}
+}
+
+func TestShowSchedule(t *testing.T) {
+	mockNow := time.Date(2025, 3, 26, 16, 55, 40, 0, time.UTC)
+	actions := `[
+		{"uuid":"later","kind":"mail","process_after":100,"comment":"letter to lawyer"},
+		{"uuid":"processed","kind":"mail","process_after":1,"processed":2},
+		{"uuid":"first","kind":"bulksms","process_after":30,"process_unit":"minute"},
+		{"uuid":"overdue","kind":"json_post","process_after":1,"comment":"a, b; c"}
+	]`
+	tests := []struct {
+		args           []string
+		mockStatus     string
+		expectedError  string
+		expectedOutput string
+	}{
+		{
+			args:          []string{"--format", "pdf"},
+			expectedError: "unsupported format pdf",
+		},
+		{
+			mockStatus:    `{"last_seen":"2025-03-26T14:55:40Z"}`,
+			expectedError: `server returned unknown process_unit ""`,
+		},
+		{
+			mockStatus: `{"last_seen":"2025-03-26T14:55:40Z","process_unit":"hour"}`,
+			expectedOutput: "" +
+				"2025-03-26T15:25:40Z  overdue by 1h 30m — bulksms — first\n" +
+				"2025-03-26T15:55:40Z  overdue by 1h 0m — json_post — 'a, b; c'\n" +
+				"2025-03-30T18:55:40Z  in 4d 2h — mail — 'letter to lawyer'\n",
+		},
+		{
+			args:       []string{"--format", "json"},
+			mockStatus: `{"last_seen":"2025-03-26T14:55:40Z","process_unit":"hour","maintenance":{"extend":3600000000000}}`,
+			expectedOutput: `[{"uuid":"first","kind":"bulksms","fire_at":"2025-03-26T16:25:40Z"},` +
+				`{"uuid":"overdue","kind":"json_post","comment":"a, b; c","fire_at":"2025-03-26T16:55:40Z"},` +
+				`{"uuid":"later","kind":"mail","comment":"letter to lawyer","fire_at":"2025-03-30T19:55:40Z"}]` + "\n",
+		},
+		{
+			args:       []string{"--format", "ics"},
+			mockStatus: `{"last_seen":"2025-03-26T16:00:40Z","process_unit":"hour"}`,
+			expectedOutput: "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nPRODID:-//dead-man-hand//dmh-cli//EN\r\nCALSCALE:GREGORIAN\r\n" +
+				"BEGIN:VEVENT\r\nUID:first@dead-man-hand\r\nDTSTAMP:20250326T165540Z\r\nDTSTART:20250326T163040Z\r\n" +
+				"SUMMARY:DMH bulksms action fires\r\nDESCRIPTION:Update alive before this time to postpone action first.\r\n" +
+				"BEGIN:VALARM\r\nACTION:DISPLAY\r\nTRIGGER:-PT1H\r\nDESCRIPTION:DMH bulksms action fires\r\nEND:VALARM\r\nEND:VEVENT\r\n" +
+				"BEGIN:VEVENT\r\nUID:overdue@dead-man-hand\r\nDTSTAMP:20250326T165540Z\r\nDTSTART:20250326T170040Z\r\n" +
+				"SUMMARY:DMH json_post action fires: a\\, b\\; c\r\nDESCRIPTION:Update alive before this time to postpone action overdue.\r\n" +
+				"BEGIN:VALARM\r\nACTION:DISPLAY\r\nTRIGGER:-PT1H\r\nDESCRIPTION:DMH json_post action fires: a\\, b\\; c\r\nEND:VALARM\r\nEND:VEVENT\r\n" +
+				"BEGIN:VEVENT\r\nUID:later@dead-man-hand\r\nDTSTAMP:20250326T165540Z\r\nDTSTART:20250330T200040Z\r\n" +
+				"SUMMARY:DMH mail action fires: letter to lawyer\r\nDESCRIPTION:Update alive before this time to postpone action later.\r\n" +
+				"BEGIN:VALARM\r\nACTION:DISPLAY\r\nTRIGGER:-PT1H\r\nDESCRIPTION:DMH mail action fires: letter to lawyer\r\nEND:VALARM\r\nEND:VEVENT\r\n" +
+				"END:VCALENDAR\r\n",
+		},
+	}
+	timeNow = func() time.Time { return mockNow }
+	defer func() { timeNow = time.Now }()
+	for _, test := range tests {
+		fakeServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/api/status":
+				w.Write([]byte(test.mockStatus))
+			case "/api/action/store":
+				w.Write([]byte(actions))
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+		defer fakeServer.Close()
+
+		output, err := captureCLIOutput(t, append([]string{"dmh-cli", "schedule", "--server", fakeServer.URL}, test.args...)...)
+		if test.expectedError == "" {
+			require.Nil(t, err)
+			require.Equal(t, test.expectedOutput, output)
+		} else {
+			require.NotNil(t, err)
+			require.Contains(t, err.Error(), test.expectedError)
+		}
+	}
+}
+
+func TestRelativeTime(t *testing.T) {
+	require.Equal(t, "in 3d 4h", relativeTime(76*time.Hour+30*time.Minute))
+	require.Equal(t, "in 2h 5m", relativeTime(2*time.Hour+5*time.Minute))
+	require.Equal(t, "in 0m", relativeTime(30*time.Second))
+	require.Equal(t, "overdue by 15m", relativeTime(-15*time.Minute))
+}
+
+func TestShowMetrics(t *testing.T) {
+	tests := []struct {
+		mockHandler    http.HandlerFunc
+		expectedError  string
+		expectedOutput string
+	}{
+		{
+			mockHandler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusUnauthorized)
+			},
+			expectedError: "server returned status 401: ",
+		},
+		{
+			mockHandler: func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("dmh_actions{processed=\"0\" 1\n"))
+			},
+			expectedError: "unable to parse metrics",
+		},
+		{
+			mockHandler: func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("# HELP go_goroutines Number of goroutines.\n# TYPE go_goroutines gauge\ngo_goroutines 10\n"))
+			},
+			expectedOutput: "Actions: no data\nMissing secrets: none\nAction errors: none\n",
+		},
+		{
+			mockHandler: func(w http.ResponseWriter, r *http.Request) {
+				require.Equal(t, "GET", r.Method)
+				require.Equal(t, "/metrics", r.URL.Path)
+				w.Write([]byte(`# TYPE dmh_actions gauge
+dmh_actions{processed="0"} 3
+dmh_actions{processed="1"} 1
+dmh_actions{processed="2"} 2
+# TYPE dmh_missing_secrets_total counter
+dmh_missing_secrets_total{action="b"} 1
+dmh_missing_secrets_total{action="a"} 2
+# TYPE dmh_action_errors_total counter
+dmh_action_errors_total{action="a",error="Run"} 1
+dmh_action_errors_total{action="b",error="DecryptAction"} 3
+dmh_action_errors_total{action="b",error="Run"} 2
+dmh_action_errors_total{action="c",error="Run"} 1
+dmh_action_errors_total{action="d",error="Run"} 1
+dmh_action_errors_total{action="e",error="Run"} 1
+dmh_action_errors_total{action="f",error="Run"} 1
+`))
+			},
+			expectedOutput: "" +
+				"Actions: 3 pending, 1 recurring, 2 fired\n" +
+				"Missing secrets: 2 actions\n" +
+				"  a\n" +
+				"  b\n" +
+				"Action errors: 6 actions, top 5\n" +
+				"  b 5 (DecryptAction: 3, Run: 2)\n" +
+				"  a 1 (Run: 1)\n" +
+				"  c 1 (Run: 1)\n" +
+				"  d 1 (Run: 1)\n" +
+				"  e 1 (Run: 1)\n",
+		},
+	}
+	for _, test := range tests {
+		fakeServer := httptest.NewServer(test.mockHandler)
+		defer fakeServer.Close()
+
+		output, err := captureCLIOutput(t, "dmh-cli", "metrics", "--server", fakeServer.URL)
+		if test.expectedError == "" {
+			require.Nil(t, err)
+			require.Equal(t, test.expectedOutput, output)
+		} else {
+			require.NotNil(t, err)
+			require.Contains(t, err.Error(), test.expectedError)
+		}
+	}
+}
+
 func TestListActions(t *testing.T) {
 	tests := []struct {
 		mockHandler   http.HandlerFunc
 		expectedError string
 		inputServer   string
 		inputToken    string
+		inputParams   []string
 	}{
 		{
 			inputToken: "test-token",
@@ -115,17 +380,654 @@ func TestListActions(t *testing.T) {
 			expectedError: `unable to parse address: parse "\r": net/url: invalid control character in URL`,
 		},
 		{
-			expectedError: `request failed: Get "http://127.0.0.1:8080/api/action/store": dial tcp 127.0.0.1:8080: connect: connection refused`,
+			expectedError: `request failed: Get "http://127.0.0.1:8080/api/action/store": dial tcp 127.0.0.1:8080: connect: connection refused`,
+		},
+		{
+			mockHandler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusInternalServerError)
+			},
+			expectedError: "server returned status 500: ",
+		},
+		{
+			mockHandler: func(w http.ResponseWriter, r *http.Request) {
+				require.Equal(t, "/api/action/store", r.URL.Path)
+				require.Equal(t, "", r.URL.RawQuery)
+				w.WriteHeader(http.StatusOK)
+			},
+		},
+		{
+			inputParams: []string{"--filter-comment", "mail to"},
+			mockHandler: func(w http.ResponseWriter, r *http.Request) {
+				require.Equal(t, "/api/action/store", r.URL.Path)
+				require.Equal(t, "mail to", r.URL.Query().Get("comment"))
+				w.WriteHeader(http.StatusOK)
+			},
+		},
+		{
+			inputParams: []string{"--filter-comment", "mail", "--filter-kind", "mail", "--filter-processed", "0"},
+			mockHandler: func(w http.ResponseWriter, r *http.Request) {
+				require.Equal(t, "comment=mail&kind=mail&processed=0", r.URL.RawQuery)
+				w.WriteHeader(http.StatusOK)
+			},
+		},
+		{
+			inputParams: []string{"--filter-recipient-hash", "abc123"},
+			mockHandler: func(w http.ResponseWriter, r *http.Request) {
+				require.Equal(t, "abc123", r.URL.Query().Get("recipient_hash"))
+				w.WriteHeader(http.StatusOK)
+			},
+		},
+		{
+			inputParams: []string{"--since", "2025-04-01T00:00:00Z", "--until", "2025-04-08T00:00:00+02:00"},
+			mockHandler: func(w http.ResponseWriter, r *http.Request) {
+				require.Equal(t, "", r.URL.Query().Get("comment"))
+				require.Equal(t, "2025-04-01T00:00:00Z", r.URL.Query().Get("fires_after"))
+				require.Equal(t, "2025-04-08T00:00:00+02:00", r.URL.Query().Get("fires_before"))
+				w.WriteHeader(http.StatusOK)
+			},
+		},
+		{
+			inputParams: []string{"--at", "2025-04-01T12:00:00Z"},
+			mockHandler: func(w http.ResponseWriter, r *http.Request) {
+				require.Equal(t, "2025-04-01T12:00:00Z", r.URL.Query().Get("at"))
+				w.WriteHeader(http.StatusOK)
+			},
+		},
+	}
+	for _, test := range tests {
+		var fakeServer *httptest.Server
+		if test.mockHandler != nil {
+			fakeServer = httptest.NewServer(test.mockHandler)
+			defer fakeServer.Close()
+
+			originalGetClient := getClient
+			defer func() { getClient = originalGetClient }()
+			getClient = func(*cli.Command) *http.Client {
+				return fakeServer.Client()
+			}
+		}
+
+		cmd := createCLI()
+		var params []string
+		if test.inputServer != "" {
+			params = []string{"dmh-cli", "action", "list", "--server", test.inputServer}
+		} else if fakeServer != nil {
+			params = []string{"dmh-cli", "action", "list", "--server", fakeServer.URL}
+		} else {
+			params = []string{"dmh-cli", "action", "list"}
+		}
+		if test.inputToken != "" {
+			params = append(params, "--token", test.inputToken)
+		}
+		params = append(params, test.inputParams...)
+
+		err := cmd.Run(context.Background(), params)
+		if test.expectedError == "" {
+			require.Nil(t, err)
+		} else {
+			require.NotNil(t, err)
+			require.Equal(t, test.expectedError, err.Error())
+		}
+
+	}
+}
+
+func TestAddAction(t *testing.T) {
+	tests := []struct {
+		inputParams     []string
+		inputFile       string
+		fileContent     string
+		templateContent string
+		mockHandler     http.HandlerFunc
+		expectedError   string
+	}{
+		{
+			inputFile:     "/nonexistent/actions.yaml",
+			expectedError: "unable to load actions from file",
+		},
+		{
+			inputFile: "testdata/add-success.yaml",
+			fileContent: `- kind: test
+  data: '{"test": true}'
+  process_after: 10
+`,
+			mockHandler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusCreated)
+			},
+		},
+		{
+			inputParams: []string{"--data", `{"test": true}`, "--kind", "test", "--process-after", "10"},
+			mockHandler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusInternalServerError)
+			},
+			expectedError: "server returned status 500: ",
+		},
+		{
+			inputParams: []string{"--data", `{"test": true}`, "--kind", "test", "--process-after", "10"},
+			mockHandler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusCreated)
+			},
+		},
+		{
+			inputParams: []string{"--data", `{"test": true}`, "--kind", "test", "--process-after", "10", "--process-unit", "minute"},
+			mockHandler: func(w http.ResponseWriter, r *http.Request) {
+				var a state.Action
+				require.Nil(t, json.NewDecoder(r.Body).Decode(&a))
+				require.Equal(t, "minute", a.ProcessUnit)
+				w.WriteHeader(http.StatusCreated)
+			},
+		},
+		{
+			inputParams: []string{"--data", `{"message": "secret"}`, "--kind", "dummy", "--process-after", "10", "--recipient-passphrase", "correct horse"},
+			mockHandler: func(w http.ResponseWriter, r *http.Request) {
+				var a state.Action
+				require.Nil(t, json.NewDecoder(r.Body).Decode(&a))
+				data := map[string]string{}
+				require.Nil(t, json.Unmarshal([]byte(a.Data), &data))
+				decrypted, err := crypt.DecryptPassphrase(data["message"], "correct horse")
+				require.Nil(t, err)
+				require.Equal(t, "secret", decrypted)
+				w.WriteHeader(http.StatusCreated)
+			},
+		},
+		{
+			inputParams:   []string{"--data", `{"test": true}`, "--kind", "test", "--process-after", "10", "--recipient-passphrase", "correct horse"},
+			expectedError: "recipient_passphrase is not supported by kind test",
+		},
+		{
+			inputParams:   []string{"--data", `{"test": true}`, "--kind", "test", "--process-after", "10", "--process-unit", "day"},
+			expectedError: "process_unit should be one of second, minute, hour",
+		},
+		{
+			inputParams: []string{"--data", `{"test": true}`, "--kind", "test", "--process-after", "10", "--deadline", "2999-01-01T00:00:00Z"},
+			mockHandler: func(w http.ResponseWriter, r *http.Request) {
+				var a state.Action
+				require.Nil(t, json.NewDecoder(r.Body).Decode(&a))
+				require.NotNil(t, a.Deadline)
+				require.True(t, a.Deadline.Equal(time.Date(2999, 1, 1, 0, 0, 0, 0, time.UTC)))
+				w.WriteHeader(http.StatusCreated)
+			},
+		},
+		{
+			inputParams: []string{"--data", `{"test": true}`, "--kind", "test", "--process-after", "10", "--not-before", "2999-01-01T00:00:00Z"},
+			mockHandler: func(w http.ResponseWriter, r *http.Request) {
+				var a state.Action
+				require.Nil(t, json.NewDecoder(r.Body).Decode(&a))
+				require.NotNil(t, a.NotBefore)
+				require.True(t, a.NotBefore.Equal(time.Date(2999, 1, 1, 0, 0, 0, 0, time.UTC)))
+				require.Nil(t, a.Deadline)
+				w.WriteHeader(http.StatusCreated)
+			},
+		},
+		{
+			inputParams:   []string{"--data", `{"test": true}`, "--kind", "test", "--process-after", "10", "--deadline", "tomorrow"},
+			expectedError: "invalid value",
+		},
+		{
+			inputParams: []string{"--data", `{"test": true}`, "--kind", "test", "--process-after", "10", "--priority", "10"},
+			mockHandler: func(w http.ResponseWriter, r *http.Request) {
+				var a state.Action
+				require.Nil(t, json.NewDecoder(r.Body).Decode(&a))
+				require.Equal(t, 10, a.Priority)
+				w.WriteHeader(http.StatusCreated)
+			},
+		},
+		{
+			inputParams:   []string{"--data", `{"test": true}`, "--kind", "test", "--process-after", "10", "--priority", "1000"},
+			expectedError: "priority should be between -100 and 100",
+		},
+		{
+			inputParams: []string{"--data", `{"test": true}`, "--kind", "test", "--process-after", "10", "--depends-on", "a", "--depends-on", "b", "--depends-delay", "24"},
+			mockHandler: func(w http.ResponseWriter, r *http.Request) {
+				var a state.Action
+				require.Nil(t, json.NewDecoder(r.Body).Decode(&a))
+				require.Equal(t, []string{"a", "b"}, a.DependsOn)
+				require.Equal(t, 24, a.DependsDelay)
+				w.WriteHeader(http.StatusCreated)
+			},
+		},
+		{
+			inputParams:   []string{"--data", `{"test": true}`, "--kind", "test", "--process-after", "10", "--depends-delay", "24"},
+			expectedError: "depends_delay requires depends_on",
+		},
+		{
+			inputParams: []string{"--data", `{"test": true}`, "--kind", "test", "--process-after", "10", "--min-interval", "24", "--dedupe-window", "72"},
+			mockHandler: func(w http.ResponseWriter, r *http.Request) {
+				var a state.Action
+				require.Nil(t, json.NewDecoder(r.Body).Decode(&a))
+				require.Equal(t, 72, a.DedupeWindow)
+				w.WriteHeader(http.StatusCreated)
+			},
+		},
+		{
+			inputParams:   []string{"--data", `{"test": true}`, "--kind", "test", "--process-after", "10", "--dedupe-window", "72"},
+			expectedError: "dedupe_window requires min_interval",
+		},
+		{
+			inputParams: []string{"--data", `{"test": true}`, "--kind", "test", "--process-after", "10", "--severity", "destructive"},
+			mockHandler: func(w http.ResponseWriter, r *http.Request) {
+				var a state.Action
+				require.Nil(t, json.NewDecoder(r.Body).Decode(&a))
+				require.Equal(t, state.SeverityDestructive, a.Severity)
+				w.WriteHeader(http.StatusCreated)
+			},
+		},
+		{
+			inputParams:   []string{"--data", `{"test": true}`, "--kind", "test", "--process-after", "10", "--severity", "critical"},
+			expectedError: "severity should be one of notify, destructive",
+		},
+		{
+			inputParams: []string{"--data", `{"test": true}`, "--kind", "test", "--process-after", "10", "--on-success", "https://example.com/ok", "--on-failure", "https://example.com/failed"},
+			mockHandler: func(w http.ResponseWriter, r *http.Request) {
+				var a state.Action
+				require.Nil(t, json.NewDecoder(r.Body).Decode(&a))
+				require.Equal(t, "https://example.com/ok", a.OnSuccess)
+				require.Equal(t, "https://example.com/failed", a.OnFailure)
+				w.WriteHeader(http.StatusCreated)
+			},
+		},
+		{
+			inputParams:   []string{"--from-file", "/nonexistent/template.json"},
+			expectedError: "unable to load action template",
+		},
+		{
+			inputParams:     []string{"--from-file", "testdata/template.json"},
+			templateContent: `{"kind": "json_post", "data": {"url": "http://test"}, "process_after": 10, "min_interval": 2, "comment": "template"}`,
+			mockHandler: func(w http.ResponseWriter, r *http.Request) {
+				var a state.Action
+				require.Nil(t, json.NewDecoder(r.Body).Decode(&a))
+				require.Equal(t, state.Action{Kind: "json_post", Data: `{"url":"http://test"}`, ProcessAfter: 10, MinInterval: 2, Comment: "template"}, a)
+				w.WriteHeader(http.StatusCreated)
+			},
+		},
+		{
+			inputParams:     []string{"--from-file", "testdata/template.json", "--comment", "clone", "--process-after", "20", "--min-interval", "0"},
+			templateContent: `{"kind": "json_post", "data": "{\"url\": \"http://test\"}", "process_after": 10, "min_interval": 2, "comment": "template"}`,
+			mockHandler: func(w http.ResponseWriter, r *http.Request) {
+				var a state.Action
+				require.Nil(t, json.NewDecoder(r.Body).Decode(&a))
+				require.Equal(t, state.Action{Kind: "json_post", Data: `{"url": "http://test"}`, ProcessAfter: 20, MinInterval: 0, Comment: "clone"}, a)
+				w.WriteHeader(http.StatusCreated)
+			},
+		},
+		{
+			inputParams:     []string{"--from-file", "testdata/template.json"},
+			templateContent: `{"kind": "json_post", "data": {"url": "http://test"}}`,
+			expectedError:   "process_after should be greater than 0",
+		},
+	}
+
+	os.MkdirAll("testdata", 0755)
+	defer os.RemoveAll("testdata")
+
+	for _, test := range tests {
+		if test.fileContent != "" {
+			err := os.WriteFile(test.inputFile, []byte(test.fileContent), 0644)
+			require.NoError(t, err)
+		}
+		if test.templateContent != "" {
+			err := os.WriteFile("testdata/template.json", []byte(test.templateContent), 0644)
+			require.NoError(t, err)
+		}
+
+		var fakeServer *httptest.Server
+		if test.mockHandler != nil {
+			fakeServer = httptest.NewServer(test.mockHandler)
+			defer fakeServer.Close()
+
+			originalGetClient := getClient
+			defer func() { getClient = originalGetClient }()
+			getClient = func(*cli.Command) *http.Client {
+				return fakeServer.Client()
+			}
+		}
+
+		cmd := createCLI()
+		params := []string{"dmh-cli", "action", "add"}
+		if fakeServer != nil {
+			params = append(params, "--server", fakeServer.URL)
+		}
+		if test.inputFile != "" {
+			params = append(params, "--file", test.inputFile)
+		}
+		params = append(params, test.inputParams...)
+
+		err := cmd.Run(context.Background(), params)
+
+		if test.expectedError == "" {
+			require.Nil(t, err)
+		} else {
+			require.NotNil(t, err)
+			require.Contains(t, err.Error(), test.expectedError)
+		}
+	}
+}
+
+func TestTestAction(t *testing.T) {
+	tests := []struct {
+		inputParams     []string
+		inputFile       string
+		fileContent     string
+		templateContent string
+		mockHandler     http.HandlerFunc
+		expectedError   string
+		expectedOutput  string
+	}{
+		{
+			inputFile:     "/nonexistent/actions.yaml",
+			expectedError: "unable to load actions from file",
+		},
+		{
+			inputFile: "testdata/test-success.yaml",
+			fileContent: `- kind: test
+  data: '{"test": true}'
+  process_after: 10
+`,
+			inputParams: []string{"--confirm-real-send"},
+			mockHandler: func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				require.Contains(t, string(body), `"confirm":true`)
+				w.WriteHeader(http.StatusOK)
+			},
+			expectedOutput: "Actions tested successfully",
+		},
+		{
+			inputFile: "testdata/test-dry-run.yaml",
+			fileContent: `- kind: test
+  data: '{"test": true}'
+  process_after: 10
+`,
+			mockHandler: func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(`{"dry_run":true,"recipients":[]}`))
+			},
+			expectedOutput: "Actions validated, use --confirm-real-send to execute them",
+		},
+		{
+			inputParams: []string{"--data", `{"test": true}`, "--kind", "test", "--process-after", "10"},
+			mockHandler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusInternalServerError)
+			},
+			expectedError: "server returned status 500: ",
+		},
+		{
+			inputParams: []string{"--data", `{"test": true}`, "--kind", "test", "--process-after", "10", "--confirm-real-send"},
+			mockHandler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			},
+			expectedOutput: "Action tested successfully",
+		},
+		{
+			inputParams: []string{"--data", `{"test": true}`, "--kind", "test", "--process-after", "10"},
+			mockHandler: func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				require.Contains(t, string(body), `"confirm":false`)
+				w.Write([]byte(`{"dry_run":true,"recipients":[{"type":"mail","address":"a@b.com"}]}`))
+			},
+			expectedOutput: "Action test was not run, it would be delivered to:\n  mail: a@b.com\nAction validated, use --confirm-real-send to execute it",
+		},
+		{
+			inputParams: []string{"--data", `{"test": true}`, "--kind", "test", "--process-after", "10"},
+			mockHandler: func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(`not json`))
+			},
+			expectedError: "unable to decode response",
+		},
+	}
+
+	os.MkdirAll("testdata", 0755)
+	defer os.RemoveAll("testdata")
+
+	for _, test := range tests {
+		if test.fileContent != "" {
+			err := os.WriteFile(test.inputFile, []byte(test.fileContent), 0644)
+			require.NoError(t, err)
+		}
+
+		var fakeServer *httptest.Server
+		if test.mockHandler != nil {
+			fakeServer = httptest.NewServer(test.mockHandler)
+			defer fakeServer.Close()
+
+			originalGetClient := getClient
+			defer func() { getClient = originalGetClient }()
+			getClient = func(*cli.Command) *http.Client {
+				return fakeServer.Client()
+			}
+		}
+
+		params := []string{"dmh-cli", "action", "test"}
+		if fakeServer != nil {
+			params = append(params, "--server", fakeServer.URL)
+		}
+		if test.inputFile != "" {
+			params = append(params, "--file", test.inputFile)
+		}
+		params = append(params, test.inputParams...)
+
+		output, err := captureCLIOutput(t, params...)
+
+		if test.expectedError == "" {
+			require.Nil(t, err)
+			require.Contains(t, output, test.expectedOutput)
+		} else {
+			require.NotNil(t, err)
+			require.Contains(t, err.Error(), test.expectedError)
+		}
+	}
+}
+
+func TestValidateAction(t *testing.T) {
+	tests := []struct {
+		inputParams   []string
+		inputFile     string
+		fileContent   string
+		mockHandler   http.HandlerFunc
+		expectedError string
+	}{
+		{
+			inputFile:     "/nonexistent/actions.yaml",
+			expectedError: "unable to load actions from file",
+		},
+		{
+			inputFile: "testdata/validate-success.yaml",
+			fileContent: `- kind: test
+  data: '{"test": true}'
+  process_after: 10
+`,
+			mockHandler: func(w http.ResponseWriter, r *http.Request) {
+				require.Equal(t, "/api/action/validate", r.URL.Path)
+				w.WriteHeader(http.StatusOK)
+			},
+		},
+		{
+			inputParams: []string{"--data", `{"test": true}`, "--kind", "test", "--process-after", "10"},
+			mockHandler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"status":"Invalid request.","error":"message must be provided"}`))
+			},
+			expectedError: "server returned status 400: ",
+		},
+		{
+			inputParams: []string{"--data", `{"test": true}`, "--kind", "test", "--process-after", "10", "--min-interval", "2"},
+			mockHandler: func(w http.ResponseWriter, r *http.Request) {
+				require.Equal(t, "/api/action/validate", r.URL.Path)
+				var a state.Action
+				require.Nil(t, json.NewDecoder(r.Body).Decode(&a))
+				require.Equal(t, state.Action{Kind: "test", Data: `{"test": true}`, ProcessAfter: 10, MinInterval: 2}, a)
+				w.WriteHeader(http.StatusOK)
+			},
+		},
+	}
+
+	os.MkdirAll("testdata", 0755)
+	defer os.RemoveAll("testdata")
+
+	for _, test := range tests {
+		if test.fileContent != "" {
+			err := os.WriteFile(test.inputFile, []byte(test.fileContent), 0644)
+			require.NoError(t, err)
+		}
+
+		var fakeServer *httptest.Server
+		if test.mockHandler != nil {
+			fakeServer = httptest.NewServer(test.mockHandler)
+			defer fakeServer.Close()
+
+			originalGetClient := getClient
+			defer func() { getClient = originalGetClient }()
+			getClient = func(*cli.Command) *http.Client {
+				return fakeServer.Client()
+			}
+		}
+
+		cmd := createCLI()
+		params := []string{"dmh-cli", "action", "validate"}
+		if fakeServer != nil {
+			params = append(params, "--server", fakeServer.URL)
+		}
+		if test.inputFile != "" {
+			params = append(params, "--file", test.inputFile)
+		}
+		params = append(params, test.inputParams...)
+
+		err := cmd.Run(context.Background(), params)
+
+		if test.expectedError == "" {
+			require.Nil(t, err)
+		} else {
+			require.NotNil(t, err)
+			require.Contains(t, err.Error(), test.expectedError)
+		}
+	}
+}
+
+func TestPreviewAction(t *testing.T) {
+	tests := []struct {
+		inputParams    []string
+		inputFile      string
+		fileContent    string
+		mockHandler    http.HandlerFunc
+		expectedError  string
+		expectedOutput string
+	}{
+		{
+			inputFile:     "/nonexistent/actions.yaml",
+			expectedError: "unable to load actions from file",
+		},
+		{
+			inputParams: []string{"--data", `{"test": true}`, "--kind", "mail", "--process-after", "10"},
+			mockHandler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusBadRequest)
+			},
+			expectedError: "server returned status 400: ",
+		},
+		{
+			inputParams: []string{"--data", `{"test": true}`, "--kind", "mail", "--process-after", "10"},
+			mockHandler: func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("not-json"))
+			},
+			expectedError: "unable to decode response",
+		},
+		{
+			inputParams: []string{"--data", `{"test": true}`, "--kind", "mail", "--process-after", "10"},
+			mockHandler: func(w http.ResponseWriter, r *http.Request) {
+				require.Equal(t, "POST", r.Method)
+				require.Equal(t, "/api/action/preview", r.URL.Path)
+				var a state.Action
+				require.Nil(t, json.NewDecoder(r.Body).Decode(&a))
+				require.Equal(t, state.Action{Kind: "mail", Data: `{"test": true}`, ProcessAfter: 10}, a)
+				w.Write([]byte(`{"recipients":[{"type":"mail","address":"a@b.com"},{"type":"mail","address":"c@d.com"}]}`))
+			},
+			expectedOutput: "mail: a@b.com\nmail: c@d.com\n",
+		},
+		{
+			inputFile: "testdata/preview-success.yaml",
+			fileContent: `- kind: mail
+  data: '{"test": true}'
+  process_after: 10
+- kind: dummy
+  data: '{"message": "test"}'
+  process_after: 10
+`,
+			mockHandler: func(w http.ResponseWriter, r *http.Request) {
+				var a state.Action
+				require.Nil(t, json.NewDecoder(r.Body).Decode(&a))
+				if a.Kind == "dummy" {
+					w.Write([]byte(`{"recipients":[]}`))
+					return
+				}
+				w.Write([]byte(`{"recipients":[{"type":"mail","address":"a@b.com"}]}`))
+			},
+			expectedOutput: "Action 1 (mail):\n  mail: a@b.com\nAction 2 (dummy):\n  no recipients\n",
+		},
+	}
+
+	os.MkdirAll("testdata", 0755)
+	defer os.RemoveAll("testdata")
+
+	for _, test := range tests {
+		if test.fileContent != "" {
+			require.NoError(t, os.WriteFile(test.inputFile, []byte(test.fileContent), 0644))
+		}
+
+		params := []string{"dmh-cli", "action", "preview"}
+		if test.mockHandler != nil {
+			fakeServer := httptest.NewServer(test.mockHandler)
+			defer fakeServer.Close()
+			params = append(params, "--server", fakeServer.URL)
+		}
+		if test.inputFile != "" {
+			params = append(params, "--file", test.inputFile)
+		}
+		params = append(params, test.inputParams...)
+
+		output, err := captureCLIOutput(t, params...)
+		if test.expectedError == "" {
+			require.Nil(t, err)
+			require.Equal(t, test.expectedOutput, output)
+		} else {
+			require.NotNil(t, err)
+			require.Contains(t, err.Error(), test.expectedError)
+		}
+	}
+}
+
+func TestDeleteAction(t *testing.T) {
+	tests := []struct {
+		inputParams   []string
+		inputServer   string
+		mockHandler   http.HandlerFunc
+		expectedError string
+	}{
+		{
+			inputParams:   []string{},
+			expectedError: `Required flag "uuid" not set`,
+		},
+		{
+			inputParams:   []string{"--uuid", ""},
+			expectedError: "uuid is required",
+		},
+		{
+			inputServer:   "\r",
+			inputParams:   []string{"--uuid", "test-uuid"},
+			expectedError: `unable to parse address: parse "\r": net/url: invalid control character in URL`,
+		},
+		{
+			inputParams:   []string{"--uuid", "test-uuid"},
+			expectedError: `request failed: Delete "http://127.0.0.1:8080/api/action/store/test-uuid": dial tcp 127.0.0.1:8080: connect: connection refused`,
 		},
 		{
+			inputParams: []string{"--uuid", "test-uuid"},
 			mockHandler: func(w http.ResponseWriter, r *http.Request) {
 				w.WriteHeader(http.StatusInternalServerError)
 			},
 			expectedError: "server returned status 500: ",
 		},
 		{
+			inputParams: []string{"--uuid", "test-uuid"},
 			mockHandler: func(w http.ResponseWriter, r *http.Request) {
-				require.Equal(t, "/api/action/store", r.URL.Path)
+				require.Equal(t, "DELETE", r.Method)
+				require.Equal(t, "/api/action/store/test-uuid", r.URL.Path)
 				w.WriteHeader(http.StatusOK)
 			},
 		},
@@ -146,73 +1048,75 @@ func TestListActions(t *testing.T) {
 		cmd := createCLI()
 		var params []string
 		if test.inputServer != "" {
-			params = []string{"dmh-cli", "action", "list", "--server", test.inputServer}
+			params = []string{"dmh-cli", "action", "delete", "--server", test.inputServer}
 		} else if fakeServer != nil {
-			params = []string{"dmh-cli", "action", "list", "--server", fakeServer.URL}
+			params = []string{"dmh-cli", "action", "delete", "--server", fakeServer.URL}
 		} else {
-			params = []string{"dmh-cli", "action", "list"}
-		}
-		if test.inputToken != "" {
-			params = append(params, "--token", test.inputToken)
+			params = []string{"dmh-cli", "action", "delete"}
 		}
 
+		params = append(params, test.inputParams...)
+
 		err := cmd.Run(context.Background(), params)
 		if test.expectedError == "" {
 			require.Nil(t, err)
 		} else {
 			require.NotNil(t, err)
-			require.Equal(t, test.expectedError, err.Error())
+			require.Contains(t, err.Error(), test.expectedError)
 		}
-
 	}
 }
 
-func TestAddAction(t *testing.T) {
+func TestPurgeActions(t *testing.T) {
 	tests := []struct {
 		inputParams   []string
-		inputFile     string
-		fileContent   string
 		mockHandler   http.HandlerFunc
 		expectedError string
 	}{
 		{
-			inputFile:     "/nonexistent/actions.yaml",
-			expectedError: "unable to load actions from file",
+			inputParams:   []string{},
+			expectedError: "purge deletes all actions, confirm with --yes",
 		},
 		{
-			inputFile: "testdata/add-success.yaml",
-			fileContent: `- kind: test
-  data: '{"test": true}'
-  process_after: 10
-`,
+			inputParams: []string{"--yes"},
 			mockHandler: func(w http.ResponseWriter, r *http.Request) {
-				w.WriteHeader(http.StatusCreated)
+				w.WriteHeader(http.StatusInternalServerError)
 			},
+			expectedError: "server returned status 500: ",
 		},
 		{
-			inputParams: []string{"--data", `{"test": true}`, "--kind", "test", "--process-after", "10"},
+			inputParams: []string{"--yes"},
 			mockHandler: func(w http.ResponseWriter, r *http.Request) {
-				w.WriteHeader(http.StatusInternalServerError)
+				w.Write([]byte("not-json"))
 			},
-			expectedError: "server returned status 500: ",
+			expectedError: "unable to decode response",
 		},
 		{
-			inputParams: []string{"--data", `{"test": true}`, "--kind", "test", "--process-after", "10"},
+			inputParams: []string{"--yes"},
 			mockHandler: func(w http.ResponseWriter, r *http.Request) {
-				w.WriteHeader(http.StatusCreated)
+				require.Equal(t, "POST", r.Method)
+				require.Equal(t, "/api/action/purge", r.URL.Path)
+				require.Empty(t, r.URL.Query().Get("keep_vault_secrets"))
+				w.Write([]byte(`{"deleted":2,"vault_delete_failed":0}`))
+			},
+		},
+		{
+			inputParams: []string{"--yes"},
+			mockHandler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusMultiStatus)
+				w.Write([]byte(`{"deleted":2,"vault_delete_failed":1,"vault_not_deleted":[{"action":"a","vault_url":"http://vault/a","error":"locked"}]}`))
+			},
+			expectedError: "1 vault secrets were not deleted",
+		},
+		{
+			inputParams: []string{"--yes", "--keep-vault-secrets"},
+			mockHandler: func(w http.ResponseWriter, r *http.Request) {
+				require.Equal(t, "true", r.URL.Query().Get("keep_vault_secrets"))
+				w.Write([]byte(`{"deleted":2,"vault_delete_failed":0}`))
 			},
 		},
 	}
-
-	os.MkdirAll("testdata", 0755)
-	defer os.RemoveAll("testdata")
-
 	for _, test := range tests {
-		if test.fileContent != "" {
-			err := os.WriteFile(test.inputFile, []byte(test.fileContent), 0644)
-			require.NoError(t, err)
-		}
-
 		var fakeServer *httptest.Server
 		if test.mockHandler != nil {
 			fakeServer = httptest.NewServer(test.mockHandler)
@@ -226,17 +1130,13 @@ func TestAddAction(t *testing.T) {
 		}
 
 		cmd := createCLI()
-		params := []string{"dmh-cli", "action", "add"}
+		params := []string{"dmh-cli", "action", "purge"}
 		if fakeServer != nil {
 			params = append(params, "--server", fakeServer.URL)
 		}
-		if test.inputFile != "" {
-			params = append(params, "--file", test.inputFile)
-		}
 		params = append(params, test.inputParams...)
 
 		err := cmd.Run(context.Background(), params)
-
 		if test.expectedError == "" {
 			require.Nil(t, err)
 		} else {
@@ -246,76 +1146,46 @@ func TestAddAction(t *testing.T) {
 	}
 }
 
-func TestTestAction(t *testing.T) {
+func TestReorderActions(t *testing.T) {
 	tests := []struct {
 		inputParams   []string
-		inputFile     string
-		fileContent   string
 		mockHandler   http.HandlerFunc
 		expectedError string
 	}{
 		{
-			inputFile:     "/nonexistent/actions.yaml",
-			expectedError: "unable to load actions from file",
-		},
-		{
-			inputFile: "testdata/test-success.yaml",
-			fileContent: `- kind: test
-  data: '{"test": true}'
-  process_after: 10
-`,
-			mockHandler: func(w http.ResponseWriter, r *http.Request) {
-				w.WriteHeader(http.StatusOK)
-			},
-		},
-		{
-			inputParams: []string{"--data", `{"test": true}`, "--kind", "test", "--process-after", "10"},
+			inputParams: []string{"--uuid", "b", "--uuid", "a"},
 			mockHandler: func(w http.ResponseWriter, r *http.Request) {
-				w.WriteHeader(http.StatusInternalServerError)
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"error":"order is not a permutation of actions"}`))
 			},
-			expectedError: "server returned status 500: ",
+			expectedError: "server returned status 400",
 		},
 		{
-			inputParams: []string{"--data", `{"test": true}`, "--kind", "test", "--process-after", "10"},
+			inputParams: []string{"--uuid", "b", "--uuid", "a"},
 			mockHandler: func(w http.ResponseWriter, r *http.Request) {
-				w.WriteHeader(http.StatusOK)
+				require.Equal(t, "POST", r.Method)
+				require.Equal(t, "/api/action/reorder", r.URL.Path)
+				body, err := io.ReadAll(r.Body)
+				require.Nil(t, err)
+				require.JSONEq(t, `{"uuids":["b","a"]}`, string(body))
+				w.Write([]byte(`{"status":"success"}`))
 			},
 		},
 	}
-
-	os.MkdirAll("testdata", 0755)
-	defer os.RemoveAll("testdata")
-
 	for _, test := range tests {
-		if test.fileContent != "" {
-			err := os.WriteFile(test.inputFile, []byte(test.fileContent), 0644)
-			require.NoError(t, err)
-		}
-
-		var fakeServer *httptest.Server
-		if test.mockHandler != nil {
-			fakeServer = httptest.NewServer(test.mockHandler)
-			defer fakeServer.Close()
+		fakeServer := httptest.NewServer(test.mockHandler)
+		defer fakeServer.Close()
 
-			originalGetClient := getClient
-			defer func() { getClient = originalGetClient }()
-			getClient = func(*cli.Command) *http.Client {
-				return fakeServer.Client()
-			}
+		originalGetClient := getClient
+		defer func() { getClient = originalGetClient }()
+		getClient = func(*cli.Command) *http.Client {
+			return fakeServer.Client()
 		}
 
 		cmd := createCLI()
-		params := []string{"dmh-cli", "action", "test"}
-		if fakeServer != nil {
-			params = append(params, "--server", fakeServer.URL)
-		}
-		if test.inputFile != "" {
-			params = append(params, "--file", test.inputFile)
-		}
-		params = append(params, test.inputParams...)
+		params := append([]string{"dmh-cli", "action", "reorder", "--server", fakeServer.URL}, test.inputParams...)
 
 		err := cmd.Run(context.Background(), params)
-
 		if test.expectedError == "" {
 			require.Nil(t, err)
 		} else {
@@ -325,43 +1195,29 @@ func TestTestAction(t *testing.T) {
 	}
 }
 
-func TestDeleteAction(t *testing.T) {
+func TestMarkGone(t *testing.T) {
 	tests := []struct {
 		inputParams   []string
-		inputServer   string
 		mockHandler   http.HandlerFunc
 		expectedError string
 	}{
 		{
 			inputParams:   []string{},
-			expectedError: `Required flag "uuid" not set`,
-		},
-		{
-			inputParams:   []string{"--uuid", ""},
-			expectedError: "uuid is required",
-		},
-		{
-			inputServer:   "\r",
-			inputParams:   []string{"--uuid", "test-uuid"},
-			expectedError: `unable to parse address: parse "\r": net/url: invalid control character in URL`,
+			expectedError: "gone arms all actions, confirm with --yes",
 		},
 		{
-			inputParams:   []string{"--uuid", "test-uuid"},
-			expectedError: `request failed: Delete "http://127.0.0.1:8080/api/action/store/test-uuid": dial tcp 127.0.0.1:8080: connect: connection refused`,
-		},
-		{
-			inputParams: []string{"--uuid", "test-uuid"},
+			inputParams: []string{"--yes"},
 			mockHandler: func(w http.ResponseWriter, r *http.Request) {
-				w.WriteHeader(http.StatusInternalServerError)
+				w.WriteHeader(http.StatusForbidden)
 			},
-			expectedError: "server returned status 500: ",
+			expectedError: "server returned status 403: ",
 		},
 		{
-			inputParams: []string{"--uuid", "test-uuid"},
+			inputParams: []string{"--yes"},
 			mockHandler: func(w http.ResponseWriter, r *http.Request) {
 				require.Equal(t, "DELETE", r.Method)
-				require.Equal(t, "/api/action/store/test-uuid", r.URL.Path)
-				w.WriteHeader(http.StatusOK)
+				require.Equal(t, "/api/alive", r.URL.Path)
+				w.Write([]byte(`{"status":"success"}`))
 			},
 		},
 	}
@@ -379,15 +1235,10 @@ func TestDeleteAction(t *testing.T) {
 		}
 
 		cmd := createCLI()
-		var params []string
-		if test.inputServer != "" {
-			params = []string{"dmh-cli", "action", "delete", "--server", test.inputServer}
-		} else if fakeServer != nil {
-			params = []string{"dmh-cli", "action", "delete", "--server", fakeServer.URL}
-		} else {
-			params = []string{"dmh-cli", "action", "delete"}
+		params := []string{"dmh-cli", "alive", "gone"}
+		if fakeServer != nil {
+			params = append(params, "--server", fakeServer.URL)
 		}
-
 		params = append(params, test.inputParams...)
 
 		err := cmd.Run(context.Background(), params)
@@ -470,6 +1321,36 @@ func TestLoadActionsFromFile(t *testing.T) {
 `,
 			expectedLen: 1,
 		},
+		{
+			inputFile: "testdata/native-deadline.yaml",
+			fileContent: `- kind: dummy
+  data:
+    message: test
+  process_after: 12
+  deadline: 2999-01-01T00:00:00Z
+`,
+			expectedLen: 1,
+		},
+		{
+			inputFile: "testdata/native-priority.yaml",
+			fileContent: `- kind: dummy
+  data:
+    message: test
+  process_after: 12
+  priority: -200
+`,
+			expectedError: "action #1: priority should be between -100 and 100",
+		},
+		{
+			inputFile: "testdata/native-depends-on.yaml",
+			fileContent: `- kind: dummy
+  data:
+    message: test
+  process_after: 12
+  depends_on: [a, a]
+`,
+			expectedError: "action #1: depends_on contains a more than once",
+		},
 		{
 			inputFile: "testdata/load-invalid-action.yaml",
 			fileContent: `- kind: dummy
@@ -627,6 +1508,145 @@ func TestActionDataUnmarshalYAML(t *testing.T) {
 	}
 }
 
+func TestVaultCountdown(t *testing.T) {
+	mockNow := time.Date(2025, 3, 26, 14, 55, 40, 0, time.UTC)
+	tests := []struct {
+		inputParams    []string
+		mockHandler    http.HandlerFunc
+		expectedError  string
+		expectedOutput string
+	}{
+		{
+			inputParams:   []string{"--client-uuid", "client"},
+			expectedError: `Required flag "secret-uuid" not set`,
+		},
+		{
+			inputParams:   []string{"--client-uuid", "", "--secret-uuid", "secret"},
+			expectedError: "client-uuid and secret-uuid are required",
+		},
+		{
+			inputParams: []string{"--client-uuid", "client", "--secret-uuid", "secret"},
+			mockHandler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusUnauthorized)
+			},
+			expectedError: "server returned status 401",
+		},
+		{
+			inputParams: []string{"--client-uuid", "client", "--secret-uuid", "secret"},
+			mockHandler: func(w http.ResponseWriter, r *http.Request) {
+				require.Equal(t, "HEAD", r.Method)
+				require.Equal(t, "/api/vault/store/client/secret", r.URL.Path)
+				w.WriteHeader(http.StatusOK)
+			},
+			expectedOutput: "Secret released\n",
+		},
+		{
+			inputParams: []string{"--client-uuid", "client", "--secret-uuid", "secret"},
+			mockHandler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNotFound)
+			},
+			expectedOutput: "Secret missing\n",
+		},
+		{
+			inputParams: []string{"--client-uuid", "client", "--secret-uuid", "secret"},
+			mockHandler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Retry-After", "5400")
+				w.WriteHeader(http.StatusLocked)
+			},
+			expectedOutput: "Secret releases in 1h30m0s (at 2025-03-26T16:25:40Z)\n",
+		},
+		{
+			inputParams: []string{"--client-uuid", "client", "--secret-uuid", "secret"},
+			mockHandler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusLocked)
+			},
+			expectedOutput: "Secret not released\n",
+		},
+	}
+	timeNow = func() time.Time { return mockNow }
+	defer func() { timeNow = time.Now }()
+	for _, test := range tests {
+		args := []string{"dmh-cli", "vault", "countdown"}
+		if test.mockHandler != nil {
+			fakeServer := httptest.NewServer(test.mockHandler)
+			defer fakeServer.Close()
+			args = append(args, "--server", fakeServer.URL)
+		}
+
+		output, err := captureCLIOutput(t, append(args, test.inputParams...)...)
+		if test.expectedError == "" {
+			require.Nil(t, err)
+			require.Equal(t, test.expectedOutput, output)
+		} else {
+			require.NotNil(t, err)
+			require.Contains(t, err.Error(), test.expectedError)
+		}
+	}
+}
+
+func TestWatchAction(t *testing.T) {
+	mockNow := time.Date(2025, 3, 26, 14, 55, 40, 0, time.UTC)
+	timeNow = func() time.Time { return mockNow }
+	defer func() { timeNow = time.Now }()
+
+	var polls int
+	var vaultURL string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/action/store/uuid", func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "GET", r.Method)
+		require.Equal(t, "Bearer dmh-token", r.Header.Get("Authorization"))
+		polls++
+		processed := map[int]int{1: 0, 2: 0, 3: 1}[polls]
+		if polls > 3 {
+			processed = 2
+		}
+		fmt.Fprintf(w, `{"uuid":"uuid","processed":%d,"encryption":{"vault_url":%q},"next_fire_at":null}`, processed, vaultURL)
+	})
+	mux.HandleFunc("/api/vault/store/client/uuid", func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "HEAD", r.Method)
+		require.Equal(t, "Bearer vault-token", r.Header.Get("Authorization"))
+		switch {
+		case polls == 1:
+			w.WriteHeader(http.StatusLocked)
+		case polls <= 3:
+			w.WriteHeader(http.StatusOK)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	fakeServer := httptest.NewServer(mux)
+	defer fakeServer.Close()
+	vaultURL = fakeServer.URL + "/api/vault/store/client/uuid"
+
+	args := []string{"dmh-cli", "--server", fakeServer.URL, "--token", "dmh-token", "action", "watch", "--uuid", "uuid", "--interval", "1ms", "--vault-token", "vault-token"}
+	output, err := captureCLIOutput(t, args...)
+	require.Nil(t, err)
+	require.Equal(t, `2025-03-26T14:55:40Z processed=pending vault=locked
+2025-03-26T14:55:40Z processed=pending vault=released
+2025-03-26T14:55:40Z processed=executed vault=released
+2025-03-26T14:55:40Z processed=done vault=missing
+Action uuid fired
+`, output)
+	require.Equal(t, 4, polls)
+
+	polls = 0
+	output, err = captureCLIOutput(t, append(args, "--until", "released")...)
+	require.Nil(t, err)
+	require.Equal(t, "2025-03-26T14:55:40Z processed=pending vault=locked\n2025-03-26T14:55:40Z processed=pending vault=released\nAction uuid released\n", output)
+
+	polls = 0
+	vaultURL = ""
+	output, err = captureCLIOutput(t, append(args, "--timeout", "10ms", "--interval", "1h")...)
+	require.EqualError(t, err, "action was not fired within 10ms, last state: processed=pending vault=-")
+	require.Equal(t, "2025-03-26T14:55:40Z processed=pending vault=-\n", output)
+
+	_, err = captureCLIOutput(t, append(args, "--until", "deleted")...)
+	require.EqualError(t, err, "until must be released or fired")
+
+	_, err = captureCLIOutput(t, "dmh-cli", "--server", fakeServer.URL, "action", "watch", "--uuid", "missing")
+	require.ErrorContains(t, err, "server returned status 404")
+}
+
 // captureCLIOutput runs the CLI with the given args and returns captured stdout.
 func captureCLIOutput(t *testing.T, args ...string) (string, error) {
 	t.Helper()
@@ -694,7 +1714,7 @@ func TestGenBearer(t *testing.T) {
 func TestCreateCLI(t *testing.T) {
 	cmd := createCLI()
 	require.Equal(t, "dmh-client", cmd.Name)
-	require.Equal(t, "1.0.0", cmd.Version)
+	require.Equal(t, version.Get().String(), cmd.Version)
 
 	var flagNames []string
 	for _, f := range cmd.Flags {
@@ -707,7 +1727,79 @@ func TestCreateCLI(t *testing.T) {
 	for _, c := range cmd.Commands {
 		cmdNames = append(cmdNames, c.Name)
 	}
-	require.ElementsMatch(t, []string{"alive", "action", "crypt"}, cmdNames)
+	require.ElementsMatch(t, []string{"alive", "metrics", "schedule", "action", "vault", "crypt", "version"}, cmdNames)
+}
+
+func TestCLIServerAndTokenSources(t *testing.T) {
+	home := t.TempDir()
+	originalUserHomeDir := userHomeDir
+	userHomeDir = func() (string, error) { return home, nil }
+	defer func() { userHomeDir = originalUserHomeDir }()
+
+	tests := []struct {
+		inputArgs      []string
+		inputEnv       map[string]string
+		inputFile      string
+		expectedServer string
+		expectedToken  string
+	}{
+		{
+			expectedServer: defaultServerAddr,
+		},
+		{
+			inputFile:      "server: http://file:8080\ntoken: file-token",
+			expectedServer: "http://file:8080",
+			expectedToken:  "file-token",
+		},
+		{
+			inputEnv:       map[string]string{"DMH_SERVER": "http://env:8080", "DMH_API_KEY": "env-key"},
+			inputFile:      "server: http://file:8080\ntoken: file-token",
+			expectedServer: "http://env:8080",
+			expectedToken:  "env-key",
+		},
+		{
+			inputEnv:       map[string]string{"DMH_TOKEN": "env-token", "DMH_API_KEY": "env-key"},
+			expectedServer: defaultServerAddr,
+			expectedToken:  "env-token",
+		},
+		{
+			inputArgs:      []string{"--server", "http://flag:8080", "--api-key", "flag-key"},
+			inputEnv:       map[string]string{"DMH_SERVER": "http://env:8080", "DMH_TOKEN": "env-token"},
+			inputFile:      "server: http://file:8080\ntoken: file-token",
+			expectedServer: "http://flag:8080",
+			expectedToken:  "flag-key",
+		},
+		{
+			inputFile:      "server: [",
+			expectedServer: defaultServerAddr,
+		},
+	}
+	for _, test := range tests {
+		for _, env := range []string{"DMH_SERVER", "DMH_TOKEN", "DMH_API_KEY"} {
+			os.Unsetenv(env)
+		}
+		for k, v := range test.inputEnv {
+			require.Nil(t, os.Setenv(k, v))
+		}
+		os.Remove(filepath.Join(home, cliConfigFile))
+		if test.inputFile != "" {
+			require.Nil(t, os.WriteFile(filepath.Join(home, cliConfigFile), []byte(test.inputFile), 0600))
+		}
+
+		var server, token string
+		cmd := createCLI()
+		cmd.Action = func(ctx context.Context, cmd *cli.Command) error {
+			server = cmd.String("server")
+			token = cmd.String("token")
+			return nil
+		}
+		require.Nil(t, cmd.Run(context.Background(), append([]string{"dmh-cli"}, test.inputArgs...)))
+		require.Equal(t, test.expectedServer, server, "args %v, env %v, file %q", test.inputArgs, test.inputEnv, test.inputFile)
+		require.Equal(t, test.expectedToken, token, "args %v, env %v, file %q", test.inputArgs, test.inputEnv, test.inputFile)
+	}
+	for _, env := range []string{"DMH_SERVER", "DMH_TOKEN", "DMH_API_KEY"} {
+		os.Unsetenv(env)
+	}
 }
 
 func TestDoRequest(t *testing.T) {
@@ -949,7 +2041,7 @@ func TestSendTestAction(t *testing.T) {
 		{
 			mockHandler: func(w http.ResponseWriter, r *http.Request) {
 				require.Equal(t, "/api/action/test", r.URL.Path)
-				w.WriteHeader(http.StatusOK)
+				w.Write([]byte(`{"dry_run":true,"recipients":[]}`))
 			},
 		},
 	}
@@ -1123,3 +2215,26 @@ func TestGenAgeKey(t *testing.T) {
 		}
 	}
 }
+
+func TestEncryptValue(t *testing.T) {
+	master, err := crypt.NewAge("")
+	require.Nil(t, err)
+
+	t.Setenv(crypt.MasterKeyEnv, "")
+	t.Setenv(crypt.MasterKeyFileEnv, "")
+	_, err = captureCLIOutput(t, "dmh-cli", "crypt", "encrypt-value", "--value", "secret")
+	require.Equal(t, "DMH_MASTER_KEY or DMH_MASTER_KEY_FILE is not set", err.Error())
+
+	t.Setenv(crypt.MasterKeyEnv, "invalid")
+	_, err = captureCLIOutput(t, "dmh-cli", "crypt", "encrypt-value", "--value", "secret")
+	require.NotNil(t, err)
+
+	t.Setenv(crypt.MasterKeyEnv, master.GetPrivateKey())
+	out, err := captureCLIOutput(t, "dmh-cli", "crypt", "encrypt-value", "--value", "secret")
+	require.Nil(t, err)
+	require.Regexp(t, `(?m)^EncryptedValue: !encrypted:`, out)
+	encrypted := strings.TrimSpace(strings.TrimPrefix(out, "EncryptedValue: "))
+	decrypted, err := crypt.DecryptValue(master, encrypted)
+	require.Nil(t, err)
+	require.Equal(t, "secret", decrypted)
+}
@@ -1,13 +1,21 @@
 package main
 
 import (
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
 	"log"
+	"os"
+	"path/filepath"
 	"slices"
 	"strings"
 	"time"
 
+	"dmh/internal/api"
 	"dmh/internal/auth"
+	"dmh/internal/crypt"
 	"dmh/internal/execute"
+	"dmh/internal/metric"
 	"dmh/internal/state"
 	"dmh/internal/vault"
 
@@ -21,17 +29,41 @@ import (
 var envListKeys = []string{"components", "auth.anonymous_scope"}
 
 // readConfig reads configFile and feeds it to koanf.
+// When configDir is provided, all *.yaml files from it are merged (sorted by name)
+// on top of configFile.
 // readConfig can be feeded from env variables:
 // DMH_REMOTE_VAULT__URL=http://test -> remote_vault.url=http://test
 // DMH_COMPONENTS = "dmh," -> components=["dmh"]
+// DMH_PROFILE=prod -> profile=prod, selects profiles.prod (see pluginConfig)
+// Values tagged with !encrypted: are decrypted with master key (see decryptConfig).
 // It will also ensure that required keys for enabled component are present.
-func readConfig(configFile string) *koanf.Koanf {
+func readConfig(configFile string, configDir string) *koanf.Koanf {
 	k := koanf.New(".")
 	if err := k.Load(file.Provider(configFile), yaml.Parser()); err != nil {
 		log.Panicf("error loading config %s: %v", configFile, err)
 	}
 
+	if configDir != "" {
+		if info, err := os.Stat(configDir); err != nil || !info.IsDir() {
+			log.Panicf("config dir %s is not a directory", configDir)
+		}
+		// filepath.Glob returns matches sorted by name.
+		configDirFiles, err := filepath.Glob(filepath.Join(configDir, "*.yaml"))
+		if err != nil {
+			log.Panicf("error listing config dir %s: %v", configDir, err)
+		}
+		for _, configDirFile := range configDirFiles {
+			if err := k.Load(file.Provider(configDirFile), yaml.Parser()); err != nil {
+				log.Panicf("error loading config %s: %v", configDirFile, err)
+			}
+		}
+	}
+
 	k.Load(env.ProviderWithValue("DMH_", ".", func(s string, v string) (string, any) {
+		// master key is never part of config.
+		if s == crypt.MasterKeyEnv || s == crypt.MasterKeyFileEnv {
+			return "", nil
+		}
 		key := strings.Replace(strings.ToLower(strings.TrimPrefix(s, "DMH_")), "__", ".", -1)
 
 		if slices.Contains(envListKeys, key) && strings.Contains(v, ",") {
@@ -40,6 +72,8 @@ func readConfig(configFile string) *koanf.Koanf {
 		return key, v
 	}), nil)
 
+	decryptConfig(k)
+
 	requiredKeys := []string{"components"}
 
 	for _, configKey := range requiredKeys {
@@ -63,16 +97,118 @@ func readConfig(configFile string) *koanf.Koanf {
 		log.Printf("dmh and vault component enabled, check https://github.com/bkupidura/dead-man-hand/wiki/Security#run-dmh-and-vault-on-different-servers--locations")
 	}
 
+	if profile := k.String("profile"); profile != "" {
+		if !k.Exists("profiles." + profile) {
+			log.Panicf("config profile %s is not defined in profiles", profile)
+		}
+		log.Printf("using config profile %s", profile)
+	}
+
 	return k
 }
 
+// decryptConfig decrypts config values (also in lists) tagged with !encrypted:.
+// Master key (age private key) is read from DMH_MASTER_KEY or from file pointed by DMH_MASTER_KEY_FILE,
+// it is required only when any value is tagged. Value which can't be decrypted is fatal.
+func decryptConfig(k *koanf.Koanf) {
+	var c crypt.AgeInterface
+	decrypt := func(key string, value string) string {
+		if !crypt.IsEncryptedValue(value) {
+			return value
+		}
+		if c == nil {
+			masterKey, err := crypt.MasterKey()
+			if err != nil {
+				log.Panicf("unable to load master key: %s", err)
+			}
+			if masterKey == "" {
+				log.Panicf("config key %s is encrypted, but %s or %s is not set", key, crypt.MasterKeyEnv, crypt.MasterKeyFileEnv)
+			}
+			if c, err = crypt.NewAge(masterKey); err != nil {
+				log.Panicf("invalid master key: %s", err)
+			}
+		}
+		plaintext, err := crypt.DecryptValue(c, value)
+		if err != nil {
+			log.Panicf("unable to decrypt config key %s: %s", key, err)
+		}
+		return plaintext
+	}
+
+	for _, key := range k.Keys() {
+		switch v := k.Get(key).(type) {
+		case string:
+			if crypt.IsEncryptedValue(v) {
+				k.Set(key, decrypt(key, v))
+			}
+		case []string:
+			if slices.ContainsFunc(v, crypt.IsEncryptedValue) {
+				decrypted := make([]string, 0, len(v))
+				for _, item := range v {
+					decrypted = append(decrypted, decrypt(key, item))
+				}
+				k.Set(key, decrypted)
+			}
+		case []any:
+			encrypted := false
+			decrypted := make([]any, 0, len(v))
+			for _, item := range v {
+				if s, ok := item.(string); ok && crypt.IsEncryptedValue(s) {
+					encrypted = true
+					item = decrypt(key, s)
+				}
+				decrypted = append(decrypted, item)
+			}
+			if encrypted {
+				k.Set(key, decrypted)
+			}
+		}
+	}
+}
+
+// pluginConfig returns execute.plugin.<plugin> config.
+// When profile is selected, profiles.<profile>.execute.plugin.<plugin> is merged over it.
+func pluginConfig(k *koanf.Koanf, plugin string) *koanf.Koanf {
+	path := "execute.plugin." + plugin
+	config := k.Cut(path)
+	if profile := k.String("profile"); profile != "" {
+		if err := config.Merge(k.Cut("profiles." + profile + "." + path)); err != nil {
+			log.Panicf("unable to merge config profile %s: %s", profile, err)
+		}
+	}
+	return config
+}
+
 // stateOptions maps config into state.Options and validates it.
 func stateOptions(k *koanf.Koanf) *state.Options {
 	o := &state.Options{
-		VaultURL:        k.String("remote_vault.url"),
-		VaultClientUUID: k.String("remote_vault.client_uuid"),
-		VaultToken:      k.String("remote_vault.token"),
-		SavePath:        k.String("state.file"),
+		VaultURL:               k.String("remote_vault.url"),
+		VaultClientUUID:        k.String("remote_vault.client_uuid"),
+		VaultToken:             k.String("remote_vault.token"),
+		AdditionalVaultURLs:    additionalVaultURLs(k),
+		SavePath:               k.String("state.file"),
+		ClearProcessedVaultURL: k.Bool("state.clear_processed_vault_url"),
+		AgePluginRecipient:     k.String("state.age_plugin.recipient"),
+		AgePluginIdentity:      k.String("state.age_plugin.identity"),
+		SSHRecipient:           k.String("state.ssh.recipient"),
+		SSHKeyFile:             k.String("state.ssh.key_file"),
+		BackupDir:              k.String("state.backup_dir"),
+		BackupKeep:             k.Int("state.backup_keep"),
+		WrapResponse:           k.Bool("remote_vault.wrap_response"),
+		RequiredSources:        requiredSources(k),
+		Pretty:                 k.Bool("state.pretty"),
+		UniqueComments:         k.Bool("action.unique_comments"),
+		MaxActions:             k.Int("state.max_actions"),
+		OverflowPolicy:         k.String("state.overflow_policy"),
+		OnCorrupt:              k.String("state.on_corrupt"),
+		FiredLogFile:           k.String("state.fired_log_file"),
+		RecipientHashSalt:      k.String("state.recipient_hash_salt"),
+		Compress:               k.Bool("state.compress"),
+		SignKey:                k.String("state.sign.key"),
+		SignAllowUnsigned:      k.Bool("state.sign.allow_unsigned"),
+	}
+	if o.RecipientHashSalt != "" {
+		o.Recipient = execute.PrimaryRecipient
 	}
 	if err := o.Validate(); err != nil {
 		log.Panicf("invalid dmh config: %s", err)
@@ -80,12 +216,61 @@ func stateOptions(k *koanf.Koanf) *state.Options {
 	return o
 }
 
+// requiredSources returns alive.required_sources, nil when not configured.
+func requiredSources(k *koanf.Koanf) []string {
+	if sources := k.Strings("alive.required_sources"); len(sources) > 0 {
+		return sources
+	}
+	return nil
+}
+
+// additionalVaultURLs returns vaults which action vault_url may point to, nil when not configured.
+func additionalVaultURLs(k *koanf.Koanf) []string {
+	if urls := k.Strings("remote_vault.additional_urls"); len(urls) > 0 {
+		return urls
+	}
+	return nil
+}
+
+// getLastSeenMetaConfig returns config for recording where check-ins come from.
+func getLastSeenMetaConfig(k *koanf.Koanf) api.LastSeenMetaConfig {
+	return api.LastSeenMetaConfig{
+		Enabled:           k.Bool("state.last_seen_meta.enabled"),
+		TrustForwardedFor: k.Bool("state.last_seen_meta.trust_forwarded_for"),
+	}
+}
+
 // vaultOptions maps config into vault.Options and validates it.
+// Age key is resolved from vault.key_source (config, file, hashicorp).
 func vaultOptions(k *koanf.Koanf) *vault.Options {
+	keySource := &vault.KeySource{
+		Source: k.String("vault.key_source"),
+		Key:    k.String("vault.key"),
+		File:   k.String("vault.key_file"),
+		HashiCorp: vault.HashiCorpConfig{
+			Address: k.String("vault.hashicorp.address"),
+			Token:   k.String("vault.hashicorp.token"),
+			Path:    k.String("vault.hashicorp.path"),
+			Field:   k.String("vault.hashicorp.field"),
+		},
+	}
+	key, err := keySource.ResolveKey()
+	if err != nil {
+		log.Panicf("unable to load vault key: %s", err)
+	}
 	o := &vault.Options{
-		Key:               k.String("vault.key"),
-		SavePath:          k.String("vault.file"),
-		SecretProcessUnit: processUnit(k),
+		Key:                 key,
+		SSHKeyFile:          k.String("vault.ssh_key_file"),
+		SavePath:            k.String("vault.file"),
+		SecretProcessUnit:   processUnit(k),
+		MaxSecretsPerClient: k.Int("vault.max_secrets_per_client"),
+		MaxSecrets:          k.Int("vault.max_secrets"),
+		OverflowPolicy:      k.String("vault.overflow_policy"),
+		ReleaseWebhook:      k.String("vault.release_webhook"),
+		Pretty:              k.Bool("vault.pretty"),
+		EncryptFile:         k.Bool("vault.encrypt_file"),
+		FileKey:             k.String("vault.file_key"),
+		ReleaseSkew:         time.Duration(k.Int("vault.release_skew")) * time.Second,
 	}
 	if err := o.Validate(); err != nil {
 		log.Panicf("invalid vault config: %s", err)
@@ -93,16 +278,226 @@ func vaultOptions(k *koanf.Koanf) *vault.Options {
 	return o
 }
 
+// declaredActions returns actions declared in actions config section and validates them.
+// Every action must have unique id, it is used by State.Reconcile to find already added actions.
+func declaredActions(k *koanf.Koanf) []*state.Action {
+	declared := []*state.Action{}
+	if err := k.UnmarshalWithConf("actions", &declared, koanf.UnmarshalConf{Tag: "yaml"}); err != nil {
+		log.Panicf("unable to unmarshal config: %s", err)
+	}
+	ids := map[string]bool{}
+	for i, a := range declared {
+		if a.DeclaredID == "" {
+			log.Panicf("actions #%d: id is required", i+1)
+		}
+		if ids[a.DeclaredID] {
+			log.Panicf("actions #%d: id %s is not unique", i+1, a.DeclaredID)
+		}
+		ids[a.DeclaredID] = true
+		if err := a.Validate(); err != nil {
+			log.Panicf("actions #%d (%s): %s", i+1, a.DeclaredID, err)
+		}
+	}
+	return declared
+}
+
+// metricOptions maps config into metric.Options.
+// metrics.slow_probe_timeout (seconds) and metrics.slow_probe_concurrency fall back to metric defaults when not set.
+// metrics.empty_warn_after (hours) defaults to defaultEmptyWarnAfter, 0 disables it.
+// v is nil when vault component is disabled.
+func metricOptions(k *koanf.Koanf, s state.StateInterface, v vault.VaultInterface) *metric.Options {
+	return &metric.Options{
+		State:                s,
+		Vault:                v,
+		VaultToken:           k.String("remote_vault.token"),
+		CommentLabel:         k.Bool("metrics.comment_label"),
+		SlowProbeTimeout:     time.Duration(k.Int("metrics.slow_probe_timeout")) * time.Second,
+		SlowProbeConcurrency: k.Int("metrics.slow_probe_concurrency"),
+		Jitter:               time.Duration(k.Int("metrics.jitter")) * time.Second,
+		SlowProbeStagger:     time.Duration(k.Int("metrics.slow_probe_stagger")) * time.Millisecond,
+		EmptyWarnAfter:       emptyWarnAfter(k),
+	}
+}
+
+// emptyWarnAfter maps metrics.empty_warn_after (hours) into time after which DMH without
+// pending actions or vault without secrets is reported.
+func emptyWarnAfter(k *koanf.Koanf) time.Duration {
+	if !k.Exists("metrics.empty_warn_after") {
+		return defaultEmptyWarnAfter
+	}
+	if after := k.Int("metrics.empty_warn_after"); after > 0 {
+		return time.Duration(after) * time.Hour
+	}
+	return 0
+}
+
 // processUnit maps action.process_unit config into a time unit.
 func processUnit(k *koanf.Koanf) time.Duration {
-	switch k.String("action.process_unit") {
-	case "second":
-		return time.Second
-	case "minute":
-		return time.Minute
-	default:
-		return time.Hour
+	if unit, ok := vault.ProcessUnit(k.String("action.process_unit")); ok {
+		return unit
+	}
+	return time.Hour
+}
+
+// dispatchJitter maps action.dispatch_jitter (seconds) into max random delay of every dispatcher run.
+// Jitter must be shorter than dispatcher interval, otherwise runs would be skipped.
+func dispatchJitter(k *koanf.Koanf) time.Duration {
+	jitter := time.Duration(k.Int("action.dispatch_jitter")) * time.Second
+	if interval := time.Duration(getActionsInterval) * getActionsIntervalUnit; jitter < 0 || jitter >= interval {
+		log.Panicf("invalid dmh config: action.dispatch_jitter should be between 0 and %d seconds", int(interval.Seconds())-1)
 	}
+	return jitter
+}
+
+// inProcessVault returns if DMH should call colocated vault directly instead of remote_vault.url.
+// remote_vault.in_process is honored only when both dmh and vault components are enabled.
+func inProcessVault(k *koanf.Koanf) bool {
+	if !k.Bool("remote_vault.in_process") {
+		return false
+	}
+	components := k.Strings("components")
+	if !slices.Contains(components, "dmh") || !slices.Contains(components, "vault") {
+		log.Printf("remote_vault.in_process requires dmh and vault components, using remote_vault.url")
+		return false
+	}
+	return true
+}
+
+// actionRunTimeout maps action.run_timeout (seconds) into timeout of single action run.
+func actionRunTimeout(k *koanf.Koanf) time.Duration {
+	if timeout := k.Int("action.run_timeout"); timeout > 0 {
+		return time.Duration(timeout) * time.Second
+	}
+	return defaultActionRunTimeout
+}
+
+// getFailureBackoff returns backoff of actions which Run keeps failing.
+// action.failure_backoff.after is number of consecutive failures, initial and max are in seconds.
+func getFailureBackoff(k *koanf.Koanf) failureBackoff {
+	backoff := failureBackoff{
+		After:   k.Int("action.failure_backoff.after"),
+		Initial: time.Minute,
+		Max:     time.Hour,
+	}
+	if initial := k.Int("action.failure_backoff.initial"); initial > 0 {
+		backoff.Initial = time.Duration(initial) * time.Second
+	}
+	if max := k.Int("action.failure_backoff.max"); max > 0 {
+		backoff.Max = time.Duration(max) * time.Second
+	}
+	if backoff.Max < backoff.Initial {
+		log.Panicf("action.failure_backoff.max must not be lower than action.failure_backoff.initial")
+	}
+	return backoff
+}
+
+// actionsGCAfter maps state.gc_after (in action.process_unit) into age after which processed actions are removed.
+// Zero disables garbage collection.
+func actionsGCAfter(k *koanf.Koanf, unit time.Duration) time.Duration {
+	if gcAfter := k.Int("state.gc_after"); gcAfter > 0 {
+		return time.Duration(gcAfter) * unit
+	}
+	return 0
+}
+
+// maxVaultDowntime maps decrypt.max_vault_downtime (in seconds) into time after which
+// unreachable remote vault marks instance as not ready. Zero disables it.
+func maxVaultDowntime(k *koanf.Koanf) time.Duration {
+	if downtime := k.Int("decrypt.max_vault_downtime"); downtime > 0 {
+		return time.Duration(downtime) * time.Second
+	}
+	return 0
+}
+
+// reconcileInterval maps reconcile.interval (in seconds) into reconciliation interval.
+// Zero disables reconciliation.
+func reconcileInterval(k *koanf.Koanf) time.Duration {
+	if interval := k.Int("reconcile.interval"); interval > 0 {
+		return time.Duration(interval) * time.Second
+	}
+	return 0
+}
+
+// aliveCronToken returns alive.cron_token, hex encoded sha256 of token accepted by GET /api/alive/{token}.
+// Empty disables cron check-in.
+func aliveCronToken(k *koanf.Koanf) string {
+	hash := strings.ToLower(k.String("alive.cron_token"))
+	if hash == "" {
+		return ""
+	}
+	if decoded, err := hex.DecodeString(hash); err != nil || len(decoded) != sha256.Size {
+		log.Panicf("alive.cron_token must be a hex encoded sha256, generate token with dmh-cli crypt generate-bearer")
+	}
+	return hash
+}
+
+// validateOnStart maps execute.validate_on_start into execute self-test mode.
+// It is empty (disabled, default), warn or fail.
+func validateOnStart(k *koanf.Koanf) string {
+	mode := k.String("execute.validate_on_start")
+	if !slices.Contains([]string{"", "warn", "fail"}, mode) {
+		log.Panicf("execute.validate_on_start must be warn or fail")
+	}
+	return mode
+}
+
+// maxBodyBytes maps http.max_body_bytes into request body limit.
+// Zero keeps API default.
+func maxBodyBytes(k *koanf.Koanf) int64 {
+	if limit := k.Int64("http.max_body_bytes"); limit > 0 {
+		return limit
+	}
+	return 0
+}
+
+// actionMaxDataBytes maps action.max_data_bytes into action data limit.
+// Zero disables it, action data is limited only by http.max_body_bytes.
+func actionMaxDataBytes(k *koanf.Koanf) int {
+	if limit := k.Int("action.max_data_bytes"); limit > 0 {
+		return limit
+	}
+	return 0
+}
+
+// serverTLSVersions maps http.tls_min_version into TLS version.
+var serverTLSVersions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// getServerTLS returns TLS config of DMH HTTP server.
+// http.tls_cert and http.tls_key must be set together, without them plaintext HTTP is served.
+func getServerTLS(k *koanf.Koanf) serverTLS {
+	config := serverTLS{
+		CertFile:   k.String("http.tls_cert"),
+		KeyFile:    k.String("http.tls_key"),
+		MinVersion: tls.VersionTLS12,
+	}
+	if (config.CertFile == "") != (config.KeyFile == "") {
+		log.Panicf("http.tls_cert and http.tls_key must be set together")
+	}
+	if version := k.String("http.tls_min_version"); version != "" {
+		minVersion, ok := serverTLSVersions[version]
+		if !ok {
+			log.Panicf("http.tls_min_version must be one of 1.2, 1.3")
+		}
+		config.MinVersion = minVersion
+	}
+	return config
+}
+
+// getConfirmPolicy returns action kinds (and optionally destructive actions) which run only after confirm window.
+// Window is in action.process_unit.
+func getConfirmPolicy(k *koanf.Koanf, unit time.Duration) confirmPolicy {
+	policy := confirmPolicy{
+		Kinds:       k.Strings("action.confirm.kinds"),
+		Destructive: k.Bool("action.confirm.destructive"),
+		Window:      time.Duration(k.Int("action.confirm.window")) * unit,
+	}
+	if (len(policy.Kinds) > 0 || policy.Destructive) && policy.Window <= 0 {
+		log.Panicf("action.confirm.window must be greater than 0")
+	}
+	return policy
 }
 
 // getAuthConfig returns parsed and validated auth config.
@@ -122,10 +517,11 @@ func getAuthConfig(k *koanf.Koanf) auth.Config {
 // When the config section is present, it is validated at startup.
 func getBulkSMSConfig(k *koanf.Koanf) execute.BulkSMSConfig {
 	var config execute.BulkSMSConfig
-	if err := k.Unmarshal("execute.plugin.bulksms", &config); err != nil {
+	c := pluginConfig(k, "bulksms")
+	if err := c.Unmarshal("", &config); err != nil {
 		log.Panicf("unable to unmarshal config: %s", err)
 	}
-	if k.Exists("execute.plugin.bulksms") {
+	if len(c.Keys()) > 0 {
 		if err := config.Validate(); err != nil {
 			log.Panicf("invalid execute.plugin.bulksms config: %s", err)
 		}
@@ -137,13 +533,95 @@ func getBulkSMSConfig(k *koanf.Koanf) execute.BulkSMSConfig {
 // When the config section is present, it is validated at startup.
 func getMailConfig(k *koanf.Koanf) execute.MailConfig {
 	var config execute.MailConfig
-	if err := k.Unmarshal("execute.plugin.mail", &config); err != nil {
+	c := pluginConfig(k, "mail")
+	if err := c.Unmarshal("", &config); err != nil {
 		log.Panicf("unable to unmarshal config: %s", err)
 	}
-	if k.Exists("execute.plugin.mail") {
+	if len(c.Keys()) > 0 {
 		if err := config.Validate(); err != nil {
 			log.Panicf("invalid execute.plugin.mail config: %s", err)
 		}
 	}
 	return config
 }
+
+// getFileWriteConfig returns parsed config for file_write execute plugin.
+// When the config section is present, it is validated at startup.
+func getFileWriteConfig(k *koanf.Koanf) execute.FileWriteConfig {
+	var config execute.FileWriteConfig
+	c := pluginConfig(k, "file_write")
+	if err := c.Unmarshal("", &config); err != nil {
+		log.Panicf("unable to unmarshal config: %s", err)
+	}
+	if len(c.Keys()) > 0 {
+		if err := config.Validate(); err != nil {
+			log.Panicf("invalid execute.plugin.file_write config: %s", err)
+		}
+	}
+	return config
+}
+
+// getJournalConfig returns parsed config for journal execute plugin.
+// When the config section is present, it is validated at startup.
+func getJournalConfig(k *koanf.Koanf) execute.JournalConfig {
+	var config execute.JournalConfig
+	c := pluginConfig(k, "journal")
+	if err := c.Unmarshal("", &config); err != nil {
+		log.Panicf("unable to unmarshal config: %s", err)
+	}
+	if len(c.Keys()) > 0 {
+		if err := config.Validate(); err != nil {
+			log.Panicf("invalid execute.plugin.journal config: %s", err)
+		}
+	}
+	return config
+}
+
+// getTestModeConfig returns parsed and validated execute test mode config.
+func getTestModeConfig(k *koanf.Koanf) execute.TestModeConfig {
+	var config execute.TestModeConfig
+	if err := k.Unmarshal("execute.test_mode", &config); err != nil {
+		log.Panicf("unable to unmarshal config: %s", err)
+	}
+	if err := config.Validate(); err != nil {
+		log.Panicf("invalid execute.test_mode config: %s", err)
+	}
+	if config.Enabled {
+		log.Printf("execute test mode is ENABLED, actions are delivered only to test recipients")
+	}
+	return config
+}
+
+// getQueueConfig returns execute.queue config, it is validated by execute.New when execute.mode is queue.
+func getQueueConfig(k *koanf.Koanf) execute.QueueConfig {
+	var config execute.QueueConfig
+	if err := k.Unmarshal("execute.queue", &config); err != nil {
+		log.Panicf("unable to unmarshal config: %s", err)
+	}
+	return config
+}
+
+// getJSONPostConfig returns parsed config for json_post execute plugin.
+// default_headers must be a map of string values, allow entries must be IP addresses, CIDRs or host names.
+func getJSONPostConfig(k *koanf.Koanf) execute.JSONPostConfig {
+	var config execute.JSONPostConfig
+	c := pluginConfig(k, "json_post")
+	if c.Exists("default_headers") {
+		headers, ok := c.Get("default_headers").(map[string]any)
+		if !ok {
+			log.Panicf("invalid execute.plugin.json_post config: default_headers must be a map")
+		}
+		for name, value := range headers {
+			if _, ok := value.(string); !ok {
+				log.Panicf("invalid execute.plugin.json_post config: default_headers %s must be a string", name)
+			}
+		}
+	}
+	if err := c.Unmarshal("", &config); err != nil {
+		log.Panicf("unable to unmarshal config: %s", err)
+	}
+	if err := config.Validate(); err != nil {
+		log.Panicf("invalid execute.plugin.json_post config: %s", err)
+	}
+	return config
+}
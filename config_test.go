@@ -4,11 +4,16 @@
 package main
 
 import (
+	"crypto/tls"
+	"fmt"
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
+	"dmh/internal/api"
 	"dmh/internal/auth"
+	"dmh/internal/crypt"
 	"dmh/internal/execute"
 	"dmh/internal/state"
 	"dmh/internal/vault"
@@ -34,10 +39,140 @@ func TestStateOptions(t *testing.T) {
 				SavePath:        "state.json",
 			},
 		},
+		{
+			inputYAML: "remote_vault:\n  url: http://test\n  client_uuid: uuid\nstate:\n  file: state.json\n  pretty: true",
+			expectedOpts: &state.Options{
+				VaultURL:        "http://test",
+				VaultClientUUID: "uuid",
+				SavePath:        "state.json",
+				Pretty:          true,
+			},
+		},
+		{
+			inputYAML: "remote_vault:\n  url: http://test\n  client_uuid: uuid\nstate:\n  file: state.json\n  compress: true",
+			expectedOpts: &state.Options{
+				VaultURL:        "http://test",
+				VaultClientUUID: "uuid",
+				SavePath:        "state.json",
+				Compress:        true,
+			},
+		},
+		{
+			inputYAML: "remote_vault:\n  url: http://test\n  client_uuid: uuid\nstate:\n  file: state.json\n  sign:\n    key: 0123456789abcdef\n    allow_unsigned: true",
+			expectedOpts: &state.Options{
+				VaultURL:          "http://test",
+				VaultClientUUID:   "uuid",
+				SavePath:          "state.json",
+				SignKey:           "0123456789abcdef",
+				SignAllowUnsigned: true,
+			},
+		},
+		{
+			inputYAML: "remote_vault:\n  url: http://test\n  client_uuid: uuid\nstate:\n  file: state.json\naction:\n  unique_comments: true",
+			expectedOpts: &state.Options{
+				VaultURL:        "http://test",
+				VaultClientUUID: "uuid",
+				SavePath:        "state.json",
+				UniqueComments:  true,
+			},
+		},
+		{
+			inputYAML: "remote_vault:\n  url: http://test\n  client_uuid: uuid\nstate:\n  file: state.json\n  max_actions: 100\n  overflow_policy: evict",
+			expectedOpts: &state.Options{
+				VaultURL:        "http://test",
+				VaultClientUUID: "uuid",
+				SavePath:        "state.json",
+				MaxActions:      100,
+				OverflowPolicy:  "evict",
+			},
+		},
+		{
+			inputYAML:   "remote_vault:\n  url: http://test\n  client_uuid: uuid\nstate:\n  file: state.json\n  overflow_policy: lru",
+			shouldPanic: true,
+		},
+		{
+			inputYAML: "remote_vault:\n  url: http://test\n  client_uuid: uuid\nstate:\n  file: state.json\n  fired_log_file: fired.log",
+			expectedOpts: &state.Options{
+				VaultURL:        "http://test",
+				VaultClientUUID: "uuid",
+				SavePath:        "state.json",
+				FiredLogFile:    "fired.log",
+			},
+		},
+		{
+			inputYAML: "remote_vault:\n  url: http://test\n  client_uuid: uuid\nstate:\n  file: state.json\n  clear_processed_vault_url: true",
+			expectedOpts: &state.Options{
+				VaultURL:               "http://test",
+				VaultClientUUID:        "uuid",
+				SavePath:               "state.json",
+				ClearProcessedVaultURL: true,
+			},
+		},
+		{
+			inputYAML: "remote_vault:\n  url: http://test\n  client_uuid: uuid\nstate:\n  file: state.json\n  age_plugin:\n    recipient: age1yubikey1test\n    identity: AGE-PLUGIN-YUBIKEY-1TEST",
+			expectedOpts: &state.Options{
+				VaultURL:           "http://test",
+				VaultClientUUID:    "uuid",
+				SavePath:           "state.json",
+				AgePluginRecipient: "age1yubikey1test",
+				AgePluginIdentity:  "AGE-PLUGIN-YUBIKEY-1TEST",
+			},
+		},
+		{
+			inputYAML: "remote_vault:\n  url: http://test\n  client_uuid: uuid\nstate:\n  file: state.json\n  backup_dir: backup\n  backup_keep: 5",
+			expectedOpts: &state.Options{
+				VaultURL:        "http://test",
+				VaultClientUUID: "uuid",
+				SavePath:        "state.json",
+				BackupDir:       "backup",
+				BackupKeep:      5,
+			},
+		},
+		{
+			inputYAML: "remote_vault:\n  url: http://test\n  client_uuid: uuid\nstate:\n  file: state.json\n  backup_dir: backup\n  backup_keep: 5\n  on_corrupt: use_backup",
+			expectedOpts: &state.Options{
+				VaultURL:        "http://test",
+				VaultClientUUID: "uuid",
+				SavePath:        "state.json",
+				BackupDir:       "backup",
+				BackupKeep:      5,
+				OnCorrupt:       "use_backup",
+			},
+		},
+		{
+			inputYAML:   "remote_vault:\n  url: http://test\n  client_uuid: uuid\nstate:\n  file: state.json\n  on_corrupt: use_backup",
+			shouldPanic: true,
+		},
+		{
+			inputYAML: "remote_vault:\n  url: http://test\n  client_uuid: uuid\n  wrap_response: true\nstate:\n  file: state.json",
+			expectedOpts: &state.Options{
+				VaultURL:        "http://test",
+				VaultClientUUID: "uuid",
+				SavePath:        "state.json",
+				WrapResponse:    true,
+			},
+		},
+		{
+			inputYAML: "remote_vault:\n  url: http://test\n  client_uuid: uuid\nstate:\n  file: state.json\nalive:\n  required_sources: [alice, bob]",
+			expectedOpts: &state.Options{
+				VaultURL:        "http://test",
+				VaultClientUUID: "uuid",
+				SavePath:        "state.json",
+				RequiredSources: []string{"alice", "bob"},
+			},
+		},
+		{
+			inputYAML:   "remote_vault:\n  url: http://test\n  client_uuid: uuid\nstate:\n  file: state.json\nalive:\n  required_sources: [alice, alice]",
+			shouldPanic: true,
+		},
 		{
 			inputYAML:   "remote_vault:\n  client_uuid: uuid\nstate:\n  file: state.json",
 			shouldPanic: true,
 		},
+		{
+			inputYAML:   "remote_vault:\n  url: http://test\n  client_uuid: uuid\nstate:\n  file: state.json\n  recipient_hash_salt: short",
+			shouldPanic: true,
+		},
 	}
 	for _, test := range tests {
 		k := koanf.New(".")
@@ -48,9 +183,18 @@ func TestStateOptions(t *testing.T) {
 			require.Equal(t, test.expectedOpts, stateOptions(k))
 		}
 	}
+
+	k := koanf.New(".")
+	require.Nil(t, k.Load(rawbytes.Provider([]byte("remote_vault:\n  url: http://test\n  client_uuid: uuid\nstate:\n  file: state.json\n  recipient_hash_salt: 0123456789abcdef")), yaml.Parser()))
+	opts := stateOptions(k)
+	require.Equal(t, "0123456789abcdef", opts.RecipientHashSalt)
+	require.NotNil(t, opts.Recipient)
 }
 
 func TestVaultOptions(t *testing.T) {
+	keyFile := filepath.Join(t.TempDir(), "key")
+	require.Nil(t, os.WriteFile(keyFile, []byte("AGE-SECRET-KEY-1WCXTESPDAL64QQLNE6SEHHSFQVHZ2KV7KR2XCLGQ0UFSUUJXP5AS84HFG0\n"), 0600))
+
 	tests := []struct {
 		inputYAML    string
 		expectedOpts *vault.Options
@@ -64,6 +208,81 @@ func TestVaultOptions(t *testing.T) {
 				SecretProcessUnit: time.Hour,
 			},
 		},
+		{
+			inputYAML: "vault:\n  key: AGE-SECRET-KEY-1WCXTESPDAL64QQLNE6SEHHSFQVHZ2KV7KR2XCLGQ0UFSUUJXP5AS84HFG0\n  file: vault.json\n  max_secrets_per_client: 10\n  max_secrets: 100",
+			expectedOpts: &vault.Options{
+				Key:                 "AGE-SECRET-KEY-1WCXTESPDAL64QQLNE6SEHHSFQVHZ2KV7KR2XCLGQ0UFSUUJXP5AS84HFG0",
+				SavePath:            "vault.json",
+				SecretProcessUnit:   time.Hour,
+				MaxSecretsPerClient: 10,
+				MaxSecrets:          100,
+			},
+		},
+		{
+			inputYAML: "vault:\n  key: AGE-SECRET-KEY-1WCXTESPDAL64QQLNE6SEHHSFQVHZ2KV7KR2XCLGQ0UFSUUJXP5AS84HFG0\n  file: vault.json\n  release_skew: 30",
+			expectedOpts: &vault.Options{
+				Key:               "AGE-SECRET-KEY-1WCXTESPDAL64QQLNE6SEHHSFQVHZ2KV7KR2XCLGQ0UFSUUJXP5AS84HFG0",
+				SavePath:          "vault.json",
+				SecretProcessUnit: time.Hour,
+				ReleaseSkew:       30 * time.Second,
+			},
+		},
+		{
+			inputYAML:   "vault:\n  key: AGE-SECRET-KEY-1WCXTESPDAL64QQLNE6SEHHSFQVHZ2KV7KR2XCLGQ0UFSUUJXP5AS84HFG0\n  file: vault.json\n  release_skew: -1",
+			shouldPanic: true,
+		},
+		{
+			inputYAML: "vault:\n  key: AGE-SECRET-KEY-1WCXTESPDAL64QQLNE6SEHHSFQVHZ2KV7KR2XCLGQ0UFSUUJXP5AS84HFG0\n  file: vault.json\n  release_webhook: https://dmh.example.com/webhook",
+			expectedOpts: &vault.Options{
+				Key:               "AGE-SECRET-KEY-1WCXTESPDAL64QQLNE6SEHHSFQVHZ2KV7KR2XCLGQ0UFSUUJXP5AS84HFG0",
+				SavePath:          "vault.json",
+				SecretProcessUnit: time.Hour,
+				ReleaseWebhook:    "https://dmh.example.com/webhook",
+			},
+		},
+		{
+			inputYAML:   "vault:\n  key: AGE-SECRET-KEY-1WCXTESPDAL64QQLNE6SEHHSFQVHZ2KV7KR2XCLGQ0UFSUUJXP5AS84HFG0\n  file: vault.json\n  release_webhook: not-a-url",
+			shouldPanic: true,
+		},
+		{
+			inputYAML: "vault:\n  key: AGE-SECRET-KEY-1WCXTESPDAL64QQLNE6SEHHSFQVHZ2KV7KR2XCLGQ0UFSUUJXP5AS84HFG0\n  file: vault.json\n  pretty: true",
+			expectedOpts: &vault.Options{
+				Key:               "AGE-SECRET-KEY-1WCXTESPDAL64QQLNE6SEHHSFQVHZ2KV7KR2XCLGQ0UFSUUJXP5AS84HFG0",
+				SavePath:          "vault.json",
+				SecretProcessUnit: time.Hour,
+				Pretty:            true,
+			},
+		},
+		{
+			inputYAML: "vault:\n  key: AGE-SECRET-KEY-1WCXTESPDAL64QQLNE6SEHHSFQVHZ2KV7KR2XCLGQ0UFSUUJXP5AS84HFG0\n  file: vault.json\n  encrypt_file: true\n  file_key: AGE-SECRET-KEY-1GEUMZFAZD42WGZFGATTTJHV4SURK8LU507QVCAKXKJP6UTFMJTCS0E3QJ4",
+			expectedOpts: &vault.Options{
+				Key:               "AGE-SECRET-KEY-1WCXTESPDAL64QQLNE6SEHHSFQVHZ2KV7KR2XCLGQ0UFSUUJXP5AS84HFG0",
+				SavePath:          "vault.json",
+				SecretProcessUnit: time.Hour,
+				EncryptFile:       true,
+				FileKey:           "AGE-SECRET-KEY-1GEUMZFAZD42WGZFGATTTJHV4SURK8LU507QVCAKXKJP6UTFMJTCS0E3QJ4",
+			},
+		},
+		{
+			inputYAML:   "vault:\n  key: AGE-SECRET-KEY-1WCXTESPDAL64QQLNE6SEHHSFQVHZ2KV7KR2XCLGQ0UFSUUJXP5AS84HFG0\n  file: vault.json\n  encrypt_file: true\n  file_key: not-a-key",
+			shouldPanic: true,
+		},
+		{
+			inputYAML: fmt.Sprintf("vault:\n  key_source: file\n  key_file: %s\n  file: vault.json", keyFile),
+			expectedOpts: &vault.Options{
+				Key:               "AGE-SECRET-KEY-1WCXTESPDAL64QQLNE6SEHHSFQVHZ2KV7KR2XCLGQ0UFSUUJXP5AS84HFG0",
+				SavePath:          "vault.json",
+				SecretProcessUnit: time.Hour,
+			},
+		},
+		{
+			inputYAML:   fmt.Sprintf("vault:\n  ssh_key_file: %s\n  file: vault.json", keyFile),
+			shouldPanic: true,
+		},
+		{
+			inputYAML:   "vault:\n  key_source: file\n  file: vault.json",
+			shouldPanic: true,
+		},
 		{
 			inputYAML:   "vault:\n  file: vault.json",
 			shouldPanic: true,
@@ -80,6 +299,450 @@ func TestVaultOptions(t *testing.T) {
 	}
 }
 
+func TestActionRunTimeout(t *testing.T) {
+	tests := []struct {
+		inputYAML       string
+		expectedTimeout time.Duration
+	}{
+		{
+			inputYAML:       "action:\n  run_timeout: 10",
+			expectedTimeout: 10 * time.Second,
+		},
+		{
+			inputYAML:       "action:\n  run_timeout: -1",
+			expectedTimeout: defaultActionRunTimeout,
+		},
+		{
+			inputYAML:       "components:\n  - dmh",
+			expectedTimeout: defaultActionRunTimeout,
+		},
+	}
+	for _, test := range tests {
+		k := koanf.New(".")
+		require.Nil(t, k.Load(rawbytes.Provider([]byte(test.inputYAML)), yaml.Parser()))
+		require.Equal(t, test.expectedTimeout, actionRunTimeout(k), "yaml %q", test.inputYAML)
+	}
+}
+
+func TestDispatchJitter(t *testing.T) {
+	tests := []struct {
+		inputYAML      string
+		expectedJitter time.Duration
+		shouldPanic    bool
+	}{
+		{
+			inputYAML:      "action:\n  dispatch_jitter: 30",
+			expectedJitter: 30 * time.Second,
+		},
+		{
+			inputYAML: "components:\n  - dmh",
+		},
+		{
+			inputYAML:   "action:\n  dispatch_jitter: -1",
+			shouldPanic: true,
+		},
+		{
+			inputYAML:   "action:\n  dispatch_jitter: 300",
+			shouldPanic: true,
+		},
+	}
+	for _, test := range tests {
+		k := koanf.New(".")
+		require.Nil(t, k.Load(rawbytes.Provider([]byte(test.inputYAML)), yaml.Parser()))
+		if test.shouldPanic {
+			require.Panics(t, func() { dispatchJitter(k) }, "yaml %q", test.inputYAML)
+			continue
+		}
+		require.Equal(t, test.expectedJitter, dispatchJitter(k), "yaml %q", test.inputYAML)
+	}
+}
+
+func TestInProcessVault(t *testing.T) {
+	tests := []struct {
+		inputYAML string
+		expected  bool
+	}{
+		{
+			inputYAML: "components:\n  - dmh\n  - vault\nremote_vault:\n  in_process: true",
+			expected:  true,
+		},
+		{
+			inputYAML: "components:\n  - dmh\n  - vault",
+		},
+		{
+			inputYAML: "components:\n  - dmh\nremote_vault:\n  in_process: true",
+		},
+		{
+			inputYAML: "components:\n  - vault\nremote_vault:\n  in_process: true",
+		},
+	}
+	for _, test := range tests {
+		k := koanf.New(".")
+		require.Nil(t, k.Load(rawbytes.Provider([]byte(test.inputYAML)), yaml.Parser()))
+		require.Equal(t, test.expected, inProcessVault(k), "yaml %q", test.inputYAML)
+	}
+}
+
+func TestDeclaredActions(t *testing.T) {
+	tests := []struct {
+		inputYAML        string
+		expectedDeclared []*state.Action
+		expectedPanic    bool
+	}{
+		{
+			inputYAML: "actions:\n  - id: family\n    kind: mail\n    data: '{\"message\":\"test\"}'\n    process_after: 72\n    comment: mail family\n  - id: wipe\n    kind: json_post\n    data: '{\"url\":\"https://example.com\"}'\n    process_after: 96\n    severity: destructive",
+			expectedDeclared: []*state.Action{
+				{DeclaredID: "family", Kind: "mail", Data: `{"message":"test"}`, ProcessAfter: 72, Comment: "mail family"},
+				{DeclaredID: "wipe", Kind: "json_post", Data: `{"url":"https://example.com"}`, ProcessAfter: 96, Severity: state.SeverityDestructive},
+			},
+		},
+		{
+			inputYAML:        "components:\n  - dmh",
+			expectedDeclared: []*state.Action{},
+		},
+		{
+			inputYAML:     "actions:\n  - kind: mail\n    data: '{}'\n    process_after: 72",
+			expectedPanic: true,
+		},
+		{
+			inputYAML:     "actions:\n  - id: a\n    kind: mail\n    data: '{}'\n    process_after: 72\n  - id: a\n    kind: mail\n    data: '{}'\n    process_after: 24",
+			expectedPanic: true,
+		},
+		{
+			inputYAML:     "actions:\n  - id: a\n    kind: mail\n    data: '{}'",
+			expectedPanic: true,
+		},
+	}
+	for _, test := range tests {
+		k := koanf.New(".")
+		require.Nil(t, k.Load(rawbytes.Provider([]byte(test.inputYAML)), yaml.Parser()))
+		if test.expectedPanic {
+			require.Panics(t, func() { declaredActions(k) }, "yaml %q", test.inputYAML)
+			continue
+		}
+		require.Equal(t, test.expectedDeclared, declaredActions(k), "yaml %q", test.inputYAML)
+	}
+}
+
+func TestMetricOptions(t *testing.T) {
+	tests := []struct {
+		inputYAML           string
+		expectedTimeout     time.Duration
+		expectedConcurrency int
+		expectedJitter      time.Duration
+		expectedStagger     time.Duration
+		expectedEmptyWarn   time.Duration
+	}{
+		{
+			inputYAML:           "metrics:\n  slow_probe_timeout: 10\n  slow_probe_concurrency: 8",
+			expectedTimeout:     10 * time.Second,
+			expectedConcurrency: 8,
+			expectedEmptyWarn:   24 * time.Hour,
+		},
+		{
+			inputYAML:         "metrics:\n  jitter: 3\n  slow_probe_stagger: 250",
+			expectedJitter:    3 * time.Second,
+			expectedStagger:   250 * time.Millisecond,
+			expectedEmptyWarn: 24 * time.Hour,
+		},
+		{
+			inputYAML:         "components:\n  - dmh",
+			expectedEmptyWarn: 24 * time.Hour,
+		},
+		{
+			inputYAML:         "metrics:\n  empty_warn_after: 72",
+			expectedEmptyWarn: 72 * time.Hour,
+		},
+		{
+			inputYAML: "metrics:\n  empty_warn_after: 0",
+		},
+	}
+	for _, test := range tests {
+		k := koanf.New(".")
+		require.Nil(t, k.Load(rawbytes.Provider([]byte(test.inputYAML)), yaml.Parser()))
+		opts := metricOptions(k, nil, nil)
+		require.Equal(t, test.expectedTimeout, opts.SlowProbeTimeout, "yaml %q", test.inputYAML)
+		require.Equal(t, test.expectedConcurrency, opts.SlowProbeConcurrency, "yaml %q", test.inputYAML)
+		require.Equal(t, test.expectedJitter, opts.Jitter, "yaml %q", test.inputYAML)
+		require.Equal(t, test.expectedStagger, opts.SlowProbeStagger, "yaml %q", test.inputYAML)
+		require.Equal(t, test.expectedEmptyWarn, opts.EmptyWarnAfter, "yaml %q", test.inputYAML)
+		require.Nil(t, opts.Vault)
+	}
+
+	v := &vault.Vault{}
+	require.Equal(t, v, metricOptions(koanf.New("."), nil, v).Vault)
+}
+
+func TestActionsGCAfter(t *testing.T) {
+	tests := []struct {
+		inputYAML       string
+		expectedGCAfter time.Duration
+	}{
+		{
+			inputYAML:       "state:\n  gc_after: 720",
+			expectedGCAfter: 720 * time.Hour,
+		},
+		{
+			inputYAML:       "state:\n  gc_after: -1",
+			expectedGCAfter: 0,
+		},
+		{
+			inputYAML:       "components:\n  - dmh",
+			expectedGCAfter: 0,
+		},
+	}
+	for _, test := range tests {
+		k := koanf.New(".")
+		require.Nil(t, k.Load(rawbytes.Provider([]byte(test.inputYAML)), yaml.Parser()))
+		require.Equal(t, test.expectedGCAfter, actionsGCAfter(k, time.Hour), "yaml %q", test.inputYAML)
+	}
+}
+
+func TestMaxVaultDowntime(t *testing.T) {
+	tests := []struct {
+		inputYAML        string
+		expectedDowntime time.Duration
+	}{
+		{
+			inputYAML:        "decrypt:\n  max_vault_downtime: 900",
+			expectedDowntime: 15 * time.Minute,
+		},
+		{
+			inputYAML:        "decrypt:\n  max_vault_downtime: -1",
+			expectedDowntime: 0,
+		},
+		{
+			inputYAML:        "components:\n  - dmh",
+			expectedDowntime: 0,
+		},
+	}
+	for _, test := range tests {
+		k := koanf.New(".")
+		require.Nil(t, k.Load(rawbytes.Provider([]byte(test.inputYAML)), yaml.Parser()))
+		require.Equal(t, test.expectedDowntime, maxVaultDowntime(k), "yaml %q", test.inputYAML)
+	}
+}
+
+func TestAliveCronToken(t *testing.T) {
+	tests := []struct {
+		inputYAML     string
+		expectedToken string
+		expectedPanic bool
+	}{
+		{
+			inputYAML:     "alive:\n  cron_token: 4C5DC9B7708905F77F5E5D16316B5DFB425E68CB326DCD55A860E90A7707031E",
+			expectedToken: "4c5dc9b7708905f77f5e5d16316b5dfb425e68cb326dcd55a860e90a7707031e",
+		},
+		{
+			inputYAML:     "alive:\n  cron_token: test-token",
+			expectedPanic: true,
+		},
+		{
+			inputYAML: "components:\n  - dmh",
+		},
+	}
+	for _, test := range tests {
+		k := koanf.New(".")
+		require.Nil(t, k.Load(rawbytes.Provider([]byte(test.inputYAML)), yaml.Parser()))
+		if test.expectedPanic {
+			require.Panics(t, func() { aliveCronToken(k) }, "yaml %q", test.inputYAML)
+			continue
+		}
+		require.Equal(t, test.expectedToken, aliveCronToken(k), "yaml %q", test.inputYAML)
+	}
+}
+
+func TestMaxBodyBytes(t *testing.T) {
+	tests := []struct {
+		inputYAML            string
+		expectedMaxBodyBytes int64
+		expectedMaxDataBytes int
+	}{
+		{
+			inputYAML:            "http:\n  max_body_bytes: 2048\naction:\n  max_data_bytes: 1024",
+			expectedMaxBodyBytes: 2048,
+			expectedMaxDataBytes: 1024,
+		},
+		{
+			inputYAML: "http:\n  max_body_bytes: -1\naction:\n  max_data_bytes: -1",
+		},
+		{
+			inputYAML: "components:\n  - dmh",
+		},
+	}
+	for _, test := range tests {
+		k := koanf.New(".")
+		require.Nil(t, k.Load(rawbytes.Provider([]byte(test.inputYAML)), yaml.Parser()))
+		require.Equal(t, test.expectedMaxBodyBytes, maxBodyBytes(k), "yaml %q", test.inputYAML)
+		require.Equal(t, test.expectedMaxDataBytes, actionMaxDataBytes(k), "yaml %q", test.inputYAML)
+	}
+}
+
+func TestValidateOnStart(t *testing.T) {
+	tests := []struct {
+		inputYAML    string
+		expectedMode string
+		shouldPanic  bool
+	}{
+		{inputYAML: "components:\n  - dmh"},
+		{inputYAML: "execute:\n  validate_on_start: warn", expectedMode: "warn"},
+		{inputYAML: "execute:\n  validate_on_start: fail", expectedMode: "fail"},
+		{inputYAML: "execute:\n  validate_on_start: always", shouldPanic: true},
+	}
+	for _, test := range tests {
+		k := koanf.New(".")
+		require.Nil(t, k.Load(rawbytes.Provider([]byte(test.inputYAML)), yaml.Parser()))
+		if test.shouldPanic {
+			require.Panics(t, func() { validateOnStart(k) }, "yaml %q", test.inputYAML)
+			continue
+		}
+		require.Equal(t, test.expectedMode, validateOnStart(k), "yaml %q", test.inputYAML)
+	}
+}
+
+func TestGetServerTLS(t *testing.T) {
+	tests := []struct {
+		inputYAML     string
+		expectedTLS   serverTLS
+		expectedPanic bool
+	}{
+		{
+			inputYAML:   "components:\n  - dmh",
+			expectedTLS: serverTLS{MinVersion: tls.VersionTLS12},
+		},
+		{
+			inputYAML:   "http:\n  tls_cert: cert.pem\n  tls_key: key.pem",
+			expectedTLS: serverTLS{CertFile: "cert.pem", KeyFile: "key.pem", MinVersion: tls.VersionTLS12},
+		},
+		{
+			inputYAML:   "http:\n  tls_cert: cert.pem\n  tls_key: key.pem\n  tls_min_version: 1.3",
+			expectedTLS: serverTLS{CertFile: "cert.pem", KeyFile: "key.pem", MinVersion: tls.VersionTLS13},
+		},
+		{
+			inputYAML:     "http:\n  tls_cert: cert.pem",
+			expectedPanic: true,
+		},
+		{
+			inputYAML:     "http:\n  tls_key: key.pem",
+			expectedPanic: true,
+		},
+		{
+			inputYAML:     "http:\n  tls_min_version: 1.1",
+			expectedPanic: true,
+		},
+	}
+	for _, test := range tests {
+		k := koanf.New(".")
+		require.Nil(t, k.Load(rawbytes.Provider([]byte(test.inputYAML)), yaml.Parser()))
+		if test.expectedPanic {
+			require.Panics(t, func() { getServerTLS(k) }, "yaml %q", test.inputYAML)
+			continue
+		}
+		require.Equal(t, test.expectedTLS, getServerTLS(k), "yaml %q", test.inputYAML)
+	}
+}
+
+func TestReconcileInterval(t *testing.T) {
+	tests := []struct {
+		inputYAML        string
+		expectedInterval time.Duration
+	}{
+		{
+			inputYAML:        "reconcile:\n  interval: 3600",
+			expectedInterval: time.Hour,
+		},
+		{
+			inputYAML:        "reconcile:\n  interval: -1",
+			expectedInterval: 0,
+		},
+		{
+			inputYAML:        "components:\n  - dmh",
+			expectedInterval: 0,
+		},
+	}
+	for _, test := range tests {
+		k := koanf.New(".")
+		require.Nil(t, k.Load(rawbytes.Provider([]byte(test.inputYAML)), yaml.Parser()))
+		require.Equal(t, test.expectedInterval, reconcileInterval(k), "yaml %q", test.inputYAML)
+	}
+}
+
+func TestGetConfirmPolicy(t *testing.T) {
+	tests := []struct {
+		inputYAML      string
+		expectedPolicy confirmPolicy
+		expectedPanic  bool
+	}{
+		{
+			inputYAML:      "action:\n  confirm:\n    kinds: [mail, json_post]\n    window: 30",
+			expectedPolicy: confirmPolicy{Kinds: []string{"mail", "json_post"}, Window: 30 * time.Minute},
+		},
+		{
+			inputYAML:      "action:\n  confirm:\n    destructive: true\n    window: 10",
+			expectedPolicy: confirmPolicy{Kinds: []string{}, Destructive: true, Window: 10 * time.Minute},
+		},
+		{
+			inputYAML:     "action:\n  confirm:\n    kinds: [mail]",
+			expectedPanic: true,
+		},
+		{
+			inputYAML:     "action:\n  confirm:\n    destructive: true",
+			expectedPanic: true,
+		},
+		{
+			inputYAML:      "components:\n  - dmh",
+			expectedPolicy: confirmPolicy{Kinds: []string{}},
+		},
+	}
+	for _, test := range tests {
+		k := koanf.New(".")
+		require.Nil(t, k.Load(rawbytes.Provider([]byte(test.inputYAML)), yaml.Parser()))
+		if test.expectedPanic {
+			require.Panics(t, func() { getConfirmPolicy(k, time.Minute) }, "yaml %q", test.inputYAML)
+			continue
+		}
+		policy := getConfirmPolicy(k, time.Minute)
+		require.Equal(t, test.expectedPolicy, policy, "yaml %q", test.inputYAML)
+		require.Equal(t, len(test.expectedPolicy.Kinds) > 0, policy.requires(&state.Action{Kind: "mail"}))
+		require.Equal(t, test.expectedPolicy.Destructive, policy.requires(&state.Action{Kind: "dummy", Severity: state.SeverityDestructive}))
+		require.False(t, policy.requires(&state.Action{Kind: "dummy", Severity: state.SeverityNotify}))
+	}
+}
+
+func TestGetFailureBackoff(t *testing.T) {
+	tests := []struct {
+		inputYAML       string
+		expectedBackoff failureBackoff
+		expectedPanic   bool
+	}{
+		{
+			inputYAML:       "action:\n  failure_backoff:\n    after: 3\n    initial: 30\n    max: 600",
+			expectedBackoff: failureBackoff{After: 3, Initial: 30 * time.Second, Max: 10 * time.Minute},
+		},
+		{
+			inputYAML:       "action:\n  failure_backoff:\n    after: 2",
+			expectedBackoff: failureBackoff{After: 2, Initial: time.Minute, Max: time.Hour},
+		},
+		{
+			inputYAML:     "action:\n  failure_backoff:\n    after: 2\n    initial: 120\n    max: 60",
+			expectedPanic: true,
+		},
+		{
+			inputYAML:       "components:\n  - dmh",
+			expectedBackoff: failureBackoff{Initial: time.Minute, Max: time.Hour},
+		},
+	}
+	for _, test := range tests {
+		k := koanf.New(".")
+		require.Nil(t, k.Load(rawbytes.Provider([]byte(test.inputYAML)), yaml.Parser()))
+		if test.expectedPanic {
+			require.Panics(t, func() { getFailureBackoff(k) }, "yaml %q", test.inputYAML)
+			continue
+		}
+		require.Equal(t, test.expectedBackoff, getFailureBackoff(k), "yaml %q", test.inputYAML)
+	}
+}
+
 func TestProcessUnit(t *testing.T) {
 	tests := []struct {
 		inputYAML    string
@@ -281,6 +944,62 @@ func TestReadConfig(t *testing.T) {
 				return k
 			},
 		},
+		{
+			configFunc: func(configFile string) {
+				f, err := os.Create(configFile)
+				require.Nil(t, err)
+				defer f.Close()
+				_, err = f.WriteString(`
+                                components:
+                                - dmh
+                                profile: prod
+                                profiles:
+                                  staging:
+                                    execute:
+                                      plugin:
+                                        mail:
+                                          server: staging-server
+                                `)
+				require.Nil(t, err)
+			},
+			shouldPanic: true,
+		},
+		{
+			configFunc: func(configFile string) {
+				f, err := os.Create(configFile)
+				require.Nil(t, err)
+				defer f.Close()
+				_, err = f.WriteString(`
+                                components:
+                                - dmh
+                                profile: staging
+                                profiles:
+                                  staging:
+                                    execute:
+                                      plugin:
+                                        mail:
+                                          server: staging-server
+                                `)
+				require.Nil(t, err)
+			},
+			expectedKoanf: func() *koanf.Koanf {
+				b := []byte(`
+                                components:
+                                - dmh
+                                profile: staging
+                                profiles:
+                                  staging:
+                                    execute:
+                                      plugin:
+                                        mail:
+                                          server: staging-server
+                                `)
+				k := koanf.New(".")
+				err := k.Load(rawbytes.Provider(b), yaml.Parser())
+				require.Nil(t, err)
+				return k
+			},
+		},
 	}
 	for _, test := range tests {
 		configFile := "test_config.yaml"
@@ -289,10 +1008,10 @@ func TestReadConfig(t *testing.T) {
 		defer os.Remove(configFile)
 		if test.shouldPanic {
 			require.Panics(t, func() {
-				readConfig(configFile)
+				readConfig(configFile, "")
 			})
 		} else {
-			k := readConfig(configFile)
+			k := readConfig(configFile, "")
 			expectedK := test.expectedKoanf()
 			require.Equal(t, expectedK, k)
 		}
@@ -452,10 +1171,10 @@ func TestReadConfigEnv(t *testing.T) {
 		}
 		if test.shouldPanic {
 			require.Panics(t, func() {
-				readConfig(configFile)
+				readConfig(configFile, "")
 			})
 		} else {
-			k := readConfig(configFile)
+			k := readConfig(configFile, "")
 			marshaledK, err := k.Marshal(yaml.Parser())
 			require.Nil(t, err)
 
@@ -500,7 +1219,7 @@ func TestReadConfigMergeEnvFile(t *testing.T) {
 		require.Nil(t, err)
 	}()
 
-	k := readConfig(configFile)
+	k := readConfig(configFile, "")
 	marshaledK, err := k.Marshal(yaml.Parser())
 	require.Nil(t, err)
 
@@ -528,6 +1247,164 @@ func TestReadConfigMergeEnvFile(t *testing.T) {
 
 }
 
+func TestReadConfigDir(t *testing.T) {
+	configFile := "test_read_config_dir.yaml"
+	configDir := "test_read_config_dir.d"
+	require.Nil(t, os.WriteFile(configFile, []byte(`
+        components:
+        - dmh
+        state:
+          file: test.json
+        remote_vault:
+          client_uuid: test
+          url: http://test
+        `), 0600))
+	defer os.Remove(configFile)
+	require.Nil(t, os.MkdirAll(configDir, 0700))
+	defer os.RemoveAll(configDir)
+	require.Nil(t, os.WriteFile(configDir+"/20-vault.yaml", []byte(`
+        remote_vault:
+          url: http://override
+        `), 0600))
+	require.Nil(t, os.WriteFile(configDir+"/10-mail.yaml", []byte(`
+        remote_vault:
+          url: http://first
+        execute:
+          plugin:
+            mail:
+              server: localhost
+        `), 0600))
+	require.Nil(t, os.WriteFile(configDir+"/ignored.yml", []byte(`
+        state:
+          file: ignored.json
+        `), 0600))
+
+	k := readConfig(configFile, configDir)
+	marshaledK, err := k.Marshal(yaml.Parser())
+	require.Nil(t, err)
+
+	expectedK := koanf.New(".")
+	err = expectedK.Load(rawbytes.Provider([]byte(`
+                                components:
+                                - dmh
+                                state:
+                                  file: test.json
+                                remote_vault:
+                                  client_uuid: test
+                                  url: http://override
+                                execute:
+                                  plugin:
+                                    mail:
+                                      server: localhost
+                                `)), yaml.Parser())
+	require.Nil(t, err)
+	marshaledExpectedK, err := expectedK.Marshal(yaml.Parser())
+	require.Nil(t, err)
+	require.Equal(t, marshaledExpectedK, marshaledK)
+
+	require.Panics(t, func() { readConfig(configFile, "test_read_config_dir_missing.d") })
+
+	require.Nil(t, os.WriteFile(configDir+"/30-broken.yaml", []byte("{broken"), 0600))
+	require.Panics(t, func() { readConfig(configFile, configDir) })
+}
+
+func TestReadConfigEncrypted(t *testing.T) {
+	master, err := crypt.NewAge("")
+	require.Nil(t, err)
+	other, err := crypt.NewAge("")
+	require.Nil(t, err)
+	encryptedKey, err := crypt.EncryptValue(master, "AGE-SECRET-KEY-TEST")
+	require.Nil(t, err)
+	encryptedPassword, err := crypt.EncryptValue(master, "smtp-password")
+	require.Nil(t, err)
+	encryptedRecipient, err := crypt.EncryptValue(master, "secret@example.com")
+	require.Nil(t, err)
+	encryptedOther, err := crypt.EncryptValue(other, "other")
+	require.Nil(t, err)
+
+	configFile := "test_read_config_encrypted.yaml"
+	defer os.Remove(configFile)
+	masterKeyFile := filepath.Join(t.TempDir(), "master.key")
+	require.Nil(t, os.WriteFile(masterKeyFile, []byte(master.GetPrivateKey()+"\n"), 0600))
+
+	writeConfig := func(extra string) {
+		require.Nil(t, os.WriteFile(configFile, []byte(fmt.Sprintf(`
+components:
+- vault
+vault:
+  key: "%s"
+  file: vault.json
+execute:
+  test_mode:
+    recipients:
+    - plain@example.com
+    - "%s"
+%s`, encryptedKey, encryptedRecipient, extra)), 0600))
+	}
+
+	t.Setenv(crypt.MasterKeyEnv, master.GetPrivateKey())
+	t.Setenv(crypt.MasterKeyFileEnv, "")
+	t.Setenv("DMH_EXECUTE__PLUGIN__MAIL__PASSWORD", encryptedPassword)
+	writeConfig("")
+	k := readConfig(configFile, "")
+	require.Equal(t, "AGE-SECRET-KEY-TEST", k.String("vault.key"))
+	require.Equal(t, "vault.json", k.String("vault.file"))
+	require.Equal(t, "smtp-password", k.String("execute.plugin.mail.password"))
+	require.Equal(t, []string{"plain@example.com", "secret@example.com"}, k.Strings("execute.test_mode.recipients"))
+	require.False(t, k.Exists("master_key"))
+
+	t.Setenv(crypt.MasterKeyEnv, "")
+	t.Setenv(crypt.MasterKeyFileEnv, masterKeyFile)
+	k = readConfig(configFile, "")
+	require.Equal(t, "AGE-SECRET-KEY-TEST", k.String("vault.key"))
+	require.False(t, k.Exists("master_key_file"))
+
+	t.Setenv(crypt.MasterKeyFileEnv, "")
+	require.PanicsWithValue(t, "config key execute.plugin.mail.password is encrypted, but DMH_MASTER_KEY or DMH_MASTER_KEY_FILE is not set", func() { readConfig(configFile, "") })
+
+	t.Setenv(crypt.MasterKeyEnv, "invalid")
+	require.Panics(t, func() { readConfig(configFile, "") })
+
+	t.Setenv(crypt.MasterKeyEnv, master.GetPrivateKey())
+	t.Setenv("DMH_EXECUTE__PLUGIN__MAIL__PASSWORD", encryptedOther)
+	require.Panics(t, func() { readConfig(configFile, "") })
+
+	t.Setenv("DMH_EXECUTE__PLUGIN__MAIL__PASSWORD", "plain")
+	writeConfig(`state:
+  file: "!encrypted:broken"
+`)
+	require.Panics(t, func() { readConfig(configFile, "") })
+
+	t.Setenv(crypt.MasterKeyEnv, "")
+	writeConfig("")
+	require.Panics(t, func() { readConfig(configFile, "") })
+}
+
+func TestGetLastSeenMetaConfig(t *testing.T) {
+	tests := []struct {
+		inputYAML      string
+		expectedConfig api.LastSeenMetaConfig
+	}{
+		{
+			inputYAML:      "state:\n  file: state.json",
+			expectedConfig: api.LastSeenMetaConfig{},
+		},
+		{
+			inputYAML:      "state:\n  last_seen_meta:\n    enabled: true",
+			expectedConfig: api.LastSeenMetaConfig{Enabled: true},
+		},
+		{
+			inputYAML:      "state:\n  last_seen_meta:\n    enabled: true\n    trust_forwarded_for: true",
+			expectedConfig: api.LastSeenMetaConfig{Enabled: true, TrustForwardedFor: true},
+		},
+	}
+	for _, test := range tests {
+		k := koanf.New(".")
+		require.Nil(t, k.Load(rawbytes.Provider([]byte(test.inputYAML)), yaml.Parser()))
+		require.Equal(t, test.expectedConfig, getLastSeenMetaConfig(k))
+	}
+}
+
 func TestGetAuthConfig(t *testing.T) {
 	tests := []struct {
 		koanfFunc      func() *koanf.Koanf
@@ -782,6 +1659,7 @@ func TestGetMailConfig(t *testing.T) {
                                       password: password
                                       server: server
                                       from: from@address
+                                      from_name: Dead Man
                                       tls_policy: no_tls
                                 `)
 				k := koanf.New(".")
@@ -794,9 +1672,70 @@ func TestGetMailConfig(t *testing.T) {
 				Password:  "password",
 				Server:    "server",
 				From:      "from@address",
+				FromName:  "Dead Man",
 				TLSPolicy: "no_tls",
 			},
 		},
+		{
+			koanfFunc: func() *koanf.Koanf {
+				b := []byte(`
+                                profile: prod
+                                execute:
+                                  plugin:
+                                    mail:
+                                      username: test
+                                      password: password
+                                      server: staging-server
+                                      from: from@address
+                                profiles:
+                                  prod:
+                                    execute:
+                                      plugin:
+                                        mail:
+                                          password: prod-password
+                                          server: prod-server
+                                  staging:
+                                    execute:
+                                      plugin:
+                                        mail:
+                                          server: other-server
+                                `)
+				k := koanf.New(".")
+				err := k.Load(rawbytes.Provider(b), yaml.Parser())
+				require.Nil(t, err)
+				return k
+			},
+			expectedConfig: execute.MailConfig{
+				Username:  "test",
+				Password:  "prod-password",
+				Server:    "prod-server",
+				From:      "from@address",
+				TLSPolicy: "tls_mandatory",
+			},
+		},
+		{
+			koanfFunc: func() *koanf.Koanf {
+				b := []byte(`
+                                profile: prod
+                                profiles:
+                                  prod:
+                                    execute:
+                                      plugin:
+                                        mail:
+                                          server: prod-server
+                                          from: from@address
+                                `)
+				k := koanf.New(".")
+				err := k.Load(rawbytes.Provider(b), yaml.Parser())
+				require.Nil(t, err)
+				return k
+			},
+			expectedConfig: execute.MailConfig{
+				Server:    "prod-server",
+				From:      "from@address",
+				TLSPolicy: "tls_mandatory",
+			},
+		},
 		{
 			koanfFunc: func() *koanf.Koanf {
 				b := []byte(`
@@ -833,3 +1772,228 @@ func TestGetMailConfig(t *testing.T) {
 		}
 	}
 }
+
+func TestGetJSONPostConfig(t *testing.T) {
+	tests := []struct {
+		inputConfig    string
+		shouldPanic    bool
+		expectedConfig execute.JSONPostConfig
+	}{
+		{
+			inputConfig: `execute:
+  plugin:
+    missing:
+      data: 10
+`,
+			expectedConfig: execute.JSONPostConfig{},
+		},
+		{
+			inputConfig: `execute:
+  plugin:
+    json_post:
+      default_headers:
+        Authorization: Bearer token
+        X-Source: dmh
+`,
+			expectedConfig: execute.JSONPostConfig{
+				DefaultHeaders: map[string]string{"Authorization": "Bearer token", "X-Source": "dmh"},
+			},
+		},
+		{
+			inputConfig: `execute:
+  plugin:
+    json_post:
+      default_headers:
+        - Authorization
+`,
+			shouldPanic: true,
+		},
+		{
+			inputConfig: `execute:
+  plugin:
+    json_post:
+      default_headers:
+        X-Retry: 3
+`,
+			shouldPanic: true,
+		},
+		{
+			inputConfig: `execute:
+  plugin:
+    json_post:
+      deny_private: true
+      allow:
+        - hooks.lan
+        - 192.168.1.0/24
+`,
+			expectedConfig: execute.JSONPostConfig{DenyPrivate: true, Allow: []string{"hooks.lan", "192.168.1.0/24"}},
+		},
+		{
+			inputConfig: `execute:
+  plugin:
+    json_post:
+      deny_private: true
+      allow:
+        - 192.168.1.0/33
+`,
+			shouldPanic: true,
+		},
+	}
+	for _, test := range tests {
+		k := koanf.New(".")
+		err := k.Load(rawbytes.Provider([]byte(test.inputConfig)), yaml.Parser())
+		require.Nil(t, err)
+		if test.shouldPanic {
+			require.Panics(t, func() { getJSONPostConfig(k) })
+		} else {
+			config := getJSONPostConfig(k)
+			require.Equal(t, test.expectedConfig, config)
+		}
+	}
+}
+
+func TestGetJournalConfig(t *testing.T) {
+	journalFile := filepath.Join(t.TempDir(), "journal.jsonl")
+	tests := []struct {
+		inputConfig    string
+		shouldPanic    bool
+		expectedConfig execute.JournalConfig
+	}{
+		{
+			inputConfig:    "components:\n  - dmh\n",
+			expectedConfig: execute.JournalConfig{},
+		},
+		{
+			inputConfig:    fmt.Sprintf("execute:\n  plugin:\n    journal:\n      file: %s\n", journalFile),
+			expectedConfig: execute.JournalConfig{File: journalFile},
+		},
+		{
+			inputConfig: "execute:\n  plugin:\n    journal:\n      file: \"\"\n",
+			shouldPanic: true,
+		},
+		{
+			inputConfig: fmt.Sprintf("execute:\n  plugin:\n    journal:\n      file: %s\n", filepath.Join(journalFile, "nested")),
+			shouldPanic: true,
+		},
+	}
+	for _, test := range tests {
+		k := koanf.New(".")
+		err := k.Load(rawbytes.Provider([]byte(test.inputConfig)), yaml.Parser())
+		require.Nil(t, err)
+		if test.shouldPanic {
+			require.Panics(t, func() { getJournalConfig(k) })
+			continue
+		}
+		require.Equal(t, test.expectedConfig, getJournalConfig(k))
+	}
+}
+
+func TestGetFileWriteConfig(t *testing.T) {
+	tests := []struct {
+		inputConfig    string
+		shouldPanic    bool
+		expectedConfig execute.FileWriteConfig
+	}{
+		{
+			inputConfig:    "components:\n  - dmh\n",
+			expectedConfig: execute.FileWriteConfig{},
+		},
+		{
+			inputConfig:    "execute:\n  plugin:\n    file_write:\n      allowed_dirs:\n        - /var/dmh/out\n",
+			expectedConfig: execute.FileWriteConfig{AllowedDirs: []string{"/var/dmh/out"}},
+		},
+		{
+			inputConfig: "execute:\n  plugin:\n    file_write:\n      allowed_dirs: []\n",
+			shouldPanic: true,
+		},
+		{
+			inputConfig: "execute:\n  plugin:\n    file_write:\n      allowed_dirs:\n        - out\n",
+			shouldPanic: true,
+		},
+	}
+	for _, test := range tests {
+		k := koanf.New(".")
+		err := k.Load(rawbytes.Provider([]byte(test.inputConfig)), yaml.Parser())
+		require.Nil(t, err)
+		if test.shouldPanic {
+			require.Panics(t, func() { getFileWriteConfig(k) })
+			continue
+		}
+		require.Equal(t, test.expectedConfig, getFileWriteConfig(k))
+	}
+}
+
+func TestGetTestModeConfig(t *testing.T) {
+	tests := []struct {
+		inputConfig    string
+		shouldPanic    bool
+		expectedConfig execute.TestModeConfig
+	}{
+		{
+			inputConfig:    "components:\n  - dmh\n",
+			expectedConfig: execute.TestModeConfig{},
+		},
+		{
+			inputConfig: `execute:
+  test_mode:
+    enabled: true
+    mail: me@test.com
+    phone: "+48111222333"
+`,
+			expectedConfig: execute.TestModeConfig{Enabled: true, Mail: "me@test.com", Phone: "+48111222333"},
+		},
+		{
+			inputConfig: `execute:
+  test_mode:
+    enabled: true
+`,
+			shouldPanic: true,
+		},
+		{
+			inputConfig: `execute:
+  test_mode:
+    enabled: true
+    url: not-url
+`,
+			shouldPanic: true,
+		},
+	}
+	for _, test := range tests {
+		k := koanf.New(".")
+		err := k.Load(rawbytes.Provider([]byte(test.inputConfig)), yaml.Parser())
+		require.Nil(t, err)
+		if test.shouldPanic {
+			require.Panics(t, func() { getTestModeConfig(k) })
+		} else {
+			config := getTestModeConfig(k)
+			require.Equal(t, test.expectedConfig, config)
+		}
+	}
+}
+
+func TestGetQueueConfig(t *testing.T) {
+	tests := []struct {
+		inputConfig    string
+		expectedConfig execute.QueueConfig
+	}{
+		{
+			inputConfig:    "components:\n  - dmh\n",
+			expectedConfig: execute.QueueConfig{},
+		},
+		{
+			inputConfig: `execute:
+  mode: queue
+  queue:
+    url: nats://127.0.0.1:4222
+    subject: dmh.actions
+`,
+			expectedConfig: execute.QueueConfig{URL: "nats://127.0.0.1:4222", Subject: "dmh.actions"},
+		},
+	}
+	for _, test := range tests {
+		k := koanf.New(".")
+		err := k.Load(rawbytes.Provider([]byte(test.inputConfig)), yaml.Parser())
+		require.Nil(t, err)
+		require.Equal(t, test.expectedConfig, getQueueConfig(k))
+	}
+}
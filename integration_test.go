@@ -50,6 +50,12 @@ func authRequest(method string, url string, token string, body []byte) (*http.Re
 	return http.DefaultClient.Do(req)
 }
 
+// confirmedAction is /api/action/test request which really runs action.
+type confirmedAction struct {
+	*state.Action
+	Confirm bool `json:"confirm"`
+}
+
 // syncBuffer is goroutine safe bytes.Buffer for capturing logs.
 type syncBuffer struct {
 	mtx sync.Mutex
@@ -237,13 +243,13 @@ func TestDMH(t *testing.T) {
 	resp, err = authRequest("GET", "http://127.0.0.1:8080/api/action/store", "unknown-token", nil)
 	require.Nil(t, err)
 	defer resp.Body.Close()
-	require.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	require.Equal(t, http.StatusForbidden, resp.StatusCode)
 
 	// Lets check that request with valid token but without covering scope is rejected
 	resp, err = authRequest("GET", "http://127.0.0.1:8080/api/action/store", vaultBearerToken, nil)
 	require.Nil(t, err)
 	defer resp.Body.Close()
-	require.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	require.Equal(t, http.StatusForbidden, resp.StatusCode)
 
 	// Fetch secrets uuids we know
 	for _, test := range []struct {
@@ -273,9 +279,24 @@ func TestDMH(t *testing.T) {
 		Data:         `{"url":"http://127.0.0.1:9090/action/test","data":{"key1":"value1", "key2": "action/test"}, "headers": {"header3": "test1", "header4": "test2"}, "success_code":[200]}`,
 	}
 
+	// Without confirm action is only validated, /action/test is not hit.
 	actionJson, err = json.Marshal(action)
 	require.Nil(t, err)
 
+	resp, err = authRequest("POST", "http://127.0.0.1:8080/api/action/test", userBearerToken, actionJson)
+	require.Nil(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var dryRun struct {
+		DryRun bool `json:"dry_run"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&dryRun)
+	require.Nil(t, err)
+	require.True(t, dryRun.DryRun)
+
+	actionJson, err = json.Marshal(confirmedAction{action, true})
+	require.Nil(t, err)
+
 	resp, err = authRequest("POST", "http://127.0.0.1:8080/api/action/test", userBearerToken, actionJson)
 	require.Nil(t, err)
 	defer resp.Body.Close()
@@ -288,7 +309,7 @@ func TestDMH(t *testing.T) {
 		Data:         `{"message":"integration test dummy action"}`,
 	}
 
-	actionJson, err = json.Marshal(action)
+	actionJson, err = json.Marshal(confirmedAction{action, true})
 	require.Nil(t, err)
 
 	resp, err = authRequest("POST", "http://127.0.0.1:8080/api/action/test", userBearerToken, actionJson)
@@ -304,7 +325,7 @@ func TestDMH(t *testing.T) {
 		Data:         `{"url":"http://127.0.0.1:9090/action/sig_auth","data":{"link":"https://dmh.example.com/{sig_auth:alive}"},"success_code":[200]}`,
 	}
 
-	actionJson, err = json.Marshal(action)
+	actionJson, err = json.Marshal(confirmedAction{action, true})
 	require.Nil(t, err)
 
 	resp, err = authRequest("POST", "http://127.0.0.1:8080/api/action/test", sigAuthBearerToken, actionJson)
@@ -319,7 +340,7 @@ func TestDMH(t *testing.T) {
 		Data:         `{"url":"http://127.0.0.1:9090/action/sig_auth","data":{"link":"https://dmh.example.com/{sig_auth:metrics}"},"success_code":[200]}`,
 	}
 
-	actionJson, err = json.Marshal(action)
+	actionJson, err = json.Marshal(confirmedAction{action, true})
 	require.Nil(t, err)
 
 	resp, err = authRequest("POST", "http://127.0.0.1:8080/api/action/test", sigAuthBearerToken, actionJson)
@@ -597,9 +618,10 @@ func TestDMH(t *testing.T) {
 	require.Contains(t, string(body), `dmh_action_errors_total{action="bf577b9d-26f4-4168-b8e4-0e1d692559ed",error="DecryptAction"} 10`)
 	require.Regexp(t, `dmh_action_errors_total{action="[a-f0-9-]+",error="Run"} [0-9]+`, string(body))
 
-	require.Contains(t, string(body), `dmh_http_requests_total{code="401",method="GET"} 3`)
+	require.Contains(t, string(body), `dmh_http_requests_total{code="401",method="GET"} 1`)
+	require.Contains(t, string(body), `dmh_http_requests_total{code="403",method="GET"} 2`)
 	require.Contains(t, string(body), `dmh_http_requests_total{code="201",method="POST"} 10`)
-	require.Contains(t, string(body), `dmh_http_requests_total{code="200",method="POST"} 3`)
+	require.Contains(t, string(body), `dmh_http_requests_total{code="200",method="POST"} 4`)
 	require.Contains(t, string(body), `dmh_http_requests_total{code="403",method="POST"} 1`)
 
 	require.Contains(t, string(body), `dmh_auth_failures_total{reason="missing_credentials",type=""} 1`)
@@ -617,7 +639,7 @@ func TestDMH(t *testing.T) {
 	resp, err = authRequest("GET", "http://127.0.0.1:8080/alive", userBearerToken, nil)
 	require.Nil(t, err)
 	defer resp.Body.Close()
-	require.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	require.Equal(t, http.StatusForbidden, resp.StatusCode)
 
 	// Signed URL grants access to exactly /alive without any bearer token.
 	signedAliveURL := "http://127.0.0.1:8080" + crypt.SignURL("integration-test-signed-url-secret", "/alive", time.Now().Add(time.Hour))
@@ -640,14 +662,14 @@ func TestDMH(t *testing.T) {
 	resp, err = http.Get(wrongSecretURL)
 	require.Nil(t, err)
 	defer resp.Body.Close()
-	require.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	require.Equal(t, http.StatusForbidden, resp.StatusCode)
 
 	// Expired signature does not authorize.
 	expiredURL := "http://127.0.0.1:8080" + crypt.SignURL("integration-test-signed-url-secret", "/alive", time.Now().Add(-time.Hour))
 	resp, err = http.Get(expiredURL)
 	require.Nil(t, err)
 	defer resp.Body.Close()
-	require.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	require.Equal(t, http.StatusForbidden, resp.StatusCode)
 }
 
 func TestDMHAuthDisabled(t *testing.T) {
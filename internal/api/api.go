@@ -1,101 +1,232 @@
 package api
 
 import (
+	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
+	"math"
+	"net"
 	"net/http"
 	"net/url"
+	"strconv"
+	"strings"
 	"time"
 
 	"dmh/internal/auth"
+	"dmh/internal/crypt"
 	"dmh/internal/execute"
+	"dmh/internal/metric"
 	"dmh/internal/state"
+	"dmh/internal/useragent"
 	"dmh/internal/vault"
+	"dmh/internal/version"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/render"
+	"gopkg.in/yaml.v3"
 )
 
 const httpClientTimeout = 15 * time.Second
 
+// ErrActionDataTooLarge is returned when action data exceeds action.max_data_bytes.
+var ErrActionDataTooLarge = errors.New("action data too large")
+
+const (
+	// minDeadlineLead is how far in the future deadline must be, it covers clock skew between client and server.
+	// Closer deadline would fire action on next dispatcher run, it is most likely a mistake.
+	minDeadlineLead = time.Minute
+	// soonFireWarning is time after last seen below which new action is reported as firing almost immediately.
+	soonFireWarning = 10 * time.Minute
+)
+
 var (
+	// eventsKeepAliveInterval is how often SSE comment is sent to keep idle stream open.
+	eventsKeepAliveInterval = 15 * time.Second
 	// httpClient is used for the outbound http connections.
-	httpClient = &http.Client{Timeout: httpClientTimeout}
+	httpClient = &http.Client{Timeout: httpClientTimeout, Transport: &useragent.Transport{}}
 	// mocks for tests
-	newRequest = http.NewRequest
+	newRequest      = http.NewRequest
+	newVerifyToken  = crypt.NewBearerToken
+	newReceiptToken = crypt.NewBearerToken
+)
+
+// Error codes returned in ErrResponse.Code.
+// Codes are part of the API, clients can rely on them.
+const (
+	CodeInvalidPayload   = "invalid_payload"
+	CodeActionFailed     = "action_failed"
+	CodeNotFound         = "not_found"
+	CodeLocked           = "locked"
+	CodeForbidden        = "forbidden"
+	CodeDuplicate        = "duplicate"
+	CodeLimitReached     = "limit_reached"
+	CodeVaultUnreachable = "vault_unreachable"
+	CodeVaultError       = "vault_error"
+	CodeInternal         = "internal"
+	CodeNotReady         = "not_ready"
+	CodeNotPending       = "not_pending"
+	CodeStaleVersion     = "stale_version"
+	CodeTooLarge         = "too_large"
+	CodeGone             = "gone"
+	CodeUnauthorized     = auth.CodeUnauthorized // returned by auth.Authorizer for request without credentials
 )
 
 // ErrResponse is generic error code struct.
 type ErrResponse struct {
-	Err            error  `json:"-"`               // low-level runtime error
-	HTTPStatusCode int    `json:"-"`               // http response status code
-	StatusText     string `json:"status"`          // user-level status message
-	ErrorText      string `json:"error,omitempty"` // application-level error message, for debugging
+	Err            error    `json:"-"`                // low-level runtime error
+	HTTPStatusCode int      `json:"-"`                // http response status code
+	StatusText     string   `json:"status"`           // user-level status message
+	Code           string   `json:"code"`             // stable machine-readable error code
+	ErrorText      string   `json:"error,omitempty"`  // application-level error message, for debugging
+	Errors         []string `json:"errors,omitempty"` // every validation problem, for clients showing them per field
+	RetryAfter     int      `json:"seconds_until_release,omitempty"`
+	RequestID      string   `json:"request_id,omitempty"` // id of request, matches request_id in server logs
 }
 
 // Render returns rendered error response.
+// Retry-After header is set when RetryAfter is provided.
 func (e *ErrResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	e.RequestID = middleware.GetReqID(r.Context())
+	if e.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(e.RetryAfter))
+	}
 	render.Status(r, e.HTTPStatusCode)
 	return nil
 }
 
+// newErrResponse returns ErrResponse.
+// Error text is exposed only for client errors (4xx), server errors can leak internals.
+func newErrResponse(statusCode int, statusText string, code string, err error) *ErrResponse {
+	e := &ErrResponse{
+		Err:            err,
+		HTTPStatusCode: statusCode,
+		StatusText:     statusText,
+		Code:           code,
+	}
+	if err != nil && statusCode < http.StatusInternalServerError {
+		e.ErrorText = err.Error()
+		var validationErr state.ValidationError
+		if errors.As(err, &validationErr) {
+			for _, problem := range validationErr {
+				e.Errors = append(e.Errors, problem.Error())
+			}
+		}
+	}
+	return e
+}
+
 // StatusErrInvalidRequests returns BadRequest.
 func StatusErrInvalidRequest(err error) render.Renderer {
-	return &ErrResponse{
-		Err:            err,
-		HTTPStatusCode: http.StatusBadRequest,
-		StatusText:     "Invalid request.",
-		ErrorText:      err.Error(),
+	return newErrResponse(http.StatusBadRequest, "Invalid request.", CodeInvalidPayload, err)
+}
+
+// StatusErrActionFailed returns BadRequest when action execution failed.
+func StatusErrActionFailed(err error) render.Renderer {
+	return newErrResponse(http.StatusBadRequest, "Action failed.", CodeActionFailed, err)
+}
+
+// StatusErrDuplicate returns BadRequest when resource already exists.
+func StatusErrDuplicate(err error) render.Renderer {
+	return newErrResponse(http.StatusBadRequest, "Resource already exists.", CodeDuplicate, err)
+}
+
+// StatusErrDuplicateComment returns Conflict when action comment is already used.
+func StatusErrDuplicateComment(err error) render.Renderer {
+	return newErrResponse(http.StatusConflict, "Action comment already exists.", CodeDuplicate, err)
+}
+
+// StatusErrStaleVersion returns Conflict when resource version is not newer than stored one.
+func StatusErrStaleVersion(err error) render.Renderer {
+	return newErrResponse(http.StatusConflict, "Resource version is stale.", CodeStaleVersion, err)
+}
+
+// StatusErrTooLarge returns RequestEntityTooLarge.
+func StatusErrTooLarge(err error) render.Renderer {
+	return newErrResponse(http.StatusRequestEntityTooLarge, "Request too large.", CodeTooLarge, err)
+}
+
+// statusErrBind returns error response for request which can't be bound.
+// Body over http.max_body_bytes and data over action.max_data_bytes are reported as too large.
+func statusErrBind(err error) render.Renderer {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) || errors.Is(err, ErrActionDataTooLarge) {
+		return StatusErrTooLarge(err)
 	}
+	return StatusErrInvalidRequest(err)
+}
+
+// StatusErrLimitReached returns BadRequest when resource limit is reached.
+func StatusErrLimitReached(err error) render.Renderer {
+	return newErrResponse(http.StatusBadRequest, "Limit reached.", CodeLimitReached, err)
 }
 
 // StatusErrInternal returns InternalServerError.
 func StatusErrInternal(err error) render.Renderer {
-	return &ErrResponse{
-		Err:            err,
-		HTTPStatusCode: http.StatusInternalServerError,
-		StatusText:     "Internal error.",
-	}
+	return newErrResponse(http.StatusInternalServerError, "Internal error.", CodeInternal, err)
+}
+
+// StatusErrVaultUnreachable returns InternalServerError when vault cant be reached.
+func StatusErrVaultUnreachable(err error) render.Renderer {
+	return newErrResponse(http.StatusInternalServerError, "Internal error.", CodeVaultUnreachable, err)
+}
+
+// StatusErrVaultError returns InternalServerError when vault returned unexpected response.
+func StatusErrVaultError(err error) render.Renderer {
+	return newErrResponse(http.StatusInternalServerError, "Internal error.", CodeVaultError, err)
+}
+
+// StatusErrNotReady returns ServiceUnavailable when instance did not finish startup.
+func StatusErrNotReady(err error) render.Renderer {
+	return newErrResponse(http.StatusServiceUnavailable, "Not ready.", CodeNotReady, err)
+}
+
+// StatusErrNotPending returns Conflict when action is not waiting for confirmation.
+func StatusErrNotPending(err error) render.Renderer {
+	return newErrResponse(http.StatusConflict, "Action is not pending.", CodeNotPending, err)
 }
 
 // StatusErrNotFound returns NotFound.
 func StatusErrNotFound(err error) render.Renderer {
-	return &ErrResponse{
-		HTTPStatusCode: http.StatusNotFound,
-		StatusText:     "Resource not found.",
-	}
+	return newErrResponse(http.StatusNotFound, "Resource not found.", CodeNotFound, err)
 }
 
 // StatusErrLocked returns Locked.
 func StatusErrLocked(err error) render.Renderer {
-	return &ErrResponse{
-		HTTPStatusCode: http.StatusLocked,
-		StatusText:     "Resource is locked.",
-	}
+	return newErrResponse(http.StatusLocked, "Resource is locked.", CodeLocked, err)
+}
+
+// StatusErrNotReleased returns Locked with number of seconds until secret is released.
+func StatusErrNotReleased(remaining time.Duration) render.Renderer {
+	e := newErrResponse(http.StatusLocked, "Resource is locked.", CodeLocked, nil)
+	e.RetryAfter = max(int(math.Ceil(remaining.Seconds())), 1)
+	return e
+}
+
+// StatusErrGone returns Gone.
+func StatusErrGone(err error) render.Renderer {
+	return newErrResponse(http.StatusGone, "Resource is gone.", CodeGone, err)
 }
 
 // StatusErrForbidden returns Forbidden.
 func StatusErrForbidden(err error) render.Renderer {
-	return &ErrResponse{
-		Err:            err,
-		HTTPStatusCode: http.StatusForbidden,
-		StatusText:     "Forbidden.",
-		ErrorText:      err.Error(),
-	}
+	return newErrResponse(http.StatusForbidden, "Forbidden.", CodeForbidden, err)
 }
 
 // validateSigAuthScopes rejects action data whose {sig_auth:<page>} placeholders
 // reference a path the requester token scope does not cover, so a signed URL
 // cant delegate access the requester does not have. Anonymous scopes dont count.
 // Skipped when auth is disabled, nothing is signed then.
-func validateSigAuthScopes(r *http.Request, authConfig auth.Config, data string) error {
+func validateSigAuthScopes(r *http.Request, authConfig auth.Config, data ...string) error {
 	if !authConfig.Enabled {
 		return nil
 	}
-	for _, path := range execute.SigAuthPaths(data) {
-		if !auth.IdentityCovers(r, path) {
-			return fmt.Errorf("not allowed to sign %s", path)
+	for _, d := range data {
+		for _, path := range execute.SigAuthPaths(d) {
+			if !auth.IdentityCovers(r, path) {
+				return fmt.Errorf("not allowed to sign %s", path)
+			}
 		}
 	}
 	return nil
@@ -103,8 +234,9 @@ func validateSigAuthScopes(r *http.Request, authConfig auth.Config, data string)
 
 // OKResponse is generic ok code struct.
 type OKResponse struct {
-	HTTPStatusCode int    `json:"-"`
-	StatusText     string `json:"status"`
+	HTTPStatusCode int      `json:"-"`
+	StatusText     string   `json:"status"`
+	Warnings       []string `json:"warnings,omitempty"` // request succeeded, but client should double check it
 }
 
 // Render returns rendered ok response.
@@ -121,289 +253,1867 @@ func StatusOK(httpStatus int) render.Renderer {
 	}
 }
 
-// healthHandler is used by /ready and /healthz endpoints.
+// healthHandler is used by /healthz liveness endpoint, it succeeds while process serves HTTP.
 func healthHandler() func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 		render.Render(w, r, StatusOK(http.StatusOK))
 	}
 }
 
-// aliveHandler updates LastSeen in vault and, only if the vault acknowledges,
-// updates State.LastSeen.
-func aliveHandler(s state.StateInterface, vaultURL string, vaultClientUUID string, vaultToken string) func(http.ResponseWriter, *http.Request) {
+// versionResponse describes running DMH build.
+type versionResponse struct {
+	version.Info
+	Components []string `json:"components"`
+}
+
+// versionHandler returns build information and enabled components.
+func versionHandler(components []string) func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
-		endpointAddress, err := url.JoinPath(vaultURL, "api", "vault", "alive", vaultClientUUID)
-		if err != nil {
-			log.Printf("unable to parse address: %s", err)
-			render.Render(w, r, StatusErrInternal(nil))
-			return
-		}
+		render.JSON(w, r, &versionResponse{Info: version.Get(), Components: components})
+	}
+}
 
-		req, err := newRequest("GET", endpointAddress, nil)
-		if err != nil {
-			log.Printf("unable to create request: %s", err)
-			render.Render(w, r, StatusErrInternal(nil))
+// readyHandler is used by /readyz (and /ready) readiness endpoint.
+// It fails until every readiness component is ready.
+func readyHandler(readiness *Readiness) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if pending := readiness.Pending(); len(pending) > 0 {
+			logf(r, "not ready, waiting for %s", strings.Join(pending, ", "))
+			render.Render(w, r, StatusErrNotReady(nil))
 			return
 		}
-		if vaultToken != "" {
-			req.Header.Set("Authorization", "Bearer "+vaultToken)
-		}
+		render.Render(w, r, StatusOK(http.StatusOK))
+	}
+}
 
-		resp, err := httpClient.Do(req)
-		if err != nil {
-			log.Printf("unable to connect to vault: %s", err)
-			render.Render(w, r, StatusErrInternal(nil))
-			return
+// aliveFiringSoonWindow is how far ahead alive summary counts actions as firing soon.
+const aliveFiringSoonWindow = 48 * time.Hour
+
+// aliveResponse is returned by alive check-in to clients accepting application/json.
+type aliveResponse struct {
+	StatusText     string     `json:"status"`
+	ArmedActions   int        `json:"armed_actions"`
+	FiringSoon     int        `json:"firing_soon"` // armed actions which run within aliveFiringSoonWindow
+	NextActionAt   *time.Time `json:"next_action_at,omitempty"`
+	NextActionUUID string     `json:"next_action_uuid,omitempty"`
+}
+
+// renderAlive writes check-in response.
+// Armed actions summary is returned only when application/json is first accepted media type,
+// other clients keep getting minimal success response.
+func renderAlive(w http.ResponseWriter, r *http.Request, s state.StateInterface, actionProcessUnit time.Duration) {
+	if !wantsJSON(r) {
+		render.Render(w, r, StatusOK(http.StatusOK))
+		return
+	}
+	response := &aliveResponse{StatusText: "success"}
+	lastSeen := s.GetLastSeen()
+	extend := s.GetMaintenance().Duration()
+	firingSoon := time.Now().Add(aliveFiringSoonWindow)
+	for _, a := range s.GetActions() {
+		nextRun, ok := a.NextRun(lastSeen, extend, actionProcessUnit)
+		if !ok {
+			continue
 		}
-		defer resp.Body.Close()
-		if resp.StatusCode != http.StatusOK {
-			log.Printf("wrong http status code received from vault: %d", resp.StatusCode)
-			render.Render(w, r, StatusErrInternal(nil))
-			return
+		response.ArmedActions++
+		if nextRun.Before(firingSoon) {
+			response.FiringSoon++
 		}
+		if response.NextActionAt == nil || nextRun.Before(*response.NextActionAt) {
+			response.NextActionAt = &nextRun
+			response.NextActionUUID = a.UUID
+		}
+	}
+	render.JSON(w, r, response)
+}
 
-		s.UpdateLastSeen()
+// errVaultRequest is returned when request to vault can't be created, it is DMH configuration problem and not vault error.
+var errVaultRequest = errors.New("invalid vault request")
 
-		render.Render(w, r, StatusOK(http.StatusOK))
+// updateVaultLastSeen updates LastSeen in Vault.
+func updateVaultLastSeen(vaultURL string, vaultClientUUID string, vaultToken string) error {
+	endpointAddress, err := url.JoinPath(vaultURL, "api", "vault", "alive", vaultClientUUID)
+	if err != nil {
+		return fmt.Errorf("%w: unable to parse address: %w", errVaultRequest, err)
+	}
+	req, err := newRequest("GET", endpointAddress, nil)
+	if err != nil {
+		return fmt.Errorf("%w: unable to create request: %w", errVaultRequest, err)
+	}
+	if vaultToken != "" {
+		req.Header.Set("Authorization", "Bearer "+vaultToken)
+	}
+	req.Header.Set(vault.ClientTimeHeader, time.Now().UTC().Format(time.RFC3339Nano))
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %w", state.ErrVaultUnreachable, err)
 	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("wrong http status code received from vault: %d", resp.StatusCode)
+	}
+	return nil
 }
 
-// vaultAliveHandler updates Vault LastSeen.
-func vaultAliveHandler(v vault.VaultInterface) func(http.ResponseWriter, *http.Request) {
-	return func(w http.ResponseWriter, r *http.Request) {
-		paramClientUUID := chi.URLParam(r, "clientUUID")
-		if paramClientUUID == "" {
-			log.Printf("wrong clientUUID provided")
-			render.Render(w, r, StatusErrNotFound(nil))
-			return
+// updateVaults calls update for every vault (remote_vault.url and remote_vault.additional_urls),
+// first error is returned. Every vault holding action keys must see check-in, otherwise it releases keys early.
+func updateVaults(vaultURLs []string, update func(vaultURL string) error) error {
+	for _, vaultURL := range vaultURLs {
+		if err := update(vaultURL); err != nil {
+			return fmt.Errorf("vault %s: %w", vaultURL, err)
 		}
-		v.UpdateLastSeen(paramClientUUID)
-		render.Render(w, r, StatusOK(http.StatusOK))
 	}
+	return nil
 }
 
-// testActionHandler allow to execute action for test.
-func testActionHandler(e execute.ExecuteInterface, authConfig auth.Config) func(http.ResponseWriter, *http.Request) {
+// renderVaultUpdateErr writes error response for failed vault update.
+func renderVaultUpdateErr(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, errVaultRequest) {
+		render.Render(w, r, StatusErrInternal(nil))
+		return
+	}
+	if errors.Is(err, state.ErrVaultUnreachable) {
+		render.Render(w, r, StatusErrVaultUnreachable(nil))
+		return
+	}
+	render.Render(w, r, StatusErrVaultError(nil))
+}
+
+// aliveHandler updates LastSeen in every vault and, only if all vaults acknowledge,
+// updates State.LastSeen. Check-in of source is recorded in State only after vaults acknowledge too.
+// When enabled, source address and User-Agent of check-in are stored with LastSeen.
+func aliveHandler(s state.StateInterface, vaultURLs []string, vaultClientUUID string, vaultToken string, metaConfig LastSeenMetaConfig, requiredSources []string, actionProcessUnit time.Duration) func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
-		request := &addTestActionRequest{}
-		if err := render.Bind(r, request); err != nil {
-			log.Printf("wrong request data provided: %s", err)
-			render.Render(w, r, StatusErrInvalidRequest(err))
+		if extend := r.FormValue("extend"); extend != "" {
+			partialAlive(w, r, s, vaultURLs, vaultClientUUID, vaultToken, extend, actionProcessUnit)
 			return
 		}
 
-		if err := validateSigAuthScopes(r, authConfig, request.Data); err != nil {
-			log.Printf("sig_auth not allowed: %s", err)
-			render.Render(w, r, StatusErrForbidden(err))
+		source := r.FormValue("source")
+		if source == "" && len(requiredSources) > 0 {
+			logf(r, "check-in without source, required sources are %s", strings.Join(requiredSources, ", "))
+			render.Render(w, r, StatusErrInvalidRequest(fmt.Errorf("source is required")))
 			return
 		}
+		advances := true
+		if source != "" {
+			var err error
+			advances, err = s.SourceLastSeenAdvances(source)
+			if err != nil {
+				logf(r, "unable to record check-in: %s", err)
+				render.Render(w, r, StatusErrInvalidRequest(err))
+				return
+			}
+		}
 
-		a := &state.Action{
-			Kind:         request.Kind,
-			Data:         request.Data,
-			ProcessAfter: request.ProcessAfter,
+		// Vault is updated only when LastSeen moves and before it moves in State.
+		// Vault LastSeen is time of this check-in, which is never earlier than the oldest required source,
+		// so vault never releases secrets earlier than DMH runs actions (it can release them later).
+		if advances {
+			err := updateVaults(vaultURLs, func(vaultURL string) error {
+				return updateVaultLastSeen(vaultURL, vaultClientUUID, vaultToken)
+			})
+			if err != nil {
+				logf(r, "unable to update last seen in vault: %s", err)
+				renderVaultUpdateErr(w, r, err)
+				return
+			}
 		}
-		if err := e.Run(a); err != nil {
-			log.Printf("unable to run action: %s", err)
-			render.Render(w, r, StatusErrInvalidRequest(err))
-			return
+
+		if source == "" {
+			s.UpdateLastSeen(lastSeenMeta(r, metaConfig))
+		} else {
+			advanced, err := s.UpdateSourceLastSeen(source, lastSeenMeta(r, metaConfig))
+			if err != nil {
+				logf(r, "unable to record check-in: %s", err)
+				render.Render(w, r, StatusErrInvalidRequest(err))
+				return
+			}
+			if !advanced {
+				logf(r, "check-in from %s recorded, waiting for other required sources", source)
+			}
 		}
 
-		render.Render(w, r, StatusOK(http.StatusOK))
+		renderAlive(w, r, s, actionProcessUnit)
 	}
 }
 
-// listActionsHandler return all actions.
-func listActionsHandler(s state.StateInterface) func(http.ResponseWriter, *http.Request) {
-	return func(w http.ResponseWriter, r *http.Request) {
-		render.JSON(w, r, s.GetActions())
+// parsePartialExtend parses partial check-in extension, percent of action window (e.g. 50%).
+func parsePartialExtend(extend string) (int, error) {
+	percent, err := strconv.Atoi(strings.TrimSuffix(extend, "%"))
+	if err != nil || percent < 1 || percent > 100 {
+		return 0, fmt.Errorf("extend should be percent between 1%% and 100%% (e.g. 50%%)")
 	}
+	return percent, nil
 }
 
-// addATestActionRequest describes user requests to add new action or test action.
-type addTestActionRequest struct {
-	Kind         string `json:"kind"`
-	Data         string `json:"data"`
-	Comment      string `json:"comment"`
-	ProcessAfter int    `json:"process_after"`
-	MinInterval  int    `json:"min_interval"`
+// vaultPartialAliveRequest describes DMH request to record partial check-in in Vault.
+type vaultPartialAliveRequest struct {
+	Percent int `json:"percent"`
 }
 
-// Bind validates addTestActionRequest.
-func (req *addTestActionRequest) Bind(r *http.Request) error {
-	a := &state.Action{
-		Kind:         req.Kind,
-		Comment:      req.Comment,
-		ProcessAfter: req.ProcessAfter,
-		MinInterval:  req.MinInterval,
-		Data:         req.Data,
+// Bind validates vaultPartialAliveRequest.
+func (req *vaultPartialAliveRequest) Bind(r *http.Request) error {
+	if req.Percent < 1 || req.Percent > 100 {
+		return fmt.Errorf("percent should be between 1 and 100")
 	}
-	if err := a.Validate(); err != nil {
+	return nil
+}
+
+// updateVaultPartialLastSeen records partial check-in in Vault, so it releases secrets as late as DMH runs actions.
+func updateVaultPartialLastSeen(vaultURL string, vaultClientUUID string, vaultToken string, percent int) error {
+	endpointAddress, err := url.JoinPath(vaultURL, "api", "vault", "alive", vaultClientUUID, "partial")
+	if err != nil {
+		return fmt.Errorf("unable to parse address: %w", err)
+	}
+	body, err := json.Marshal(&vaultPartialAliveRequest{Percent: percent})
+	if err != nil {
 		return err
 	}
+	req, err := newRequest("POST", endpointAddress, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("unable to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if vaultToken != "" {
+		req.Header.Set("Authorization", "Bearer "+vaultToken)
+	}
 
-	if _, err := execute.UnmarshalActionData(a); err != nil {
-		return err
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %w", state.ErrVaultUnreachable, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("wrong http status code received from vault: %d", resp.StatusCode)
 	}
 	return nil
 }
 
-// addActionhandler adds new action to State.
-func addActionHandler(s state.StateInterface, authConfig auth.Config) func(http.ResponseWriter, *http.Request) {
-	return func(w http.ResponseWriter, r *http.Request) {
-		request := &addTestActionRequest{}
-		if err := render.Bind(r, request); err != nil {
-			log.Printf("wrong request data provided: %s", err)
-			render.Render(w, r, StatusErrInvalidRequest(err))
-			return
-		}
+// partialAlive is partial check-in, every action is moved to extend percent of its own window from now,
+// but never earlier. Vault is updated first, so it does not release secrets later than DMH runs actions.
+// Partial check-in does not update LastSeen and is not check-in of any source.
+func partialAlive(w http.ResponseWriter, r *http.Request, s state.StateInterface, vaultURLs []string, vaultClientUUID string, vaultToken string, extend string, actionProcessUnit time.Duration) {
+	percent, err := parsePartialExtend(extend)
+	if err != nil {
+		logf(r, "wrong partial check-in: %s", err)
+		render.Render(w, r, StatusErrInvalidRequest(err))
+		return
+	}
+
+	err = updateVaults(vaultURLs, func(vaultURL string) error {
+		return updateVaultPartialLastSeen(vaultURL, vaultClientUUID, vaultToken, percent)
+	})
+	if err != nil {
+		logf(r, "unable to record partial check-in in vault: %s", err)
+		renderVaultUpdateErr(w, r, err)
+		return
+	}
+	moved := s.UpdatePartialLastSeen(percent, actionProcessUnit)
+	logf(r, "partial check-in %d%%, %d actions extended", percent, moved)
+
+	renderAlive(w, r, s, actionProcessUnit)
+}
 
-		if err := validateSigAuthScopes(r, authConfig, request.Data); err != nil {
-			log.Printf("sig_auth not allowed: %s", err)
+// goneHandler marks user as gone - LastSeen is moved far into the past in State, so every action is due on next dispatcher tick.
+// Vault is not called, DMH client token must not be able to release keys. Admin marks client as gone in vault directly.
+// It is allowed only for admin token, it is forbidden when authentication is disabled.
+func goneHandler(s state.StateInterface, actionProcessUnit time.Duration) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !adminIdentity(r) {
+			err := fmt.Errorf("marking owner as gone requires admin token")
+			logf(r, "unable to mark owner as gone: %s", err)
 			render.Render(w, r, StatusErrForbidden(err))
 			return
 		}
 
-		a := &state.Action{
-			Kind:         request.Kind,
-			Data:         request.Data,
-			ProcessAfter: request.ProcessAfter,
-			MinInterval:  request.MinInterval,
-			Comment:      request.Comment,
-		}
+		s.MarkGone()
+		logf(r, "owner marked as gone, all actions are due")
 
-		if err := s.AddAction(a); err != nil {
-			log.Printf("unable to add action: %s", err)
-			render.Render(w, r, StatusErrInternal(nil))
+		renderAlive(w, r, s, actionProcessUnit)
+	}
+}
+
+// aliveCronHandler runs alive check-in only when {token} matches alive cron token.
+// tokenHash is hex-encoded sha256 of token plaintext.
+func aliveCronHandler(tokenHash string, alive http.HandlerFunc) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !crypt.ValidateBearerToken(tokenHash, chi.URLParam(r, "token")) {
+			logf(r, "wrong alive cron token provided")
+			render.Render(w, r, StatusErrForbidden(nil))
 			return
 		}
-
-		render.Render(w, r, StatusOK(http.StatusCreated))
+		alive(w, r)
 	}
 }
 
-// addVaultSecretRequest describes user requests to add new vault secret.
-type addVaultSecretRequest struct {
-	Key          string `json:"key"`
-	ProcessAfter int    `json:"process_after"`
-}
+// lastSeenMeta returns check-in source for request or nil when recording is disabled.
+// With TrustForwardedFor, last X-Forwarded-For entry (added by our reverse proxy) is used.
+func lastSeenMeta(r *http.Request, metaConfig LastSeenMetaConfig) *state.LastSeenMeta {
+	if !metaConfig.Enabled {
+		return nil
+	}
 
-// Bind validates addVaultSecretRequest.
-func (req *addVaultSecretRequest) Bind(r *http.Request) error {
-	if req.Key == "" {
-		return fmt.Errorf("key must be provided")
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	if metaConfig.TrustForwardedFor {
+		if forwardedFor := r.Header.Get("X-Forwarded-For"); forwardedFor != "" {
+			forwarded := strings.Split(forwardedFor, ",")
+			ip = strings.TrimSpace(forwarded[len(forwarded)-1])
+		}
 	}
 
-	if req.ProcessAfter <= 0 {
-		return fmt.Errorf("process_after should be greater than 0")
+	return &state.LastSeenMeta{
+		IP:        ip,
+		UserAgent: r.UserAgent(),
 	}
-	return nil
 }
 
-// addVaultSecretHandler adds new secret to Vault.
-func addVaultSecretHandler(v vault.VaultInterface) func(http.ResponseWriter, *http.Request) {
-	return func(w http.ResponseWriter, r *http.Request) {
-		paramClientUUID := chi.URLParam(r, "clientUUID")
-		paramSecretUUID := chi.URLParam(r, "secretUUID")
+// statusResponse describes DMH status.
+type statusResponse struct {
+	LastSeen       time.Time           `json:"last_seen"`
+	LastSeenMeta   *state.LastSeenMeta `json:"last_seen_meta,omitempty"`
+	NextActionAt   *time.Time          `json:"next_action_at,omitempty"`
+	NextActionUUID string              `json:"next_action_uuid,omitempty"`
+	ProcessUnit    string              `json:"process_unit"`          // action.process_unit, used by actions without own unit
+	Maintenance    *state.Maintenance  `json:"maintenance,omitempty"` // nil when maintenance is not enabled
+}
 
-		if paramClientUUID == "" || paramSecretUUID == "" {
-			log.Printf("wrong clientUUID or secretUUID provided")
-			render.Render(w, r, StatusErrInvalidRequest(fmt.Errorf("provide valid clientUUID or secretUUID")))
-			return
+// statusHandler returns when and from where user was last seen,
+// and which action will run first if user stays silent.
+// Plain text is returned when client accepts text/plain.
+func statusHandler(s state.StateInterface, actionProcessUnit time.Duration) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		response := &statusResponse{
+			LastSeen:     s.GetLastSeen(),
+			LastSeenMeta: s.GetLastSeenMeta(),
+			ProcessUnit:  vault.ProcessUnitName(actionProcessUnit),
+			Maintenance:  s.GetMaintenance(),
 		}
-
-		request := &addVaultSecretRequest{}
-		if err := render.Bind(r, request); err != nil {
-			log.Printf("wrong request data provided: %s", err)
-			render.Render(w, r, StatusErrInvalidRequest(err))
+		extend := response.Maintenance.Duration()
+		for _, a := range s.GetActions() {
+			nextRun, ok := a.NextRun(response.LastSeen, extend, actionProcessUnit)
+			if !ok {
+				continue
+			}
+			if response.NextActionAt == nil || nextRun.Before(*response.NextActionAt) {
+				response.NextActionAt = &nextRun
+				response.NextActionUUID = a.UUID
+			}
+		}
+		if wantsText(r) {
+			renderStatusText(w, r, response)
 			return
 		}
+		render.JSON(w, r, response)
+	}
+}
 
-		secret := &vault.Secret{
-			Key:          request.Key,
-			ProcessAfter: request.ProcessAfter,
+// eventsHandler streams action lifecycle events as Server-Sent Events.
+// Every event is sent as `event: <type>` with JSON encoded state.Event in `data`.
+func eventsHandler(s state.StateInterface) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rc := http.NewResponseController(w)
+		// Stream is long lived, http.Server WriteTimeout would close it.
+		if err := rc.SetWriteDeadline(time.Time{}); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			logf(r, "unable to disable write deadline for events stream: %s", err)
 		}
 
-		if err := v.AddSecret(paramClientUUID, paramSecretUUID, secret); err != nil {
-			log.Printf("unable to add secret: %s", err)
-			render.Render(w, r, StatusErrInvalidRequest(fmt.Errorf("unable to add secret")))
+		events, unsubscribe := s.Subscribe()
+		defer unsubscribe()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		if err := rc.Flush(); err != nil {
+			logf(r, "unable to start events stream: %s", err)
+			render.Render(w, r, StatusErrInternal(nil))
 			return
 		}
 
-		render.Render(w, r, StatusOK(http.StatusCreated))
+		keepAlive := time.NewTicker(eventsKeepAliveInterval)
+		defer keepAlive.Stop()
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case e, ok := <-events:
+				if !ok {
+					return
+				}
+				data, err := json.Marshal(e)
+				if err != nil {
+					logf(r, "unable to marshal event: %s", err)
+					continue
+				}
+				fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, data)
+			case <-keepAlive.C:
+				fmt.Fprint(w, ": keep-alive\n\n")
+			}
+			if err := rc.Flush(); err != nil {
+				return
+			}
+		}
 	}
 }
 
-// getActionHandler returns single action from State based on UUID.
-func getActionHandler(s state.StateInterface) func(http.ResponseWriter, *http.Request) {
+// vaultAliveHandler updates Vault LastSeen.
+// Client clock sent in vault.ClientTimeHeader is compared with vault clock.
+func vaultAliveHandler(v vault.VaultInterface) func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
-		paramActionUUID := chi.URLParam(r, "actionUUID")
-		a, _ := s.GetAction(paramActionUUID)
-		if a != nil {
-			render.JSON(w, r, a)
+		paramClientUUID := chi.URLParam(r, "clientUUID")
+		if paramClientUUID == "" {
+			logf(r, "wrong clientUUID provided")
+			render.Render(w, r, StatusErrNotFound(nil))
 			return
 		}
-		log.Printf("action with uuid %s not found", paramActionUUID)
-		render.Render(w, r, StatusErrNotFound(nil))
+		v.UpdateLastSeen(paramClientUUID)
+		if header := r.Header.Get(vault.ClientTimeHeader); header != "" {
+			if clientTime, err := time.Parse(time.RFC3339Nano, header); err != nil {
+				logf(r, "invalid %s header: %s", vault.ClientTimeHeader, err)
+			} else {
+				v.ObserveClientClock(paramClientUUID, clientTime)
+			}
+		}
+		render.Render(w, r, StatusOK(http.StatusOK))
 	}
 }
 
-// getVaultSecretHandler returns secret from Vault.
-func getVaultSecretHandler(v vault.VaultInterface) func(http.ResponseWriter, *http.Request) {
+// vaultPartialAliveHandler records partial check-in of clientUUID (see vault.PartialSeenAt).
+func vaultPartialAliveHandler(v vault.VaultInterface) func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 		paramClientUUID := chi.URLParam(r, "clientUUID")
-		paramSecretUUID := chi.URLParam(r, "secretUUID")
-
-		s, err := v.GetSecret(paramClientUUID, paramSecretUUID)
-		if err != nil {
-			log.Printf("unable to get vault secret: %s", err)
-			if errors.Is(err, vault.ErrSecretNotReleased) {
-				render.Render(w, r, StatusErrLocked(nil))
-				return
-			}
-			render.Render(w, r, StatusErrNotFound(nil))
+		request := &vaultPartialAliveRequest{}
+		if err := render.Bind(r, request); err != nil {
+			logf(r, "wrong request data provided: %s", err)
+			render.Render(w, r, statusErrBind(err))
 			return
 		}
-
-		if r.Method == http.MethodHead {
-			render.Render(w, r, StatusOK(http.StatusOK))
+		if err := v.UpdatePartialLastSeen(paramClientUUID, request.Percent); err != nil {
+			logf(r, "unable to record partial check-in: %s", err)
+			render.Render(w, r, StatusErrInvalidRequest(err))
 			return
 		}
-
-		render.JSON(w, r, s)
+		render.Render(w, r, StatusOK(http.StatusOK))
 	}
 }
 
-// deleteActionHandler deletes single action from State based on UUID.
-func deleteActionHandler(s state.StateInterface) func(http.ResponseWriter, *http.Request) {
+// vaultGoneHandler marks clientUUID as gone, all its secrets are released until it is seen again.
+// Like release-all it is allowed only for admin token, so DMH client token can't release its own keys.
+func vaultGoneHandler(v vault.VaultInterface) func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
-		paramActionUUID := chi.URLParam(r, "actionUUID")
-		err := s.DeleteAction(paramActionUUID)
-		if err != nil {
-			log.Printf("unable to delete action: %s", err)
+		paramClientUUID := chi.URLParam(r, "clientUUID")
+		if paramClientUUID == "" {
+			logf(r, "wrong clientUUID provided")
 			render.Render(w, r, StatusErrNotFound(nil))
 			return
 		}
+		if !adminIdentity(r) {
+			err := fmt.Errorf("marking client as gone requires admin token")
+			logf(r, "unable to mark client as gone: %s", err)
+			render.Render(w, r, StatusErrForbidden(err))
+			return
+		}
+		if err := v.MarkGone(paramClientUUID); err != nil {
+			logf(r, "unable to mark client as gone: %s", err)
+			render.Render(w, r, StatusErrNotFound(err))
+			return
+		}
+		logf(r, "client %s marked as gone", paramClientUUID)
 		render.Render(w, r, StatusOK(http.StatusOK))
 	}
 }
 
-// deleteVaultSecretHandler deletes secret from Vault.
-func deleteVaultSecretHandler(v vault.VaultInterface) func(http.ResponseWriter, *http.Request) {
+// testActionHandler allow to execute action for test.
+// Action is executed only when request confirms real send, otherwise it is only
+// validated and recipients which it would be delivered to are returned.
+func testActionHandler(e execute.ExecuteInterface, authConfig auth.Config, maxDataBytes int) func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
-		paramClientUUID := chi.URLParam(r, "clientUUID")
-		paramSecretUUID := chi.URLParam(r, "secretUUID")
-
-		err := v.DeleteSecret(paramClientUUID, paramSecretUUID)
-		if err != nil {
-			log.Printf("unable to delete secret: %s", err)
+		request := &addTestActionRequest{maxDataBytes: maxDataBytes, kindEnabled: e.KindEnabled}
+		if err := render.Bind(r, request); err != nil {
+			logf(r, "wrong request data provided: %s", err)
+			render.Render(w, r, statusErrBind(err))
+			return
+		}
+
+		if err := validateSigAuthScopes(r, authConfig, request.sigAuthData()...); err != nil {
+			logf(r, "sig_auth not allowed: %s", err)
+			render.Render(w, r, StatusErrForbidden(err))
+			return
+		}
+
+		a := &state.Action{
+			Kind:         request.Kind,
+			Data:         request.Data,
+			ProcessAfter: request.ProcessAfter,
+		}
+		if !request.Confirm {
+			recipients, err := e.Preview(a)
+			if err != nil {
+				logf(r, "unable to validate action: %s", err)
+				render.Render(w, r, StatusErrInvalidRequest(err))
+				return
+			}
+			render.JSON(w, r, &dryRunActionResponse{DryRun: true, Recipients: recipients})
+			return
+		}
+		if err := e.Run(r.Context(), a); err != nil {
+			logf(r, "unable to run action: %s", err)
+			render.Render(w, r, StatusErrActionFailed(err))
+			return
+		}
+
+		render.Render(w, r, StatusOK(http.StatusOK))
+	}
+}
+
+// validateActionHandler allow to validate action without executing it.
+func validateActionHandler(e execute.ExecuteInterface, authConfig auth.Config, maxDataBytes int) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		request := &addTestActionRequest{maxDataBytes: maxDataBytes, kindEnabled: e.KindEnabled}
+		if err := render.Bind(r, request); err != nil {
+			logf(r, "wrong request data provided: %s", err)
+			render.Render(w, r, statusErrBind(err))
+			return
+		}
+
+		if err := validateSigAuthScopes(r, authConfig, request.sigAuthData()...); err != nil {
+			logf(r, "sig_auth not allowed: %s", err)
+			render.Render(w, r, StatusErrForbidden(err))
+			return
+		}
+
+		a := &state.Action{
+			Kind:         request.Kind,
+			Data:         request.Data,
+			ProcessAfter: request.ProcessAfter,
+			MinInterval:  request.MinInterval,
+			ProcessUnit:  request.ProcessUnit,
+			Deadline:     request.Deadline,
+			NotBefore:    request.NotBefore,
+			Timezone:     request.Timezone,
+			Priority:     request.Priority,
+			DependsOn:    request.DependsOn,
+			DependsDelay: request.DependsDelay,
+			DedupeWindow: request.DedupeWindow,
+			Severity:     request.Severity,
+			OnSuccess:    request.OnSuccess,
+			OnFailure:    request.OnFailure,
+			Comment:      request.Comment,
+			Fallback:     request.Fallback,
+		}
+		if err := e.Validate(a); err != nil {
+			logf(r, "action validation failed: %s", err)
+			render.Render(w, r, StatusErrInvalidRequest(err))
+			return
+		}
+
+		render.Render(w, r, StatusOK(http.StatusOK))
+	}
+}
+
+// listActionsHandler return all actions.
+// Optional comment, recipient_hash, kind and processed query parameters limit actions to those
+// matching all of them, see actionFilter.
+// Optional fires_after and fires_before (RFC3339) query parameters limit actions to those
+// which next run (if user is not seen anymore) is in the window, actions which will not run are skipped then.
+// Optional at (RFC3339) query parameter returns actions from state snapshot taken at that time, see state.SnapshotAt,
+// other filters and next_fire_at then use snapshot last seen and maintenance.
+// Plain text table is returned when client accepts text/plain.
+func listActionsHandler(s state.StateInterface, actionProcessUnit time.Duration) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		at, err := parseTimeParam(r, "at")
+		if err != nil {
+			logf(r, "wrong request data provided: %s", err)
+			render.Render(w, r, StatusErrInvalidRequest(err))
+			return
+		}
+		var actions []*state.EncryptedAction
+		var lastSeen time.Time
+		var extend time.Duration
+		if at != nil {
+			snapshot, err := s.SnapshotAt(*at)
+			if err != nil {
+				logf(r, "unable to load state snapshot: %s", err)
+				if errors.Is(err, state.ErrSnapshotNotFound) {
+					render.Render(w, r, StatusErrNotFound(err))
+					return
+				}
+				render.Render(w, r, StatusErrInternal(err))
+				return
+			}
+			actions, lastSeen, extend = snapshot.Actions, snapshot.LastSeen, snapshot.Maintenance.Duration()
+		} else {
+			actions, lastSeen, extend = s.GetActions(), s.GetLastSeen(), s.GetMaintenance().Duration()
+		}
+		filter, err := newActionFilter(r)
+		if err != nil {
+			logf(r, "wrong request data provided: %s", err)
+			render.Render(w, r, StatusErrInvalidRequest(err))
+			return
+		}
+		actions = filter.apply(actions)
+		firesAfter, err := parseTimeParam(r, "fires_after")
+		if err != nil {
+			logf(r, "wrong request data provided: %s", err)
+			render.Render(w, r, StatusErrInvalidRequest(err))
+			return
+		}
+		firesBefore, err := parseTimeParam(r, "fires_before")
+		if err != nil {
+			logf(r, "wrong request data provided: %s", err)
+			render.Render(w, r, StatusErrInvalidRequest(err))
+			return
+		}
+		if firesAfter != nil || firesBefore != nil {
+			actions = filterActionsByNextRun(actions, lastSeen, extend, actionProcessUnit, firesAfter, firesBefore)
+		}
+		if wantsText(r) {
+			renderActionsText(w, r, actions)
+			return
+		}
+		render.JSON(w, r, newActionResponses(actions, lastSeen, extend, actionProcessUnit))
+	}
+}
+
+// actionResponse is EncryptedAction returned by API with computed fields, they are not stored in state.
+type actionResponse struct {
+	*state.EncryptedAction
+	NextFireAt *time.Time `json:"next_fire_at"` // when action runs if user is not seen anymore, nil when it will not run
+}
+
+// newActionResponses adds projected run time to actions.
+// extend is maintenance extension, see state.Maintenance.
+// Absolute times of action with timezone are shown in that timezone.
+func newActionResponses(actions []*state.EncryptedAction, lastSeen time.Time, extend time.Duration, actionProcessUnit time.Duration) []*actionResponse {
+	responses := make([]*actionResponse, 0, len(actions))
+	for _, a := range actions {
+		response := &actionResponse{EncryptedAction: a}
+		if nextRun, ok := a.NextRun(lastSeen, extend, actionProcessUnit); ok {
+			response.NextFireAt = &nextRun
+		}
+		if loc, err := time.LoadLocation(a.Timezone); a.Timezone != "" && err == nil {
+			localized := *a
+			localized.Deadline = inLocation(a.Deadline, loc)
+			localized.NotBefore = inLocation(a.NotBefore, loc)
+			response.EncryptedAction = &localized
+			response.NextFireAt = inLocation(response.NextFireAt, loc)
+		}
+		responses = append(responses, response)
+	}
+	return responses
+}
+
+// inLocation returns copy of t in loc, nil when t is nil.
+func inLocation(t *time.Time, loc *time.Location) *time.Time {
+	if t == nil {
+		return nil
+	}
+	local := t.In(loc)
+	return &local
+}
+
+// exportedAction is single decrypted action returned by exportDecryptedActionsHandler.
+type exportedAction struct {
+	UUID    string `json:"uuid"`
+	Kind    string `json:"kind"`
+	Comment string `json:"comment"`
+	Data    string `json:"data,omitempty"`  // decrypted data, only when Status is 200
+	Status  int    `json:"status"`          // 200 decrypted, 410 vault key deleted, 423 vault key not released, 500 error
+	Error   string `json:"error,omitempty"` // error message, only for 4xx Status
+}
+
+// exportDecryptedActionsHandler streams JSON array with every action decrypted.
+// Action is decrypted only when vault released its key, other actions have per-item error status,
+// so owner can review everything which is about to run during real fire.
+func exportDecryptedActionsHandler(s state.StateInterface) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rc := http.NewResponseController(w)
+		// Every action is fetched from vault, export of many actions can outlive http.Server WriteTimeout.
+		if err := rc.SetWriteDeadline(time.Time{}); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			logf(r, "unable to disable write deadline for export: %s", err)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte("["))
+		for i, a := range s.GetActions() {
+			item := &exportedAction{UUID: a.UUID, Kind: a.Kind, Comment: a.Comment, Status: http.StatusOK}
+			if a.Processed == 2 {
+				item.Status = http.StatusGone
+				item.Error = "vault key was deleted after action run"
+			} else if decrypted, err := s.DecryptAction(a.UUID); err != nil {
+				logf(r, "unable to export action %s: %s", a.UUID, err)
+				item.Status = http.StatusInternalServerError
+				if errors.Is(err, state.ErrKeyNotReleased) {
+					item.Status = http.StatusLocked
+					item.Error = err.Error()
+				}
+			} else {
+				item.Data = decrypted.Data
+			}
+			encoded, err := json.Marshal(item)
+			if err != nil {
+				logf(r, "unable to marshal exported action %s: %s", a.UUID, err)
+				return
+			}
+			if i > 0 {
+				w.Write([]byte(","))
+			}
+			if _, err := w.Write(encoded); err != nil {
+				logf(r, "unable to write export: %s", err)
+				return
+			}
+			if err := rc.Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+				logf(r, "unable to flush export: %s", err)
+				return
+			}
+		}
+		w.Write([]byte("]"))
+	}
+}
+
+// dryRunActionResponse describes test action which was not executed as real send was not confirmed.
+type dryRunActionResponse struct {
+	DryRun     bool                `json:"dry_run"`
+	Recipients []execute.Recipient `json:"recipients"`
+}
+
+// previewActionResponse describes recipients which action would be delivered to.
+type previewActionResponse struct {
+	Recipients []execute.Recipient `json:"recipients"`
+}
+
+// previewActionHandler returns recipients of action without executing it.
+func previewActionHandler(e execute.ExecuteInterface, authConfig auth.Config, maxDataBytes int) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		request := &addTestActionRequest{maxDataBytes: maxDataBytes, kindEnabled: e.KindEnabled}
+		if err := render.Bind(r, request); err != nil {
+			logf(r, "wrong request data provided: %s", err)
+			render.Render(w, r, statusErrBind(err))
+			return
+		}
+
+		if err := validateSigAuthScopes(r, authConfig, request.sigAuthData()...); err != nil {
+			logf(r, "sig_auth not allowed: %s", err)
+			render.Render(w, r, StatusErrForbidden(err))
+			return
+		}
+
+		a := &state.Action{
+			Kind:         request.Kind,
+			Data:         request.Data,
+			ProcessAfter: request.ProcessAfter,
+		}
+		recipients, err := e.Preview(a)
+		if err != nil {
+			logf(r, "unable to preview action: %s", err)
+			render.Render(w, r, StatusErrInvalidRequest(err))
+			return
+		}
+
+		render.JSON(w, r, &previewActionResponse{Recipients: recipients})
+	}
+}
+
+// rehearseActionResponse describes recipients which stored action would be delivered to.
+type rehearseActionResponse struct {
+	Kind               string              `json:"kind"`
+	Recipients         []execute.Recipient `json:"recipients"`
+	FallbackKind       string              `json:"fallback_kind,omitempty"`
+	FallbackRecipients []execute.Recipient `json:"fallback_recipients,omitempty"`
+}
+
+// rehearseActionHandler decrypts stored action and prepares it (and its fallback) exactly like it would run,
+// but does not run it. Action state (processed, last run) is not changed.
+// Decryption needs vault key, Locked is returned until vault releases it.
+func rehearseActionHandler(s state.StateInterface, e execute.ExecuteInterface) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		paramActionUUID := chi.URLParam(r, "actionUUID")
+		a, _ := s.GetAction(paramActionUUID)
+		if a == nil {
+			logf(r, "action with uuid %s not found", paramActionUUID)
+			render.Render(w, r, StatusErrNotFound(nil))
+			return
+		}
+		if a.Processed == 2 {
+			logf(r, "unable to rehearse action %s: vault key was deleted after action run", paramActionUUID)
+			render.Render(w, r, StatusErrGone(fmt.Errorf("vault key was deleted after action run")))
+			return
+		}
+
+		decrypted, err := s.DecryptAction(paramActionUUID)
+		if err != nil {
+			logf(r, "unable to rehearse action %s: %s", paramActionUUID, err)
+			switch {
+			case errors.Is(err, state.ErrKeyNotReleased):
+				render.Render(w, r, StatusErrLocked(err))
+			case errors.Is(err, state.ErrVaultUnreachable):
+				render.Render(w, r, StatusErrVaultUnreachable(nil))
+			default:
+				render.Render(w, r, StatusErrInternal(nil))
+			}
+			return
+		}
+
+		recipients, err := e.Preview(decrypted)
+		if err != nil {
+			logf(r, "unable to rehearse action %s: %s", paramActionUUID, err)
+			render.Render(w, r, StatusErrActionFailed(err))
+			return
+		}
+		response := &rehearseActionResponse{Kind: decrypted.Kind, Recipients: recipients}
+		if fallback := decrypted.FallbackAction(); fallback != nil {
+			fallbackRecipients, err := e.Preview(fallback)
+			if err != nil {
+				logf(r, "unable to rehearse fallback of action %s: %s", paramActionUUID, err)
+				render.Render(w, r, StatusErrActionFailed(fmt.Errorf("fallback: %w", err)))
+				return
+			}
+			response.FallbackKind = fallback.Kind
+			response.FallbackRecipients = fallbackRecipients
+		}
+		logf(r, "action %s rehearsed", paramActionUUID)
+		render.JSON(w, r, response)
+	}
+}
+
+// parseTimeParam returns RFC3339 time from query parameter, nil when it is not provided.
+func parseTimeParam(r *http.Request, name string) (*time.Time, error) {
+	param := r.URL.Query().Get(name)
+	if param == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, param)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be RFC3339 time", name)
+	}
+	return &t, nil
+}
+
+// filterActionsByNextRun returns actions which next run is not before after and not after before, nil bound is open.
+func filterActionsByNextRun(actions []*state.EncryptedAction, lastSeen time.Time, extend time.Duration, actionProcessUnit time.Duration, after, before *time.Time) []*state.EncryptedAction {
+	filtered := make([]*state.EncryptedAction, 0, len(actions))
+	for _, a := range actions {
+		nextRun, ok := a.NextRun(lastSeen, extend, actionProcessUnit)
+		if !ok {
+			continue
+		}
+		if after != nil && nextRun.Before(*after) {
+			continue
+		}
+		if before != nil && nextRun.After(*before) {
+			continue
+		}
+		filtered = append(filtered, a)
+	}
+	return filtered
+}
+
+// actionFilter describes listActionsHandler query filters, empty fields match every action.
+type actionFilter struct {
+	Comment       string // Comment contains it (case-insensitive)
+	RecipientHash string // primary recipient has this hash (case-insensitive)
+	Kind          string // Kind is equal
+	Processed     *int   // Processed is equal
+}
+
+// newActionFilter reads actionFilter from request query parameters.
+func newActionFilter(r *http.Request) (*actionFilter, error) {
+	query := r.URL.Query()
+	filter := &actionFilter{
+		Comment:       strings.ToLower(query.Get("comment")),
+		RecipientHash: query.Get("recipient_hash"),
+		Kind:          query.Get("kind"),
+	}
+	if value := query.Get("processed"); value != "" {
+		processed, err := strconv.Atoi(value)
+		if err != nil || processed < 0 || processed > 2 {
+			return nil, fmt.Errorf("processed should be 0, 1 or 2")
+		}
+		filter.Processed = &processed
+	}
+	return filter, nil
+}
+
+// match returns true when Action matches all filters.
+func (f *actionFilter) match(a *state.EncryptedAction) bool {
+	if f.Comment != "" && !strings.Contains(strings.ToLower(a.Comment), f.Comment) {
+		return false
+	}
+	if f.RecipientHash != "" && (a.RecipientHash == "" || !strings.EqualFold(a.RecipientHash, f.RecipientHash)) {
+		return false
+	}
+	if f.Kind != "" && a.Kind != f.Kind {
+		return false
+	}
+	if f.Processed != nil && a.Processed != *f.Processed {
+		return false
+	}
+	return true
+}
+
+// apply returns actions matching all filters.
+func (f *actionFilter) apply(actions []*state.EncryptedAction) []*state.EncryptedAction {
+	filtered := make([]*state.EncryptedAction, 0, len(actions))
+	for _, a := range actions {
+		if f.match(a) {
+			filtered = append(filtered, a)
+		}
+	}
+	return filtered
+}
+
+// addATestActionRequest describes user requests to add new action or test action.
+type addTestActionRequest struct {
+	Kind         string                          `json:"kind"`
+	Data         string                          `json:"data"`
+	Comment      string                          `json:"comment"`
+	ProcessAfter int                             `json:"process_after"`
+	MinInterval  int                             `json:"min_interval"`
+	ProcessUnit  string                          `json:"process_unit"`
+	Deadline     *time.Time                      `json:"deadline"`
+	NotBefore    *time.Time                      `json:"not_before"`
+	Timezone     string                          `json:"timezone"` // IANA time zone of Deadline and NotBefore, see UnmarshalJSON
+	Priority     int                             `json:"priority"`
+	DependsOn    []string                        `json:"depends_on"`
+	DependsDelay int                             `json:"depends_delay"`
+	DedupeWindow int                             `json:"dedupe_window"`
+	Severity     string                          `json:"severity"`             // notify (default) or destructive
+	OnSuccess    string                          `json:"on_success"`           // URL which result is POSTed to after successful run
+	OnFailure    string                          `json:"on_failure"`           // URL which result is POSTed to after failed run
+	VaultURL     string                          `json:"vault_url"`            // remote vault overriding remote_vault.url (store only)
+	Fallback     *state.Fallback                 `json:"fallback"`             // delivered when Kind fails at fire time
+	DataFormat   string                          `json:"data_format"`          // format of Data, json (default) or yaml
+	Verify       bool                            `json:"verify"`               // send verification to recipient first, action runs only after it is verified (store only)
+	Passphrase   string                          `json:"recipient_passphrase"` // encrypts delivered payload for recipient (store only, never stored)
+	Confirm      bool                            `json:"confirm"`              // really execute action, only validated otherwise (test only)
+	Receipt      bool                            `json:"receipt"`              // embed delivery receipt token into data, recipient acknowledges delivery with it (store only)
+	maxDataBytes int                             // maximum size of JSON Data, 0 is unlimited
+	getActions   func() []*state.EncryptedAction // returns existing actions, DependsOn is checked against them when set (store only)
+	kindEnabled  func(string) error              // rejects kinds not enabled in execute.allowed_kinds when set
+	receiptURL   bool                            // {receipt_url} is available, public DMH address is configured (store only)
+}
+
+// actionLocalTimeLayout is layout of deadline and not_before without UTC offset, they are read in action timezone.
+const actionLocalTimeLayout = "2006-01-02T15:04:05"
+
+// UnmarshalJSON decodes addTestActionRequest, deadline and not_before are read in its timezone.
+// RFC3339 time keeps its UTC offset, time without offset (e.g. 2030-05-01T00:00:00) is accepted only with timezone.
+// With timezone both are normalized to UTC.
+func (req *addTestActionRequest) UnmarshalJSON(b []byte) error {
+	type plain addTestActionRequest
+	aux := struct {
+		*plain
+		Deadline  *string `json:"deadline"`
+		NotBefore *string `json:"not_before"`
+	}{plain: (*plain)(req)}
+	if err := json.Unmarshal(b, &aux); err != nil {
+		return err
+	}
+	var loc *time.Location
+	if req.Timezone != "" {
+		var err error
+		// Invalid timezone is reported by Action.Validate, only RFC3339 times are accepted then.
+		if loc, err = time.LoadLocation(req.Timezone); err != nil || req.Timezone == "Local" {
+			loc = nil
+		}
+	}
+	var err error
+	if req.Deadline, err = parseActionTime("deadline", aux.Deadline, loc); err != nil {
+		return err
+	}
+	if req.NotBefore, err = parseActionTime("not_before", aux.NotBefore, loc); err != nil {
+		return err
+	}
+	return nil
+}
+
+// parseActionTime returns absolute action time, nil when value is not provided.
+// Time without UTC offset is read in loc, it is rejected when loc is nil.
+func parseActionTime(name string, value *string, loc *time.Location) (*time.Time, error) {
+	if value == nil || *value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, *value)
+	if err != nil {
+		if loc == nil {
+			return nil, fmt.Errorf("%s must be RFC3339 time, time without UTC offset requires valid timezone", name)
+		}
+		if t, err = time.ParseInLocation(actionLocalTimeLayout, *value, loc); err != nil {
+			return nil, fmt.Errorf("%s must be RFC3339 time or %s in timezone", name, actionLocalTimeLayout)
+		}
+	}
+	if loc != nil {
+		t = t.UTC()
+	}
+	return &t, nil
+}
+
+// Bind validates addTestActionRequest.
+// YAML Data is converted to JSON, only JSON Data is passed further.
+// Unknown, repeatedly running or cyclic dependencies are rejected when existing actions are known.
+// All problems are returned together in state.ValidationError, except data over maxDataBytes.
+func (req *addTestActionRequest) Bind(r *http.Request) error {
+	var errs state.ValidationError
+	data, dataErr := actionDataToJSON(req.Data, req.DataFormat)
+	if dataErr != nil {
+		errs.Add(dataErr)
+	} else {
+		req.Data = data
+		if req.maxDataBytes > 0 && len(req.Data) > req.maxDataBytes {
+			return fmt.Errorf("%w: data is %d bytes, limit is %d bytes", ErrActionDataTooLarge, len(req.Data), req.maxDataBytes)
+		}
+	}
+	// Fallback data uses the same data_format as data.
+	var fallbackErr error
+	if req.Fallback != nil {
+		var fallbackData string
+		fallbackData, fallbackErr = actionDataToJSON(req.Fallback.Data, req.DataFormat)
+		if fallbackErr != nil {
+			errs.Add(fmt.Errorf("fallback: %w", fallbackErr))
+		} else {
+			req.Fallback.Data = fallbackData
+			if req.maxDataBytes > 0 && len(req.Fallback.Data) > req.maxDataBytes {
+				return fmt.Errorf("%w: fallback data is %d bytes, limit is %d bytes", ErrActionDataTooLarge, len(req.Fallback.Data), req.maxDataBytes)
+			}
+		}
+	}
+	if dataErr == nil && fallbackErr == nil {
+		req.DataFormat = ""
+	}
+
+	a := &state.Action{
+		Kind:         req.Kind,
+		Comment:      req.Comment,
+		ProcessAfter: req.ProcessAfter,
+		MinInterval:  req.MinInterval,
+		ProcessUnit:  req.ProcessUnit,
+		Deadline:     req.Deadline,
+		NotBefore:    req.NotBefore,
+		Timezone:     req.Timezone,
+		Priority:     req.Priority,
+		DependsOn:    req.DependsOn,
+		DependsDelay: req.DependsDelay,
+		DedupeWindow: req.DedupeWindow,
+		Severity:     req.Severity,
+		OnSuccess:    req.OnSuccess,
+		OnFailure:    req.OnFailure,
+		VaultURL:     req.VaultURL,
+		Data:         req.Data,
+		Fallback:     req.Fallback,
+	}
+	errs.Add(a.Validate())
+	if req.getActions != nil && len(req.DependsOn) > 0 {
+		errs.Add(state.ValidateDependencies(req.getActions(), req.DependsOn))
+	}
+
+	if req.Deadline != nil && req.Deadline.Before(time.Now().Add(minDeadlineLead)) {
+		errs.Add(fmt.Errorf("deadline should be in the future (at least %s from now)", minDeadlineLead))
+	}
+
+	if req.kindEnabled != nil && a.Kind != "" {
+		errs.Add(req.kindEnabled(a.Kind))
+	}
+	if req.Passphrase != "" && dataErr == nil && fallbackErr == nil {
+		errs.Add(execute.ValidatePassphrase(a, req.Passphrase))
+	}
+	if req.Receipt && dataErr == nil && fallbackErr == nil {
+		errs.Add(execute.ValidateReceipt(a, req.receiptURL))
+	}
+	if fallback := a.FallbackAction(); req.kindEnabled != nil && fallback != nil && fallback.Kind != "" {
+		if err := req.kindEnabled(fallback.Kind); err != nil {
+			errs.Add(fmt.Errorf("fallback: %w", err))
+		}
+	}
+
+	// kind and data are checked by plugin only when they are present and data could be decoded.
+	if dataErr == nil && a.Kind != "" && a.Data != "" {
+		if _, err := execute.UnmarshalActionData(a); err != nil {
+			errs.Add(err)
+		}
+	}
+	if fallback := a.FallbackAction(); fallback != nil && fallbackErr == nil && fallback.Kind != "" && fallback.Data != "" {
+		if _, err := execute.UnmarshalActionData(fallback); err != nil {
+			errs.Add(fmt.Errorf("fallback: %w", err))
+		}
+	}
+	return errs.Err()
+}
+
+// sigAuthData returns Data and Fallback Data, both can carry {sig_auth:<page>} placeholders.
+func (req *addTestActionRequest) sigAuthData() []string {
+	if req.Fallback == nil {
+		return []string{req.Data}
+	}
+	return []string{req.Data, req.Fallback.Data}
+}
+
+// actionWarnings returns warnings about action which is valid, but most likely not what user wanted.
+func actionWarnings(a *state.Action, defaultUnit time.Duration) []string {
+	var warnings []string
+	if processAfter := time.Duration(a.ProcessAfter) * a.Unit(defaultUnit); processAfter < soonFireWarning {
+		warnings = append(warnings, fmt.Sprintf("process_after is %s, action will run almost immediately without check-in", processAfter))
+	}
+	return warnings
+}
+
+// actionDataToJSON returns data in JSON format.
+func actionDataToJSON(data string, format string) (string, error) {
+	switch format {
+	case "", "json":
+		return data, nil
+	case "yaml":
+		var decoded any
+		if err := yaml.Unmarshal([]byte(data), &decoded); err != nil {
+			return "", fmt.Errorf("unable to decode yaml data: %w", err)
+		}
+		if decoded == nil {
+			return "", nil
+		}
+		encoded, err := json.Marshal(decoded)
+		if err != nil {
+			return "", fmt.Errorf("unable to convert yaml data to json: %w", err)
+		}
+		return string(encoded), nil
+	default:
+		return "", fmt.Errorf("data_format should be one of json, yaml")
+	}
+}
+
+// addActionhandler adds new action to State.
+// Action with verify is stored only after verification link was sent to its recipient,
+// it waits for GET /api/action/verify/{token} before dispatcher can run it.
+// verifyURL is public DMH address used in verification link, empty disables verification.
+// Action with receipt gets receipt token (and link when verifyURL is set) embedded in its data before it is encrypted.
+// Action which is valid but looks like a mistake is added, response carries warnings about it.
+func addActionHandler(s state.StateInterface, e execute.ExecuteInterface, authConfig auth.Config, verifyURL string, actionProcessUnit time.Duration, maxDataBytes int) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		request := &addTestActionRequest{maxDataBytes: maxDataBytes, getActions: s.GetActions, kindEnabled: e.KindEnabled, receiptURL: verifyURL != ""}
+		if err := render.Bind(r, request); err != nil {
+			logf(r, "wrong request data provided: %s", err)
+			render.Render(w, r, statusErrBind(err))
+			return
+		}
+
+		if err := validateSigAuthScopes(r, authConfig, request.sigAuthData()...); err != nil {
+			logf(r, "sig_auth not allowed: %s", err)
+			render.Render(w, r, StatusErrForbidden(err))
+			return
+		}
+
+		a := &state.Action{
+			Kind:         request.Kind,
+			Data:         request.Data,
+			ProcessAfter: request.ProcessAfter,
+			MinInterval:  request.MinInterval,
+			ProcessUnit:  request.ProcessUnit,
+			Deadline:     request.Deadline,
+			NotBefore:    request.NotBefore,
+			Timezone:     request.Timezone,
+			Priority:     request.Priority,
+			DependsOn:    request.DependsOn,
+			DependsDelay: request.DependsDelay,
+			DedupeWindow: request.DedupeWindow,
+			Severity:     request.Severity,
+			OnSuccess:    request.OnSuccess,
+			OnFailure:    request.OnFailure,
+			VaultURL:     request.VaultURL,
+			Comment:      request.Comment,
+			Fallback:     request.Fallback,
+		}
+		if request.Receipt {
+			token, link, err := receiptLink(verifyURL)
+			if err != nil {
+				logf(r, "unable to create receipt token: %s", err)
+				render.Render(w, r, StatusErrInternal(nil))
+				return
+			}
+			execute.ExpandReceipt(a, token, link)
+			a.ReceiptToken = token
+		}
+		if request.Passphrase != "" {
+			if err := execute.ProtectPayload(a, request.Passphrase); err != nil {
+				logf(r, "unable to protect action with recipient passphrase: %s", err)
+				render.Render(w, r, StatusErrInternal(nil))
+				return
+			}
+		}
+
+		var actionUUID string
+		var err error
+		if request.Verify {
+			if verifyURL == "" {
+				err := fmt.Errorf("verification is not enabled, action.verify.public_url is not configured")
+				logf(r, "unable to add action: %s", err)
+				render.Render(w, r, StatusErrInvalidRequest(err))
+				return
+			}
+			var token, link string
+			token, link, err = verificationLink(verifyURL)
+			if err != nil {
+				logf(r, "unable to create verification link: %s", err)
+				render.Render(w, r, StatusErrInternal(nil))
+				return
+			}
+			if err := e.RunVerification(r.Context(), a, link); err != nil {
+				logf(r, "unable to send verification: %s", err)
+				render.Render(w, r, StatusErrActionFailed(err))
+				return
+			}
+			actionUUID, err = s.AddUnverifiedAction(a, token)
+		} else {
+			actionUUID, err = s.AddAction(a)
+		}
+		if err != nil {
+			logf(r, "unable to add action: %s", err)
+			switch {
+			case errors.Is(err, state.ErrVaultUnreachable):
+				render.Render(w, r, StatusErrVaultUnreachable(nil))
+			case errors.Is(err, state.ErrDuplicateComment):
+				render.Render(w, r, StatusErrDuplicateComment(err))
+			case errors.Is(err, state.ErrVaultURLNotAllowed):
+				render.Render(w, r, StatusErrInvalidRequest(err))
+			case errors.Is(err, state.ErrActionLimitReached):
+				render.Render(w, r, StatusErrLimitReached(err))
+			default:
+				render.Render(w, r, StatusErrInternal(nil))
+			}
+			return
+		}
+
+		warnings := actionWarnings(a, actionProcessUnit)
+		for _, warning := range warnings {
+			logf(r, "action %s added with warning: %s", a.Kind, warning)
+		}
+		w.Header().Set("Location", "/api/action/store/"+url.PathEscape(actionUUID))
+		render.Render(w, r, &OKResponse{HTTPStatusCode: http.StatusCreated, StatusText: "success", Warnings: warnings})
+	}
+}
+
+// verificationLink returns new verification token and link to verifyActionHandler with it.
+func verificationLink(verifyURL string) (string, string, error) {
+	token, err := newVerifyToken()
+	if err != nil {
+		return "", "", err
+	}
+	link, err := url.JoinPath(verifyURL, "api", "action", "verify", token.Plaintext)
+	if err != nil {
+		return "", "", err
+	}
+	return token.Plaintext, link, nil
+}
+
+// receiptLink returns new receipt token and link to receiptHandler with it.
+// Link is empty when public DMH address is not configured.
+func receiptLink(publicURL string) (string, string, error) {
+	token, err := newReceiptToken()
+	if err != nil {
+		return "", "", err
+	}
+	if publicURL == "" {
+		return token.Plaintext, "", nil
+	}
+	link, err := url.JoinPath(publicURL, "api", "receipt", token.Plaintext)
+	if err != nil {
+		return "", "", err
+	}
+	return token.Plaintext, link, nil
+}
+
+// receiptHandler records that recipient received delivered action data.
+// Token comes from delivered data, see execute.ExpandReceipt.
+func receiptHandler(s state.StateInterface) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		actionUUID, err := s.AcknowledgeReceipt(chi.URLParam(r, "token"))
+		if err != nil {
+			logf(r, "unable to acknowledge receipt: %s", err)
+			if errors.Is(err, state.ErrReceiptTokenNotFound) {
+				render.Render(w, r, StatusErrNotFound(nil))
+				return
+			}
+			render.Render(w, r, StatusErrInternal(nil))
+			return
+		}
+		logf(r, "delivery of action %s acknowledged by recipient", actionUUID)
+		render.Render(w, r, StatusOK(http.StatusOK))
+	}
+}
+
+// verifyActionHandler marks action waiting for verification as verified.
+// Token comes from verification link sent to action recipient.
+func verifyActionHandler(s state.StateInterface) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		actionUUID, err := s.VerifyAction(chi.URLParam(r, "token"))
+		if err != nil {
+			logf(r, "unable to verify action: %s", err)
+			if errors.Is(err, state.ErrVerifyTokenNotFound) {
+				render.Render(w, r, StatusErrNotFound(nil))
+				return
+			}
+			render.Render(w, r, StatusErrInternal(nil))
+			return
+		}
+		logf(r, "action %s verified by recipient", actionUUID)
+		render.Render(w, r, StatusOK(http.StatusOK))
+	}
+}
+
+// addVaultSecretRequest describes user requests to add new vault secret.
+type addVaultSecretRequest struct {
+	Key          string     `json:"key"`
+	ProcessAfter int        `json:"process_after"`
+	ProcessUnit  string     `json:"process_unit"`
+	Deadline     *time.Time `json:"deadline"`
+	Comment      string     `json:"comment"`
+	Recurring    bool       `json:"recurring"`
+	Version      int64      `json:"version"`
+}
+
+// Bind validates addVaultSecretRequest.
+// All problems are returned together in state.ValidationError.
+func (req *addVaultSecretRequest) Bind(r *http.Request) error {
+	var errs state.ValidationError
+	if req.Key == "" {
+		errs.Add(fmt.Errorf("key must be provided"))
+	}
+
+	if req.ProcessAfter <= 0 {
+		errs.Add(fmt.Errorf("process_after should be greater than 0"))
+	}
+
+	if _, ok := vault.ProcessUnit(req.ProcessUnit); req.ProcessUnit != "" && !ok {
+		errs.Add(fmt.Errorf("process_unit should be one of second, minute, hour"))
+	}
+
+	if req.Version < 0 {
+		errs.Add(fmt.Errorf("version should not be negative"))
+	}
+	return errs.Err()
+}
+
+// addVaultSecretHandler adds new secret to Vault.
+func addVaultSecretHandler(v vault.VaultInterface) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		paramClientUUID := chi.URLParam(r, "clientUUID")
+		paramSecretUUID := chi.URLParam(r, "secretUUID")
+
+		if paramClientUUID == "" || paramSecretUUID == "" {
+			logf(r, "wrong clientUUID or secretUUID provided")
+			render.Render(w, r, StatusErrInvalidRequest(fmt.Errorf("provide valid clientUUID or secretUUID")))
+			return
+		}
+
+		request := &addVaultSecretRequest{}
+		if err := render.Bind(r, request); err != nil {
+			logf(r, "wrong request data provided: %s", err)
+			render.Render(w, r, statusErrBind(err))
+			return
+		}
+
+		secret := &vault.Secret{
+			Key:          request.Key,
+			ProcessAfter: request.ProcessAfter,
+			ProcessUnit:  request.ProcessUnit,
+			Deadline:     request.Deadline,
+			Comment:      request.Comment,
+			Recurring:    request.Recurring,
+			Version:      request.Version,
+		}
+
+		if err := v.AddSecret(paramClientUUID, paramSecretUUID, secret); err != nil {
+			logf(r, "unable to add secret: %s", err)
+			switch {
+			case errors.Is(err, vault.ErrSecretExists):
+				render.Render(w, r, StatusErrDuplicate(err))
+			case errors.Is(err, vault.ErrSecretVersionStale):
+				render.Render(w, r, StatusErrStaleVersion(err))
+			case errors.Is(err, vault.ErrSecretLimitReached):
+				render.Render(w, r, StatusErrLimitReached(err))
+			default:
+				render.Render(w, r, StatusErrInvalidRequest(fmt.Errorf("unable to add secret")))
+			}
+			return
+		}
+
+		w.Header().Set("Location", "/api/vault/store/"+url.PathEscape(paramClientUUID)+"/"+url.PathEscape(paramSecretUUID))
+		render.Render(w, r, StatusOK(http.StatusCreated))
+	}
+}
+
+// getActionHandler returns single action from State based on UUID.
+func getActionHandler(s state.StateInterface, actionProcessUnit time.Duration) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		paramActionUUID := chi.URLParam(r, "actionUUID")
+		a, _ := s.GetAction(paramActionUUID)
+		if a != nil {
+			if wantsText(r) {
+				renderActionsText(w, r, []*state.EncryptedAction{a})
+				return
+			}
+			render.JSON(w, r, newActionResponses([]*state.EncryptedAction{a}, s.GetLastSeen(), s.GetMaintenance().Duration(), actionProcessUnit)[0])
+			return
+		}
+		logf(r, "action with uuid %s not found", paramActionUUID)
+		render.Render(w, r, StatusErrNotFound(nil))
+	}
+}
+
+// getVaultSecretHandler returns secret from Vault.
+func getVaultSecretHandler(v vault.VaultInterface) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		paramClientUUID := chi.URLParam(r, "clientUUID")
+		paramSecretUUID := chi.URLParam(r, "secretUUID")
+
+		var wrapRecipient *crypt.Recipient
+		if recipient := r.Header.Get(vault.WrapRecipientHeader); recipient != "" {
+			var err error
+			wrapRecipient, err = crypt.NewRecipient(recipient)
+			if err != nil {
+				logf(r, "wrong wrap recipient provided: %s", err)
+				render.Render(w, r, StatusErrInvalidRequest(err))
+				return
+			}
+		}
+
+		if r.Method == http.MethodHead {
+			// HEAD only checks secret (DMH verification, metrics probes), key is not decrypted and it is not counted as release.
+			// ProcessAfterHeader is set for locked secrets too, DMH compares it with action process_after.
+			if meta, err := v.GetSecretMeta(paramClientUUID, paramSecretUUID); err == nil {
+				w.Header().Set(vault.ProcessAfterHeader, strconv.Itoa(meta.ProcessAfter))
+			}
+			status, err := v.GetSecretStatus(paramClientUUID, paramSecretUUID)
+			if err != nil {
+				logf(r, "unable to get vault secret: %s", err)
+				render.Render(w, r, StatusErrNotFound(err))
+				return
+			}
+			if !status.Released {
+				render.Render(w, r, StatusErrNotReleased(time.Duration(status.SecondsUntilRelease)*time.Second))
+				return
+			}
+			render.Render(w, r, StatusOK(http.StatusOK))
+			return
+		}
+
+		s, err := v.GetSecret(paramClientUUID, paramSecretUUID)
+		if err != nil {
+			logf(r, "unable to get vault secret: %s", err)
+			var notReleased *vault.NotReleasedError
+			if errors.As(err, &notReleased) {
+				render.Render(w, r, StatusErrNotReleased(notReleased.Remaining))
+				return
+			}
 			if errors.Is(err, vault.ErrSecretNotReleased) {
-				render.Render(w, r, StatusErrLocked(nil))
+				render.Render(w, r, StatusErrLocked(err))
 				return
 			}
-			render.Render(w, r, StatusErrNotFound(nil))
+			render.Render(w, r, StatusErrNotFound(err))
+			return
+		}
+
+		if wrapRecipient != nil {
+			wrappedKey, err := wrapRecipient.Encrypt(s.Key)
+			if err != nil {
+				logf(r, "unable to wrap vault secret: %s", err)
+				render.Render(w, r, StatusErrInternal(nil))
+				return
+			}
+			s.Key = wrappedKey
+			s.EncryptionMeta.Kind = crypt.WrapEncryptionKind
+		}
+
+		render.JSON(w, r, s)
+	}
+}
+
+// getVaultSecretStatusHandler returns if secret is released, key is never returned.
+// Monitoring can check arming status without touching secret material.
+func getVaultSecretStatusHandler(v vault.VaultInterface) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		paramClientUUID := chi.URLParam(r, "clientUUID")
+		paramSecretUUID := chi.URLParam(r, "secretUUID")
+
+		status, err := v.GetSecretStatus(paramClientUUID, paramSecretUUID)
+		if err != nil {
+			logf(r, "unable to get vault secret status: %s", err)
+			render.Render(w, r, StatusErrNotFound(err))
+			return
+		}
+		render.JSON(w, r, status)
+	}
+}
+
+// vaultInfoResponse describes Vault settings which DMH has to agree on.
+type vaultInfoResponse struct {
+	ProcessUnit string `json:"process_unit"`
+}
+
+// vaultInfoHandler returns Vault settings.
+// DMH uses it to detect process unit mismatch between components.
+func vaultInfoHandler(v vault.VaultInterface) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		render.JSON(w, r, &vaultInfoResponse{
+			ProcessUnit: vault.ProcessUnitName(v.GetSecretProcessUnit()),
+		})
+	}
+}
+
+// listVaultEventsHandler returns last secret release events from Vault, oldest first.
+// Optional since (RFC3339) query parameter limits events to those newer than since,
+// optional limit returns only first limit events. Time of last returned event can be
+// used as since of next page.
+func listVaultEventsHandler(v vault.VaultInterface) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var since time.Time
+		if param := r.URL.Query().Get("since"); param != "" {
+			parsed, err := time.Parse(time.RFC3339, param)
+			if err != nil {
+				logf(r, "wrong since provided: %s", err)
+				render.Render(w, r, StatusErrInvalidRequest(fmt.Errorf("since must be RFC3339 time")))
+				return
+			}
+			since = parsed
+		}
+		limit := 0
+		if param := r.URL.Query().Get("limit"); param != "" {
+			parsed, err := strconv.Atoi(param)
+			if err != nil || parsed <= 0 {
+				logf(r, "wrong limit provided: %s", param)
+				render.Render(w, r, StatusErrInvalidRequest(fmt.Errorf("limit must be greater than 0")))
+				return
+			}
+			limit = parsed
+		}
+		render.JSON(w, r, filterReleaseEvents(v.GetReleaseEvents(), since, limit))
+	}
+}
+
+// firedLogHandler returns fired log entries, optionally only those fired after since (RFC3339) query parameter.
+func firedLogHandler(s state.StateInterface) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		since, err := parseTimeParam(r, "since")
+		if err != nil {
+			logf(r, "wrong request data provided: %s", err)
+			render.Render(w, r, StatusErrInvalidRequest(err))
+			return
+		}
+		var sinceTime time.Time
+		if since != nil {
+			sinceTime = *since
+		}
+		entries, err := s.GetFiredLog(sinceTime)
+		if errors.Is(err, state.ErrFiredLogDisabled) {
+			render.Render(w, r, StatusErrNotFound(err))
+			return
+		}
+		if err != nil {
+			logf(r, "unable to read fired log: %s", err)
+			render.Render(w, r, StatusErrInternal(nil))
+			return
+		}
+		render.JSON(w, r, entries)
+	}
+}
+
+// filterReleaseEvents returns events newer than since (zero since keeps all), at most limit (0 is unlimited).
+func filterReleaseEvents(events []vault.ReleaseEvent, since time.Time, limit int) []vault.ReleaseEvent {
+	filtered := make([]vault.ReleaseEvent, 0, len(events))
+	for _, e := range events {
+		if limit > 0 && len(filtered) == limit {
+			break
+		}
+		if since.IsZero() || e.Time.After(since) {
+			filtered = append(filtered, e)
+		}
+	}
+	return filtered
+}
+
+// deleteActionHandler deletes single action from State based on UUID.
+// Action which vault secret could not be deleted is still deleted, failure is logged and counted.
+func deleteActionHandler(s state.StateInterface, m *metric.PromCollector) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		paramActionUUID := chi.URLParam(r, "actionUUID")
+		err := s.DeleteAction(paramActionUUID)
+		if errors.Is(err, state.ErrVaultSecretNotDeleted) {
+			logf(r, "action %s deleted: %s", paramActionUUID, err)
+			if m != nil {
+				m.RecordVaultDeleteFailed()
+			}
+		} else if err != nil {
+			logf(r, "unable to delete action: %s", err)
+			render.Render(w, r, StatusErrNotFound(err))
+			return
+		}
+		render.Render(w, r, StatusOK(http.StatusOK))
+	}
+}
+
+// cancelFireHandler cancels pending run of single action without user check-in.
+func cancelFireHandler(s state.StateInterface, m *metric.PromCollector) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		paramActionUUID := chi.URLParam(r, "actionUUID")
+		err := s.CancelActionPending(paramActionUUID)
+		if errors.Is(err, state.ErrActionNotPending) {
+			logf(r, "unable to cancel action fire: %s", err)
+			render.Render(w, r, StatusErrNotPending(err))
+			return
+		} else if err != nil {
+			logf(r, "unable to cancel action fire: %s", err)
+			render.Render(w, r, StatusErrNotFound(err))
+			return
+		}
+		logf(r, "pending run of action %s cancelled", paramActionUUID)
+		if m != nil {
+			m.RecordActionFireCancelled(paramActionUUID)
+		}
+		render.Render(w, r, StatusOK(http.StatusOK))
+	}
+}
+
+// reorderActionsRequest describes user request to reorder actions.
+type reorderActionsRequest struct {
+	UUIDs []string `json:"uuids"` // every action UUID in new order
+}
+
+// Bind validates reorderActionsRequest.
+func (req *reorderActionsRequest) Bind(r *http.Request) error {
+	if req.UUIDs == nil {
+		return fmt.Errorf("uuids is required")
+	}
+	return nil
+}
+
+// reorderActionsHandler reorders actions in State, uuids must list every action exactly once.
+func reorderActionsHandler(s state.StateInterface) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		request := &reorderActionsRequest{}
+		if err := render.Bind(r, request); err != nil {
+			logf(r, "wrong request data provided: %s", err)
+			render.Render(w, r, statusErrBind(err))
+			return
+		}
+
+		if err := s.ReorderActions(request.UUIDs); err != nil {
+			logf(r, "unable to reorder actions: %s", err)
+			render.Render(w, r, StatusErrInvalidRequest(err))
+			return
+		}
+		logf(r, "%d actions reordered", len(request.UUIDs))
+		render.Render(w, r, StatusOK(http.StatusOK))
+	}
+}
+
+// purgeActionsHandler deletes all actions from State.
+// Vault secrets are deleted too, unless keep_vault_secrets=true query parameter is provided.
+// 207 is returned when some vault secrets were not deleted, response lists them.
+// It is allowed only for admin token, it is forbidden when authentication is disabled.
+func purgeActionsHandler(s state.StateInterface) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !adminIdentity(r) {
+			err := fmt.Errorf("purge requires admin token")
+			logf(r, "unable to purge actions: %s", err)
+			render.Render(w, r, StatusErrForbidden(err))
+			return
+		}
+
+		deleteVaultSecrets := r.URL.Query().Get("keep_vault_secrets") != "true"
+		result := s.DeleteAllActions(deleteVaultSecrets)
+		logf(r, "purged %d actions, %d vault deletions failed", result.Deleted, result.VaultDeleteFailed)
+		if result.VaultDeleteFailed > 0 {
+			render.Status(r, http.StatusMultiStatus)
+		}
+		render.JSON(w, r, result)
+	}
+}
+
+// deleteVaultSecretHandler deletes secret from Vault.
+// With ?revoke=true secret is deleted before release, it is allowed only for client token of secret owner.
+func deleteVaultSecretHandler(v vault.VaultInterface) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		paramClientUUID := chi.URLParam(r, "clientUUID")
+		paramSecretUUID := chi.URLParam(r, "secretUUID")
+
+		deleteSecret := v.DeleteSecret
+		if r.URL.Query().Get("revoke") == "true" {
+			if identity := auth.IdentityFromContext(r.Context()); identity == nil || identity.ClientUUID != paramClientUUID {
+				err := fmt.Errorf("revoke requires client token of %s", paramClientUUID)
+				logf(r, "unable to revoke secret: %s", err)
+				render.Render(w, r, StatusErrForbidden(err))
+				return
+			}
+			deleteSecret = v.RevokeSecret
+		}
+
+		err := deleteSecret(paramClientUUID, paramSecretUUID)
+		if err != nil {
+			logf(r, "unable to delete secret: %s", err)
+			var notReleased *vault.NotReleasedError
+			if errors.As(err, &notReleased) {
+				render.Render(w, r, StatusErrNotReleased(notReleased.Remaining))
+				return
+			}
+			if errors.Is(err, vault.ErrSecretNotReleased) {
+				render.Render(w, r, StatusErrLocked(err))
+				return
+			}
+			render.Render(w, r, StatusErrNotFound(err))
+			return
+		}
+		render.Render(w, r, StatusOK(http.StatusOK))
+	}
+}
+
+// extendVaultSecretRequest describes owner request to release single vault secret later.
+type extendVaultSecretRequest struct {
+	Extend int `json:"extend"` // added to secret process_after, in secret process unit
+}
+
+// Bind validates extendVaultSecretRequest.
+func (req *extendVaultSecretRequest) Bind(r *http.Request) error {
+	if req.Extend <= 0 {
+		return fmt.Errorf("extend should be greater than 0")
+	}
+	return nil
+}
+
+// extendVaultSecretHandler pushes release of single secret back.
+// It is allowed only for client token of clientUUID, like secret revoke.
+func extendVaultSecretHandler(v vault.VaultInterface) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		paramClientUUID := chi.URLParam(r, "clientUUID")
+		paramSecretUUID := chi.URLParam(r, "secretUUID")
+
+		if identity := auth.IdentityFromContext(r.Context()); identity == nil || identity.ClientUUID != paramClientUUID {
+			err := fmt.Errorf("extend requires client token of %s", paramClientUUID)
+			logf(r, "unable to extend secret: %s", err)
+			render.Render(w, r, StatusErrForbidden(err))
+			return
+		}
+
+		request := &extendVaultSecretRequest{}
+		if err := render.Bind(r, request); err != nil {
+			logf(r, "wrong request data provided: %s", err)
+			render.Render(w, r, statusErrBind(err))
+			return
+		}
+
+		if err := v.ExtendSecret(paramClientUUID, paramSecretUUID, request.Extend); err != nil {
+			logf(r, "unable to extend secret: %s", err)
+			if errors.Is(err, vault.ErrSecretReleased) {
+				render.Render(w, r, StatusErrLocked(err))
+				return
+			}
+			render.Render(w, r, StatusErrNotFound(err))
+			return
+		}
+		logf(r, "secret %s/%s extended by %d", paramClientUUID, paramSecretUUID, request.Extend)
+		render.Render(w, r, StatusOK(http.StatusOK))
+	}
+}
+
+// adminIdentity returns true when request is authenticated with bearer token which is not client token.
+// It is false when authentication is disabled.
+func adminIdentity(r *http.Request) bool {
+	identity := auth.IdentityFromContext(r.Context())
+	return identity != nil && identity.Name != "" && identity.Type == auth.AuthTypeBearer && identity.ClientUUID == ""
+}
+
+// panicHandler pauses all actions, so nothing can fire until they are deleted.
+// With ?purge=true vault secrets of paused actions are deleted too.
+// It is allowed only for admin token, it is forbidden when authentication is disabled.
+func panicHandler(s state.StateInterface, m *metric.PromCollector) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !adminIdentity(r) {
+			err := fmt.Errorf("panic requires admin token")
+			logf(r, "unable to panic: %s", err)
+			render.Render(w, r, StatusErrForbidden(err))
+			return
+		}
+
+		result := s.Panic(r.URL.Query().Get("purge") == "true")
+		logf(r, "panic paused %d actions, %d vault secrets deleted, %d vault deletions failed", result.Paused, result.VaultDeleted, result.VaultDeleteFailed)
+		if m != nil {
+			m.RecordPanic()
+		}
+		render.JSON(w, r, result)
+	}
+}
+
+// releaseAllVaultSecretsHandler makes all secrets of clientUUID releasable immediately.
+// It is allowed only for bearer token which is not client token, so neither DMH client token
+// nor signed URL can pull the pin. It is forbidden when authentication is disabled.
+func releaseAllVaultSecretsHandler(v vault.VaultInterface) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		paramClientUUID := chi.URLParam(r, "clientUUID")
+
+		if !adminIdentity(r) {
+			err := fmt.Errorf("release-all requires admin token")
+			logf(r, "unable to release all secrets: %s", err)
+			render.Render(w, r, StatusErrForbidden(err))
+			return
+		}
+
+		if err := v.ReleaseAll(paramClientUUID); err != nil {
+			logf(r, "unable to release all secrets: %s", err)
+			render.Render(w, r, StatusErrNotFound(err))
+			return
+		}
+		logf(r, "all secrets of %s released", paramClientUUID)
+		render.Render(w, r, StatusOK(http.StatusOK))
+	}
+}
+
+// rotateKeyRequest describes user request to rotate own bearer token.
+type rotateKeyRequest struct {
+	Hash string `json:"hash"`
+}
+
+// Bind validates rotateKeyRequest.
+func (req *rotateKeyRequest) Bind(r *http.Request) error {
+	if req.Hash == "" {
+		return fmt.Errorf("hash must be provided")
+	}
+	return nil
+}
+
+// rotateKeyHandler replaces hash of bearer token used to authenticate request.
+// New token is used from next request, old token stops working immediately.
+func rotateKeyHandler(tokens *auth.TokenStore) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		identity := auth.IdentityFromContext(r.Context())
+		if identity == nil || identity.Type != auth.AuthTypeBearer || identity.Name == "" {
+			logf(r, "key rotation requires bearer token")
+			render.Render(w, r, StatusErrForbidden(fmt.Errorf("key rotation requires bearer token")))
+			return
+		}
+
+		request := &rotateKeyRequest{}
+		if err := render.Bind(r, request); err != nil {
+			logf(r, "wrong request data provided: %s", err)
+			render.Render(w, r, StatusErrInvalidRequest(err))
+			return
+		}
+
+		if err := tokens.Rotate(identity.Name, request.Hash); err != nil {
+			logf(r, "unable to rotate token %s: %s", identity.Name, err)
+			switch {
+			case errors.Is(err, auth.ErrTokenHashDuplicated):
+				render.Render(w, r, StatusErrDuplicate(err))
+			case errors.Is(err, auth.ErrTokenNotFound):
+				render.Render(w, r, StatusErrNotFound(err))
+			case errors.Is(err, auth.ErrTokenHashInvalid):
+				render.Render(w, r, StatusErrInvalidRequest(err))
+			default:
+				render.Render(w, r, StatusErrInternal(err))
+			}
 			return
 		}
+
+		logf(r, "token %s was rotated", identity.Name)
 		render.Render(w, r, StatusOK(http.StatusOK))
 	}
 }
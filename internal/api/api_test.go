@@ -2,16 +2,20 @@ package api
 
 import (
 	"bytes"
+	"cmp"
 	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"runtime"
+	"strings"
 	"testing"
 	"time"
 
 	"dmh/internal/auth"
+	"dmh/internal/crypt"
 	"dmh/internal/execute"
 	"dmh/internal/state"
 	"dmh/internal/vault"
@@ -26,23 +30,71 @@ type mockState struct {
 	mock.Mock
 }
 
-func (m *mockState) UpdateLastSeen() {
+func (m *mockState) UpdateLastSeen(meta *state.LastSeenMeta) {
+	m.Called(meta)
+}
+
+func (m *mockState) MarkGone() {
 	m.Called()
 }
 
+func (m *mockState) UpdatePartialLastSeen(percent int, defaultUnit time.Duration) int {
+	args := m.Called(percent, defaultUnit)
+	return args.Int(0)
+}
+
 func (m *mockState) GetLastSeen() time.Time {
 	args := m.Called()
 	return args.Get(0).(time.Time)
 }
 
+func (m *mockState) GetLastSeenMeta() *state.LastSeenMeta {
+	args := m.Called()
+	if args.Get(0) == nil {
+		return nil
+	}
+	return args.Get(0).(*state.LastSeenMeta)
+}
+
+func (m *mockState) SetMaintenance(extend time.Duration) {
+	m.Called(extend)
+}
+
+func (m *mockState) ClearMaintenance() {
+	m.Called()
+}
+
+func (m *mockState) GetMaintenance() *state.Maintenance {
+	args := m.Called()
+	if args.Get(0) == nil {
+		return nil
+	}
+	return args.Get(0).(*state.Maintenance)
+}
+
 func (m *mockState) GetActions() []*state.EncryptedAction {
 	args := m.Called()
 	return args.Get(0).([]*state.EncryptedAction)
 }
 
-func (m *mockState) AddAction(action *state.Action) error {
+func (m *mockState) AddAction(action *state.Action) (string, error) {
 	args := m.Called(action)
-	return args.Error(0)
+	return args.String(0), args.Error(1)
+}
+
+func (m *mockState) AddUnverifiedAction(action *state.Action, verifyToken string) (string, error) {
+	args := m.Called(action, verifyToken)
+	return args.String(0), args.Error(1)
+}
+
+func (m *mockState) VerifyAction(verifyToken string) (string, error) {
+	args := m.Called(verifyToken)
+	return args.String(0), args.Error(1)
+}
+
+func (m *mockState) AcknowledgeReceipt(receiptToken string) (string, error) {
+	args := m.Called(receiptToken)
+	return args.String(0), args.Error(1)
 }
 
 func (m *mockState) GetAction(uuid string) (*state.EncryptedAction, int) {
@@ -58,11 +110,46 @@ func (m *mockState) DeleteAction(uuid string) error {
 	return args.Error(0)
 }
 
+func (m *mockState) DeleteAllActions(deleteVaultSecrets bool) *state.PurgeResult {
+	args := m.Called(deleteVaultSecrets)
+	return args.Get(0).(*state.PurgeResult)
+}
+
+func (m *mockState) ReorderActions(uuids []string) error {
+	args := m.Called(uuids)
+	return args.Error(0)
+}
+
 func (m *mockState) MarkActionAsProcessed(uuid string) error {
 	args := m.Called(uuid)
 	return args.Error(0)
 }
 
+func (m *mockState) MarkActionPending(uuid string) error {
+	args := m.Called(uuid)
+	return args.Error(0)
+}
+
+func (m *mockState) RecordActionFailure(uuid string) error {
+	args := m.Called(uuid)
+	return args.Error(0)
+}
+
+func (m *mockState) UpdateSourceLastSeen(source string, meta *state.LastSeenMeta) (bool, error) {
+	args := m.Called(source, meta)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *mockState) SourceLastSeenAdvances(source string) (bool, error) {
+	args := m.Called(source)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *mockState) CancelActionPending(uuid string) error {
+	args := m.Called(uuid)
+	return args.Error(0)
+}
+
 func (m *mockState) DecryptAction(uuid string) (*state.Action, error) {
 	args := m.Called(uuid)
 	if args.Get(0) == nil {
@@ -76,11 +163,63 @@ func (m *mockState) UpdateActionLastRun(uuid string) error {
 	return args.Error(0)
 }
 
+func (m *mockState) Panic(purge bool) *state.PanicResult {
+	args := m.Called(purge)
+	return args.Get(0).(*state.PanicResult)
+}
+
+func (m *mockState) Reconcile(declared []*state.Action) error {
+	args := m.Called(declared)
+	return args.Error(0)
+}
+
+func (m *mockState) SnapshotAt(t time.Time) (*state.Snapshot, error) {
+	args := m.Called(t)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*state.Snapshot), args.Error(1)
+}
+
+func (m *mockState) GetFiredLog(since time.Time) ([]*state.FiredEntry, error) {
+	args := m.Called(since)
+	return args.Get(0).([]*state.FiredEntry), args.Error(1)
+}
+
+func (m *mockState) RecordActionDelivery(uuid string, dataHash string) error {
+	args := m.Called(uuid, dataHash)
+	return args.Error(0)
+}
+
+func (m *mockState) SuppressActionRun(uuid string) error {
+	args := m.Called(uuid)
+	return args.Error(0)
+}
+
 func (m *mockState) GetActionLastRun(uuid string) (time.Time, error) {
 	args := m.Called(uuid)
 	return args.Get(0).(time.Time), args.Error(1)
 }
 
+func (m *mockState) VerifyVaultKeys() []state.VerifyResult {
+	args := m.Called()
+	return args.Get(0).([]state.VerifyResult)
+}
+
+func (m *mockState) GetVaultProcessUnit() (time.Duration, error) {
+	args := m.Called()
+	return args.Get(0).(time.Duration), args.Error(1)
+}
+
+func (m *mockState) Subscribe() (<-chan *state.Event, func()) {
+	args := m.Called()
+	return args.Get(0).(<-chan *state.Event), args.Get(1).(func())
+}
+
+func (m *mockState) ReportActionError(uuid string, step string, err error) {
+	m.Called(uuid, step, err)
+}
+
 type mockVault struct {
 	mock.Mock
 }
@@ -89,6 +228,16 @@ func (m *mockVault) UpdateLastSeen(clientUUID string) {
 	m.Called(clientUUID)
 }
 
+func (m *mockVault) MarkGone(clientUUID string) error {
+	args := m.Called(clientUUID)
+	return args.Error(0)
+}
+
+func (m *mockVault) UpdatePartialLastSeen(clientUUID string, percent int) error {
+	args := m.Called(clientUUID, percent)
+	return args.Error(0)
+}
+
 func (m *mockVault) GetSecret(clientUUID string, secretUUID string) (*vault.Secret, error) {
 	args := m.Called(clientUUID, secretUUID)
 	if args.Get(0) == nil {
@@ -107,15 +256,143 @@ func (m *mockVault) DeleteSecret(clientUUID string, secretUUID string) error {
 	return args.Error(0)
 }
 
+func (m *mockVault) RevokeSecret(clientUUID string, secretUUID string) error {
+	args := m.Called(clientUUID, secretUUID)
+	return args.Error(0)
+}
+
+func (m *mockVault) GetReleaseEvents() []vault.ReleaseEvent {
+	args := m.Called()
+	return args.Get(0).([]vault.ReleaseEvent)
+}
+
+func (m *mockVault) GetSecretProcessUnit() time.Duration {
+	args := m.Called()
+	return args.Get(0).(time.Duration)
+}
+
+func (m *mockVault) GetSecretStatus(clientUUID string, secretUUID string) (*vault.SecretStatus, error) {
+	args := m.Called(clientUUID, secretUUID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*vault.SecretStatus), args.Error(1)
+}
+
+func (m *mockVault) GetSecretMeta(clientUUID string, secretUUID string) (*vault.Secret, error) {
+	args := m.Called(clientUUID, secretUUID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*vault.Secret), args.Error(1)
+}
+
+func (m *mockVault) StaleSecrets(olderThan time.Duration) []string {
+	args := m.Called(olderThan)
+	return args.Get(0).([]string)
+}
+
+func (m *mockVault) ClientStatuses() []vault.ClientStatus {
+	args := m.Called()
+	return args.Get(0).([]vault.ClientStatus)
+}
+
+func (m *mockVault) ExtendSecret(clientUUID string, secretUUID string, extra int) error {
+	args := m.Called(clientUUID, secretUUID, extra)
+	return args.Error(0)
+}
+
+func (m *mockVault) ReleaseAll(clientUUID string) error {
+	args := m.Called(clientUUID)
+	return args.Error(0)
+}
+
+func (m *mockVault) SetExtend(clientUUID string, extend time.Duration) {
+	m.Called(clientUUID, extend)
+}
+
+func (m *mockVault) ObserveClientClock(clientUUID string, clientTime time.Time) time.Duration {
+	args := m.Called(clientUUID, clientTime)
+	return args.Get(0).(time.Duration)
+}
+
 type mockExecute struct {
 	mock.Mock
 }
 
-func (e *mockExecute) Run(action *state.Action) error {
+func (e *mockExecute) Run(ctx context.Context, action *state.Action) error {
+	args := e.Called(ctx, action)
+	return args.Error(0)
+}
+
+func (e *mockExecute) RunVerification(ctx context.Context, action *state.Action, link string) error {
+	args := e.Called(ctx, action, link)
+	return args.Error(0)
+}
+
+func (e *mockExecute) Validate(action *state.Action) error {
 	args := e.Called(action)
 	return args.Error(0)
 }
 
+func (e *mockExecute) Preview(action *state.Action) ([]execute.Recipient, error) {
+	args := e.Called(action)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]execute.Recipient), args.Error(1)
+}
+
+// KindEnabled allows every kind, unless test set KindEnabled expectation.
+func (e *mockExecute) KindEnabled(kind string) error {
+	for _, call := range e.ExpectedCalls {
+		if call.Method == "KindEnabled" {
+			return e.Called(kind).Error(0)
+		}
+	}
+	return nil
+}
+
+// requireErrCode checks error code from ErrResponse body.
+func requireErrCode(t *testing.T, expected string, w *httptest.ResponseRecorder) {
+	t.Helper()
+	if expected == "" {
+		return
+	}
+	var response map[string]any
+	require.Nil(t, json.Unmarshal(w.Body.Bytes(), &response))
+	require.Equal(t, expected, response["code"])
+}
+
+func TestErrResponseValidationErrors(t *testing.T) {
+	tests := []struct {
+		inputErr       error
+		expectedError  string
+		expectedErrors []string
+	}{
+		{
+			inputErr:      fmt.Errorf("hash must be provided"),
+			expectedError: "hash must be provided",
+		},
+		{
+			inputErr:       state.ValidationError{fmt.Errorf("kind is required"), fmt.Errorf("process_after should be greater than 0")},
+			expectedError:  "kind is required; process_after should be greater than 0",
+			expectedErrors: []string{"kind is required", "process_after should be greater than 0"},
+		},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest("POST", "/", nil)
+		w := httptest.NewRecorder()
+		render.Render(w, r, StatusErrInvalidRequest(test.inputErr))
+
+		var response ErrResponse
+		require.Nil(t, json.Unmarshal(w.Body.Bytes(), &response))
+		require.Equal(t, http.StatusBadRequest, w.Code)
+		require.Equal(t, test.expectedError, response.ErrorText)
+		require.Equal(t, test.expectedErrors, response.Errors)
+	}
+}
+
 func TestHealthHandler(t *testing.T) {
 	req, err := http.NewRequest("GET", "/health", nil)
 	require.Nil(t, err)
@@ -127,20 +404,68 @@ func TestHealthHandler(t *testing.T) {
 	require.Equal(t, http.StatusOK, w.Code)
 }
 
+func TestVersionHandler(t *testing.T) {
+	req, err := http.NewRequest("GET", "/api/version", nil)
+	require.Nil(t, err)
+	w := httptest.NewRecorder()
+
+	handler := versionHandler([]string{"dmh", "vault"})
+
+	handler(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.JSONEq(t, fmt.Sprintf(`{"version":"dev","commit":"unknown","date":"unknown","go_version":"%s","components":["dmh","vault"]}`, runtime.Version()), w.Body.String())
+}
+
+func TestReadyHandler(t *testing.T) {
+	tests := []struct {
+		inputReadiness  *Readiness
+		expectedStatus  int
+		expectedErrCode string
+	}{
+		{
+			expectedStatus: http.StatusOK,
+		},
+		{
+			inputReadiness: NewReadiness(),
+			expectedStatus: http.StatusOK,
+		},
+		{
+			inputReadiness:  NewReadiness(ReadyState, ReadyRemoteVaultProbe),
+			expectedStatus:  http.StatusServiceUnavailable,
+			expectedErrCode: CodeNotReady,
+		},
+	}
+	for _, test := range tests {
+		req, err := http.NewRequest("GET", "/readyz", nil)
+		require.Nil(t, err)
+		w := httptest.NewRecorder()
+
+		handler := readyHandler(test.inputReadiness)
+		handler(w, req)
+		require.Equal(t, test.expectedStatus, w.Code)
+		requireErrCode(t, test.expectedErrCode, w)
+	}
+}
+
 func TestAliveHandler(t *testing.T) {
 	tests := []struct {
 		inputVaultURL         string
 		inputVaultClientUUID  string
 		inputVaultToken       string
+		inputMetaConfig       LastSeenMetaConfig
+		inputHeaders          map[string]string
 		mockNewRequest        func(string, string, io.Reader) (*http.Request, error)
 		fakeHTTPServer        func() *httptest.Server
 		expectedCode          int
+		expectedErrCode       string
 		expectLastSeenUpdated bool
+		expectedLastSeenMeta  *state.LastSeenMeta
 	}{
 		{
 			inputVaultURL:        "http://wrong\r",
 			inputVaultClientUUID: "test",
 			expectedCode:         http.StatusInternalServerError,
+			expectedErrCode:      CodeInternal,
 		},
 		{
 			inputVaultURL:        "http://test",
@@ -148,12 +473,14 @@ func TestAliveHandler(t *testing.T) {
 			mockNewRequest: func(string, string, io.Reader) (*http.Request, error) {
 				return nil, fmt.Errorf("mockNewRequest error")
 			},
-			expectedCode: http.StatusInternalServerError,
+			expectedCode:    http.StatusInternalServerError,
+			expectedErrCode: CodeInternal,
 		},
 		{
 			inputVaultURL:        "http://broken",
 			inputVaultClientUUID: "test",
 			expectedCode:         http.StatusInternalServerError,
+			expectedErrCode:      CodeVaultUnreachable,
 		},
 		{
 			inputVaultURL:        "",
@@ -165,7 +492,8 @@ func TestAliveHandler(t *testing.T) {
 				}))
 				return s
 			},
-			expectedCode: http.StatusInternalServerError,
+			expectedCode:    http.StatusInternalServerError,
+			expectedErrCode: CodeVaultError,
 		},
 		{
 			inputVaultURL:        "",
@@ -174,6 +502,9 @@ func TestAliveHandler(t *testing.T) {
 				s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 					require.Equal(t, "/api/vault/alive/test", r.URL.Path)
 					require.Empty(t, r.Header.Get("Authorization"))
+					clientTime, err := time.Parse(time.RFC3339Nano, r.Header.Get(vault.ClientTimeHeader))
+					require.Nil(t, err)
+					require.WithinDuration(t, time.Now(), clientTime, time.Minute)
 					w.WriteHeader(http.StatusOK)
 				}))
 				return s
@@ -196,15 +527,47 @@ func TestAliveHandler(t *testing.T) {
 			expectedCode:          http.StatusOK,
 			expectLastSeenUpdated: true,
 		},
+		{
+			inputVaultURL:        "",
+			inputVaultClientUUID: "test",
+			inputMetaConfig:      LastSeenMetaConfig{Enabled: true},
+			inputHeaders:         map[string]string{"User-Agent": "test-agent", "X-Forwarded-For": "10.0.0.1"},
+			fakeHTTPServer: func() *httptest.Server {
+				s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.WriteHeader(http.StatusOK)
+				}))
+				return s
+			},
+			expectedCode:          http.StatusOK,
+			expectLastSeenUpdated: true,
+			expectedLastSeenMeta:  &state.LastSeenMeta{IP: "192.0.2.1", UserAgent: "test-agent"},
+		},
+		{
+			inputVaultURL:        "",
+			inputVaultClientUUID: "test",
+			inputMetaConfig:      LastSeenMetaConfig{Enabled: true, TrustForwardedFor: true},
+			inputHeaders:         map[string]string{"User-Agent": "test-agent", "X-Forwarded-For": "10.0.0.1, 10.0.0.2"},
+			fakeHTTPServer: func() *httptest.Server {
+				s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.WriteHeader(http.StatusOK)
+				}))
+				return s
+			},
+			expectedCode:          http.StatusOK,
+			expectLastSeenUpdated: true,
+			expectedLastSeenMeta:  &state.LastSeenMeta{IP: "10.0.0.2", UserAgent: "test-agent"},
+		},
 	}
 
 	for _, test := range tests {
-		req, err := http.NewRequest("GET", "/api/alive", nil)
-		require.Nil(t, err)
+		req := httptest.NewRequest("GET", "/api/alive", nil)
+		for k, v := range test.inputHeaders {
+			req.Header.Set(k, v)
+		}
 		w := httptest.NewRecorder()
 
 		s := new(mockState)
-		s.On("UpdateLastSeen").Return()
+		s.On("UpdateLastSeen", mock.Anything).Return()
 		if test.fakeHTTPServer != nil {
 			fakeServer := test.fakeHTTPServer()
 			defer fakeServer.Close()
@@ -220,838 +583,3681 @@ func TestAliveHandler(t *testing.T) {
 			}()
 		}
 
-		handler := aliveHandler(s, test.inputVaultURL, test.inputVaultClientUUID, test.inputVaultToken)
+		handler := aliveHandler(s, []string{test.inputVaultURL}, test.inputVaultClientUUID, test.inputVaultToken, test.inputMetaConfig, nil, time.Hour)
 
 		handler(w, req)
 		require.Equal(t, test.expectedCode, w.Code)
+		requireErrCode(t, test.expectedErrCode, w)
 
 		if test.expectLastSeenUpdated {
-			s.AssertCalled(t, "UpdateLastSeen")
+			s.AssertCalled(t, "UpdateLastSeen", test.expectedLastSeenMeta)
 		} else {
-			s.AssertNotCalled(t, "UpdateLastSeen")
+			s.AssertNotCalled(t, "UpdateLastSeen", mock.Anything)
 		}
 	}
 }
 
-func TestVaultAliveHandler(t *testing.T) {
+func TestAliveHandlerSources(t *testing.T) {
 	tests := []struct {
-		inputClientUUID string
-		expectedCode    int
+		inputURL              string
+		inputRequiredSources  []string
+		mockAdvanced          bool
+		mockErr               error
+		vaultStatus           int
+		expectedCode          int
+		expectedErrCode       string
+		expectedSource        string
+		expectedVaultCalled   bool
+		expectSourceRecorded  bool
+		expectLastSeenUpdated bool
 	}{
 		{
-			inputClientUUID: "",
-			expectedCode:    http.StatusNotFound,
+			inputURL:             "/api/alive",
+			inputRequiredSources: []string{"alice", "bob"},
+			expectedCode:         http.StatusBadRequest,
+			expectedErrCode:      CodeInvalidPayload,
 		},
 		{
-			inputClientUUID: "test",
-			expectedCode:    http.StatusOK,
+			inputURL:             "/api/alive?source=eve",
+			inputRequiredSources: []string{"alice", "bob"},
+			mockErr:              fmt.Errorf("%w: eve", state.ErrUnknownSource),
+			expectedCode:         http.StatusBadRequest,
+			expectedErrCode:      CodeInvalidPayload,
+			expectedSource:       "eve",
+		},
+		{
+			inputURL:             "/api/alive?source=alice",
+			inputRequiredSources: []string{"alice", "bob"},
+			expectedCode:         http.StatusOK,
+			expectedSource:       "alice",
+			expectSourceRecorded: true,
+		},
+		{
+			inputURL:             "/api/alive?source=bob",
+			inputRequiredSources: []string{"alice", "bob"},
+			mockAdvanced:         true,
+			expectedCode:         http.StatusOK,
+			expectedSource:       "bob",
+			expectedVaultCalled:  true,
+			expectSourceRecorded: true,
+		},
+		{
+			inputURL:             "/api/alive?source=bob",
+			inputRequiredSources: []string{"alice", "bob"},
+			mockAdvanced:         true,
+			vaultStatus:          http.StatusInternalServerError,
+			expectedCode:         http.StatusInternalServerError,
+			expectedErrCode:      CodeVaultError,
+			expectedSource:       "bob",
+			expectedVaultCalled:  true,
+		},
+		{
+			inputURL:             "/api/alive?source=phone",
+			mockAdvanced:         true,
+			expectedCode:         http.StatusOK,
+			expectedSource:       "phone",
+			expectedVaultCalled:  true,
+			expectSourceRecorded: true,
+		},
+		{
+			inputURL:              "/api/alive",
+			expectedCode:          http.StatusOK,
+			expectedVaultCalled:   true,
+			expectLastSeenUpdated: true,
 		},
 	}
 	for _, test := range tests {
-		req, err := http.NewRequest("GET", fmt.Sprintf("/api/vault/alive/%s", test.inputClientUUID), nil)
-		require.Nil(t, err)
-
-		ctx := chi.NewRouteContext()
-		ctx.URLParams.Add("clientUUID", test.inputClientUUID)
-		req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, ctx))
+		vaultCalled := false
+		fakeServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			vaultCalled = true
+			w.WriteHeader(cmp.Or(test.vaultStatus, http.StatusOK))
+		}))
+		defer fakeServer.Close()
 
+		req := httptest.NewRequest("POST", test.inputURL, nil)
 		w := httptest.NewRecorder()
 
-		v := new(mockVault)
-		v.On("UpdateLastSeen", test.inputClientUUID).Return()
+		s := new(mockState)
+		s.On("UpdateLastSeen", mock.Anything).Return()
+		s.On("SourceLastSeenAdvances", test.expectedSource).Return(test.mockAdvanced, test.mockErr)
+		s.On("UpdateSourceLastSeen", test.expectedSource, (*state.LastSeenMeta)(nil)).Return(test.mockAdvanced, nil)
 
-		handler := vaultAliveHandler(v)
+		handler := aliveHandler(s, []string{fakeServer.URL}, "test", "", LastSeenMetaConfig{}, test.inputRequiredSources, time.Hour)
 
 		handler(w, req)
-		require.Equal(t, test.expectedCode, w.Code)
+		require.Equal(t, test.expectedCode, w.Code, test.inputURL)
+		requireErrCode(t, test.expectedErrCode, w)
+		require.Equal(t, test.expectedVaultCalled, vaultCalled, test.inputURL)
+		if test.expectSourceRecorded {
+			s.AssertCalled(t, "UpdateSourceLastSeen", test.expectedSource, (*state.LastSeenMeta)(nil))
+		} else {
+			s.AssertNotCalled(t, "UpdateSourceLastSeen", mock.Anything, mock.Anything)
+		}
+		if test.expectLastSeenUpdated {
+			s.AssertCalled(t, "UpdateLastSeen", (*state.LastSeenMeta)(nil))
+		} else {
+			s.AssertNotCalled(t, "UpdateLastSeen", mock.Anything)
+		}
 	}
 }
 
-func TestTestActionHandler(t *testing.T) {
+func TestAliveHandlerSummary(t *testing.T) {
+	lastSeen := time.Now().UTC().Truncate(time.Second)
+	nextAction := lastSeen.Add(10 * time.Hour)
 	tests := []struct {
-		payload         string
-		mockExecuteFunc func() execute.ExecuteInterface
-		inputAuthConfig auth.Config
-		inputIdentity   *auth.Identity
-		expectedCode    int
+		inputAccept      string
+		inputActions     []*state.EncryptedAction
+		expectedResponse string
 	}{
 		{
-			payload: `{"kind": "bulksms", "data": "{\"test\": 10}}`,
-			mockExecuteFunc: func() execute.ExecuteInterface {
-				e := new(mockExecute)
-				return e
+			inputAccept:      "",
+			expectedResponse: `{"status":"success"}`,
+		},
+		{
+			inputAccept:      "*/*",
+			expectedResponse: `{"status":"success"}`,
+		},
+		{
+			inputAccept:      "application/json",
+			expectedResponse: `{"status":"success","armed_actions":0,"firing_soon":0}`,
+		},
+		{
+			inputAccept: "application/json, text/plain",
+			inputActions: []*state.EncryptedAction{
+				{UUID: "later", Action: state.Action{ProcessAfter: 100}},
+				{UUID: "soon", Action: state.Action{ProcessAfter: 10}},
+				{UUID: "processed", Action: state.Action{ProcessAfter: 1}, Processed: 2},
+			},
+			expectedResponse: fmt.Sprintf(`{"status":"success","armed_actions":2,"firing_soon":1,"next_action_at":"%s","next_action_uuid":"soon"}`, nextAction.Format(time.RFC3339)),
+		},
+	}
+	for _, test := range tests {
+		fakeServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer fakeServer.Close()
+
+		req := httptest.NewRequest("GET", "/api/alive", nil)
+		req.Header.Set("Accept", test.inputAccept)
+		w := httptest.NewRecorder()
+
+		s := new(mockState)
+		s.On("UpdateLastSeen", mock.Anything).Return()
+		s.On("GetLastSeen").Return(lastSeen)
+		s.On("GetMaintenance").Return(nil)
+		s.On("GetActions").Return(test.inputActions)
+
+		handler := aliveHandler(s, []string{fakeServer.URL}, "test", "", LastSeenMetaConfig{}, nil, time.Hour)
+
+		handler(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+		require.JSONEq(t, test.expectedResponse, w.Body.String(), test.inputAccept)
+		if !strings.HasPrefix(test.inputAccept, "application/json") {
+			s.AssertNotCalled(t, "GetActions")
+		}
+	}
+}
+
+func TestAliveHandlerAdditionalVaults(t *testing.T) {
+	var globalRequests, overrideRequests int
+	globalVault := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		globalRequests++
+	}))
+	defer globalVault.Close()
+	overrideStatus := http.StatusOK
+	overrideVault := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/api/vault/alive/test", r.URL.Path)
+		require.Equal(t, "Bearer vault-token", r.Header.Get("Authorization"))
+		overrideRequests++
+		w.WriteHeader(overrideStatus)
+	}))
+	defer overrideVault.Close()
+
+	s := new(mockState)
+	s.On("UpdateLastSeen", mock.Anything).Return()
+	handler := aliveHandler(s, []string{globalVault.URL, overrideVault.URL}, "test", "vault-token", LastSeenMetaConfig{}, nil, time.Hour)
+
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest("GET", "/api/alive", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, 1, globalRequests)
+	require.Equal(t, 1, overrideRequests)
+	s.AssertNumberOfCalls(t, "UpdateLastSeen", 1)
+
+	// LastSeen is not updated when any vault does not acknowledge check-in.
+	overrideStatus = http.StatusInternalServerError
+	w = httptest.NewRecorder()
+	handler(w, httptest.NewRequest("GET", "/api/alive", nil))
+	require.Equal(t, http.StatusInternalServerError, w.Code)
+	requireErrCode(t, CodeVaultError, w)
+	require.Equal(t, 2, overrideRequests)
+	s.AssertNumberOfCalls(t, "UpdateLastSeen", 1)
+}
+
+func TestStatusHandler(t *testing.T) {
+	mockTime := time.Date(2025, 3, 26, 14, 55, 40, 0, time.UTC)
+	tests := []struct {
+		inputMeta        *state.LastSeenMeta
+		inputActions     []*state.EncryptedAction
+		inputMaintenance *state.Maintenance
+		expectedBody     string
+	}{
+		{
+			expectedBody: `{"last_seen":"2025-03-26T14:55:40Z","process_unit":"hour"}` + "\n",
+		},
+		{
+			inputMeta:    &state.LastSeenMeta{IP: "10.0.0.1", UserAgent: "test-agent"},
+			expectedBody: `{"last_seen":"2025-03-26T14:55:40Z","last_seen_meta":{"ip":"10.0.0.1","user_agent":"test-agent"},"process_unit":"hour"}` + "\n",
+		},
+		{
+			inputActions: []*state.EncryptedAction{
+				{UUID: "processed", Action: state.Action{ProcessAfter: 1}, Processed: 2},
+				{UUID: "later", Action: state.Action{ProcessAfter: 5}},
+				{UUID: "first", Action: state.Action{ProcessAfter: 30, ProcessUnit: "minute"}},
+			},
+			expectedBody: `{"last_seen":"2025-03-26T14:55:40Z","next_action_at":"2025-03-26T15:25:40Z","next_action_uuid":"first","process_unit":"hour"}` + "\n",
+		},
+		{
+			inputActions: []*state.EncryptedAction{
+				{UUID: "processed", Action: state.Action{ProcessAfter: 1}, Processed: 1},
+			},
+			expectedBody: `{"last_seen":"2025-03-26T14:55:40Z","process_unit":"hour"}` + "\n",
+		},
+		{
+			inputActions: []*state.EncryptedAction{
+				{UUID: "first", Action: state.Action{ProcessAfter: 30, ProcessUnit: "minute"}},
+			},
+			inputMaintenance: &state.Maintenance{Extend: time.Hour, Since: mockTime},
+			expectedBody:     `{"last_seen":"2025-03-26T14:55:40Z","next_action_at":"2025-03-26T16:25:40Z","next_action_uuid":"first","process_unit":"hour","maintenance":{"extend":3600000000000,"since":"2025-03-26T14:55:40Z"}}` + "\n",
+		},
+	}
+	for _, test := range tests {
+		req, err := http.NewRequest("GET", "/api/status", nil)
+		require.Nil(t, err)
+		w := httptest.NewRecorder()
+
+		s := new(mockState)
+		s.On("GetLastSeen").Return(mockTime)
+		s.On("GetMaintenance").Return(test.inputMaintenance)
+		s.On("GetLastSeenMeta").Return(test.inputMeta)
+		s.On("GetActions").Return(test.inputActions)
+
+		handler := statusHandler(s, time.Hour)
+
+		handler(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Equal(t, test.expectedBody, w.Body.String())
+	}
+}
+
+func TestEventsHandler(t *testing.T) {
+	events := make(chan *state.Event, 2)
+	events <- &state.Event{Type: state.EventActionAdded, ActionUUID: "test-uuid", Time: time.Date(2025, 3, 26, 14, 55, 40, 0, time.UTC)}
+	events <- &state.Event{Type: state.EventActionError, ActionUUID: "test-uuid", Processed: 1, Step: "Run", Error: "boom", Time: time.Date(2025, 3, 26, 14, 55, 41, 0, time.UTC)}
+	close(events)
+
+	unsubscribed := false
+	s := new(mockState)
+	s.On("Subscribe").Return((<-chan *state.Event)(events), func() { unsubscribed = true })
+
+	req := httptest.NewRequest("GET", "/api/events", nil)
+	w := httptest.NewRecorder()
+	eventsHandler(s)(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "text/event-stream", w.Header().Get("Content-Type"))
+	require.Equal(t, "no-cache", w.Header().Get("Cache-Control"))
+	require.Equal(t, "event: action_added\n"+
+		`data: {"type":"action_added","action_uuid":"test-uuid","processed":0,"time":"2025-03-26T14:55:40Z"}`+"\n\n"+
+		"event: action_error\n"+
+		`data: {"type":"action_error","action_uuid":"test-uuid","processed":1,"step":"Run","error":"boom","time":"2025-03-26T14:55:41Z"}`+"\n\n",
+		w.Body.String())
+	require.True(t, unsubscribed)
+}
+
+func TestEventsHandlerDisconnect(t *testing.T) {
+	eventsKeepAliveInterval = time.Millisecond
+	defer func() {
+		eventsKeepAliveInterval = 15 * time.Second
+	}()
+
+	events := make(chan *state.Event)
+	s := new(mockState)
+	s.On("Subscribe").Return((<-chan *state.Event)(events), func() {})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req := httptest.NewRequest("GET", "/api/events", nil).WithContext(ctx)
+	w := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		eventsHandler(s)(w, req)
+		close(done)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+	<-done
+
+	require.Contains(t, w.Body.String(), ": keep-alive\n\n")
+}
+
+func TestVaultAliveHandler(t *testing.T) {
+	clientTime := time.Date(2025, 3, 26, 14, 0, 0, 0, time.UTC)
+	tests := []struct {
+		inputClientUUID string
+		inputClientTime string
+		expectedObserve bool
+		expectedCode    int
+		expectedErrCode string
+	}{
+		{
+			inputClientUUID: "",
+			expectedCode:    http.StatusNotFound,
+			expectedErrCode: CodeNotFound,
+		},
+		{
+			inputClientUUID: "test",
+			expectedCode:    http.StatusOK,
+		},
+		{
+			inputClientUUID: "test",
+			inputClientTime: clientTime.Format(time.RFC3339Nano),
+			expectedObserve: true,
+			expectedCode:    http.StatusOK,
+		},
+		{
+			inputClientUUID: "test",
+			inputClientTime: "yesterday",
+			expectedCode:    http.StatusOK,
+		},
+	}
+	for _, test := range tests {
+		req, err := http.NewRequest("GET", fmt.Sprintf("/api/vault/alive/%s", test.inputClientUUID), nil)
+		require.Nil(t, err)
+		if test.inputClientTime != "" {
+			req.Header.Set(vault.ClientTimeHeader, test.inputClientTime)
+		}
+
+		ctx := chi.NewRouteContext()
+		ctx.URLParams.Add("clientUUID", test.inputClientUUID)
+		req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, ctx))
+
+		w := httptest.NewRecorder()
+
+		v := new(mockVault)
+		v.On("UpdateLastSeen", test.inputClientUUID).Return()
+		v.On("ObserveClientClock", test.inputClientUUID, clientTime).Return(time.Duration(0))
+
+		handler := vaultAliveHandler(v)
+
+		handler(w, req)
+		require.Equal(t, test.expectedCode, w.Code)
+		requireErrCode(t, test.expectedErrCode, w)
+		if test.expectedObserve {
+			v.AssertCalled(t, "ObserveClientClock", test.inputClientUUID, clientTime)
+		} else {
+			v.AssertNotCalled(t, "ObserveClientClock", mock.Anything, mock.Anything)
+		}
+	}
+}
+
+func TestPartialAlive(t *testing.T) {
+	tests := []struct {
+		inputQuery      string
+		vaultStatus     int
+		expectedCode    int
+		expectedErrCode string
+		expectedPercent int
+	}{
+		{
+			inputQuery:      "?extend=50%25",
+			vaultStatus:     http.StatusOK,
+			expectedCode:    http.StatusOK,
+			expectedPercent: 50,
+		},
+		{
+			inputQuery:      "?extend=100&source=phone",
+			vaultStatus:     http.StatusOK,
+			expectedCode:    http.StatusOK,
+			expectedPercent: 100,
+		},
+		{
+			inputQuery:      "?extend=0%25",
+			expectedCode:    http.StatusBadRequest,
+			expectedErrCode: CodeInvalidPayload,
+		},
+		{
+			inputQuery:      "?extend=half",
+			expectedCode:    http.StatusBadRequest,
+			expectedErrCode: CodeInvalidPayload,
+		},
+		{
+			inputQuery:      "?extend=50%25",
+			vaultStatus:     http.StatusForbidden,
+			expectedCode:    http.StatusInternalServerError,
+			expectedErrCode: CodeVaultError,
+			expectedPercent: 50,
+		},
+	}
+	for _, test := range tests {
+		var vaultPercent int
+		fakeServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			require.Equal(t, "POST", r.Method)
+			require.Equal(t, "/api/vault/alive/client-uuid/partial", r.URL.Path)
+			require.Equal(t, "Bearer vault-token", r.Header.Get("Authorization"))
+			request := &vaultPartialAliveRequest{}
+			require.Nil(t, json.NewDecoder(r.Body).Decode(request))
+			vaultPercent = request.Percent
+			w.WriteHeader(test.vaultStatus)
+		}))
+		defer fakeServer.Close()
+
+		req, err := http.NewRequest("POST", "/api/alive"+test.inputQuery, nil)
+		require.Nil(t, err)
+		w := httptest.NewRecorder()
+
+		s := new(mockState)
+		s.On("UpdatePartialLastSeen", test.expectedPercent, time.Hour).Return(2)
+
+		handler := aliveHandler(s, []string{fakeServer.URL}, "client-uuid", "vault-token", LastSeenMetaConfig{}, []string{"phone", "laptop"}, time.Hour)
+		handler(w, req)
+		require.Equal(t, test.expectedCode, w.Code)
+		requireErrCode(t, test.expectedErrCode, w)
+		require.Equal(t, test.expectedPercent, vaultPercent)
+		if test.expectedCode == http.StatusOK {
+			s.AssertCalled(t, "UpdatePartialLastSeen", test.expectedPercent, time.Hour)
+		} else {
+			s.AssertNotCalled(t, "UpdatePartialLastSeen", mock.Anything, mock.Anything)
+		}
+		s.AssertNotCalled(t, "UpdateLastSeen", mock.Anything)
+		s.AssertNotCalled(t, "UpdateSourceLastSeen", mock.Anything, mock.Anything)
+	}
+}
+
+func TestVaultPartialAliveHandler(t *testing.T) {
+	tests := []struct {
+		payload         string
+		vaultErr        error
+		expectedCode    int
+		expectedErrCode string
+	}{
+		{
+			payload:      `{"percent": 50}`,
+			expectedCode: http.StatusOK,
+		},
+		{
+			payload:         `{"percent": 0}`,
+			expectedCode:    http.StatusBadRequest,
+			expectedErrCode: CodeInvalidPayload,
+		},
+		{
+			payload:         `{"percent": 50}`,
+			vaultErr:        fmt.Errorf("percent should be between 1 and 100"),
+			expectedCode:    http.StatusBadRequest,
+			expectedErrCode: CodeInvalidPayload,
+		},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest("POST", "/api/vault/alive/test/partial", bytes.NewBufferString(test.payload))
+		req.Header.Set("Content-Type", "application/json")
+		ctx := chi.NewRouteContext()
+		ctx.URLParams.Add("clientUUID", "test")
+		req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, ctx))
+		w := httptest.NewRecorder()
+
+		v := new(mockVault)
+		v.On("UpdatePartialLastSeen", "test", 50).Return(test.vaultErr)
+
+		handler := vaultPartialAliveHandler(v)
+		handler(w, req)
+		require.Equal(t, test.expectedCode, w.Code)
+		requireErrCode(t, test.expectedErrCode, w)
+	}
+}
+
+func TestVaultGoneHandler(t *testing.T) {
+	adminIdentity := &auth.Identity{Name: "admin", Type: auth.AuthTypeBearer, Scopes: []string{"api:vault:alive"}}
+	tests := []struct {
+		inputClientUUID string
+		inputIdentity   *auth.Identity
+		mockError       error
+		expectedCode    int
+		expectedErrCode string
+		expectedGone    bool
+	}{
+		{
+			inputClientUUID: "",
+			inputIdentity:   adminIdentity,
+			expectedCode:    http.StatusNotFound,
+			expectedErrCode: CodeNotFound,
+		},
+		{
+			inputClientUUID: "test",
+			expectedCode:    http.StatusForbidden,
+			expectedErrCode: CodeForbidden,
+		},
+		{
+			inputClientUUID: "test",
+			inputIdentity:   &auth.Identity{Name: "dmh", Type: auth.AuthTypeBearer, ClientUUID: "test", Scopes: []string{"api:vault:alive:test"}},
+			expectedCode:    http.StatusForbidden,
+			expectedErrCode: CodeForbidden,
+		},
+		{
+			inputClientUUID: "unknown",
+			inputIdentity:   adminIdentity,
+			mockError:       fmt.Errorf("client unknown is missing"),
+			expectedCode:    http.StatusNotFound,
+			expectedErrCode: CodeNotFound,
+			expectedGone:    true,
+		},
+		{
+			inputClientUUID: "test",
+			inputIdentity:   adminIdentity,
+			expectedCode:    http.StatusOK,
+			expectedGone:    true,
+		},
+	}
+	for _, test := range tests {
+		req, err := http.NewRequest("DELETE", fmt.Sprintf("/api/vault/alive/%s", test.inputClientUUID), nil)
+		require.Nil(t, err)
+
+		ctx := chi.NewRouteContext()
+		ctx.URLParams.Add("clientUUID", test.inputClientUUID)
+		req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, ctx))
+		if test.inputIdentity != nil {
+			req = req.WithContext(auth.ContextWithIdentity(req.Context(), test.inputIdentity))
+		}
+
+		w := httptest.NewRecorder()
+
+		v := new(mockVault)
+		v.On("MarkGone", test.inputClientUUID).Return(test.mockError)
+
+		handler := vaultGoneHandler(v)
+
+		handler(w, req)
+		require.Equal(t, test.expectedCode, w.Code)
+		requireErrCode(t, test.expectedErrCode, w)
+		if test.expectedGone {
+			v.AssertCalled(t, "MarkGone", test.inputClientUUID)
+		} else {
+			v.AssertNotCalled(t, "MarkGone", mock.Anything)
+		}
+	}
+}
+
+func TestTestActionHandler(t *testing.T) {
+	tests := []struct {
+		payload         string
+		mockExecuteFunc func() execute.ExecuteInterface
+		inputAuthConfig auth.Config
+		inputIdentity   *auth.Identity
+		inputMaxData    int
+		expectedCode    int
+		expectedErrCode string
+		expectedBody    string
+	}{
+		{
+			payload: `{"kind": "bulksms", "data": "{\"test\": 10}}`,
+			mockExecuteFunc: func() execute.ExecuteInterface {
+				e := new(mockExecute)
+				return e
+			},
+			expectedCode:    http.StatusBadRequest,
+			expectedErrCode: CodeInvalidPayload,
+		},
+		{
+			payload: `{"kind": "bulksms", "process_after": 10, "confirm": true, "data": "{\"message\": \"test\", \"destination\": [\"1111\"]}"}`,
+			mockExecuteFunc: func() execute.ExecuteInterface {
+				e := new(mockExecute)
+				e.On("Run", mock.Anything, &state.Action{Kind: "bulksms", Data: "{\"message\": \"test\", \"destination\": [\"1111\"]}", ProcessAfter: 10}).Return(fmt.Errorf("mockExecuteFunc error"))
+				return e
+			},
+			expectedCode:    http.StatusBadRequest,
+			expectedErrCode: CodeActionFailed,
+		},
+		{
+			payload: `{"kind": "bulksms", "process_after": 5, "confirm": true, "data": "{\"message\": \"test\", \"destination\": [\"1111\"]}"}`,
+			mockExecuteFunc: func() execute.ExecuteInterface {
+				e := new(mockExecute)
+				e.On("Run", mock.Anything, &state.Action{Kind: "bulksms", Data: "{\"message\": \"test\", \"destination\": [\"1111\"]}", ProcessAfter: 5}).Return(nil)
+				return e
+			},
+			expectedCode: http.StatusOK,
+		},
+		{
+			payload: `{"kind": "bulksms", "process_after": 5, "data": "{\"message\": \"test\", \"destination\": [\"1111\"]}"}`,
+			mockExecuteFunc: func() execute.ExecuteInterface {
+				e := new(mockExecute)
+				e.On("Preview", &state.Action{Kind: "bulksms", Data: "{\"message\": \"test\", \"destination\": [\"1111\"]}", ProcessAfter: 5}).Return([]execute.Recipient{{Type: "phone", Address: "1111"}}, nil)
+				return e
+			},
+			expectedCode: http.StatusOK,
+			expectedBody: `{"dry_run":true,"recipients":[{"type":"phone","address":"1111"}]}` + "\n",
+		},
+		{
+			payload: `{"kind": "bulksms", "process_after": 5, "confirm": false, "data": "{\"message\": \"test\", \"destination\": [\"1111\"]}"}`,
+			mockExecuteFunc: func() execute.ExecuteInterface {
+				e := new(mockExecute)
+				e.On("Preview", &state.Action{Kind: "bulksms", Data: "{\"message\": \"test\", \"destination\": [\"1111\"]}", ProcessAfter: 5}).Return(nil, fmt.Errorf("token must be provided"))
+				return e
+			},
+			expectedCode:    http.StatusBadRequest,
+			expectedErrCode: CodeInvalidPayload,
+		},
+		{
+			payload: `{"kind": "mail", "process_after": 10, "data": "{\"message\": \"/{sig_auth:alive}\", \"destination\": [\"a@b.com\"], \"subject\": \"hi\"}"}`,
+			mockExecuteFunc: func() execute.ExecuteInterface {
+				return new(mockExecute)
+			},
+			inputAuthConfig: auth.Config{Enabled: true},
+			inputIdentity:   &auth.Identity{Name: "admin", Scopes: []string{"api"}},
+			expectedCode:    http.StatusForbidden,
+			expectedErrCode: CodeForbidden,
+		},
+		{
+			payload: `{"kind": "mail", "process_after": 5, "confirm": true, "data": "{\"message\": \"/{sig_auth:alive}\", \"destination\": [\"a@b.com\"], \"subject\": \"hi\"}"}`,
+			mockExecuteFunc: func() execute.ExecuteInterface {
+				e := new(mockExecute)
+				e.On("Run", mock.Anything, &state.Action{Kind: "mail", Data: "{\"message\": \"/{sig_auth:alive}\", \"destination\": [\"a@b.com\"], \"subject\": \"hi\"}", ProcessAfter: 5}).Return(nil)
+				return e
+			},
+			inputAuthConfig: auth.Config{Enabled: true},
+			inputIdentity:   &auth.Identity{Name: "admin", Scopes: []string{"api", "alive"}},
+			expectedCode:    http.StatusOK,
+		},
+		{
+			payload: `{"kind": "bulksms", "process_after": 5, "data": "{\"message\": \"test\", \"destination\": [\"1111\"]}"}`,
+			mockExecuteFunc: func() execute.ExecuteInterface {
+				return new(mockExecute)
+			},
+			inputMaxData:    10,
+			expectedCode:    http.StatusRequestEntityTooLarge,
+			expectedErrCode: CodeTooLarge,
+		},
+	}
+	for _, test := range tests {
+		reqBody := bytes.NewBufferString(test.payload)
+		req, err := http.NewRequest("POST", "/api/action/test", reqBody)
+		require.Nil(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		if test.inputIdentity != nil {
+			req = req.WithContext(auth.ContextWithIdentity(req.Context(), test.inputIdentity))
+		}
+
+		w := httptest.NewRecorder()
+		e := test.mockExecuteFunc()
+
+		handler := testActionHandler(e, test.inputAuthConfig, test.inputMaxData)
+
+		handler(w, req)
+		require.Equal(t, test.expectedCode, w.Code)
+		requireErrCode(t, test.expectedErrCode, w)
+		if test.expectedBody != "" {
+			require.Equal(t, test.expectedBody, w.Body.String())
+		}
+		e.(*mockExecute).AssertExpectations(t)
+	}
+}
+
+func TestValidateActionHandler(t *testing.T) {
+	tests := []struct {
+		payload         string
+		mockExecuteFunc func() execute.ExecuteInterface
+		inputAuthConfig auth.Config
+		inputIdentity   *auth.Identity
+		expectedCode    int
+		expectedErrCode string
+	}{
+		{
+			payload: `{"kind": "bulksms", "data": "{\"test\": 10}}`,
+			mockExecuteFunc: func() execute.ExecuteInterface {
+				return new(mockExecute)
+			},
+			expectedCode:    http.StatusBadRequest,
+			expectedErrCode: CodeInvalidPayload,
+		},
+		{
+			payload: `{"kind": "mail", "process_after": 10, "data": "{\"message\": \"test\", \"destination\": [\"a@b.com\"], \"subject\": \"hi\"}"}`,
+			mockExecuteFunc: func() execute.ExecuteInterface {
+				e := new(mockExecute)
+				e.On("Validate", &state.Action{Kind: "mail", Data: "{\"message\": \"test\", \"destination\": [\"a@b.com\"], \"subject\": \"hi\"}", ProcessAfter: 10}).Return(fmt.Errorf("server must be provided"))
+				return e
+			},
+			expectedCode:    http.StatusBadRequest,
+			expectedErrCode: CodeInvalidPayload,
+		},
+		{
+			payload: `{"kind": "bulksms", "process_after": 5, "min_interval": 1, "comment": "test", "data": "{\"message\": \"test\", \"destination\": [\"1111\"]}"}`,
+			mockExecuteFunc: func() execute.ExecuteInterface {
+				e := new(mockExecute)
+				e.On("Validate", &state.Action{Kind: "bulksms", Data: "{\"message\": \"test\", \"destination\": [\"1111\"]}", ProcessAfter: 5, MinInterval: 1, Comment: "test"}).Return(nil)
+				return e
+			},
+			expectedCode: http.StatusOK,
+		},
+		{
+			payload: `{"kind": "mail", "process_after": 10, "data": "{\"message\": \"/{sig_auth:alive}\", \"destination\": [\"a@b.com\"], \"subject\": \"hi\"}"}`,
+			mockExecuteFunc: func() execute.ExecuteInterface {
+				return new(mockExecute)
+			},
+			inputAuthConfig: auth.Config{Enabled: true},
+			inputIdentity:   &auth.Identity{Name: "admin", Scopes: []string{"api"}},
+			expectedCode:    http.StatusForbidden,
+			expectedErrCode: CodeForbidden,
+		},
+		{
+			payload: `{"kind": "mail", "process_after": 10, "data": "{\"message\": \"test\", \"destination\": [\"a@b.com\"], \"subject\": \"hi\"}"}`,
+			mockExecuteFunc: func() execute.ExecuteInterface {
+				e := new(mockExecute)
+				e.On("KindEnabled", "mail").Return(fmt.Errorf("kind %q %w", "mail", execute.ErrKindNotEnabled))
+				return e
+			},
+			expectedCode:    http.StatusBadRequest,
+			expectedErrCode: CodeInvalidPayload,
+		},
+	}
+	for _, test := range tests {
+		reqBody := bytes.NewBufferString(test.payload)
+		req, err := http.NewRequest("POST", "/api/action/validate", reqBody)
+		require.Nil(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		if test.inputIdentity != nil {
+			req = req.WithContext(auth.ContextWithIdentity(req.Context(), test.inputIdentity))
+		}
+
+		w := httptest.NewRecorder()
+		e := test.mockExecuteFunc()
+
+		handler := validateActionHandler(e, test.inputAuthConfig, 0)
+
+		handler(w, req)
+		require.Equal(t, test.expectedCode, w.Code)
+		requireErrCode(t, test.expectedErrCode, w)
+		e.(*mockExecute).AssertNotCalled(t, "Run", mock.Anything)
+	}
+}
+
+func TestPreviewActionHandler(t *testing.T) {
+	tests := []struct {
+		payload          string
+		mockExecuteFunc  func() execute.ExecuteInterface
+		inputAuthConfig  auth.Config
+		inputIdentity    *auth.Identity
+		expectedCode     int
+		expectedErrCode  string
+		expectedResponse string
+	}{
+		{
+			payload: `{"kind": "mail", "data": "{\"test\": 10}}`,
+			mockExecuteFunc: func() execute.ExecuteInterface {
+				return new(mockExecute)
+			},
+			expectedCode:    http.StatusBadRequest,
+			expectedErrCode: CodeInvalidPayload,
+		},
+		{
+			payload: `{"kind": "mail", "process_after": 10, "data": "{\"message\": \"test\", \"destination\": [\"a@b.com\"], \"subject\": \"hi\"}"}`,
+			mockExecuteFunc: func() execute.ExecuteInterface {
+				e := new(mockExecute)
+				e.On("Preview", &state.Action{Kind: "mail", Data: "{\"message\": \"test\", \"destination\": [\"a@b.com\"], \"subject\": \"hi\"}", ProcessAfter: 10}).Return(nil, fmt.Errorf("server must be provided"))
+				return e
+			},
+			expectedCode:    http.StatusBadRequest,
+			expectedErrCode: CodeInvalidPayload,
+		},
+		{
+			payload: `{"kind": "mail", "process_after": 10, "data": "{\"message\": \"test\", \"destination\": [\"a@b.com\", \"c@d.com\"], \"subject\": \"hi\"}"}`,
+			mockExecuteFunc: func() execute.ExecuteInterface {
+				e := new(mockExecute)
+				e.On("Preview", &state.Action{Kind: "mail", Data: "{\"message\": \"test\", \"destination\": [\"a@b.com\", \"c@d.com\"], \"subject\": \"hi\"}", ProcessAfter: 10}).Return([]execute.Recipient{{Type: "mail", Address: "a@b.com"}, {Type: "mail", Address: "c@d.com"}}, nil)
+				return e
+			},
+			expectedCode:     http.StatusOK,
+			expectedResponse: `{"recipients":[{"type":"mail","address":"a@b.com"},{"type":"mail","address":"c@d.com"}]}`,
+		},
+		{
+			payload: `{"kind": "mail", "process_after": 10, "data": "{\"message\": \"/{sig_auth:alive}\", \"destination\": [\"a@b.com\"], \"subject\": \"hi\"}"}`,
+			mockExecuteFunc: func() execute.ExecuteInterface {
+				return new(mockExecute)
+			},
+			inputAuthConfig: auth.Config{Enabled: true},
+			inputIdentity:   &auth.Identity{Name: "admin", Scopes: []string{"api"}},
+			expectedCode:    http.StatusForbidden,
+			expectedErrCode: CodeForbidden,
+		},
+	}
+	for _, test := range tests {
+		reqBody := bytes.NewBufferString(test.payload)
+		req, err := http.NewRequest("POST", "/api/action/preview", reqBody)
+		require.Nil(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		if test.inputIdentity != nil {
+			req = req.WithContext(auth.ContextWithIdentity(req.Context(), test.inputIdentity))
+		}
+
+		w := httptest.NewRecorder()
+		e := test.mockExecuteFunc()
+
+		handler := previewActionHandler(e, test.inputAuthConfig, 0)
+
+		handler(w, req)
+		require.Equal(t, test.expectedCode, w.Code)
+		requireErrCode(t, test.expectedErrCode, w)
+		if test.expectedResponse != "" {
+			require.JSONEq(t, test.expectedResponse, w.Body.String())
+		}
+		e.(*mockExecute).AssertNotCalled(t, "Run", mock.Anything)
+	}
+}
+
+func TestRehearseActionHandler(t *testing.T) {
+	mailAction := &state.Action{Kind: "mail", Data: `{"message":"test"}`}
+	fallbackAction := &state.Action{Kind: "mail", Data: `{"message":"test"}`, Fallback: &state.Fallback{Kind: "bulksms", Data: `{"message":"test"}`}}
+	tests := []struct {
+		mockStateFunc    func() state.StateInterface
+		mockExecuteFunc  func() execute.ExecuteInterface
+		expectedCode     int
+		expectedErrCode  string
+		expectedResponse string
+	}{
+		{
+			mockStateFunc: func() state.StateInterface {
+				s := new(mockState)
+				s.On("GetAction", "test").Return(nil, -1)
+				return s
+			},
+			mockExecuteFunc: func() execute.ExecuteInterface { return new(mockExecute) },
+			expectedCode:    http.StatusNotFound,
+			expectedErrCode: CodeNotFound,
+		},
+		{
+			mockStateFunc: func() state.StateInterface {
+				s := new(mockState)
+				s.On("GetAction", "test").Return(&state.EncryptedAction{UUID: "test", Processed: 2}, 0)
+				return s
+			},
+			mockExecuteFunc: func() execute.ExecuteInterface { return new(mockExecute) },
+			expectedCode:    http.StatusGone,
+			expectedErrCode: CodeGone,
+		},
+		{
+			mockStateFunc: func() state.StateInterface {
+				s := new(mockState)
+				s.On("GetAction", "test").Return(&state.EncryptedAction{UUID: "test"}, 0)
+				s.On("DecryptAction", "test").Return(nil, fmt.Errorf("%w: test", state.ErrKeyNotReleased))
+				return s
+			},
+			mockExecuteFunc: func() execute.ExecuteInterface { return new(mockExecute) },
+			expectedCode:    http.StatusLocked,
+			expectedErrCode: CodeLocked,
+		},
+		{
+			mockStateFunc: func() state.StateInterface {
+				s := new(mockState)
+				s.On("GetAction", "test").Return(&state.EncryptedAction{UUID: "test"}, 0)
+				s.On("DecryptAction", "test").Return(nil, fmt.Errorf("%w: timeout", state.ErrVaultUnreachable))
+				return s
+			},
+			mockExecuteFunc: func() execute.ExecuteInterface { return new(mockExecute) },
+			expectedCode:    http.StatusInternalServerError,
+			expectedErrCode: CodeVaultUnreachable,
+		},
+		{
+			mockStateFunc: func() state.StateInterface {
+				s := new(mockState)
+				s.On("GetAction", "test").Return(&state.EncryptedAction{UUID: "test"}, 0)
+				s.On("DecryptAction", "test").Return(mailAction, nil)
+				return s
+			},
+			mockExecuteFunc: func() execute.ExecuteInterface {
+				e := new(mockExecute)
+				e.On("Preview", mailAction).Return(nil, fmt.Errorf("server must be provided"))
+				return e
+			},
+			expectedCode:    http.StatusBadRequest,
+			expectedErrCode: CodeActionFailed,
+		},
+		{
+			mockStateFunc: func() state.StateInterface {
+				s := new(mockState)
+				s.On("GetAction", "test").Return(&state.EncryptedAction{UUID: "test"}, 0)
+				s.On("DecryptAction", "test").Return(mailAction, nil)
+				return s
+			},
+			mockExecuteFunc: func() execute.ExecuteInterface {
+				e := new(mockExecute)
+				e.On("Preview", mailAction).Return([]execute.Recipient{{Type: "mail", Address: "a@b.com"}}, nil)
+				return e
+			},
+			expectedCode:     http.StatusOK,
+			expectedResponse: `{"kind":"mail","recipients":[{"type":"mail","address":"a@b.com"}]}`,
+		},
+		{
+			mockStateFunc: func() state.StateInterface {
+				s := new(mockState)
+				s.On("GetAction", "test").Return(&state.EncryptedAction{UUID: "test"}, 0)
+				s.On("DecryptAction", "test").Return(fallbackAction, nil)
+				return s
+			},
+			mockExecuteFunc: func() execute.ExecuteInterface {
+				e := new(mockExecute)
+				e.On("Preview", fallbackAction).Return([]execute.Recipient{{Type: "mail", Address: "a@b.com"}}, nil)
+				e.On("Preview", fallbackAction.FallbackAction()).Return([]execute.Recipient{{Type: "phone", Address: "111"}}, nil)
+				return e
+			},
+			expectedCode:     http.StatusOK,
+			expectedResponse: `{"kind":"mail","recipients":[{"type":"mail","address":"a@b.com"}],"fallback_kind":"bulksms","fallback_recipients":[{"type":"phone","address":"111"}]}`,
+		},
+	}
+	for _, test := range tests {
+		req, err := http.NewRequest("POST", "/api/action/store/test/rehearse", nil)
+		require.Nil(t, err)
+		ctx := chi.NewRouteContext()
+		ctx.URLParams.Add("actionUUID", "test")
+		req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, ctx))
+		w := httptest.NewRecorder()
+		s := test.mockStateFunc()
+		e := test.mockExecuteFunc()
+
+		rehearseActionHandler(s, e)(w, req)
+		require.Equal(t, test.expectedCode, w.Code)
+		requireErrCode(t, test.expectedErrCode, w)
+		if test.expectedResponse != "" {
+			require.JSONEq(t, test.expectedResponse, w.Body.String())
+		}
+		e.(*mockExecute).AssertNotCalled(t, "Run", mock.Anything, mock.Anything)
+		s.(*mockState).AssertNotCalled(t, "MarkActionAsProcessed", mock.Anything)
+	}
+}
+
+func TestListActionsHandler(t *testing.T) {
+	listLastSeen := time.Date(2025, 4, 1, 0, 0, 0, 0, time.UTC)
+	listDeadline := time.Date(2025, 4, 2, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		mockStateFunc    func() state.StateInterface
+		inputQuery       string
+		expectedCode     int
+		expectedResponse []*state.EncryptedAction
+	}{
+		{
+			mockStateFunc: func() state.StateInterface {
+				s := new(mockState)
+				s.On("GetActions").Return([]*state.EncryptedAction{})
+				return s
+			},
+			expectedCode:     http.StatusOK,
+			expectedResponse: []*state.EncryptedAction{},
+		},
+		{
+			mockStateFunc: func() state.StateInterface {
+				s := new(mockState)
+				s.On("GetActions").Return([]*state.EncryptedAction{
+					{UUID: "test1", Action: state.Action{}},
+					{UUID: "test2", Action: state.Action{}},
+				})
+				return s
+			},
+			expectedCode: http.StatusOK,
+			expectedResponse: []*state.EncryptedAction{
+				{UUID: "test1", Action: state.Action{}},
+				{UUID: "test2", Action: state.Action{}},
+			},
+		},
+		{
+			mockStateFunc: func() state.StateInterface {
+				s := new(mockState)
+				s.On("GetActions").Return([]*state.EncryptedAction{
+					{UUID: "test1", Action: state.Action{Comment: "Mail to Alice"}},
+					{UUID: "test2", Action: state.Action{Comment: "sms to bob"}},
+					{UUID: "test3", Action: state.Action{Comment: "second MAIL"}},
+				})
+				return s
+			},
+			inputQuery:   "?comment=mail",
+			expectedCode: http.StatusOK,
+			expectedResponse: []*state.EncryptedAction{
+				{UUID: "test1", Action: state.Action{Comment: "Mail to Alice"}},
+				{UUID: "test3", Action: state.Action{Comment: "second MAIL"}},
+			},
+		},
+		{
+			mockStateFunc: func() state.StateInterface {
+				s := new(mockState)
+				s.On("GetActions").Return([]*state.EncryptedAction{
+					{UUID: "test1", RecipientHash: "aaaa"},
+					{UUID: "test2", RecipientHash: "bbbb"},
+					{UUID: "test3"},
+					{UUID: "test4", RecipientHash: "aaaa"},
+				})
+				return s
+			},
+			inputQuery:   "?recipient_hash=AAAA",
+			expectedCode: http.StatusOK,
+			expectedResponse: []*state.EncryptedAction{
+				{UUID: "test1", RecipientHash: "aaaa"},
+				{UUID: "test4", RecipientHash: "aaaa"},
+			},
+		},
+		{
+			mockStateFunc: func() state.StateInterface {
+				s := new(mockState)
+				s.On("GetActions").Return([]*state.EncryptedAction{
+					{UUID: "test1", Action: state.Action{Comment: "Mail to Alice"}},
+				})
+				return s
+			},
+			inputQuery:       "?comment=missing",
+			expectedCode:     http.StatusOK,
+			expectedResponse: []*state.EncryptedAction{},
+		},
+		{
+			mockStateFunc: func() state.StateInterface {
+				s := new(mockState)
+				s.On("GetActions").Return([]*state.EncryptedAction{
+					{UUID: "test1", Action: state.Action{Kind: "mail", Comment: "Mail to Alice"}},
+					{UUID: "test2", Action: state.Action{Kind: "mail", Comment: "mail to bob"}, Processed: 2},
+					{UUID: "test3", Action: state.Action{Kind: "bulksms", Comment: "mail fallback"}},
+					{UUID: "test4", Action: state.Action{Kind: "mail", Comment: "letter"}},
+					{UUID: "test5", Action: state.Action{Kind: "mail", Comment: "second mail"}, RecipientHash: "aaaa"},
+				})
+				return s
+			},
+			inputQuery:   "?comment=mail&kind=mail&processed=0",
+			expectedCode: http.StatusOK,
+			expectedResponse: []*state.EncryptedAction{
+				{UUID: "test1", Action: state.Action{Kind: "mail", Comment: "Mail to Alice"}},
+				{UUID: "test5", Action: state.Action{Kind: "mail", Comment: "second mail"}, RecipientHash: "aaaa"},
+			},
+		},
+		{
+			mockStateFunc: func() state.StateInterface {
+				s := new(mockState)
+				s.On("GetActions").Return([]*state.EncryptedAction{
+					{UUID: "test1", Action: state.Action{Kind: "mail", Comment: "Mail to Alice"}},
+					{UUID: "test2", Action: state.Action{Kind: "mail", Comment: "mail to bob"}, Processed: 2},
+					{UUID: "test3", Action: state.Action{Kind: "mail", Comment: "second mail"}, RecipientHash: "aaaa"},
+				})
+				return s
+			},
+			inputQuery:   "?comment=MAIL&recipient_hash=aaaa&processed=0",
+			expectedCode: http.StatusOK,
+			expectedResponse: []*state.EncryptedAction{
+				{UUID: "test3", Action: state.Action{Kind: "mail", Comment: "second mail"}, RecipientHash: "aaaa"},
+			},
+		},
+		{
+			mockStateFunc: func() state.StateInterface {
+				s := new(mockState)
+				s.On("GetActions").Return([]*state.EncryptedAction{})
+				return s
+			},
+			inputQuery:   "?processed=3",
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			mockStateFunc: func() state.StateInterface {
+				s := new(mockState)
+				s.On("GetActions").Return([]*state.EncryptedAction{
+					{UUID: "hour", Action: state.Action{ProcessAfter: 1}},
+					{UUID: "week", Action: state.Action{ProcessAfter: 24 * 7}},
+					{UUID: "month", Action: state.Action{ProcessAfter: 24 * 30}},
+					{UUID: "deadline", Action: state.Action{ProcessAfter: 24 * 30, Deadline: &listDeadline}},
+					{UUID: "processed", Action: state.Action{ProcessAfter: 1}, Processed: 2},
+				})
+				s.On("GetLastSeen").Return(listLastSeen)
+				s.On("GetMaintenance").Return(nil)
+				return s
+			},
+			inputQuery:   "?fires_before=2025-04-09T00:00:00Z",
+			expectedCode: http.StatusOK,
+			expectedResponse: []*state.EncryptedAction{
+				{UUID: "hour", Action: state.Action{ProcessAfter: 1}},
+				{UUID: "week", Action: state.Action{ProcessAfter: 24 * 7}},
+				{UUID: "deadline", Action: state.Action{ProcessAfter: 24 * 30, Deadline: &listDeadline}},
+			},
+		},
+		{
+			mockStateFunc: func() state.StateInterface {
+				s := new(mockState)
+				s.On("GetActions").Return([]*state.EncryptedAction{
+					{UUID: "hour", Action: state.Action{ProcessAfter: 1}},
+					{UUID: "week", Action: state.Action{ProcessAfter: 24 * 7}},
+					{UUID: "month", Action: state.Action{ProcessAfter: 24 * 30}},
+					{UUID: "processed", Action: state.Action{ProcessAfter: 1}, Processed: 2},
+				})
+				s.On("GetLastSeen").Return(listLastSeen)
+				s.On("GetMaintenance").Return(&state.Maintenance{Extend: 24 * time.Hour})
+				return s
+			},
+			inputQuery:   "?fires_after=2025-04-02T00:00:00Z&fires_before=2025-04-03T00:00:00Z",
+			expectedCode: http.StatusOK,
+			expectedResponse: []*state.EncryptedAction{
+				{UUID: "hour", Action: state.Action{ProcessAfter: 1}},
+			},
+		},
+	}
+	for _, test := range tests {
+		req, err := http.NewRequest("GET", "/api/action/store"+test.inputQuery, nil)
+		require.Nil(t, err)
+		w := httptest.NewRecorder()
+
+		s := test.mockStateFunc()
+		s.(*mockState).On("GetLastSeen").Return(listLastSeen).Maybe()
+		s.(*mockState).On("GetMaintenance").Return(nil).Maybe()
+
+		handler := listActionsHandler(s, time.Hour)
+
+		handler(w, req)
+		require.Equal(t, test.expectedCode, w.Code)
+		if test.expectedCode != http.StatusOK {
+			requireErrCode(t, CodeInvalidPayload, w)
+			continue
+		}
+
+		contentType := w.Header().Get("Content-Type")
+		require.Equal(t, "application/json", contentType)
+
+		var response []*state.EncryptedAction
+		err = json.Unmarshal(w.Body.Bytes(), &response)
+		require.Nil(t, err)
+		require.Equal(t, test.expectedResponse, response)
+	}
+}
+
+func TestNewActionResponses(t *testing.T) {
+	lastSeen := time.Date(2025, 4, 1, 12, 0, 0, 0, time.UTC)
+	notBefore := time.Date(2025, 4, 10, 0, 0, 0, 0, time.UTC)
+	actions := []*state.EncryptedAction{
+		{UUID: "hour", Action: state.Action{ProcessAfter: 1}},
+		{UUID: "not-before", Action: state.Action{ProcessAfter: 1, NotBefore: &notBefore}},
+		{UUID: "processed", Action: state.Action{ProcessAfter: 1}, Processed: 2},
+	}
+
+	responses := newActionResponses(actions, lastSeen, 24*time.Hour, time.Hour)
+	require.Len(t, responses, 3)
+	require.Equal(t, lastSeen.Add(25*time.Hour), *responses[0].NextFireAt)
+	require.Equal(t, notBefore, *responses[1].NextFireAt)
+	require.Nil(t, responses[2].NextFireAt)
+
+	encoded, err := json.Marshal(responses[0])
+	require.Nil(t, err)
+	require.Contains(t, string(encoded), `"uuid":"hour"`)
+	require.Contains(t, string(encoded), `"next_fire_at":"2025-04-02T13:00:00Z"`)
+}
+
+func TestAddActionRequestLocalTime(t *testing.T) {
+	tests := []struct {
+		payload       string
+		expectedError string
+	}{
+		{
+			payload:       `{"deadline": "2999-05-01T00:00:00"}`,
+			expectedError: "deadline must be RFC3339 time, time without UTC offset requires valid timezone",
+		},
+		{
+			payload:       `{"timezone": "Local", "not_before": "2999-05-01T00:00:00"}`,
+			expectedError: "not_before must be RFC3339 time, time without UTC offset requires valid timezone",
+		},
+		{
+			payload:       `{"timezone": "Europe/Warsaw", "deadline": "01.05.2999"}`,
+			expectedError: "deadline must be RFC3339 time or 2006-01-02T15:04:05 in timezone",
+		},
+		{
+			payload: `{"deadline": null, "not_before": ""}`,
+		},
+	}
+	for _, test := range tests {
+		var req addTestActionRequest
+		err := json.Unmarshal([]byte(test.payload), &req)
+		if test.expectedError != "" {
+			require.EqualError(t, err, test.expectedError)
+			continue
+		}
+		require.Nil(t, err)
+		require.Nil(t, req.Deadline)
+		require.Nil(t, req.NotBefore)
+	}
+}
+
+func TestNewActionResponsesTimezone(t *testing.T) {
+	lastSeen := time.Date(2025, 4, 1, 12, 0, 0, 0, time.UTC)
+	deadline := time.Date(2025, 4, 30, 22, 0, 0, 0, time.UTC)
+	a := &state.EncryptedAction{UUID: "local", Action: state.Action{ProcessAfter: 1, Deadline: &deadline, Timezone: "Europe/Warsaw"}}
+
+	responses := newActionResponses([]*state.EncryptedAction{a}, lastSeen, 0, time.Hour)
+	encoded, err := json.Marshal(responses[0])
+	require.Nil(t, err)
+	require.Contains(t, string(encoded), `"deadline":"2025-05-01T00:00:00+02:00"`)
+	require.Contains(t, string(encoded), `"next_fire_at":"2025-04-01T15:00:00+02:00"`)
+	require.Contains(t, string(encoded), `"timezone":"Europe/Warsaw"`)
+	// stored action is not changed.
+	require.Equal(t, time.UTC, a.Deadline.Location())
+}
+
+func TestListActionsHandlerInvalidTime(t *testing.T) {
+	for _, query := range []string{"?fires_before=tomorrow", "?fires_after=2025-04-01", "?at=yesterday"} {
+		s := new(mockState)
+		s.On("GetActions").Return([]*state.EncryptedAction{}).Maybe()
+		s.On("GetLastSeen").Return(time.Time{}).Maybe()
+		s.On("GetMaintenance").Return(nil).Maybe()
+		req, err := http.NewRequest("GET", "/api/action/store"+query, nil)
+		require.Nil(t, err)
+		w := httptest.NewRecorder()
+
+		listActionsHandler(s, time.Hour)(w, req)
+		require.Equal(t, http.StatusBadRequest, w.Code)
+		requireErrCode(t, CodeInvalidPayload, w)
+	}
+}
+
+func TestListActionsHandlerSnapshot(t *testing.T) {
+	at := time.Date(2025, 4, 1, 12, 0, 0, 0, time.UTC)
+	snapshotLastSeen := time.Date(2025, 4, 1, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		mockError        error
+		expectedCode     int
+		expectedResponse string
+	}{
+		{
+			expectedCode:     http.StatusOK,
+			expectedResponse: `"next_fire_at":"2025-04-01T12:00:00Z"`,
+		},
+		{
+			mockError:        fmt.Errorf("%w: no backup before 2025-04-01T12:00:00Z", state.ErrSnapshotNotFound),
+			expectedCode:     http.StatusNotFound,
+			expectedResponse: `"code":"not_found"`,
+		},
+		{
+			mockError:    fmt.Errorf("unable to load state backup"),
+			expectedCode: http.StatusInternalServerError,
+		},
+	}
+	for _, test := range tests {
+		s := new(mockState)
+		if test.mockError != nil {
+			s.On("SnapshotAt", at).Return(nil, test.mockError)
+		} else {
+			s.On("SnapshotAt", at).Return(&state.Snapshot{
+				Time:        at.Add(-time.Minute),
+				LastSeen:    snapshotLastSeen,
+				Maintenance: &state.Maintenance{Extend: time.Hour},
+				Actions:     []*state.EncryptedAction{{UUID: "from-snapshot", Action: state.Action{ProcessAfter: 1}}},
+			}, nil)
+		}
+		req, err := http.NewRequest("GET", "/api/action/store?at=2025-04-01T12:00:00Z", nil)
+		require.Nil(t, err)
+		w := httptest.NewRecorder()
+
+		listActionsHandler(s, time.Hour)(w, req)
+		require.Equal(t, test.expectedCode, w.Code)
+		require.Contains(t, w.Body.String(), test.expectedResponse)
+		s.AssertExpectations(t)
+	}
+}
+
+func TestExportDecryptedActionsHandler(t *testing.T) {
+	tests := []struct {
+		mockStateFunc    func() state.StateInterface
+		expectedResponse string
+	}{
+		{
+			mockStateFunc: func() state.StateInterface {
+				s := new(mockState)
+				s.On("GetActions").Return([]*state.EncryptedAction{})
+				return s
+			},
+			expectedResponse: `[]`,
+		},
+		{
+			mockStateFunc: func() state.StateInterface {
+				s := new(mockState)
+				s.On("GetActions").Return([]*state.EncryptedAction{
+					{UUID: "released", Action: state.Action{Kind: "mail", Comment: "first", Data: "encrypted"}},
+					{UUID: "locked", Action: state.Action{Kind: "bulksms", Data: "encrypted"}},
+					{UUID: "broken", Action: state.Action{Kind: "mail", Data: "encrypted"}},
+					{UUID: "processed", Action: state.Action{Kind: "mail", Data: "encrypted"}, Processed: 2},
+				})
+				s.On("DecryptAction", "released").Return(&state.Action{Kind: "mail", Data: `{"message":"test"}`}, nil)
+				s.On("DecryptAction", "locked").Return(nil, fmt.Errorf("%w: locked", state.ErrKeyNotReleased))
+				s.On("DecryptAction", "broken").Return(nil, fmt.Errorf("unable to get vault data, status code 500"))
+				return s
+			},
+			expectedResponse: `[
+				{"uuid":"released","kind":"mail","comment":"first","data":"{\"message\":\"test\"}","status":200},
+				{"uuid":"locked","kind":"bulksms","comment":"","status":423,"error":"vault key is not released: locked"},
+				{"uuid":"broken","kind":"mail","comment":"","status":500},
+				{"uuid":"processed","kind":"mail","comment":"","status":410,"error":"vault key was deleted after action run"}
+			]`,
+		},
+	}
+	for _, test := range tests {
+		req, err := http.NewRequest("GET", "/api/action/export/decrypted", nil)
+		require.Nil(t, err)
+		w := httptest.NewRecorder()
+		s := test.mockStateFunc()
+
+		exportDecryptedActionsHandler(s)(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Equal(t, "application/json", w.Header().Get("Content-Type"))
+		require.JSONEq(t, test.expectedResponse, w.Body.String())
+		s.(*mockState).AssertNotCalled(t, "DecryptAction", "processed")
+	}
+}
+
+func TestAddActionRequestBind(t *testing.T) {
+	pastDeadline := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	futureDeadline := time.Date(2999, 1, 1, 0, 0, 0, 0, time.UTC)
+	// 2999-05-01T00:00:00 in Europe/Warsaw (CEST).
+	localDeadline := time.Date(2999, 4, 30, 22, 0, 0, 0, time.UTC)
+	soonDeadline := time.Now().Add(30 * time.Second).UTC().Truncate(time.Second)
+	tests := []struct {
+		payload       string
+		expectedError error
+		expectedReq   *addTestActionRequest
+	}{
+		{
+			payload:       `{"kind": "", "data": "test", "process_after": 10}`,
+			expectedError: state.ValidationError{fmt.Errorf("kind is required")},
+			expectedReq: &addTestActionRequest{
+				Kind:         "",
+				Data:         "test",
+				ProcessAfter: 10,
+			},
+		},
+		{
+			payload: `{"kind": "bulksms", "data": "{\"message\":\"test\",\"destination\":[\"111\"]}", "process_after": 10, "min_interval": 0}`,
+			expectedReq: &addTestActionRequest{
+				Kind:         "bulksms",
+				Data:         "{\"message\":\"test\",\"destination\":[\"111\"]}",
+				ProcessAfter: 10,
+				MinInterval:  0,
+			},
+		},
+		{
+			payload: `{"kind": "bulksms", "data": "{\"message\":\"test\",\"destination\":[\"111\"]}", "process_after": 10, "min_interval": 10}`,
+			expectedReq: &addTestActionRequest{
+				Kind:         "bulksms",
+				Data:         "{\"message\":\"test\",\"destination\":[\"111\"]}",
+				ProcessAfter: 10,
+				MinInterval:  10,
+			},
+		},
+		{
+			payload:       `{"kind": "bulksms", "data": "{\"message\":\"test\",\"destination\":[\"111\"]}", "process_after": 10, "process_unit": "day"}`,
+			expectedError: state.ValidationError{fmt.Errorf("process_unit should be one of second, minute, hour")},
+			expectedReq: &addTestActionRequest{
+				Kind:         "bulksms",
+				Data:         "{\"message\":\"test\",\"destination\":[\"111\"]}",
+				ProcessAfter: 10,
+				ProcessUnit:  "day",
+			},
+		},
+		{
+			payload: `{"kind": "bulksms", "data": "{\"message\":\"test\",\"destination\":[\"111\"]}", "process_after": 10, "process_unit": "minute"}`,
+			expectedReq: &addTestActionRequest{
+				Kind:         "bulksms",
+				Data:         "{\"message\":\"test\",\"destination\":[\"111\"]}",
+				ProcessAfter: 10,
+				ProcessUnit:  "minute",
+			},
+		},
+		{
+			payload:       `{"kind": "bulksms", "data": "{\"message\":\"test\",\"destination\":[\"111\"]}", "process_after": 10, "deadline": "2020-01-01T00:00:00Z"}`,
+			expectedError: state.ValidationError{fmt.Errorf("deadline should be in the future (at least 1m0s from now)")},
+			expectedReq: &addTestActionRequest{
+				Kind:         "bulksms",
+				Data:         "{\"message\":\"test\",\"destination\":[\"111\"]}",
+				ProcessAfter: 10,
+				Deadline:     &pastDeadline,
+			},
+		},
+		{
+			payload:       fmt.Sprintf(`{"kind": "bulksms", "data": "{\"message\":\"test\",\"destination\":[\"111\"]}", "process_after": 10, "deadline": "%s"}`, soonDeadline.Format(time.RFC3339)),
+			expectedError: state.ValidationError{fmt.Errorf("deadline should be in the future (at least 1m0s from now)")},
+			expectedReq: &addTestActionRequest{
+				Kind:         "bulksms",
+				Data:         "{\"message\":\"test\",\"destination\":[\"111\"]}",
+				ProcessAfter: 10,
+				Deadline:     &soonDeadline,
+			},
+		},
+		{
+			payload: `{"kind": "bulksms", "data": "{\"message\":\"test\",\"destination\":[\"111\"]}", "process_after": 10, "deadline": "2999-01-01T00:00:00Z"}`,
+			expectedReq: &addTestActionRequest{
+				Kind:         "bulksms",
+				Data:         "{\"message\":\"test\",\"destination\":[\"111\"]}",
+				ProcessAfter: 10,
+				Deadline:     &futureDeadline,
+			},
+		},
+		{
+			payload: `{"kind": "bulksms", "data": "{\"message\":\"test\",\"destination\":[\"111\"]}", "process_after": 10, "not_before": "2999-01-01T00:00:00Z"}`,
+			expectedReq: &addTestActionRequest{
+				Kind:         "bulksms",
+				Data:         "{\"message\":\"test\",\"destination\":[\"111\"]}",
+				ProcessAfter: 10,
+				NotBefore:    &futureDeadline,
+			},
+		},
+		{
+			payload:       `{"kind": "bulksms", "data": "{\"message\":\"test\",\"destination\":[\"111\"]}", "process_after": 10, "deadline": "2999-01-01T00:00:00Z", "not_before": "2999-01-01T00:00:00Z"}`,
+			expectedError: state.ValidationError{fmt.Errorf("not_before should be before deadline")},
+			expectedReq: &addTestActionRequest{
+				Kind:         "bulksms",
+				Data:         "{\"message\":\"test\",\"destination\":[\"111\"]}",
+				ProcessAfter: 10,
+				Deadline:     &futureDeadline,
+				NotBefore:    &futureDeadline,
+			},
+		},
+		{
+			payload: `{"kind": "bulksms", "data": "{\"message\":\"test\",\"destination\":[\"111\"]}", "process_after": 10, "timezone": "Europe/Warsaw", "deadline": "2999-05-01T00:00:00", "not_before": "2999-01-01T00:00:00Z"}`,
+			expectedReq: &addTestActionRequest{
+				Kind:         "bulksms",
+				Data:         "{\"message\":\"test\",\"destination\":[\"111\"]}",
+				ProcessAfter: 10,
+				Timezone:     "Europe/Warsaw",
+				Deadline:     &localDeadline,
+				NotBefore:    &futureDeadline,
+			},
+		},
+		{
+			payload:       `{"kind": "bulksms", "data": "{\"message\":\"test\",\"destination\":[\"111\"]}", "process_after": 10, "timezone": "Mars/Olympus", "deadline": "2999-01-01T00:00:00Z"}`,
+			expectedError: state.ValidationError{fmt.Errorf("timezone should be valid IANA time zone name")},
+			expectedReq: &addTestActionRequest{
+				Kind:         "bulksms",
+				Data:         "{\"message\":\"test\",\"destination\":[\"111\"]}",
+				ProcessAfter: 10,
+				Timezone:     "Mars/Olympus",
+				Deadline:     &futureDeadline,
+			},
+		},
+		{
+			payload:       `{"kind": "bulksms", "data": "{\"message\":\"test\",\"destination\":[\"111\"]}", "process_after": 10, "priority": 101}`,
+			expectedError: state.ValidationError{fmt.Errorf("priority should be between -100 and 100")},
+			expectedReq: &addTestActionRequest{
+				Kind:         "bulksms",
+				Data:         "{\"message\":\"test\",\"destination\":[\"111\"]}",
+				ProcessAfter: 10,
+				Priority:     101,
+			},
+		},
+		{
+			payload: `{"kind": "bulksms", "data": "{\"message\":\"test\",\"destination\":[\"111\"]}", "process_after": 10, "priority": -5}`,
+			expectedReq: &addTestActionRequest{
+				Kind:         "bulksms",
+				Data:         "{\"message\":\"test\",\"destination\":[\"111\"]}",
+				ProcessAfter: 10,
+				Priority:     -5,
+			},
+		},
+		{
+			payload:       `{"kind": "bulksms", "data": "{\"message\":\"test\",\"destination\":[\"111\"]}", "process_after": 10, "severity": "critical"}`,
+			expectedError: state.ValidationError{fmt.Errorf("severity should be one of notify, destructive")},
+			expectedReq: &addTestActionRequest{
+				Kind:         "bulksms",
+				Data:         "{\"message\":\"test\",\"destination\":[\"111\"]}",
+				ProcessAfter: 10,
+				Severity:     "critical",
+			},
+		},
+		{
+			payload: `{"kind": "bulksms", "data": "{\"message\":\"test\",\"destination\":[\"111\"]}", "process_after": 10, "severity": "destructive"}`,
+			expectedReq: &addTestActionRequest{
+				Kind:         "bulksms",
+				Data:         "{\"message\":\"test\",\"destination\":[\"111\"]}",
+				ProcessAfter: 10,
+				Severity:     state.SeverityDestructive,
+			},
+		},
+		{
+			payload: `{"kind": "bulksms", "data": "message: test\ndestination:\n  - \"111\"\n", "data_format": "yaml", "process_after": 10}`,
+			expectedReq: &addTestActionRequest{
+				Kind:         "bulksms",
+				Data:         "{\"destination\":[\"111\"],\"message\":\"test\"}",
+				ProcessAfter: 10,
+			},
+		},
+		{
+			payload:       `{"kind": "bulksms", "data": "message: test", "data_format": "toml", "process_after": 10}`,
+			expectedError: state.ValidationError{fmt.Errorf("data_format should be one of json, yaml")},
+			expectedReq: &addTestActionRequest{
+				Kind:         "bulksms",
+				Data:         "message: test",
+				ProcessAfter: 10,
+				DataFormat:   "toml",
+			},
+		},
+		{
+			payload: `{"kind": "bulksms", "data": "message: test\ndestination:\n  - \"111\"\n", "data_format": "yaml", "process_after": 10, "fallback": {"kind": "json_post", "data": "url: https://example.com\nsuccess_code: [200]\ndata:\n  message: test\n"}}`,
+			expectedReq: &addTestActionRequest{
+				Kind:         "bulksms",
+				Data:         "{\"destination\":[\"111\"],\"message\":\"test\"}",
+				ProcessAfter: 10,
+				Fallback:     &state.Fallback{Kind: "json_post", Data: "{\"data\":{\"message\":\"test\"},\"success_code\":[200],\"url\":\"https://example.com\"}"},
+			},
+		},
+		{
+			payload:       `{"kind": "bulksms", "data": "{\"message\":\"test\",\"destination\":[\"111\"]}", "process_after": 10, "fallback": {"kind": "pigeon", "data": "{}"}}`,
+			expectedError: state.ValidationError{fmt.Errorf("fallback: %w", fmt.Errorf("unknown kind pigeon"))},
+			expectedReq: &addTestActionRequest{
+				Kind:         "bulksms",
+				Data:         "{\"message\":\"test\",\"destination\":[\"111\"]}",
+				ProcessAfter: 10,
+				Fallback:     &state.Fallback{Kind: "pigeon", Data: "{}"},
+			},
+		},
+		{
+			payload:       `{"kind": "bulksms", "data": "{\"message\":\"test\",\"destination\":[\"111\"]}", "process_after": 10, "fallback": {"kind": "json_post"}}`,
+			expectedError: state.ValidationError{fmt.Errorf("fallback.data is required")},
+			expectedReq: &addTestActionRequest{
+				Kind:         "bulksms",
+				Data:         "{\"message\":\"test\",\"destination\":[\"111\"]}",
+				ProcessAfter: 10,
+				Fallback:     &state.Fallback{Kind: "json_post"},
+			},
+		},
+		{
+			payload: `{"kind": "bulksms", "data": "{\"message\":\"test\",\"destination\":[\"111\"]}", "process_after": 10, "vault_url": "https://vault.example.com"}`,
+			expectedReq: &addTestActionRequest{
+				Kind:         "bulksms",
+				Data:         "{\"message\":\"test\",\"destination\":[\"111\"]}",
+				ProcessAfter: 10,
+				VaultURL:     "https://vault.example.com",
+			},
+		},
+		{
+			payload:       `{"kind": "bulksms", "data": "{\"message\":\"test\",\"destination\":[\"111\"]}", "process_after": 10, "vault_url": "vault.example.com"}`,
+			expectedError: state.ValidationError{fmt.Errorf("vault_url should be http or https URL")},
+			expectedReq: &addTestActionRequest{
+				Kind:         "bulksms",
+				Data:         "{\"message\":\"test\",\"destination\":[\"111\"]}",
+				ProcessAfter: 10,
+				VaultURL:     "vault.example.com",
+			},
+		},
+		{
+			payload: `{"kind": "", "data": "test", "process_after": 0, "min_interval": -1, "deadline": "2020-01-01T00:00:00Z"}`,
+			expectedError: state.ValidationError{
+				fmt.Errorf("kind is required"),
+				fmt.Errorf("process_after should be greater than 0"),
+				fmt.Errorf("min_interval should be greater or equal 0"),
+				fmt.Errorf("deadline should be in the future (at least 1m0s from now)"),
+			},
+			expectedReq: &addTestActionRequest{
+				Data:        "test",
+				MinInterval: -1,
+				Deadline:    &pastDeadline,
+			},
+		},
+	}
+	for _, test := range tests {
+		reqBody := bytes.NewBufferString(test.payload)
+		req, err := http.NewRequest("POST", "/api/action/store", reqBody)
+		require.Nil(t, err)
+		req.Header.Set("Content-Type", "application/json")
+
+		ctx := context.WithValue(req.Context(), chi.RouteCtxKey, chi.NewRouteContext())
+		req = req.WithContext(ctx)
+
+		parsedReq := &addTestActionRequest{}
+		err = render.Bind(req, parsedReq)
+
+		require.Equal(t, test.expectedError, err)
+		require.Equal(t, test.expectedReq, parsedReq)
+	}
+}
+
+func TestAddActionRequestBindKindEnabled(t *testing.T) {
+	e, err := execute.New(&execute.Options{AllowedKinds: []string{"dummy"}})
+	require.Nil(t, err)
+	tests := []struct {
+		payload       string
+		expectedError string
+	}{
+		{
+			payload: `{"kind": "dummy", "data": "{\"message\": \"test\"}", "process_after": 10}`,
+		},
+		{
+			payload:       `{"kind": "mail", "data": "{\"message\": \"test\", \"subject\": \"test\", \"destination\": [\"a@b.com\"]}", "process_after": 10}`,
+			expectedError: `kind "mail" is not enabled`,
+		},
+		{
+			payload:       `{"kind": "dummy", "data": "{\"message\": \"test\"}", "process_after": 10, "fallback": {"kind": "bulksms", "data": "{\"message\": \"test\", \"destination\": [\"111\"]}"}}`,
+			expectedError: `fallback: kind "bulksms" is not enabled`,
+		},
+	}
+	for _, test := range tests {
+		req, err := http.NewRequest("POST", "/api/action/store", bytes.NewBufferString(test.payload))
+		require.Nil(t, err)
+		req.Header.Set("Content-Type", "application/json")
+
+		err = render.Bind(req, &addTestActionRequest{kindEnabled: e.KindEnabled})
+		if test.expectedError == "" {
+			require.Nil(t, err)
+			continue
+		}
+		require.EqualError(t, err, test.expectedError)
+		require.ErrorIs(t, err, execute.ErrKindNotEnabled)
+	}
+}
+
+func TestActionDataToJSON(t *testing.T) {
+	tests := []struct {
+		inputData             string
+		inputFormat           string
+		expectedData          string
+		expectedErrorContains string
+	}{
+		{
+			inputData:    `{"message": "test"}`,
+			expectedData: `{"message": "test"}`,
+		},
+		{
+			inputData:    `not even json`,
+			inputFormat:  "json",
+			expectedData: `not even json`,
+		},
+		{
+			inputData:    "url: https://example.com\nheaders:\n  X-Test: value\ndata:\n  nested:\n    count: 2\n",
+			inputFormat:  "yaml",
+			expectedData: `{"data":{"nested":{"count":2}},"headers":{"X-Test":"value"},"url":"https://example.com"}`,
+		},
+		{
+			inputData:    "",
+			inputFormat:  "yaml",
+			expectedData: "",
+		},
+		{
+			inputData:             "message: [test",
+			inputFormat:           "yaml",
+			expectedErrorContains: "unable to decode yaml data",
+		},
+		{
+			inputData:             "message: test",
+			inputFormat:           "xml",
+			expectedErrorContains: "data_format should be one of json, yaml",
+		},
+	}
+	for _, test := range tests {
+		data, err := actionDataToJSON(test.inputData, test.inputFormat)
+		if test.expectedErrorContains != "" {
+			require.ErrorContains(t, err, test.expectedErrorContains)
+			continue
+		}
+		require.Nil(t, err)
+		require.Equal(t, test.expectedData, data)
+	}
+}
+
+func TestValidateSigAuthScopes(t *testing.T) {
+	tests := []struct {
+		inputAuthConfig auth.Config
+		inputIdentity   *auth.Identity
+		inputData       string
+		expectedError   string
+	}{
+		{
+			inputAuthConfig: auth.Config{Enabled: false},
+			inputData:       `{"message": "/{sig_auth:alive}"}`,
+		},
+		{
+			inputAuthConfig: auth.Config{Enabled: true},
+			inputIdentity:   &auth.Identity{Name: "admin", Scopes: []string{"api"}},
+			inputData:       `{"message": "no placeholder"}`,
+		},
+		{
+			inputAuthConfig: auth.Config{Enabled: true},
+			inputIdentity:   &auth.Identity{Name: "admin", Scopes: []string{"alive"}},
+			inputData:       `{"message": "/{sig_auth:alive}"}`,
+		},
+		{
+			inputAuthConfig: auth.Config{Enabled: true},
+			inputIdentity:   &auth.Identity{Name: "admin", Scopes: []string{"api"}},
+			inputData:       `{"message": "/{sig_auth:alive}"}`,
+			expectedError:   "not allowed to sign /alive",
+		},
+		{
+			inputAuthConfig: auth.Config{Enabled: true},
+			inputData:       `{"message": "/{sig_auth:alive}"}`,
+			expectedError:   "not allowed to sign /alive",
+		},
+		{
+			inputAuthConfig: auth.Config{Enabled: true, AnonymousScopes: []string{"alive"}},
+			inputIdentity:   &auth.Identity{Name: "admin", Scopes: []string{"api"}},
+			inputData:       `{"message": "/{sig_auth:alive}"}`,
+			expectedError:   "not allowed to sign /alive",
+		},
+		{
+			inputAuthConfig: auth.Config{Enabled: true},
+			inputIdentity:   &auth.Identity{Name: "admin", Scopes: []string{"alive"}},
+			inputData:       `{"message": "/{sig_auth:alive} and /{sig_auth:metrics}"}`,
+			expectedError:   "not allowed to sign /metrics",
+		},
+		{
+			inputAuthConfig: auth.Config{Enabled: true},
+			inputIdentity:   &auth.Identity{Name: "admin", Scopes: []string{"alive", "metrics"}},
+			inputData:       `{"message": "/{sig_auth:alive} and /{sig_auth:metrics}"}`,
+		},
+		{
+			inputAuthConfig: auth.Config{Enabled: true},
+			inputIdentity:   &auth.Identity{Name: "admin", Scopes: []string{"api", "alive", "metrics"}},
+			inputData:       `{"message": "/{sig_auth:alive}"}`,
+		},
+		{
+			inputAuthConfig: auth.Config{Enabled: true},
+			inputIdentity:   &auth.Identity{Name: "admin", Scopes: []string{"api", "alive"}},
+			inputData:       `{"message": "/{sig_auth:alive} and /{sig_auth:metrics}"}`,
+			expectedError:   "not allowed to sign /metrics",
+		},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest("POST", "/api/action/store", nil)
+		if test.inputIdentity != nil {
+			req = req.WithContext(auth.ContextWithIdentity(req.Context(), test.inputIdentity))
+		}
+		err := validateSigAuthScopes(req, test.inputAuthConfig, test.inputData)
+		if test.expectedError == "" {
+			require.Nil(t, err)
+		} else {
+			require.NotNil(t, err)
+			require.Equal(t, test.expectedError, err.Error())
+		}
+	}
+}
+
+func TestAddActionHandler(t *testing.T) {
+	tests := []struct {
+		payload         string
+		mockStateFunc   func() state.StateInterface
+		inputAuthConfig auth.Config
+		inputIdentity   *auth.Identity
+		expectedCode    int
+		expectedErrCode string
+		expectedActions []*state.EncryptedAction
+	}{
+		{
+			payload: `{"kind": "bulksms", "data": "{\"message\":\"test\",\"destination\":[\"123\"]", "process_after": 10}`,
+			mockStateFunc: func() state.StateInterface {
+				s, err := state.New(&state.Options{})
+				require.Nil(t, err)
+				return s
+			},
+			expectedCode:    http.StatusBadRequest,
+			expectedErrCode: CodeInvalidPayload,
+			expectedActions: []*state.EncryptedAction{},
+		},
+		{
+			payload: `{"kind": "bulksms", "data": "{\"message\":\"test\",\"destination\":[\"123\"]}", "process_after": 10, "depends_on": ["missing"]}`,
+			mockStateFunc: func() state.StateInterface {
+				s := new(mockState)
+				s.On("GetActions").Return([]*state.EncryptedAction{{UUID: "existing"}})
+				return s
+			},
+			expectedCode:    http.StatusBadRequest,
+			expectedErrCode: CodeInvalidPayload,
+			expectedActions: []*state.EncryptedAction{{UUID: "existing"}},
+		},
+		{
+			payload: `{"kind": "bulksms", "data": "{\"message\":\"test\",\"destination\":[\"123\"]}", "process_after": 10, "depends_on": ["existing"], "depends_delay": 24}`,
+			mockStateFunc: func() state.StateInterface {
+				s := new(mockState)
+				s.On("AddAction", &state.Action{Kind: "bulksms", Data: "{\"message\":\"test\",\"destination\":[\"123\"]}", ProcessAfter: 10, DependsOn: []string{"existing"}, DependsDelay: 24}).Return("test-uuid", nil)
+				s.On("GetActions").Return([]*state.EncryptedAction{{UUID: "existing"}})
+				return s
+			},
+			expectedCode:    http.StatusCreated,
+			expectedActions: []*state.EncryptedAction{{UUID: "existing"}},
+		},
+		{
+			payload: `{"kind": "bulksms", "data": "{\"message\":\"test\",\"destination\":[\"123\"]}", "process_after": 10}`,
+			mockStateFunc: func() state.StateInterface {
+				s := new(mockState)
+				s.On("AddAction", &state.Action{Kind: "bulksms", Data: "{\"message\":\"test\",\"destination\":[\"123\"]}", ProcessAfter: 10, Comment: ""}).Return("", fmt.Errorf("mockState error"))
+				s.On("GetActions").Return([]*state.EncryptedAction{})
+				return s
+			},
+			expectedCode:    http.StatusInternalServerError,
+			expectedErrCode: CodeInternal,
+			expectedActions: []*state.EncryptedAction{},
+		},
+		{
+			payload: `{"kind": "bulksms", "data": "{\"message\":\"test\",\"destination\":[\"123\"]}", "process_after": 10}`,
+			mockStateFunc: func() state.StateInterface {
+				s := new(mockState)
+				s.On("AddAction", &state.Action{Kind: "bulksms", Data: "{\"message\":\"test\",\"destination\":[\"123\"]}", ProcessAfter: 10, Comment: ""}).Return("", fmt.Errorf("%w: mockState error", state.ErrVaultUnreachable))
+				s.On("GetActions").Return([]*state.EncryptedAction{})
+				return s
+			},
+			expectedCode:    http.StatusInternalServerError,
+			expectedErrCode: CodeVaultUnreachable,
+			expectedActions: []*state.EncryptedAction{},
+		},
+		{
+			payload: `{"kind": "bulksms", "data": "{\"message\":\"test\",\"destination\":[\"123\"]}", "process_after": 10, "comment": "lawyer"}`,
+			mockStateFunc: func() state.StateInterface {
+				s := new(mockState)
+				s.On("AddAction", &state.Action{Kind: "bulksms", Data: "{\"message\":\"test\",\"destination\":[\"123\"]}", ProcessAfter: 10, Comment: "lawyer"}).Return("", fmt.Errorf("%w: lawyer", state.ErrDuplicateComment))
+				s.On("GetActions").Return([]*state.EncryptedAction{})
+				return s
+			},
+			expectedCode:    http.StatusConflict,
+			expectedErrCode: CodeDuplicate,
+			expectedActions: []*state.EncryptedAction{},
+		},
+		{
+			payload: `{"kind": "bulksms", "data": "{\"message\":\"test\",\"destination\":[\"123\"]}", "process_after": 10, "vault_url": "https://attacker.example.com"}`,
+			mockStateFunc: func() state.StateInterface {
+				s := new(mockState)
+				s.On("AddAction", &state.Action{Kind: "bulksms", Data: "{\"message\":\"test\",\"destination\":[\"123\"]}", ProcessAfter: 10, VaultURL: "https://attacker.example.com"}).Return("", fmt.Errorf("%w: https://attacker.example.com", state.ErrVaultURLNotAllowed))
+				s.On("GetActions").Return([]*state.EncryptedAction{})
+				return s
+			},
+			expectedCode:    http.StatusBadRequest,
+			expectedErrCode: CodeInvalidPayload,
+			expectedActions: []*state.EncryptedAction{},
+		},
+		{
+			payload: `{"kind": "bulksms", "data": "{\"message\":\"test\",\"destination\":[\"123\"]}", "process_after": 10}`,
+			mockStateFunc: func() state.StateInterface {
+				s := new(mockState)
+				s.On("AddAction", &state.Action{Kind: "bulksms", Data: "{\"message\":\"test\",\"destination\":[\"123\"]}", ProcessAfter: 10}).Return("", fmt.Errorf("%w (1)", state.ErrActionLimitReached))
+				s.On("GetActions").Return([]*state.EncryptedAction{})
+				return s
+			},
+			expectedCode:    http.StatusBadRequest,
+			expectedErrCode: CodeLimitReached,
+			expectedActions: []*state.EncryptedAction{},
+		},
+		{
+			payload: `{"kind": "bulksms", "data": "{\"message\":\"test\",\"destination\":[\"123\"]}", "process_after": 10}`,
+			mockStateFunc: func() state.StateInterface {
+				s := new(mockState)
+				s.On("AddAction", &state.Action{Kind: "bulksms", Data: "{\"message\":\"test\",\"destination\":[\"123\"]}", ProcessAfter: 10, Comment: ""}).Return("test-uuid", nil)
+				s.On("GetActions").Return([]*state.EncryptedAction{
+					{Action: state.Action{Kind: "bulksms", Data: "encrypted", ProcessAfter: 10, Comment: ""}},
+				})
+				return s
+			},
+			expectedCode: http.StatusCreated,
+			expectedActions: []*state.EncryptedAction{
+				{Action: state.Action{Kind: "bulksms", Data: "encrypted", ProcessAfter: 10, Comment: ""}},
+			},
+		},
+		{
+			payload: `{"kind": "bulksms", "data": "{\"message\":\"test\",\"destination\":[\"123\"]}", "process_after": 10}`,
+			mockStateFunc: func() state.StateInterface {
+				s := new(mockState)
+				s.On("AddAction", &state.Action{Kind: "bulksms", Data: "{\"message\":\"test\",\"destination\":[\"123\"]}", ProcessAfter: 10, Comment: ""}).Return("test-uuid", nil)
+				s.On("GetActions").Return([]*state.EncryptedAction{
+					{Action: state.Action{Kind: "bulksms", Data: "encrypted", ProcessAfter: 20, Comment: ""}},
+					{Action: state.Action{Kind: "bulksms", Data: "encrypted2", ProcessAfter: 10, Comment: ""}},
+				})
+				return s
+			},
+			expectedCode: http.StatusCreated,
+			expectedActions: []*state.EncryptedAction{
+				{Action: state.Action{Kind: "bulksms", Data: "encrypted", ProcessAfter: 20, Comment: ""}},
+				{Action: state.Action{Kind: "bulksms", Data: "encrypted2", ProcessAfter: 10, Comment: ""}},
+			},
+		},
+		{
+			payload: `{"kind": "mail", "process_after": 10, "data": "{\"message\":\"/{sig_auth:alive}\",\"destination\":[\"a@b.com\"],\"subject\":\"hi\"}"}`,
+			mockStateFunc: func() state.StateInterface {
+				s := new(mockState)
+				s.On("GetActions").Return([]*state.EncryptedAction{})
+				return s
+			},
+			inputAuthConfig: auth.Config{Enabled: true},
+			inputIdentity:   &auth.Identity{Name: "admin", Scopes: []string{"api"}},
+			expectedCode:    http.StatusForbidden,
+			expectedErrCode: CodeForbidden,
+			expectedActions: []*state.EncryptedAction{},
+		},
+		{
+			payload: `{"kind": "mail", "process_after": 10, "data": "{\"message\":\"/{sig_auth:alive}\",\"destination\":[\"a@b.com\"],\"subject\":\"hi\"}"}`,
+			mockStateFunc: func() state.StateInterface {
+				s := new(mockState)
+				s.On("AddAction", &state.Action{Kind: "mail", Data: "{\"message\":\"/{sig_auth:alive}\",\"destination\":[\"a@b.com\"],\"subject\":\"hi\"}", ProcessAfter: 10, Comment: ""}).Return("test-uuid", nil)
+				s.On("GetActions").Return([]*state.EncryptedAction{
+					{Action: state.Action{Kind: "mail", Data: "encrypted", ProcessAfter: 10, Comment: ""}},
+				})
+				return s
+			},
+			inputAuthConfig: auth.Config{Enabled: true},
+			inputIdentity:   &auth.Identity{Name: "admin", Scopes: []string{"api", "alive"}},
+			expectedCode:    http.StatusCreated,
+			expectedActions: []*state.EncryptedAction{
+				{Action: state.Action{Kind: "mail", Data: "encrypted", ProcessAfter: 10, Comment: ""}},
+			},
+		},
+	}
+	for _, test := range tests {
+		reqBody := bytes.NewBufferString(test.payload)
+		req, err := http.NewRequest("POST", "/api/action/store", reqBody)
+		require.Nil(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		if test.inputIdentity != nil {
+			req = req.WithContext(auth.ContextWithIdentity(req.Context(), test.inputIdentity))
+		}
+
+		w := httptest.NewRecorder()
+		s := test.mockStateFunc()
+
+		handler := addActionHandler(s, new(mockExecute), test.inputAuthConfig, "", time.Hour, 0)
+
+		handler(w, req)
+		require.Equal(t, test.expectedCode, w.Code)
+		requireErrCode(t, test.expectedErrCode, w)
+		if test.expectedCode == http.StatusCreated {
+			require.Equal(t, "/api/action/store/test-uuid", w.Header().Get("Location"))
+		} else {
+			require.Empty(t, w.Header().Get("Location"))
+		}
+		actions := s.GetActions()
+		require.Equal(t, len(test.expectedActions), len(actions))
+		for i, ta := range test.expectedActions {
+			require.Equal(t, ta.Action.Kind, actions[i].Action.Kind)
+			require.Equal(t, ta.Action.ProcessAfter, actions[i].Action.ProcessAfter)
+			require.Equal(t, ta.Action.Comment, actions[i].Action.Comment)
+			require.Equal(t, ta.Action.Data, actions[i].Action.Data)
+		}
+	}
+}
+
+func TestAddVaultSecretRequest(t *testing.T) {
+	deadline := time.Date(2999, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		payload       string
+		expectedError error
+		expectedReq   *addVaultSecretRequest
+	}{
+		{
+			payload:       `{"key": "", "process_after": 10}`,
+			expectedError: state.ValidationError{fmt.Errorf("key must be provided")},
+			expectedReq: &addVaultSecretRequest{
+				Key:          "",
+				ProcessAfter: 10,
+			},
+		},
+		{
+			payload:       `{"key": "test", "process_after": 0}`,
+			expectedError: state.ValidationError{fmt.Errorf("process_after should be greater than 0")},
+			expectedReq: &addVaultSecretRequest{
+				Key:          "test",
+				ProcessAfter: 0,
+			},
+		},
+		{
+			payload:       `{"key": "test", "process_after": -10}`,
+			expectedError: state.ValidationError{fmt.Errorf("process_after should be greater than 0")},
+			expectedReq: &addVaultSecretRequest{
+				Key:          "test",
+				ProcessAfter: -10,
+			},
+		},
+		{
+			payload: `{"key": "test", "process_after": 15}`,
+			expectedReq: &addVaultSecretRequest{
+				Key:          "test",
+				ProcessAfter: 15,
+			},
+		},
+		{
+			payload:       `{"key": "test", "process_after": 15, "process_unit": "week"}`,
+			expectedError: state.ValidationError{fmt.Errorf("process_unit should be one of second, minute, hour")},
+			expectedReq: &addVaultSecretRequest{
+				Key:          "test",
+				ProcessAfter: 15,
+				ProcessUnit:  "week",
+			},
+		},
+		{
+			payload: `{"key": "test", "process_after": 15, "process_unit": "second"}`,
+			expectedReq: &addVaultSecretRequest{
+				Key:          "test",
+				ProcessAfter: 15,
+				ProcessUnit:  "second",
+			},
+		},
+		{
+			payload: `{"key": "", "process_after": 0, "process_unit": "week", "version": -1}`,
+			expectedError: state.ValidationError{
+				fmt.Errorf("key must be provided"),
+				fmt.Errorf("process_after should be greater than 0"),
+				fmt.Errorf("process_unit should be one of second, minute, hour"),
+				fmt.Errorf("version should not be negative"),
+			},
+			expectedReq: &addVaultSecretRequest{
+				ProcessUnit: "week",
+				Version:     -1,
+			},
+		},
+		{
+			payload: `{"key": "test", "process_after": 15, "deadline": "2999-01-01T00:00:00Z"}`,
+			expectedReq: &addVaultSecretRequest{
+				Key:          "test",
+				ProcessAfter: 15,
+				Deadline:     &deadline,
+			},
+		},
+	}
+	for _, test := range tests {
+		reqBody := bytes.NewBufferString(test.payload)
+		req, err := http.NewRequest("POST", "/api/vault/store/client-uuid/secret-uuid", reqBody)
+		require.Nil(t, err)
+		req.Header.Set("Content-Type", "application/json")
+
+		ctx := context.WithValue(req.Context(), chi.RouteCtxKey, chi.NewRouteContext())
+		req = req.WithContext(ctx)
+
+		parsedReq := &addVaultSecretRequest{}
+		err = render.Bind(req, parsedReq)
+
+		require.Equal(t, test.expectedError, err)
+		require.Equal(t, test.expectedReq, parsedReq)
+	}
+}
+
+func TestAddVaultSecretHandler(t *testing.T) {
+	tests := []struct {
+		payload         string
+		inputClientUUID string
+		inputSecretUUID string
+		mockVaultFunc   func() vault.VaultInterface
+		expectedCode    int
+		expectedErrCode string
+	}{
+		{
+			payload:         `{"key": "test", "process_after": 10}`,
+			inputClientUUID: "",
+			inputSecretUUID: "secret-uuid",
+			mockVaultFunc: func() vault.VaultInterface {
+				v := new(mockVault)
+				return v
+			},
+			expectedCode:    http.StatusBadRequest,
+			expectedErrCode: CodeInvalidPayload,
+		},
+		{
+			payload:         `{"key": "test", "process_after": 10}`,
+			inputClientUUID: "client-uuid",
+			inputSecretUUID: "",
+			mockVaultFunc: func() vault.VaultInterface {
+				v := new(mockVault)
+				return v
+			},
+			expectedCode:    http.StatusBadRequest,
+			expectedErrCode: CodeInvalidPayload,
+		},
+		{
+			payload:         `{"process_after": 10}`,
+			inputClientUUID: "client-uuid",
+			inputSecretUUID: "secret-uuid",
+			mockVaultFunc: func() vault.VaultInterface {
+				v := new(mockVault)
+				return v
+			},
+			expectedCode:    http.StatusBadRequest,
+			expectedErrCode: CodeInvalidPayload,
+		},
+		{
+			payload:         `{"key": "test", "process_after": 10}`,
+			inputClientUUID: "client-uuid",
+			inputSecretUUID: "secret-uuid",
+			mockVaultFunc: func() vault.VaultInterface {
+				v := new(mockVault)
+				v.On("AddSecret", "client-uuid", "secret-uuid", &vault.Secret{Key: "test", ProcessAfter: 10}).Return(fmt.Errorf("mockVault error"))
+				return v
+			},
+			expectedCode:    http.StatusBadRequest,
+			expectedErrCode: CodeInvalidPayload,
+		},
+		{
+			payload:         `{"key": "test", "process_after": 10}`,
+			inputClientUUID: "client-uuid",
+			inputSecretUUID: "secret-uuid",
+			mockVaultFunc: func() vault.VaultInterface {
+				v := new(mockVault)
+				v.On("AddSecret", "client-uuid", "secret-uuid", &vault.Secret{Key: "test", ProcessAfter: 10}).Return(fmt.Errorf("secret client-uuid/secret-uuid %w", vault.ErrSecretExists))
+				return v
+			},
+			expectedCode:    http.StatusBadRequest,
+			expectedErrCode: CodeDuplicate,
+		},
+		{
+			payload:         `{"key": "test", "process_after": 10}`,
+			inputClientUUID: "client-uuid",
+			inputSecretUUID: "secret-uuid",
+			mockVaultFunc: func() vault.VaultInterface {
+				v := new(mockVault)
+				v.On("AddSecret", "client-uuid", "secret-uuid", &vault.Secret{Key: "test", ProcessAfter: 10}).Return(fmt.Errorf("vault %w (1)", vault.ErrSecretLimitReached))
+				return v
+			},
+			expectedCode:    http.StatusBadRequest,
+			expectedErrCode: CodeLimitReached,
+		},
+		{
+			payload:         `{"key": "test", "process_after": 10, "version": 5}`,
+			inputClientUUID: "client-uuid",
+			inputSecretUUID: "secret-uuid",
+			mockVaultFunc: func() vault.VaultInterface {
+				v := new(mockVault)
+				v.On("AddSecret", "client-uuid", "secret-uuid", &vault.Secret{Key: "test", ProcessAfter: 10, Version: 5}).Return(fmt.Errorf("secret client-uuid/secret-uuid %w (5 <= 7)", vault.ErrSecretVersionStale))
+				return v
+			},
+			expectedCode:    http.StatusConflict,
+			expectedErrCode: CodeStaleVersion,
+		},
+		{
+			payload:         `{"key": "test", "process_after": 10, "version": -1}`,
+			inputClientUUID: "client-uuid",
+			inputSecretUUID: "secret-uuid",
+			mockVaultFunc: func() vault.VaultInterface {
+				return new(mockVault)
+			},
+			expectedCode:    http.StatusBadRequest,
+			expectedErrCode: CodeInvalidPayload,
+		},
+		{
+			payload:         `{"key": "test", "process_after": 10}`,
+			inputClientUUID: "client-uuid",
+			inputSecretUUID: "secret-uuid",
+			mockVaultFunc: func() vault.VaultInterface {
+				v := new(mockVault)
+				v.On("AddSecret", "client-uuid", "secret-uuid", &vault.Secret{Key: "test", ProcessAfter: 10}).Return(nil)
+				return v
+			},
+			expectedCode: http.StatusCreated,
+		},
+		{
+			payload:         `{"key": "test", "process_after": 10, "comment": "letter to lawyer"}`,
+			inputClientUUID: "client-uuid",
+			inputSecretUUID: "secret-uuid",
+			mockVaultFunc: func() vault.VaultInterface {
+				v := new(mockVault)
+				v.On("AddSecret", "client-uuid", "secret-uuid", &vault.Secret{Key: "test", ProcessAfter: 10, Comment: "letter to lawyer"}).Return(nil)
+				return v
+			},
+			expectedCode: http.StatusCreated,
+		},
+	}
+	for _, test := range tests {
+		reqBody := bytes.NewBufferString(test.payload)
+		req, err := http.NewRequest("POST", fmt.Sprintf("/api/vault/store/%s/%s", test.inputClientUUID, test.inputSecretUUID), reqBody)
+		require.Nil(t, err)
+		req.Header.Set("Content-Type", "application/json")
+
+		ctx := chi.NewRouteContext()
+		ctx.URLParams.Add("clientUUID", test.inputClientUUID)
+		ctx.URLParams.Add("secretUUID", test.inputSecretUUID)
+		req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, ctx))
+
+		w := httptest.NewRecorder()
+		v := test.mockVaultFunc()
+
+		handler := addVaultSecretHandler(v)
+
+		handler(w, req)
+		require.Equal(t, test.expectedCode, w.Code)
+		requireErrCode(t, test.expectedErrCode, w)
+		if test.expectedCode == http.StatusCreated {
+			require.Equal(t, "/api/vault/store/client-uuid/secret-uuid", w.Header().Get("Location"))
+		} else {
+			require.Empty(t, w.Header().Get("Location"))
+		}
+	}
+}
+
+func TestActionWarnings(t *testing.T) {
+	tests := []struct {
+		inputAction      *state.Action
+		inputDefaultUnit time.Duration
+		expectedWarnings []string
+	}{
+		{
+			inputAction:      &state.Action{ProcessAfter: 1},
+			inputDefaultUnit: time.Hour,
+		},
+		{
+			inputAction:      &state.Action{ProcessAfter: 10, ProcessUnit: "minute"},
+			inputDefaultUnit: time.Hour,
+		},
+		{
+			inputAction:      &state.Action{ProcessAfter: 9, ProcessUnit: "minute"},
+			inputDefaultUnit: time.Hour,
+			expectedWarnings: []string{"process_after is 9m0s, action will run almost immediately without check-in"},
+		},
+		{
+			inputAction:      &state.Action{ProcessAfter: 30},
+			inputDefaultUnit: time.Second,
+			expectedWarnings: []string{"process_after is 30s, action will run almost immediately without check-in"},
+		},
+	}
+	for _, test := range tests {
+		require.Equal(t, test.expectedWarnings, actionWarnings(test.inputAction, test.inputDefaultUnit))
+	}
+}
+
+func TestAddActionHandlerWarnings(t *testing.T) {
+	tests := []struct {
+		payload          string
+		expectedResponse string
+	}{
+		{
+			payload:          `{"kind": "dummy", "process_after": 10, "data": "{\"message\":\"test\"}"}`,
+			expectedResponse: `{"status":"success"}`,
+		},
+		{
+			payload:          `{"kind": "dummy", "process_after": 5, "process_unit": "second", "data": "{\"message\":\"test\"}"}`,
+			expectedResponse: `{"status":"success","warnings":["process_after is 5s, action will run almost immediately without check-in"]}`,
+		},
+	}
+	for _, test := range tests {
+		s := new(mockState)
+		s.On("AddAction", mock.Anything).Return("test-uuid", nil)
+
+		req, err := http.NewRequest("POST", "/api/action/store", bytes.NewBufferString(test.payload))
+		require.Nil(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+
+		addActionHandler(s, new(mockExecute), auth.Config{}, "", time.Hour, 0)(w, req)
+		require.Equal(t, http.StatusCreated, w.Code)
+		require.JSONEq(t, test.expectedResponse, w.Body.String())
+	}
+}
+
+func TestAddActionHandlerPassphrase(t *testing.T) {
+	tests := []struct {
+		payload         string
+		expectedCode    int
+		expectedErrCode string
+	}{
+		{
+			payload:      `{"kind": "dummy", "process_after": 10, "data": "{\"message\":\"secret\"}", "recipient_passphrase": "correct horse"}`,
+			expectedCode: http.StatusCreated,
+		},
+		{
+			payload:         `{"kind": "dummy", "process_after": 10, "data": "{\"message\":\"secret\"}", "recipient_passphrase": "short"}`,
+			expectedCode:    http.StatusBadRequest,
+			expectedErrCode: CodeInvalidPayload,
+		},
+		{
+			payload:         `{"kind": "json_post", "process_after": 10, "data": "{\"url\":\"http://example.com\"}", "recipient_passphrase": "correct horse"}`,
+			expectedCode:    http.StatusBadRequest,
+			expectedErrCode: CodeInvalidPayload,
+		},
+	}
+	for _, test := range tests {
+		var added *state.Action
+		s := new(mockState)
+		s.On("AddAction", mock.Anything).Run(func(args mock.Arguments) {
+			added = args.Get(0).(*state.Action)
+		}).Return("test-uuid", nil)
+
+		req, err := http.NewRequest("POST", "/api/action/store", bytes.NewBufferString(test.payload))
+		require.Nil(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+
+		addActionHandler(s, new(mockExecute), auth.Config{}, "", time.Hour, 0)(w, req)
+		require.Equal(t, test.expectedCode, w.Code)
+		requireErrCode(t, test.expectedErrCode, w)
+		if test.expectedCode != http.StatusCreated {
+			s.AssertNotCalled(t, "AddAction", mock.Anything)
+			continue
+		}
+		require.NotContains(t, added.Data, "secret")
+		data := map[string]string{}
+		require.Nil(t, json.Unmarshal([]byte(added.Data), &data))
+		decrypted, err := crypt.DecryptPassphrase(data["message"], "correct horse")
+		require.Nil(t, err)
+		require.Equal(t, "secret", decrypted)
+	}
+}
+
+func TestAddActionHandlerReceipt(t *testing.T) {
+	defer func() { newReceiptToken = crypt.NewBearerToken }()
+
+	tests := []struct {
+		payload          string
+		inputVerifyURL   string
+		mockReceiptToken func() (crypt.BearerToken, error)
+		expectedCode     int
+		expectedErrCode  string
+		expectedData     string
+		expectedFallback string
+	}{
+		{
+			payload:         `{"kind": "dummy", "process_after": 10, "data": "{\"message\":\"test\"}", "receipt": true}`,
+			expectedCode:    http.StatusBadRequest,
+			expectedErrCode: CodeInvalidPayload,
+		},
+		{
+			payload:         `{"kind": "dummy", "process_after": 10, "data": "{\"message\":\"open {receipt_url}\"}", "receipt": true}`,
+			expectedCode:    http.StatusBadRequest,
+			expectedErrCode: CodeInvalidPayload,
+		},
+		{
+			payload: `{"kind": "dummy", "process_after": 10, "data": "{\"message\":\"ack {receipt_token}\"}", "receipt": true}`,
+			mockReceiptToken: func() (crypt.BearerToken, error) {
+				return crypt.BearerToken{}, fmt.Errorf("mock error")
+			},
+			expectedCode:    http.StatusInternalServerError,
+			expectedErrCode: CodeInternal,
+		},
+		{
+			payload:      `{"kind": "dummy", "process_after": 10, "data": "{\"message\":\"ack {receipt_token}\"}", "receipt": true}`,
+			expectedCode: http.StatusCreated,
+			expectedData: `{"message":"ack receipt-token"}`,
+		},
+		{
+			payload:          `{"kind": "dummy", "process_after": 10, "data": "{\"message\":\"open {receipt_url}\"}", "fallback": {"kind": "dummy", "data": "{\"message\":\"{receipt_token}\"}"}, "receipt": true}`,
+			inputVerifyURL:   "https://dmh.example.com",
+			expectedCode:     http.StatusCreated,
+			expectedData:     `{"message":"open https://dmh.example.com/api/receipt/receipt-token"}`,
+			expectedFallback: `{"message":"receipt-token"}`,
+		},
+		{
+			payload:      `{"kind": "dummy", "process_after": 10, "data": "{\"message\":\"ack {receipt_token}\"}"}`,
+			expectedCode: http.StatusCreated,
+			expectedData: `{"message":"ack {receipt_token}"}`,
+		},
+	}
+	for _, test := range tests {
+		newReceiptToken = func() (crypt.BearerToken, error) {
+			return crypt.BearerToken{Plaintext: "receipt-token"}, nil
+		}
+		if test.mockReceiptToken != nil {
+			newReceiptToken = test.mockReceiptToken
+		}
+		var added *state.Action
+		s := new(mockState)
+		s.On("GetActions").Return([]*state.EncryptedAction{})
+		s.On("AddAction", mock.Anything).Run(func(args mock.Arguments) {
+			added = args.Get(0).(*state.Action)
+		}).Return("test-uuid", nil)
+
+		req, err := http.NewRequest("POST", "/api/action/store", bytes.NewBufferString(test.payload))
+		require.Nil(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+
+		addActionHandler(s, new(mockExecute), auth.Config{}, test.inputVerifyURL, time.Hour, 0)(w, req)
+		require.Equal(t, test.expectedCode, w.Code)
+		requireErrCode(t, test.expectedErrCode, w)
+		if test.expectedCode != http.StatusCreated {
+			s.AssertNotCalled(t, "AddAction", mock.Anything)
+			continue
+		}
+		require.Equal(t, test.expectedData, added.Data)
+		if test.expectedFallback != "" {
+			require.Equal(t, test.expectedFallback, added.Fallback.Data)
+		}
+		if strings.Contains(test.payload, `"receipt": true`) {
+			require.Equal(t, "receipt-token", added.ReceiptToken)
+		} else {
+			require.Empty(t, added.ReceiptToken)
+		}
+	}
+}
+
+func TestReceiptHandler(t *testing.T) {
+	tests := []struct {
+		mockError       error
+		expectedCode    int
+		expectedErrCode string
+	}{
+		{
+			expectedCode: http.StatusOK,
+		},
+		{
+			mockError:       state.ErrReceiptTokenNotFound,
+			expectedCode:    http.StatusNotFound,
+			expectedErrCode: CodeNotFound,
+		},
+		{
+			mockError:       fmt.Errorf("mock error"),
+			expectedCode:    http.StatusInternalServerError,
+			expectedErrCode: CodeInternal,
+		},
+	}
+	for _, test := range tests {
+		s := new(mockState)
+		s.On("AcknowledgeReceipt", "receipt-token").Return("test-uuid", test.mockError)
+
+		req, err := http.NewRequest("POST", "/api/receipt/receipt-token", nil)
+		require.Nil(t, err)
+		ctx := chi.NewRouteContext()
+		ctx.URLParams.Add("token", "receipt-token")
+		req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, ctx))
+
+		w := httptest.NewRecorder()
+		receiptHandler(s)(w, req)
+		require.Equal(t, test.expectedCode, w.Code)
+		requireErrCode(t, test.expectedErrCode, w)
+	}
+}
+
+func TestAddActionHandlerVerify(t *testing.T) {
+	defer func() { newVerifyToken = crypt.NewBearerToken }()
+	newVerifyToken = func() (crypt.BearerToken, error) {
+		return crypt.BearerToken{Plaintext: "verify-token"}, nil
+	}
+
+	payload := `{"kind": "dummy", "process_after": 10, "data": "{\"message\":\"test\"}", "verify": true}`
+	action := &state.Action{Kind: "dummy", Data: `{"message":"test"}`, ProcessAfter: 10}
+	link := "https://dmh.example.com/api/action/verify/verify-token"
+	tests := []struct {
+		inputVerifyURL     string
+		mockStateFunc      func() *mockState
+		mockExecuteFunc    func() *mockExecute
+		mockVerifyToken    func() (crypt.BearerToken, error)
+		expectedCode       int
+		expectedErrCode    string
+		expectedUnverified bool
+	}{
+		{
+			mockStateFunc:   func() *mockState { return new(mockState) },
+			mockExecuteFunc: func() *mockExecute { return new(mockExecute) },
+			expectedCode:    http.StatusBadRequest,
+			expectedErrCode: CodeInvalidPayload,
+		},
+		{
+			inputVerifyURL:  "https://dmh.example.com",
+			mockStateFunc:   func() *mockState { return new(mockState) },
+			mockExecuteFunc: func() *mockExecute { return new(mockExecute) },
+			mockVerifyToken: func() (crypt.BearerToken, error) {
+				return crypt.BearerToken{}, fmt.Errorf("mock error")
+			},
+			expectedCode:    http.StatusInternalServerError,
+			expectedErrCode: CodeInternal,
+		},
+		{
+			inputVerifyURL: "https://dmh.example.com",
+			mockStateFunc:  func() *mockState { return new(mockState) },
+			mockExecuteFunc: func() *mockExecute {
+				e := new(mockExecute)
+				e.On("RunVerification", mock.Anything, action, link).Return(fmt.Errorf("kind dummy does not support verification"))
+				return e
+			},
+			expectedCode:    http.StatusBadRequest,
+			expectedErrCode: CodeActionFailed,
+		},
+		{
+			inputVerifyURL: "https://dmh.example.com",
+			mockStateFunc: func() *mockState {
+				s := new(mockState)
+				s.On("AddUnverifiedAction", action, "verify-token").Return("", state.ErrVaultUnreachable)
+				return s
+			},
+			mockExecuteFunc: func() *mockExecute {
+				e := new(mockExecute)
+				e.On("RunVerification", mock.Anything, action, link).Return(nil)
+				return e
+			},
+			expectedCode:       http.StatusInternalServerError,
+			expectedErrCode:    CodeVaultUnreachable,
+			expectedUnverified: true,
+		},
+		{
+			inputVerifyURL: "https://dmh.example.com/",
+			mockStateFunc: func() *mockState {
+				s := new(mockState)
+				s.On("AddUnverifiedAction", action, "verify-token").Return("test-uuid", nil)
+				return s
+			},
+			mockExecuteFunc: func() *mockExecute {
+				e := new(mockExecute)
+				e.On("RunVerification", mock.Anything, action, link).Return(nil)
+				return e
+			},
+			expectedCode:       http.StatusCreated,
+			expectedUnverified: true,
+		},
+	}
+	for _, test := range tests {
+		newVerifyToken = func() (crypt.BearerToken, error) {
+			return crypt.BearerToken{Plaintext: "verify-token"}, nil
+		}
+		if test.mockVerifyToken != nil {
+			newVerifyToken = test.mockVerifyToken
+		}
+		req, err := http.NewRequest("POST", "/api/action/store", bytes.NewBufferString(payload))
+		require.Nil(t, err)
+		req.Header.Set("Content-Type", "application/json")
+
+		w := httptest.NewRecorder()
+		s := test.mockStateFunc()
+		e := test.mockExecuteFunc()
+
+		addActionHandler(s, e, auth.Config{}, test.inputVerifyURL, time.Hour, 0)(w, req)
+		require.Equal(t, test.expectedCode, w.Code)
+		requireErrCode(t, test.expectedErrCode, w)
+		s.AssertNotCalled(t, "AddAction", mock.Anything)
+		if test.expectedUnverified {
+			s.AssertCalled(t, "AddUnverifiedAction", action, "verify-token")
+		} else {
+			s.AssertNotCalled(t, "AddUnverifiedAction", mock.Anything, mock.Anything)
+		}
+	}
+}
+
+func TestVerifyActionHandler(t *testing.T) {
+	tests := []struct {
+		mockError       error
+		expectedCode    int
+		expectedErrCode string
+	}{
+		{
+			expectedCode: http.StatusOK,
+		},
+		{
+			mockError:       state.ErrVerifyTokenNotFound,
+			expectedCode:    http.StatusNotFound,
+			expectedErrCode: CodeNotFound,
+		},
+		{
+			mockError:       fmt.Errorf("mock error"),
+			expectedCode:    http.StatusInternalServerError,
+			expectedErrCode: CodeInternal,
+		},
+	}
+	for _, test := range tests {
+		s := new(mockState)
+		s.On("VerifyAction", "verify-token").Return("test-uuid", test.mockError)
+
+		req, err := http.NewRequest("GET", "/api/action/verify/verify-token", nil)
+		require.Nil(t, err)
+		ctx := chi.NewRouteContext()
+		ctx.URLParams.Add("token", "verify-token")
+		req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, ctx))
+
+		w := httptest.NewRecorder()
+		verifyActionHandler(s)(w, req)
+		require.Equal(t, test.expectedCode, w.Code)
+		requireErrCode(t, test.expectedErrCode, w)
+	}
+}
+
+func TestGetActionHandler(t *testing.T) {
+	tests := []struct {
+		actionUUID       string
+		mockStateFunc    func() state.StateInterface
+		expectedCode     int
+		expectedErrCode  string
+		expectedResponse *state.EncryptedAction
+	}{
+		{
+			actionUUID: "",
+			mockStateFunc: func() state.StateInterface {
+				s := new(mockState)
+				s.On("GetAction", "").Return(nil, -1)
+				return s
+			},
+			expectedCode:    http.StatusNotFound,
+			expectedErrCode: CodeNotFound,
+		},
+		{
+			actionUUID: "test",
+			mockStateFunc: func() state.StateInterface {
+				s := new(mockState)
+				s.On("GetAction", "test").Return(nil, -1)
+				return s
+			},
+			expectedCode:    http.StatusNotFound,
+			expectedErrCode: CodeNotFound,
+		},
+		{
+			actionUUID: "test",
+			mockStateFunc: func() state.StateInterface {
+				s := new(mockState)
+				s.On("GetAction", "test").Return(&state.EncryptedAction{UUID: "test", Action: state.Action{Kind: "mail", Data: "encrypted", ProcessAfter: 10}}, 0)
+				return s
+			},
+			expectedCode:     http.StatusOK,
+			expectedResponse: &state.EncryptedAction{UUID: "test", Action: state.Action{Kind: "mail", Data: "encrypted", ProcessAfter: 10}},
+		},
+	}
+	for _, test := range tests {
+		req, err := http.NewRequest("GET", fmt.Sprintf("/api/action/store/%s", test.actionUUID), nil)
+		require.Nil(t, err)
+
+		ctx := chi.NewRouteContext()
+		ctx.URLParams.Add("actionUUID", test.actionUUID)
+		req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, ctx))
+
+		w := httptest.NewRecorder()
+		s := test.mockStateFunc()
+		s.(*mockState).On("GetLastSeen").Return(time.Now()).Maybe()
+		s.(*mockState).On("GetMaintenance").Return(nil).Maybe()
+
+		handler := getActionHandler(s, time.Hour)
+
+		handler(w, req)
+		require.Equal(t, test.expectedCode, w.Code)
+		requireErrCode(t, test.expectedErrCode, w)
+
+		contentType := w.Header().Get("Content-Type")
+		require.Equal(t, "application/json", contentType)
+
+		if test.expectedCode < 300 {
+			var response *state.EncryptedAction
+			err = json.Unmarshal(w.Body.Bytes(), &response)
+			require.Nil(t, err)
+			require.Equal(t, test.expectedResponse, response)
+		}
+
+	}
+}
+
+func TestGetVaultSecretHandler(t *testing.T) {
+	tests := []struct {
+		inputClientUUID      string
+		inputSecretUUID      string
+		inputMethod          string
+		mockVaultFunc        func() vault.VaultInterface
+		expectedCode         int
+		expectedErrCode      string
+		expectedResponse     *vault.Secret
+		expectedRetryAfter   string
+		expectedBody         string
+		expectedProcessAfter string
+	}{
+		{
+			inputClientUUID: "client-uuid",
+			inputSecretUUID: "secret-uuid",
+			inputMethod:     "GET",
+			mockVaultFunc: func() vault.VaultInterface {
+				v := new(mockVault)
+				v.On("GetSecret", "client-uuid", "secret-uuid").Return(nil, fmt.Errorf("mockVault error"))
+				return v
+			},
+			expectedCode:    http.StatusNotFound,
+			expectedErrCode: CodeNotFound,
+		},
+		{
+			inputClientUUID: "client-uuid",
+			inputSecretUUID: "secret-uuid",
+			inputMethod:     "HEAD",
+			mockVaultFunc: func() vault.VaultInterface {
+				v := new(mockVault)
+				v.On("GetSecretMeta", "client-uuid", "secret-uuid").Return(nil, fmt.Errorf("mockVault error"))
+				v.On("GetSecretStatus", "client-uuid", "secret-uuid").Return(nil, fmt.Errorf("mockVault error"))
+				return v
+			},
+			expectedCode:    http.StatusNotFound,
+			expectedErrCode: CodeNotFound,
+		},
+		{
+			inputClientUUID: "client-uuid",
+			inputSecretUUID: "secret-uuid",
+			inputMethod:     "GET",
+			mockVaultFunc: func() vault.VaultInterface {
+				v := new(mockVault)
+				v.On("GetSecret", "client-uuid", "secret-uuid").Return(nil, fmt.Errorf("secret client-uuid/secret-uuid %w", vault.ErrSecretNotReleased))
+				return v
 			},
-			expectedCode: http.StatusBadRequest,
+			expectedCode:     http.StatusLocked,
+			expectedErrCode:  CodeLocked,
+			expectedResponse: nil,
 		},
 		{
-			payload: `{"kind": "bulksms", "process_after": 10, "data": "{\"message\": \"test\", \"destination\": [\"1111\"]}"}`,
-			mockExecuteFunc: func() execute.ExecuteInterface {
-				e := new(mockExecute)
-				e.On("Run", &state.Action{Kind: "bulksms", Data: "{\"message\": \"test\", \"destination\": [\"1111\"]}", ProcessAfter: 10}).Return(fmt.Errorf("mockExecuteFunc error"))
-				return e
+			inputClientUUID: "client-uuid",
+			inputSecretUUID: "secret-uuid",
+			inputMethod:     "HEAD",
+			mockVaultFunc: func() vault.VaultInterface {
+				v := new(mockVault)
+				v.On("GetSecretMeta", "client-uuid", "secret-uuid").Return(&vault.Secret{ProcessAfter: 5}, nil)
+				v.On("GetSecretStatus", "client-uuid", "secret-uuid").Return(&vault.SecretStatus{SecondsUntilRelease: 30}, nil)
+				return v
 			},
-			expectedCode: http.StatusBadRequest,
+			expectedProcessAfter: "5",
+			expectedCode:         http.StatusLocked,
+			expectedErrCode:      CodeLocked,
+			expectedResponse:     nil,
+			expectedRetryAfter:   "30",
+			expectedBody:         `{"status":"Resource is locked.","code":"locked","seconds_until_release":30}`,
 		},
 		{
-			payload: `{"kind": "bulksms", "process_after": 5, "data": "{\"message\": \"test\", \"destination\": [\"1111\"]}"}`,
-			mockExecuteFunc: func() execute.ExecuteInterface {
-				e := new(mockExecute)
-				e.On("Run", &state.Action{Kind: "bulksms", Data: "{\"message\": \"test\", \"destination\": [\"1111\"]}", ProcessAfter: 5}).Return(nil)
-				return e
+			inputClientUUID: "client-uuid",
+			inputSecretUUID: "secret-uuid",
+			inputMethod:     "GET",
+			mockVaultFunc: func() vault.VaultInterface {
+				v := new(mockVault)
+				v.On("GetSecret", "client-uuid", "secret-uuid").Return(nil, &vault.NotReleasedError{ClientUUID: "client-uuid", SecretUUID: "secret-uuid", Remaining: 90500 * time.Millisecond})
+				return v
 			},
-			expectedCode: http.StatusOK,
+			expectedCode:       http.StatusLocked,
+			expectedErrCode:    CodeLocked,
+			expectedRetryAfter: "91",
+			expectedBody:       `{"status":"Resource is locked.","code":"locked","seconds_until_release":91}`,
 		},
 		{
-			payload: `{"kind": "mail", "process_after": 10, "data": "{\"message\": \"/{sig_auth:alive}\", \"destination\": [\"a@b.com\"], \"subject\": \"hi\"}"}`,
-			mockExecuteFunc: func() execute.ExecuteInterface {
-				return new(mockExecute)
+			inputClientUUID: "client-uuid",
+			inputSecretUUID: "secret-uuid",
+			inputMethod:     "GET",
+			mockVaultFunc: func() vault.VaultInterface {
+				v := new(mockVault)
+				v.On("GetSecret", "client-uuid", "secret-uuid").Return(nil, &vault.NotReleasedError{ClientUUID: "client-uuid", SecretUUID: "secret-uuid"})
+				return v
 			},
-			inputAuthConfig: auth.Config{Enabled: true},
-			inputIdentity:   &auth.Identity{Name: "admin", Scopes: []string{"api"}},
-			expectedCode:    http.StatusForbidden,
+			expectedCode:       http.StatusLocked,
+			expectedErrCode:    CodeLocked,
+			expectedRetryAfter: "1",
+			expectedBody:       `{"status":"Resource is locked.","code":"locked","seconds_until_release":1}`,
 		},
 		{
-			payload: `{"kind": "mail", "process_after": 5, "data": "{\"message\": \"/{sig_auth:alive}\", \"destination\": [\"a@b.com\"], \"subject\": \"hi\"}"}`,
-			mockExecuteFunc: func() execute.ExecuteInterface {
-				e := new(mockExecute)
-				e.On("Run", &state.Action{Kind: "mail", Data: "{\"message\": \"/{sig_auth:alive}\", \"destination\": [\"a@b.com\"], \"subject\": \"hi\"}", ProcessAfter: 5}).Return(nil)
-				return e
+			inputClientUUID: "client-uuid",
+			inputSecretUUID: "secret-uuid",
+			inputMethod:     "GET",
+			mockVaultFunc: func() vault.VaultInterface {
+				v := new(mockVault)
+				v.On("GetSecret", "client-uuid", "secret-uuid").Return(&vault.Secret{Key: "test", ProcessAfter: 10}, nil)
+				return v
 			},
-			inputAuthConfig: auth.Config{Enabled: true},
-			inputIdentity:   &auth.Identity{Name: "admin", Scopes: []string{"api", "alive"}},
-			expectedCode:    http.StatusOK,
+			expectedCode:     http.StatusOK,
+			expectedResponse: &vault.Secret{Key: "test", ProcessAfter: 10},
+		},
+		{
+			inputClientUUID: "client-uuid",
+			inputSecretUUID: "secret-uuid",
+			inputMethod:     "HEAD",
+			mockVaultFunc: func() vault.VaultInterface {
+				v := new(mockVault)
+				v.On("GetSecretMeta", "client-uuid", "secret-uuid").Return(&vault.Secret{ProcessAfter: 10}, nil)
+				v.On("GetSecretStatus", "client-uuid", "secret-uuid").Return(&vault.SecretStatus{Released: true}, nil)
+				return v
+			},
+			expectedCode:         http.StatusOK,
+			expectedProcessAfter: "10",
 		},
 	}
 	for _, test := range tests {
-		reqBody := bytes.NewBufferString(test.payload)
-		req, err := http.NewRequest("POST", "/api/action/test", reqBody)
+		req, err := http.NewRequest(test.inputMethod, fmt.Sprintf("/api/vault/store/%s/%s", test.inputClientUUID, test.inputSecretUUID), nil)
 		require.Nil(t, err)
-		req.Header.Set("Content-Type", "application/json")
-		if test.inputIdentity != nil {
-			req = req.WithContext(auth.ContextWithIdentity(req.Context(), test.inputIdentity))
-		}
+
+		ctx := chi.NewRouteContext()
+		ctx.URLParams.Add("clientUUID", test.inputClientUUID)
+		ctx.URLParams.Add("secretUUID", test.inputSecretUUID)
+		req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, ctx))
 
 		w := httptest.NewRecorder()
-		e := test.mockExecuteFunc()
+		v := test.mockVaultFunc()
 
-		handler := testActionHandler(e, test.inputAuthConfig)
+		handler := getVaultSecretHandler(v)
 
 		handler(w, req)
 		require.Equal(t, test.expectedCode, w.Code)
+		requireErrCode(t, test.expectedErrCode, w)
+		require.Equal(t, test.expectedRetryAfter, w.Header().Get("Retry-After"))
+		require.Equal(t, test.expectedProcessAfter, w.Header().Get(vault.ProcessAfterHeader))
+		if test.expectedBody != "" {
+			require.JSONEq(t, test.expectedBody, w.Body.String())
+		}
+
+		contentType := w.Header().Get("Content-Type")
+		require.Equal(t, "application/json", contentType)
+
+		if test.expectedCode < 300 {
+			if test.inputMethod == "HEAD" {
+				require.JSONEq(t, `{"status":"success"}`, w.Body.String())
+			} else {
+				var response *vault.Secret
+				err = json.Unmarshal(w.Body.Bytes(), &response)
+				require.Nil(t, err)
+				require.Equal(t, test.expectedResponse, response)
+			}
+		}
+
 	}
 }
 
-func TestListActionsHandler(t *testing.T) {
+func TestGetVaultSecretHandlerWrap(t *testing.T) {
+	unwrap, err := crypt.NewAge("")
+	require.Nil(t, err)
+
 	tests := []struct {
-		mockStateFunc    func() state.StateInterface
-		expectedCode     int
-		expectedResponse []*state.EncryptedAction
+		inputMethod        string
+		inputRecipient     string
+		expectedCode       int
+		expectedErrCode    string
+		expectedGetSecrets int
 	}{
 		{
-			mockStateFunc: func() state.StateInterface {
-				s := new(mockState)
-				s.On("GetActions").Return([]*state.EncryptedAction{})
-				return s
-			},
-			expectedCode:     http.StatusOK,
-			expectedResponse: []*state.EncryptedAction{},
+			inputMethod:     "GET",
+			inputRecipient:  "age1broken",
+			expectedCode:    http.StatusBadRequest,
+			expectedErrCode: CodeInvalidPayload,
 		},
 		{
-			mockStateFunc: func() state.StateInterface {
-				s := new(mockState)
-				s.On("GetActions").Return([]*state.EncryptedAction{
-					{UUID: "test1", Action: state.Action{}},
-					{UUID: "test2", Action: state.Action{}},
-				})
-				return s
-			},
-			expectedCode: http.StatusOK,
-			expectedResponse: []*state.EncryptedAction{
-				{UUID: "test1", Action: state.Action{}},
-				{UUID: "test2", Action: state.Action{}},
-			},
+			inputMethod:        "GET",
+			inputRecipient:     unwrap.GetPublicKey(),
+			expectedCode:       http.StatusOK,
+			expectedGetSecrets: 1,
+		},
+		{
+			inputMethod:    "HEAD",
+			inputRecipient: unwrap.GetPublicKey(),
+			expectedCode:   http.StatusOK,
 		},
 	}
 	for _, test := range tests {
-		req, err := http.NewRequest("GET", "/api/action/store", nil)
+		req, err := http.NewRequest(test.inputMethod, "/api/vault/store/client-uuid/secret-uuid", nil)
 		require.Nil(t, err)
-		w := httptest.NewRecorder()
+		req.Header.Set(vault.WrapRecipientHeader, test.inputRecipient)
 
-		s := test.mockStateFunc()
+		ctx := chi.NewRouteContext()
+		ctx.URLParams.Add("clientUUID", "client-uuid")
+		ctx.URLParams.Add("secretUUID", "secret-uuid")
+		req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, ctx))
 
-		handler := listActionsHandler(s)
+		w := httptest.NewRecorder()
+		v := new(mockVault)
+		v.On("GetSecret", "client-uuid", "secret-uuid").Return(&vault.Secret{Key: "test", ProcessAfter: 10, EncryptionMeta: vault.EncryptionMeta{Kind: crypt.EncryptionKind}}, nil)
+		v.On("GetSecretMeta", "client-uuid", "secret-uuid").Return(&vault.Secret{ProcessAfter: 10}, nil)
+		v.On("GetSecretStatus", "client-uuid", "secret-uuid").Return(&vault.SecretStatus{Released: true}, nil)
 
-		handler(w, req)
+		getVaultSecretHandler(v)(w, req)
 		require.Equal(t, test.expectedCode, w.Code)
+		requireErrCode(t, test.expectedErrCode, w)
+		v.AssertNumberOfCalls(t, "GetSecret", test.expectedGetSecrets)
 
-		contentType := w.Header().Get("Content-Type")
-		require.Equal(t, "application/json", contentType)
-
-		var response []*state.EncryptedAction
-		err = json.Unmarshal(w.Body.Bytes(), &response)
-		require.Nil(t, err)
-		require.Equal(t, test.expectedResponse, response)
+		if test.inputMethod == "GET" && test.expectedCode == http.StatusOK {
+			var response *vault.Secret
+			require.Nil(t, json.Unmarshal(w.Body.Bytes(), &response))
+			require.Equal(t, crypt.WrapEncryptionKind, response.EncryptionMeta.Kind)
+			require.NotEqual(t, "test", response.Key)
+			key, err := unwrap.Decrypt(response.Key)
+			require.Nil(t, err)
+			require.Equal(t, "test", key)
+		}
 	}
 }
 
-func TestAddActionRequestBind(t *testing.T) {
+func TestVaultInfoHandler(t *testing.T) {
 	tests := []struct {
-		payload       string
-		expectedError error
-		expectedReq   *addTestActionRequest
+		inputUnit    time.Duration
+		expectedBody string
 	}{
 		{
-			payload:       `{"kind": "", "data": "test", "process_after": 10}`,
-			expectedError: fmt.Errorf("kind is required"),
-			expectedReq: &addTestActionRequest{
-				Kind:         "",
-				Data:         "test",
-				ProcessAfter: 10,
-			},
-		},
-		{
-			payload: `{"kind": "bulksms", "data": "{\"message\":\"test\",\"destination\":[\"111\"]}", "process_after": 10, "min_interval": 0}`,
-			expectedReq: &addTestActionRequest{
-				Kind:         "bulksms",
-				Data:         "{\"message\":\"test\",\"destination\":[\"111\"]}",
-				ProcessAfter: 10,
-				MinInterval:  0,
-			},
+			inputUnit:    time.Hour,
+			expectedBody: `{"process_unit":"hour"}` + "\n",
 		},
 		{
-			payload: `{"kind": "bulksms", "data": "{\"message\":\"test\",\"destination\":[\"111\"]}", "process_after": 10, "min_interval": 10}`,
-			expectedReq: &addTestActionRequest{
-				Kind:         "bulksms",
-				Data:         "{\"message\":\"test\",\"destination\":[\"111\"]}",
-				ProcessAfter: 10,
-				MinInterval:  10,
-			},
+			inputUnit:    time.Second,
+			expectedBody: `{"process_unit":"second"}` + "\n",
 		},
 	}
 	for _, test := range tests {
-		reqBody := bytes.NewBufferString(test.payload)
-		req, err := http.NewRequest("POST", "/api/action/store", reqBody)
+		req, err := http.NewRequest("GET", "/api/vault/info", nil)
 		require.Nil(t, err)
-		req.Header.Set("Content-Type", "application/json")
 
-		ctx := context.WithValue(req.Context(), chi.RouteCtxKey, chi.NewRouteContext())
-		req = req.WithContext(ctx)
+		w := httptest.NewRecorder()
 
-		parsedReq := &addTestActionRequest{}
-		err = render.Bind(req, parsedReq)
+		v := new(mockVault)
+		v.On("GetSecretProcessUnit").Return(test.inputUnit)
 
-		require.Equal(t, test.expectedError, err)
-		require.Equal(t, test.expectedReq, parsedReq)
+		handler := vaultInfoHandler(v)
+
+		handler(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Equal(t, test.expectedBody, w.Body.String())
 	}
 }
 
-func TestValidateSigAuthScopes(t *testing.T) {
+func TestListVaultEventsHandler(t *testing.T) {
+	events := []vault.ReleaseEvent{
+		{ClientUUID: "client", SecretUUID: "secret1", Time: time.Date(2025, 3, 26, 14, 55, 40, 0, time.UTC)},
+		{ClientUUID: "client", SecretUUID: "secret2", Time: time.Date(2025, 3, 26, 15, 55, 40, 0, time.UTC)},
+		{ClientUUID: "client", SecretUUID: "secret3", Time: time.Date(2025, 3, 26, 16, 55, 40, 0, time.UTC)},
+	}
 	tests := []struct {
-		inputAuthConfig auth.Config
-		inputIdentity   *auth.Identity
-		inputData       string
-		expectedError   string
+		inputEvents     []vault.ReleaseEvent
+		inputQuery      string
+		expectedBody    string
+		expectedCode    int
+		expectedErrCode string
 	}{
 		{
-			inputAuthConfig: auth.Config{Enabled: false},
-			inputData:       `{"message": "/{sig_auth:alive}"}`,
+			inputEvents:  []vault.ReleaseEvent{},
+			expectedBody: "[]\n",
 		},
 		{
-			inputAuthConfig: auth.Config{Enabled: true},
-			inputIdentity:   &auth.Identity{Name: "admin", Scopes: []string{"api"}},
-			inputData:       `{"message": "no placeholder"}`,
+			inputEvents: []vault.ReleaseEvent{
+				{ClientUUID: "client", SecretUUID: "secret", Time: time.Date(2025, 3, 26, 14, 55, 40, 0, time.UTC)},
+			},
+			expectedBody: `[{"client_uuid":"client","secret_uuid":"secret","time":"2025-03-26T14:55:40Z"}]` + "\n",
 		},
 		{
-			inputAuthConfig: auth.Config{Enabled: true},
-			inputIdentity:   &auth.Identity{Name: "admin", Scopes: []string{"alive"}},
-			inputData:       `{"message": "/{sig_auth:alive}"}`,
+			inputEvents:  events,
+			inputQuery:   "?since=2025-03-26T14:55:40Z",
+			expectedBody: `[{"client_uuid":"client","secret_uuid":"secret2","time":"2025-03-26T15:55:40Z"},{"client_uuid":"client","secret_uuid":"secret3","time":"2025-03-26T16:55:40Z"}]` + "\n",
 		},
 		{
-			inputAuthConfig: auth.Config{Enabled: true},
-			inputIdentity:   &auth.Identity{Name: "admin", Scopes: []string{"api"}},
-			inputData:       `{"message": "/{sig_auth:alive}"}`,
-			expectedError:   "not allowed to sign /alive",
+			inputEvents:  events,
+			inputQuery:   "?limit=1",
+			expectedBody: `[{"client_uuid":"client","secret_uuid":"secret1","time":"2025-03-26T14:55:40Z"}]` + "\n",
 		},
 		{
-			inputAuthConfig: auth.Config{Enabled: true},
-			inputData:       `{"message": "/{sig_auth:alive}"}`,
-			expectedError:   "not allowed to sign /alive",
+			inputEvents:  events,
+			inputQuery:   "?since=2025-03-26T16:00:00%2B01:00&limit=1",
+			expectedBody: `[{"client_uuid":"client","secret_uuid":"secret2","time":"2025-03-26T15:55:40Z"}]` + "\n",
 		},
 		{
-			inputAuthConfig: auth.Config{Enabled: true, AnonymousScopes: []string{"alive"}},
-			inputIdentity:   &auth.Identity{Name: "admin", Scopes: []string{"api"}},
-			inputData:       `{"message": "/{sig_auth:alive}"}`,
-			expectedError:   "not allowed to sign /alive",
+			inputEvents:  events,
+			inputQuery:   "?since=2025-03-26T16:55:40Z",
+			expectedBody: "[]\n",
 		},
 		{
-			inputAuthConfig: auth.Config{Enabled: true},
-			inputIdentity:   &auth.Identity{Name: "admin", Scopes: []string{"alive"}},
-			inputData:       `{"message": "/{sig_auth:alive} and /{sig_auth:metrics}"}`,
-			expectedError:   "not allowed to sign /metrics",
+			inputEvents:     events,
+			inputQuery:      "?since=yesterday",
+			expectedCode:    http.StatusBadRequest,
+			expectedErrCode: CodeInvalidPayload,
 		},
 		{
-			inputAuthConfig: auth.Config{Enabled: true},
-			inputIdentity:   &auth.Identity{Name: "admin", Scopes: []string{"alive", "metrics"}},
-			inputData:       `{"message": "/{sig_auth:alive} and /{sig_auth:metrics}"}`,
+			inputEvents:     events,
+			inputQuery:      "?limit=0",
+			expectedCode:    http.StatusBadRequest,
+			expectedErrCode: CodeInvalidPayload,
+		},
+	}
+	for _, test := range tests {
+		req, err := http.NewRequest("GET", "/api/vault/events"+test.inputQuery, nil)
+		require.Nil(t, err)
+
+		w := httptest.NewRecorder()
+
+		v := new(mockVault)
+		v.On("GetReleaseEvents").Return(test.inputEvents)
+
+		handler := listVaultEventsHandler(v)
+
+		handler(w, req)
+		if test.expectedCode == 0 {
+			test.expectedCode = http.StatusOK
+		}
+		require.Equal(t, test.expectedCode, w.Code, "query %s", test.inputQuery)
+		requireErrCode(t, test.expectedErrCode, w)
+		if test.expectedBody != "" {
+			require.Equal(t, test.expectedBody, w.Body.String())
+		}
+	}
+}
+
+func TestFiredLogHandler(t *testing.T) {
+	firedAt := time.Date(2025, 3, 26, 14, 55, 40, 0, time.UTC)
+	since := time.Date(2025, 3, 26, 14, 0, 0, 0, time.UTC)
+	tests := []struct {
+		inputQuery      string
+		mockState       func() state.StateInterface
+		expectedBody    string
+		expectedCode    int
+		expectedErrCode string
+	}{
+		{
+			mockState: func() state.StateInterface {
+				s := new(mockState)
+				s.On("GetFiredLog", time.Time{}).Return([]*state.FiredEntry{{UUID: "a", Kind: "mail", Comment: "test", FiredAt: firedAt, Result: state.FiredResultSuccess}}, nil)
+				return s
+			},
+			expectedBody: `[{"uuid":"a","kind":"mail","comment":"test","fired_at":"2025-03-26T14:55:40Z","result":"success"}]` + "\n",
 		},
 		{
-			inputAuthConfig: auth.Config{Enabled: true},
-			inputIdentity:   &auth.Identity{Name: "admin", Scopes: []string{"api", "alive", "metrics"}},
-			inputData:       `{"message": "/{sig_auth:alive}"}`,
+			inputQuery: "?since=2025-03-26T14:00:00Z",
+			mockState: func() state.StateInterface {
+				s := new(mockState)
+				s.On("GetFiredLog", since).Return([]*state.FiredEntry{}, nil)
+				return s
+			},
+			expectedBody: "[]\n",
+		},
+		{
+			inputQuery:      "?since=yesterday",
+			mockState:       func() state.StateInterface { return new(mockState) },
+			expectedCode:    http.StatusBadRequest,
+			expectedErrCode: CodeInvalidPayload,
+		},
+		{
+			mockState: func() state.StateInterface {
+				s := new(mockState)
+				s.On("GetFiredLog", time.Time{}).Return([]*state.FiredEntry(nil), state.ErrFiredLogDisabled)
+				return s
+			},
+			expectedCode:    http.StatusNotFound,
+			expectedErrCode: CodeNotFound,
 		},
 		{
-			inputAuthConfig: auth.Config{Enabled: true},
-			inputIdentity:   &auth.Identity{Name: "admin", Scopes: []string{"api", "alive"}},
-			inputData:       `{"message": "/{sig_auth:alive} and /{sig_auth:metrics}"}`,
-			expectedError:   "not allowed to sign /metrics",
+			mockState: func() state.StateInterface {
+				s := new(mockState)
+				s.On("GetFiredLog", time.Time{}).Return([]*state.FiredEntry(nil), fmt.Errorf("fired log line 1 is corrupted"))
+				return s
+			},
+			expectedCode:    http.StatusInternalServerError,
+			expectedErrCode: CodeInternal,
 		},
 	}
 	for _, test := range tests {
-		req := httptest.NewRequest("POST", "/api/action/store", nil)
-		if test.inputIdentity != nil {
-			req = req.WithContext(auth.ContextWithIdentity(req.Context(), test.inputIdentity))
+		req, err := http.NewRequest("GET", "/api/fired"+test.inputQuery, nil)
+		require.Nil(t, err)
+
+		w := httptest.NewRecorder()
+		s := test.mockState()
+
+		handler := firedLogHandler(s)
+
+		handler(w, req)
+		if test.expectedCode == 0 {
+			test.expectedCode = http.StatusOK
 		}
-		err := validateSigAuthScopes(req, test.inputAuthConfig, test.inputData)
-		if test.expectedError == "" {
-			require.Nil(t, err)
-		} else {
-			require.NotNil(t, err)
-			require.Equal(t, test.expectedError, err.Error())
+		require.Equal(t, test.expectedCode, w.Code, "query %s", test.inputQuery)
+		requireErrCode(t, test.expectedErrCode, w)
+		if test.expectedBody != "" {
+			require.Equal(t, test.expectedBody, w.Body.String())
 		}
+		s.(*mockState).AssertExpectations(t)
 	}
 }
 
-func TestAddActionHandler(t *testing.T) {
+func TestDeleteActionHandler(t *testing.T) {
 	tests := []struct {
-		payload         string
+		actionUUID      string
 		mockStateFunc   func() state.StateInterface
-		inputAuthConfig auth.Config
-		inputIdentity   *auth.Identity
 		expectedCode    int
-		expectedActions []*state.EncryptedAction
+		expectedErrCode string
 	}{
 		{
-			payload: `{"kind": "bulksms", "data": "{\"message\":\"test\",\"destination\":[\"123\"]", "process_after": 10}`,
+			actionUUID: "",
 			mockStateFunc: func() state.StateInterface {
-				s, err := state.New(&state.Options{})
-				require.Nil(t, err)
+				s := new(mockState)
+				s.On("DeleteAction", "").Return(fmt.Errorf("missing action"))
 				return s
 			},
-			expectedCode:    http.StatusBadRequest,
-			expectedActions: []*state.EncryptedAction{},
+			expectedCode:    http.StatusNotFound,
+			expectedErrCode: CodeNotFound,
 		},
 		{
-			payload: `{"kind": "bulksms", "data": "{\"message\":\"test\",\"destination\":[\"123\"]}", "process_after": 10}`,
+			actionUUID: "test",
 			mockStateFunc: func() state.StateInterface {
 				s := new(mockState)
-				s.On("AddAction", &state.Action{Kind: "bulksms", Data: "{\"message\":\"test\",\"destination\":[\"123\"]}", ProcessAfter: 10, Comment: ""}).Return(fmt.Errorf("mockState error"))
-				s.On("GetActions").Return([]*state.EncryptedAction{})
+				s.On("DeleteAction", "test").Return(fmt.Errorf("missing action"))
 				return s
 			},
-			expectedCode:    http.StatusInternalServerError,
-			expectedActions: []*state.EncryptedAction{},
+			expectedCode:    http.StatusNotFound,
+			expectedErrCode: CodeNotFound,
 		},
 		{
-			payload: `{"kind": "bulksms", "data": "{\"message\":\"test\",\"destination\":[\"123\"]}", "process_after": 10}`,
+			actionUUID: "test",
 			mockStateFunc: func() state.StateInterface {
 				s := new(mockState)
-				s.On("AddAction", &state.Action{Kind: "bulksms", Data: "{\"message\":\"test\",\"destination\":[\"123\"]}", ProcessAfter: 10, Comment: ""}).Return(nil)
-				s.On("GetActions").Return([]*state.EncryptedAction{
-					{Action: state.Action{Kind: "bulksms", Data: "encrypted", ProcessAfter: 10, Comment: ""}},
-				})
+				s.On("DeleteAction", "test").Return(nil)
 				return s
 			},
-			expectedCode: http.StatusCreated,
-			expectedActions: []*state.EncryptedAction{
-				{Action: state.Action{Kind: "bulksms", Data: "encrypted", ProcessAfter: 10, Comment: ""}},
-			},
+			expectedCode: http.StatusOK,
 		},
 		{
-			payload: `{"kind": "bulksms", "data": "{\"message\":\"test\",\"destination\":[\"123\"]}", "process_after": 10}`,
+			actionUUID: "test",
 			mockStateFunc: func() state.StateInterface {
 				s := new(mockState)
-				s.On("AddAction", &state.Action{Kind: "bulksms", Data: "{\"message\":\"test\",\"destination\":[\"123\"]}", ProcessAfter: 10, Comment: ""}).Return(nil)
-				s.On("GetActions").Return([]*state.EncryptedAction{
-					{Action: state.Action{Kind: "bulksms", Data: "encrypted", ProcessAfter: 20, Comment: ""}},
-					{Action: state.Action{Kind: "bulksms", Data: "encrypted2", ProcessAfter: 10, Comment: ""}},
-				})
+				s.On("DeleteAction", "test").Return(fmt.Errorf("%w: status code 403", state.ErrVaultSecretNotDeleted))
 				return s
 			},
-			expectedCode: http.StatusCreated,
-			expectedActions: []*state.EncryptedAction{
-				{Action: state.Action{Kind: "bulksms", Data: "encrypted", ProcessAfter: 20, Comment: ""}},
-				{Action: state.Action{Kind: "bulksms", Data: "encrypted2", ProcessAfter: 10, Comment: ""}},
-			},
+			expectedCode: http.StatusOK,
 		},
+	}
+	for _, test := range tests {
+		req, err := http.NewRequest("DELETE", fmt.Sprintf("/api/action/store/%s", test.actionUUID), nil)
+		require.Nil(t, err)
+
+		ctx := chi.NewRouteContext()
+		ctx.URLParams.Add("actionUUID", test.actionUUID)
+		req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, ctx))
+
+		w := httptest.NewRecorder()
+		s := test.mockStateFunc()
+
+		handler := deleteActionHandler(s, nil)
+
+		handler(w, req)
+		require.Equal(t, test.expectedCode, w.Code)
+		requireErrCode(t, test.expectedErrCode, w)
+
+		contentType := w.Header().Get("Content-Type")
+		require.Equal(t, "application/json", contentType)
+
+	}
+}
+
+func TestCancelFireHandler(t *testing.T) {
+	tests := []struct {
+		actionUUID      string
+		mockStateFunc   func() state.StateInterface
+		expectedCode    int
+		expectedErrCode string
+	}{
 		{
-			payload: `{"kind": "mail", "process_after": 10, "data": "{\"message\":\"/{sig_auth:alive}\",\"destination\":[\"a@b.com\"],\"subject\":\"hi\"}"}`,
+			actionUUID: "test",
 			mockStateFunc: func() state.StateInterface {
 				s := new(mockState)
-				s.On("GetActions").Return([]*state.EncryptedAction{})
+				s.On("CancelActionPending", "test").Return(fmt.Errorf("missing action"))
 				return s
 			},
-			inputAuthConfig: auth.Config{Enabled: true},
-			inputIdentity:   &auth.Identity{Name: "admin", Scopes: []string{"api"}},
-			expectedCode:    http.StatusForbidden,
-			expectedActions: []*state.EncryptedAction{},
+			expectedCode:    http.StatusNotFound,
+			expectedErrCode: CodeNotFound,
 		},
 		{
-			payload: `{"kind": "mail", "process_after": 10, "data": "{\"message\":\"/{sig_auth:alive}\",\"destination\":[\"a@b.com\"],\"subject\":\"hi\"}"}`,
+			actionUUID: "test",
 			mockStateFunc: func() state.StateInterface {
 				s := new(mockState)
-				s.On("AddAction", &state.Action{Kind: "mail", Data: "{\"message\":\"/{sig_auth:alive}\",\"destination\":[\"a@b.com\"],\"subject\":\"hi\"}", ProcessAfter: 10, Comment: ""}).Return(nil)
-				s.On("GetActions").Return([]*state.EncryptedAction{
-					{Action: state.Action{Kind: "mail", Data: "encrypted", ProcessAfter: 10, Comment: ""}},
-				})
+				s.On("CancelActionPending", "test").Return(fmt.Errorf("%w: test", state.ErrActionNotPending))
 				return s
 			},
-			inputAuthConfig: auth.Config{Enabled: true},
-			inputIdentity:   &auth.Identity{Name: "admin", Scopes: []string{"api", "alive"}},
-			expectedCode:    http.StatusCreated,
-			expectedActions: []*state.EncryptedAction{
-				{Action: state.Action{Kind: "mail", Data: "encrypted", ProcessAfter: 10, Comment: ""}},
+			expectedCode:    http.StatusConflict,
+			expectedErrCode: CodeNotPending,
+		},
+		{
+			actionUUID: "test",
+			mockStateFunc: func() state.StateInterface {
+				s := new(mockState)
+				s.On("CancelActionPending", "test").Return(nil)
+				return s
 			},
+			expectedCode: http.StatusOK,
 		},
 	}
 	for _, test := range tests {
-		reqBody := bytes.NewBufferString(test.payload)
-		req, err := http.NewRequest("POST", "/api/action/store", reqBody)
+		req, err := http.NewRequest("POST", fmt.Sprintf("/api/action/store/%s/cancel-fire", test.actionUUID), nil)
 		require.Nil(t, err)
-		req.Header.Set("Content-Type", "application/json")
-		if test.inputIdentity != nil {
-			req = req.WithContext(auth.ContextWithIdentity(req.Context(), test.inputIdentity))
-		}
+
+		ctx := chi.NewRouteContext()
+		ctx.URLParams.Add("actionUUID", test.actionUUID)
+		req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, ctx))
 
 		w := httptest.NewRecorder()
 		s := test.mockStateFunc()
 
-		handler := addActionHandler(s, test.inputAuthConfig)
+		handler := cancelFireHandler(s, nil)
 
 		handler(w, req)
 		require.Equal(t, test.expectedCode, w.Code)
-		actions := s.GetActions()
-		require.Equal(t, len(test.expectedActions), len(actions))
-		for i, ta := range test.expectedActions {
-			require.Equal(t, ta.Action.Kind, actions[i].Action.Kind)
-			require.Equal(t, ta.Action.ProcessAfter, actions[i].Action.ProcessAfter)
-			require.Equal(t, ta.Action.Comment, actions[i].Action.Comment)
-			require.Equal(t, ta.Action.Data, actions[i].Action.Data)
-		}
+		requireErrCode(t, test.expectedErrCode, w)
 	}
 }
 
-func TestAddVaultSecretRequest(t *testing.T) {
+func TestPurgeActionsHandler(t *testing.T) {
+	adminIdentity := &auth.Identity{Name: "admin", Type: auth.AuthTypeBearer, Scopes: []string{"api:action"}}
+	for _, identity := range []*auth.Identity{
+		nil,
+		{Name: "client", Type: auth.AuthTypeBearer, ClientUUID: "client-uuid"},
+		{Name: "signed", Type: auth.AuthTypeSignedURL},
+	} {
+		req, err := http.NewRequest("POST", "/api/action/purge", nil)
+		require.Nil(t, err)
+		if identity != nil {
+			req = req.WithContext(auth.ContextWithIdentity(req.Context(), identity))
+		}
+		w := httptest.NewRecorder()
+		s := new(mockState)
+
+		purgeActionsHandler(s)(w, req)
+		require.Equal(t, http.StatusForbidden, w.Code)
+		requireErrCode(t, CodeForbidden, w)
+		s.AssertNotCalled(t, "DeleteAllActions", mock.Anything)
+	}
+
 	tests := []struct {
-		payload       string
-		expectedError error
-		expectedReq   *addVaultSecretRequest
+		inputQuery                 string
+		mockResult                 *state.PurgeResult
+		expectedDeleteVaultSecrets bool
+		expectedCode               int
+		expectedBody               string
 	}{
 		{
-			payload:       `{"key": "", "process_after": 10}`,
-			expectedError: fmt.Errorf("key must be provided"),
-			expectedReq: &addVaultSecretRequest{
-				Key:          "",
-				ProcessAfter: 10,
-			},
+			inputQuery:                 "",
+			mockResult:                 &state.PurgeResult{Deleted: 3},
+			expectedDeleteVaultSecrets: true,
+			expectedCode:               http.StatusOK,
+			expectedBody:               `{"deleted":3,"vault_delete_failed":0}`,
 		},
 		{
-			payload:       `{"key": "test", "process_after": 0}`,
-			expectedError: fmt.Errorf("process_after should be greater than 0"),
-			expectedReq: &addVaultSecretRequest{
-				Key:          "test",
-				ProcessAfter: 0,
-			},
+			inputQuery:                 "?keep_vault_secrets=true",
+			mockResult:                 &state.PurgeResult{Deleted: 3},
+			expectedDeleteVaultSecrets: false,
+			expectedCode:               http.StatusOK,
+			expectedBody:               `{"deleted":3,"vault_delete_failed":0}`,
 		},
 		{
-			payload:       `{"key": "test", "process_after": -10}`,
-			expectedError: fmt.Errorf("process_after should be greater than 0"),
-			expectedReq: &addVaultSecretRequest{
-				Key:          "test",
-				ProcessAfter: -10,
+			inputQuery: "",
+			mockResult: &state.PurgeResult{Deleted: 3, VaultDeleteFailed: 1, VaultNotDeleted: []*state.NotDeletedSecret{
+				{Action: "locked", VaultURL: "http://vault/api/vault/store/client/locked", Error: "unable to delete vault data, status code 423"},
+			}},
+			expectedDeleteVaultSecrets: true,
+			expectedCode:               http.StatusMultiStatus,
+			expectedBody:               `{"deleted":3,"vault_delete_failed":1,"vault_not_deleted":[{"action":"locked","vault_url":"http://vault/api/vault/store/client/locked","error":"unable to delete vault data, status code 423"}]}`,
+		},
+	}
+	for _, test := range tests {
+		req, err := http.NewRequest("POST", "/api/action/purge"+test.inputQuery, nil)
+		require.Nil(t, err)
+		req = req.WithContext(auth.ContextWithIdentity(req.Context(), adminIdentity))
+		w := httptest.NewRecorder()
+
+		s := new(mockState)
+		s.On("DeleteAllActions", test.expectedDeleteVaultSecrets).Return(test.mockResult)
+
+		handler := purgeActionsHandler(s)
+
+		handler(w, req)
+		require.Equal(t, test.expectedCode, w.Code)
+		require.Equal(t, test.expectedBody+"\n", w.Body.String())
+		s.AssertCalled(t, "DeleteAllActions", test.expectedDeleteVaultSecrets)
+	}
+}
+
+func TestReorderActionsHandler(t *testing.T) {
+	tests := []struct {
+		payload         string
+		mockStateFunc   func() *mockState
+		expectedCode    int
+		expectedErrCode string
+	}{
+		{
+			payload:         `{}`,
+			mockStateFunc:   func() *mockState { return new(mockState) },
+			expectedCode:    http.StatusBadRequest,
+			expectedErrCode: CodeInvalidPayload,
+		},
+		{
+			payload: `{"uuids": ["b", "a"]}`,
+			mockStateFunc: func() *mockState {
+				s := new(mockState)
+				s.On("ReorderActions", []string{"b", "a"}).Return(nil)
+				return s
 			},
+			expectedCode: http.StatusOK,
 		},
 		{
-			payload: `{"key": "test", "process_after": 15}`,
-			expectedReq: &addVaultSecretRequest{
-				Key:          "test",
-				ProcessAfter: 15,
+			payload: `{"uuids": ["b"]}`,
+			mockStateFunc: func() *mockState {
+				s := new(mockState)
+				s.On("ReorderActions", []string{"b"}).Return(fmt.Errorf("%w: got 1 uuids, expected 2", state.ErrInvalidOrder))
+				return s
 			},
+			expectedCode:    http.StatusBadRequest,
+			expectedErrCode: CodeInvalidPayload,
 		},
 	}
 	for _, test := range tests {
-		reqBody := bytes.NewBufferString(test.payload)
-		req, err := http.NewRequest("POST", "/api/vault/store/client-uuid/secret-uuid", reqBody)
-		require.Nil(t, err)
+		req := httptest.NewRequest("POST", "/api/action/reorder", bytes.NewBufferString(test.payload))
 		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
 
-		ctx := context.WithValue(req.Context(), chi.RouteCtxKey, chi.NewRouteContext())
-		req = req.WithContext(ctx)
-
-		parsedReq := &addVaultSecretRequest{}
-		err = render.Bind(req, parsedReq)
+		s := test.mockStateFunc()
+		handler := reorderActionsHandler(s)
 
-		require.Equal(t, test.expectedError, err)
-		require.Equal(t, test.expectedReq, parsedReq)
+		handler(w, req)
+		require.Equal(t, test.expectedCode, w.Code)
+		requireErrCode(t, test.expectedErrCode, w)
+		s.AssertExpectations(t)
 	}
 }
 
-func TestAddVaultSecretHandler(t *testing.T) {
+func TestReleaseAllVaultSecretsHandler(t *testing.T) {
+	adminIdentity := &auth.Identity{Name: "admin", Type: auth.AuthTypeBearer, Scopes: []string{"api:vault:store"}}
 	tests := []struct {
-		payload         string
-		inputClientUUID string
-		inputSecretUUID string
+		inputIdentity   *auth.Identity
 		mockVaultFunc   func() vault.VaultInterface
 		expectedCode    int
+		expectedErrCode string
 	}{
 		{
-			payload:         `{"key": "test", "process_after": 10}`,
-			inputClientUUID: "",
-			inputSecretUUID: "secret-uuid",
-			mockVaultFunc: func() vault.VaultInterface {
-				v := new(mockVault)
-				return v
-			},
-			expectedCode: http.StatusBadRequest,
+			mockVaultFunc:   func() vault.VaultInterface { return new(mockVault) },
+			expectedCode:    http.StatusForbidden,
+			expectedErrCode: CodeForbidden,
 		},
 		{
-			payload:         `{"key": "test", "process_after": 10}`,
-			inputClientUUID: "client-uuid",
-			inputSecretUUID: "",
-			mockVaultFunc: func() vault.VaultInterface {
-				v := new(mockVault)
-				return v
-			},
-			expectedCode: http.StatusBadRequest,
+			inputIdentity:   &auth.Identity{Name: "client", Type: auth.AuthTypeBearer, ClientUUID: "client-uuid"},
+			mockVaultFunc:   func() vault.VaultInterface { return new(mockVault) },
+			expectedCode:    http.StatusForbidden,
+			expectedErrCode: CodeForbidden,
 		},
 		{
-			payload:         `{"process_after": 10}`,
-			inputClientUUID: "client-uuid",
-			inputSecretUUID: "secret-uuid",
-			mockVaultFunc: func() vault.VaultInterface {
-				v := new(mockVault)
-				return v
-			},
-			expectedCode: http.StatusBadRequest,
+			inputIdentity:   &auth.Identity{Name: "signed", Type: auth.AuthTypeSignedURL},
+			mockVaultFunc:   func() vault.VaultInterface { return new(mockVault) },
+			expectedCode:    http.StatusForbidden,
+			expectedErrCode: CodeForbidden,
 		},
 		{
-			payload:         `{"key": "test", "process_after": 10}`,
-			inputClientUUID: "client-uuid",
-			inputSecretUUID: "secret-uuid",
+			inputIdentity: adminIdentity,
 			mockVaultFunc: func() vault.VaultInterface {
 				v := new(mockVault)
-				v.On("AddSecret", "client-uuid", "secret-uuid", &vault.Secret{Key: "test", ProcessAfter: 10}).Return(fmt.Errorf("mockVault error"))
+				v.On("ReleaseAll", "client-uuid").Return(fmt.Errorf("client client-uuid is missing"))
 				return v
 			},
-			expectedCode: http.StatusBadRequest,
+			expectedCode:    http.StatusNotFound,
+			expectedErrCode: CodeNotFound,
 		},
 		{
-			payload:         `{"key": "test", "process_after": 10}`,
-			inputClientUUID: "client-uuid",
-			inputSecretUUID: "secret-uuid",
+			inputIdentity: adminIdentity,
 			mockVaultFunc: func() vault.VaultInterface {
 				v := new(mockVault)
-				v.On("AddSecret", "client-uuid", "secret-uuid", &vault.Secret{Key: "test", ProcessAfter: 10}).Return(nil)
+				v.On("ReleaseAll", "client-uuid").Return(nil)
 				return v
 			},
-			expectedCode: http.StatusCreated,
+			expectedCode: http.StatusOK,
 		},
 	}
 	for _, test := range tests {
-		reqBody := bytes.NewBufferString(test.payload)
-		req, err := http.NewRequest("POST", fmt.Sprintf("/api/vault/store/%s/%s", test.inputClientUUID, test.inputSecretUUID), reqBody)
+		req, err := http.NewRequest("POST", "/api/vault/store/client-uuid/release-all", nil)
 		require.Nil(t, err)
-		req.Header.Set("Content-Type", "application/json")
+		if test.inputIdentity != nil {
+			req = req.WithContext(auth.ContextWithIdentity(req.Context(), test.inputIdentity))
+		}
 
 		ctx := chi.NewRouteContext()
-		ctx.URLParams.Add("clientUUID", test.inputClientUUID)
-		ctx.URLParams.Add("secretUUID", test.inputSecretUUID)
+		ctx.URLParams.Add("clientUUID", "client-uuid")
 		req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, ctx))
 
 		w := httptest.NewRecorder()
 		v := test.mockVaultFunc()
 
-		handler := addVaultSecretHandler(v)
+		handler := releaseAllVaultSecretsHandler(v)
 
 		handler(w, req)
 		require.Equal(t, test.expectedCode, w.Code)
+		requireErrCode(t, test.expectedErrCode, w)
+		v.(*mockVault).AssertExpectations(t)
 	}
 }
 
-func TestGetActionHandler(t *testing.T) {
+func TestPanicHandler(t *testing.T) {
+	adminIdentity := &auth.Identity{Name: "admin", Type: auth.AuthTypeBearer, Scopes: []string{"api:panic"}}
 	tests := []struct {
-		actionUUID       string
-		mockStateFunc    func() state.StateInterface
-		expectedCode     int
-		expectedResponse *state.EncryptedAction
+		inputIdentity   *auth.Identity
+		inputQuery      string
+		mockStateFunc   func() state.StateInterface
+		expectedCode    int
+		expectedErrCode string
+		expectedBody    string
 	}{
 		{
-			actionUUID: "",
-			mockStateFunc: func() state.StateInterface {
-				s := new(mockState)
-				s.On("GetAction", "").Return(nil, -1)
-				return s
-			},
-			expectedCode: http.StatusNotFound,
+			mockStateFunc:   func() state.StateInterface { return new(mockState) },
+			expectedCode:    http.StatusForbidden,
+			expectedErrCode: CodeForbidden,
 		},
 		{
-			actionUUID: "test",
+			inputIdentity:   &auth.Identity{Name: "client", Type: auth.AuthTypeBearer, ClientUUID: "client-uuid"},
+			mockStateFunc:   func() state.StateInterface { return new(mockState) },
+			expectedCode:    http.StatusForbidden,
+			expectedErrCode: CodeForbidden,
+		},
+		{
+			inputIdentity:   &auth.Identity{Name: "signed", Type: auth.AuthTypeSignedURL},
+			mockStateFunc:   func() state.StateInterface { return new(mockState) },
+			expectedCode:    http.StatusForbidden,
+			expectedErrCode: CodeForbidden,
+		},
+		{
+			inputIdentity: adminIdentity,
 			mockStateFunc: func() state.StateInterface {
 				s := new(mockState)
-				s.On("GetAction", "test").Return(nil, -1)
+				s.On("Panic", false).Return(&state.PanicResult{Paused: 3})
 				return s
 			},
-			expectedCode: http.StatusNotFound,
+			expectedCode: http.StatusOK,
+			expectedBody: `{"paused":3,"vault_deleted":0,"vault_delete_failed":0}`,
 		},
 		{
-			actionUUID: "test",
+			inputIdentity: adminIdentity,
+			inputQuery:    "?purge=true",
 			mockStateFunc: func() state.StateInterface {
 				s := new(mockState)
-				s.On("GetAction", "test").Return(&state.EncryptedAction{UUID: "test", Action: state.Action{Kind: "mail", Data: "encrypted", ProcessAfter: 10}}, 0)
+				s.On("Panic", true).Return(&state.PanicResult{Paused: 3, VaultDeleted: 2, VaultDeleteFailed: 1})
 				return s
 			},
-			expectedCode:     http.StatusOK,
-			expectedResponse: &state.EncryptedAction{UUID: "test", Action: state.Action{Kind: "mail", Data: "encrypted", ProcessAfter: 10}},
+			expectedCode: http.StatusOK,
+			expectedBody: `{"paused":3,"vault_deleted":2,"vault_delete_failed":1}`,
 		},
 	}
 	for _, test := range tests {
-		req, err := http.NewRequest("GET", fmt.Sprintf("/api/action/store/%s", test.actionUUID), nil)
+		req, err := http.NewRequest("POST", "/api/panic"+test.inputQuery, nil)
 		require.Nil(t, err)
-
-		ctx := chi.NewRouteContext()
-		ctx.URLParams.Add("actionUUID", test.actionUUID)
-		req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, ctx))
+		if test.inputIdentity != nil {
+			req = req.WithContext(auth.ContextWithIdentity(req.Context(), test.inputIdentity))
+		}
 
 		w := httptest.NewRecorder()
 		s := test.mockStateFunc()
 
-		handler := getActionHandler(s)
-
+		handler := panicHandler(s, nil)
 		handler(w, req)
 		require.Equal(t, test.expectedCode, w.Code)
+		requireErrCode(t, test.expectedErrCode, w)
+		if test.expectedBody != "" {
+			require.JSONEq(t, test.expectedBody, w.Body.String())
+		}
+		s.(*mockState).AssertExpectations(t)
+	}
+}
 
-		contentType := w.Header().Get("Content-Type")
-		require.Equal(t, "application/json", contentType)
-
-		if test.expectedCode < 300 {
-			var response *state.EncryptedAction
-			err = json.Unmarshal(w.Body.Bytes(), &response)
-			require.Nil(t, err)
-			require.Equal(t, test.expectedResponse, response)
+func TestGoneHandler(t *testing.T) {
+	adminIdentity := &auth.Identity{Name: "admin", Type: auth.AuthTypeBearer, Scopes: []string{"api:alive"}}
+	tests := []struct {
+		inputIdentity   *auth.Identity
+		expectedCode    int
+		expectedErrCode string
+		expectedGone    bool
+	}{
+		{
+			expectedCode:    http.StatusForbidden,
+			expectedErrCode: CodeForbidden,
+		},
+		{
+			inputIdentity:   &auth.Identity{Name: "client", Type: auth.AuthTypeBearer, ClientUUID: "client-uuid"},
+			expectedCode:    http.StatusForbidden,
+			expectedErrCode: CodeForbidden,
+		},
+		{
+			inputIdentity:   &auth.Identity{Name: "signed", Type: auth.AuthTypeSignedURL},
+			expectedCode:    http.StatusForbidden,
+			expectedErrCode: CodeForbidden,
+		},
+		{
+			inputIdentity: adminIdentity,
+			expectedCode:  http.StatusOK,
+			expectedGone:  true,
+		},
+	}
+	for _, test := range tests {
+		req, err := http.NewRequest("DELETE", "/api/alive", nil)
+		require.Nil(t, err)
+		if test.inputIdentity != nil {
+			req = req.WithContext(auth.ContextWithIdentity(req.Context(), test.inputIdentity))
 		}
 
+		w := httptest.NewRecorder()
+		s := new(mockState)
+		s.On("MarkGone").Return()
+
+		handler := goneHandler(s, time.Hour)
+		handler(w, req)
+		require.Equal(t, test.expectedCode, w.Code)
+		requireErrCode(t, test.expectedErrCode, w)
+		if test.expectedGone {
+			s.AssertCalled(t, "MarkGone")
+		} else {
+			s.AssertNotCalled(t, "MarkGone")
+		}
 	}
 }
 
-func TestGetVaultSecretHandler(t *testing.T) {
+func TestExtendVaultSecretHandler(t *testing.T) {
+	clientIdentity := &auth.Identity{Name: "client", ClientUUID: "client-uuid"}
 	tests := []struct {
-		inputClientUUID  string
-		inputSecretUUID  string
-		inputMethod      string
-		mockVaultFunc    func() vault.VaultInterface
-		expectedCode     int
-		expectedResponse *vault.Secret
+		payload         string
+		inputIdentity   *auth.Identity
+		mockVaultFunc   func() vault.VaultInterface
+		expectedCode    int
+		expectedErrCode string
 	}{
 		{
-			inputClientUUID: "client-uuid",
-			inputSecretUUID: "secret-uuid",
-			inputMethod:     "GET",
-			mockVaultFunc: func() vault.VaultInterface {
-				v := new(mockVault)
-				v.On("GetSecret", "client-uuid", "secret-uuid").Return(nil, fmt.Errorf("mockVault error"))
-				return v
-			},
-			expectedCode: http.StatusNotFound,
+			payload:         `{"extend": 5}`,
+			mockVaultFunc:   func() vault.VaultInterface { return new(mockVault) },
+			expectedCode:    http.StatusForbidden,
+			expectedErrCode: CodeForbidden,
 		},
 		{
-			inputClientUUID: "client-uuid",
-			inputSecretUUID: "secret-uuid",
-			inputMethod:     "HEAD",
-			mockVaultFunc: func() vault.VaultInterface {
-				v := new(mockVault)
-				v.On("GetSecret", "client-uuid", "secret-uuid").Return(nil, fmt.Errorf("mockVault error"))
-				return v
-			},
-			expectedCode: http.StatusNotFound,
+			payload:         `{"extend": 5}`,
+			inputIdentity:   &auth.Identity{Name: "other", ClientUUID: "other-uuid"},
+			mockVaultFunc:   func() vault.VaultInterface { return new(mockVault) },
+			expectedCode:    http.StatusForbidden,
+			expectedErrCode: CodeForbidden,
 		},
 		{
-			inputClientUUID: "client-uuid",
-			inputSecretUUID: "secret-uuid",
-			inputMethod:     "GET",
-			mockVaultFunc: func() vault.VaultInterface {
-				v := new(mockVault)
-				v.On("GetSecret", "client-uuid", "secret-uuid").Return(nil, fmt.Errorf("secret client-uuid/secret-uuid %w", vault.ErrSecretNotReleased))
-				return v
-			},
-			expectedCode:     http.StatusLocked,
-			expectedResponse: nil,
+			payload:         `{"extend": 0}`,
+			inputIdentity:   clientIdentity,
+			mockVaultFunc:   func() vault.VaultInterface { return new(mockVault) },
+			expectedCode:    http.StatusBadRequest,
+			expectedErrCode: CodeInvalidPayload,
 		},
 		{
-			inputClientUUID: "client-uuid",
-			inputSecretUUID: "secret-uuid",
-			inputMethod:     "HEAD",
+			payload:       `{"extend": 5}`,
+			inputIdentity: clientIdentity,
 			mockVaultFunc: func() vault.VaultInterface {
 				v := new(mockVault)
-				v.On("GetSecret", "client-uuid", "secret-uuid").Return(nil, fmt.Errorf("secret client-uuid/secret-uuid %w", vault.ErrSecretNotReleased))
+				v.On("ExtendSecret", "client-uuid", "secret-uuid", 5).Return(fmt.Errorf("secret client-uuid/secret-uuid is missing"))
 				return v
 			},
-			expectedCode:     http.StatusLocked,
-			expectedResponse: nil,
+			expectedCode:    http.StatusNotFound,
+			expectedErrCode: CodeNotFound,
 		},
 		{
-			inputClientUUID: "client-uuid",
-			inputSecretUUID: "secret-uuid",
-			inputMethod:     "GET",
+			payload:       `{"extend": 5}`,
+			inputIdentity: clientIdentity,
 			mockVaultFunc: func() vault.VaultInterface {
 				v := new(mockVault)
-				v.On("GetSecret", "client-uuid", "secret-uuid").Return(&vault.Secret{Key: "test", ProcessAfter: 10}, nil)
+				v.On("ExtendSecret", "client-uuid", "secret-uuid", 5).Return(fmt.Errorf("secret client-uuid/secret-uuid %w", vault.ErrSecretReleased))
 				return v
 			},
-			expectedCode:     http.StatusOK,
-			expectedResponse: &vault.Secret{Key: "test", ProcessAfter: 10},
+			expectedCode:    http.StatusLocked,
+			expectedErrCode: CodeLocked,
 		},
 		{
-			inputClientUUID: "client-uuid",
-			inputSecretUUID: "secret-uuid",
-			inputMethod:     "HEAD",
+			payload:       `{"extend": 5}`,
+			inputIdentity: clientIdentity,
 			mockVaultFunc: func() vault.VaultInterface {
 				v := new(mockVault)
-				v.On("GetSecret", "client-uuid", "secret-uuid").Return(&vault.Secret{Key: "test", ProcessAfter: 10}, nil)
+				v.On("ExtendSecret", "client-uuid", "secret-uuid", 5).Return(nil)
 				return v
 			},
 			expectedCode: http.StatusOK,
 		},
 	}
 	for _, test := range tests {
-		req, err := http.NewRequest(test.inputMethod, fmt.Sprintf("/api/vault/store/%s/%s", test.inputClientUUID, test.inputSecretUUID), nil)
+		req, err := http.NewRequest("POST", "/api/vault/store/client-uuid/secret-uuid/extend", strings.NewReader(test.payload))
 		require.Nil(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		if test.inputIdentity != nil {
+			req = req.WithContext(auth.ContextWithIdentity(req.Context(), test.inputIdentity))
+		}
 
 		ctx := chi.NewRouteContext()
-		ctx.URLParams.Add("clientUUID", test.inputClientUUID)
-		ctx.URLParams.Add("secretUUID", test.inputSecretUUID)
+		ctx.URLParams.Add("clientUUID", "client-uuid")
+		ctx.URLParams.Add("secretUUID", "secret-uuid")
 		req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, ctx))
 
 		w := httptest.NewRecorder()
 		v := test.mockVaultFunc()
 
-		handler := getVaultSecretHandler(v)
+		handler := extendVaultSecretHandler(v)
 
 		handler(w, req)
 		require.Equal(t, test.expectedCode, w.Code)
-
-		contentType := w.Header().Get("Content-Type")
-		require.Equal(t, "application/json", contentType)
-
-		if test.expectedCode < 300 {
-			if test.inputMethod == "HEAD" {
-				require.JSONEq(t, `{"status":"success"}`, w.Body.String())
-			} else {
-				var response *vault.Secret
-				err = json.Unmarshal(w.Body.Bytes(), &response)
-				require.Nil(t, err)
-				require.Equal(t, test.expectedResponse, response)
-			}
-		}
-
+		requireErrCode(t, test.expectedErrCode, w)
+		v.(*mockVault).AssertExpectations(t)
 	}
 }
 
-func TestDeleteActionHandler(t *testing.T) {
+func TestDeleteVaultSecretHandler(t *testing.T) {
 	tests := []struct {
-		actionUUID    string
-		mockStateFunc func() state.StateInterface
-		expectedCode  int
+		inputClientUUID    string
+		inputSecretUUID    string
+		inputQuery         string
+		inputIdentity      *auth.Identity
+		mockVaultFunc      func() vault.VaultInterface
+		expectedCode       int
+		expectedErrCode    string
+		expectedRetryAfter string
 	}{
 		{
-			actionUUID: "",
-			mockStateFunc: func() state.StateInterface {
-				s := new(mockState)
-				s.On("DeleteAction", "").Return(fmt.Errorf("missing action"))
-				return s
+			inputClientUUID: "client-uuid",
+			inputSecretUUID: "secret-uuid",
+			mockVaultFunc: func() vault.VaultInterface {
+				v := new(mockVault)
+				v.On("DeleteSecret", "client-uuid", "secret-uuid").Return(fmt.Errorf("mockVault error"))
+				return v
 			},
-			expectedCode: http.StatusNotFound,
+			expectedCode:    http.StatusNotFound,
+			expectedErrCode: CodeNotFound,
 		},
 		{
-			actionUUID: "test",
-			mockStateFunc: func() state.StateInterface {
-				s := new(mockState)
-				s.On("DeleteAction", "test").Return(fmt.Errorf("missing action"))
-				return s
+			inputClientUUID: "client-uuid",
+			inputSecretUUID: "secret-uuid",
+			mockVaultFunc: func() vault.VaultInterface {
+				v := new(mockVault)
+				v.On("DeleteSecret", "client-uuid", "secret-uuid").Return(fmt.Errorf("secret client-uuid/secret-uuid %w", vault.ErrSecretNotReleased))
+				return v
 			},
-			expectedCode: http.StatusNotFound,
+			expectedCode:    http.StatusLocked,
+			expectedErrCode: CodeLocked,
 		},
 		{
-			actionUUID: "test",
-			mockStateFunc: func() state.StateInterface {
-				s := new(mockState)
-				s.On("DeleteAction", "test").Return(nil)
-				return s
+			inputClientUUID: "client-uuid",
+			inputSecretUUID: "secret-uuid",
+			mockVaultFunc: func() vault.VaultInterface {
+				v := new(mockVault)
+				v.On("DeleteSecret", "client-uuid", "secret-uuid").Return(&vault.NotReleasedError{ClientUUID: "client-uuid", SecretUUID: "secret-uuid", Remaining: 90500 * time.Millisecond})
+				return v
 			},
-			expectedCode: http.StatusOK,
+			expectedCode:       http.StatusLocked,
+			expectedErrCode:    CodeLocked,
+			expectedRetryAfter: "91",
 		},
-	}
-	for _, test := range tests {
-		req, err := http.NewRequest("DELETE", fmt.Sprintf("/api/action/store/%s", test.actionUUID), nil)
-		require.Nil(t, err)
-
-		ctx := chi.NewRouteContext()
-		ctx.URLParams.Add("actionUUID", test.actionUUID)
-		req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, ctx))
-
-		w := httptest.NewRecorder()
-		s := test.mockStateFunc()
-
-		handler := deleteActionHandler(s)
-
-		handler(w, req)
-		require.Equal(t, test.expectedCode, w.Code)
-
-		contentType := w.Header().Get("Content-Type")
-		require.Equal(t, "application/json", contentType)
-
-	}
-}
-
-func TestDeleteVaultSecretHandler(t *testing.T) {
-	tests := []struct {
-		inputClientUUID string
-		inputSecretUUID string
-		mockVaultFunc   func() vault.VaultInterface
-		expectedCode    int
-	}{
 		{
 			inputClientUUID: "client-uuid",
 			inputSecretUUID: "secret-uuid",
 			mockVaultFunc: func() vault.VaultInterface {
 				v := new(mockVault)
-				v.On("DeleteSecret", "client-uuid", "secret-uuid").Return(fmt.Errorf("mockVault error"))
+				v.On("DeleteSecret", "client-uuid", "secret-uuid").Return(nil)
 				return v
 			},
-			expectedCode: http.StatusNotFound,
+			expectedCode: http.StatusOK,
+		},
+		{
+			inputClientUUID: "client-uuid",
+			inputSecretUUID: "secret-uuid",
+			inputQuery:      "?revoke=true",
+			mockVaultFunc: func() vault.VaultInterface {
+				return new(mockVault)
+			},
+			expectedCode:    http.StatusForbidden,
+			expectedErrCode: CodeForbidden,
+		},
+		{
+			inputClientUUID: "client-uuid",
+			inputSecretUUID: "secret-uuid",
+			inputQuery:      "?revoke=true",
+			inputIdentity:   &auth.Identity{Name: "admin", Scopes: []string{"api"}},
+			mockVaultFunc: func() vault.VaultInterface {
+				return new(mockVault)
+			},
+			expectedCode:    http.StatusForbidden,
+			expectedErrCode: CodeForbidden,
+		},
+		{
+			inputClientUUID: "client-uuid",
+			inputSecretUUID: "secret-uuid",
+			inputQuery:      "?revoke=true",
+			inputIdentity:   &auth.Identity{Name: "other", ClientUUID: "other-uuid"},
+			mockVaultFunc: func() vault.VaultInterface {
+				return new(mockVault)
+			},
+			expectedCode:    http.StatusForbidden,
+			expectedErrCode: CodeForbidden,
 		},
 		{
 			inputClientUUID: "client-uuid",
 			inputSecretUUID: "secret-uuid",
+			inputQuery:      "?revoke=true",
+			inputIdentity:   &auth.Identity{Name: "client", ClientUUID: "client-uuid"},
 			mockVaultFunc: func() vault.VaultInterface {
 				v := new(mockVault)
-				v.On("DeleteSecret", "client-uuid", "secret-uuid").Return(fmt.Errorf("secret client-uuid/secret-uuid %w", vault.ErrSecretNotReleased))
+				v.On("RevokeSecret", "client-uuid", "secret-uuid").Return(fmt.Errorf("mockVault error"))
 				return v
 			},
-			expectedCode: http.StatusLocked,
+			expectedCode:    http.StatusNotFound,
+			expectedErrCode: CodeNotFound,
 		},
 		{
 			inputClientUUID: "client-uuid",
 			inputSecretUUID: "secret-uuid",
+			inputQuery:      "?revoke=true",
+			inputIdentity:   &auth.Identity{Name: "client", ClientUUID: "client-uuid"},
 			mockVaultFunc: func() vault.VaultInterface {
 				v := new(mockVault)
-				v.On("DeleteSecret", "client-uuid", "secret-uuid").Return(nil)
+				v.On("RevokeSecret", "client-uuid", "secret-uuid").Return(nil)
 				return v
 			},
 			expectedCode: http.StatusOK,
 		},
 	}
 	for _, test := range tests {
-		req, err := http.NewRequest("DELETE", fmt.Sprintf("/api/vault/store/%s/%s", test.inputClientUUID, test.inputSecretUUID), nil)
+		req, err := http.NewRequest("DELETE", fmt.Sprintf("/api/vault/store/%s/%s%s", test.inputClientUUID, test.inputSecretUUID, test.inputQuery), nil)
 		require.Nil(t, err)
+		if test.inputIdentity != nil {
+			req = req.WithContext(auth.ContextWithIdentity(req.Context(), test.inputIdentity))
+		}
 
 		ctx := chi.NewRouteContext()
 		ctx.URLParams.Add("clientUUID", test.inputClientUUID)
@@ -1065,6 +4271,8 @@ func TestDeleteVaultSecretHandler(t *testing.T) {
 
 		handler(w, req)
 		require.Equal(t, test.expectedCode, w.Code)
+		requireErrCode(t, test.expectedErrCode, w)
+		require.Equal(t, test.expectedRetryAfter, w.Header().Get("Retry-After"))
 
 		contentType := w.Header().Get("Content-Type")
 		require.Equal(t, "application/json", contentType)
@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"path"
+	"strings"
 	"time"
 
 	"dmh/internal/auth"
@@ -12,21 +14,45 @@ import (
 )
 
 // apiLogFormatter logs the path only, never the query string or headers, so tokens and signatures never reach logs.
+// Tokens which are part of the path are masked, see maskPathTokens.
 type apiLogFormatter struct{}
 
 func (apiLogFormatter) NewLogEntry(r *http.Request) middleware.LogEntry {
 	return &apiLogEntry{
-		method: r.Method,
-		path:   r.URL.Path,
-		remote: r.RemoteAddr,
+		method:    r.Method,
+		path:      maskPathTokens(r.URL.Path),
+		remote:    r.RemoteAddr,
+		requestID: middleware.GetReqID(r.Context()),
 	}
 }
 
+// tokenPathPrefixes are paths followed only by secret token, e.g. /api/alive/{token}.
+var tokenPathPrefixes = []string{
+	"/api/alive/",         // alive cron token
+	"/api/action/verify/", // action verification token
+	"/api/receipt/",       // delivery receipt token
+}
+
+// maskPathTokens replaces everything after token path prefix with {token},
+// so anyone reading request log can't replay the token.
+// Path is matched cleaned, the same way router sees it, so /api//alive/x is masked too.
+// Request is logged before it is routed (and even when auth rejects it), so route parameters can't be used.
+func maskPathTokens(p string) string {
+	cleaned := path.Clean("/" + p)
+	for _, prefix := range tokenPathPrefixes {
+		if rest, ok := strings.CutPrefix(cleaned, prefix); ok && rest != "" {
+			return prefix + "{token}"
+		}
+	}
+	return p
+}
+
 type apiLogEntry struct {
-	method   string
-	path     string
-	remote   string
-	identity string
+	method    string
+	path      string
+	remote    string
+	identity  string
+	requestID string
 }
 
 // Write logs a single completed request.
@@ -35,6 +61,9 @@ func (e *apiLogEntry) Write(status, bytes int, header http.Header, elapsed time.
 	if e.identity != "" {
 		msg += fmt.Sprintf(" identity=%s", e.identity)
 	}
+	if e.requestID != "" {
+		msg += fmt.Sprintf(" request_id=%s", e.requestID)
+	}
 	log.Print(msg)
 }
 
@@ -44,10 +73,30 @@ func (e *apiLogEntry) Panic(v any, stack []byte) {
 	if e.identity != "" {
 		msg += fmt.Sprintf(" identity=%s", e.identity)
 	}
+	if e.requestID != "" {
+		msg += fmt.Sprintf(" request_id=%s", e.requestID)
+	}
 	log.Print(msg)
 	middleware.PrintPrettyStack(v)
 }
 
+// requestID assigns request id (client provided X-Request-Id is kept) and echoes it in X-Request-Id response header.
+func requestID(next http.Handler) http.Handler {
+	return middleware.RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(middleware.RequestIDHeader, middleware.GetReqID(r.Context()))
+		next.ServeHTTP(w, r)
+	}))
+}
+
+// logf logs handler message with id of request r, so it can be matched with request log and error response.
+func logf(r *http.Request, format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	if id := middleware.GetReqID(r.Context()); id != "" {
+		msg += fmt.Sprintf(" request_id=%s", id)
+	}
+	log.Print(msg)
+}
+
 // logIdentity attaches Identity to the log entry via chi's GetLogEntry.
 // Runs before Authorizer, so a denied request still logs which token it was.
 func logIdentity(next http.Handler) http.Handler {
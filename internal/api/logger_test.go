@@ -2,6 +2,7 @@ package api
 
 import (
 	"bytes"
+	"context"
 	"log"
 	"net/http"
 	"net/http/httptest"
@@ -25,6 +26,26 @@ func TestApiLogFormatterNewLogEntry(t *testing.T) {
 	require.Equal(t, "", apiEntry.identity)
 }
 
+func TestMaskPathTokens(t *testing.T) {
+	tests := []struct {
+		inputPath    string
+		expectedPath string
+	}{
+		{inputPath: "/api/action/store", expectedPath: "/api/action/store"},
+		{inputPath: "/api/alive", expectedPath: "/api/alive"},
+		{inputPath: "/api/alive/", expectedPath: "/api/alive/"},
+		{inputPath: "/api/alive/secret-token", expectedPath: "/api/alive/{token}"},
+		{inputPath: "//api/alive/secret-token/", expectedPath: "/api/alive/{token}"},
+		{inputPath: "/api/alive/secret/token", expectedPath: "/api/alive/{token}"},
+		{inputPath: "/api/action/verify/secret-token", expectedPath: "/api/action/verify/{token}"},
+		{inputPath: "/api/receipt/secret-token", expectedPath: "/api/receipt/{token}"},
+		{inputPath: "/api/action/store/uuid", expectedPath: "/api/action/store/uuid"},
+	}
+	for _, test := range tests {
+		require.Equal(t, test.expectedPath, maskPathTokens(test.inputPath), test.inputPath)
+	}
+}
+
 func TestApiLogEntryWrite(t *testing.T) {
 	tests := []struct {
 		inputEntry      *apiLogEntry
@@ -54,6 +75,12 @@ func TestApiLogEntryWrite(t *testing.T) {
 			inputStatus:     http.StatusOK,
 			expectedContain: []string{"status=200", "identity=admin"},
 		},
+		{
+			inputEntry:      &apiLogEntry{method: "GET", path: "/api/action/store", remote: "1.2.3.4", requestID: "req-1"},
+			inputStatus:     http.StatusInternalServerError,
+			expectedContain: []string{"status=500", "request_id=req-1"},
+			expectedExclude: []string{"identity="},
+		},
 	}
 	for _, test := range tests {
 		buf := &bytes.Buffer{}
@@ -128,3 +155,48 @@ func TestLogIdentityNoEntry(t *testing.T) {
 	})
 	require.True(t, called)
 }
+
+func TestRequestID(t *testing.T) {
+	tests := []struct {
+		inputHeader string
+		expectedID  string
+	}{
+		{
+			inputHeader: "client-id",
+			expectedID:  "client-id",
+		},
+		{},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", "/x", nil)
+		if test.inputHeader != "" {
+			req.Header.Set(middleware.RequestIDHeader, test.inputHeader)
+		}
+		w := httptest.NewRecorder()
+
+		var id string
+		next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { id = middleware.GetReqID(r.Context()) })
+		requestID(next).ServeHTTP(w, req)
+
+		require.NotEmpty(t, id)
+		if test.expectedID != "" {
+			require.Equal(t, test.expectedID, id)
+		}
+		require.Equal(t, id, w.Header().Get(middleware.RequestIDHeader))
+	}
+}
+
+func TestLogf(t *testing.T) {
+	buf := &bytes.Buffer{}
+	log.SetOutput(buf)
+	defer log.SetOutput(os.Stderr)
+
+	req := httptest.NewRequest("GET", "/x", nil)
+	logf(req, "unable to %s", "test")
+	require.Contains(t, buf.String(), "unable to test\n")
+
+	buf.Reset()
+	req = req.WithContext(context.WithValue(req.Context(), middleware.RequestIDKey, "req-1"))
+	logf(req, "unable to %s", "test")
+	require.Contains(t, buf.String(), "unable to test request_id=req-1\n")
+}
@@ -0,0 +1,182 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"dmh/internal/state"
+	"dmh/internal/vault"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+)
+
+// parseExtend parses maintenance extension, Go duration (e.g. 36h) or whole days (e.g. 14d).
+func parseExtend(extend string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(extend, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("extend should be duration (e.g. 36h) or number of days (e.g. 14d)")
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(extend)
+	if err != nil {
+		return 0, fmt.Errorf("extend should be duration (e.g. 36h) or number of days (e.g. 14d)")
+	}
+	return d, nil
+}
+
+// maintenanceRequest describes user request to enable maintenance.
+type maintenanceRequest struct {
+	Extend   string        `json:"extend"`
+	duration time.Duration // parsed Extend
+}
+
+// Bind validates maintenanceRequest.
+func (req *maintenanceRequest) Bind(r *http.Request) error {
+	d, err := parseExtend(req.Extend)
+	if err != nil {
+		return err
+	}
+	if d < time.Second {
+		return fmt.Errorf("extend should be at least 1s")
+	}
+	req.duration = d
+	return nil
+}
+
+// maintenanceResponse describes current maintenance.
+type maintenanceResponse struct {
+	Enabled bool       `json:"enabled"`
+	Extend  string     `json:"extend,omitempty"`
+	Since   *time.Time `json:"since,omitempty"`
+}
+
+// newMaintenanceResponse returns response for maintenance, nil maintenance is disabled.
+func newMaintenanceResponse(m *state.Maintenance) *maintenanceResponse {
+	if m == nil {
+		return &maintenanceResponse{}
+	}
+	return &maintenanceResponse{Enabled: true, Extend: m.Extend.String(), Since: &m.Since}
+}
+
+// vaultExtendRequest describes DMH request to set maintenance extension in Vault.
+type vaultExtendRequest struct {
+	ExtendSeconds int64 `json:"extend_seconds"`
+}
+
+// Bind validates vaultExtendRequest.
+func (req *vaultExtendRequest) Bind(r *http.Request) error {
+	if req.ExtendSeconds < 0 {
+		return fmt.Errorf("extend_seconds should be greater or equal 0")
+	}
+	return nil
+}
+
+// updateVaultExtend sets maintenance extension in Vault, so it releases secrets as late as DMH runs actions.
+func updateVaultExtend(vaultURL string, vaultClientUUID string, vaultToken string, extend time.Duration) error {
+	endpointAddress, err := url.JoinPath(vaultURL, "api", "vault", "alive", vaultClientUUID, "extend")
+	if err != nil {
+		return fmt.Errorf("unable to parse address: %w", err)
+	}
+	body, err := json.Marshal(&vaultExtendRequest{ExtendSeconds: int64(extend / time.Second)})
+	if err != nil {
+		return err
+	}
+	req, err := newRequest("POST", endpointAddress, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("unable to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if vaultToken != "" {
+		req.Header.Set("Authorization", "Bearer "+vaultToken)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %w", state.ErrVaultUnreachable, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("wrong http status code received from vault: %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// getMaintenanceHandler returns current maintenance.
+func getMaintenanceHandler(s state.StateInterface) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		render.JSON(w, r, newMaintenanceResponse(s.GetMaintenance()))
+	}
+}
+
+// setMaintenanceHandler enables maintenance, every action fires extend later than usual.
+// Vault is updated first, so it never releases secrets earlier than DMH runs actions.
+// Setting maintenance is not a check-in, last seen is not changed.
+func setMaintenanceHandler(s state.StateInterface, vaultURLs []string, vaultClientUUID string, vaultToken string) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		request := &maintenanceRequest{}
+		if err := render.Bind(r, request); err != nil {
+			logf(r, "wrong request data provided: %s", err)
+			render.Render(w, r, statusErrBind(err))
+			return
+		}
+
+		err := updateVaults(vaultURLs, func(vaultURL string) error {
+			return updateVaultExtend(vaultURL, vaultClientUUID, vaultToken, request.duration)
+		})
+		if err != nil {
+			logf(r, "unable to update maintenance in vault: %s", err)
+			renderVaultUpdateErr(w, r, err)
+			return
+		}
+		s.SetMaintenance(request.duration)
+		logf(r, "maintenance enabled, actions are extended by %s", request.duration)
+		render.JSON(w, r, newMaintenanceResponse(s.GetMaintenance()))
+	}
+}
+
+// clearMaintenanceHandler disables maintenance.
+func clearMaintenanceHandler(s state.StateInterface, vaultURLs []string, vaultClientUUID string, vaultToken string) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		err := updateVaults(vaultURLs, func(vaultURL string) error {
+			return updateVaultExtend(vaultURL, vaultClientUUID, vaultToken, 0)
+		})
+		if err != nil {
+			logf(r, "unable to update maintenance in vault: %s", err)
+			renderVaultUpdateErr(w, r, err)
+			return
+		}
+		s.ClearMaintenance()
+		logf(r, "maintenance disabled")
+		render.JSON(w, r, newMaintenanceResponse(nil))
+	}
+}
+
+// vaultExtendHandler sets maintenance extension of client in Vault.
+func vaultExtendHandler(v vault.VaultInterface) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		paramClientUUID := chi.URLParam(r, "clientUUID")
+		if paramClientUUID == "" {
+			logf(r, "wrong clientUUID provided")
+			render.Render(w, r, StatusErrNotFound(nil))
+			return
+		}
+
+		request := &vaultExtendRequest{}
+		if err := render.Bind(r, request); err != nil {
+			logf(r, "wrong request data provided: %s", err)
+			render.Render(w, r, statusErrBind(err))
+			return
+		}
+		v.SetExtend(paramClientUUID, time.Duration(request.ExtendSeconds)*time.Second)
+		render.Render(w, r, StatusOK(http.StatusOK))
+	}
+}
@@ -0,0 +1,205 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"dmh/internal/state"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseExtend(t *testing.T) {
+	tests := []struct {
+		inputExtend      string
+		expectedDuration time.Duration
+		expectedError    bool
+	}{
+		{inputExtend: "14d", expectedDuration: 14 * 24 * time.Hour},
+		{inputExtend: "36h", expectedDuration: 36 * time.Hour},
+		{inputExtend: "1h30m", expectedDuration: 90 * time.Minute},
+		{inputExtend: "d", expectedError: true},
+		{inputExtend: "1.5d", expectedError: true},
+		{inputExtend: "", expectedError: true},
+		{inputExtend: "two weeks", expectedError: true},
+	}
+	for _, test := range tests {
+		d, err := parseExtend(test.inputExtend)
+		if test.expectedError {
+			require.Error(t, err, "extend %q", test.inputExtend)
+			continue
+		}
+		require.Nil(t, err)
+		require.Equal(t, test.expectedDuration, d)
+	}
+}
+
+func TestSetMaintenanceHandler(t *testing.T) {
+	since := time.Date(2025, 3, 26, 14, 0, 0, 0, time.UTC)
+	tests := []struct {
+		payload           string
+		vaultStatus       int
+		mockStateFunc     func() *mockState
+		expectedCode      int
+		expectedErrCode   string
+		expectedVaultBody string
+		expectedResponse  string
+	}{
+		{
+			payload:     `{"extend": "14d"}`,
+			vaultStatus: http.StatusOK,
+			mockStateFunc: func() *mockState {
+				s := new(mockState)
+				s.On("SetMaintenance", 14*24*time.Hour).Return()
+				s.On("GetMaintenance").Return(&state.Maintenance{Extend: 14 * 24 * time.Hour, Since: since})
+				return s
+			},
+			expectedCode:      http.StatusOK,
+			expectedVaultBody: `{"extend_seconds":1209600}`,
+			expectedResponse:  `{"enabled":true,"extend":"336h0m0s","since":"2025-03-26T14:00:00Z"}`,
+		},
+		{
+			payload:         `{"extend": "0s"}`,
+			mockStateFunc:   func() *mockState { return new(mockState) },
+			expectedCode:    http.StatusBadRequest,
+			expectedErrCode: CodeInvalidPayload,
+		},
+		{
+			payload:         `{"extend": "two weeks"}`,
+			mockStateFunc:   func() *mockState { return new(mockState) },
+			expectedCode:    http.StatusBadRequest,
+			expectedErrCode: CodeInvalidPayload,
+		},
+		{
+			payload:           `{"extend": "36h"}`,
+			vaultStatus:       http.StatusForbidden,
+			mockStateFunc:     func() *mockState { return new(mockState) },
+			expectedCode:      http.StatusInternalServerError,
+			expectedErrCode:   CodeVaultError,
+			expectedVaultBody: `{"extend_seconds":129600}`,
+		},
+	}
+	for _, test := range tests {
+		var vaultBody string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			require.Equal(t, "POST", r.Method)
+			require.Equal(t, "/api/vault/alive/client-uuid/extend", r.URL.Path)
+			require.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+			body, err := io.ReadAll(r.Body)
+			require.Nil(t, err)
+			vaultBody = string(body)
+			w.WriteHeader(test.vaultStatus)
+		}))
+
+		s := test.mockStateFunc()
+		req := httptest.NewRequest("POST", "/api/maintenance", bytes.NewBufferString(test.payload))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		setMaintenanceHandler(s, []string{server.URL}, "client-uuid", "token")(w, req)
+		server.Close()
+
+		require.Equal(t, test.expectedCode, w.Code)
+		requireErrCode(t, test.expectedErrCode, w)
+		require.Equal(t, test.expectedVaultBody, vaultBody)
+		if test.expectedResponse != "" {
+			require.JSONEq(t, test.expectedResponse, w.Body.String())
+		}
+		s.AssertExpectations(t)
+	}
+}
+
+func TestClearMaintenanceHandler(t *testing.T) {
+	var vaultBody string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.Nil(t, err)
+		vaultBody = string(body)
+	}))
+	defer server.Close()
+
+	s := new(mockState)
+	s.On("ClearMaintenance").Return()
+	req := httptest.NewRequest("DELETE", "/api/maintenance", nil)
+	w := httptest.NewRecorder()
+	clearMaintenanceHandler(s, []string{server.URL}, "client-uuid", "")(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, `{"extend_seconds":0}`, vaultBody)
+	require.JSONEq(t, `{"enabled":false}`, w.Body.String())
+	s.AssertExpectations(t)
+
+	// maintenance is kept when vault can't be updated.
+	s = new(mockState)
+	w = httptest.NewRecorder()
+	clearMaintenanceHandler(s, []string{"http://127.0.0.1:0"}, "client-uuid", "")(w, req)
+	require.Equal(t, http.StatusInternalServerError, w.Code)
+	requireErrCode(t, CodeVaultUnreachable, w)
+	s.AssertNotCalled(t, "ClearMaintenance")
+}
+
+func TestGetMaintenanceHandler(t *testing.T) {
+	since := time.Date(2025, 3, 26, 14, 0, 0, 0, time.UTC)
+	tests := []struct {
+		inputMaintenance *state.Maintenance
+		expectedResponse string
+	}{
+		{expectedResponse: `{"enabled":false}`},
+		{
+			inputMaintenance: &state.Maintenance{Extend: 36 * time.Hour, Since: since},
+			expectedResponse: `{"enabled":true,"extend":"36h0m0s","since":"2025-03-26T14:00:00Z"}`,
+		},
+	}
+	for _, test := range tests {
+		s := new(mockState)
+		if test.inputMaintenance == nil {
+			s.On("GetMaintenance").Return(nil)
+		} else {
+			s.On("GetMaintenance").Return(test.inputMaintenance)
+		}
+		w := httptest.NewRecorder()
+		getMaintenanceHandler(s)(w, httptest.NewRequest("GET", "/api/maintenance", nil))
+		require.Equal(t, http.StatusOK, w.Code)
+		require.JSONEq(t, test.expectedResponse, w.Body.String())
+	}
+}
+
+func TestVaultExtendHandler(t *testing.T) {
+	tests := []struct {
+		inputClientUUID string
+		payload         string
+		expectedExtend  time.Duration
+		expectedCode    int
+		expectedErrCode string
+	}{
+		{inputClientUUID: "", payload: `{"extend_seconds": 60}`, expectedCode: http.StatusNotFound, expectedErrCode: CodeNotFound},
+		{inputClientUUID: "test", payload: `{"extend_seconds": -1}`, expectedCode: http.StatusBadRequest, expectedErrCode: CodeInvalidPayload},
+		{inputClientUUID: "test", payload: `{"extend_seconds": 60}`, expectedExtend: time.Minute, expectedCode: http.StatusOK},
+		{inputClientUUID: "test", payload: `{"extend_seconds": 0}`, expectedCode: http.StatusOK},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest("POST", "/api/vault/alive/test/extend", bytes.NewBufferString(test.payload))
+		req.Header.Set("Content-Type", "application/json")
+		ctx := chi.NewRouteContext()
+		ctx.URLParams.Add("clientUUID", test.inputClientUUID)
+		req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, ctx))
+		w := httptest.NewRecorder()
+
+		v := new(mockVault)
+		v.On("SetExtend", test.inputClientUUID, test.expectedExtend).Return()
+		vaultExtendHandler(v)(w, req)
+
+		require.Equal(t, test.expectedCode, w.Code)
+		requireErrCode(t, test.expectedErrCode, w)
+		if test.expectedCode == http.StatusOK {
+			v.AssertExpectations(t)
+		} else {
+			v.AssertNotCalled(t, "SetExtend", test.inputClientUUID, test.expectedExtend)
+		}
+	}
+}
@@ -1,6 +1,8 @@
 package api
 
 import (
+	"time"
+
 	"dmh/internal/auth"
 	"dmh/internal/execute"
 	"dmh/internal/metric"
@@ -12,16 +14,44 @@ var (
 	HTTPPort = 8080
 )
 
+// LastSeenMetaConfig controls recording where check-ins come from.
+type LastSeenMetaConfig struct {
+	Enabled bool
+	// TrustForwardedFor takes source address from X-Forwarded-For header set by reverse proxy.
+	TrustForwardedFor bool
+}
+
 type Options struct {
-	Vault           vault.VaultInterface
-	State           state.StateInterface
-	Execute         execute.ExecuteInterface
-	Auth            auth.Config
-	VaultURL        string
-	VaultClientUUID string
-	VaultToken      string
-	DMHEnabled      bool
-	VaultEnabled    bool
-	Debug           bool
-	Metric          *metric.PromCollector
+	Vault    vault.VaultInterface
+	State    state.StateInterface
+	Execute  execute.ExecuteInterface
+	Auth     auth.Config
+	VaultURL string
+	// AdditionalVaultURLs are vaults which action vault_url may point to, check-ins and maintenance are sent to them too.
+	AdditionalVaultURLs []string
+	VaultClientUUID     string
+	VaultToken          string
+	DMHEnabled          bool
+	VaultEnabled        bool
+	Debug               bool
+	Metric              *metric.PromCollector
+	LastSeenMeta        LastSeenMetaConfig
+	// ActionProcessUnit is default time unit for action ProcessAfter and MinInterval.
+	ActionProcessUnit time.Duration
+	// RequiredSources are check-in sources which all must be seen, check-in without source is rejected.
+	RequiredSources []string
+	// EventsEnabled exposes /api/events stream of action lifecycle events.
+	EventsEnabled bool
+	// Readiness is reported by /readyz, nil is always ready.
+	Readiness *Readiness
+	// Tokens are bearer tokens used when auth is enabled, nil means static Auth.Bearer.Tokens.
+	Tokens *auth.TokenStore
+	// ActionVerifyURL is public DMH address used in action verification links, empty disables verification.
+	ActionVerifyURL string
+	// MaxBodyBytes caps request body size, 0 is default 1 MiB.
+	MaxBodyBytes int64
+	// ActionMaxDataBytes caps action data size, 0 is unlimited.
+	ActionMaxDataBytes int
+	// AliveCronToken is sha256 hash of token accepted by GET /api/alive/{token}, empty disables it.
+	AliveCronToken string
 }
@@ -0,0 +1,59 @@
+package api
+
+import (
+	"slices"
+	"sync"
+)
+
+// Readiness components registered by main.
+const (
+	ReadyState            = "state"              // DMH state loaded
+	ReadyVault            = "vault"              // vault component loaded
+	ReadyRemoteVaultProbe = "remote_vault_probe" // remote vault responded at least once
+	ReadyRemoteVaultLink  = "remote_vault_link"  // remote vault was not unreachable for too long when decrypting actions
+)
+
+// Readiness tracks components which must finish startup before instance can serve requests.
+type Readiness struct {
+	mtx     sync.RWMutex
+	pending map[string]struct{}
+}
+
+// NewReadiness returns Readiness waiting for all components.
+func NewReadiness(components ...string) *Readiness {
+	r := &Readiness{pending: make(map[string]struct{}, len(components))}
+	for _, c := range components {
+		r.pending[c] = struct{}{}
+	}
+	return r
+}
+
+// SetReady marks component as ready, component stays ready until SetNotReady.
+func (r *Readiness) SetReady(component string) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	delete(r.pending, component)
+}
+
+// SetNotReady marks component as not ready again.
+func (r *Readiness) SetNotReady(component string) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.pending[component] = struct{}{}
+}
+
+// Pending returns sorted components which are not ready yet.
+// Nil Readiness is always ready.
+func (r *Readiness) Pending() []string {
+	if r == nil {
+		return nil
+	}
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+	pending := make([]string, 0, len(r.pending))
+	for c := range r.pending {
+		pending = append(pending, c)
+	}
+	slices.Sort(pending)
+	return pending
+}
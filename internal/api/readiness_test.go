@@ -0,0 +1,30 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadiness(t *testing.T) {
+	var nilReadiness *Readiness
+	require.Empty(t, nilReadiness.Pending())
+
+	r := NewReadiness(ReadyVault, ReadyState, ReadyRemoteVaultProbe)
+	require.Equal(t, []string{ReadyRemoteVaultProbe, ReadyState, ReadyVault}, r.Pending())
+
+	r.SetReady(ReadyState)
+	r.SetReady("unknown")
+	require.Equal(t, []string{ReadyRemoteVaultProbe, ReadyVault}, r.Pending())
+
+	r.SetReady(ReadyVault)
+	r.SetReady(ReadyRemoteVaultProbe)
+	require.Empty(t, r.Pending())
+
+	r.SetNotReady(ReadyRemoteVaultLink)
+	require.Equal(t, []string{ReadyRemoteVaultLink}, r.Pending())
+	r.SetReady(ReadyRemoteVaultLink)
+	require.Empty(t, r.Pending())
+
+	require.Empty(t, NewReadiness().Pending())
+}
@@ -1,6 +1,8 @@
 package api
 
 import (
+	"net/http"
+
 	"dmh/internal/auth"
 
 	"github.com/go-chi/chi/v5"
@@ -8,52 +10,156 @@ import (
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
-// maxRequestBodyBytes caps request bodies accepted from clients.
+// maxRequestBodyBytes caps request bodies accepted from clients when Options.MaxBodyBytes is not set.
 const maxRequestBodyBytes = 1 << 20 // 1 MiB
 
+// compressLevel is gzip/deflate level used for API responses.
+const compressLevel = 5
+
+// compress compresses responses for clients sending Accept-Encoding.
+// /metrics is skipped, promhttp negotiates compression on its own.
+// SSE streams are not compressed, text/event-stream is not compressible type.
+func compress(next http.Handler) http.Handler {
+	compressed := middleware.Compress(compressLevel)(next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/metrics" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		compressed.ServeHTTP(w, r)
+	})
+}
+
+// enabledComponents returns names of components enabled in opts.
+func enabledComponents(opts *Options) []string {
+	components := []string{}
+	if opts.DMHEnabled {
+		components = append(components, "dmh")
+	}
+	if opts.VaultEnabled {
+		components = append(components, "vault")
+	}
+	return components
+}
+
 // NewRouter creates http router.
 func NewRouter(opts *Options) *chi.Mux {
 	httpRouter := chi.NewRouter()
 
+	maxBodyBytes := opts.MaxBodyBytes
+	if maxBodyBytes <= 0 {
+		maxBodyBytes = maxRequestBodyBytes
+	}
+
+	tokens := opts.Tokens
+	if tokens == nil {
+		// Store without rotation file can't fail.
+		tokens, _ = auth.NewTokenStore(opts.Auth.Bearer.Tokens, "")
+	}
+
+	// Every vault which can hold action keys must see check-ins and maintenance.
+	vaultURLs := append([]string{opts.VaultURL}, opts.AdditionalVaultURLs...)
+
 	httpRouter.Group(func(r chi.Router) {
+		r.Use(requestID)
 		if opts.Auth.Enabled {
 			r.Use(auth.SeedIdentity)
 		}
 		r.Use(middleware.RequestLogger(apiLogFormatter{}))
 		r.Use(middleware.CleanPath)
 		r.Use(middleware.Recoverer)
-		r.Use(middleware.RequestSize(maxRequestBodyBytes))
+		r.Use(compress)
+		r.Use(middleware.RequestSize(maxBodyBytes))
 		r.Use(metricsMiddleware(opts.Metric))
 		if opts.Auth.Enabled {
-			r.Use(auth.BearerAuthenticator(opts.Auth.Bearer.Tokens))
+			r.Use(auth.BearerAuthenticator(tokens))
 			r.Use(auth.SignedURLAuthenticator(opts.Auth.SignedURL.Secret))
+			if opts.DMHEnabled && opts.AliveCronToken != "" {
+				r.Use(auth.AliveCronAuthenticator(opts.AliveCronToken))
+			}
 			r.Use(logIdentity)
 			r.Use(auth.Authorizer(opts.Auth.AnonymousScopes))
 		}
-		r.Get("/ready", healthHandler())
 		r.Get("/healthz", healthHandler())
+		r.Get("/readyz", readyHandler(opts.Readiness))
+		r.Get("/ready", readyHandler(opts.Readiness))
 		r.Method("GET", "/metrics", promhttp.Handler())
+		r.Get("/api/version", versionHandler(enabledComponents(opts)))
+		if opts.Auth.Enabled && tokens.Persistent() {
+			r.Route("/api/admin/rotate-key", func(r chi.Router) {
+				r.Post("/", rotateKeyHandler(tokens))
+			})
+		}
 		if opts.Debug {
 			r.Mount("/debug", middleware.Profiler())
 		}
 		if opts.DMHEnabled {
 			r.Route("/alive", func(r chi.Router) {
 				r.Get("/", aliveWebHandler())
-				r.Post("/", aliveHandler(opts.State, opts.VaultURL, opts.VaultClientUUID, opts.VaultToken))
+				r.Post("/", aliveHandler(opts.State, vaultURLs, opts.VaultClientUUID, opts.VaultToken, opts.LastSeenMeta, opts.RequiredSources, opts.ActionProcessUnit))
 			})
 			r.Route("/api/alive", func(r chi.Router) {
-				r.Get("/", aliveHandler(opts.State, opts.VaultURL, opts.VaultClientUUID, opts.VaultToken))
-				r.Post("/", aliveHandler(opts.State, opts.VaultURL, opts.VaultClientUUID, opts.VaultToken))
+				r.Get("/", aliveHandler(opts.State, vaultURLs, opts.VaultClientUUID, opts.VaultToken, opts.LastSeenMeta, opts.RequiredSources, opts.ActionProcessUnit))
+				r.Post("/", aliveHandler(opts.State, vaultURLs, opts.VaultClientUUID, opts.VaultToken, opts.LastSeenMeta, opts.RequiredSources, opts.ActionProcessUnit))
+				r.Delete("/", goneHandler(opts.State, opts.ActionProcessUnit))
+				if opts.AliveCronToken != "" {
+					r.Get("/{token}", aliveCronHandler(opts.AliveCronToken, aliveHandler(opts.State, vaultURLs, opts.VaultClientUUID, opts.VaultToken, opts.LastSeenMeta, opts.RequiredSources, opts.ActionProcessUnit)))
+				}
+			})
+			r.Route("/api/maintenance", func(r chi.Router) {
+				r.Get("/", getMaintenanceHandler(opts.State))
+				r.Post("/", setMaintenanceHandler(opts.State, vaultURLs, opts.VaultClientUUID, opts.VaultToken))
+				r.Delete("/", clearMaintenanceHandler(opts.State, vaultURLs, opts.VaultClientUUID, opts.VaultToken))
+			})
+			r.Route("/ui", func(r chi.Router) {
+				r.Get("/", statusWebHandler(opts.State, opts.ActionProcessUnit))
+			})
+			r.Route("/api/status", func(r chi.Router) {
+				r.Get("/", statusHandler(opts.State, opts.ActionProcessUnit))
+			})
+			if opts.EventsEnabled {
+				r.Route("/api/events", func(r chi.Router) {
+					r.Get("/", eventsHandler(opts.State))
+				})
+			}
+			r.Route("/api/fired", func(r chi.Router) {
+				r.Get("/", firedLogHandler(opts.State))
 			})
 			r.Route("/api/action/test", func(r chi.Router) {
-				r.Post("/", testActionHandler(opts.Execute, opts.Auth))
+				r.Post("/", testActionHandler(opts.Execute, opts.Auth, opts.ActionMaxDataBytes))
+			})
+			r.Route("/api/action/validate", func(r chi.Router) {
+				r.Post("/", validateActionHandler(opts.Execute, opts.Auth, opts.ActionMaxDataBytes))
+			})
+			r.Route("/api/action/preview", func(r chi.Router) {
+				r.Post("/", previewActionHandler(opts.Execute, opts.Auth, opts.ActionMaxDataBytes))
+			})
+			r.Route("/api/action/verify/{token}", func(r chi.Router) {
+				r.Get("/", verifyActionHandler(opts.State))
+			})
+			r.Route("/api/receipt/{token}", func(r chi.Router) {
+				r.Post("/", receiptHandler(opts.State))
+			})
+			r.Route("/api/action/export/decrypted", func(r chi.Router) {
+				r.Get("/", exportDecryptedActionsHandler(opts.State))
+			})
+			r.Route("/api/panic", func(r chi.Router) {
+				r.Post("/", panicHandler(opts.State, opts.Metric))
+			})
+			r.Route("/api/action/purge", func(r chi.Router) {
+				r.Post("/", purgeActionsHandler(opts.State))
+			})
+			r.Route("/api/action/reorder", func(r chi.Router) {
+				r.Post("/", reorderActionsHandler(opts.State))
 			})
 			r.Route("/api/action/store", func(r chi.Router) {
-				r.Get("/", listActionsHandler(opts.State))
-				r.Post("/", addActionHandler(opts.State, opts.Auth))
+				r.Get("/", listActionsHandler(opts.State, opts.ActionProcessUnit))
+				r.Post("/", addActionHandler(opts.State, opts.Execute, opts.Auth, opts.ActionVerifyURL, opts.ActionProcessUnit, opts.ActionMaxDataBytes))
 				r.Route("/{actionUUID}", func(r chi.Router) {
-					r.Get("/", getActionHandler(opts.State))
-					r.Delete("/", deleteActionHandler(opts.State))
+					r.Get("/", getActionHandler(opts.State, opts.ActionProcessUnit))
+					r.Delete("/", deleteActionHandler(opts.State, opts.Metric))
+					r.Post("/cancel-fire", cancelFireHandler(opts.State, opts.Metric))
+					r.Post("/rehearse", rehearseActionHandler(opts.State, opts.Execute))
 				})
 			})
 		}
@@ -61,16 +167,28 @@ func NewRouter(opts *Options) *chi.Mux {
 			r.Route("/api/vault/alive", func(r chi.Router) {
 				r.Route("/{clientUUID}", func(r chi.Router) {
 					r.Get("/", vaultAliveHandler(opts.Vault))
+					r.Delete("/", vaultGoneHandler(opts.Vault))
+					r.Post("/extend", vaultExtendHandler(opts.Vault))
+					r.Post("/partial", vaultPartialAliveHandler(opts.Vault))
 				})
 			})
 			r.Route("/api/vault/store", func(r chi.Router) {
+				r.Post("/{clientUUID}/release-all", releaseAllVaultSecretsHandler(opts.Vault))
 				r.Route("/{clientUUID}/{secretUUID}", func(r chi.Router) {
 					r.MethodFunc("GET", "/", getVaultSecretHandler(opts.Vault))
 					r.MethodFunc("HEAD", "/", getVaultSecretHandler(opts.Vault))
 					r.Post("/", addVaultSecretHandler(opts.Vault))
 					r.Delete("/", deleteVaultSecretHandler(opts.Vault))
+					r.Post("/extend", extendVaultSecretHandler(opts.Vault))
+					r.Get("/status", getVaultSecretStatusHandler(opts.Vault))
 				})
 			})
+			r.Route("/api/vault/info", func(r chi.Router) {
+				r.Get("/", vaultInfoHandler(opts.Vault))
+			})
+			r.Route("/api/vault/events", func(r chi.Router) {
+				r.Get("/", listVaultEventsHandler(opts.Vault))
+			})
 		}
 	})
 
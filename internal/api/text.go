@@ -0,0 +1,74 @@
+package api
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"dmh/internal/state"
+
+	"github.com/go-chi/render"
+)
+
+// acceptedMediaType returns first media type from Accept header, or empty string when it can't be parsed.
+func acceptedMediaType(r *http.Request) string {
+	accept, _, _ := strings.Cut(r.Header.Get("Accept"), ",")
+	mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(accept))
+	if err != nil {
+		return ""
+	}
+	return mediaType
+}
+
+// wantsText returns true when client prefers text/plain over JSON.
+// Only first media type from Accept header is checked, JSON stays default.
+func wantsText(r *http.Request) bool {
+	return acceptedMediaType(r) == "text/plain"
+}
+
+// wantsJSON returns true when client explicitly asks for application/json.
+// Unlike wantsText, */* or missing Accept header don't count.
+func wantsJSON(r *http.Request) bool {
+	return acceptedMediaType(r) == "application/json"
+}
+
+// formatTime returns RFC3339 time, or - for zero time.
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Format(time.RFC3339)
+}
+
+// renderActionsText writes actions as human readable table.
+// Encrypted action data is not shown.
+func renderActionsText(w http.ResponseWriter, r *http.Request, actions []*state.EncryptedAction) {
+	var b strings.Builder
+	tw := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "UUID\tKIND\tPROCESS AFTER\tMIN INTERVAL\tPROCESSED\tLAST RUN\tCOMMENT")
+	for _, a := range actions {
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%d\t%s\t%s\n", a.UUID, a.Kind, a.ProcessAfter, a.MinInterval, a.Processed, formatTime(a.LastRun), a.Comment)
+	}
+	tw.Flush()
+	render.PlainText(w, r, b.String())
+}
+
+// renderStatusText writes status as human readable key-value lines.
+func renderStatusText(w http.ResponseWriter, r *http.Request, status *statusResponse) {
+	var b strings.Builder
+	tw := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "last seen:\t%s\n", formatTime(status.LastSeen))
+	if m := status.LastSeenMeta; m != nil {
+		fmt.Fprintf(tw, "last seen from:\t%s %s\n", m.IP, m.UserAgent)
+	}
+	if status.NextActionAt != nil {
+		fmt.Fprintf(tw, "next action:\t%s at %s\n", status.NextActionUUID, formatTime(*status.NextActionAt))
+	} else {
+		fmt.Fprintln(tw, "next action:\t-")
+	}
+	tw.Flush()
+	render.PlainText(w, r, b.String())
+}
@@ -0,0 +1,142 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"dmh/internal/state"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWantsText(t *testing.T) {
+	tests := []struct {
+		inputAccept string
+		expected    bool
+	}{
+		{inputAccept: "", expected: false},
+		{inputAccept: "*/*", expected: false},
+		{inputAccept: "application/json", expected: false},
+		{inputAccept: "text/plain", expected: true},
+		{inputAccept: "text/plain; charset=utf-8", expected: true},
+		{inputAccept: "text/plain, application/json", expected: true},
+		{inputAccept: "application/json, text/plain", expected: false},
+		{inputAccept: "text/plain;;", expected: false},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Accept", test.inputAccept)
+		require.Equal(t, test.expected, wantsText(r), "accept %q", test.inputAccept)
+	}
+}
+
+func TestWantsJSON(t *testing.T) {
+	tests := []struct {
+		inputAccept string
+		expected    bool
+	}{
+		{inputAccept: "", expected: false},
+		{inputAccept: "*/*", expected: false},
+		{inputAccept: "text/plain", expected: false},
+		{inputAccept: "application/json", expected: true},
+		{inputAccept: "application/json; charset=utf-8", expected: true},
+		{inputAccept: "application/json, text/plain", expected: true},
+		{inputAccept: "text/plain, application/json", expected: false},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Accept", test.inputAccept)
+		require.Equal(t, test.expected, wantsJSON(r), "accept %q", test.inputAccept)
+	}
+}
+
+func TestRenderActionsText(t *testing.T) {
+	lastRun := time.Date(2025, 3, 26, 14, 0, 0, 0, time.UTC)
+	actions := []*state.EncryptedAction{
+		{UUID: "a", Action: state.Action{Kind: "mail", ProcessAfter: 10, Comment: "first", Data: "secret"}},
+		{UUID: "bb", Action: state.Action{Kind: "dummy", ProcessAfter: 2, MinInterval: 1}, Processed: 1, LastRun: lastRun},
+	}
+
+	r := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	renderActionsText(w, r, actions)
+
+	require.Equal(t, "text/plain; charset=utf-8", w.Header().Get("Content-Type"))
+	require.Equal(t, ""+
+		"UUID  KIND   PROCESS AFTER  MIN INTERVAL  PROCESSED  LAST RUN              COMMENT\n"+
+		"a     mail   10             0             0          -                     first\n"+
+		"bb    dummy  2              1             1          2025-03-26T14:00:00Z  \n",
+		w.Body.String())
+	require.NotContains(t, w.Body.String(), "secret")
+}
+
+func TestRenderStatusText(t *testing.T) {
+	lastSeen := time.Date(2025, 3, 26, 14, 0, 0, 0, time.UTC)
+	nextAction := lastSeen.Add(time.Hour)
+	tests := []struct {
+		inputStatus *statusResponse
+		expected    string
+	}{
+		{
+			inputStatus: &statusResponse{LastSeen: lastSeen},
+			expected: "" +
+				"last seen:    2025-03-26T14:00:00Z\n" +
+				"next action:  -\n",
+		},
+		{
+			inputStatus: &statusResponse{
+				LastSeen:       lastSeen,
+				LastSeenMeta:   &state.LastSeenMeta{IP: "127.0.0.1", UserAgent: "curl"},
+				NextActionAt:   &nextAction,
+				NextActionUUID: "a",
+			},
+			expected: "" +
+				"last seen:       2025-03-26T14:00:00Z\n" +
+				"last seen from:  127.0.0.1 curl\n" +
+				"next action:     a at 2025-03-26T15:00:00Z\n",
+		},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		w := httptest.NewRecorder()
+		renderStatusText(w, r, test.inputStatus)
+		require.Equal(t, test.expected, w.Body.String())
+	}
+}
+
+func TestHandlersAcceptText(t *testing.T) {
+	s := new(mockState)
+	s.On("GetActions").Return([]*state.EncryptedAction{{UUID: "test", Action: state.Action{Kind: "mail", ProcessAfter: 1}}})
+	s.On("GetAction", "test").Return(&state.EncryptedAction{UUID: "test", Action: state.Action{Kind: "mail", ProcessAfter: 1}}, 0)
+	s.On("GetLastSeen").Return(time.Date(2025, 3, 26, 14, 0, 0, 0, time.UTC))
+	s.On("GetMaintenance").Return(nil)
+	s.On("GetLastSeenMeta").Return(nil)
+
+	tests := []struct {
+		inputHandler     http.HandlerFunc
+		inputAccept      string
+		expectedContains string
+	}{
+		{inputHandler: listActionsHandler(s, time.Hour), inputAccept: "text/plain", expectedContains: "UUID  KIND"},
+		{inputHandler: listActionsHandler(s, time.Hour), inputAccept: "application/json", expectedContains: `"uuid":"test"`},
+		{inputHandler: getActionHandler(s, time.Hour), inputAccept: "text/plain", expectedContains: "test  mail"},
+		{inputHandler: getActionHandler(s, time.Hour), expectedContains: `"uuid":"test"`},
+		{inputHandler: statusHandler(s, time.Hour), inputAccept: "text/plain", expectedContains: "next action:  test at 2025-03-26T15:00:00Z"},
+		{inputHandler: statusHandler(s, time.Hour), inputAccept: "*/*", expectedContains: `"next_action_uuid":"test"`},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Accept", test.inputAccept)
+		ctx := chi.NewRouteContext()
+		ctx.URLParams.Add("actionUUID", "test")
+		r = r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, ctx))
+		w := httptest.NewRecorder()
+		test.inputHandler(w, r)
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Contains(t, w.Body.String(), test.expectedContains)
+	}
+}
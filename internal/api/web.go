@@ -1,8 +1,14 @@
 package api
 
 import (
+	"bytes"
 	_ "embed"
+	"html/template"
 	"net/http"
+	"time"
+
+	"dmh/internal/state"
+	"dmh/internal/vault"
 
 	"github.com/go-chi/render"
 )
@@ -12,9 +18,67 @@ import (
 //go:embed alive.html
 var aliveWebPage string
 
+// statusWebPage is template of read-only status page.
+//
+//go:embed status.html
+var statusWebPage string
+
+var statusWebTemplate = template.Must(template.New("status").Funcs(template.FuncMap{
+	"formatTime":    formatTime,
+	"processedName": processedName,
+}).Parse(statusWebPage))
+
+// statusWebData is rendered by statusWebTemplate.
+type statusWebData struct {
+	Now         time.Time
+	LastSeen    time.Time
+	Maintenance *state.Maintenance
+	ProcessUnit string
+	VaultError  string // empty when vault is reachable
+	Actions     []*actionResponse
+}
+
 // aliveWebHandler renders static page which allows humans to confirm they are alive.
 func aliveWebHandler() func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 		render.HTML(w, r, aliveWebPage)
 	}
 }
+
+// statusWebHandler renders read-only page with last seen, projected fire time and processed status
+// of every action and vault reachability, so users without CLI can confirm their setup works.
+func statusWebHandler(s state.StateInterface, actionProcessUnit time.Duration) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		data := &statusWebData{
+			Now:         time.Now(),
+			LastSeen:    s.GetLastSeen(),
+			Maintenance: s.GetMaintenance(),
+			ProcessUnit: vault.ProcessUnitName(actionProcessUnit),
+		}
+		data.Actions = newActionResponses(s.GetActions(), data.LastSeen, data.Maintenance.Duration(), actionProcessUnit)
+		if _, err := s.GetVaultProcessUnit(); err != nil {
+			data.VaultError = err.Error()
+		}
+
+		var b bytes.Buffer
+		if err := statusWebTemplate.Execute(&b, data); err != nil {
+			logf(r, "unable to render status page: %s", err)
+			render.Render(w, r, StatusErrInternal(nil))
+			return
+		}
+		render.HTML(w, r, b.String())
+	}
+}
+
+// processedName returns human readable EncryptedAction.Processed.
+func processedName(processed int) string {
+	switch processed {
+	case 0:
+		return "pending"
+	case 1:
+		return "executed"
+	case 2:
+		return "done"
+	}
+	return "unknown"
+}
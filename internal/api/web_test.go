@@ -1,9 +1,13 @@
 package api
 
 import (
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
+
+	"dmh/internal/state"
 
 	"github.com/stretchr/testify/require"
 )
@@ -21,3 +25,68 @@ func TestAliveWebHandler(t *testing.T) {
 	require.Contains(t, w.Body.String(), `<button id="alive">`)
 	require.Contains(t, w.Body.String(), `fetch(window.location.pathname + window.location.search, {method: "POST"})`)
 }
+
+func TestStatusWebHandler(t *testing.T) {
+	lastSeen := time.Date(2025, 3, 26, 14, 55, 40, 0, time.UTC)
+	tests := []struct {
+		inputActions     []*state.EncryptedAction
+		inputMaintenance *state.Maintenance
+		inputVaultErr    error
+		expectedBody     []string
+		notExpectedBody  []string
+	}{
+		{
+			inputActions: []*state.EncryptedAction{
+				{UUID: "pending", Action: state.Action{Kind: "mail", ProcessAfter: 2, Comment: "<b>comment</b>"}},
+				{UUID: "done", Action: state.Action{Kind: "json_post", ProcessAfter: 1}, Processed: 2, LastRun: lastSeen},
+			},
+			expectedBody: []string{
+				`<tr><th>Last seen</th><td>2025-03-26T14:55:40Z</td></tr>`,
+				`<span class="ok">reachable</span>`,
+				`<tr><td>pending</td><td>mail</td><td>&lt;b&gt;comment&lt;/b&gt;</td><td>pending</td><td>-</td><td>2025-03-26T16:55:40Z</td></tr>`,
+				`<tr><td>done</td><td>json_post</td><td></td><td>done</td><td>2025-03-26T14:55:40Z</td><td>-</td></tr>`,
+			},
+			notExpectedBody: []string{"Maintenance", "No actions configured"},
+		},
+		{
+			inputActions:     []*state.EncryptedAction{},
+			inputMaintenance: &state.Maintenance{Extend: time.Hour, Since: lastSeen},
+			inputVaultErr:    fmt.Errorf("connection refused"),
+			expectedBody: []string{
+				`<tr><th>Maintenance</th><td>since 2025-03-26T14:55:40Z, extends actions by 1h0m0s</td></tr>`,
+				`<span class="error">unreachable: connection refused</span>`,
+				"No actions configured, nothing is protected.",
+			},
+		},
+	}
+	for _, test := range tests {
+		s := new(mockState)
+		s.On("GetLastSeen").Return(lastSeen)
+		s.On("GetMaintenance").Return(test.inputMaintenance)
+		s.On("GetActions").Return(test.inputActions)
+		s.On("GetVaultProcessUnit").Return(time.Hour, test.inputVaultErr)
+
+		req, err := http.NewRequest("GET", "/ui", nil)
+		require.Nil(t, err)
+		w := httptest.NewRecorder()
+
+		handler := statusWebHandler(s, time.Hour)
+
+		handler(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Equal(t, "text/html; charset=utf-8", w.Header().Get("Content-Type"))
+		for _, expected := range test.expectedBody {
+			require.Contains(t, w.Body.String(), expected)
+		}
+		for _, notExpected := range test.notExpectedBody {
+			require.NotContains(t, w.Body.String(), notExpected)
+		}
+	}
+}
+
+func TestProcessedName(t *testing.T) {
+	require.Equal(t, "pending", processedName(0))
+	require.Equal(t, "executed", processedName(1))
+	require.Equal(t, "done", processedName(2))
+	require.Equal(t, "unknown", processedName(3))
+}
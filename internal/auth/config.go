@@ -1,7 +1,6 @@
 package auth
 
 import (
-	"encoding/hex"
 	"fmt"
 	"log"
 	"strings"
@@ -19,15 +18,30 @@ var (
 
 // Token describes single named bearer token.
 // Hash is hex-encoded sha256 of token plaintext, generated with dmh-cli.
+// Token with ClientUUID is vault client token, its scopes are derived from ClientUUID
+// so it can reach only secrets and heartbeat of this single client.
 type Token struct {
-	Name   string   `koanf:"name"`
-	Hash   string   `koanf:"hash"`
-	Scopes []string `koanf:"scope"`
+	Name       string   `koanf:"name"`
+	Hash       string   `koanf:"hash"`
+	Scopes     []string `koanf:"scope"`
+	ClientUUID string   `koanf:"client_uuid"`
+}
+
+// clientScopes returns scopes of vault client token.
+// api:vault:info is shared, DMH reads vault process unit from it.
+func clientScopes(clientUUID string) []string {
+	return []string{
+		"api:vault:store:" + clientUUID,
+		"api:vault:alive:" + clientUUID,
+		"api:vault:info",
+	}
 }
 
 // BearerConfig describes bearer token authentication config.
+// RotationFile stores hashes rotated with /api/admin/rotate-key, they override configured hashes.
 type BearerConfig struct {
-	Tokens []Token `koanf:"token"`
+	Tokens       []Token `koanf:"token"`
+	RotationFile string  `koanf:"rotation_file"`
 }
 
 // SignedURLConfig describes HMAC signed URL authentication config.
@@ -91,6 +105,7 @@ func (s *SignedURLConfig) Validate() error {
 }
 
 // Validate checks BearerConfig.
+// Scopes of vault client tokens are checked as derived from their ClientUUID, Tokens are not modified.
 func (b *BearerConfig) Validate() error {
 	if len(b.Tokens) == 0 {
 		return fmt.Errorf("auth.bearer.token is not configured, generate token with dmh-cli auth generate-bearer")
@@ -107,9 +122,8 @@ func (b *BearerConfig) Validate() error {
 		}
 		seenName[token.Name] = true
 
-		decodedHash, err := hex.DecodeString(token.Hash)
-		if err != nil || len(decodedHash) != 32 {
-			return fmt.Errorf("token %s hash must be a hex encoded sha256", token.Name)
+		if err := validateTokenHash(token.Hash); err != nil {
+			return fmt.Errorf("token %s %w", token.Name, err)
 		}
 		normalizedHash := strings.ToLower(token.Hash)
 		if seenHash[normalizedHash] {
@@ -117,10 +131,21 @@ func (b *BearerConfig) Validate() error {
 		}
 		seenHash[normalizedHash] = true
 
-		if len(token.Scopes) == 0 {
+		scopes := token.Scopes
+		if token.ClientUUID != "" {
+			if len(token.Scopes) > 0 {
+				return fmt.Errorf("token %s: scope and client_uuid are mutually exclusive", token.Name)
+			}
+			if strings.ContainsAny(token.ClientUUID, ":/") {
+				return fmt.Errorf("token %s: client_uuid cant contain ':' or '/'", token.Name)
+			}
+			scopes = clientScopes(token.ClientUUID)
+		}
+
+		if len(scopes) == 0 {
 			return fmt.Errorf("token %s must have at least one scope", token.Name)
 		}
-		for _, scope := range token.Scopes {
+		for _, scope := range scopes {
 			if err := validateScope(scope); err != nil {
 				return fmt.Errorf("token %s: %w", token.Name, err)
 			}
@@ -157,6 +157,22 @@ func TestBearerValidate(t *testing.T) {
 			},
 			expectedError: "token admin: scope cant be empty",
 		},
+		{
+			inputConfig: BearerConfig{
+				Tokens: []Token{
+					{Name: "client", Hash: testTokenHash, Scopes: []string{"api"}, ClientUUID: "client-uuid"},
+				},
+			},
+			expectedError: "token client: scope and client_uuid are mutually exclusive",
+		},
+		{
+			inputConfig: BearerConfig{
+				Tokens: []Token{
+					{Name: "client", Hash: testTokenHash, ClientUUID: "client:uuid"},
+				},
+			},
+			expectedError: "token client: client_uuid cant contain ':' or '/'",
+		},
 	}
 	for _, test := range tests {
 		err := test.inputConfig.Validate()
@@ -169,6 +185,38 @@ func TestBearerValidate(t *testing.T) {
 	}
 }
 
+func TestBearerValidateClientUUID(t *testing.T) {
+	b := BearerConfig{
+		Tokens: []Token{
+			{Name: "admin", Hash: testTokenHash, Scopes: []string{"api"}},
+			{Name: "client-a", Hash: otherHash, ClientUUID: "uuid-A"},
+		},
+	}
+	require.Nil(t, b.Validate())
+	// Validate never modifies config.
+	require.Nil(t, b.Tokens[1].Scopes)
+
+	ts, err := NewTokenStore(b.Tokens, "")
+	require.Nil(t, err)
+	tokens := ts.Tokens()
+	require.Equal(t, []string{"api"}, tokens[0].Scopes)
+	require.Equal(t, []string{"api:vault:store:uuid-A", "api:vault:alive:uuid-A", "api:vault:info"}, tokens[1].Scopes)
+	require.Nil(t, b.Tokens[1].Scopes)
+
+	for path, expected := range map[string]bool{
+		"/api/vault/store/uuid-A/secret": true,
+		"/api/vault/alive/uuid-A":        true,
+		"/api/vault/info":                true,
+		"/api/vault/store/uuid-B/secret": false,
+		"/api/vault/store/uuid-AB/x":     false,
+		"/api/vault/alive/uuid-B":        false,
+		"/api/vault/events":              false,
+		"/api/action/store":              false,
+	} {
+		require.Equal(t, expected, anyScopeCovers(tokens[1].Scopes, pathSegments(path)), path)
+	}
+}
+
 func TestSignedURLValidate(t *testing.T) {
 	tests := []struct {
 		inputConfig    SignedURLConfig
@@ -8,6 +8,7 @@ import (
 	"dmh/internal/crypt"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/render"
 )
 
@@ -22,18 +23,35 @@ const (
 	AuthTypeBearer    AuthType = "bearer"
 	AuthTypeSignedURL AuthType = "signed_url"
 	AuthTypeAnonymous AuthType = "anonymous"
+	AuthTypeAliveCron AuthType = "alive_cron"
 )
 
+// Error codes of rejected requests, same as codes of api error responses.
+const (
+	CodeUnauthorized = "unauthorized"
+	CodeForbidden    = "forbidden"
+)
+
+// errResponse has the same shape as api.ErrResponse, auth package can't import api.
+type errResponse struct {
+	StatusText string `json:"status"`
+	Code       string `json:"code"`
+	ErrorText  string `json:"error,omitempty"`
+	RequestID  string `json:"request_id,omitempty"`
+}
+
 // Identity describes the requester and, once the auth chain has run, the
 // outcome of authentication/authorization for the request.
 // Name is set only when a credential actually resolved to a principal.
 // Type and Reason are populated even on failure (e.g. Type=bearer,
 // Reason=invalid_token).
+// ClientUUID is set for vault client tokens.
 type Identity struct {
-	Name   string
-	Scopes []string
-	Type   AuthType
-	Reason string
+	Name       string
+	Scopes     []string
+	Type       AuthType
+	Reason     string
+	ClientUUID string
 }
 
 // IdentityFromContext returns Identity stored in ctx or nil.
@@ -69,8 +87,9 @@ func SeedIdentity(next http.Handler) http.Handler {
 // BearerAuthenticator returns middleware which resolves Authorization header
 // into Identity stored in request context.
 // Identity already resolved by other authenticators is never overwritten.
+// Tokens are read from TokenStore on every request, so rotated tokens are used immediately.
 // It never rejects requests, authorization is done by Authorizer.
-func BearerAuthenticator(tokens []Token) func(http.Handler) http.Handler {
+func BearerAuthenticator(tokens *TokenStore) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			r, id := ensureIdentity(r)
@@ -78,10 +97,11 @@ func BearerAuthenticator(tokens []Token) func(http.Handler) http.Handler {
 				if presented := bearerFromHeader(r); presented != "" {
 					id.Type = AuthTypeBearer
 					id.Reason = "invalid_token"
-					for _, token := range tokens {
+					for _, token := range tokens.Tokens() {
 						if crypt.ValidateBearerToken(token.Hash, presented) {
 							id.Name = token.Name
 							id.Scopes = token.Scopes
+							id.ClientUUID = token.ClientUUID
 							id.Reason = ""
 							break
 						}
@@ -120,6 +140,32 @@ func SignedURLAuthenticator(secret string) func(http.Handler) http.Handler {
 	}
 }
 
+// AliveCronAuthenticator returns middleware which resolves GET /api/alive/{token}
+// with valid alive cron token into Identity.
+// tokenHash is hex-encoded sha256 of token plaintext.
+// Identity scope is the requested path, so cron token authorizes only check-in.
+// It never rejects requests, authorization is done by Authorizer.
+func AliveCronAuthenticator(tokenHash string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r, id := ensureIdentity(r)
+			if id.Name == "" && r.Method == http.MethodGet {
+				path := requestPath(r)
+				if segs := pathSegments(path); len(segs) == 3 && segs[0] == "api" && segs[1] == "alive" {
+					id.Type = AuthTypeAliveCron
+					id.Reason = "invalid_token"
+					if crypt.ValidateBearerToken(tokenHash, segs[2]) {
+						id.Name = "alive-cron"
+						id.Scopes = []string{pathScope(path)}
+						id.Reason = ""
+					}
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
 // requestPath returns the path chi's router dispatches this request on
 // (cleaned by middleware.CleanPath), falling back to r.URL.Path when chi
 // hasn't set one.
@@ -132,6 +178,8 @@ func requestPath(r *http.Request) string {
 
 // Authorizer returns middleware enforcing scope based authorization (default deny).
 // Request is allowed when its path is covered by anonymous scope or Identity scope.
+// Request without credentials is rejected with 401 and WWW-Authenticate challenge,
+// request with invalid or insufficient credentials with 403.
 func Authorizer(anonymousScopes []string) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -154,9 +202,14 @@ func Authorizer(anonymousScopes []string) func(http.Handler) http.Handler {
 				id.Reason = "missing_credentials"
 			}
 
-			w.Header().Set("WWW-Authenticate", `Bearer realm="dmh"`)
-			render.Status(r, http.StatusUnauthorized)
-			render.JSON(w, r, map[string]string{"status": "Unauthorized."})
+			if id.Reason == "missing_credentials" {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="dmh"`)
+				render.Status(r, http.StatusUnauthorized)
+				render.JSON(w, r, &errResponse{StatusText: "Unauthorized.", Code: CodeUnauthorized, ErrorText: id.Reason, RequestID: middleware.GetReqID(r.Context())})
+				return
+			}
+			render.Status(r, http.StatusForbidden)
+			render.JSON(w, r, &errResponse{StatusText: "Forbidden.", Code: CodeForbidden, ErrorText: id.Reason, RequestID: middleware.GetReqID(r.Context())})
 		})
 	}
 }
@@ -172,7 +172,7 @@ func TestBearerAuthenticator(t *testing.T) {
 	}
 	for _, test := range tests {
 		var gotIdentity *Identity
-		handler := BearerAuthenticator(tokens)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler := BearerAuthenticator(newTestTokenStore(t, tokens))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			gotIdentity = IdentityFromContext(r.Context())
 		}))
 
@@ -221,14 +221,14 @@ func TestAuthorizer(t *testing.T) {
 		{
 			inputIdentity:  &Identity{Type: AuthTypeBearer, Reason: "invalid_token"},
 			inputPath:      "/api/action/store",
-			expectedCode:   http.StatusUnauthorized,
+			expectedCode:   http.StatusForbidden,
 			expectedType:   AuthTypeBearer,
 			expectedReason: "invalid_token",
 		},
 		{
 			inputIdentity:  &Identity{Type: AuthTypeSignedURL, Reason: "invalid_signature"},
 			inputPath:      "/api/action/store",
-			expectedCode:   http.StatusUnauthorized,
+			expectedCode:   http.StatusForbidden,
 			expectedType:   AuthTypeSignedURL,
 			expectedReason: "invalid_signature",
 		},
@@ -240,7 +240,7 @@ func TestAuthorizer(t *testing.T) {
 		{
 			inputIdentity:  &Identity{Name: "alive-cron", Scopes: []string{"api:alive"}},
 			inputPath:      "/api/action/store",
-			expectedCode:   http.StatusUnauthorized,
+			expectedCode:   http.StatusForbidden,
 			expectedReason: "insufficient_scope",
 		},
 		{
@@ -256,7 +256,7 @@ func TestAuthorizer(t *testing.T) {
 		{
 			inputIdentity:  &Identity{Name: "dmh", Scopes: []string{"api:vault:store:uuid-A", "api:vault:alive:uuid-A"}},
 			inputPath:      "/api/vault/store/uuid-AB",
-			expectedCode:   http.StatusUnauthorized,
+			expectedCode:   http.StatusForbidden,
 			expectedReason: "insufficient_scope",
 		},
 		{
@@ -270,7 +270,7 @@ func TestAuthorizer(t *testing.T) {
 			inputAnonymousScopes: []string{"healthz"},
 			inputIdentity:        &Identity{Name: "admin", Scopes: []string{"api"}},
 			inputPath:            "/",
-			expectedCode:         http.StatusUnauthorized,
+			expectedCode:         http.StatusForbidden,
 			expectedReason:       "insufficient_scope",
 		},
 		{
@@ -295,7 +295,7 @@ func TestAuthorizer(t *testing.T) {
 		{
 			inputIdentity:  &Identity{Name: "dmh", Scopes: []string{"api:action:store:uuid-A"}},
 			inputPath:      "/api/action/store/uuid-A/../uuid-B",
-			expectedCode:   http.StatusUnauthorized,
+			expectedCode:   http.StatusForbidden,
 			expectedReason: "insufficient_scope",
 		},
 	}
@@ -314,9 +314,13 @@ func TestAuthorizer(t *testing.T) {
 		require.Equal(t, test.expectedCode, w.Code, "path %s identity %+v", test.inputPath, test.inputIdentity)
 		require.Equal(t, test.expectedType, test.inputIdentity.Type, "path %s identity %+v", test.inputPath, test.inputIdentity)
 		require.Equal(t, test.expectedReason, test.inputIdentity.Reason, "path %s identity %+v", test.inputPath, test.inputIdentity)
-		if test.expectedCode == http.StatusUnauthorized {
+		switch test.expectedCode {
+		case http.StatusUnauthorized:
 			require.Equal(t, `Bearer realm="dmh"`, w.Header().Get("WWW-Authenticate"))
-			require.JSONEq(t, `{"status":"Unauthorized."}`, w.Body.String())
+			require.JSONEq(t, `{"status":"Unauthorized.","code":"unauthorized","error":"missing_credentials"}`, w.Body.String())
+		case http.StatusForbidden:
+			require.Empty(t, w.Header().Get("WWW-Authenticate"))
+			require.JSONEq(t, `{"status":"Forbidden.","code":"forbidden","error":"`+test.expectedReason+`"}`, w.Body.String())
 		}
 	}
 }
@@ -386,7 +390,7 @@ func TestMiddlewareChain(t *testing.T) {
 	anonymousScopes := []string{"healthz"}
 	secret := "test-secret"
 
-	handler := BearerAuthenticator(tokens)(SignedURLAuthenticator(secret)(Authorizer(anonymousScopes)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	handler := BearerAuthenticator(newTestTokenStore(t, tokens))(SignedURLAuthenticator(secret)(Authorizer(anonymousScopes)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 	}))))
 
@@ -399,12 +403,12 @@ func TestMiddlewareChain(t *testing.T) {
 		{inputURL: "/api/action/store", inputToken: token.Plaintext, expectedCode: http.StatusOK},
 		{inputURL: "/api/alive", inputToken: token.Plaintext, expectedCode: http.StatusOK},
 		{inputURL: "/api/action/store", inputToken: "", expectedCode: http.StatusUnauthorized},
-		{inputURL: "/api/action/store", inputToken: "wrong-token", expectedCode: http.StatusUnauthorized},
-		{inputURL: "/api/vault/store/uuid", inputToken: token.Plaintext, expectedCode: http.StatusUnauthorized},
-		{inputURL: "/metrics", inputToken: token.Plaintext, expectedCode: http.StatusUnauthorized},
+		{inputURL: "/api/action/store", inputToken: "wrong-token", expectedCode: http.StatusForbidden},
+		{inputURL: "/api/vault/store/uuid", inputToken: token.Plaintext, expectedCode: http.StatusForbidden},
+		{inputURL: "/metrics", inputToken: token.Plaintext, expectedCode: http.StatusForbidden},
 		{inputURL: crypt.SignURL(secret, "/api/vault/store/uuid", time.Now().Add(time.Hour)), expectedCode: http.StatusOK},
-		{inputURL: crypt.SignURL("wrong-secret", "/api/vault/store/uuid", time.Now().Add(time.Hour)), expectedCode: http.StatusUnauthorized},
-		{inputURL: crypt.SignURL(secret, "/api/vault/store/uuid", time.Now().Add(time.Hour)), inputToken: token.Plaintext, expectedCode: http.StatusUnauthorized},
+		{inputURL: crypt.SignURL("wrong-secret", "/api/vault/store/uuid", time.Now().Add(time.Hour)), expectedCode: http.StatusForbidden},
+		{inputURL: crypt.SignURL(secret, "/api/vault/store/uuid", time.Now().Add(time.Hour)), inputToken: token.Plaintext, expectedCode: http.StatusForbidden},
 	}
 	for _, test := range tests {
 		req := httptest.NewRequest("GET", test.inputURL, nil)
@@ -472,6 +476,67 @@ func TestSignedURLAuthenticator(t *testing.T) {
 	}
 }
 
+func TestAliveCronAuthenticator(t *testing.T) {
+	tests := []struct {
+		inputMethod      string
+		inputURL         string
+		inputIdentity    *Identity
+		expectedIdentity *Identity
+	}{
+		{
+			inputMethod:      "GET",
+			inputURL:         "/api/alive/test-token",
+			expectedIdentity: &Identity{Name: "alive-cron", Scopes: []string{"api:alive:test-token"}, Type: AuthTypeAliveCron},
+		},
+		{
+			inputMethod:      "GET",
+			inputURL:         "/api/alive/wrong-token",
+			expectedIdentity: &Identity{Type: AuthTypeAliveCron, Reason: "invalid_token"},
+		},
+		{
+			inputMethod:      "POST",
+			inputURL:         "/api/alive/test-token",
+			expectedIdentity: &Identity{},
+		},
+		{
+			inputMethod:      "GET",
+			inputURL:         "/api/alive",
+			expectedIdentity: &Identity{},
+		},
+		{
+			inputMethod:      "GET",
+			inputURL:         "/api/vault/alive/test-token",
+			expectedIdentity: &Identity{},
+		},
+		{
+			inputMethod:      "GET",
+			inputURL:         "/api/alive/test-token",
+			inputIdentity:    &Identity{Name: "bearer", Scopes: []string{"api"}},
+			expectedIdentity: &Identity{Name: "bearer", Scopes: []string{"api"}},
+		},
+	}
+
+	for _, test := range tests {
+		var gotIdentity *Identity
+		next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			gotIdentity = IdentityFromContext(r.Context())
+			w.WriteHeader(http.StatusOK)
+		})
+		handler := AliveCronAuthenticator(otherHash)(next)
+
+		req, err := http.NewRequest(test.inputMethod, test.inputURL, nil)
+		require.Nil(t, err)
+		req = withRouteContext(req)
+		if test.inputIdentity != nil {
+			req = req.WithContext(ContextWithIdentity(req.Context(), test.inputIdentity))
+		}
+		w := httptest.NewRecorder()
+
+		handler.ServeHTTP(w, req)
+		require.Equal(t, test.expectedIdentity, gotIdentity, "%s %s", test.inputMethod, test.inputURL)
+	}
+}
+
 func TestRequestPath(t *testing.T) {
 	tests := []struct {
 		inputSetRouteContext bool
@@ -0,0 +1,148 @@
+package auth
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/google/renameio/v2"
+)
+
+var (
+	// ErrTokenHashDuplicated is returned when rotated hash is already used by other token.
+	ErrTokenHashDuplicated = errors.New("hash is already used")
+	// ErrTokenNotFound is returned when rotated token does not exist.
+	ErrTokenNotFound = errors.New("token not found")
+	// ErrTokenHashInvalid is returned when hash is not hex encoded sha256.
+	ErrTokenHashInvalid = errors.New("hash must be a hex encoded sha256")
+)
+
+var (
+	// mocks for tests
+	atomicWrite = func(path string, data []byte, perm os.FileMode) error {
+		return renameio.WriteFile(path, data, perm)
+	}
+)
+
+// TokenStore holds bearer tokens used by BearerAuthenticator.
+// Token hashes can be rotated at runtime, rotated hashes are persisted to rotation file (name -> hash).
+type TokenStore struct {
+	tokens atomic.Pointer[[]Token]
+	mtx    sync.Mutex // serializes Rotate
+	path   string
+}
+
+// NewTokenStore returns TokenStore with tokens.
+// Scopes of vault client tokens are derived from their ClientUUID.
+// When path is set, hashes rotated earlier are loaded from it and override hashes of tokens with the same name.
+func NewTokenStore(tokens []Token, path string) (*TokenStore, error) {
+	ts := &TokenStore{path: path}
+	tokens = slices.Clone(tokens)
+	for i := range tokens {
+		if tokens[i].ClientUUID != "" {
+			tokens[i].Scopes = clientScopes(tokens[i].ClientUUID)
+		}
+	}
+	if path != "" {
+		rotated, err := readRotationFile(path)
+		if err != nil {
+			return nil, err
+		}
+		for name, hash := range rotated {
+			i := slices.IndexFunc(tokens, func(t Token) bool { return t.Name == name })
+			if i < 0 {
+				log.Printf("rotated token %s is not configured, ignoring it", name)
+				continue
+			}
+			tokens[i].Hash = hash
+		}
+	}
+	ts.tokens.Store(&tokens)
+	return ts, nil
+}
+
+// Tokens returns current tokens.
+func (ts *TokenStore) Tokens() []Token {
+	return *ts.tokens.Load()
+}
+
+// Persistent returns true when rotated hashes are persisted.
+func (ts *TokenStore) Persistent() bool {
+	return ts.path != ""
+}
+
+// Rotate replaces hash of token name.
+// New hash is persisted first, so rotation is never lost on restart.
+func (ts *TokenStore) Rotate(name string, hash string) error {
+	if err := validateTokenHash(hash); err != nil {
+		return err
+	}
+	ts.mtx.Lock()
+	defer ts.mtx.Unlock()
+
+	tokens := slices.Clone(ts.Tokens())
+	i := slices.IndexFunc(tokens, func(t Token) bool { return t.Name == name })
+	if i < 0 {
+		return fmt.Errorf("%w: %s", ErrTokenNotFound, name)
+	}
+	for _, t := range tokens {
+		if strings.EqualFold(t.Hash, hash) {
+			return fmt.Errorf("%w: %s", ErrTokenHashDuplicated, t.Name)
+		}
+	}
+	tokens[i].Hash = hash
+
+	if ts.path != "" {
+		rotated, err := readRotationFile(ts.path)
+		if err != nil {
+			return err
+		}
+		rotated[name] = hash
+		data, err := json.Marshal(rotated)
+		if err != nil {
+			return err
+		}
+		if err := atomicWrite(ts.path, data, 0600); err != nil {
+			return fmt.Errorf("unable to save rotation file: %w", err)
+		}
+	}
+	ts.tokens.Store(&tokens)
+	return nil
+}
+
+// readRotationFile returns rotated hashes (name -> hash), missing file is empty.
+func readRotationFile(path string) (map[string]string, error) {
+	rotated := map[string]string{}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return rotated, nil
+		}
+		return nil, fmt.Errorf("unable to read rotation file: %w", err)
+	}
+	if err := json.Unmarshal(data, &rotated); err != nil {
+		return nil, fmt.Errorf("unable to decode rotation file: %w", err)
+	}
+	for name, hash := range rotated {
+		if err := validateTokenHash(hash); err != nil {
+			return nil, fmt.Errorf("rotation file token %s: %w", name, err)
+		}
+	}
+	return rotated, nil
+}
+
+// validateTokenHash checks that hash is hex encoded sha256.
+func validateTokenHash(hash string) error {
+	decodedHash, err := hex.DecodeString(hash)
+	if err != nil || len(decodedHash) != 32 {
+		return ErrTokenHashInvalid
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package auth
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// thirdHash is sha256 of "third-token".
+const thirdHash = "4805ab0624bf846ebd4ee89b43701d8e83e3912a3294b46907753515fe8d9a09"
+
+// newTestTokenStore returns TokenStore without rotation file.
+func newTestTokenStore(t *testing.T, tokens []Token) *TokenStore {
+	t.Helper()
+	ts, err := NewTokenStore(tokens, "")
+	require.Nil(t, err)
+	return ts
+}
+
+func TestNewTokenStore(t *testing.T) {
+	temp := t.TempDir()
+	tokens := []Token{
+		{Name: "admin", Hash: testTokenHash, Scopes: []string{"api"}},
+		{Name: "alive-cron", Hash: otherHash, Scopes: []string{"api:alive"}},
+	}
+
+	rotationFile := filepath.Join(temp, "rotated.json")
+	require.Nil(t, os.WriteFile(rotationFile, []byte(fmt.Sprintf(`{"admin": "%s", "removed": "%s"}`, thirdHash, thirdHash)), 0600))
+	brokenFile := filepath.Join(temp, "broken.json")
+	require.Nil(t, os.WriteFile(brokenFile, []byte(`{"admin":`), 0600))
+	invalidHashFile := filepath.Join(temp, "invalid.json")
+	require.Nil(t, os.WriteFile(invalidHashFile, []byte(`{"admin": "abc"}`), 0600))
+
+	tests := []struct {
+		inputPath             string
+		expectedTokens        []Token
+		expectedPersistent    bool
+		expectedErrorContains string
+	}{
+		{
+			expectedTokens: tokens,
+		},
+		{
+			inputPath:          filepath.Join(temp, "missing.json"),
+			expectedTokens:     tokens,
+			expectedPersistent: true,
+		},
+		{
+			inputPath: rotationFile,
+			expectedTokens: []Token{
+				{Name: "admin", Hash: thirdHash, Scopes: []string{"api"}},
+				{Name: "alive-cron", Hash: otherHash, Scopes: []string{"api:alive"}},
+			},
+			expectedPersistent: true,
+		},
+		{
+			inputPath:             brokenFile,
+			expectedErrorContains: "unable to decode rotation file",
+		},
+		{
+			inputPath:             invalidHashFile,
+			expectedErrorContains: "rotation file token admin: hash must be a hex encoded sha256",
+		},
+	}
+	for _, test := range tests {
+		ts, err := NewTokenStore(tokens, test.inputPath)
+		if test.expectedErrorContains != "" {
+			require.ErrorContains(t, err, test.expectedErrorContains)
+			require.Nil(t, ts)
+			continue
+		}
+		require.Nil(t, err)
+		require.Equal(t, test.expectedTokens, ts.Tokens())
+		require.Equal(t, test.expectedPersistent, ts.Persistent())
+	}
+	// configured tokens are never modified
+	require.Equal(t, testTokenHash, tokens[0].Hash)
+}
+
+func TestTokenStoreRotate(t *testing.T) {
+	rotationFile := filepath.Join(t.TempDir(), "rotated.json")
+	tokens := []Token{
+		{Name: "admin", Hash: testTokenHash, Scopes: []string{"api"}},
+		{Name: "alive-cron", Hash: otherHash, Scopes: []string{"api:alive"}},
+	}
+	ts, err := NewTokenStore(tokens, rotationFile)
+	require.Nil(t, err)
+
+	require.ErrorIs(t, ts.Rotate("admin", "abc"), ErrTokenHashInvalid)
+	require.ErrorIs(t, ts.Rotate("missing", thirdHash), ErrTokenNotFound)
+	require.ErrorIs(t, ts.Rotate("admin", otherHash), ErrTokenHashDuplicated)
+
+	originalAtomicWrite := atomicWrite
+	atomicWrite = func(string, []byte, os.FileMode) error { return fmt.Errorf("mock write error") }
+	require.ErrorContains(t, ts.Rotate("admin", thirdHash), "unable to save rotation file: mock write error")
+	require.Equal(t, testTokenHash, ts.Tokens()[0].Hash)
+	atomicWrite = originalAtomicWrite
+
+	require.Nil(t, ts.Rotate("admin", thirdHash))
+	require.Equal(t, thirdHash, ts.Tokens()[0].Hash)
+	require.Equal(t, otherHash, ts.Tokens()[1].Hash)
+
+	data, err := os.ReadFile(rotationFile)
+	require.Nil(t, err)
+	require.JSONEq(t, fmt.Sprintf(`{"admin": "%s"}`, thirdHash), string(data))
+
+	reloaded, err := NewTokenStore(tokens, rotationFile)
+	require.Nil(t, err)
+	require.Equal(t, ts.Tokens(), reloaded.Tokens())
+
+	inMemory := newTestTokenStore(t, tokens)
+	require.Nil(t, inMemory.Rotate("alive-cron", thirdHash))
+	require.Equal(t, thirdHash, inMemory.Tokens()[1].Hash)
+}
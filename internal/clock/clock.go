@@ -0,0 +1,167 @@
+package clock
+
+import (
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+// Clock is source of current time and tickers for timing logic of dispatcher, State and Vault.
+type Clock interface {
+	Now() time.Time
+	NewTicker(time.Duration) Ticker
+}
+
+// Ticker delivers ticks of Clock.
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// Jitter returns random duration in [0, max), it is 0 when max is not positive.
+// Timed loops wait for it before work, so colocated instances don't hit shared vault and webhooks at the same instant.
+func Jitter(max time.Duration) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+	return rand.N(max)
+}
+
+// Sleep waits d of wall time, it returns false when chStop was signalled first.
+func Sleep(d time.Duration, chStop chan bool) bool {
+	if d <= 0 {
+		return true
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-chStop:
+		return false
+	}
+}
+
+// New returns Clock backed by wall clock.
+func New() Clock {
+	return realClock{}
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) NewTicker(d time.Duration) Ticker {
+	return realTicker{time.NewTicker(d)}
+}
+
+type realTicker struct {
+	*time.Ticker
+}
+
+func (t realTicker) C() <-chan time.Time {
+	return t.Ticker.C
+}
+
+// FakeClock is Clock for tests, time moves only with Set and Advance.
+// Ticks are delivered synchronously from Advance, so when Advance returns every due tick was received.
+type FakeClock struct {
+	mtx     sync.Mutex
+	cond    *sync.Cond // signalled when ticker is created
+	now     time.Time
+	tickers []*fakeTicker
+}
+
+// NewFake returns FakeClock set to now.
+func NewFake(now time.Time) *FakeClock {
+	c := &FakeClock{now: now}
+	c.cond = sync.NewCond(&c.mtx)
+	return c
+}
+
+// WaitForTickers blocks until at least n tickers are active, e.g. until started goroutine created its ticker.
+func (c *FakeClock) WaitForTickers(n int) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	for len(c.tickers) < n {
+		c.cond.Wait()
+	}
+}
+
+// Now returns current time of FakeClock.
+func (c *FakeClock) Now() time.Time {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return c.now
+}
+
+// NewTicker returns Ticker firing every d of fake time.
+func (c *FakeClock) NewTicker(d time.Duration) Ticker {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	t := &fakeTicker{c: make(chan time.Time), interval: d, next: c.now.Add(d), clock: c}
+	c.tickers = append(c.tickers, t)
+	c.cond.Broadcast()
+	return t
+}
+
+// Set moves FakeClock to now without delivering ticks.
+func (c *FakeClock) Set(now time.Time) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.now = now
+	for _, t := range c.tickers {
+		t.next = now.Add(t.interval)
+	}
+}
+
+// Advance moves FakeClock by d, every tick which became due is delivered to its receiver.
+// Advance blocks until ticks are received, it must not be called when nothing receives from ticker.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mtx.Lock()
+	target := c.now.Add(d)
+	c.mtx.Unlock()
+	for {
+		c.mtx.Lock()
+		var due *fakeTicker
+		for _, t := range c.tickers {
+			if !t.next.After(target) && (due == nil || t.next.Before(due.next)) {
+				due = t
+			}
+		}
+		if due == nil {
+			c.now = target
+			c.mtx.Unlock()
+			return
+		}
+		c.now = due.next
+		due.next = due.next.Add(due.interval)
+		tick := c.now
+		c.mtx.Unlock()
+		due.c <- tick
+	}
+}
+
+type fakeTicker struct {
+	c        chan time.Time
+	interval time.Duration
+	next     time.Time
+	clock    *FakeClock
+}
+
+func (t *fakeTicker) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *fakeTicker) Stop() {
+	t.clock.mtx.Lock()
+	defer t.clock.mtx.Unlock()
+	for i, ticker := range t.clock.tickers {
+		if ticker == t {
+			t.clock.tickers = append(t.clock.tickers[:i], t.clock.tickers[i+1:]...)
+			return
+		}
+	}
+}
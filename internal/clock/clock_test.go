@@ -0,0 +1,80 @@
+package clock
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew(t *testing.T) {
+	c := New()
+	require.WithinDuration(t, time.Now(), c.Now(), time.Second)
+
+	ticker := c.NewTicker(time.Millisecond)
+	defer ticker.Stop()
+	select {
+	case <-ticker.C():
+	case <-time.After(time.Second):
+		t.Fatal("ticker did not tick")
+	}
+}
+
+func TestFakeClock(t *testing.T) {
+	start := time.Date(2025, 3, 26, 14, 0, 0, 0, time.UTC)
+	c := NewFake(start)
+	require.Equal(t, start, c.Now())
+
+	ticker := c.NewTicker(10 * time.Minute)
+	c.WaitForTickers(1)
+	ticks := make(chan time.Time, 10)
+	done := make(chan bool)
+	go func() {
+		for tick := range ticker.C() {
+			ticks <- tick
+			if len(ticks) == 3 {
+				close(done)
+				return
+			}
+		}
+	}()
+
+	c.Advance(5 * time.Minute)
+	require.Equal(t, start.Add(5*time.Minute), c.Now())
+	require.Empty(t, ticks)
+
+	c.Advance(25 * time.Minute)
+	<-done
+	require.Equal(t, start.Add(30*time.Minute), c.Now())
+	require.Equal(t, start.Add(10*time.Minute), <-ticks)
+	require.Equal(t, start.Add(20*time.Minute), <-ticks)
+	require.Equal(t, start.Add(30*time.Minute), <-ticks)
+
+	ticker.Stop()
+	c.Advance(time.Hour)
+	require.Equal(t, start.Add(90*time.Minute), c.Now())
+
+	c.Set(start)
+	require.Equal(t, start, c.Now())
+}
+
+func TestJitter(t *testing.T) {
+	require.Zero(t, Jitter(0))
+	require.Zero(t, Jitter(-time.Second))
+	for range 100 {
+		jitter := Jitter(time.Second)
+		require.GreaterOrEqual(t, jitter, time.Duration(0))
+		require.Less(t, jitter, time.Second)
+	}
+}
+
+func TestSleep(t *testing.T) {
+	require.True(t, Sleep(0, nil))
+	require.True(t, Sleep(time.Millisecond, make(chan bool)))
+
+	chStop := make(chan bool, 1)
+	chStop <- true
+	started := time.Now()
+	require.False(t, Sleep(time.Hour, chStop))
+	require.Less(t, time.Since(started), time.Second)
+}
@@ -1,8 +1,6 @@
 package crypt
 
 import (
-	"bytes"
-	"encoding/base64"
 	"fmt"
 	"io"
 
@@ -11,6 +9,10 @@ import (
 
 const EncryptionKind = "X25519"
 
+// WrapEncryptionKind is used when vault secret key is additionally encrypted to requester recipient
+// for transport, so key released by vault can't be sniffed on the wire.
+const WrapEncryptionKind = "X25519+wrap"
+
 var (
 	// mocks for tests
 	ageGenerateX25519Identity = age.GenerateX25519Identity
@@ -24,7 +26,10 @@ var (
 type AgeInterface interface {
 	Encrypt(string) (string, error)
 	Decrypt(string) (string, error)
+	EncryptStream(dst io.Writer, src io.Reader) error
+	DecryptStream(dst io.Writer, src io.Reader) error
 	GetPrivateKey() string
+	GetPublicKey() string
 }
 
 // Age stores age encryption identity.
@@ -55,48 +60,67 @@ func NewAge(key string) (AgeInterface, error) {
 // Encrypt will return encrypted data and error.
 // Encrypted data is base64 decoded.
 func (c *Age) Encrypt(data string) (string, error) {
-	if data == "" {
-		return "", fmt.Errorf("empty data")
-	}
-	out := &bytes.Buffer{}
-	w, err := ageEncrypt(out, c.identity.Recipient())
-	if err != nil {
-		return "", err
-	}
-	if _, err := ioWriteString(w, data); err != nil {
-		return "", err
-	}
-	if err := w.Close(); err != nil {
-		return "", err
-	}
-	return base64.StdEncoding.EncodeToString(out.Bytes()), nil
+	return encrypt(data, c.identity.Recipient())
 }
 
 // Decrypt decrypts input data.
 // Decrypt will return plain text data and error.
 // Decrypt expect that input data is base64 encoded.
 func (c *Age) Decrypt(data string) (string, error) {
-	if data == "" {
-		return "", fmt.Errorf("empty data")
-	}
-	decodedBytes, err := base64.StdEncoding.DecodeString(data)
-	if err != nil {
-		return "", err
-	}
+	return decrypt(data, c.identity)
+}
 
-	r, err := ageDecrypt(bytes.NewReader(decodedBytes), c.identity)
+// EncryptStream encrypts src into dst.
+// Unlike Encrypt, output is binary age format (not base64 encoded) and data is never fully buffered in memory,
+// so it should be used for large payloads.
+func (c *Age) EncryptStream(dst io.Writer, src io.Reader) error {
+	w, err := ageEncrypt(dst, c.identity.Recipient())
 	if err != nil {
-		return "", err
+		return err
+	}
+	if _, err := ioCopy(w, src); err != nil {
+		return err
 	}
+	return w.Close()
+}
 
-	out := &bytes.Buffer{}
-	if _, err := ioCopy(out, r); err != nil {
-		return "", err
+// DecryptStream decrypts src produced by EncryptStream into dst.
+// Partially decrypted data could be written to dst before error is returned.
+func (c *Age) DecryptStream(dst io.Writer, src io.Reader) error {
+	r, err := ageDecrypt(src, c.identity)
+	if err != nil {
+		return err
 	}
-	return out.String(), nil
+	_, err = ioCopy(dst, r)
+	return err
 }
 
 // GetPrivateKey returns age private key.
 func (c *Age) GetPrivateKey() string {
 	return c.identity.String()
 }
+
+// GetPublicKey returns age public key (recipient).
+func (c *Age) GetPublicKey() string {
+	return c.identity.Recipient().String()
+}
+
+// Recipient stores age encryption recipient, it can only encrypt.
+type Recipient struct {
+	recipient *age.X25519Recipient
+}
+
+// NewRecipient returns new instance of Recipient from age public key (age1...).
+func NewRecipient(recipient string) (*Recipient, error) {
+	r, err := age.ParseX25519Recipient(recipient)
+	if err != nil {
+		return nil, fmt.Errorf("invalid age recipient: %w", err)
+	}
+	return &Recipient{recipient: r}, nil
+}
+
+// Encrypt encrypts input data to recipient.
+// Encrypted data is base64 encoded.
+func (c *Recipient) Encrypt(data string) (string, error) {
+	return encrypt(data, c.recipient)
+}
@@ -322,3 +322,145 @@ func TestSameKeys(t *testing.T) {
 	require.Equal(t, c1.GetPrivateKey(), c2.GetPrivateKey())
 	require.Equal(t, "AGE-SECRET-KEY-1WCXTESPDAL64QQLNE6SEHHSFQVHZ2KV7KR2XCLGQ0UFSUUJXP5AS84HFG0", c1.GetPrivateKey())
 }
+
+func TestRecipient(t *testing.T) {
+	_, err := NewRecipient("age1broken")
+	require.ErrorContains(t, err, "invalid age recipient")
+
+	c, err := NewAge("")
+	require.Nil(t, err)
+	r, err := NewRecipient(c.GetPublicKey())
+	require.Nil(t, err)
+
+	encrypted, err := r.Encrypt("test")
+	require.Nil(t, err)
+	decrypted, err := c.Decrypt(encrypted)
+	require.Nil(t, err)
+	require.Equal(t, "test", decrypted)
+
+	_, err = r.Encrypt("")
+	require.EqualError(t, err, "empty data")
+}
+
+func TestEncryptStream(t *testing.T) {
+	tests := []struct {
+		inputData      string
+		expectedError  error
+		mockAgeEncrypt func(dst io.Writer, recipients ...age.Recipient) (io.WriteCloser, error)
+		mockIoCopy     func(dst io.Writer, src io.Reader) (written int64, err error)
+	}{
+		{
+			inputData:     "test",
+			expectedError: fmt.Errorf("mockAgeEncrypt error"),
+			mockAgeEncrypt: func(dst io.Writer, recipients ...age.Recipient) (io.WriteCloser, error) {
+				return nil, fmt.Errorf("mockAgeEncrypt error")
+			},
+		},
+		{
+			inputData:     "test",
+			expectedError: fmt.Errorf("mockIoCopy error"),
+			mockIoCopy: func(dst io.Writer, src io.Reader) (written int64, err error) {
+				return 0, fmt.Errorf("mockIoCopy error")
+			},
+		},
+		{
+			inputData:     "test",
+			expectedError: fmt.Errorf("mockClose error"),
+			mockAgeEncrypt: func(dst io.Writer, recipients ...age.Recipient) (io.WriteCloser, error) {
+				return &failCloseWriteCloser{Writer: &bytes.Buffer{}}, nil
+			},
+		},
+		{
+			inputData: "",
+		},
+		{
+			inputData: "test",
+		},
+		{
+			inputData: strings.Repeat("long data", 100000),
+		},
+	}
+	for _, test := range tests {
+		ageEncrypt = age.Encrypt
+		ioCopy = io.Copy
+		if test.mockAgeEncrypt != nil {
+			ageEncrypt = test.mockAgeEncrypt
+		}
+		if test.mockIoCopy != nil {
+			ioCopy = test.mockIoCopy
+		}
+
+		c, err := NewAge("AGE-SECRET-KEY-1WCXTESPDAL64QQLNE6SEHHSFQVHZ2KV7KR2XCLGQ0UFSUUJXP5AS84HFG0")
+		require.Nil(t, err)
+
+		encrypted := &bytes.Buffer{}
+		err = c.EncryptStream(encrypted, strings.NewReader(test.inputData))
+		require.Equal(t, test.expectedError, err)
+		if err != nil {
+			continue
+		}
+		ioCopy = io.Copy
+
+		// Stream output is raw age format, not base64.
+		require.True(t, bytes.HasPrefix(encrypted.Bytes(), []byte("age-encryption.org/v1\n")))
+
+		decrypted := &bytes.Buffer{}
+		require.Nil(t, c.DecryptStream(decrypted, encrypted))
+		require.Equal(t, test.inputData, decrypted.String())
+	}
+}
+
+func TestDecryptStream(t *testing.T) {
+	c, err := NewAge("")
+	require.Nil(t, err)
+	encrypted := &bytes.Buffer{}
+	require.Nil(t, c.EncryptStream(encrypted, strings.NewReader("test data")))
+
+	tests := []struct {
+		inputData      []byte
+		expectedError  error
+		mockAgeDecrypt func(src io.Reader, identities ...age.Identity) (io.Reader, error)
+		mockIoCopy     func(dst io.Writer, src io.Reader) (written int64, err error)
+	}{
+		{
+			inputData:     encrypted.Bytes(),
+			expectedError: fmt.Errorf("mockAgeDecrypt error"),
+			mockAgeDecrypt: func(src io.Reader, identities ...age.Identity) (io.Reader, error) {
+				return nil, fmt.Errorf("mockAgeDecrypt error")
+			},
+		},
+		{
+			inputData:     encrypted.Bytes(),
+			expectedError: fmt.Errorf("mockIoCopy error"),
+			mockIoCopy: func(dst io.Writer, src io.Reader) (written int64, err error) {
+				return 0, fmt.Errorf("mockIoCopy error")
+			},
+		},
+		{
+			inputData: encrypted.Bytes(),
+		},
+	}
+	for _, test := range tests {
+		ageDecrypt = age.Decrypt
+		ioCopy = io.Copy
+		if test.mockAgeDecrypt != nil {
+			ageDecrypt = test.mockAgeDecrypt
+		}
+		if test.mockIoCopy != nil {
+			ioCopy = test.mockIoCopy
+		}
+
+		decrypted := &bytes.Buffer{}
+		err := c.DecryptStream(decrypted, bytes.NewReader(test.inputData))
+		require.Equal(t, test.expectedError, err)
+		if err == nil {
+			require.Equal(t, "test data", decrypted.String())
+		}
+	}
+	ioCopy = io.Copy
+
+	// Data encrypted to other identity can't be decrypted.
+	other, err := NewAge("")
+	require.Nil(t, err)
+	require.Error(t, other.DecryptStream(&bytes.Buffer{}, bytes.NewReader(encrypted.Bytes())))
+}
@@ -0,0 +1,56 @@
+package crypt
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// EncryptedValuePrefix marks config values encrypted with master key.
+const EncryptedValuePrefix = "!encrypted:"
+
+const (
+	// MasterKeyEnv holds master key (age private key) used to decrypt config values.
+	MasterKeyEnv = "DMH_MASTER_KEY"
+	// MasterKeyFileEnv holds path to file with master key, used when MasterKeyEnv is not set.
+	MasterKeyFileEnv = "DMH_MASTER_KEY_FILE"
+)
+
+// MasterKey returns master key from MasterKeyEnv or from file pointed by MasterKeyFileEnv.
+// Empty key is returned when none of them is set.
+func MasterKey() (string, error) {
+	if key := os.Getenv(MasterKeyEnv); key != "" {
+		return strings.TrimSpace(key), nil
+	}
+	path := os.Getenv(MasterKeyFileEnv)
+	if path == "" {
+		return "", nil
+	}
+	key, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("unable to read master key file %s: %w", path, err)
+	}
+	return strings.TrimSpace(string(key)), nil
+}
+
+// IsEncryptedValue returns if value is tagged with EncryptedValuePrefix.
+func IsEncryptedValue(value string) bool {
+	return strings.HasPrefix(value, EncryptedValuePrefix)
+}
+
+// EncryptValue encrypts plaintext and tags it with EncryptedValuePrefix.
+func EncryptValue(c AgeInterface, plaintext string) (string, error) {
+	encrypted, err := c.Encrypt(plaintext)
+	if err != nil {
+		return "", err
+	}
+	return EncryptedValuePrefix + encrypted, nil
+}
+
+// DecryptValue decrypts value tagged with EncryptedValuePrefix.
+func DecryptValue(c AgeInterface, value string) (string, error) {
+	if !IsEncryptedValue(value) {
+		return "", fmt.Errorf("value is not tagged with %s", EncryptedValuePrefix)
+	}
+	return c.Decrypt(strings.TrimPrefix(value, EncryptedValuePrefix))
+}
@@ -0,0 +1,77 @@
+package crypt
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMasterKey(t *testing.T) {
+	keyFile := filepath.Join(t.TempDir(), "master.key")
+	require.Nil(t, os.WriteFile(keyFile, []byte("file-key\n"), 0600))
+
+	tests := []struct {
+		env           map[string]string
+		expectedKey   string
+		expectedError string
+	}{
+		{},
+		{
+			env:         map[string]string{MasterKeyEnv: " env-key\n"},
+			expectedKey: "env-key",
+		},
+		{
+			env:         map[string]string{MasterKeyFileEnv: keyFile},
+			expectedKey: "file-key",
+		},
+		{
+			env:         map[string]string{MasterKeyEnv: "env-key", MasterKeyFileEnv: keyFile},
+			expectedKey: "env-key",
+		},
+		{
+			env:           map[string]string{MasterKeyFileEnv: filepath.Join(t.TempDir(), "missing")},
+			expectedError: "unable to read master key file",
+		},
+	}
+
+	for _, test := range tests {
+		t.Setenv(MasterKeyEnv, "")
+		t.Setenv(MasterKeyFileEnv, "")
+		for k, v := range test.env {
+			t.Setenv(k, v)
+		}
+		key, err := MasterKey()
+		if test.expectedError != "" {
+			require.ErrorContains(t, err, test.expectedError)
+			continue
+		}
+		require.Nil(t, err)
+		require.Equal(t, test.expectedKey, key)
+	}
+}
+
+func TestEncryptDecryptValue(t *testing.T) {
+	c, err := NewAge("")
+	require.Nil(t, err)
+	other, err := NewAge("")
+	require.Nil(t, err)
+
+	encrypted, err := EncryptValue(c, "secret")
+	require.Nil(t, err)
+	require.True(t, IsEncryptedValue(encrypted))
+	require.NotContains(t, encrypted, "secret")
+
+	decrypted, err := DecryptValue(c, encrypted)
+	require.Nil(t, err)
+	require.Equal(t, "secret", decrypted)
+
+	_, err = DecryptValue(other, encrypted)
+	require.NotNil(t, err)
+
+	_, err = DecryptValue(c, "secret")
+	require.ErrorContains(t, err, "value is not tagged with !encrypted:")
+
+	require.False(t, IsEncryptedValue("encrypted:abc"))
+}
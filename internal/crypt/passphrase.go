@@ -0,0 +1,61 @@
+package crypt
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+)
+
+// scryptWorkFactor is log2 of scrypt work factor used by EncryptPassphrase, lowered in tests.
+var scryptWorkFactor = 18
+
+// EncryptPassphrase encrypts data with passphrase (age scrypt recipient).
+// Output is ASCII armored age file, so it can be delivered as text and decrypted with `age -d`.
+func EncryptPassphrase(data string, passphrase string) (string, error) {
+	if data == "" {
+		return "", fmt.Errorf("empty data")
+	}
+	recipient, err := age.NewScryptRecipient(passphrase)
+	if err != nil {
+		return "", err
+	}
+	recipient.SetWorkFactor(scryptWorkFactor)
+
+	out := &bytes.Buffer{}
+	a := armor.NewWriter(out)
+	w, err := ageEncrypt(a, recipient)
+	if err != nil {
+		return "", err
+	}
+	if _, err := ioWriteString(w, data); err != nil {
+		return "", err
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+	if err := a.Close(); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+// DecryptPassphrase decrypts ASCII armored data encrypted by EncryptPassphrase.
+func DecryptPassphrase(data string, passphrase string) (string, error) {
+	identity, err := age.NewScryptIdentity(passphrase)
+	if err != nil {
+		return "", err
+	}
+	r, err := ageDecrypt(armor.NewReader(strings.NewReader(data)), identity)
+	if err != nil {
+		return "", err
+	}
+	out := &bytes.Buffer{}
+	if _, err := io.Copy(out, r); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
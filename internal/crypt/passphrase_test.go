@@ -0,0 +1,35 @@
+package crypt
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncryptDecryptPassphrase(t *testing.T) {
+	scryptWorkFactor = 10
+	defer func() { scryptWorkFactor = 18 }()
+
+	encrypted, err := EncryptPassphrase("secret message", "correct horse")
+	require.Nil(t, err)
+	require.True(t, strings.HasPrefix(encrypted, "-----BEGIN AGE ENCRYPTED FILE-----\n"))
+	require.True(t, strings.HasSuffix(encrypted, "-----END AGE ENCRYPTED FILE-----\n"))
+	require.NotContains(t, encrypted, "secret message")
+
+	decrypted, err := DecryptPassphrase(encrypted, "correct horse")
+	require.Nil(t, err)
+	require.Equal(t, "secret message", decrypted)
+
+	_, err = DecryptPassphrase(encrypted, "wrong horse")
+	require.NotNil(t, err)
+
+	_, err = DecryptPassphrase("not armored", "correct horse")
+	require.NotNil(t, err)
+
+	_, err = EncryptPassphrase("", "correct horse")
+	require.ErrorContains(t, err, "empty data")
+
+	_, err = EncryptPassphrase("secret message", "")
+	require.NotNil(t, err)
+}
@@ -0,0 +1,135 @@
+package crypt
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"log"
+
+	"filippo.io/age"
+	"filippo.io/age/plugin"
+)
+
+// PluginEncryptionKind is used when action data is additionally encrypted to age plugin recipient.
+// Data is first encrypted to plugin recipient, result is encrypted with X25519 key stored in vault.
+const PluginEncryptionKind = "X25519+plugin"
+
+var (
+	// mocks for tests
+	pluginNewRecipient = plugin.NewRecipient
+	pluginNewIdentity  = plugin.NewIdentity
+)
+
+// pluginUI is used for age plugin interaction.
+// DMH runs without terminal, so plugins requesting input (e.g. PIN) are not supported.
+var pluginUI = &plugin.ClientUI{
+	DisplayMessage: func(name, message string) error {
+		log.Printf("age plugin %s: %s", name, message)
+		return nil
+	},
+	RequestValue: func(name, prompt string, secret bool) (string, error) {
+		return "", fmt.Errorf("age plugin %s requested input (%s), interactive plugins are not supported", name, prompt)
+	},
+	Confirm: func(name, prompt, yes, no string) (bool, error) {
+		return false, fmt.Errorf("age plugin %s requested confirmation (%s), interactive plugins are not supported", name, prompt)
+	},
+	WaitTimer: func(name string) {
+		log.Printf("waiting for age plugin %s", name)
+	},
+}
+
+// PluginAgeInterface implement PluginAge.
+type PluginAgeInterface interface {
+	Encrypt(string) (string, error)
+	Decrypt(string) (string, error)
+}
+
+// PluginAge stores age plugin recipient and identity (e.g. age-plugin-yubikey).
+// Plugin binary (age-plugin-<name>) must be available in PATH.
+type PluginAge struct {
+	recipient *plugin.Recipient
+	identity  *plugin.Identity
+}
+
+// NewPluginAge returns new instance of PluginAge.
+// recipient is required for Encrypt, identity is required for Decrypt.
+func NewPluginAge(recipient string, identity string) (PluginAgeInterface, error) {
+	if recipient == "" && identity == "" {
+		return nil, fmt.Errorf("recipient or identity must be provided")
+	}
+	c := &PluginAge{}
+	if recipient != "" {
+		r, err := pluginNewRecipient(recipient, pluginUI)
+		if err != nil {
+			return nil, fmt.Errorf("invalid age plugin recipient: %w", err)
+		}
+		c.recipient = r
+	}
+	if identity != "" {
+		i, err := pluginNewIdentity(identity, pluginUI)
+		if err != nil {
+			return nil, fmt.Errorf("invalid age plugin identity: %w", err)
+		}
+		c.identity = i
+	}
+	return c, nil
+}
+
+// Encrypt encrypts input data to plugin recipient.
+// Encrypted data is base64 encoded.
+func (c *PluginAge) Encrypt(data string) (string, error) {
+	if c.recipient == nil {
+		return "", fmt.Errorf("age plugin recipient is not configured")
+	}
+	return encrypt(data, c.recipient)
+}
+
+// Decrypt decrypts input data with plugin identity.
+// Decrypt expect that input data is base64 encoded.
+func (c *PluginAge) Decrypt(data string) (string, error) {
+	if c.identity == nil {
+		return "", fmt.Errorf("age plugin identity is not configured")
+	}
+	return decrypt(data, c.identity)
+}
+
+// encrypt encrypts data to recipient and returns it base64 encoded.
+func encrypt(data string, recipient age.Recipient) (string, error) {
+	if data == "" {
+		return "", fmt.Errorf("empty data")
+	}
+	out := &bytes.Buffer{}
+	w, err := ageEncrypt(out, recipient)
+	if err != nil {
+		return "", err
+	}
+	if _, err := ioWriteString(w, data); err != nil {
+		return "", err
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(out.Bytes()), nil
+}
+
+// decrypt decrypts base64 encoded data with identity.
+func decrypt(data string, identity age.Identity) (string, error) {
+	if data == "" {
+		return "", fmt.Errorf("empty data")
+	}
+	decodedBytes, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return "", err
+	}
+
+	r, err := ageDecrypt(bytes.NewReader(decodedBytes), identity)
+	if err != nil {
+		return "", err
+	}
+
+	out := &bytes.Buffer{}
+	if _, err := ioCopy(out, r); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
@@ -0,0 +1,115 @@
+package crypt
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"filippo.io/age"
+	"filippo.io/age/plugin"
+	"github.com/stretchr/testify/require"
+)
+
+// TestMain allows test binary to act as age-plugin-dmhtest.
+// Plugin recipient and identity data are plain X25519 recipient and identity strings.
+func TestMain(m *testing.M) {
+	if filepath.Base(os.Args[0]) == "age-plugin-dmhtest" {
+		p, _ := plugin.New("dmhtest")
+		p.HandleRecipient(func(data []byte) (age.Recipient, error) {
+			return age.ParseX25519Recipient(string(data))
+		})
+		p.HandleIdentity(func(data []byte) (age.Identity, error) {
+			return age.ParseX25519Identity(string(data))
+		})
+		os.Exit(p.Main())
+	}
+	os.Exit(m.Run())
+}
+
+// installTestPlugin puts age-plugin-dmhtest into PATH.
+func installTestPlugin(t *testing.T) {
+	t.Helper()
+	temp := t.TempDir()
+	ex, err := os.Executable()
+	require.Nil(t, err)
+	require.Nil(t, os.Symlink(ex, filepath.Join(temp, "age-plugin-dmhtest")))
+	t.Setenv("PATH", temp+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestNewPluginAge(t *testing.T) {
+	tests := []struct {
+		inputRecipient        string
+		inputIdentity         string
+		expectedErrorContains string
+	}{
+		{
+			expectedErrorContains: "recipient or identity must be provided",
+		},
+		{
+			inputRecipient:        "age1broken",
+			expectedErrorContains: "invalid age plugin recipient",
+		},
+		{
+			inputIdentity:         "AGE-PLUGIN-BROKEN",
+			expectedErrorContains: "invalid age plugin identity",
+		},
+		{
+			inputRecipient: plugin.EncodeRecipient("dmhtest", []byte("data")),
+		},
+		{
+			inputIdentity: plugin.EncodeIdentity("dmhtest", []byte("data")),
+		},
+	}
+	for _, test := range tests {
+		c, err := NewPluginAge(test.inputRecipient, test.inputIdentity)
+		if test.expectedErrorContains != "" {
+			require.ErrorContains(t, err, test.expectedErrorContains)
+			require.Nil(t, c)
+			continue
+		}
+		require.Nil(t, err)
+		require.IsType(t, &PluginAge{}, c)
+	}
+}
+
+func TestPluginAgeEncryptDecrypt(t *testing.T) {
+	installTestPlugin(t)
+
+	identity, err := age.GenerateX25519Identity()
+	require.Nil(t, err)
+	recipient := plugin.EncodeRecipient("dmhtest", []byte(identity.Recipient().String()))
+	pluginIdentity := plugin.EncodeIdentity("dmhtest", []byte(identity.String()))
+
+	encryptOnly, err := NewPluginAge(recipient, "")
+	require.Nil(t, err)
+	encrypted, err := encryptOnly.Encrypt("test")
+	require.Nil(t, err)
+
+	_, err = encryptOnly.Decrypt(encrypted)
+	require.EqualError(t, err, "age plugin identity is not configured")
+
+	decryptOnly, err := NewPluginAge("", pluginIdentity)
+	require.Nil(t, err)
+	_, err = decryptOnly.Encrypt("test")
+	require.EqualError(t, err, "age plugin recipient is not configured")
+
+	decrypted, err := decryptOnly.Decrypt(encrypted)
+	require.Nil(t, err)
+	require.Equal(t, "test", decrypted)
+
+	other, err := age.GenerateX25519Identity()
+	require.Nil(t, err)
+	wrongIdentity, err := NewPluginAge("", plugin.EncodeIdentity("dmhtest", []byte(other.String())))
+	require.Nil(t, err)
+	_, err = wrongIdentity.Decrypt(encrypted)
+	require.NotNil(t, err)
+}
+
+func TestPluginAgeMissingPlugin(t *testing.T) {
+	c, err := NewPluginAge(plugin.EncodeRecipient("dmhmissing", []byte("data")), "")
+	require.Nil(t, err)
+	_, err = c.Encrypt("test")
+	var notFound *plugin.NotFoundError
+	require.ErrorAs(t, err, &notFound, fmt.Sprintf("unexpected error %v", err))
+}
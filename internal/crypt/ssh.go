@@ -0,0 +1,118 @@
+package crypt
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+
+	"filippo.io/age"
+	"filippo.io/age/agessh"
+	"golang.org/x/crypto/ssh"
+)
+
+// SSH key types supported by age, they are used as EncryptionKind of data encrypted to SSH key.
+const (
+	SSHEd25519EncryptionKind = "ssh-ed25519"
+	SSHRSAEncryptionKind     = "ssh-rsa"
+)
+
+// SSHEncryptionKindPrefix is used when action data is additionally encrypted to SSH recipient.
+// Data is first encrypted to SSH recipient, result is encrypted with X25519 key stored in vault.
+// Prefix is followed by SSH key type without ssh- (e.g. X25519+ssh-ed25519).
+const SSHEncryptionKindPrefix = EncryptionKind + "+ssh-"
+
+// SSHAgeInterface implement SSHAge.
+type SSHAgeInterface interface {
+	Encrypt(string) (string, error)
+	Decrypt(string) (string, error)
+	GetPublicKey() string
+	Kind() string
+}
+
+// SSHAge stores age recipient and identity created from SSH key (Ed25519 or RSA).
+type SSHAge struct {
+	recipient age.Recipient
+	identity  age.Identity
+	publicKey ssh.PublicKey
+}
+
+// NewSSHAge returns new instance of SSHAge.
+// recipient is SSH public key in authorized_keys format, identity is unencrypted SSH private key (PEM).
+// When only identity is provided, recipient is its public key. When both are provided they must match.
+func NewSSHAge(recipient string, identity []byte) (SSHAgeInterface, error) {
+	if recipient == "" && len(identity) == 0 {
+		return nil, fmt.Errorf("recipient or identity must be provided")
+	}
+	c := &SSHAge{}
+	if len(identity) > 0 {
+		i, err := agessh.ParseIdentity(identity)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ssh identity: %w", err)
+		}
+		signer, err := ssh.ParsePrivateKey(identity)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ssh identity: %w", err)
+		}
+		c.identity = i
+		c.publicKey = signer.PublicKey()
+		switch i := i.(type) {
+		case *agessh.Ed25519Identity:
+			c.recipient = i.Recipient()
+		case *agessh.RSAIdentity:
+			c.recipient = i.Recipient()
+		}
+	}
+	if recipient != "" {
+		publicKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(recipient))
+		if err != nil {
+			return nil, fmt.Errorf("invalid ssh recipient: %w", err)
+		}
+		r, err := agessh.ParseRecipient(string(bytes.TrimSpace(ssh.MarshalAuthorizedKey(publicKey))))
+		if err != nil {
+			return nil, fmt.Errorf("invalid ssh recipient: %w", err)
+		}
+		if c.publicKey != nil && !bytes.Equal(c.publicKey.Marshal(), publicKey.Marshal()) {
+			return nil, fmt.Errorf("ssh recipient does not match ssh identity")
+		}
+		c.recipient = r
+		c.publicKey = publicKey
+	}
+	return c, nil
+}
+
+// Encrypt encrypts input data to SSH recipient.
+// Encrypted data is base64 encoded.
+func (c *SSHAge) Encrypt(data string) (string, error) {
+	return encrypt(data, c.recipient)
+}
+
+// Decrypt decrypts input data with SSH identity.
+// Decrypt expect that input data is base64 encoded.
+func (c *SSHAge) Decrypt(data string) (string, error) {
+	if c.identity == nil {
+		return "", fmt.Errorf("ssh identity is not configured")
+	}
+	return decrypt(data, c.identity)
+}
+
+// GetPublicKey returns SSH public key in authorized_keys format.
+func (c *SSHAge) GetPublicKey() string {
+	return string(bytes.TrimSpace(ssh.MarshalAuthorizedKey(c.publicKey)))
+}
+
+// Kind returns SSH key type (SSHEd25519EncryptionKind or SSHRSAEncryptionKind).
+func (c *SSHAge) Kind() string {
+	return c.publicKey.Type()
+}
+
+// ReadSSHKeyFile reads SSH private key from file which must not be accessible by group or others.
+func ReadSSHKeyFile(path string) ([]byte, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if perm := info.Mode().Perm(); perm&0077 != 0 {
+		return nil, fmt.Errorf("%s permissions %#o are too open, it should be 600 or stricter", path, perm)
+	}
+	return os.ReadFile(path)
+}
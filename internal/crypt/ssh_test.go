@@ -0,0 +1,152 @@
+package crypt
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+// newTestSSHKey returns SSH private key (PEM) and its public key in authorized_keys format.
+func newTestSSHKey(t *testing.T, kind string) ([]byte, string) {
+	var key any
+	switch kind {
+	case SSHEd25519EncryptionKind:
+		_, priv, err := ed25519.GenerateKey(rand.Reader)
+		require.Nil(t, err)
+		key = priv
+	case SSHRSAEncryptionKind:
+		priv, err := rsa.GenerateKey(rand.Reader, 2048)
+		require.Nil(t, err)
+		key = priv
+	}
+	block, err := ssh.MarshalPrivateKey(key, "")
+	require.Nil(t, err)
+	signer, err := ssh.NewSignerFromKey(key)
+	require.Nil(t, err)
+	return pem.EncodeToMemory(block), strings.TrimSpace(string(ssh.MarshalAuthorizedKey(signer.PublicKey())))
+}
+
+func TestNewSSHAge(t *testing.T) {
+	ed25519Key, ed25519Public := newTestSSHKey(t, SSHEd25519EncryptionKind)
+	_, otherPublic := newTestSSHKey(t, SSHEd25519EncryptionKind)
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.Nil(t, err)
+	encryptedBlock, err := ssh.MarshalPrivateKeyWithPassphrase(priv, "", []byte("passphrase"))
+	require.Nil(t, err)
+
+	tests := []struct {
+		inputRecipient        string
+		inputIdentity         []byte
+		expectedErrorContains string
+		expectedPublicKey     string
+	}{
+		{
+			expectedErrorContains: "recipient or identity must be provided",
+		},
+		{
+			inputIdentity:         []byte("not a key"),
+			expectedErrorContains: "invalid ssh identity",
+		},
+		{
+			inputIdentity:         pem.EncodeToMemory(encryptedBlock),
+			expectedErrorContains: "invalid ssh identity",
+		},
+		{
+			inputRecipient:        "ssh-ed25519 invalid",
+			expectedErrorContains: "invalid ssh recipient",
+		},
+		{
+			inputRecipient:        "ecdsa-sha2-nistp256 AAAAE2VjZHNhLXNoYTItbmlzdHAyNTYAAAAIbmlzdHAyNTYAAABBBEmKSENjQEezOmxkZMy7opKgwFB9nkt5YRrYMjNuG5N87uRgg6CLrbo5wAdT/y6v0mKV0U2w0WZ2YB/++Tpockg=",
+			expectedErrorContains: "invalid ssh recipient",
+		},
+		{
+			inputRecipient:        otherPublic,
+			inputIdentity:         ed25519Key,
+			expectedErrorContains: "ssh recipient does not match ssh identity",
+		},
+		{
+			inputIdentity:     ed25519Key,
+			expectedPublicKey: ed25519Public,
+		},
+		{
+			inputRecipient:    ed25519Public + " user@host",
+			inputIdentity:     ed25519Key,
+			expectedPublicKey: ed25519Public,
+		},
+		{
+			inputRecipient:    ed25519Public,
+			expectedPublicKey: ed25519Public,
+		},
+	}
+	for _, test := range tests {
+		c, err := NewSSHAge(test.inputRecipient, test.inputIdentity)
+		if test.expectedErrorContains != "" {
+			require.ErrorContains(t, err, test.expectedErrorContains)
+			continue
+		}
+		require.Nil(t, err)
+		require.Equal(t, test.expectedPublicKey, c.GetPublicKey())
+		require.Equal(t, SSHEd25519EncryptionKind, c.Kind())
+	}
+}
+
+func TestSSHAgeEncrypt(t *testing.T) {
+	for _, kind := range []string{SSHEd25519EncryptionKind, SSHRSAEncryptionKind} {
+		key, public := newTestSSHKey(t, kind)
+
+		c, err := NewSSHAge("", key)
+		require.Nil(t, err)
+		require.Equal(t, kind, c.Kind())
+
+		encrypted, err := c.Encrypt("test data")
+		require.Nil(t, err)
+		decrypted, err := c.Decrypt(encrypted)
+		require.Nil(t, err)
+		require.Equal(t, "test data", decrypted)
+
+		// Recipient alone can only encrypt.
+		recipientOnly, err := NewSSHAge(public, nil)
+		require.Nil(t, err)
+		encrypted, err = recipientOnly.Encrypt("test data")
+		require.Nil(t, err)
+		_, err = recipientOnly.Decrypt(encrypted)
+		require.Equal(t, "ssh identity is not configured", err.Error())
+		decrypted, err = c.Decrypt(encrypted)
+		require.Nil(t, err)
+		require.Equal(t, "test data", decrypted)
+
+		// Data encrypted to other key can't be decrypted.
+		otherKey, _ := newTestSSHKey(t, kind)
+		other, err := NewSSHAge("", otherKey)
+		require.Nil(t, err)
+		_, err = other.Decrypt(encrypted)
+		require.Error(t, err)
+	}
+}
+
+func TestReadSSHKeyFile(t *testing.T) {
+	dir := t.TempDir()
+	key, _ := newTestSSHKey(t, SSHEd25519EncryptionKind)
+
+	keyFile := filepath.Join(dir, "id_ed25519")
+	require.Nil(t, os.WriteFile(keyFile, key, 0600))
+	data, err := ReadSSHKeyFile(keyFile)
+	require.Nil(t, err)
+	require.Equal(t, key, data)
+
+	openKeyFile := filepath.Join(dir, "id_ed25519_open")
+	require.Nil(t, os.WriteFile(openKeyFile, key, 0644))
+	_, err = ReadSSHKeyFile(openKeyFile)
+	require.ErrorContains(t, err, "permissions 0644 are too open")
+
+	_, err = ReadSSHKeyFile(filepath.Join(dir, "missing"))
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
@@ -2,6 +2,7 @@ package execute
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
@@ -12,6 +13,7 @@ import (
 	"time"
 
 	"dmh/internal/state"
+	"dmh/internal/useragent"
 )
 
 var (
@@ -42,7 +44,7 @@ type sendRequest struct {
 }
 
 // Run will sent SMS over https://www.bulksms.com/ HTTP API.
-func (d *ExecuteBulkSMS) Run() error {
+func (d *ExecuteBulkSMS) Run(ctx context.Context) error {
 	sr := &sendRequest{
 		Body:         d.Message,
 		Encoding:     "UNICODE",
@@ -53,7 +55,7 @@ func (d *ExecuteBulkSMS) Run() error {
 	if err != nil {
 		return err
 	}
-	req, err := http.NewRequest("POST", endpoint, bytes.NewBuffer(marshaledData))
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewBuffer(marshaledData))
 	if err != nil {
 		return err
 	}
@@ -62,7 +64,7 @@ func (d *ExecuteBulkSMS) Run() error {
 	authPair := fmt.Sprintf("%s:%s", d.config.Token.ID, d.config.Token.Secret)
 	req.Header.Set("Authorization", fmt.Sprintf("Basic %s", base64.StdEncoding.EncodeToString([]byte(authPair))))
 
-	client := &http.Client{Timeout: 30 * time.Second}
+	client := &http.Client{Timeout: 30 * time.Second, Transport: &useragent.Transport{}}
 	resp, err := client.Do(req)
 	if err != nil {
 		return err
@@ -1,6 +1,7 @@
 package execute
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -96,7 +97,7 @@ func TestBulkSMSRun(t *testing.T) {
 			}()
 		}
 		plugin := test.inputPlugin
-		err := plugin.Run()
+		err := plugin.Run(context.Background())
 		if test.expectedError {
 			require.NotNil(t, err)
 		} else {
@@ -0,0 +1,152 @@
+package execute
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	"dmh/internal/useragent"
+)
+
+// ErrPrivateAddress is returned when json_post URL points to private address and deny_private is enabled.
+var ErrPrivateAddress = errors.New("private address is not allowed")
+
+var (
+	// mocks for tests
+	lookupNetIP = net.DefaultResolver.LookupNetIP
+)
+
+// privateAddr reports whether addr is loopback, private (RFC1918, unique local), link-local
+// (including cloud metadata 169.254.169.254) or unspecified address.
+func privateAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsLoopback() || addr.IsPrivate() || addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() || addr.IsUnspecified()
+}
+
+// validateAllow checks that every allow entry is IP address, CIDR or host name.
+func validateAllow(allow []string) error {
+	for _, entry := range allow {
+		if validPrefixOrAddr(entry) {
+			continue
+		}
+		if entry == "" || strings.ContainsAny(entry, " /:") {
+			return fmt.Errorf("allow %q must be IP address, CIDR or host name", entry)
+		}
+	}
+	return nil
+}
+
+func validPrefixOrAddr(entry string) bool {
+	if _, err := netip.ParsePrefix(entry); err == nil {
+		return true
+	}
+	_, err := netip.ParseAddr(entry)
+	return err == nil
+}
+
+// allowedHost reports whether host name (or IP literal) is listed in allow.
+func (c JSONPostConfig) allowedHost(host string) bool {
+	return slices.ContainsFunc(c.Allow, func(entry string) bool {
+		return strings.EqualFold(entry, host)
+	})
+}
+
+// allowedAddr reports whether addr is covered by IP or CIDR listed in allow.
+func (c JSONPostConfig) allowedAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, entry := range c.Allow {
+		if prefix, err := netip.ParsePrefix(entry); err == nil && prefix.Contains(addr) {
+			return true
+		}
+		if allowed, err := netip.ParseAddr(entry); err == nil && allowed.Unmap() == addr {
+			return true
+		}
+	}
+	return false
+}
+
+// checkAddr returns ErrPrivateAddress when addr is private and not allowed.
+func (c JSONPostConfig) checkAddr(addr netip.Addr) error {
+	if privateAddr(addr) && !c.allowedAddr(addr) {
+		return fmt.Errorf("%w: %s", ErrPrivateAddress, addr.Unmap())
+	}
+	return nil
+}
+
+// checkURL resolves host of rawURL and returns error when any of its addresses is private and not allowed.
+// Host listed in allow by name is not resolved.
+func (c JSONPostConfig) checkURL(ctx context.Context, rawURL string) error {
+	if !c.DenyPrivate {
+		return nil
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	host := u.Hostname()
+	if host == "" {
+		return fmt.Errorf("url must contain host")
+	}
+	if c.allowedHost(host) {
+		return nil
+	}
+	if addr, err := netip.ParseAddr(host); err == nil {
+		return c.checkAddr(addr)
+	}
+	addrs, err := lookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return fmt.Errorf("unable to resolve %s: %w", host, err)
+	}
+	for _, addr := range addrs {
+		if err := c.checkAddr(addr); err != nil {
+			return fmt.Errorf("%s %w", host, err)
+		}
+	}
+	return nil
+}
+
+// transport returns http transport which refuses to connect to private addresses not allowed by config.
+// Address is checked when connection is made, so host can't resolve to different address after checkURL.
+func (c JSONPostConfig) transport(rawURL string) http.RoundTripper {
+	if !c.DenyPrivate {
+		return nil
+	}
+	if u, err := url.Parse(rawURL); err == nil && c.allowedHost(u.Hostname()) {
+		return nil
+	}
+	dialer := &net.Dialer{
+		Control: func(network string, address string, conn syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return err
+			}
+			return c.checkAddr(addrPort.Addr())
+		},
+	}
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.DialContext = dialer.DialContext
+	return t
+}
+
+// HTTPClient returns client for request to rawURL, which refuses private addresses not allowed by config
+// (when deny_private is enabled) and does not follow redirects.
+// It is used by json_post and by other requests to user provided URLs, e.g. action callbacks.
+func (c JSONPostConfig) HTTPClient(rawURL string, timeout time.Duration) *http.Client {
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: &useragent.Transport{Base: c.transport(rawURL)},
+		// dont follow redirects.
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
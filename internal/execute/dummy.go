@@ -1,6 +1,7 @@
 package execute
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
@@ -16,7 +17,7 @@ type ExecuteDummy struct {
 }
 
 // Run will log Message. Its should be only used for tests.
-func (d *ExecuteDummy) Run() error {
+func (d *ExecuteDummy) Run(ctx context.Context) error {
 	if d.FailOnRun {
 		return fmt.Errorf("FailOnRun error")
 	}
@@ -1,6 +1,7 @@
 package execute
 
 import (
+	"context"
 	"fmt"
 	"testing"
 
@@ -24,7 +25,7 @@ func TestDummyRun(t *testing.T) {
 	}
 	for _, test := range tests {
 		plugin := test.inputPlugin
-		err := plugin.Run()
+		err := plugin.Run(context.Background())
 		require.Equal(t, test.expectedError, err)
 	}
 }
@@ -1,8 +1,14 @@
 package execute
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
 
 	"dmh/internal/state"
 )
@@ -12,59 +18,171 @@ var (
 	jsonMarshal = json.Marshal
 )
 
+// ErrKindNotEnabled is returned for action kind which is not listed in execute.allowed_kinds.
+var ErrKindNotEnabled = errors.New("is not enabled")
+
+// ErrTemporary is wrapped by plugin errors which are expected to pass when action is retried later,
+// e.g. SMTP 4xx greylisting. Other errors are permanent.
+var ErrTemporary = errors.New("temporary failure")
+
+// builtinKinds are action kinds known to UnmarshalActionData.
+var builtinKinds = []string{"json_post", "http", "form_post", "bulksms", "mail", "journal", "file_write", "dummy"}
+
+// RunMeta describes action which is run, it is available to plugins supporting templates.
+type RunMeta struct {
+	UUID     string
+	Comment  string
+	LastSeen time.Time
+}
+
+// runMetaKey is context key for RunMeta.
+type runMetaKey struct{}
+
+// WithRunMeta returns ctx carrying RunMeta for plugins.
+func WithRunMeta(ctx context.Context, meta RunMeta) context.Context {
+	return context.WithValue(ctx, runMetaKey{}, meta)
+}
+
+// runMetaFromContext returns RunMeta from ctx, empty RunMeta is returned when ctx does not carry it (e.g. test action).
+func runMetaFromContext(ctx context.Context) RunMeta {
+	meta, _ := ctx.Value(runMetaKey{}).(RunMeta)
+	return meta
+}
+
 // ExecuteData describes interface for every execute plugin.
 type ExecuteData interface {
-	Run() error                    // Run executes plugin
+	Run(context.Context) error     // Run executes plugin, it must stop when context is done
 	Populate(*state.Action) error  // Populate will populate plugin struct with Action.Data
 	PopulateConfig(*Execute) error // PopulateConfig will populate plugin config struct from Executor config
 }
 
 // ExecuteInterface describes interface for Execute.
 type ExecuteInterface interface {
-	Run(*state.Action) error
+	Run(context.Context, *state.Action) error
+	RunVerification(context.Context, *state.Action, string) error
+	Validate(*state.Action) error
+	Preview(*state.Action) ([]Recipient, error)
+	KindEnabled(string) error
 }
 
 // Execute stores internal data.
 type Execute struct {
 	bulkSMSConf     BulkSMSConfig
 	mailConf        MailConfig
+	jsonPostConf    JSONPostConfig
+	journalConf     JournalConfig
+	fileWriteConf   FileWriteConfig
 	signedURLSecret string
 	signedURLTTL    int
+	testMode        TestModeConfig
+	allowedKinds    []string
 }
 
 // New returns new instance of Execute.
+// Every entry of Options.AllowedKinds must be built-in kind.
+// In ModeQueue returned Queue publishes actions instead of running them.
 func New(opts *Options) (ExecuteInterface, error) {
+	for _, kind := range opts.AllowedKinds {
+		if !slices.Contains(builtinKinds, kind) {
+			return nil, fmt.Errorf("execute.allowed_kinds contains unknown kind %s", kind)
+		}
+	}
 	e := &Execute{
 		bulkSMSConf:     opts.BulkSMSConf,
 		mailConf:        opts.MailConf,
+		jsonPostConf:    opts.JSONPostConf,
+		journalConf:     opts.JournalConf,
+		fileWriteConf:   opts.FileWriteConf,
 		signedURLSecret: opts.SignedURLSecret,
 		signedURLTTL:    opts.SignedURLTTL,
+		testMode:        opts.TestMode,
+		allowedKinds:    opts.AllowedKinds,
+	}
+
+	switch opts.Mode {
+	case "", ModeLocal:
+		return e, nil
+	case ModeQueue:
+		if err := opts.QueueConf.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid execute.queue config: %w", err)
+		}
+		// Test recipients can't be applied to published action, consumer would deliver to real ones.
+		if opts.TestMode.Enabled {
+			return nil, fmt.Errorf("execute.test_mode is not supported with execute.mode %s", ModeQueue)
+		}
+		if strings.HasPrefix(opts.QueueConf.URL, "nats://") {
+			log.Printf("WARNING: execute.queue.url uses nats://, decrypted action data is sent in cleartext unless queue server requires TLS, use tls://")
+		}
+		return &Queue{Execute: e, config: opts.QueueConf}, nil
+	default:
+		return nil, fmt.Errorf("execute.mode should be %s or %s", ModeLocal, ModeQueue)
+	}
+}
+
+// Run will execute Action.
+// ctx bounds execution, plugins abort external calls when it is done.
+// In test mode delivery is redirected to test recipients.
+func (e *Execute) Run(ctx context.Context, a *state.Action) error {
+	data, err := e.prepare(a)
+	if err != nil {
+		return err
+	}
+	if err := applyTestMode(data, e.testMode); err != nil {
+		return fmt.Errorf("test mode: %w", err)
 	}
+	return data.Run(ctx)
+}
 
-	return e, nil
+// Validate will prepare Action (and its fallback) exactly like Run does, but it will never execute it.
+func (e *Execute) Validate(a *state.Action) error {
+	if _, err := e.prepare(a); err != nil {
+		return err
+	}
+	if fallback := a.FallbackAction(); fallback != nil {
+		if _, err := e.prepare(fallback); err != nil {
+			return fmt.Errorf("fallback: %w", err)
+		}
+	}
+	return nil
+}
+
+// KindEnabled returns ErrKindNotEnabled when kind is not listed in execute.allowed_kinds.
+// Unknown kinds are not rejected here, UnmarshalActionData reports them.
+func (e *Execute) KindEnabled(kind string) error {
+	if len(e.allowedKinds) == 0 || slices.Contains(e.allowedKinds, kind) || !slices.Contains(builtinKinds, kind) {
+		return nil
+	}
+	return fmt.Errorf("kind %q %w", kind, ErrKindNotEnabled)
 }
 
-// Run will execute Action).
-func (e *Execute) Run(a *state.Action) error {
+// prepare returns plugin populated with Action.Data and Executor config.
+func (e *Execute) prepare(a *state.Action) (ExecuteData, error) {
+	if err := e.KindEnabled(a.Kind); err != nil {
+		return nil, err
+	}
 	action := *a
 	e.expandSigAuth(&action)
 	data, err := UnmarshalActionData(&action)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	if err := data.PopulateConfig(e); err != nil {
-		return err
+		return nil, err
 	}
-	return data.Run()
+	return data, nil
 }
 
 // UnmarshalActionData will unmarshal Action.Data into valid plugin which can be executed.
 func UnmarshalActionData(action *state.Action) (ExecuteData, error) {
 	switch action.Kind {
-	case "json_post":
+	case "json_post", "http":
 		data := &ExecuteJSONPost{}
 		err := data.Populate(action)
 		return data, err
+	case "form_post":
+		data := &ExecuteFormPost{}
+		err := data.Populate(action)
+		return data, err
 	case "bulksms":
 		data := &ExecuteBulkSMS{}
 		err := data.Populate(action)
@@ -73,6 +191,14 @@ func UnmarshalActionData(action *state.Action) (ExecuteData, error) {
 		data := &ExecuteMail{}
 		err := data.Populate(action)
 		return data, err
+	case "journal":
+		data := &ExecuteJournal{}
+		err := data.Populate(action)
+		return data, err
+	case "file_write":
+		data := &ExecuteFileWrite{}
+		err := data.Populate(action)
+		return data, err
 	case "dummy":
 		data := &ExecuteDummy{}
 		err := data.Populate(action)
@@ -1,6 +1,8 @@
 package execute
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"testing"
 
@@ -61,6 +63,25 @@ func TestNew(t *testing.T) {
 				}
 			},
 		},
+		{
+			inputOptions: &Options{
+				AllowedKinds: []string{"mail", "dummy"},
+			},
+			expectedExecute: func() ExecuteInterface {
+				return &Execute{
+					allowedKinds: []string{"mail", "dummy"},
+				}
+			},
+		},
+		{
+			inputOptions: &Options{
+				AllowedKinds: []string{"mail", "command"},
+			},
+			expectedError: fmt.Errorf("execute.allowed_kinds contains unknown kind command"),
+			expectedExecute: func() ExecuteInterface {
+				return nil
+			},
+		},
 	}
 	for _, test := range tests {
 		e, err := New(test.inputOptions)
@@ -70,6 +91,21 @@ func TestNew(t *testing.T) {
 	}
 }
 
+func TestKindEnabled(t *testing.T) {
+	e := &Execute{allowedKinds: []string{"dummy"}}
+	require.Nil(t, e.KindEnabled("dummy"))
+	require.EqualError(t, e.KindEnabled("mail"), `kind "mail" is not enabled`)
+	require.ErrorIs(t, e.KindEnabled("mail"), ErrKindNotEnabled)
+	// unknown kind is reported by UnmarshalActionData
+	require.Nil(t, e.KindEnabled("command"))
+	require.Nil(t, (&Execute{}).KindEnabled("mail"))
+
+	err := e.Run(context.Background(), &state.Action{Kind: "json_post", Data: `{"url": "https://test", "success_code": [200]}`})
+	require.ErrorIs(t, err, ErrKindNotEnabled)
+	err = e.Validate(&state.Action{Kind: "dummy", Data: `{"message": "test"}`, Fallback: &state.Fallback{Kind: "mail", Data: `{}`}})
+	require.EqualError(t, err, `fallback: kind "mail" is not enabled`)
+}
+
 func TestRun(t *testing.T) {
 	tests := []struct {
 		inputExecute  *Execute
@@ -97,7 +133,48 @@ func TestRun(t *testing.T) {
 		},
 	}
 	for _, test := range tests {
-		err := test.inputExecute.Run(test.inputAction)
+		err := test.inputExecute.Run(context.Background(), test.inputAction)
+		require.Equal(t, test.expectedError, err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		inputExecute  *Execute
+		inputAction   *state.Action
+		expectedError error
+	}{
+		{
+			inputExecute:  &Execute{},
+			inputAction:   &state.Action{Kind: "dummy", Data: `{"fail_on_populate": true}`},
+			expectedError: fmt.Errorf("FailOnPopulate error"),
+		},
+		{
+			inputExecute:  &Execute{},
+			inputAction:   &state.Action{Kind: "dummy", Data: `{"fail_on_populate_config": true, "message": "test"}`},
+			expectedError: fmt.Errorf("FailOnPopulateConfig error"),
+		},
+		{
+			inputExecute: &Execute{},
+			inputAction:  &state.Action{Kind: "dummy", Data: `{"fail_on_run": true, "message": "test"}`},
+		},
+		{
+			inputExecute:  &Execute{},
+			inputAction:   &state.Action{Kind: "mail", Data: `{"message": "test", "destination": ["test@test.com"], "subject": "test"}`},
+			expectedError: fmt.Errorf("server must be provided"),
+		},
+		{
+			inputExecute: &Execute{},
+			inputAction:  &state.Action{Kind: "dummy", Data: `{"message": "test"}`, Fallback: &state.Fallback{Kind: "dummy", Data: `{"message": "fallback"}`}},
+		},
+		{
+			inputExecute:  &Execute{},
+			inputAction:   &state.Action{Kind: "dummy", Data: `{"message": "test"}`, Fallback: &state.Fallback{Kind: "dummy", Data: `{"fail_on_populate": true}`}},
+			expectedError: fmt.Errorf("fallback: %w", fmt.Errorf("FailOnPopulate error")),
+		},
+	}
+	for _, test := range tests {
+		err := test.inputExecute.Validate(test.inputAction)
 		require.Equal(t, test.expectedError, err)
 	}
 }
@@ -125,6 +202,22 @@ func TestUnmarshalActionData(t *testing.T) {
 				URL: "test", SuccessCode: []int{200}, Data: map[string]any{"test": "value"},
 			},
 		},
+		{
+			inputAction: &state.Action{
+				Kind: "http", Data: `{"url":"test", "method": "PUT", "success_code": [200], "data": {"test": "value"}}`,
+			},
+			expectedData: &ExecuteJSONPost{
+				URL: "test", Method: "PUT", SuccessCode: []int{200}, Data: map[string]any{"test": "value"},
+			},
+		},
+		{
+			inputAction: &state.Action{
+				Kind: "form_post", Data: `{"url":"https://test/hook", "success_code": [200], "fields": {"test": "value"}}`,
+			},
+			expectedData: &ExecuteFormPost{
+				URL: "https://test/hook", SuccessCode: []int{200}, Fields: map[string]string{"test": "value"},
+			},
+		},
 		{
 			inputAction: &state.Action{
 				Kind: "bulksms", Data: `{"message": "", "destination": ["11111"]}`,
@@ -176,6 +269,19 @@ func TestUnmarshalActionData(t *testing.T) {
 				Message: "test", FailOnRun: false, FailOnPopulate: false, FailOnPopulateConfig: false,
 			},
 		},
+		{
+			inputAction: &state.Action{
+				Kind: "journal", Data: `{}`,
+			},
+			expectedError: fmt.Errorf("data must be provided"),
+			expectedData:  &ExecuteJournal{},
+		},
+		{
+			inputAction: &state.Action{
+				Kind: "journal", Data: `{"message": "test"}`,
+			},
+			expectedData: &ExecuteJournal{data: json.RawMessage(`{"message": "test"}`)},
+		},
 		{
 			inputAction: &state.Action{
 				Kind: "non-existing", Data: `{}`,
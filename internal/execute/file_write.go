@@ -0,0 +1,142 @@
+package execute
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"dmh/internal/state"
+)
+
+// defaultFileWriteMode is used when action does not provide mode.
+const defaultFileWriteMode os.FileMode = 0600
+
+type FileWriteConfig struct {
+	AllowedDirs []string `koanf:"allowed_dirs"` // files can be written only under these dirs
+}
+
+// ExecuteFileWrite writes content to local file, e.g. to deposit document on local disk or mounted share.
+// Path must be under one of execute.plugin.file_write.allowed_dirs.
+type ExecuteFileWrite struct {
+	Path       string `json:"path"`
+	Content    string `json:"content"`
+	Mode       string `json:"mode"`        // octal file mode, default 0600
+	Append     bool   `json:"append"`      // append to existing file instead of replacing it
+	CreateDirs bool   `json:"create_dirs"` // create missing parent dirs with 0700
+	mode       os.FileMode
+	config     FileWriteConfig
+}
+
+// Run writes content to file and syncs it to disk.
+// Path is checked again with symlinks resolved, so symlink inside allowed dir can't redirect write outside of it.
+func (d *ExecuteFileWrite) Run(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	dir := filepath.Dir(d.Path)
+	if d.CreateDirs {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return fmt.Errorf("unable to create dir %s: %w", dir, err)
+		}
+	}
+	realDir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return fmt.Errorf("unable to resolve dir %s: %w", dir, err)
+	}
+	var realAllowedDirs []string
+	for _, allowedDir := range d.config.AllowedDirs {
+		if realAllowedDir, err := filepath.EvalSymlinks(allowedDir); err == nil {
+			realAllowedDirs = append(realAllowedDirs, realAllowedDir)
+		}
+	}
+	if !underDirs(filepath.Join(realDir, filepath.Base(d.Path)), realAllowedDirs) {
+		return fmt.Errorf("path %s resolves outside of allowed dirs", d.Path)
+	}
+	if info, err := os.Lstat(d.Path); err == nil && info.Mode()&os.ModeSymlink != 0 {
+		return fmt.Errorf("path %s is a symlink", d.Path)
+	}
+
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if d.Append {
+		flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	}
+	f, err := os.OpenFile(d.Path, flags, d.mode)
+	if err != nil {
+		return fmt.Errorf("unable to open file: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.WriteString(d.Content); err != nil {
+		return fmt.Errorf("unable to write file: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("unable to sync file: %w", err)
+	}
+	return f.Close()
+}
+
+func (d *ExecuteFileWrite) Populate(a *state.Action) error {
+	if err := json.Unmarshal([]byte(a.Data), d); err != nil {
+		return err
+	}
+	if d.Path == "" {
+		return fmt.Errorf("path must be provided")
+	}
+	if !filepath.IsAbs(d.Path) {
+		return fmt.Errorf("path must be absolute")
+	}
+	d.Path = filepath.Clean(d.Path)
+	if d.Content == "" {
+		return fmt.Errorf("content must be provided")
+	}
+	d.mode = defaultFileWriteMode
+	if d.Mode != "" {
+		mode, err := strconv.ParseUint(d.Mode, 8, 32)
+		if err != nil || mode > 0777 {
+			return fmt.Errorf("mode must be octal file permissions (e.g. 0600)")
+		}
+		d.mode = os.FileMode(mode)
+	}
+	return nil
+}
+
+// Validate checks that allowed dirs are provided as absolute paths.
+func (c *FileWriteConfig) Validate() error {
+	if len(c.AllowedDirs) == 0 {
+		return fmt.Errorf("allowed_dirs must be provided")
+	}
+	for _, dir := range c.AllowedDirs {
+		if !filepath.IsAbs(dir) {
+			return fmt.Errorf("allowed dir %s must be absolute", dir)
+		}
+	}
+	return nil
+}
+
+// PopulateConfig checks that action path is under one of allowed dirs.
+func (d *ExecuteFileWrite) PopulateConfig(e *Execute) error {
+	d.config = e.fileWriteConf
+	if err := d.config.Validate(); err != nil {
+		return err
+	}
+	if !underDirs(d.Path, d.config.AllowedDirs) {
+		return fmt.Errorf("path %s is not under execute.plugin.file_write.allowed_dirs", d.Path)
+	}
+	return nil
+}
+
+// underDirs returns true when path is inside (not equal to) one of dirs.
+func underDirs(path string, dirs []string) bool {
+	for _, dir := range dirs {
+		rel, err := filepath.Rel(filepath.Clean(dir), path)
+		if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		return true
+	}
+	return false
+}
@@ -0,0 +1,158 @@
+package execute
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"dmh/internal/state"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileWriteRun(t *testing.T) {
+	allowedDir := t.TempDir()
+	config := FileWriteConfig{AllowedDirs: []string{allowedDir}}
+	letter := filepath.Join(allowedDir, "letter.txt")
+
+	plugin := &ExecuteFileWrite{Path: letter, Content: "first", mode: 0600, config: config}
+	require.Nil(t, plugin.Run(context.Background()))
+	plugin = &ExecuteFileWrite{Path: letter, Content: "second", mode: 0600, config: config}
+	require.Nil(t, plugin.Run(context.Background()))
+	data, err := os.ReadFile(letter)
+	require.Nil(t, err)
+	require.Equal(t, "second", string(data))
+
+	plugin = &ExecuteFileWrite{Path: letter, Content: " third", Append: true, mode: 0600, config: config}
+	require.Nil(t, plugin.Run(context.Background()))
+	data, err = os.ReadFile(letter)
+	require.Nil(t, err)
+	require.Equal(t, "second third", string(data))
+
+	nested := filepath.Join(allowedDir, "a", "b", "letter.txt")
+	plugin = &ExecuteFileWrite{Path: nested, Content: "nested", mode: 0640, config: config}
+	require.ErrorContains(t, plugin.Run(context.Background()), "unable to resolve dir")
+	plugin.CreateDirs = true
+	require.Nil(t, plugin.Run(context.Background()))
+	info, err := os.Stat(nested)
+	require.Nil(t, err)
+	require.Equal(t, os.FileMode(0640), info.Mode().Perm())
+
+	// Symlinks can't redirect write outside of allowed dirs.
+	outsideDir := t.TempDir()
+	require.Nil(t, os.Symlink(outsideDir, filepath.Join(allowedDir, "outside")))
+	plugin = &ExecuteFileWrite{Path: filepath.Join(allowedDir, "outside", "letter.txt"), Content: "test", mode: 0600, config: config}
+	require.ErrorContains(t, plugin.Run(context.Background()), "resolves outside of allowed dirs")
+	require.Nil(t, os.Symlink(filepath.Join(outsideDir, "letter.txt"), filepath.Join(allowedDir, "link.txt")))
+	plugin = &ExecuteFileWrite{Path: filepath.Join(allowedDir, "link.txt"), Content: "test", mode: 0600, config: config}
+	require.ErrorContains(t, plugin.Run(context.Background()), "is a symlink")
+	_, err = os.Stat(filepath.Join(outsideDir, "letter.txt"))
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	plugin = &ExecuteFileWrite{Path: letter, Content: "test", mode: 0600, config: config}
+	require.ErrorIs(t, plugin.Run(ctx), context.Canceled)
+}
+
+func TestFileWritePopulate(t *testing.T) {
+	tests := []struct {
+		inputAction   *state.Action
+		expectedError string
+		expectedData  *ExecuteFileWrite
+	}{
+		{
+			inputAction:   &state.Action{Kind: "file_write", Data: `{"broken"`},
+			expectedError: "unexpected end of JSON input",
+		},
+		{
+			inputAction:   &state.Action{Kind: "file_write", Data: `{"content": "test"}`},
+			expectedError: "path must be provided",
+		},
+		{
+			inputAction:   &state.Action{Kind: "file_write", Data: `{"path": "letter.txt", "content": "test"}`},
+			expectedError: "path must be absolute",
+		},
+		{
+			inputAction:   &state.Action{Kind: "file_write", Data: `{"path": "/var/dmh/letter.txt"}`},
+			expectedError: "content must be provided",
+		},
+		{
+			inputAction:   &state.Action{Kind: "file_write", Data: `{"path": "/var/dmh/letter.txt", "content": "test", "mode": "rw"}`},
+			expectedError: "mode must be octal file permissions (e.g. 0600)",
+		},
+		{
+			inputAction:   &state.Action{Kind: "file_write", Data: `{"path": "/var/dmh/letter.txt", "content": "test", "mode": "4755"}`},
+			expectedError: "mode must be octal file permissions (e.g. 0600)",
+		},
+		{
+			inputAction:  &state.Action{Kind: "file_write", Data: `{"path": "/var/dmh/out/../letter.txt", "content": "test"}`},
+			expectedData: &ExecuteFileWrite{Path: "/var/dmh/letter.txt", Content: "test", mode: 0600},
+		},
+		{
+			inputAction:  &state.Action{Kind: "file_write", Data: `{"path": "/var/dmh/letter.txt", "content": "test", "mode": "0644", "append": true, "create_dirs": true}`},
+			expectedData: &ExecuteFileWrite{Path: "/var/dmh/letter.txt", Content: "test", Mode: "0644", Append: true, CreateDirs: true, mode: 0644},
+		},
+	}
+	for _, test := range tests {
+		plugin := &ExecuteFileWrite{}
+		err := plugin.Populate(test.inputAction)
+		if test.expectedError != "" {
+			require.EqualError(t, err, test.expectedError)
+			continue
+		}
+		require.Nil(t, err)
+		require.Equal(t, test.expectedData, plugin)
+	}
+}
+
+func TestFileWritePopulateConfig(t *testing.T) {
+	tests := []struct {
+		inputPath     string
+		inputConfig   FileWriteConfig
+		expectedError string
+	}{
+		{
+			inputPath:     "/var/dmh/letter.txt",
+			expectedError: "allowed_dirs must be provided",
+		},
+		{
+			inputPath:     "/var/dmh/letter.txt",
+			inputConfig:   FileWriteConfig{AllowedDirs: []string{"dmh"}},
+			expectedError: "allowed dir dmh must be absolute",
+		},
+		{
+			inputPath:   "/var/dmh/letter.txt",
+			inputConfig: FileWriteConfig{AllowedDirs: []string{"/srv", "/var/dmh/"}},
+		},
+		{
+			inputPath:   "/var/dmh/out/letter.txt",
+			inputConfig: FileWriteConfig{AllowedDirs: []string{"/var/dmh"}},
+		},
+		{
+			inputPath:     "/var/dmh",
+			inputConfig:   FileWriteConfig{AllowedDirs: []string{"/var/dmh"}},
+			expectedError: "path /var/dmh is not under execute.plugin.file_write.allowed_dirs",
+		},
+		{
+			inputPath:     "/var/dmh-other/letter.txt",
+			inputConfig:   FileWriteConfig{AllowedDirs: []string{"/var/dmh"}},
+			expectedError: "path /var/dmh-other/letter.txt is not under execute.plugin.file_write.allowed_dirs",
+		},
+		{
+			inputPath:     "/etc/passwd",
+			inputConfig:   FileWriteConfig{AllowedDirs: []string{"/var/dmh"}},
+			expectedError: "path /etc/passwd is not under execute.plugin.file_write.allowed_dirs",
+		},
+	}
+	for _, test := range tests {
+		plugin := &ExecuteFileWrite{Path: test.inputPath}
+		err := plugin.PopulateConfig(&Execute{fileWriteConf: test.inputConfig})
+		if test.expectedError != "" {
+			require.EqualError(t, err, test.expectedError)
+			continue
+		}
+		require.Nil(t, err)
+	}
+}
@@ -0,0 +1,81 @@
+package execute
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"dmh/internal/state"
+	"dmh/internal/useragent"
+)
+
+// ExecuteFormPost is used by form_post kind, for endpoints which accept only form encoded body.
+type ExecuteFormPost struct {
+	URL         string            `json:"url"`
+	Headers     map[string]string `json:"headers"`
+	Fields      map[string]string `json:"fields"`
+	SuccessCode []int             `json:"success_code"`
+}
+
+// Run will sent HTTP POST request with application/x-www-form-urlencoded encoding.
+func (d *ExecuteFormPost) Run(ctx context.Context) error {
+	form := url.Values{}
+	for k, v := range d.Fields {
+		form.Set(k, v)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.URL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	for k, v := range d.Headers {
+		req.Header.Set(k, v)
+	}
+
+	client := &http.Client{
+		Timeout:   30 * time.Second,
+		Transport: &useragent.Transport{},
+		// dont follow redirects.
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if slices.Contains(d.SuccessCode, resp.StatusCode) {
+		return nil
+	}
+
+	return fmt.Errorf("received wrong status code %d", resp.StatusCode)
+}
+
+func (d *ExecuteFormPost) Populate(a *state.Action) error {
+	err := json.Unmarshal([]byte(a.Data), &d)
+	if err != nil {
+		return err
+	}
+	if u, err := url.Parse(d.URL); err != nil || u.Scheme == "" || u.Host == "" {
+		return fmt.Errorf("url must be a valid absolute url")
+	}
+	if len(d.SuccessCode) == 0 {
+		return fmt.Errorf("success_code must be provided")
+	}
+	if len(d.Fields) == 0 {
+		return fmt.Errorf("fields must be provided")
+	}
+	return nil
+}
+
+func (d *ExecuteFormPost) PopulateConfig(e *Execute) error {
+	return nil
+}
@@ -0,0 +1,152 @@
+package execute
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"dmh/internal/state"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormPostRun(t *testing.T) {
+	tests := []struct {
+		inputPlugin    func(string) *ExecuteFormPost
+		fakeHTTPServer func() *httptest.Server
+		expectedError  bool
+	}{
+		{
+			inputPlugin: func(string) *ExecuteFormPost {
+				return &ExecuteFormPost{
+					URL:    "broken\r",
+					Fields: map[string]string{"test": "test"},
+				}
+			},
+			expectedError: true,
+		},
+		{
+			inputPlugin: func(string) *ExecuteFormPost {
+				return &ExecuteFormPost{
+					URL:    "http://non-existing",
+					Fields: map[string]string{"test": "test"},
+				}
+			},
+			expectedError: true,
+		},
+		{
+			inputPlugin: func(url string) *ExecuteFormPost {
+				return &ExecuteFormPost{
+					URL:         url,
+					Fields:      map[string]string{"test": "test"},
+					SuccessCode: []int{http.StatusCreated},
+				}
+			},
+			fakeHTTPServer: func() *httptest.Server {
+				s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.WriteHeader(http.StatusOK)
+				}))
+				return s
+			},
+			expectedError: true,
+		},
+		{
+			inputPlugin: func(url string) *ExecuteFormPost {
+				return &ExecuteFormPost{
+					URL:         url,
+					Fields:      map[string]string{"to": "me@test.com", "text": "hello world&more"},
+					Headers:     map[string]string{"Authorization": "Basic dGVzdA=="},
+					SuccessCode: []int{http.StatusOK},
+				}
+			},
+			fakeHTTPServer: func() *httptest.Server {
+				s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					require.Equal(t, http.MethodPost, r.Method)
+					require.Equal(t, "application/x-www-form-urlencoded", r.Header.Get("Content-Type"))
+					require.Equal(t, "Basic dGVzdA==", r.Header.Get("Authorization"))
+					body, err := io.ReadAll(r.Body)
+					require.Nil(t, err)
+					require.Equal(t, "text=hello+world%26more&to=me%40test.com", string(body))
+					w.WriteHeader(http.StatusOK)
+				}))
+				return s
+			},
+		},
+		{
+			inputPlugin: func(url string) *ExecuteFormPost {
+				return &ExecuteFormPost{
+					URL:         url + "/redirect",
+					Fields:      map[string]string{"test": "test"},
+					SuccessCode: []int{http.StatusFound},
+				}
+			},
+			fakeHTTPServer: func() *httptest.Server {
+				mux := http.NewServeMux()
+				mux.HandleFunc("/redirect", func(w http.ResponseWriter, r *http.Request) {
+					http.Redirect(w, r, "/followed", http.StatusFound)
+				})
+				mux.HandleFunc("/followed", func(w http.ResponseWriter, r *http.Request) {
+					require.FailNow(t, "redirect target must not be requested")
+				})
+				return httptest.NewServer(mux)
+			},
+		},
+	}
+	for _, test := range tests {
+		var fakeURL string
+		if test.fakeHTTPServer != nil {
+			fakeServer := test.fakeHTTPServer()
+			fakeURL = fakeServer.URL
+			defer fakeServer.Close()
+		}
+		plugin := test.inputPlugin(fakeURL)
+		err := plugin.Run(context.Background())
+		if test.expectedError {
+			require.NotNil(t, err)
+		} else {
+			require.Nil(t, err)
+		}
+	}
+}
+
+func TestFormPostPopulate(t *testing.T) {
+	tests := []struct {
+		inputAction   *state.Action
+		expectedError string
+	}{
+		{
+			inputAction:   &state.Action{Kind: "form_post", Data: `{"broken"`},
+			expectedError: "unexpected end of JSON input",
+		},
+		{
+			inputAction:   &state.Action{Kind: "form_post", Data: `{"url": ""}`},
+			expectedError: "url must be a valid absolute url",
+		},
+		{
+			inputAction:   &state.Action{Kind: "form_post", Data: `{"url": "/relative"}`},
+			expectedError: "url must be a valid absolute url",
+		},
+		{
+			inputAction:   &state.Action{Kind: "form_post", Data: `{"url": "https://test", "success_code": []}`},
+			expectedError: "success_code must be provided",
+		},
+		{
+			inputAction:   &state.Action{Kind: "form_post", Data: `{"url": "https://test", "success_code": [200], "fields": {}}`},
+			expectedError: "fields must be provided",
+		},
+		{
+			inputAction: &state.Action{Kind: "form_post", Data: `{"url": "https://test", "success_code": [200], "fields": {"test": "test"}}`},
+		},
+	}
+	for _, test := range tests {
+		plugin := &ExecuteFormPost{}
+		err := plugin.Populate(test.inputAction)
+		if test.expectedError == "" {
+			require.Nil(t, err)
+		} else {
+			require.EqualError(t, err, test.expectedError)
+		}
+	}
+}
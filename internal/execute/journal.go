@@ -0,0 +1,91 @@
+package execute
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"dmh/internal/state"
+)
+
+type JournalConfig struct {
+	File string `koanf:"file"`
+}
+
+// ExecuteJournal appends record of action run to local journal file.
+// Data is kept as provided by user, it is written to journal as is.
+type ExecuteJournal struct {
+	data     json.RawMessage
+	testMode bool
+	config   JournalConfig
+}
+
+// journalEntry is single line of journal file.
+type journalEntry struct {
+	Time    time.Time       `json:"time"`
+	UUID    string          `json:"uuid"`
+	Comment string          `json:"comment"`
+	Data    json.RawMessage `json:"data"`
+	Test    bool            `json:"test,omitempty"`
+}
+
+// Run appends JSON line to journal file and syncs it to disk.
+// It does not depend on network, so run is recorded even when other plugins can't deliver.
+func (d *ExecuteJournal) Run(ctx context.Context) error {
+	meta := runMetaFromContext(ctx)
+	line, err := jsonMarshal(&journalEntry{
+		Time:    timeNow(),
+		UUID:    meta.UUID,
+		Comment: meta.Comment,
+		Data:    d.data,
+		Test:    d.testMode,
+	})
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(d.config.File, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("unable to open journal: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("unable to write journal: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("unable to sync journal: %w", err)
+	}
+	return f.Close()
+}
+
+func (d *ExecuteJournal) Populate(a *state.Action) error {
+	var data map[string]any
+	if err := json.Unmarshal([]byte(a.Data), &data); err != nil {
+		return err
+	}
+	if len(data) == 0 {
+		return fmt.Errorf("data must be provided")
+	}
+	d.data = json.RawMessage(a.Data)
+	return nil
+}
+
+// Validate checks that journal file can be appended to.
+func (c *JournalConfig) Validate() error {
+	if c.File == "" {
+		return fmt.Errorf("config file must be provided")
+	}
+	f, err := os.OpenFile(c.File, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("file must be writable: %w", err)
+	}
+	return f.Close()
+}
+
+func (d *ExecuteJournal) PopulateConfig(e *Execute) error {
+	d.config = e.journalConf
+	return d.config.Validate()
+}
@@ -0,0 +1,114 @@
+package execute
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"dmh/internal/state"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestJournalRun(t *testing.T) {
+	mockTime := time.Date(2025, 3, 26, 14, 55, 40, 0, time.UTC)
+	timeNow = func() time.Time { return mockTime }
+	defer func() { timeNow = time.Now }()
+
+	journalFile := filepath.Join(t.TempDir(), "journal.jsonl")
+	ctx := WithRunMeta(context.Background(), RunMeta{UUID: "uuid", Comment: "comment"})
+
+	plugin := &ExecuteJournal{data: json.RawMessage(`{"message":"first"}`), config: JournalConfig{File: journalFile}}
+	require.Nil(t, plugin.Run(ctx))
+	plugin = &ExecuteJournal{data: json.RawMessage(`{"message":"second"}`), testMode: true, config: JournalConfig{File: journalFile}}
+	require.Nil(t, plugin.Run(context.Background()))
+
+	data, err := os.ReadFile(journalFile)
+	require.Nil(t, err)
+	require.Equal(t, []string{
+		`{"time":"2025-03-26T14:55:40Z","uuid":"uuid","comment":"comment","data":{"message":"first"}}`,
+		`{"time":"2025-03-26T14:55:40Z","uuid":"","comment":"","data":{"message":"second"},"test":true}`,
+	}, strings.Split(strings.TrimSuffix(string(data), "\n"), "\n"))
+
+	info, err := os.Stat(journalFile)
+	require.Nil(t, err)
+	require.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	plugin = &ExecuteJournal{data: json.RawMessage(`{}`), config: JournalConfig{File: filepath.Join(t.TempDir(), "missing", "journal.jsonl")}}
+	require.ErrorContains(t, plugin.Run(ctx), "unable to open journal")
+
+	jsonMarshal = func(any) ([]byte, error) { return nil, fmt.Errorf("marshal error") }
+	defer func() { jsonMarshal = json.Marshal }()
+	plugin = &ExecuteJournal{data: json.RawMessage(`{}`), config: JournalConfig{File: journalFile}}
+	require.EqualError(t, plugin.Run(ctx), "marshal error")
+}
+
+func TestJournalPopulate(t *testing.T) {
+	tests := []struct {
+		inputAction   *state.Action
+		expectedError string
+		expectedData  json.RawMessage
+	}{
+		{
+			inputAction:   &state.Action{Kind: "journal", Data: `{"broken"`},
+			expectedError: "unexpected end of JSON input",
+		},
+		{
+			inputAction:   &state.Action{Kind: "journal", Data: `["not", "object"]`},
+			expectedError: "json: cannot unmarshal array into Go value of type map[string]interface {}",
+		},
+		{
+			inputAction:   &state.Action{Kind: "journal", Data: `{}`},
+			expectedError: "data must be provided",
+		},
+		{
+			inputAction:  &state.Action{Kind: "journal", Data: `{"message": "test", "nested": {"value": 1}}`},
+			expectedData: json.RawMessage(`{"message": "test", "nested": {"value": 1}}`),
+		},
+	}
+	for _, test := range tests {
+		plugin := &ExecuteJournal{}
+		err := plugin.Populate(test.inputAction)
+		if test.expectedError != "" {
+			require.EqualError(t, err, test.expectedError)
+			continue
+		}
+		require.Nil(t, err)
+		require.Equal(t, test.expectedData, plugin.data)
+	}
+}
+
+func TestJournalPopulateConfig(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		inputConfig           JournalConfig
+		expectedErrorContains string
+	}{
+		{
+			expectedErrorContains: "config file must be provided",
+		},
+		{
+			inputConfig:           JournalConfig{File: filepath.Join(dir, "missing", "journal.jsonl")},
+			expectedErrorContains: "file must be writable",
+		},
+		{
+			inputConfig: JournalConfig{File: filepath.Join(dir, "journal.jsonl")},
+		},
+	}
+	for _, test := range tests {
+		plugin := &ExecuteJournal{}
+		err := plugin.PopulateConfig(&Execute{journalConf: test.inputConfig})
+		require.Equal(t, test.inputConfig, plugin.config)
+		if test.expectedErrorContains != "" {
+			require.ErrorContains(t, err, test.expectedErrorContains)
+			continue
+		}
+		require.Nil(t, err)
+		require.FileExists(t, test.inputConfig.File)
+	}
+}
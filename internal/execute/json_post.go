@@ -2,46 +2,86 @@ package execute
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"slices"
+	"strings"
 	"time"
 
 	"dmh/internal/state"
 )
 
+// JSONPostConfig describes config for json_post execute plugin.
+// DenyPrivate refuses URLs resolving to loopback, private or link-local addresses (SSRF guard),
+// Allow lists IP addresses, CIDRs or host names of legit internal webhooks.
+type JSONPostConfig struct {
+	DefaultHeaders map[string]string `koanf:"default_headers"`
+	DenyPrivate    bool              `koanf:"deny_private"`
+	Allow          []string          `koanf:"allow"`
+}
+
+// Validate checks json_post config.
+func (c *JSONPostConfig) Validate() error {
+	return validateAllow(c.Allow)
+}
+
+// jsonPostMethods are HTTP methods allowed in json_post action.
+var jsonPostMethods = []string{http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+
+// ExecuteJSONPost is used by json_post kind and its http alias.
 type ExecuteJSONPost struct {
 	URL         string            `json:"url"`
+	Method      string            `json:"method"` // one of jsonPostMethods, default POST
 	Headers     map[string]string `json:"headers"`
 	Data        map[string]any    `json:"data"`
 	SuccessCode []int             `json:"success_code"`
+	Templated   bool              `json:"templated"` // render URL, header values and strings in Data as Go templates with templateData
+	config      JSONPostConfig
 }
 
-// Run will sent HTTP POST request which application/json encoding.
-func (d *ExecuteJSONPost) Run() error {
-	marshaledData, err := jsonMarshal(d.Data)
+// Run will sent HTTP request (POST by default) which application/json encoding.
+// Templated request is rendered with RunMeta from ctx first.
+func (d *ExecuteJSONPost) Run(ctx context.Context) error {
+	if !d.Templated {
+		return d.send(ctx)
+	}
+	rendered, err := d.render(newTemplateData(runMetaFromContext(ctx)))
 	if err != nil {
 		return err
 	}
-	req, err := http.NewRequest("POST", d.URL, bytes.NewBuffer(marshaledData))
+	return rendered.send(ctx)
+}
+
+// send sends HTTP request, DELETE without data is sent without body.
+func (d *ExecuteJSONPost) send(ctx context.Context) error {
+	var body io.Reader
+	if len(d.Data) > 0 || d.method() != http.MethodDelete {
+		marshaledData, err := jsonMarshal(d.Data)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewBuffer(marshaledData)
+	}
+	req, err := http.NewRequestWithContext(ctx, d.method(), d.URL, body)
 	if err != nil {
 		return err
 	}
 
-	req.Header.Set("Content-Type", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	// Action headers are set last, so they win over config default headers.
+	for k, v := range d.config.DefaultHeaders {
+		req.Header.Set(k, v)
+	}
 	for k, v := range d.Headers {
 		req.Header.Set(k, v)
 	}
 
-	client := &http.Client{
-		Timeout: 30 * time.Second,
-		// dont follow redirects.
-		CheckRedirect: func(req *http.Request, via []*http.Request) error {
-			return http.ErrUseLastResponse
-		},
-	}
-	resp, err := client.Do(req)
+	resp, err := d.config.HTTPClient(d.URL, 30*time.Second).Do(req)
 	if err != nil {
 		return err
 	}
@@ -54,6 +94,47 @@ func (d *ExecuteJSONPost) Run() error {
 	return fmt.Errorf("received wrong status code %d", resp.StatusCode)
 }
 
+// render returns copy of d with URL, header values and strings in Data rendered with data.
+// Strings are rendered one by one, so request body stays valid JSON whatever is rendered.
+func (d *ExecuteJSONPost) render(data templateData) (*ExecuteJSONPost, error) {
+	return d.mapTemplates(func(name string, text string) (string, error) {
+		return renderTemplate(name, text, data)
+	})
+}
+
+// mapTemplates returns copy of d with fn applied to URL, header values and strings in Data.
+func (d *ExecuteJSONPost) mapTemplates(fn func(string, string) (string, error)) (*ExecuteJSONPost, error) {
+	mapped := *d
+	var err error
+	if mapped.URL, err = fn("url", d.URL); err != nil {
+		return nil, err
+	}
+	if d.Headers != nil {
+		mapped.Headers = make(map[string]string, len(d.Headers))
+		for k, v := range d.Headers {
+			if mapped.Headers[k], err = fn("headers."+k, v); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if d.Data != nil {
+		data, err := mapStrings("data", d.Data, fn)
+		if err != nil {
+			return nil, err
+		}
+		mapped.Data = data.(map[string]any)
+	}
+	return &mapped, nil
+}
+
+// method returns HTTP method of request, POST when not provided.
+func (d *ExecuteJSONPost) method() string {
+	if d.Method == "" {
+		return http.MethodPost
+	}
+	return strings.ToUpper(d.Method)
+}
+
 func (d *ExecuteJSONPost) Populate(a *state.Action) error {
 	err := json.Unmarshal([]byte(a.Data), &d)
 	if err != nil {
@@ -65,12 +146,24 @@ func (d *ExecuteJSONPost) Populate(a *state.Action) error {
 	if len(d.SuccessCode) == 0 {
 		return fmt.Errorf("success_code must be provided")
 	}
-	if len(d.Data) == 0 {
+	if !slices.Contains(jsonPostMethods, d.method()) {
+		return fmt.Errorf("method must be one of %s", strings.Join(jsonPostMethods, ", "))
+	}
+	if len(d.Data) == 0 && d.method() != http.MethodDelete {
 		return fmt.Errorf("data must be provided")
 	}
+	if d.Templated {
+		_, err := d.mapTemplates(func(name string, text string) (string, error) {
+			_, err := parseTemplate(name, text)
+			return text, err
+		})
+		return err
+	}
 	return nil
 }
 
+// PopulateConfig rejects URL pointing to private address when deny_private is enabled.
 func (d *ExecuteJSONPost) PopulateConfig(e *Execute) error {
-	return nil
+	d.config = e.jsonPostConf
+	return d.config.checkURL(context.Background(), d.URL)
 }
@@ -1,14 +1,19 @@
 package execute
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/netip"
 	"testing"
+	"time"
 
 	"dmh/internal/state"
+	"dmh/internal/useragent"
 
 	"github.com/stretchr/testify/require"
 )
@@ -96,6 +101,69 @@ func TestJsonPostRun(t *testing.T) {
 				return s
 			},
 		},
+		{
+			inputPlugin: func(url string) *ExecuteJSONPost {
+				return &ExecuteJSONPost{
+					URL:         url,
+					Data:        map[string]any{"test": "test"},
+					Headers:     map[string]string{"x-override": "action"},
+					SuccessCode: []int{http.StatusOK},
+					config: JSONPostConfig{
+						DefaultHeaders: map[string]string{"Authorization": "Bearer token", "X-Override": "config"},
+					},
+				}
+			},
+			fakeHTTPServer: func() *httptest.Server {
+				s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					require.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+					require.Equal(t, useragent.Default(), r.Header.Get("User-Agent"))
+					require.Equal(t, []string{"action"}, r.Header.Values("X-Override"))
+					w.WriteHeader(http.StatusOK)
+				}))
+				return s
+			},
+		},
+		{
+			inputPlugin: func(url string) *ExecuteJSONPost {
+				return &ExecuteJSONPost{
+					URL:         url,
+					Method:      "patch",
+					Data:        map[string]any{"status": "resolved"},
+					SuccessCode: []int{http.StatusOK},
+				}
+			},
+			fakeHTTPServer: func() *httptest.Server {
+				s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					require.Equal(t, http.MethodPatch, r.Method)
+					require.Equal(t, "application/json", r.Header.Get("Content-Type"))
+					body, err := io.ReadAll(r.Body)
+					require.Nil(t, err)
+					require.Equal(t, `{"status":"resolved"}`, string(body))
+					w.WriteHeader(http.StatusOK)
+				}))
+				return s
+			},
+		},
+		{
+			inputPlugin: func(url string) *ExecuteJSONPost {
+				return &ExecuteJSONPost{
+					URL:         url,
+					Method:      http.MethodDelete,
+					SuccessCode: []int{http.StatusNoContent},
+				}
+			},
+			fakeHTTPServer: func() *httptest.Server {
+				s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					require.Equal(t, http.MethodDelete, r.Method)
+					require.Equal(t, "", r.Header.Get("Content-Type"))
+					body, err := io.ReadAll(r.Body)
+					require.Nil(t, err)
+					require.Empty(t, body)
+					w.WriteHeader(http.StatusNoContent)
+				}))
+				return s
+			},
+		},
 		{
 			inputPlugin: func(url string) *ExecuteJSONPost {
 				return &ExecuteJSONPost{
@@ -133,7 +201,7 @@ func TestJsonPostRun(t *testing.T) {
 
 		}
 		plugin := test.inputPlugin(fakeURL)
-		err := plugin.Run()
+		err := plugin.Run(context.Background())
 		if test.expectedError {
 			require.NotNil(t, err)
 		} else {
@@ -142,6 +210,102 @@ func TestJsonPostRun(t *testing.T) {
 	}
 }
 
+func TestJsonPostRunCancelled(t *testing.T) {
+	release := make(chan struct{})
+	fakeServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer fakeServer.Close()
+	defer close(release)
+
+	plugin := &ExecuteJSONPost{
+		URL:         fakeServer.URL,
+		Data:        map[string]any{"test": "test"},
+		SuccessCode: []int{http.StatusOK},
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := plugin.Run(ctx)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestJsonPostRunTemplated(t *testing.T) {
+	mockTime, err := time.Parse(time.RFC3339, "2025-03-26T14:55:40Z")
+	require.Nil(t, err)
+	timeNow = func() time.Time { return mockTime }
+	defer func() { timeNow = time.Now }()
+
+	ctx := WithRunMeta(context.Background(), RunMeta{UUID: "test-uuid", Comment: `say "bye"`, LastSeen: mockTime.Add(-26 * time.Hour)})
+	tests := []struct {
+		inputPlugin         *ExecuteJSONPost
+		expectedPath        string
+		expectedHeader      string
+		expectedBody        string
+		expectedErrorString string
+	}{
+		{
+			inputPlugin: &ExecuteJSONPost{
+				URL:     "/fired/{{ .UUID }}",
+				Headers: map[string]string{"X-Fired": "{{ .Now.Format \"2006-01-02\" }}"},
+				Data: map[string]any{
+					"message": "fired at {{ .Now.Format \"15:04\" }} after {{ .SilentFor }} of silence",
+					"comment": "{{ .Comment }}",
+					"tags":    []any{"{{ .UUID }}", 1.0, true},
+				},
+				Templated: true,
+			},
+			expectedPath:   "/fired/test-uuid",
+			expectedHeader: "2025-03-26",
+			expectedBody:   `{"message":"fired at 14:55 after 26h0m0s of silence","comment":"say \"bye\"","tags":["test-uuid",1,true]}`,
+		},
+		{
+			inputPlugin: &ExecuteJSONPost{
+				URL:     "/literal",
+				Headers: map[string]string{"X-Fired": "{{ .Now }}"},
+				Data:    map[string]any{"message": "{{ .UUID }} {not a template}"},
+			},
+			expectedPath:   "/literal",
+			expectedHeader: "{{ .Now }}",
+			expectedBody:   `{"message":"{{ .UUID }} {not a template}"}`,
+		},
+		{
+			inputPlugin: &ExecuteJSONPost{
+				URL:       "/missing",
+				Data:      map[string]any{"message": "{{ .Missing }}"},
+				Templated: true,
+			},
+			expectedErrorString: "unable to render data.message",
+		},
+	}
+	for _, test := range tests {
+		var path, header, body string
+		fakeServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			path = r.URL.Path
+			header = r.Header.Get("X-Fired")
+			b, err := io.ReadAll(r.Body)
+			require.Nil(t, err)
+			body = string(b)
+		}))
+		defer fakeServer.Close()
+
+		plugin := test.inputPlugin
+		plugin.URL = fakeServer.URL + plugin.URL
+		plugin.SuccessCode = []int{http.StatusOK}
+		err := plugin.Run(ctx)
+		if test.expectedErrorString != "" {
+			require.ErrorContains(t, err, test.expectedErrorString)
+			continue
+		}
+		require.Nil(t, err)
+		require.Equal(t, test.expectedPath, path)
+		require.Equal(t, test.expectedHeader, header)
+		require.JSONEq(t, test.expectedBody, body)
+	}
+}
+
 func TestJsonPostPopulate(t *testing.T) {
 	tests := []struct {
 		inputPlugin   *ExecuteJSONPost
@@ -172,6 +336,42 @@ func TestJsonPostPopulate(t *testing.T) {
 			inputPlugin: &ExecuteJSONPost{},
 			inputAction: &state.Action{Kind: "json_post", Data: `{"url": "test", "success_code":[200], "data": {"test": "test"}}`},
 		},
+		{
+			inputPlugin:   &ExecuteJSONPost{},
+			inputAction:   &state.Action{Kind: "json_post", Data: `{"url": "test", "success_code":[200], "data": {"test": "test"}, "method": "GET"}`},
+			expectedError: "method must be one of POST, PUT, PATCH, DELETE",
+		},
+		{
+			inputPlugin:   &ExecuteJSONPost{},
+			inputAction:   &state.Action{Kind: "http", Data: `{"url": "test", "success_code":[200], "data": {}, "method": "PATCH"}`},
+			expectedError: "data must be provided",
+		},
+		{
+			inputPlugin: &ExecuteJSONPost{},
+			inputAction: &state.Action{Kind: "http", Data: `{"url": "test", "success_code":[200], "data": {"test": "test"}, "method": "patch"}`},
+		},
+		{
+			inputPlugin: &ExecuteJSONPost{},
+			inputAction: &state.Action{Kind: "http", Data: `{"url": "test", "success_code":[204], "method": "DELETE"}`},
+		},
+		{
+			inputPlugin: &ExecuteJSONPost{},
+			inputAction: &state.Action{Kind: "json_post", Data: `{"url": "test", "success_code":[200], "data": {"test": "{{ .Now"}}`},
+		},
+		{
+			inputPlugin:   &ExecuteJSONPost{},
+			inputAction:   &state.Action{Kind: "json_post", Data: `{"url": "test", "success_code":[200], "data": {"test": ["ok", {"nested": "{{ .Now"}]}, "templated": true}`},
+			expectedError: "invalid data.test[1].nested template: template: data.test[1].nested:1: unclosed action",
+		},
+		{
+			inputPlugin:   &ExecuteJSONPost{},
+			inputAction:   &state.Action{Kind: "json_post", Data: `{"url": "test/{{ end }}", "success_code":[200], "data": {"test": "test"}, "templated": true}`},
+			expectedError: "invalid url template: template: url:1: unexpected {{end}}",
+		},
+		{
+			inputPlugin: &ExecuteJSONPost{},
+			inputAction: &state.Action{Kind: "json_post", Data: `{"url": "test/{{ .UUID }}", "headers": {"X-Fired": "{{ .Now }}"}, "success_code":[200], "data": {"test": "{{ .SilentFor }}", "count": 1}, "templated": true}`},
+		},
 	}
 	for _, test := range tests {
 		plugin := test.inputPlugin
@@ -189,4 +389,72 @@ func TestJsonPostPopulateConfig(t *testing.T) {
 	plugin := &ExecuteJSONPost{}
 	err := plugin.PopulateConfig(&Execute{})
 	require.Nil(t, err)
+	require.Equal(t, JSONPostConfig{}, plugin.config)
+
+	config := JSONPostConfig{DefaultHeaders: map[string]string{"Authorization": "Bearer token"}}
+	err = plugin.PopulateConfig(&Execute{jsonPostConf: config})
+	require.Nil(t, err)
+	require.Equal(t, config, plugin.config)
+}
+
+func TestJsonPostPopulateConfigDenyPrivate(t *testing.T) {
+	defer func() { lookupNetIP = net.DefaultResolver.LookupNetIP }()
+	lookupNetIP = func(ctx context.Context, network string, host string) ([]netip.Addr, error) {
+		switch host {
+		case "public.example.com":
+			return []netip.Addr{netip.MustParseAddr("93.184.216.34")}, nil
+		case "mixed.example.com":
+			return []netip.Addr{netip.MustParseAddr("93.184.216.34"), netip.MustParseAddr("10.0.0.5")}, nil
+		}
+		return nil, fmt.Errorf("no such host")
+	}
+	config := JSONPostConfig{DenyPrivate: true, Allow: []string{"hooks.lan", "192.168.1.0/24", "127.0.0.2"}}
+	tests := []struct {
+		inputURL      string
+		inputConfig   JSONPostConfig
+		expectedError string
+	}{
+		{inputURL: "http://169.254.169.254/latest/meta-data", inputConfig: JSONPostConfig{}},
+		{inputURL: "http://public.example.com/hook", inputConfig: config},
+		{inputURL: "http://hooks.lan/hook", inputConfig: config},
+		{inputURL: "http://192.168.1.10:8080/hook", inputConfig: config},
+		{inputURL: "http://127.0.0.2/hook", inputConfig: config},
+		{inputURL: "http://169.254.169.254/latest/meta-data", inputConfig: config, expectedError: "private address is not allowed: 169.254.169.254"},
+		{inputURL: "http://127.0.0.1/hook", inputConfig: config, expectedError: "private address is not allowed: 127.0.0.1"},
+		{inputURL: "http://[::1]/hook", inputConfig: config, expectedError: "private address is not allowed: ::1"},
+		{inputURL: "http://[::ffff:10.0.0.1]/hook", inputConfig: config, expectedError: "private address is not allowed: 10.0.0.1"},
+		{inputURL: "http://0.0.0.0/hook", inputConfig: config, expectedError: "private address is not allowed: 0.0.0.0"},
+		{inputURL: "http://mixed.example.com/hook", inputConfig: config, expectedError: "mixed.example.com private address is not allowed: 10.0.0.5"},
+		{inputURL: "http://unknown.example.com/hook", inputConfig: config, expectedError: "unable to resolve unknown.example.com: no such host"},
+		{inputURL: "/hook", inputConfig: config, expectedError: "url must contain host"},
+	}
+	for _, test := range tests {
+		plugin := &ExecuteJSONPost{URL: test.inputURL}
+		err := plugin.PopulateConfig(&Execute{jsonPostConf: test.inputConfig})
+		if test.expectedError == "" {
+			require.Nil(t, err, test.inputURL)
+			continue
+		}
+		require.EqualError(t, err, test.expectedError, test.inputURL)
+	}
+}
+
+func TestJsonPostRunDenyPrivate(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	plugin := &ExecuteJSONPost{URL: server.URL, Data: map[string]any{"test": true}, SuccessCode: []int{http.StatusOK}, config: JSONPostConfig{DenyPrivate: true}}
+	require.ErrorIs(t, plugin.Run(context.Background()), ErrPrivateAddress)
+
+	plugin.config.Allow = []string{"127.0.0.0/8"}
+	require.Nil(t, plugin.Run(context.Background()))
+}
+
+func TestJSONPostConfigValidate(t *testing.T) {
+	require.Nil(t, (&JSONPostConfig{Allow: []string{"hooks.lan", "10.0.0.0/8", "192.168.1.10", "fd00::/8", "::1"}}).Validate())
+	require.EqualError(t, (&JSONPostConfig{Allow: []string{"10.0.0.0/33"}}).Validate(), `allow "10.0.0.0/33" must be IP address, CIDR or host name`)
+	require.EqualError(t, (&JSONPostConfig{Allow: []string{""}}).Validate(), `allow "" must be IP address, CIDR or host name`)
+	require.EqualError(t, (&JSONPostConfig{Allow: []string{"hooks.lan:8080"}}).Validate(), `allow "hooks.lan:8080" must be IP address, CIDR or host name`)
 }
@@ -1,10 +1,14 @@
 package execute
 
 import (
+	"bytes"
 	"context"
 	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
+	htmltemplate "html/template"
+	"io"
 	"net/mail"
 	"slices"
 	"time"
@@ -22,6 +26,7 @@ type MailConfig struct {
 	Password    string `koanf:"password"`
 	Server      string `koanf:"server"`
 	From        string `koanf:"from"`
+	FromName    string `koanf:"from_name"`
 	TLSPolicy   string `koanf:"tls_policy"`
 	TLSInsecure bool   `koanf:"tls_insecure"`
 }
@@ -30,13 +35,49 @@ type ExecuteMail struct {
 	Message     string   `json:"message"`
 	Destination []string `json:"destination"`
 	Subject     string   `json:"subject"`
+	ReplyTo     string   `json:"reply_to"`
+	From        string   `json:"from"`      // overrides From (and FromName) of MailConfig, e.g. "Alice <alice@example.com>"
+	HTML        bool     `json:"html"`      // send Message as text/html
+	Templated   bool     `json:"templated"` // render Subject and Message as Go templates with templateData
 	config      MailConfig
 }
 
 // Run will sent email over SMTP.
-func (d *ExecuteMail) Run() error {
+func (d *ExecuteMail) Run(ctx context.Context) error {
+	client, err := d.config.client()
+	if err != nil {
+		return err
+	}
+
+	message, err := d.message(ctx)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, mailTimeout)
+	defer cancel()
+
+	if err := client.DialAndSendWithContext(ctx, message); err != nil {
+		return classifySMTPError(err)
+	}
+
+	return nil
+}
+
+// classifySMTPError wraps temporary (4xx) SMTP errors, e.g. greylisting, with ErrTemporary.
+// Permanent (5xx) and connection errors are returned unchanged.
+func classifySMTPError(err error) error {
+	var sendErr *gomail.SendError
+	if errors.As(err, &sendErr) && sendErr.IsTemp() {
+		return fmt.Errorf("%w: %w", ErrTemporary, err)
+	}
+	return err
+}
+
+// client returns SMTP client configured from MailConfig.
+func (c *MailConfig) client() (*gomail.Client, error) {
 	var tlsPolicy gomail.Option
-	switch d.config.TLSPolicy {
+	switch c.TLSPolicy {
 	case "tls_mandatory":
 		tlsPolicy = gomail.WithTLSPortPolicy(gomail.TLSMandatory)
 	case "tls_opportunistic":
@@ -48,41 +89,124 @@ func (d *ExecuteMail) Run() error {
 	var client *gomail.Client
 	var err error
 
-	if d.config.Username != "" {
-		client, err = gomail.NewClient(d.config.Server, tlsPolicy, gomail.WithSMTPAuth(gomail.SMTPAuthPlain), gomail.WithUsername(d.config.Username), gomail.WithPassword(d.config.Password), gomail.WithTimeout(mailTimeout))
+	if c.Username != "" {
+		client, err = gomail.NewClient(c.Server, tlsPolicy, gomail.WithSMTPAuth(gomail.SMTPAuthPlain), gomail.WithUsername(c.Username), gomail.WithPassword(c.Password), gomail.WithTimeout(mailTimeout))
 	} else {
-		client, err = gomail.NewClient(d.config.Server, tlsPolicy, gomail.WithTimeout(mailTimeout))
+		client, err = gomail.NewClient(c.Server, tlsPolicy, gomail.WithTimeout(mailTimeout))
 	}
 
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	if d.config.TLSInsecure {
+	if c.TLSInsecure {
 		client.SetTLSConfig(&tls.Config{
 			InsecureSkipVerify: true,
 		})
 	}
+	return client, nil
+}
 
-	message := gomail.NewMsg()
-	if err := message.From(d.config.From); err != nil {
+// probe connects to SMTP server, it sends EHLO, STARTTLS and AUTH (when configured) like Run does, but no message.
+func (c *MailConfig) probe(ctx context.Context) error {
+	client, err := c.client()
+	if err != nil {
 		return err
 	}
-	if err := message.To(d.Destination...); err != nil {
+	ctx, cancel := context.WithTimeout(ctx, mailTimeout)
+	defer cancel()
+	if err := client.DialWithContext(ctx); err != nil {
 		return err
 	}
+	return client.Close()
+}
 
-	message.Subject(d.Subject)
-	message.SetBodyString(gomail.TypeTextPlain, d.Message)
+// message builds mail message with From (optionally with display name), Reply-To, To, Subject and body.
+// From of action wins over MailConfig, SMTP account is the same for both.
+// Templated Subject and Message are rendered with RunMeta from ctx.
+func (d *ExecuteMail) message(ctx context.Context) (*gomail.Msg, error) {
+	subject, body := d.Subject, d.Message
+	if d.Templated {
+		var err error
+		if subject, body, err = d.render(runMetaFromContext(ctx)); err != nil {
+			return nil, err
+		}
+	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), mailTimeout)
-	defer cancel()
+	message := gomail.NewMsg()
+	if d.From != "" {
+		if err := message.From(d.From); err != nil {
+			return nil, err
+		}
+	} else if d.config.FromName != "" {
+		if err := message.FromFormat(d.config.FromName, d.config.From); err != nil {
+			return nil, err
+		}
+	} else {
+		if err := message.From(d.config.From); err != nil {
+			return nil, err
+		}
+	}
+	if d.ReplyTo != "" {
+		if err := message.ReplyTo(d.ReplyTo); err != nil {
+			return nil, err
+		}
+	}
+	if err := message.To(d.Destination...); err != nil {
+		return nil, err
+	}
 
-	if err := client.DialAndSendWithContext(ctx, message); err != nil {
-		return err
+	message.Subject(subject)
+	if d.HTML {
+		message.SetBodyString(gomail.TypeTextHTML, body)
+	} else {
+		message.SetBodyString(gomail.TypeTextPlain, body)
 	}
+	return message, nil
+}
 
-	return nil
+// render executes Subject and Message templates.
+// HTML Message is rendered with html/template, so values are escaped.
+func (d *ExecuteMail) render(meta RunMeta) (string, string, error) {
+	data := newTemplateData(meta)
+	subjectTemplate, messageTemplate, err := d.parseTemplates()
+	if err != nil {
+		return "", "", err
+	}
+	subject := &bytes.Buffer{}
+	if err := subjectTemplate.Execute(subject, data); err != nil {
+		return "", "", fmt.Errorf("unable to render subject: %w", err)
+	}
+	message := &bytes.Buffer{}
+	if err := messageTemplate.Execute(message, data); err != nil {
+		return "", "", fmt.Errorf("unable to render message: %w", err)
+	}
+	return subject.String(), message.String(), nil
+}
+
+// templateExecutor is implemented by text/template and html/template.
+type templateExecutor interface {
+	Execute(wr io.Writer, data any) error
+}
+
+// parseTemplates parses Subject and Message templates.
+func (d *ExecuteMail) parseTemplates() (templateExecutor, templateExecutor, error) {
+	subject, err := parseTemplate("subject", d.Subject)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !d.HTML {
+		message, err := parseTemplate("message", d.Message)
+		if err != nil {
+			return nil, nil, err
+		}
+		return subject, message, nil
+	}
+	message, err := htmltemplate.New("message").Option("missingkey=error").Parse(d.Message)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid message template: %w", err)
+	}
+	return subject, message, nil
 }
 
 func (d *ExecuteMail) Populate(a *state.Action) error {
@@ -106,6 +230,24 @@ func (d *ExecuteMail) Populate(a *state.Action) error {
 		}
 	}
 
+	if d.ReplyTo != "" {
+		if _, err := mail.ParseAddress(d.ReplyTo); err != nil {
+			return fmt.Errorf("reply_to must be a valid address %s", err)
+		}
+	}
+
+	if d.From != "" {
+		if _, err := mail.ParseAddress(d.From); err != nil {
+			return fmt.Errorf("from must be a valid address %s", err)
+		}
+	}
+
+	if d.Templated {
+		if _, _, err := d.parseTemplates(); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -2,25 +2,31 @@ package execute
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"io"
+	"net"
 	"os"
 	"os/exec"
 	"regexp"
 	"strings"
 	"testing"
+	"time"
 
 	"dmh/internal/state"
 
 	"github.com/emersion/go-sasl"
 	"github.com/emersion/go-smtp"
 	"github.com/stretchr/testify/require"
+	gomail "github.com/wneessen/go-mail"
 )
 
 type mockSMTPHandler struct {
 	authShouldFail bool
 	fromShouldFail bool
+	rcptErrorCode  int // Rcpt fails with this SMTP code when set
 	sessions       []*mockSMTPSession
 }
 
@@ -57,6 +63,12 @@ func (s *mockSMTPSession) Mail(from string, opts *smtp.MailOptions) error {
 }
 
 func (s *mockSMTPSession) Rcpt(to string, opts *smtp.RcptOptions) error {
+	if s.handler.rcptErrorCode != 0 {
+		return &smtp.SMTPError{
+			Code:    s.handler.rcptErrorCode,
+			Message: "mockSMTPSessionRcpt error",
+		}
+	}
 	s.to = append(s.to, to)
 	return nil
 }
@@ -264,6 +276,25 @@ func TestMailRun(t *testing.T) {
 			inputSMTPServerWithTLS: false,
 			inputMockSMTPHandler:   newSMTPHandler(false, false),
 		},
+		{
+			inputPlugin: &ExecuteMail{
+				config: MailConfig{
+					Username:    "test",
+					Password:    "test",
+					Server:      "localhost",
+					TLSPolicy:   "tls_mandatory",
+					TLSInsecure: true,
+					From:        "test@test.com",
+					FromName:    "Dead Man",
+				},
+				Message:     "Test",
+				Subject:     "test subject",
+				Destination: []string{"test1@test.com"},
+				ReplyTo:     "reply@test.com",
+			},
+			inputSMTPServerWithTLS: true,
+			inputMockSMTPHandler:   newSMTPHandler(false, false),
+		},
 	}
 	generateCerts := exec.Command("sh", "-c", `openssl req -x509 -newkey rsa:2048 -nodes -keyout key.pem -out cert.pem -days 365 -subj "/C=US/ST=State/L=Locality/O=Organization/CN=localhost"`)
 	err := generateCerts.Run()
@@ -303,7 +334,7 @@ func TestMailRun(t *testing.T) {
 		}
 
 		plugin := test.inputPlugin
-		err = plugin.Run()
+		err = plugin.Run(context.Background())
 
 		if test.expectedError {
 			require.NotNil(t, err)
@@ -323,7 +354,11 @@ func TestMailRun(t *testing.T) {
 			for _, destination := range test.inputPlugin.Destination {
 				destinationFormatted = append(destinationFormatted, fmt.Sprintf("<%s>", destination))
 			}
-			bodyRegex := regexp.MustCompile(fmt.Sprintf(`Subject: %s(?s).*From: <%s>(?s).*To: %s(?s).*%s`, test.inputPlugin.Subject, test.inputPlugin.config.From, strings.Join(destinationFormatted, ", "), test.inputPlugin.Message))
+			fromFormatted := fmt.Sprintf("<%s>", test.inputPlugin.config.From)
+			if test.inputPlugin.config.FromName != "" {
+				fromFormatted = fmt.Sprintf(`"%s" %s`, test.inputPlugin.config.FromName, fromFormatted)
+			}
+			bodyRegex := regexp.MustCompile(fmt.Sprintf(`Subject: %s(?s).*From: %s(?s).*To: %s(?s).*%s`, test.inputPlugin.Subject, fromFormatted, strings.Join(destinationFormatted, ", "), test.inputPlugin.Message))
 			require.True(t, bodyRegex.MatchString(smtpHandler.sessions[sessionIdx].body))
 			err = smtpServer.Close()
 			require.Nil(t, err)
@@ -331,6 +366,207 @@ func TestMailRun(t *testing.T) {
 	}
 }
 
+func TestMailRunSMTPErrorCode(t *testing.T) {
+	tests := []struct {
+		inputCode         int
+		expectedTemporary bool
+	}{
+		{inputCode: 451, expectedTemporary: true},
+		{inputCode: 450, expectedTemporary: true},
+		{inputCode: 550},
+		{inputCode: 554},
+	}
+	for _, test := range tests {
+		// listener is ready before client dials
+		l, err := net.Listen("tcp", "127.0.0.1:25")
+		require.Nil(t, err)
+		smtpServer := smtp.NewServer(&mockSMTPHandler{rcptErrorCode: test.inputCode})
+		smtpServer.Domain = "localhost"
+		smtpServer.AllowInsecureAuth = true
+		go smtpServer.Serve(l)
+
+		plugin := &ExecuteMail{
+			config:      MailConfig{Server: "127.0.0.1", TLSPolicy: "no_tls", From: "test@test.com"},
+			Message:     "Test",
+			Subject:     "test subject",
+			Destination: []string{"test1@test.com"},
+		}
+		err = plugin.Run(context.Background())
+		smtpServer.Close()
+
+		require.ErrorContains(t, err, fmt.Sprint(test.inputCode), "code %d", test.inputCode)
+		require.Equal(t, test.expectedTemporary, errors.Is(err, ErrTemporary), "code %d", test.inputCode)
+	}
+}
+
+func TestClassifySMTPError(t *testing.T) {
+	err := fmt.Errorf("dial failed")
+	require.Equal(t, err, classifySMTPError(err))
+	sendErr := &gomail.SendError{Reason: gomail.ErrSMTPRcptTo}
+	require.NotErrorIs(t, classifySMTPError(sendErr), ErrTemporary)
+}
+
+func TestMailMessage(t *testing.T) {
+	tests := []struct {
+		inputPlugin         *ExecuteMail
+		expectedHeaders     []string
+		notExpectedHeaders  []string
+		expectedErrorString string
+	}{
+		{
+			inputPlugin: &ExecuteMail{
+				config:      MailConfig{From: "test@test.com"},
+				Message:     "Test",
+				Subject:     "test subject",
+				Destination: []string{"test1@test.com"},
+			},
+			expectedHeaders:    []string{"From: <test@test.com>", "To: <test1@test.com>", "Subject: test subject"},
+			notExpectedHeaders: []string{"Reply-To:"},
+		},
+		{
+			inputPlugin: &ExecuteMail{
+				config:      MailConfig{From: "test@test.com", FromName: "Dead Man"},
+				Message:     "Test",
+				Subject:     "test subject",
+				Destination: []string{"test1@test.com"},
+				ReplyTo:     "reply@test.com",
+			},
+			expectedHeaders: []string{`From: "Dead Man" <test@test.com>`, "Reply-To: <reply@test.com>", "To: <test1@test.com>"},
+		},
+		{
+			inputPlugin: &ExecuteMail{
+				config:      MailConfig{From: "test@test.com", FromName: "Dead Man"},
+				Message:     "Test",
+				Subject:     "test subject",
+				Destination: []string{"test1@test.com"},
+				From:        "Alice <alice@test.com>",
+			},
+			expectedHeaders:    []string{`From: "Alice" <alice@test.com>`, "To: <test1@test.com>"},
+			notExpectedHeaders: []string{"Dead Man", "<test@test.com>"},
+		},
+		{
+			inputPlugin: &ExecuteMail{
+				config:      MailConfig{From: "test@test.com", FromName: "Dead Man"},
+				Message:     "Test",
+				Subject:     "test subject",
+				Destination: []string{"test1@test.com"},
+				From:        "personal@test.com",
+			},
+			expectedHeaders:    []string{"From: <personal@test.com>"},
+			notExpectedHeaders: []string{"Dead Man"},
+		},
+		{
+			inputPlugin: &ExecuteMail{
+				config:      MailConfig{From: "test"},
+				Destination: []string{"test1@test.com"},
+			},
+			expectedErrorString: `failed to parse mail address "test"`,
+		},
+		{
+			inputPlugin: &ExecuteMail{
+				config:      MailConfig{From: "test@test.com"},
+				Destination: []string{"test1@test.com"},
+				ReplyTo:     "reply",
+			},
+			expectedErrorString: `failed to parse mail address "reply"`,
+		},
+	}
+	for _, test := range tests {
+		message, err := test.inputPlugin.message(context.Background())
+		if test.expectedErrorString != "" {
+			require.ErrorContains(t, err, test.expectedErrorString)
+			continue
+		}
+		require.Nil(t, err)
+		buf := new(bytes.Buffer)
+		_, err = message.WriteTo(buf)
+		require.Nil(t, err)
+		for _, header := range test.expectedHeaders {
+			require.Contains(t, buf.String(), header)
+		}
+		for _, header := range test.notExpectedHeaders {
+			require.NotContains(t, buf.String(), header)
+		}
+	}
+}
+
+func TestMailMessageTemplated(t *testing.T) {
+	mockTime, err := time.Parse(time.RFC3339, "2025-03-26T14:55:40Z")
+	require.Nil(t, err)
+	timeNow = func() time.Time { return mockTime }
+	defer func() { timeNow = time.Now }()
+
+	ctx := WithRunMeta(context.Background(), RunMeta{UUID: "test-uuid", Comment: "<b>comment</b>", LastSeen: mockTime.Add(-26 * time.Hour)})
+	tests := []struct {
+		inputPlugin         *ExecuteMail
+		inputCtx            context.Context
+		expectedContains    []string
+		expectedErrorString string
+	}{
+		{
+			inputPlugin: &ExecuteMail{
+				Subject:   "DMH fired {{ .Now.Format \"2006-01-02\" }} after {{ .SilentFor }}",
+				Message:   "action {{ .UUID }} ({{ .Comment }}), last seen {{ .LastSeen.Format \"2006-01-02 15:04\" }}",
+				Templated: true,
+			},
+			inputCtx:         ctx,
+			expectedContains: []string{"Subject: DMH fired 2025-03-26 after 26h0m0s", "action test-uuid (<b>comment</b>), last seen 2025-03-25 12:55"},
+		},
+		{
+			inputPlugin: &ExecuteMail{
+				Subject:   "{{ .Comment }}",
+				Message:   "<p>{{ .Comment }}</p>",
+				HTML:      true,
+				Templated: true,
+			},
+			inputCtx:         ctx,
+			expectedContains: []string{"Subject: <b>comment</b>", "Content-Type: text/html", "<p>&lt;b&gt;comment&lt;/b&gt;</p>"},
+		},
+		{
+			inputPlugin: &ExecuteMail{
+				Subject: "literal {{ .Now }}",
+				Message: "literal {{ .UUID }}",
+			},
+			inputCtx:         ctx,
+			expectedContains: []string{"Subject: literal {{ .Now }}", "literal {{ .UUID }}"},
+		},
+		{
+			inputPlugin: &ExecuteMail{
+				Subject:   "test",
+				Message:   "silent for {{ .SilentFor }}, uuid [{{ .UUID }}]",
+				Templated: true,
+			},
+			inputCtx:         context.Background(),
+			expectedContains: []string{"silent for 0s, uuid []"},
+		},
+		{
+			inputPlugin: &ExecuteMail{
+				Subject:   "test",
+				Message:   "{{ .Missing }}",
+				Templated: true,
+			},
+			inputCtx:            ctx,
+			expectedErrorString: "unable to render message",
+		},
+	}
+	for _, test := range tests {
+		test.inputPlugin.config = MailConfig{From: "test@test.com"}
+		test.inputPlugin.Destination = []string{"test1@test.com"}
+		message, err := test.inputPlugin.message(test.inputCtx)
+		if test.expectedErrorString != "" {
+			require.ErrorContains(t, err, test.expectedErrorString)
+			continue
+		}
+		require.Nil(t, err)
+		buf := new(bytes.Buffer)
+		_, err = message.WriteTo(buf)
+		require.Nil(t, err)
+		for _, expected := range test.expectedContains {
+			require.Contains(t, buf.String(), expected)
+		}
+	}
+}
+
 func TestMailPopulate(t *testing.T) {
 	tests := []struct {
 		inputPlugin   *ExecuteMail
@@ -366,6 +602,38 @@ func TestMailPopulate(t *testing.T) {
 			inputPlugin: &ExecuteMail{},
 			inputAction: &state.Action{Kind: "mail", Data: `{"message": "test", "subject": "test2", "destination": ["test@test.com", "second@test.com.pl"]}`},
 		},
+		{
+			inputPlugin:   &ExecuteMail{},
+			inputAction:   &state.Action{Kind: "mail", Data: `{"message": "test", "subject": "test2", "destination": ["test@test.com"], "reply_to": "reply"}`},
+			expectedError: "reply_to must be a valid address mail: missing '@' or angle-addr",
+		},
+		{
+			inputPlugin: &ExecuteMail{},
+			inputAction: &state.Action{Kind: "mail", Data: `{"message": "test", "subject": "test2", "destination": ["test@test.com"], "reply_to": "reply@test.com"}`},
+		},
+		{
+			inputPlugin:   &ExecuteMail{},
+			inputAction:   &state.Action{Kind: "mail", Data: `{"message": "test", "subject": "test2", "destination": ["test@test.com"], "from": "personal"}`},
+			expectedError: "from must be a valid address mail: missing '@' or angle-addr",
+		},
+		{
+			inputPlugin: &ExecuteMail{},
+			inputAction: &state.Action{Kind: "mail", Data: `{"message": "test", "subject": "test2", "destination": ["test@test.com"], "from": "Alice <alice@test.com>"}`},
+		},
+		{
+			inputPlugin:   &ExecuteMail{},
+			inputAction:   &state.Action{Kind: "mail", Data: `{"message": "test", "subject": "{{ .Now", "destination": ["test@test.com"], "templated": true}`},
+			expectedError: "invalid subject template: template: subject:1: unclosed action",
+		},
+		{
+			inputPlugin:   &ExecuteMail{},
+			inputAction:   &state.Action{Kind: "mail", Data: `{"message": "{{ end }}", "subject": "test", "destination": ["test@test.com"], "templated": true, "html": true}`},
+			expectedError: "invalid message template: template: message:1: unexpected {{end}}",
+		},
+		{
+			inputPlugin: &ExecuteMail{},
+			inputAction: &state.Action{Kind: "mail", Data: `{"message": "{{ end }}", "subject": "{{ .Now", "destination": ["test@test.com"]}`},
+		},
 	}
 	for _, test := range tests {
 		plugin := test.inputPlugin
@@ -3,6 +3,15 @@ package execute
 type Options struct {
 	BulkSMSConf     BulkSMSConfig
 	MailConf        MailConfig
+	JSONPostConf    JSONPostConfig
+	JournalConf     JournalConfig
+	FileWriteConf   FileWriteConfig
 	SignedURLSecret string
 	SignedURLTTL    int
+	TestMode        TestModeConfig
+	// AllowedKinds are action kinds which can be added and run, every built-in kind is allowed when empty.
+	AllowedKinds []string
+	// Mode is ModeLocal (default) or ModeQueue.
+	Mode      string
+	QueueConf QueueConfig
 }
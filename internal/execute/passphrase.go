@@ -0,0 +1,101 @@
+package execute
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"dmh/internal/crypt"
+	"dmh/internal/state"
+)
+
+// minPassphraseLength is minimal length of recipient passphrase.
+const minPassphraseLength = 8
+
+// passphraseFields maps action kind to its data field delivered to recipient.
+// Only these kinds can be protected with recipient passphrase.
+var passphraseFields = map[string]string{
+	"mail":       "message",
+	"bulksms":    "message",
+	"file_write": "content",
+	"dummy":      "message",
+}
+
+var (
+	// mocks for tests
+	encryptPassphrase = crypt.EncryptPassphrase
+)
+
+// ValidatePassphrase checks that Action (and its fallback) can be protected with recipient passphrase.
+func ValidatePassphrase(a *state.Action, passphrase string) error {
+	if len(passphrase) < minPassphraseLength {
+		return fmt.Errorf("recipient_passphrase should be at least %d characters", minPassphraseLength)
+	}
+	if _, _, err := passphrasePayload(a.Kind, a.Data); err != nil {
+		return err
+	}
+	if fallback := a.FallbackAction(); fallback != nil {
+		if _, _, err := passphrasePayload(fallback.Kind, fallback.Data); err != nil {
+			return fmt.Errorf("fallback: %w", err)
+		}
+	}
+	return nil
+}
+
+// ProtectPayload encrypts payload field of Action (and its fallback) data with passphrase.
+// Plugin delivers encrypted payload as is, only recipient who knows passphrase can decrypt it.
+func ProtectPayload(a *state.Action, passphrase string) error {
+	if err := ValidatePassphrase(a, passphrase); err != nil {
+		return err
+	}
+	data, err := protectData(a.Kind, a.Data, passphrase)
+	if err != nil {
+		return err
+	}
+	if a.Fallback != nil {
+		fallbackData, err := protectData(a.Fallback.Kind, a.Fallback.Data, passphrase)
+		if err != nil {
+			return fmt.Errorf("fallback: %w", err)
+		}
+		a.Fallback.Data = fallbackData
+	}
+	a.Data = data
+	return nil
+}
+
+// passphrasePayload returns decoded data and its payload field name.
+// Templated and HTML mail is rejected, encrypted payload can't be rendered.
+func passphrasePayload(kind string, data string) (map[string]any, string, error) {
+	field, ok := passphraseFields[kind]
+	if !ok {
+		return nil, "", fmt.Errorf("recipient_passphrase is not supported by kind %s", kind)
+	}
+	decoded := map[string]any{}
+	if err := json.Unmarshal([]byte(data), &decoded); err != nil {
+		return nil, "", err
+	}
+	if value, ok := decoded[field].(string); !ok || value == "" {
+		return nil, "", fmt.Errorf("%s must be provided", field)
+	}
+	if kind == "mail" && (decoded["templated"] == true || decoded["html"] == true) {
+		return nil, "", fmt.Errorf("recipient_passphrase can't be used with templated or html mail")
+	}
+	return decoded, field, nil
+}
+
+// protectData returns data with payload field encrypted with passphrase.
+func protectData(kind string, data string, passphrase string) (string, error) {
+	decoded, field, err := passphrasePayload(kind, data)
+	if err != nil {
+		return "", err
+	}
+	encrypted, err := encryptPassphrase(decoded[field].(string), passphrase)
+	if err != nil {
+		return "", fmt.Errorf("unable to encrypt %s with recipient passphrase: %w", field, err)
+	}
+	decoded[field] = encrypted
+	protected, err := jsonMarshal(decoded)
+	if err != nil {
+		return "", err
+	}
+	return string(protected), nil
+}
@@ -0,0 +1,118 @@
+package execute
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"dmh/internal/crypt"
+	"dmh/internal/state"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidatePassphrase(t *testing.T) {
+	tests := []struct {
+		inputAction   *state.Action
+		passphrase    string
+		expectedError string
+	}{
+		{
+			inputAction: &state.Action{Kind: "mail", Data: `{"message": "secret", "subject": "s", "destination": ["a@example.com"]}`},
+			passphrase:  "correct horse",
+		},
+		{
+			inputAction: &state.Action{Kind: "file_write", Data: `{"path": "/tmp/x", "content": "secret"}`},
+			passphrase:  "correct horse",
+		},
+		{
+			inputAction:   &state.Action{Kind: "mail", Data: `{"message": "secret"}`},
+			passphrase:    "short",
+			expectedError: "recipient_passphrase should be at least 8 characters",
+		},
+		{
+			inputAction:   &state.Action{Kind: "json_post", Data: `{"url": "http://example.com"}`},
+			passphrase:    "correct horse",
+			expectedError: "recipient_passphrase is not supported by kind json_post",
+		},
+		{
+			inputAction:   &state.Action{Kind: "bulksms", Data: `{"destination": ["123"]}`},
+			passphrase:    "correct horse",
+			expectedError: "message must be provided",
+		},
+		{
+			inputAction:   &state.Action{Kind: "bulksms", Data: `{"message": 1}`},
+			passphrase:    "correct horse",
+			expectedError: "message must be provided",
+		},
+		{
+			inputAction:   &state.Action{Kind: "bulksms", Data: `{`},
+			passphrase:    "correct horse",
+			expectedError: "unexpected end of JSON input",
+		},
+		{
+			inputAction:   &state.Action{Kind: "mail", Data: `{"message": "secret", "templated": true}`},
+			passphrase:    "correct horse",
+			expectedError: "recipient_passphrase can't be used with templated or html mail",
+		},
+		{
+			inputAction:   &state.Action{Kind: "mail", Data: `{"message": "secret", "html": true}`},
+			passphrase:    "correct horse",
+			expectedError: "recipient_passphrase can't be used with templated or html mail",
+		},
+		{
+			inputAction: &state.Action{
+				Kind:     "mail",
+				Data:     `{"message": "secret"}`,
+				Fallback: &state.Fallback{Kind: "json_post", Data: `{"url": "http://example.com"}`},
+			},
+			passphrase:    "correct horse",
+			expectedError: "fallback: recipient_passphrase is not supported by kind json_post",
+		},
+	}
+
+	for _, test := range tests {
+		err := ValidatePassphrase(test.inputAction, test.passphrase)
+		if test.expectedError != "" {
+			require.EqualError(t, err, test.expectedError)
+			continue
+		}
+		require.Nil(t, err)
+	}
+}
+
+func TestProtectPayload(t *testing.T) {
+	defer func() { encryptPassphrase = crypt.EncryptPassphrase }()
+
+	encryptPassphrase = func(data string, passphrase string) (string, error) {
+		return "encrypted(" + data + "," + passphrase + ")", nil
+	}
+	a := &state.Action{
+		Kind:     "mail",
+		Data:     `{"message": "secret", "subject": "s", "destination": ["a@example.com"]}`,
+		Fallback: &state.Fallback{Kind: "bulksms", Data: `{"message": "fallback secret", "destination": ["123"]}`},
+	}
+	require.Nil(t, ProtectPayload(a, "correct horse"))
+	require.JSONEq(t, `{"message": "encrypted(secret,correct horse)", "subject": "s", "destination": ["a@example.com"]}`, a.Data)
+	require.JSONEq(t, `{"message": "encrypted(fallback secret,correct horse)", "destination": ["123"]}`, a.Fallback.Data)
+
+	a = &state.Action{Kind: "json_post", Data: `{"url": "http://example.com"}`}
+	require.EqualError(t, ProtectPayload(a, "correct horse"), "recipient_passphrase is not supported by kind json_post")
+	require.Equal(t, `{"url": "http://example.com"}`, a.Data)
+
+	encryptPassphrase = func(string, string) (string, error) { return "", errors.New("mock error") }
+	a = &state.Action{Kind: "dummy", Data: `{"message": "secret"}`}
+	require.EqualError(t, ProtectPayload(a, "correct horse"), "unable to encrypt message with recipient passphrase: mock error")
+	require.Equal(t, `{"message": "secret"}`, a.Data)
+
+	encryptPassphrase = crypt.EncryptPassphrase
+	a = &state.Action{Kind: "dummy", Data: `{"message": "secret"}`}
+	require.Nil(t, ProtectPayload(a, "correct horse"))
+	data := map[string]string{}
+	require.Nil(t, json.Unmarshal([]byte(a.Data), &data))
+	decrypted, err := crypt.DecryptPassphrase(data["message"], "correct horse")
+	require.Nil(t, err)
+	require.Equal(t, "secret", decrypted)
+	_, err = UnmarshalActionData(a)
+	require.Nil(t, err)
+}
@@ -0,0 +1,99 @@
+package execute
+
+import (
+	"fmt"
+	"net/url"
+
+	"dmh/internal/state"
+)
+
+// Recipient is concrete target which action would be delivered to.
+type Recipient struct {
+	Type    string `json:"type"` // mail, phone, url or file
+	Address string `json:"address"`
+}
+
+// recipientPlugin is implemented by plugins which deliver action to external targets.
+type recipientPlugin interface {
+	recipients() []Recipient
+}
+
+// Preview returns recipients of Action without running it.
+// Action is prepared exactly like in Run, test mode redirects recipients as it redirects delivery.
+func (e *Execute) Preview(a *state.Action) ([]Recipient, error) {
+	data, err := e.prepare(a)
+	if err != nil {
+		return nil, err
+	}
+	if err := applyTestMode(data, e.testMode); err != nil {
+		return nil, fmt.Errorf("test mode: %w", err)
+	}
+	plugin, ok := data.(recipientPlugin)
+	if !ok {
+		return []Recipient{}, nil
+	}
+	return plugin.recipients(), nil
+}
+
+// PrimaryRecipient returns first recipient of Action (e.g. first mail address), empty when Action has no recipient.
+// Only Action.Data is used, executor config and test mode are ignored, so real recipient is returned.
+func PrimaryRecipient(a *state.Action) string {
+	data, err := UnmarshalActionData(a)
+	if err != nil {
+		return ""
+	}
+	plugin, ok := data.(recipientPlugin)
+	if !ok {
+		return ""
+	}
+	if recipients := plugin.recipients(); len(recipients) > 0 {
+		return recipients[0].Address
+	}
+	return ""
+}
+
+// recipients returns mail addresses.
+func (d *ExecuteMail) recipients() []Recipient {
+	recipients := make([]Recipient, 0, len(d.Destination))
+	for _, destination := range d.Destination {
+		recipients = append(recipients, Recipient{Type: "mail", Address: destination})
+	}
+	return recipients
+}
+
+// recipients returns phone numbers.
+func (d *ExecuteBulkSMS) recipients() []Recipient {
+	recipients := make([]Recipient, 0, len(d.Destination))
+	for _, destination := range d.Destination {
+		recipients = append(recipients, Recipient{Type: "phone", Address: destination})
+	}
+	return recipients
+}
+
+// recipients returns request URL, password from URL is redacted.
+func (d *ExecuteJSONPost) recipients() []Recipient {
+	address := d.URL
+	if u, err := url.Parse(d.URL); err == nil {
+		address = u.Redacted()
+	}
+	return []Recipient{{Type: "url", Address: address}}
+}
+
+// recipients returns request URL, password from URL is redacted.
+func (d *ExecuteFormPost) recipients() []Recipient {
+	address := d.URL
+	if u, err := url.Parse(d.URL); err == nil {
+		address = u.Redacted()
+	}
+	return []Recipient{{Type: "url", Address: address}}
+}
+
+// recipients returns written file.
+func (d *ExecuteFileWrite) recipients() []Recipient {
+	return []Recipient{{Type: "file", Address: d.Path}}
+}
+
+// recipients returns journal file.
+func (d *ExecuteJournal) recipients() []Recipient {
+	return []Recipient{{Type: "file", Address: d.config.File}}
+}
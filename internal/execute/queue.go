@@ -0,0 +1,281 @@
+package execute
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"dmh/internal/state"
+)
+
+// Options.Mode values, empty Mode behaves like ModeLocal.
+const (
+	ModeLocal = "local" // plugins run in DMH process
+	ModeQueue = "queue" // actions are published to queue, separate consumer runs them
+)
+
+// DefaultQueueSubject is subject used when QueueConfig.Subject is empty.
+const DefaultQueueSubject = "dmh.actions"
+
+// queueTimeout bounds single publish when ctx has no deadline.
+const queueTimeout = 10 * time.Second
+
+var (
+	// mocks for tests
+	queueDial = (&net.Dialer{}).DialContext
+)
+
+// QueueConfig describes queue used in ModeQueue.
+// Only NATS JetStream is supported: nats://[user:pass@]host:port, tls:// enforces TLS.
+// Subject must be stored by JetStream stream, core NATS drops messages when consumer is not connected.
+type QueueConfig struct {
+	URL     string `koanf:"url"`
+	Subject string `koanf:"subject"`
+}
+
+// Validate checks QueueConfig.
+func (c *QueueConfig) Validate() error {
+	u, err := url.Parse(c.URL)
+	if err != nil {
+		return fmt.Errorf("url must be valid: %w", err)
+	}
+	if u.Scheme != "nats" && u.Scheme != "tls" {
+		return fmt.Errorf("url must be nats:// or tls:// (only NATS is supported)")
+	}
+	if u.Host == "" {
+		return fmt.Errorf("url must contain host")
+	}
+	if strings.ContainsAny(c.Subject, " \t\r\n") {
+		return fmt.Errorf("subject must not contain whitespace")
+	}
+	return nil
+}
+
+// QueueMessage is published for every action run in ModeQueue.
+// Data is decrypted action data, consumer is responsible for keeping it secret.
+type QueueMessage struct {
+	UUID     string    `json:"uuid"`
+	Kind     string    `json:"kind"`
+	Comment  string    `json:"comment"`
+	Data     string    `json:"data"`
+	LastSeen time.Time `json:"last_seen"`
+	// VerifyURL is set when recipient should receive verification link instead of action message.
+	VerifyURL string `json:"verify_url,omitempty"`
+}
+
+// Queue publishes actions to queue instead of running plugins.
+// Actions are validated exactly like in ModeLocal, so broken action fails in DMH and not in consumer.
+type Queue struct {
+	*Execute
+	config QueueConfig
+}
+
+// Run publishes Action to queue.
+func (q *Queue) Run(ctx context.Context, a *state.Action) error {
+	action, err := q.prepareMessage(a)
+	if err != nil {
+		return err
+	}
+	return q.publish(ctx, q.message(ctx, action, ""))
+}
+
+// RunVerification publishes Action with verification link, consumer sends link instead of action message.
+func (q *Queue) RunVerification(ctx context.Context, a *state.Action, link string) error {
+	action, err := q.prepareMessage(a)
+	if err != nil {
+		return err
+	}
+	data, err := q.prepare(action)
+	if err != nil {
+		return err
+	}
+	if _, ok := data.(verificationPlugin); !ok {
+		return fmt.Errorf("kind %s does not support verification", a.Kind)
+	}
+	return q.publish(ctx, q.message(ctx, action, link))
+}
+
+// prepareMessage returns copy of Action with expanded placeholders, validated as local run.
+func (q *Queue) prepareMessage(a *state.Action) (*state.Action, error) {
+	action := *a
+	q.expandSigAuth(&action)
+	if _, err := q.prepare(&action); err != nil {
+		return nil, err
+	}
+	return &action, nil
+}
+
+// message returns QueueMessage of Action.
+func (q *Queue) message(ctx context.Context, a *state.Action, link string) *QueueMessage {
+	meta := runMetaFromContext(ctx)
+	return &QueueMessage{
+		UUID:      meta.UUID,
+		Kind:      a.Kind,
+		Comment:   a.Comment,
+		Data:      a.Data,
+		LastSeen:  meta.LastSeen,
+		VerifyURL: link,
+	}
+}
+
+// publish sends msg to NATS JetStream subject and waits until stream acknowledges it was stored (PubAck).
+// PONG only confirms server parsed PUB, without stream message would be dropped when consumer is down
+// and action would be marked as run anyway.
+// Connection errors and messages not stored by stream are temporary, action is retried later.
+func (q *Queue) publish(ctx context.Context, msg *QueueMessage) error {
+	payload, err := jsonMarshal(msg)
+	if err != nil {
+		return err
+	}
+	u, err := url.Parse(q.config.URL)
+	if err != nil {
+		return err
+	}
+	subject := q.config.Subject
+	if subject == "" {
+		subject = DefaultQueueSubject
+	}
+
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, queueTimeout)
+		defer cancel()
+	}
+	conn, err := queueDial(ctx, "tcp", u.Host)
+	if err != nil {
+		return fmt.Errorf("%w: unable to connect to queue: %w", ErrTemporary, err)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	r := bufio.NewReader(conn)
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return fmt.Errorf("%w: unable to read queue server info: %w", ErrTemporary, err)
+	}
+	if !strings.HasPrefix(line, "INFO ") {
+		return fmt.Errorf("unexpected queue server greeting %q", strings.TrimSpace(line))
+	}
+	var info struct {
+		TLSRequired bool `json:"tls_required"`
+	}
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "INFO ")), &info); err != nil {
+		return fmt.Errorf("unable to parse queue server info: %w", err)
+	}
+	if info.TLSRequired || u.Scheme == "tls" {
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: u.Hostname()})
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			return fmt.Errorf("%w: unable to start queue TLS: %w", ErrTemporary, err)
+		}
+		conn = tlsConn
+		r = bufio.NewReader(conn)
+	}
+
+	// no_responders makes server answer immediately with 503 status when no stream stores subject.
+	connect := map[string]any{"verbose": false, "pedantic": false, "name": "dmh", "headers": true, "no_responders": true}
+	if u.User != nil {
+		if pass, ok := u.User.Password(); ok {
+			connect["user"] = u.User.Username()
+			connect["pass"] = pass
+		} else {
+			connect["auth_token"] = u.User.Username()
+		}
+	}
+	connectJSON, err := jsonMarshal(connect)
+	if err != nil {
+		return err
+	}
+	inbox, err := queueInbox()
+	if err != nil {
+		return err
+	}
+	cmd := fmt.Sprintf("CONNECT %s\r\nSUB %s 1\r\nPUB %s %s %d\r\n%s\r\n", connectJSON, inbox, subject, inbox, len(payload), payload)
+	if _, err := conn.Write([]byte(cmd)); err != nil {
+		return fmt.Errorf("%w: unable to publish to queue: %w", ErrTemporary, err)
+	}
+
+	// JetStream replies to inbox once message is stored.
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return fmt.Errorf("%w: unable to read queue acknowledgement: %w", ErrTemporary, err)
+		}
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "MSG "), strings.HasPrefix(line, "HMSG "):
+			return readPubAck(r, line, subject)
+		case line == "PING":
+			if _, err := conn.Write([]byte("PONG\r\n")); err != nil {
+				return fmt.Errorf("%w: unable to publish to queue: %w", ErrTemporary, err)
+			}
+		case strings.HasPrefix(line, "-ERR"):
+			return fmt.Errorf("queue server rejected message: %s", strings.TrimSpace(strings.TrimPrefix(line, "-ERR")))
+		}
+	}
+}
+
+// queueInbox returns unique reply subject for single publish.
+func queueInbox() (string, error) {
+	id := make([]byte, 12)
+	if _, err := rand.Read(id); err != nil {
+		return "", fmt.Errorf("unable to generate queue inbox: %w", err)
+	}
+	return "_INBOX.dmh." + hex.EncodeToString(id), nil
+}
+
+// readPubAck reads reply announced by MSG/HMSG line and checks it is JetStream PubAck.
+func readPubAck(r *bufio.Reader, line string, subject string) error {
+	fields := strings.Fields(line)
+	size, err := strconv.Atoi(fields[len(fields)-1])
+	if err != nil || size < 0 {
+		return fmt.Errorf("unexpected queue acknowledgement %q", line)
+	}
+	headerSize := 0
+	if fields[0] == "HMSG" {
+		headerSize, err = strconv.Atoi(fields[len(fields)-2])
+		if err != nil || headerSize < 0 || headerSize > size {
+			return fmt.Errorf("unexpected queue acknowledgement %q", line)
+		}
+	}
+	// Reply is followed by CRLF.
+	body := make([]byte, size+2)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return fmt.Errorf("%w: unable to read queue acknowledgement: %w", ErrTemporary, err)
+	}
+
+	if headerSize > 0 {
+		status, _, _ := strings.Cut(string(body[:headerSize]), "\r\n")
+		if fields := strings.Fields(status); len(fields) > 1 && fields[1] == "503" {
+			return fmt.Errorf("%w: no JetStream stream stores subject %s", ErrTemporary, subject)
+		}
+	}
+
+	var ack struct {
+		Stream string `json:"stream"`
+		Error  *struct {
+			Description string `json:"description"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(body[headerSize:size], &ack); err != nil {
+		return fmt.Errorf("unable to parse queue acknowledgement: %w", err)
+	}
+	if ack.Error != nil {
+		return fmt.Errorf("%w: queue stream did not store message: %s", ErrTemporary, ack.Error.Description)
+	}
+	if ack.Stream == "" {
+		return fmt.Errorf("unexpected queue acknowledgement %q", body[headerSize:size])
+	}
+	return nil
+}
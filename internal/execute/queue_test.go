@@ -0,0 +1,212 @@
+package execute
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"dmh/internal/state"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeNATS accepts single connection, records received commands and answers published message
+// with reply, {inbox} in reply is replaced with reply subject of PUB.
+func fakeNATS(t *testing.T, info string, reply string) (string, chan []string) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	t.Cleanup(func() { l.Close() })
+	received := make(chan []string, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.Write([]byte("INFO " + info + "\r\n"))
+		r := bufio.NewReader(conn)
+		var lines []string
+		inbox := ""
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				received <- lines
+				return
+			}
+			line = strings.TrimRight(line, "\r\n")
+			lines = append(lines, line)
+			if inbox != "" {
+				// line is published payload.
+				conn.Write([]byte(strings.ReplaceAll(reply, "{inbox}", inbox)))
+				received <- lines
+				return
+			}
+			if fields := strings.Fields(line); len(fields) == 4 && fields[0] == "PUB" {
+				inbox = fields[2]
+			}
+		}
+	}()
+	return l.Addr().String(), received
+}
+
+// natsReply returns MSG (or HMSG with headers) delivered to {inbox}.
+func natsReply(headers string, payload string) string {
+	if headers == "" {
+		return fmt.Sprintf("MSG {inbox} 1 %d\r\n%s\r\n", len(payload), payload)
+	}
+	return fmt.Sprintf("HMSG {inbox} 1 %d %d\r\n%s%s\r\n", len(headers), len(headers)+len(payload), headers, payload)
+}
+
+const pubAck = `{"stream":"DMH","seq":1}`
+
+func TestNewMode(t *testing.T) {
+	tests := []struct {
+		inputOptions  *Options
+		expectedError string
+		expectedQueue bool
+	}{
+		{
+			inputOptions: &Options{Mode: ModeLocal},
+		},
+		{
+			inputOptions:  &Options{Mode: ModeQueue, QueueConf: QueueConfig{URL: "nats://127.0.0.1:4222"}},
+			expectedQueue: true,
+		},
+		{
+			inputOptions:  &Options{Mode: "remote"},
+			expectedError: "execute.mode should be local or queue",
+		},
+		{
+			inputOptions:  &Options{Mode: ModeQueue, QueueConf: QueueConfig{URL: "kafka://127.0.0.1:9092"}},
+			expectedError: "invalid execute.queue config: url must be nats:// or tls:// (only NATS is supported)",
+		},
+		{
+			inputOptions:  &Options{Mode: ModeQueue, QueueConf: QueueConfig{URL: "nats://"}},
+			expectedError: "invalid execute.queue config: url must contain host",
+		},
+		{
+			inputOptions:  &Options{Mode: ModeQueue, QueueConf: QueueConfig{URL: "nats://127.0.0.1:4222", Subject: "dmh actions"}},
+			expectedError: "invalid execute.queue config: subject must not contain whitespace",
+		},
+		{
+			inputOptions:  &Options{Mode: ModeQueue, QueueConf: QueueConfig{URL: "nats://127.0.0.1:4222"}, TestMode: TestModeConfig{Enabled: true, Mail: "test@example.com"}},
+			expectedError: "execute.test_mode is not supported with execute.mode queue",
+		},
+	}
+	for _, test := range tests {
+		e, err := New(test.inputOptions)
+		if test.expectedError != "" {
+			require.EqualError(t, err, test.expectedError)
+			continue
+		}
+		require.Nil(t, err)
+		_, isQueue := e.(*Queue)
+		require.Equal(t, test.expectedQueue, isQueue)
+	}
+}
+
+func TestQueueRun(t *testing.T) {
+	addr, received := fakeNATS(t, `{"server_id":"test"}`, "PING\r\n"+natsReply("", pubAck))
+	q := &Queue{Execute: &Execute{}, config: QueueConfig{URL: "nats://user:pass@" + addr, Subject: "dmh.test"}}
+	lastSeen := time.Date(2025, 3, 26, 14, 55, 40, 0, time.UTC)
+	ctx := WithRunMeta(context.Background(), RunMeta{UUID: "uuid", Comment: "comment", LastSeen: lastSeen})
+
+	err := q.Run(ctx, &state.Action{Kind: "dummy", Comment: "comment", Data: `{"message": "test"}`})
+	require.Nil(t, err)
+
+	lines := <-received
+	require.Len(t, lines, 4)
+	var connect map[string]any
+	require.Nil(t, json.Unmarshal([]byte(strings.TrimPrefix(lines[0], "CONNECT ")), &connect))
+	require.Equal(t, "user", connect["user"])
+	require.Equal(t, "pass", connect["pass"])
+	require.Equal(t, true, connect["no_responders"])
+	inbox := strings.Fields(lines[1])[1]
+	require.True(t, strings.HasPrefix(inbox, "_INBOX.dmh."))
+	require.Equal(t, fmt.Sprintf("SUB %s 1", inbox), lines[1])
+	require.Equal(t, fmt.Sprintf("PUB dmh.test %s %d", inbox, len(lines[3])), lines[2])
+	var msg QueueMessage
+	require.Nil(t, json.Unmarshal([]byte(lines[3]), &msg))
+	require.Equal(t, QueueMessage{UUID: "uuid", Kind: "dummy", Comment: "comment", Data: `{"message": "test"}`, LastSeen: lastSeen}, msg)
+}
+
+func TestQueueRunVerification(t *testing.T) {
+	addr, received := fakeNATS(t, `{}`, natsReply("", pubAck))
+	q := &Queue{Execute: &Execute{}, config: QueueConfig{URL: "nats://token@" + addr}}
+
+	err := q.RunVerification(context.Background(), &state.Action{Kind: "dummy", Data: `{"message": "test"}`}, "https://dmh/verify")
+	require.Nil(t, err)
+
+	lines := <-received
+	require.True(t, strings.HasPrefix(lines[2], "PUB "+DefaultQueueSubject+" "))
+	require.Contains(t, lines[0], `"auth_token":"token"`)
+	var msg QueueMessage
+	require.Nil(t, json.Unmarshal([]byte(lines[3]), &msg))
+	require.Equal(t, "https://dmh/verify", msg.VerifyURL)
+
+	err = q.RunVerification(context.Background(), &state.Action{Kind: "journal", Data: `{"event": "test"}`}, "https://dmh/verify")
+	require.EqualError(t, err, "config file must be provided")
+}
+
+func TestQueueRunErrors(t *testing.T) {
+	q := &Queue{Execute: &Execute{allowedKinds: []string{"mail"}}, config: QueueConfig{URL: "nats://127.0.0.1:4222"}}
+	err := q.Run(context.Background(), &state.Action{Kind: "dummy", Data: `{"message": "test"}`})
+	require.ErrorIs(t, err, ErrKindNotEnabled)
+
+	addr, _ := fakeNATS(t, `{}`, "-ERR 'Authorization Violation'\r\n")
+	q = &Queue{Execute: &Execute{}, config: QueueConfig{URL: "nats://" + addr}}
+	err = q.Run(context.Background(), &state.Action{Kind: "dummy", Data: `{"message": "test"}`})
+	require.EqualError(t, err, "queue server rejected message: 'Authorization Violation'")
+	require.NotErrorIs(t, err, ErrTemporary)
+
+	// Message which is not stored by JetStream stream is retried, consumer would never get it.
+	ackTests := []struct {
+		inputReply    string
+		expectedError string
+		temporary     bool
+	}{
+		{
+			inputReply:    natsReply("NATS/1.0 503\r\n\r\n", ""),
+			expectedError: "temporary failure: no JetStream stream stores subject dmh.actions",
+			temporary:     true,
+		},
+		{
+			inputReply:    natsReply("", `{"error":{"code":503,"description":"insufficient resources"}}`),
+			expectedError: "temporary failure: queue stream did not store message: insufficient resources",
+			temporary:     true,
+		},
+		{
+			inputReply:    natsReply("", `{}`),
+			expectedError: `unexpected queue acknowledgement "{}"`,
+		},
+		{
+			inputReply:    natsReply("", `not-json`),
+			expectedError: "unable to parse queue acknowledgement: invalid character 'o' in literal null (expecting 'u')",
+		},
+		{
+			inputReply:    "MSG {inbox} 1 x\r\n",
+			expectedError: `unexpected queue acknowledgement "MSG`,
+		},
+	}
+	for _, test := range ackTests {
+		addr, _ := fakeNATS(t, `{}`, test.inputReply)
+		q = &Queue{Execute: &Execute{}, config: QueueConfig{URL: "nats://" + addr}}
+		err = q.Run(context.Background(), &state.Action{Kind: "dummy", Data: `{"message": "test"}`})
+		require.ErrorContains(t, err, test.expectedError)
+		require.Equal(t, test.temporary, errors.Is(err, ErrTemporary))
+	}
+
+	defer func() { queueDial = (&net.Dialer{}).DialContext }()
+	queueDial = func(context.Context, string, string) (net.Conn, error) {
+		return nil, fmt.Errorf("connection refused")
+	}
+	err = q.Run(context.Background(), &state.Action{Kind: "dummy", Data: `{"message": "test"}`})
+	require.ErrorIs(t, err, ErrTemporary)
+	require.ErrorContains(t, err, "unable to connect to queue: connection refused")
+}
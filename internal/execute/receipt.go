@@ -0,0 +1,52 @@
+package execute
+
+import (
+	"fmt"
+	"strings"
+
+	"dmh/internal/state"
+)
+
+// Receipt placeholders are replaced when action with delivery receipt is added,
+// so delivered data carries token which recipient acknowledges delivery with.
+const (
+	ReceiptTokenPlaceholder = "{receipt_token}"
+	ReceiptURLPlaceholder   = "{receipt_url}"
+)
+
+// receiptData returns Data and Fallback Data of action, both can carry receipt placeholders.
+func receiptData(a *state.Action) []string {
+	if a.Fallback == nil {
+		return []string{a.Data}
+	}
+	return []string{a.Data, a.Fallback.Data}
+}
+
+// ValidateReceipt checks that action delivered with receipt references receipt token,
+// otherwise recipient would never be able to acknowledge it.
+// withURL is false when public DMH address is not configured, {receipt_url} can't be used then.
+func ValidateReceipt(a *state.Action, withURL bool) error {
+	var found bool
+	for _, data := range receiptData(a) {
+		hasURL := strings.Contains(data, ReceiptURLPlaceholder)
+		if hasURL || strings.Contains(data, ReceiptTokenPlaceholder) {
+			found = true
+		}
+		if hasURL && !withURL {
+			return fmt.Errorf("%s is not available, action.verify.public_url is not configured", ReceiptURLPlaceholder)
+		}
+	}
+	if !found {
+		return fmt.Errorf("receipt requires %s or %s in data", ReceiptTokenPlaceholder, ReceiptURLPlaceholder)
+	}
+	return nil
+}
+
+// ExpandReceipt replaces receipt placeholders in Data and Fallback Data with token and link.
+func ExpandReceipt(a *state.Action, token string, link string) {
+	replacer := strings.NewReplacer(ReceiptTokenPlaceholder, token, ReceiptURLPlaceholder, link)
+	a.Data = replacer.Replace(a.Data)
+	if a.Fallback != nil {
+		a.Fallback.Data = replacer.Replace(a.Fallback.Data)
+	}
+}
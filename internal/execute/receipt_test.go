@@ -0,0 +1,59 @@
+package execute
+
+import (
+	"testing"
+
+	"dmh/internal/state"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateReceipt(t *testing.T) {
+	tests := []struct {
+		inputAction   *state.Action
+		inputWithURL  bool
+		expectedError string
+	}{
+		{
+			inputAction:   &state.Action{Data: `{"message": "test"}`},
+			inputWithURL:  true,
+			expectedError: "receipt requires {receipt_token} or {receipt_url} in data",
+		},
+		{
+			inputAction: &state.Action{Data: `{"message": "ack with {receipt_token}"}`},
+		},
+		{
+			inputAction:  &state.Action{Data: `{"message": "open {receipt_url}"}`},
+			inputWithURL: true,
+		},
+		{
+			inputAction:   &state.Action{Data: `{"message": "open {receipt_url}"}`},
+			expectedError: "{receipt_url} is not available, action.verify.public_url is not configured",
+		},
+		{
+			inputAction: &state.Action{Data: `{"message": "test"}`, Fallback: &state.Fallback{Data: `{"message": "{receipt_token}"}`}},
+		},
+	}
+	for _, test := range tests {
+		err := ValidateReceipt(test.inputAction, test.inputWithURL)
+		if test.expectedError == "" {
+			require.Nil(t, err)
+		} else {
+			require.EqualError(t, err, test.expectedError)
+		}
+	}
+}
+
+func TestExpandReceipt(t *testing.T) {
+	a := &state.Action{
+		Data:     `{"message": "token {receipt_token}, link {receipt_url}"}`,
+		Fallback: &state.Fallback{Data: `{"message": "{receipt_url}"}`},
+	}
+	ExpandReceipt(a, "token", "https://dmh.example.com/api/receipt/token")
+	require.Equal(t, `{"message": "token token, link https://dmh.example.com/api/receipt/token"}`, a.Data)
+	require.Equal(t, `{"message": "https://dmh.example.com/api/receipt/token"}`, a.Fallback.Data)
+
+	a = &state.Action{Data: `{"message": "{receipt_token}"}`}
+	ExpandReceipt(a, "token", "")
+	require.Equal(t, `{"message": "token"}`, a.Data)
+}
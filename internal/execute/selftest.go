@@ -0,0 +1,78 @@
+package execute
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"dmh/internal/useragent"
+)
+
+// probeTimeout bounds single network probe of self-test.
+const probeTimeout = 10 * time.Second
+
+// SelfTest checks config of every configured plugin with its PopulateConfig, so misconfiguration is visible
+// at startup and not when action fires. With probe, network plugins are also contacted:
+// mail connects to SMTP server (EHLO, STARTTLS, AUTH) and bulksms sends HEAD to its API.
+// Plugins without config are skipped. All problems are returned together.
+func SelfTest(ctx context.Context, opts *Options, probe bool) error {
+	e := &Execute{
+		bulkSMSConf:   opts.BulkSMSConf,
+		mailConf:      opts.MailConf,
+		jsonPostConf:  opts.JSONPostConf,
+		journalConf:   opts.JournalConf,
+		fileWriteConf: opts.FileWriteConf,
+	}
+
+	var errs []error
+	if e.mailConf != (MailConfig{}) {
+		d := &ExecuteMail{}
+		if err := d.PopulateConfig(e); err != nil {
+			errs = append(errs, fmt.Errorf("mail: %w", err))
+		} else if probe {
+			if err := d.config.probe(ctx); err != nil {
+				errs = append(errs, fmt.Errorf("mail: unable to connect to %s: %w", d.config.Server, err))
+			}
+		}
+	}
+	if e.bulkSMSConf != (BulkSMSConfig{}) {
+		d := &ExecuteBulkSMS{}
+		if err := d.PopulateConfig(e); err != nil {
+			errs = append(errs, fmt.Errorf("bulksms: %w", err))
+		} else if probe {
+			if err := probeHTTP(ctx, endpoint); err != nil {
+				errs = append(errs, fmt.Errorf("bulksms: %w", err))
+			}
+		}
+	}
+	if e.journalConf != (JournalConfig{}) {
+		if err := (&ExecuteJournal{}).PopulateConfig(e); err != nil {
+			errs = append(errs, fmt.Errorf("journal: %w", err))
+		}
+	}
+	if len(e.fileWriteConf.AllowedDirs) > 0 {
+		if err := e.fileWriteConf.Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("file_write: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// probeHTTP sends HEAD request to url, any HTTP response means endpoint is reachable.
+func probeHTTP(ctx context.Context, url string) error {
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, url, nil)
+	if err != nil {
+		return err
+	}
+	client := &http.Client{Transport: &useragent.Transport{}}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("unable to connect to %s: %w", url, err)
+	}
+	resp.Body.Close()
+	return nil
+}
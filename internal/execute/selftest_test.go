@@ -0,0 +1,81 @@
+package execute
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSelfTest(t *testing.T) {
+	headServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, http.MethodHead, r.Method)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}))
+	defer headServer.Close()
+	closedServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	closedServer.Close()
+
+	validBulkSMS := BulkSMSConfig{Token: BulkSMSToken{ID: "token", Secret: "secret"}}
+	tests := []struct {
+		inputOpts     *Options
+		inputProbe    bool
+		inputEndpoint string
+		expectedError []string
+	}{
+		{
+			inputOpts: &Options{},
+		},
+		{
+			inputOpts:  &Options{},
+			inputProbe: true,
+		},
+		{
+			inputOpts: &Options{
+				MailConf:    MailConfig{Server: "localhost", From: "dmh@example.com"},
+				BulkSMSConf: validBulkSMS,
+				JournalConf: JournalConfig{File: filepath.Join(t.TempDir(), "journal.jsonl")},
+			},
+		},
+		{
+			inputOpts: &Options{
+				MailConf:    MailConfig{Server: "localhost", From: "invalid"},
+				BulkSMSConf: BulkSMSConfig{RoutingGroup: "standard"},
+				JournalConf: JournalConfig{File: filepath.Join(t.TempDir(), "missing", "journal.jsonl")},
+			},
+			expectedError: []string{"mail: from must be a valid address", "bulksms: config token id and secret must be provided", "journal: file must be writable"},
+		},
+		{
+			inputOpts:     &Options{BulkSMSConf: validBulkSMS},
+			inputProbe:    true,
+			inputEndpoint: headServer.URL,
+		},
+		{
+			inputOpts:     &Options{BulkSMSConf: validBulkSMS},
+			inputProbe:    true,
+			inputEndpoint: closedServer.URL,
+			expectedError: []string{"bulksms: unable to connect to " + closedServer.URL},
+		},
+		{
+			inputOpts:     &Options{MailConf: MailConfig{Server: "127.0.0.1", From: "dmh@example.com", TLSPolicy: "no_tls"}, BulkSMSConf: validBulkSMS},
+			inputEndpoint: closedServer.URL,
+		},
+	}
+	for _, test := range tests {
+		if test.inputEndpoint != "" {
+			endpoint = test.inputEndpoint
+		}
+		err := SelfTest(context.Background(), test.inputOpts, test.inputProbe)
+		endpoint = "https://api.bulksms.com/v1/messages"
+		if len(test.expectedError) == 0 {
+			require.Nil(t, err)
+			continue
+		}
+		for _, expected := range test.expectedError {
+			require.ErrorContains(t, err, expected)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package execute
+
+import (
+	"bytes"
+	"fmt"
+	"text/template"
+	"time"
+)
+
+// templateData is available in templated plugin fields.
+type templateData struct {
+	Now       time.Time     // when action runs
+	LastSeen  time.Time     // when user was last seen, zero when unknown
+	SilentFor time.Duration // time since LastSeen (rounded to seconds), zero when LastSeen is unknown
+	UUID      string        // action uuid, empty when unknown
+	Comment   string        // action comment
+}
+
+// newTemplateData returns templateData for action described by meta.
+func newTemplateData(meta RunMeta) templateData {
+	data := templateData{
+		Now:      timeNow(),
+		LastSeen: meta.LastSeen,
+		UUID:     meta.UUID,
+		Comment:  meta.Comment,
+	}
+	if !meta.LastSeen.IsZero() {
+		data.SilentFor = data.Now.Sub(meta.LastSeen).Round(time.Second)
+	}
+	return data
+}
+
+// parseTemplate parses text as text/template, missing keys are errors.
+func parseTemplate(name string, text string) (*template.Template, error) {
+	t, err := template.New(name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s template: %w", name, err)
+	}
+	return t, nil
+}
+
+// renderTemplate parses and executes text with data.
+func renderTemplate(name string, text string, data templateData) (string, error) {
+	t, err := parseTemplate(name, text)
+	if err != nil {
+		return "", err
+	}
+	rendered := &bytes.Buffer{}
+	if err := t.Execute(rendered, data); err != nil {
+		return "", fmt.Errorf("unable to render %s: %w", name, err)
+	}
+	return rendered.String(), nil
+}
+
+// mapStrings returns copy of JSON value with fn applied to every string (map keys excluded).
+// name is path of value (e.g. data.message), it is passed to fn for error messages.
+func mapStrings(name string, value any, fn func(string, string) (string, error)) (any, error) {
+	switch v := value.(type) {
+	case string:
+		return fn(name, v)
+	case map[string]any:
+		mapped := make(map[string]any, len(v))
+		for key, item := range v {
+			m, err := mapStrings(name+"."+key, item, fn)
+			if err != nil {
+				return nil, err
+			}
+			mapped[key] = m
+		}
+		return mapped, nil
+	case []any:
+		mapped := make([]any, 0, len(v))
+		for i, item := range v {
+			m, err := mapStrings(fmt.Sprintf("%s[%d]", name, i), item, fn)
+			if err != nil {
+				return nil, err
+			}
+			mapped = append(mapped, m)
+		}
+		return mapped, nil
+	default:
+		return value, nil
+	}
+}
@@ -0,0 +1,117 @@
+package execute
+
+import (
+	"fmt"
+	"net/mail"
+	"net/url"
+	"regexp"
+)
+
+// testModePrefix is prepended to subject or message of actions run in test mode.
+const testModePrefix = "[TEST] "
+
+// TestModeConfig describes test mode, it redirects every delivery to test recipients.
+// Plugin without configured test recipient fails instead of delivering to real one.
+type TestModeConfig struct {
+	Enabled bool   `koanf:"enabled"`
+	Mail    string `koanf:"mail"`  // mail test recipient
+	Phone   string `koanf:"phone"` // bulksms test recipient
+	URL     string `koanf:"url"`   // json_post and form_post test endpoint
+}
+
+// testModePlugin is implemented by plugins which can be redirected in test mode.
+type testModePlugin interface {
+	applyTestMode(TestModeConfig) error
+}
+
+// Validate checks TestModeConfig.
+func (c *TestModeConfig) Validate() error {
+	if !c.Enabled {
+		return nil
+	}
+	if c.Mail == "" && c.Phone == "" && c.URL == "" {
+		return fmt.Errorf("at least one of mail, phone or url must be provided")
+	}
+	if c.Mail != "" {
+		if _, err := mail.ParseAddress(c.Mail); err != nil {
+			return fmt.Errorf("mail must be a valid address %s", err)
+		}
+	}
+	if c.Phone != "" && !regexp.MustCompile(`^[+\d]+$`).MatchString(c.Phone) {
+		return fmt.Errorf("phone must be a number")
+	}
+	if c.URL != "" {
+		if u, err := url.Parse(c.URL); err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("url must be a valid absolute url")
+		}
+	}
+	return nil
+}
+
+// applyTestMode redirects plugin to test recipient when test mode is enabled.
+func applyTestMode(data ExecuteData, config TestModeConfig) error {
+	if !config.Enabled {
+		return nil
+	}
+	plugin, ok := data.(testModePlugin)
+	if !ok {
+		return fmt.Errorf("plugin does not support test mode")
+	}
+	return plugin.applyTestMode(config)
+}
+
+// applyTestMode sends mail only to test recipient with [TEST] subject.
+func (d *ExecuteMail) applyTestMode(config TestModeConfig) error {
+	if config.Mail == "" {
+		return fmt.Errorf("execute.test_mode.mail is not configured")
+	}
+	d.Destination = []string{config.Mail}
+	d.Subject = testModePrefix + d.Subject
+	return nil
+}
+
+// applyTestMode sends SMS only to test recipient with [TEST] message.
+func (d *ExecuteBulkSMS) applyTestMode(config TestModeConfig) error {
+	if config.Phone == "" {
+		return fmt.Errorf("execute.test_mode.phone is not configured")
+	}
+	d.Destination = []string{config.Phone}
+	d.Message = testModePrefix + d.Message
+	return nil
+}
+
+// applyTestMode sends request only to test endpoint.
+func (d *ExecuteJSONPost) applyTestMode(config TestModeConfig) error {
+	if config.URL == "" {
+		return fmt.Errorf("execute.test_mode.url is not configured")
+	}
+	d.URL = config.URL
+	return nil
+}
+
+// applyTestMode sends form only to test endpoint.
+func (d *ExecuteFormPost) applyTestMode(config TestModeConfig) error {
+	if config.URL == "" {
+		return fmt.Errorf("execute.test_mode.url is not configured")
+	}
+	d.URL = config.URL
+	return nil
+}
+
+// applyTestMode marks journal entry as test, journal is local so it is not redirected.
+func (d *ExecuteJournal) applyTestMode(config TestModeConfig) error {
+	d.testMode = true
+	return nil
+}
+
+// applyTestMode writes to <path>.test, so real file is never replaced during test.
+func (d *ExecuteFileWrite) applyTestMode(config TestModeConfig) error {
+	d.Path += ".test"
+	return nil
+}
+
+// applyTestMode logs [TEST] message.
+func (d *ExecuteDummy) applyTestMode(config TestModeConfig) error {
+	d.Message = testModePrefix + d.Message
+	return nil
+}
@@ -0,0 +1,137 @@
+package execute
+
+import (
+	"context"
+	"testing"
+
+	"dmh/internal/state"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTestModeConfigValidate(t *testing.T) {
+	tests := []struct {
+		inputConfig   TestModeConfig
+		expectedError string
+	}{
+		{
+			inputConfig: TestModeConfig{Mail: "broken"},
+		},
+		{
+			inputConfig:   TestModeConfig{Enabled: true},
+			expectedError: "at least one of mail, phone or url must be provided",
+		},
+		{
+			inputConfig:   TestModeConfig{Enabled: true, Mail: "broken"},
+			expectedError: "mail must be a valid address mail: missing '@' or angle-addr",
+		},
+		{
+			inputConfig:   TestModeConfig{Enabled: true, Phone: "abc"},
+			expectedError: "phone must be a number",
+		},
+		{
+			inputConfig:   TestModeConfig{Enabled: true, URL: "/relative"},
+			expectedError: "url must be a valid absolute url",
+		},
+		{
+			inputConfig: TestModeConfig{Enabled: true, Mail: "me@test.com", Phone: "+48111", URL: "http://localhost:8080/test"},
+		},
+	}
+	for _, test := range tests {
+		err := test.inputConfig.Validate()
+		if test.expectedError != "" {
+			require.EqualError(t, err, test.expectedError)
+			continue
+		}
+		require.Nil(t, err)
+	}
+}
+
+func TestApplyTestMode(t *testing.T) {
+	config := TestModeConfig{Enabled: true, Mail: "me@test.com", Phone: "+48111", URL: "http://localhost/test"}
+	tests := []struct {
+		inputData     ExecuteData
+		inputConfig   TestModeConfig
+		expectedData  ExecuteData
+		expectedError string
+	}{
+		{
+			inputData:    &ExecuteMail{Subject: "subject", Destination: []string{"real@test.com"}},
+			inputConfig:  TestModeConfig{Mail: "me@test.com"},
+			expectedData: &ExecuteMail{Subject: "subject", Destination: []string{"real@test.com"}},
+		},
+		{
+			inputData:    &ExecuteMail{Subject: "subject", Message: "message", Destination: []string{"real@test.com", "other@test.com"}},
+			inputConfig:  config,
+			expectedData: &ExecuteMail{Subject: "[TEST] subject", Message: "message", Destination: []string{"me@test.com"}},
+		},
+		{
+			inputData:     &ExecuteMail{Subject: "subject", Destination: []string{"real@test.com"}},
+			inputConfig:   TestModeConfig{Enabled: true, Phone: "+48111"},
+			expectedError: "execute.test_mode.mail is not configured",
+		},
+		{
+			inputData:    &ExecuteBulkSMS{Message: "message", Destination: []string{"+48999"}},
+			inputConfig:  config,
+			expectedData: &ExecuteBulkSMS{Message: "[TEST] message", Destination: []string{"+48111"}},
+		},
+		{
+			inputData:     &ExecuteBulkSMS{Message: "message", Destination: []string{"+48999"}},
+			inputConfig:   TestModeConfig{Enabled: true, Mail: "me@test.com"},
+			expectedError: "execute.test_mode.phone is not configured",
+		},
+		{
+			inputData:    &ExecuteJSONPost{URL: "https://real/api", Data: map[string]any{"test": "test"}},
+			inputConfig:  config,
+			expectedData: &ExecuteJSONPost{URL: "http://localhost/test", Data: map[string]any{"test": "test"}},
+		},
+		{
+			inputData:     &ExecuteJSONPost{URL: "https://real/api"},
+			inputConfig:   TestModeConfig{Enabled: true, Mail: "me@test.com"},
+			expectedError: "execute.test_mode.url is not configured",
+		},
+		{
+			inputData:    &ExecuteFormPost{URL: "https://real/api", Fields: map[string]string{"test": "test"}},
+			inputConfig:  config,
+			expectedData: &ExecuteFormPost{URL: "http://localhost/test", Fields: map[string]string{"test": "test"}},
+		},
+		{
+			inputData:    &ExecuteJournal{},
+			inputConfig:  config,
+			expectedData: &ExecuteJournal{testMode: true},
+		},
+		{
+			inputData:    &ExecuteFileWrite{Path: "/var/dmh/letter.txt"},
+			inputConfig:  config,
+			expectedData: &ExecuteFileWrite{Path: "/var/dmh/letter.txt.test"},
+		},
+		{
+			inputData:    &ExecuteDummy{Message: "message"},
+			inputConfig:  config,
+			expectedData: &ExecuteDummy{Message: "[TEST] message"},
+		},
+	}
+	for _, test := range tests {
+		err := applyTestMode(test.inputData, test.inputConfig)
+		if test.expectedError != "" {
+			require.EqualError(t, err, test.expectedError)
+			continue
+		}
+		require.Nil(t, err)
+		require.Equal(t, test.expectedData, test.inputData)
+	}
+}
+
+func TestRunTestMode(t *testing.T) {
+	e := &Execute{testMode: TestModeConfig{Enabled: true, Phone: "+48111"}}
+
+	err := e.Run(context.Background(), &state.Action{Kind: "dummy", Data: `{"message": "test"}`})
+	require.Nil(t, err)
+
+	err = e.Run(context.Background(), &state.Action{Kind: "json_post", Data: `{"url": "https://real/api", "success_code": [200], "data": {"test": "test"}}`})
+	require.EqualError(t, err, "test mode: execute.test_mode.url is not configured")
+
+	// validation never applies test mode
+	err = e.Validate(&state.Action{Kind: "json_post", Data: `{"url": "https://real/api", "success_code": [200], "data": {"test": "test"}}`})
+	require.Nil(t, err)
+}
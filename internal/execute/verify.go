@@ -0,0 +1,62 @@
+package execute
+
+import (
+	"context"
+	"fmt"
+
+	"dmh/internal/state"
+)
+
+// verificationSubject is subject of verification mail.
+const verificationSubject = "Confirm dead-man-hand delivery"
+
+// verificationPlugin is implemented by plugins which can deliver verification link to action recipient.
+type verificationPlugin interface {
+	applyVerification(link string) error
+}
+
+// verificationMessage returns message asking recipient to open verification link.
+func verificationMessage(link string) string {
+	return fmt.Sprintf("You were added as recipient of dead-man-hand action. Open %s to confirm you can receive it.", link)
+}
+
+// RunVerification sends verification link to recipients of Action instead of its message.
+// Action destination and plugin config are used as in Run, test mode still redirects delivery.
+func (e *Execute) RunVerification(ctx context.Context, a *state.Action, link string) error {
+	data, err := e.prepare(a)
+	if err != nil {
+		return err
+	}
+	plugin, ok := data.(verificationPlugin)
+	if !ok {
+		return fmt.Errorf("kind %s does not support verification", a.Kind)
+	}
+	if err := plugin.applyVerification(link); err != nil {
+		return err
+	}
+	if err := applyTestMode(data, e.testMode); err != nil {
+		return fmt.Errorf("test mode: %w", err)
+	}
+	return data.Run(ctx)
+}
+
+// applyVerification sends plain text verification mail.
+func (d *ExecuteMail) applyVerification(link string) error {
+	d.Subject = verificationSubject
+	d.Message = verificationMessage(link)
+	d.HTML = false
+	d.Templated = false
+	return nil
+}
+
+// applyVerification sends verification SMS.
+func (d *ExecuteBulkSMS) applyVerification(link string) error {
+	d.Message = verificationMessage(link)
+	return nil
+}
+
+// applyVerification logs verification message.
+func (d *ExecuteDummy) applyVerification(link string) error {
+	d.Message = verificationMessage(link)
+	return nil
+}
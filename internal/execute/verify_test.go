@@ -0,0 +1,51 @@
+package execute
+
+import (
+	"context"
+	"testing"
+
+	"dmh/internal/state"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyVerification(t *testing.T) {
+	link := "https://dmh.example.com/api/action/verify/token"
+	message := "You were added as recipient of dead-man-hand action. Open https://dmh.example.com/api/action/verify/token to confirm you can receive it."
+	tests := []struct {
+		inputData    verificationPlugin
+		expectedData verificationPlugin
+	}{
+		{
+			inputData:    &ExecuteMail{Subject: "{{ .UUID }}", Message: "<b>secret</b>", Destination: []string{"real@test.com"}, HTML: true, Templated: true},
+			expectedData: &ExecuteMail{Subject: verificationSubject, Message: message, Destination: []string{"real@test.com"}},
+		},
+		{
+			inputData:    &ExecuteBulkSMS{Message: "secret", Destination: []string{"+48999"}},
+			expectedData: &ExecuteBulkSMS{Message: message, Destination: []string{"+48999"}},
+		},
+		{
+			inputData:    &ExecuteDummy{Message: "secret"},
+			expectedData: &ExecuteDummy{Message: message},
+		},
+	}
+	for _, test := range tests {
+		require.Nil(t, test.inputData.applyVerification(link))
+		require.Equal(t, test.expectedData, test.inputData)
+	}
+}
+
+func TestRunVerification(t *testing.T) {
+	e := &Execute{}
+	link := "https://dmh.example.com/api/action/verify/token"
+
+	require.Nil(t, e.RunVerification(context.Background(), &state.Action{Kind: "dummy", Data: `{"message": "test"}`}, link))
+	require.EqualError(t, e.RunVerification(context.Background(), &state.Action{Kind: "dummy", Data: `{"message": "test", "fail_on_run": true}`}, link), "FailOnRun error")
+	require.EqualError(t, e.RunVerification(context.Background(), &state.Action{Kind: "dummy", Data: `{}`}, link), "message must be provided")
+	require.EqualError(t, e.RunVerification(context.Background(), &state.Action{Kind: "json_post", Data: `{"url": "https://real/api", "success_code": [200], "data": {"test": "test"}}`}, link), "kind json_post does not support verification")
+
+	// test mode still redirects verification
+	e.testMode = TestModeConfig{Enabled: true, Mail: "me@test.com"}
+	e.bulkSMSConf = BulkSMSConfig{Token: BulkSMSToken{ID: "id", Secret: "secret"}}
+	require.EqualError(t, e.RunVerification(context.Background(), &state.Action{Kind: "bulksms", Data: `{"message": "test", "destination": ["+48999"]}`}, link), "test mode: execute.test_mode.phone is not configured")
+}
@@ -5,9 +5,13 @@ import (
 	"log"
 	"net/http"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
+	"dmh/internal/clock"
 	"dmh/internal/state"
+	"dmh/internal/useragent"
 
 	"github.com/prometheus/client_golang/prometheus"
 )
@@ -19,18 +23,81 @@ var (
 	collectSlowUnit     = time.Hour
 )
 
+// maxCommentLabel bounds length of comment label value.
+const maxCommentLabel = 32
+
+// Defaults of slow collector vault secret probes.
+const (
+	defaultSlowProbeTimeout     = 3 * time.Second
+	defaultSlowProbeConcurrency = 4
+)
+
 type PromCollector struct {
 	chStop                 chan bool
 	chSlowStop             chan bool
 	s                      state.StateInterface
+	v                      VaultClients
 	vaultToken             string
 	dmhActions             *prometheus.GaugeVec
+	dmhActionsByKind       *prometheus.GaugeVec
+	commentLabel           bool
 	dmhMissingSecretsTotal *prometheus.CounterVec
 	dmhActionErrorsTotal   *prometheus.CounterVec
+	dmhActionsCollected    prometheus.Counter
+	dmhActionFireCancelled *prometheus.CounterVec
+	dmhActionBackoff       *prometheus.GaugeVec
 	httpRequestsTotal      *prometheus.CounterVec
 	httpRequestDuration    *prometheus.HistogramVec
 	authSuccessTotal       *prometheus.CounterVec
 	authFailuresTotal      *prometheus.CounterVec
+	vaultSecretReleased    *prometheus.CounterVec
+	vaultClientClockSkew   *prometheus.GaugeVec
+	vaultUnitMismatch      prometheus.Gauge
+	vaultClientStale       *prometheus.GaugeVec
+	vaultClientSinceSeen   *prometheus.GaugeVec
+	reconcileMismatch      *prometheus.CounterVec
+	reconcileStaleSecrets  prometheus.Gauge
+	decryptUnreachable     *prometheus.CounterVec
+	vaultDeleteFailed      prometheus.Counter
+	dmhPanic               prometheus.Counter
+	dmhActionRuns          *prometheus.CounterVec
+	dmhActionSuppressed    *prometheus.CounterVec
+	slowProbeTimeout       time.Duration
+	slowProbeConcurrency   int
+	slowProbeStagger       time.Duration
+	jitter                 time.Duration
+	dmhActionUnacked       *prometheus.GaugeVec
+	noActions              prometheus.Gauge
+	vaultEmpty             prometheus.Gauge
+	emptyWarnAfter         time.Duration
+	actionsEmpty           emptySince
+	secretsEmpty           emptySince
+}
+
+// emptySince tracks since when DMH (or vault) has nothing to protect.
+type emptySince struct {
+	since    time.Time // zero when not empty
+	warnedAt time.Time // zero when warning was not logged yet
+}
+
+// observe records if tracked resource is empty at now and returns true when it is empty for at least after.
+// Warning is logged when after is crossed and repeated every after while resource stays empty.
+func (e *emptySince) observe(empty bool, now time.Time, after time.Duration, what string) bool {
+	if !empty {
+		*e = emptySince{}
+		return false
+	}
+	if e.since.IsZero() {
+		e.since = now
+	}
+	if now.Sub(e.since) < after {
+		return false
+	}
+	if e.warnedAt.IsZero() || now.Sub(e.warnedAt) >= after {
+		log.Printf("WARNING: %s for %s, nothing is protected, check configuration", what, now.Sub(e.since).Round(time.Second))
+		e.warnedAt = now
+	}
+	return true
 }
 
 // Initialize register prometheus collectors and start collector.
@@ -39,14 +106,34 @@ func Initialize(opts *Options) *PromCollector {
 		Name: "dmh_actions",
 		Help: "Number of actions stored in DMH",
 	}, []string{"processed"})
+	actionsByKindLabels := []string{"kind", "processed"}
+	if opts != nil && opts.CommentLabel {
+		actionsByKindLabels = append(actionsByKindLabels, "comment")
+	}
+	dmhActionsByKind := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "dmh_actions_by_kind",
+		Help: "Number of actions stored in DMH, by kind",
+	}, actionsByKindLabels)
 	dmhMissingSecretsTotal := prometheus.NewCounterVec(prometheus.CounterOpts{
 		Name: "dmh_missing_secrets_total",
-		Help: "Total number of missing secrets detected in the vault during daily validation",
+		Help: "Total number of missing secrets detected in the vault during startup and daily validation",
 	}, []string{"action"})
 	dmhActionErrorsTotal := prometheus.NewCounterVec(prometheus.CounterOpts{
 		Name: "dmh_action_errors_total",
 		Help: "Total number of action errors",
 	}, []string{"action", "error"})
+	dmhActionsCollected := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "dmh_actions_collected_total",
+		Help: "Total number of fully processed actions removed by garbage collection",
+	})
+	dmhActionFireCancelled := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "dmh_action_fire_cancelled_total",
+		Help: "Total number of pending action runs cancelled by user",
+	}, []string{"action"})
+	dmhActionBackoff := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "dmh_action_backoff",
+		Help: "Set to 1 while action which keeps failing is not retried",
+	}, []string{"action"})
 	httpRequestsTotal := prometheus.NewCounterVec(prometheus.CounterOpts{
 		Name: "dmh_http_requests_total",
 		Help: "Total number of HTTP requests, by method and response code",
@@ -64,37 +151,167 @@ func Initialize(opts *Options) *PromCollector {
 		Name: "dmh_auth_failures_total",
 		Help: "Total number of failed authentications, by credential type and reason",
 	}, []string{"type", "reason"})
+	vaultSecretReleased := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "dmh_vault_secret_released_total",
+		Help: "Total number of secrets released by vault, by client uuid",
+	}, []string{"client"})
+	vaultClientClockSkew := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "dmh_vault_client_clock_skew_seconds",
+		Help: "Difference between client clock and vault clock reported in last alive request, by client uuid",
+	}, []string{"client"})
+	vaultUnitMismatch := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "dmh_vault_process_unit_mismatch",
+		Help: "Set to 1 when remote vault process unit differs from DMH action.process_unit",
+	})
+	vaultClientStale := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "dmh_vault_client_stale",
+		Help: "Set to 1 when vault client is silent long enough that at least one of its secrets is released, by client uuid",
+	}, []string{"client"})
+	vaultClientSinceSeen := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "dmh_vault_client_seconds_since_seen",
+		Help: "Seconds since vault client was last seen, by client uuid",
+	}, []string{"client"})
+	reconcileMismatch := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "dmh_reconcile_mismatch_total",
+		Help: "Total number of inconsistencies between actions and vault secrets found by reconciliation, by type",
+	}, []string{"type"})
+	reconcileStaleSecrets := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "dmh_reconcile_stale_secrets",
+		Help: "Number of vault secrets released longer than reconcile interval ago which were not deleted, found by last reconciliation",
+	})
+	decryptUnreachable := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "dmh_vault_decrypt_unreachable_total",
+		Help: "Total number of action decrypt attempts which failed because remote vault was unreachable",
+	}, []string{"action"})
+	vaultDeleteFailed := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "dmh_vault_delete_failed_total",
+		Help: "Total number of deleted actions which vault secret could not be deleted",
+	})
+	dmhPanic := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "dmh_panic_total",
+		Help: "Total number of panic calls which paused all actions",
+	})
+	dmhActionRuns := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "dmh_action_runs_total",
+		Help: "Total number of successful action runs, by delivery path (primary or fallback)",
+	}, []string{"action", "path"})
+	dmhActionSuppressed := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "dmh_action_suppressed_total",
+		Help: "Total number of recurring action runs skipped because identical data was delivered within dedupe window",
+	}, []string{"action"})
+	dmhActionUnacked := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "dmh_action_unacknowledged",
+		Help: "Set to 1 for action with delivery receipt which was run, but recipient did not acknowledge it since last run",
+	}, []string{"action"})
+	noActions := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "dmh_no_actions",
+		Help: "Set to 1 when DMH has no pending actions for longer than metrics.empty_warn_after",
+	})
+	vaultEmpty := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "dmh_vault_empty",
+		Help: "Set to 1 when vault stores no secrets for longer than metrics.empty_warn_after",
+	})
 	if opts != nil && opts.Registry != nil {
 		opts.Registry.MustRegister(dmhActions)
+		opts.Registry.MustRegister(dmhActionsByKind)
 		opts.Registry.MustRegister(dmhMissingSecretsTotal)
 		opts.Registry.MustRegister(dmhActionErrorsTotal)
+		opts.Registry.MustRegister(dmhActionsCollected)
+		opts.Registry.MustRegister(dmhActionFireCancelled)
+		opts.Registry.MustRegister(dmhActionBackoff)
 		opts.Registry.MustRegister(httpRequestsTotal)
 		opts.Registry.MustRegister(httpRequestDuration)
 		opts.Registry.MustRegister(authSuccessTotal)
 		opts.Registry.MustRegister(authFailuresTotal)
+		opts.Registry.MustRegister(vaultSecretReleased)
+		opts.Registry.MustRegister(vaultClientClockSkew)
+		opts.Registry.MustRegister(vaultUnitMismatch)
+		opts.Registry.MustRegister(vaultClientStale)
+		opts.Registry.MustRegister(vaultClientSinceSeen)
+		opts.Registry.MustRegister(reconcileMismatch)
+		opts.Registry.MustRegister(reconcileStaleSecrets)
+		opts.Registry.MustRegister(decryptUnreachable)
+		opts.Registry.MustRegister(vaultDeleteFailed)
+		opts.Registry.MustRegister(dmhPanic)
+		opts.Registry.MustRegister(dmhActionRuns)
+		opts.Registry.MustRegister(dmhActionSuppressed)
+		opts.Registry.MustRegister(dmhActionUnacked)
+		opts.Registry.MustRegister(noActions)
+		opts.Registry.MustRegister(vaultEmpty)
 	} else {
 		prometheus.MustRegister(dmhActions)
+		prometheus.MustRegister(dmhActionsByKind)
 		prometheus.MustRegister(dmhMissingSecretsTotal)
 		prometheus.MustRegister(dmhActionErrorsTotal)
+		prometheus.MustRegister(dmhActionsCollected)
+		prometheus.MustRegister(dmhActionFireCancelled)
+		prometheus.MustRegister(dmhActionBackoff)
 		prometheus.MustRegister(httpRequestsTotal)
 		prometheus.MustRegister(httpRequestDuration)
 		prometheus.MustRegister(authSuccessTotal)
 		prometheus.MustRegister(authFailuresTotal)
+		prometheus.MustRegister(vaultSecretReleased)
+		prometheus.MustRegister(vaultClientClockSkew)
+		prometheus.MustRegister(vaultUnitMismatch)
+		prometheus.MustRegister(vaultClientStale)
+		prometheus.MustRegister(vaultClientSinceSeen)
+		prometheus.MustRegister(reconcileMismatch)
+		prometheus.MustRegister(reconcileStaleSecrets)
+		prometheus.MustRegister(decryptUnreachable)
+		prometheus.MustRegister(vaultDeleteFailed)
+		prometheus.MustRegister(dmhPanic)
+		prometheus.MustRegister(dmhActionRuns)
+		prometheus.MustRegister(dmhActionSuppressed)
+		prometheus.MustRegister(dmhActionUnacked)
+		prometheus.MustRegister(noActions)
+		prometheus.MustRegister(vaultEmpty)
 	}
 
 	p := &PromCollector{
 		chStop:                 make(chan bool),
 		chSlowStop:             make(chan bool),
 		s:                      opts.State,
+		v:                      opts.Vault,
 		vaultToken:             opts.VaultToken,
 		dmhActions:             dmhActions,
+		dmhActionsByKind:       dmhActionsByKind,
+		commentLabel:           opts.CommentLabel,
 		dmhMissingSecretsTotal: dmhMissingSecretsTotal,
 		dmhActionErrorsTotal:   dmhActionErrorsTotal,
+		dmhActionsCollected:    dmhActionsCollected,
+		dmhActionFireCancelled: dmhActionFireCancelled,
+		dmhActionBackoff:       dmhActionBackoff,
 		httpRequestsTotal:      httpRequestsTotal,
 		httpRequestDuration:    httpRequestDuration,
 		authSuccessTotal:       authSuccessTotal,
 		authFailuresTotal:      authFailuresTotal,
+		vaultSecretReleased:    vaultSecretReleased,
+		vaultClientClockSkew:   vaultClientClockSkew,
+		vaultUnitMismatch:      vaultUnitMismatch,
+		vaultClientStale:       vaultClientStale,
+		vaultClientSinceSeen:   vaultClientSinceSeen,
+		reconcileMismatch:      reconcileMismatch,
+		reconcileStaleSecrets:  reconcileStaleSecrets,
+		decryptUnreachable:     decryptUnreachable,
+		vaultDeleteFailed:      vaultDeleteFailed,
+		dmhPanic:               dmhPanic,
+		dmhActionRuns:          dmhActionRuns,
+		dmhActionSuppressed:    dmhActionSuppressed,
+		slowProbeTimeout:       defaultSlowProbeTimeout,
+		slowProbeConcurrency:   defaultSlowProbeConcurrency,
+		dmhActionUnacked:       dmhActionUnacked,
+		noActions:              noActions,
+		vaultEmpty:             vaultEmpty,
+		emptyWarnAfter:         opts.EmptyWarnAfter,
 	}
+	if opts.SlowProbeTimeout > 0 {
+		p.slowProbeTimeout = opts.SlowProbeTimeout
+	}
+	if opts.SlowProbeConcurrency > 0 {
+		p.slowProbeConcurrency = opts.SlowProbeConcurrency
+	}
+	p.jitter = opts.Jitter
+	p.slowProbeStagger = opts.SlowProbeStagger
 
 	go p.collect()
 	go p.collectSlow()
@@ -112,6 +329,37 @@ func (p *PromCollector) UpdateDMHActionErrors(actionUUID, errorLabel string, n i
 	p.dmhActionErrorsTotal.WithLabelValues(actionUUID, errorLabel).Add(float64(n))
 }
 
+// UpdateDMHMissingSecrets increments the dmh_missing_secrets_total counter for a given action uuid by n.
+func (p *PromCollector) UpdateDMHMissingSecrets(actionUUID string, n int) {
+	p.dmhMissingSecretsTotal.WithLabelValues(actionUUID).Add(float64(n))
+}
+
+// RecordActionCollected increments dmh_actions_collected_total and drops per action series of garbage collected action.
+func (p *PromCollector) RecordActionCollected(actionUUID string) {
+	p.dmhActionsCollected.Inc()
+	p.dmhActionErrorsTotal.DeletePartialMatch(prometheus.Labels{"action": actionUUID})
+	p.dmhMissingSecretsTotal.DeletePartialMatch(prometheus.Labels{"action": actionUUID})
+	p.dmhActionFireCancelled.DeletePartialMatch(prometheus.Labels{"action": actionUUID})
+	p.dmhActionBackoff.DeletePartialMatch(prometheus.Labels{"action": actionUUID})
+	p.decryptUnreachable.DeletePartialMatch(prometheus.Labels{"action": actionUUID})
+	p.dmhActionRuns.DeletePartialMatch(prometheus.Labels{"action": actionUUID})
+	p.dmhActionSuppressed.DeletePartialMatch(prometheus.Labels{"action": actionUUID})
+}
+
+// SetActionBackoff sets dmh_action_backoff for a given action uuid, series is removed when backoff is over.
+func (p *PromCollector) SetActionBackoff(actionUUID string, active bool) {
+	if active {
+		p.dmhActionBackoff.WithLabelValues(actionUUID).Set(1)
+		return
+	}
+	p.dmhActionBackoff.DeleteLabelValues(actionUUID)
+}
+
+// RecordActionFireCancelled increments dmh_action_fire_cancelled_total for a given action uuid.
+func (p *PromCollector) RecordActionFireCancelled(actionUUID string) {
+	p.dmhActionFireCancelled.WithLabelValues(actionUUID).Inc()
+}
+
 // RecordHTTPRequest records an HTTP request and its latency.
 func (p *PromCollector) RecordHTTPRequest(method string, code int, d time.Duration) {
 	p.httpRequestsTotal.WithLabelValues(method, strconv.Itoa(code)).Inc()
@@ -128,13 +376,71 @@ func (p *PromCollector) RecordAuthFailure(authType, reason string) {
 	p.authFailuresTotal.WithLabelValues(authType, reason).Inc()
 }
 
+// RecordVaultSecretRelease records a secret released by vault for a given client uuid.
+func (p *PromCollector) RecordVaultSecretRelease(clientUUID string) {
+	p.vaultSecretReleased.WithLabelValues(clientUUID).Inc()
+}
+
+// SetVaultClientClockSkew sets dmh_vault_client_clock_skew_seconds for a given client uuid.
+func (p *PromCollector) SetVaultClientClockSkew(clientUUID string, skew time.Duration) {
+	p.vaultClientClockSkew.WithLabelValues(clientUUID).Set(skew.Seconds())
+}
+
+// SetVaultProcessUnitMismatch sets dmh_vault_process_unit_mismatch gauge.
+func (p *PromCollector) SetVaultProcessUnitMismatch(mismatch bool) {
+	if mismatch {
+		p.vaultUnitMismatch.Set(1)
+		return
+	}
+	p.vaultUnitMismatch.Set(0)
+}
+
+// RecordReconcileMismatch increments dmh_reconcile_mismatch_total for a given mismatch type.
+func (p *PromCollector) RecordReconcileMismatch(mismatchType string) {
+	p.reconcileMismatch.WithLabelValues(mismatchType).Inc()
+}
+
+// SetReconcileStaleSecrets sets dmh_reconcile_stale_secrets to number of stale secrets found by last reconciliation.
+func (p *PromCollector) SetReconcileStaleSecrets(count int) {
+	p.reconcileStaleSecrets.Set(float64(count))
+}
+
+// RecordVaultDecryptUnreachable increments dmh_vault_decrypt_unreachable_total for a given action uuid.
+func (p *PromCollector) RecordVaultDecryptUnreachable(actionUUID string) {
+	p.decryptUnreachable.WithLabelValues(actionUUID).Inc()
+}
+
+// RecordActionRun increments dmh_action_runs_total for a given action uuid and delivery path.
+func (p *PromCollector) RecordActionRun(actionUUID, path string) {
+	p.dmhActionRuns.WithLabelValues(actionUUID, path).Inc()
+}
+
+// RecordActionSuppressed increments dmh_action_suppressed_total for a given action uuid.
+func (p *PromCollector) RecordActionSuppressed(actionUUID string) {
+	p.dmhActionSuppressed.WithLabelValues(actionUUID).Inc()
+}
+
+// RecordVaultDeleteFailed increments dmh_vault_delete_failed_total.
+func (p *PromCollector) RecordVaultDeleteFailed() {
+	p.vaultDeleteFailed.Inc()
+}
+
+// RecordPanic increments dmh_panic_total.
+func (p *PromCollector) RecordPanic() {
+	p.dmhPanic.Inc()
+}
+
 // collect will refresh Prometheus collectors (regular interval).
 func (p *PromCollector) collect() {
 	log.Printf("starting prometheus collector")
-	collectTicker := time.NewTicker(time.Duration(collectInterval) * collectIntervalUnit)
+	interval := time.Duration(collectInterval) * collectIntervalUnit
+	collectTicker := time.NewTicker(interval)
 	for {
 		select {
 		case <-collectTicker.C:
+			if !clock.Sleep(clock.Jitter(min(p.jitter, interval)), p.chStop) {
+				return
+			}
 			if p.s != nil {
 				actionsPerProcessed := map[int]int{0: 0, 1: 0, 2: 0}
 				for _, a := range p.s.GetActions() {
@@ -143,6 +449,14 @@ func (p *PromCollector) collect() {
 				for k, v := range actionsPerProcessed {
 					p.dmhActions.WithLabelValues(fmt.Sprint(k)).Set(float64(v))
 				}
+				p.collectActionsByKind()
+				p.collectUnacknowledged()
+			}
+			if p.v != nil {
+				p.collectVaultClients()
+			}
+			if p.emptyWarnAfter > 0 {
+				p.collectEmpty(time.Now())
 			}
 		case <-p.chStop:
 			return
@@ -150,51 +464,157 @@ func (p *PromCollector) collect() {
 	}
 }
 
+// collectActionsByKind refreshes dmh_actions_by_kind.
+// Series are rebuilt from scratch, so kinds (and comments) without actions disappear.
+func (p *PromCollector) collectActionsByKind() {
+	actionsByKind := map[string]int{}
+	labels := map[string][]string{}
+	for _, a := range p.s.GetActions() {
+		values := []string{a.Kind, fmt.Sprint(a.Processed)}
+		if p.commentLabel {
+			values = append(values, truncateLabel(a.Comment, maxCommentLabel))
+		}
+		key := strings.Join(values, "\x00")
+		actionsByKind[key] += 1
+		labels[key] = values
+	}
+	p.dmhActionsByKind.Reset()
+	for k, v := range actionsByKind {
+		p.dmhActionsByKind.WithLabelValues(labels[k]...).Set(float64(v))
+	}
+}
+
+// collectUnacknowledged refreshes dmh_action_unacknowledged.
+// Series are rebuilt from scratch, so acknowledged and removed actions disappear.
+func (p *PromCollector) collectUnacknowledged() {
+	p.dmhActionUnacked.Reset()
+	for _, a := range p.s.GetActions() {
+		if a.Unacknowledged() {
+			p.dmhActionUnacked.WithLabelValues(a.UUID).Set(1)
+		}
+	}
+}
+
+// collectVaultClients refreshes dmh_vault_client_stale and dmh_vault_client_seconds_since_seen.
+// Series are rebuilt from scratch, so removed clients disappear.
+func (p *PromCollector) collectVaultClients() {
+	now := time.Now()
+	p.vaultClientStale.Reset()
+	p.vaultClientSinceSeen.Reset()
+	for _, c := range p.v.ClientStatuses() {
+		stale := 0.0
+		if c.Stale {
+			stale = 1
+		}
+		p.vaultClientStale.WithLabelValues(c.ClientUUID).Set(stale)
+		p.vaultClientSinceSeen.WithLabelValues(c.ClientUUID).Set(max(now.Sub(c.LastSeen).Seconds(), 0))
+	}
+}
+
+// collectEmpty refreshes dmh_no_actions and dmh_vault_empty.
+// DMH without pending actions (or vault without secrets) for emptyWarnAfter is likely misconfigured,
+// user believes they are protected, but nothing would be released.
+func (p *PromCollector) collectEmpty(now time.Time) {
+	if p.s != nil {
+		pending := 0
+		for _, a := range p.s.GetActions() {
+			if a.Processed != 2 {
+				pending++
+			}
+		}
+		setGauge(p.noActions, p.actionsEmpty.observe(pending == 0, now, p.emptyWarnAfter, "DMH has no pending actions"))
+	}
+	if p.v != nil {
+		secrets := 0
+		for _, c := range p.v.ClientStatuses() {
+			secrets += c.Secrets
+		}
+		setGauge(p.vaultEmpty, p.secretsEmpty.observe(secrets == 0, now, p.emptyWarnAfter, "vault has no secrets"))
+	}
+}
+
+// setGauge sets g to 1 when value is true, 0 otherwise.
+func setGauge(g prometheus.Gauge, value bool) {
+	if value {
+		g.Set(1)
+		return
+	}
+	g.Set(0)
+}
+
+// truncateLabel returns value cut to at most max runes.
+func truncateLabel(value string, max int) string {
+	runes := []rune(value)
+	if len(runes) <= max {
+		return value
+	}
+	return string(runes[:max])
+}
+
 // collectSlow will refresh Prometheus collectors (slow interval).
 func (p *PromCollector) collectSlow() {
 	log.Printf("starting prometheus slow collector")
-	collectSlowTicker := time.NewTicker(time.Duration(collectSlowInterval) * collectSlowUnit)
+	interval := time.Duration(collectSlowInterval) * collectSlowUnit
+	collectSlowTicker := time.NewTicker(interval)
 	for {
 		select {
 		case <-collectSlowTicker.C:
+			if !clock.Sleep(clock.Jitter(min(p.jitter, interval)), p.chSlowStop) {
+				return
+			}
 			if p.s != nil {
-				for _, a := range p.s.GetActions() {
-					if a.Processed == 2 {
-						continue
-					}
-					secretUrl := a.EncryptionMeta.VaultURL
-					if secretUrl == "" {
-						p.dmhMissingSecretsTotal.WithLabelValues(a.UUID).Add(1)
-						continue
-					}
-
-					req, err := http.NewRequest(http.MethodHead, secretUrl, nil)
-					if err != nil {
-						p.dmhMissingSecretsTotal.WithLabelValues(a.UUID).Add(1)
-						continue
-					}
-					if p.vaultToken != "" {
-						req.Header.Set("Authorization", "Bearer "+p.vaultToken)
-					}
-
-					client := http.Client{
-						Timeout: 3 * time.Second,
-					}
-					reg, err := client.Do(req)
-
-					if err != nil {
-						p.dmhMissingSecretsTotal.WithLabelValues(a.UUID).Add(1)
-						continue
-					}
-					reg.Body.Close()
-					if reg.StatusCode != http.StatusOK && reg.StatusCode != http.StatusLocked {
-						p.dmhMissingSecretsTotal.WithLabelValues(a.UUID).Add(1)
-						continue
-					}
-				}
+				p.probeSecrets(p.s.GetActions())
 			}
 		case <-p.chSlowStop:
 			return
 		}
 	}
 }
+
+// probeSecrets checks that vault still stores secret of every action which was not fully processed.
+// Secrets are probed by slowProbeConcurrency workers, every probe is bounded by slowProbeTimeout.
+// Actions without vault URL (e.g. cleared by state.clear_processed_vault_url) are skipped.
+// Every probe waits random delay up to slowProbeStagger, so probes are spread instead of hitting vault at once.
+func (p *PromCollector) probeSecrets(actions []*state.EncryptedAction) {
+	client := &http.Client{
+		Timeout:   p.slowProbeTimeout,
+		Transport: &useragent.Transport{},
+	}
+	queue := make(chan *state.EncryptedAction)
+	var wg sync.WaitGroup
+	for range p.slowProbeConcurrency {
+		wg.Go(func() {
+			for a := range queue {
+				time.Sleep(clock.Jitter(p.slowProbeStagger))
+				if !p.secretExists(client, a.EncryptionMeta.VaultURL) {
+					p.dmhMissingSecretsTotal.WithLabelValues(a.UUID).Add(1)
+				}
+			}
+		})
+	}
+	for _, a := range actions {
+		if a.Processed == 2 || a.EncryptionMeta.VaultURL == "" {
+			continue
+		}
+		queue <- a
+	}
+	close(queue)
+	wg.Wait()
+}
+
+// secretExists returns true when vault responds to secret probe with 200 (released) or 423 (not released yet).
+func (p *PromCollector) secretExists(client *http.Client, secretURL string) bool {
+	req, err := http.NewRequest(http.MethodHead, secretURL, nil)
+	if err != nil {
+		return false
+	}
+	if p.vaultToken != "" {
+		req.Header.Set("Authorization", "Bearer "+p.vaultToken)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	return resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusLocked
+}
@@ -7,12 +7,15 @@ import (
 	"net/http/httptest"
 	"reflect"
 	"regexp"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/google/uuid"
 
 	"dmh/internal/state"
+	"dmh/internal/vault"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -24,23 +27,71 @@ type mockState struct {
 	mock.Mock
 }
 
-func (m *mockState) UpdateLastSeen() {
+func (m *mockState) UpdateLastSeen(meta *state.LastSeenMeta) {
+	m.Called(meta)
+}
+
+func (m *mockState) MarkGone() {
 	m.Called()
 }
 
+func (m *mockState) UpdatePartialLastSeen(percent int, defaultUnit time.Duration) int {
+	args := m.Called(percent, defaultUnit)
+	return args.Int(0)
+}
+
 func (m *mockState) GetLastSeen() time.Time {
 	args := m.Called()
 	return args.Get(0).(time.Time)
 }
 
+func (m *mockState) GetLastSeenMeta() *state.LastSeenMeta {
+	args := m.Called()
+	if args.Get(0) == nil {
+		return nil
+	}
+	return args.Get(0).(*state.LastSeenMeta)
+}
+
+func (m *mockState) SetMaintenance(extend time.Duration) {
+	m.Called(extend)
+}
+
+func (m *mockState) ClearMaintenance() {
+	m.Called()
+}
+
+func (m *mockState) GetMaintenance() *state.Maintenance {
+	args := m.Called()
+	if args.Get(0) == nil {
+		return nil
+	}
+	return args.Get(0).(*state.Maintenance)
+}
+
 func (m *mockState) GetActions() []*state.EncryptedAction {
 	args := m.Called()
 	return args.Get(0).([]*state.EncryptedAction)
 }
 
-func (m *mockState) AddAction(action *state.Action) error {
+func (m *mockState) AddAction(action *state.Action) (string, error) {
 	args := m.Called(action)
-	return args.Error(0)
+	return args.String(0), args.Error(1)
+}
+
+func (m *mockState) AddUnverifiedAction(action *state.Action, verifyToken string) (string, error) {
+	args := m.Called(action, verifyToken)
+	return args.String(0), args.Error(1)
+}
+
+func (m *mockState) VerifyAction(verifyToken string) (string, error) {
+	args := m.Called(verifyToken)
+	return args.String(0), args.Error(1)
+}
+
+func (m *mockState) AcknowledgeReceipt(receiptToken string) (string, error) {
+	args := m.Called(receiptToken)
+	return args.String(0), args.Error(1)
 }
 
 func (m *mockState) GetAction(uuid string) (*state.EncryptedAction, int) {
@@ -56,11 +107,46 @@ func (m *mockState) DeleteAction(uuid string) error {
 	return args.Error(0)
 }
 
+func (m *mockState) DeleteAllActions(deleteVaultSecrets bool) *state.PurgeResult {
+	args := m.Called(deleteVaultSecrets)
+	return args.Get(0).(*state.PurgeResult)
+}
+
+func (m *mockState) ReorderActions(uuids []string) error {
+	args := m.Called(uuids)
+	return args.Error(0)
+}
+
 func (m *mockState) MarkActionAsProcessed(uuid string) error {
 	args := m.Called(uuid)
 	return args.Error(0)
 }
 
+func (m *mockState) MarkActionPending(uuid string) error {
+	args := m.Called(uuid)
+	return args.Error(0)
+}
+
+func (m *mockState) RecordActionFailure(uuid string) error {
+	args := m.Called(uuid)
+	return args.Error(0)
+}
+
+func (m *mockState) UpdateSourceLastSeen(source string, meta *state.LastSeenMeta) (bool, error) {
+	args := m.Called(source, meta)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *mockState) SourceLastSeenAdvances(source string) (bool, error) {
+	args := m.Called(source)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *mockState) CancelActionPending(uuid string) error {
+	args := m.Called(uuid)
+	return args.Error(0)
+}
+
 func (m *mockState) DecryptAction(uuid string) (*state.Action, error) {
 	args := m.Called(uuid)
 	if args.Get(0) == nil {
@@ -74,11 +160,63 @@ func (m *mockState) UpdateActionLastRun(uuid string) error {
 	return args.Error(0)
 }
 
+func (m *mockState) Panic(purge bool) *state.PanicResult {
+	args := m.Called(purge)
+	return args.Get(0).(*state.PanicResult)
+}
+
+func (m *mockState) Reconcile(declared []*state.Action) error {
+	args := m.Called(declared)
+	return args.Error(0)
+}
+
+func (m *mockState) SnapshotAt(t time.Time) (*state.Snapshot, error) {
+	args := m.Called(t)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*state.Snapshot), args.Error(1)
+}
+
+func (m *mockState) GetFiredLog(since time.Time) ([]*state.FiredEntry, error) {
+	args := m.Called(since)
+	return args.Get(0).([]*state.FiredEntry), args.Error(1)
+}
+
+func (m *mockState) RecordActionDelivery(uuid string, dataHash string) error {
+	args := m.Called(uuid, dataHash)
+	return args.Error(0)
+}
+
+func (m *mockState) SuppressActionRun(uuid string) error {
+	args := m.Called(uuid)
+	return args.Error(0)
+}
+
 func (m *mockState) GetActionLastRun(uuid string) (time.Time, error) {
 	args := m.Called(uuid)
 	return args.Get(0).(time.Time), args.Error(1)
 }
 
+func (m *mockState) VerifyVaultKeys() []state.VerifyResult {
+	args := m.Called()
+	return args.Get(0).([]state.VerifyResult)
+}
+
+func (m *mockState) GetVaultProcessUnit() (time.Duration, error) {
+	args := m.Called()
+	return args.Get(0).(time.Duration), args.Error(1)
+}
+
+func (m *mockState) Subscribe() (<-chan *state.Event, func()) {
+	args := m.Called()
+	return args.Get(0).(<-chan *state.Event), args.Get(1).(func())
+}
+
+func (m *mockState) ReportActionError(uuid string, step string, err error) {
+	m.Called(uuid, step, err)
+}
+
 func TestInitialize(t *testing.T) {
 	tests := []struct {
 		inputOpts             func() *Options
@@ -121,6 +259,8 @@ func TestInitialize(t *testing.T) {
 		require.NotNil(t, p.httpRequestDuration)
 		require.NotNil(t, p.authSuccessTotal)
 		require.NotNil(t, p.authFailuresTotal)
+		require.NotNil(t, p.vaultSecretReleased)
+		require.NotNil(t, p.vaultUnitMismatch)
 		require.IsType(t, &prometheus.GaugeVec{}, p.dmhActions)
 		require.IsType(t, &prometheus.CounterVec{}, p.dmhMissingSecretsTotal)
 		require.IsType(t, &prometheus.CounterVec{}, p.dmhActionErrorsTotal)
@@ -128,13 +268,15 @@ func TestInitialize(t *testing.T) {
 		require.IsType(t, &prometheus.HistogramVec{}, p.httpRequestDuration)
 		require.IsType(t, &prometheus.CounterVec{}, p.authSuccessTotal)
 		require.IsType(t, &prometheus.CounterVec{}, p.authFailuresTotal)
+		require.IsType(t, &prometheus.CounterVec{}, p.vaultSecretReleased)
 	}
 }
 
 func TestCollect(t *testing.T) {
 	tests := []struct {
-		inputOptions   func() *Options
-		expectedRegexp []*regexp.Regexp
+		inputOptions      func() *Options
+		expectedRegexp    []*regexp.Regexp
+		notExpectedRegexp []*regexp.Regexp
 	}{
 		{
 			inputOptions: func() *Options {
@@ -177,6 +319,62 @@ func TestCollect(t *testing.T) {
 				regexp.MustCompile(`dmh_actions{processed="2"} 1`),
 			},
 		},
+		{
+			inputOptions: func() *Options {
+				reg := prometheus.NewRegistry()
+				s := new(mockState)
+				s.On("GetActions").Return([]*state.EncryptedAction{
+					{Action: state.Action{Kind: "mail", Comment: "first"}},
+					{Action: state.Action{Kind: "mail", Comment: "second"}},
+					{Action: state.Action{Kind: "json_post"}, Processed: 2},
+				})
+				return &Options{State: s, Registry: reg}
+			},
+			expectedRegexp: []*regexp.Regexp{
+				regexp.MustCompile(`dmh_actions_by_kind{kind="mail",processed="0"} 2`),
+				regexp.MustCompile(`dmh_actions_by_kind{kind="json_post",processed="2"} 1`),
+			},
+			notExpectedRegexp: []*regexp.Regexp{
+				regexp.MustCompile(`comment=`),
+				regexp.MustCompile(`dmh_actions_by_kind{kind="mail",processed="2"}`),
+			},
+		},
+		{
+			inputOptions: func() *Options {
+				reg := prometheus.NewRegistry()
+				s := new(mockState)
+				s.On("GetActions").Return([]*state.EncryptedAction{
+					{Action: state.Action{Kind: "mail", Comment: "first"}},
+					{Action: state.Action{Kind: "mail", Comment: "first"}},
+					{Action: state.Action{Kind: "mail", Comment: strings.Repeat("a", 40)}, Processed: 1},
+				})
+				return &Options{State: s, Registry: reg, CommentLabel: true}
+			},
+			expectedRegexp: []*regexp.Regexp{
+				regexp.MustCompile(`dmh_actions_by_kind{comment="first",kind="mail",processed="0"} 2`),
+				regexp.MustCompile(`dmh_actions_by_kind{comment="` + strings.Repeat("a", 32) + `",kind="mail",processed="1"} 1`),
+			},
+		},
+		{
+			inputOptions: func() *Options {
+				reg := prometheus.NewRegistry()
+				s := new(mockState)
+				receivedAt := time.Now()
+				s.On("GetActions").Return([]*state.EncryptedAction{
+					{UUID: "unacked", ReceiptTokenHash: "hash", Processed: 2, LastRun: time.Now()},
+					{UUID: "acked", ReceiptTokenHash: "hash", Processed: 2, LastRun: receivedAt.Add(-time.Hour), ReceivedAt: &receivedAt},
+					{UUID: "pending", ReceiptTokenHash: "hash"},
+					{UUID: "no-receipt", Processed: 2},
+				})
+				return &Options{State: s, Registry: reg}
+			},
+			expectedRegexp: []*regexp.Regexp{
+				regexp.MustCompile(`dmh_action_unacknowledged{action="unacked"} 1`),
+			},
+			notExpectedRegexp: []*regexp.Regexp{
+				regexp.MustCompile(`dmh_action_unacknowledged{action="(acked|pending|no-receipt)"}`),
+			},
+		},
 	}
 	collectInterval = 1
 	defer func() {
@@ -203,7 +401,105 @@ func TestCollect(t *testing.T) {
 		for _, r := range test.expectedRegexp {
 			require.Regexp(t, r, string(body))
 		}
+		for _, r := range test.notExpectedRegexp {
+			require.NotRegexp(t, r, string(body))
+		}
+	}
+}
+
+type mockVaultClients struct {
+	mock.Mock
+}
+
+func (m *mockVaultClients) ClientStatuses() []vault.ClientStatus {
+	args := m.Called()
+	return args.Get(0).([]vault.ClientStatus)
+}
+
+func TestCollectVaultClients(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	v := new(mockVaultClients)
+	v.On("ClientStatuses").Return([]vault.ClientStatus{
+		{ClientUUID: "seen", LastSeen: time.Now().Add(-10 * time.Second)},
+		{ClientUUID: "gone", LastSeen: time.Now().Add(-2 * time.Hour), Stale: true},
+		{ClientUUID: "future", LastSeen: time.Now().Add(time.Hour)},
+	}).Once()
+	v.On("ClientStatuses").Return([]vault.ClientStatus{
+		{ClientUUID: "seen", LastSeen: time.Now()},
+	})
+	p := Initialize(&Options{Registry: reg, Vault: v})
+	p.chStop <- true
+	p.chSlowStop <- true
+
+	gather := func() string {
+		w := httptest.NewRecorder()
+		promhttp.HandlerFor(reg, promhttp.HandlerOpts{}).ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+		return w.Body.String()
 	}
+
+	p.collectVaultClients()
+	body := gather()
+	require.Regexp(t, `dmh_vault_client_stale{client="gone"} 1`, body)
+	require.Regexp(t, `dmh_vault_client_stale{client="seen"} 0`, body)
+	require.Regexp(t, `dmh_vault_client_seconds_since_seen{client="gone"} 7200`, body)
+	require.Regexp(t, `dmh_vault_client_seconds_since_seen{client="seen"} 10`, body)
+	require.Regexp(t, `dmh_vault_client_seconds_since_seen{client="future"} 0\n`, body)
+
+	p.collectVaultClients()
+	body = gather()
+	require.Regexp(t, `dmh_vault_client_stale{client="seen"} 0`, body)
+	require.NotRegexp(t, `client="gone"`, body)
+	require.NotRegexp(t, `client="future"`, body)
+}
+
+func TestCollectEmpty(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	s := new(mockState)
+	s.On("GetActions").Return([]*state.EncryptedAction{{Processed: 2}}).Times(3)
+	s.On("GetActions").Return([]*state.EncryptedAction{{}})
+	v := new(mockVaultClients)
+	v.On("ClientStatuses").Return([]vault.ClientStatus{{ClientUUID: "empty"}}).Twice()
+	v.On("ClientStatuses").Return([]vault.ClientStatus{{ClientUUID: "empty"}, {ClientUUID: "client", Secrets: 1}})
+	p := Initialize(&Options{Registry: reg, State: s, Vault: v, EmptyWarnAfter: time.Hour})
+	p.chStop <- true
+	p.chSlowStop <- true
+
+	gather := func() string {
+		w := httptest.NewRecorder()
+		promhttp.HandlerFor(reg, promhttp.HandlerOpts{}).ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+		return w.Body.String()
+	}
+
+	now := time.Now()
+	p.collectEmpty(now)
+	body := gather()
+	require.Regexp(t, `dmh_no_actions 0`, body)
+	require.Regexp(t, `dmh_vault_empty 0`, body)
+
+	p.collectEmpty(now.Add(time.Hour))
+	body = gather()
+	require.Regexp(t, `dmh_no_actions 1`, body)
+	require.Regexp(t, `dmh_vault_empty 1`, body)
+	require.Equal(t, now.Add(time.Hour), p.actionsEmpty.warnedAt)
+
+	p.collectEmpty(now.Add(90 * time.Minute))
+	body = gather()
+	require.Regexp(t, `dmh_no_actions 1`, body)
+	require.Regexp(t, `dmh_vault_empty 0`, body)
+	require.Equal(t, now.Add(time.Hour), p.actionsEmpty.warnedAt)
+	require.Equal(t, emptySince{}, p.secretsEmpty)
+
+	p.collectEmpty(now.Add(2 * time.Hour))
+	body = gather()
+	require.Regexp(t, `dmh_no_actions 0`, body)
+	require.Equal(t, emptySince{}, p.actionsEmpty)
+}
+
+func TestTruncateLabel(t *testing.T) {
+	require.Equal(t, "", truncateLabel("", 3))
+	require.Equal(t, "abc", truncateLabel("abc", 3))
+	require.Equal(t, "abc", truncateLabel("abcd", 3))
+	require.Equal(t, "zaż", truncateLabel("zażółć", 3))
 }
 
 func TestCollectSlow(t *testing.T) {
@@ -246,6 +542,20 @@ func TestCollectSlow(t *testing.T) {
 				regexp.MustCompile(`dmh_missing_secrets_total{action="uuid1"}`),
 			},
 		},
+		{
+			inputOptions: func() *Options {
+				reg := prometheus.NewRegistry()
+				s := new(mockState)
+				s.On("GetActions").Return([]*state.EncryptedAction{
+					{Processed: 2, UUID: "uuid1", EncryptionMeta: state.EncryptionMeta{VaultURL: ""}},
+				})
+				return &Options{State: s, Registry: reg}
+			},
+			expectedRegexp: []*regexp.Regexp{},
+			notExpectedRegexp: []*regexp.Regexp{
+				regexp.MustCompile(`dmh_missing_secrets_total{action="uuid1"}`),
+			},
+		},
 		{
 			inputOptions: func() *Options {
 				reg := prometheus.NewRegistry()
@@ -255,10 +565,10 @@ func TestCollectSlow(t *testing.T) {
 				})
 				return &Options{State: s, Registry: reg}
 			},
-			expectedRegexp: []*regexp.Regexp{
-				regexp.MustCompile(`dmh_missing_secrets_total{action="uuid1"} 1`),
+			expectedRegexp: []*regexp.Regexp{},
+			notExpectedRegexp: []*regexp.Regexp{
+				regexp.MustCompile(`dmh_missing_secrets_total{action="uuid1"}`),
 			},
-			notExpectedRegexp: []*regexp.Regexp{},
 		},
 		{
 			inputOptions: func() *Options {
@@ -334,12 +644,12 @@ func TestCollectSlow(t *testing.T) {
 				return &Options{State: s, Registry: reg, VaultToken: "test-vault-token"}
 			},
 			expectedRegexp: []*regexp.Regexp{
-				regexp.MustCompile(`dmh_missing_secrets_total{action="uuid1"} 1`),
 				regexp.MustCompile(`dmh_missing_secrets_total{action="uuid4"} 1`),
 				regexp.MustCompile(`dmh_missing_secrets_total{action="uuid6"} 1`),
 				regexp.MustCompile(`dmh_missing_secrets_total{action="uuid7"} 1`),
 			},
 			notExpectedRegexp: []*regexp.Regexp{
+				regexp.MustCompile(`dmh_missing_secrets_total{action="uuid1"}`),
 				regexp.MustCompile(`dmh_missing_secrets_total{action="uuid2"}`),
 				regexp.MustCompile(`dmh_missing_secrets_total{action="uuid3"}`),
 				regexp.MustCompile(`dmh_missing_secrets_total{action="uuid5"}`),
@@ -381,6 +691,79 @@ func TestCollectSlow(t *testing.T) {
 	}
 }
 
+func TestProbeSecrets(t *testing.T) {
+	var inFlight, maxInFlight atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		current := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			seen := maxInFlight.Load()
+			if current <= seen || maxInFlight.CompareAndSwap(seen, current) {
+				break
+			}
+		}
+		if r.URL.Path == "/slow" {
+			time.Sleep(500 * time.Millisecond)
+		} else {
+			time.Sleep(50 * time.Millisecond)
+		}
+		w.WriteHeader(http.StatusLocked)
+	}))
+	defer server.Close()
+
+	reg := prometheus.NewRegistry()
+	p := Initialize(&Options{Registry: reg, SlowProbeTimeout: 200 * time.Millisecond, SlowProbeConcurrency: 2})
+	p.Stop()
+	require.Equal(t, 200*time.Millisecond, p.slowProbeTimeout)
+	require.Equal(t, 2, p.slowProbeConcurrency)
+
+	actions := []*state.EncryptedAction{
+		{UUID: "cleared", EncryptionMeta: state.EncryptionMeta{VaultURL: ""}},
+	}
+	for i := range 6 {
+		actions = append(actions, &state.EncryptedAction{UUID: fmt.Sprintf("fast%d", i), EncryptionMeta: state.EncryptionMeta{VaultURL: server.URL}})
+	}
+	// slow probe is last, its handler keeps running after probe timed out
+	actions = append(actions, &state.EncryptedAction{UUID: "slow", EncryptionMeta: state.EncryptionMeta{VaultURL: server.URL + "/slow"}})
+	p.probeSecrets(actions)
+
+	require.Equal(t, int32(2), maxInFlight.Load())
+	w := httptest.NewRecorder()
+	promhttp.HandlerFor(reg, promhttp.HandlerOpts{}).ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	body := w.Body.String()
+	require.Regexp(t, regexp.MustCompile(`dmh_missing_secrets_total{action="slow"} 1`), body)
+	require.NotRegexp(t, regexp.MustCompile(`dmh_missing_secrets_total{action="fast`), body)
+	require.NotRegexp(t, regexp.MustCompile(`dmh_missing_secrets_total{action="cleared"}`), body)
+
+	p = Initialize(&Options{Registry: prometheus.NewRegistry()})
+	p.Stop()
+	require.Equal(t, defaultSlowProbeTimeout, p.slowProbeTimeout)
+	require.Equal(t, defaultSlowProbeConcurrency, p.slowProbeConcurrency)
+}
+
+func TestProbeSecretsStagger(t *testing.T) {
+	var probes atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		probes.Add(1)
+		w.WriteHeader(http.StatusLocked)
+	}))
+	defer server.Close()
+
+	p := Initialize(&Options{Registry: prometheus.NewRegistry(), SlowProbeConcurrency: 1, SlowProbeStagger: 20 * time.Millisecond, Jitter: time.Hour})
+	p.Stop()
+	require.Equal(t, 20*time.Millisecond, p.slowProbeStagger)
+	require.Equal(t, time.Hour, p.jitter)
+
+	actions := []*state.EncryptedAction{}
+	for i := range 5 {
+		actions = append(actions, &state.EncryptedAction{UUID: fmt.Sprintf("uuid%d", i), EncryptionMeta: state.EncryptionMeta{VaultURL: server.URL}})
+	}
+	started := time.Now()
+	p.probeSecrets(actions)
+	require.Equal(t, int32(5), probes.Load())
+	require.Less(t, time.Since(started), 5*20*time.Millisecond+time.Second)
+}
+
 func TestDMHActionErrorsTotal(t *testing.T) {
 	tests := []struct {
 		inputActionUUID string
@@ -419,6 +802,107 @@ func TestDMHActionErrorsTotal(t *testing.T) {
 	}
 }
 
+func TestRecordActionCollected(t *testing.T) {
+	opts := &Options{State: nil, Registry: prometheus.NewRegistry()}
+	p := Initialize(opts)
+	p.Stop()
+
+	p.UpdateDMHActionErrors("collected", "Run", 1)
+	p.UpdateDMHActionErrors("collected", "DecryptAction", 1)
+	p.UpdateDMHMissingSecrets("collected", 1)
+	p.RecordActionFireCancelled("collected")
+	p.UpdateDMHActionErrors("other", "Run", 1)
+	p.RecordActionCollected("collected")
+
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	w := httptest.NewRecorder()
+
+	handler := promhttp.HandlerFor(opts.Registry.(prometheus.Gatherer), promhttp.HandlerOpts{})
+	handler.ServeHTTP(w, req)
+
+	body, err := io.ReadAll(w.Result().Body)
+	require.Nil(t, err)
+	require.Contains(t, string(body), "dmh_actions_collected_total 1")
+	require.Contains(t, string(body), `dmh_action_errors_total{action="other",error="Run"} 1`)
+	require.NotContains(t, string(body), `action="collected"`)
+}
+
+func TestRecordActionFireCancelled(t *testing.T) {
+	opts := &Options{State: nil, Registry: prometheus.NewRegistry()}
+	p := Initialize(opts)
+	p.Stop()
+
+	p.RecordActionFireCancelled("action")
+	p.RecordActionFireCancelled("action")
+
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	w := httptest.NewRecorder()
+
+	handler := promhttp.HandlerFor(opts.Registry.(prometheus.Gatherer), promhttp.HandlerOpts{})
+	handler.ServeHTTP(w, req)
+
+	body, err := io.ReadAll(w.Result().Body)
+	require.Nil(t, err)
+	require.Contains(t, string(body), `dmh_action_fire_cancelled_total{action="action"} 2`)
+}
+
+func TestSetActionBackoff(t *testing.T) {
+	opts := &Options{State: nil, Registry: prometheus.NewRegistry()}
+	p := Initialize(opts)
+	p.Stop()
+
+	p.SetActionBackoff("action", true)
+	p.SetActionBackoff("other", true)
+	p.SetActionBackoff("other", false)
+
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	w := httptest.NewRecorder()
+
+	handler := promhttp.HandlerFor(opts.Registry.(prometheus.Gatherer), promhttp.HandlerOpts{})
+	handler.ServeHTTP(w, req)
+
+	body, err := io.ReadAll(w.Result().Body)
+	require.Nil(t, err)
+	require.Contains(t, string(body), `dmh_action_backoff{action="action"} 1`)
+	require.NotContains(t, string(body), `dmh_action_backoff{action="other"}`)
+}
+
+func TestDMHMissingSecretsTotal(t *testing.T) {
+	tests := []struct {
+		inputActionUUID string
+		inputIncrements []int
+		expected        float64
+	}{
+		{uuid.NewString(), []int{1, 2}, 3},
+		{uuid.NewString(), []int{1}, 1},
+	}
+
+	for _, test := range tests {
+		opts := &Options{State: nil, Registry: prometheus.NewRegistry()}
+		p := Initialize(opts)
+		p.Stop()
+
+		for _, inc := range test.inputIncrements {
+			p.UpdateDMHMissingSecrets(test.inputActionUUID, inc)
+		}
+
+		req := httptest.NewRequest("GET", "/metrics", nil)
+		w := httptest.NewRecorder()
+
+		handler := promhttp.HandlerFor(opts.Registry.(prometheus.Gatherer), promhttp.HandlerOpts{})
+		handler.ServeHTTP(w, req)
+
+		resp := w.Result()
+		body, err := io.ReadAll(resp.Body)
+		require.Nil(t, err)
+
+		require.Regexp(t,
+			regexp.MustCompile(fmt.Sprintf(`dmh_missing_secrets_total{action=\"%s\"} %v`, test.inputActionUUID, test.expected)),
+			string(body),
+		)
+	}
+}
+
 func TestRecordHTTPRequest(t *testing.T) {
 	tests := []struct {
 		inputMethod string
@@ -540,3 +1024,225 @@ func TestRecordAuthFailure(t *testing.T) {
 		)
 	}
 }
+
+func TestRecordVaultSecretRelease(t *testing.T) {
+	tests := []struct {
+		inputClient string
+		inputCalls  int
+		expected    float64
+	}{
+		{"client-a", 1, 1},
+		{"client-b", 3, 3},
+	}
+
+	for _, test := range tests {
+		opts := &Options{State: nil, Registry: prometheus.NewRegistry()}
+		p := Initialize(opts)
+		p.Stop()
+
+		for i := 0; i < test.inputCalls; i++ {
+			p.RecordVaultSecretRelease(test.inputClient)
+		}
+
+		req := httptest.NewRequest("GET", "/metrics", nil)
+		w := httptest.NewRecorder()
+
+		handler := promhttp.HandlerFor(opts.Registry.(prometheus.Gatherer), promhttp.HandlerOpts{})
+		handler.ServeHTTP(w, req)
+
+		resp := w.Result()
+		body, err := io.ReadAll(resp.Body)
+		require.Nil(t, err)
+
+		require.Regexp(t,
+			regexp.MustCompile(fmt.Sprintf(`dmh_vault_secret_released_total{client="%s"} %v`, test.inputClient, test.expected)),
+			string(body),
+		)
+	}
+}
+
+func TestSetVaultClientClockSkew(t *testing.T) {
+	tests := []struct {
+		inputSkew []time.Duration
+		expected  string
+	}{
+		{[]time.Duration{90 * time.Second}, `dmh_vault_client_clock_skew_seconds{client="client-a"} 90`},
+		{[]time.Duration{90 * time.Second, -2 * time.Second}, `dmh_vault_client_clock_skew_seconds{client="client-a"} -2`},
+	}
+
+	for _, test := range tests {
+		opts := &Options{State: nil, Registry: prometheus.NewRegistry()}
+		p := Initialize(opts)
+		p.Stop()
+
+		for _, skew := range test.inputSkew {
+			p.SetVaultClientClockSkew("client-a", skew)
+		}
+
+		req := httptest.NewRequest("GET", "/metrics", nil)
+		w := httptest.NewRecorder()
+
+		handler := promhttp.HandlerFor(opts.Registry.(prometheus.Gatherer), promhttp.HandlerOpts{})
+		handler.ServeHTTP(w, req)
+
+		body, err := io.ReadAll(w.Result().Body)
+		require.Nil(t, err)
+		require.Contains(t, string(body), test.expected)
+	}
+}
+
+func TestSetVaultProcessUnitMismatch(t *testing.T) {
+	tests := []struct {
+		inputMismatch []bool
+		expected      string
+	}{
+		{[]bool{true}, "dmh_vault_process_unit_mismatch 1"},
+		{[]bool{true, false}, "dmh_vault_process_unit_mismatch 0"},
+	}
+
+	for _, test := range tests {
+		opts := &Options{State: nil, Registry: prometheus.NewRegistry()}
+		p := Initialize(opts)
+		p.Stop()
+
+		for _, mismatch := range test.inputMismatch {
+			p.SetVaultProcessUnitMismatch(mismatch)
+		}
+
+		req := httptest.NewRequest("GET", "/metrics", nil)
+		w := httptest.NewRecorder()
+
+		handler := promhttp.HandlerFor(opts.Registry.(prometheus.Gatherer), promhttp.HandlerOpts{})
+		handler.ServeHTTP(w, req)
+
+		body, err := io.ReadAll(w.Result().Body)
+		require.Nil(t, err)
+		require.Contains(t, string(body), test.expected)
+	}
+}
+
+func TestRecordReconcileMismatch(t *testing.T) {
+	opts := &Options{State: nil, Registry: prometheus.NewRegistry()}
+	p := Initialize(opts)
+	p.Stop()
+
+	p.RecordReconcileMismatch("missing_secret")
+	p.RecordReconcileMismatch("missing_secret")
+	p.RecordReconcileMismatch("process_after")
+	p.SetReconcileStaleSecrets(3)
+	p.SetReconcileStaleSecrets(1)
+
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	w := httptest.NewRecorder()
+
+	handler := promhttp.HandlerFor(opts.Registry.(prometheus.Gatherer), promhttp.HandlerOpts{})
+	handler.ServeHTTP(w, req)
+
+	body, err := io.ReadAll(w.Result().Body)
+	require.Nil(t, err)
+	require.Contains(t, string(body), `dmh_reconcile_mismatch_total{type="missing_secret"} 2`)
+	require.Contains(t, string(body), `dmh_reconcile_mismatch_total{type="process_after"} 1`)
+	require.Contains(t, string(body), "dmh_reconcile_stale_secrets 1")
+}
+
+func TestRecordVaultDeleteFailed(t *testing.T) {
+	opts := &Options{State: nil, Registry: prometheus.NewRegistry()}
+	p := Initialize(opts)
+	p.Stop()
+
+	p.RecordVaultDeleteFailed()
+	p.RecordVaultDeleteFailed()
+
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	w := httptest.NewRecorder()
+
+	handler := promhttp.HandlerFor(opts.Registry.(prometheus.Gatherer), promhttp.HandlerOpts{})
+	handler.ServeHTTP(w, req)
+
+	body, err := io.ReadAll(w.Result().Body)
+	require.Nil(t, err)
+	require.Contains(t, string(body), `dmh_vault_delete_failed_total 2`)
+}
+
+func TestRecordPanic(t *testing.T) {
+	opts := &Options{State: nil, Registry: prometheus.NewRegistry()}
+	p := Initialize(opts)
+	p.Stop()
+
+	p.RecordPanic()
+
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	w := httptest.NewRecorder()
+
+	handler := promhttp.HandlerFor(opts.Registry.(prometheus.Gatherer), promhttp.HandlerOpts{})
+	handler.ServeHTTP(w, req)
+
+	body, err := io.ReadAll(w.Result().Body)
+	require.Nil(t, err)
+	require.Contains(t, string(body), `dmh_panic_total 1`)
+}
+
+func TestRecordActionRun(t *testing.T) {
+	opts := &Options{State: nil, Registry: prometheus.NewRegistry()}
+	p := Initialize(opts)
+	p.Stop()
+
+	p.RecordActionRun("uuid1", "primary")
+	p.RecordActionRun("uuid1", "fallback")
+	p.RecordActionRun("uuid1", "fallback")
+
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	w := httptest.NewRecorder()
+
+	handler := promhttp.HandlerFor(opts.Registry.(prometheus.Gatherer), promhttp.HandlerOpts{})
+	handler.ServeHTTP(w, req)
+
+	body, err := io.ReadAll(w.Result().Body)
+	require.Nil(t, err)
+	require.Contains(t, string(body), `dmh_action_runs_total{action="uuid1",path="primary"} 1`)
+	require.Contains(t, string(body), `dmh_action_runs_total{action="uuid1",path="fallback"} 2`)
+}
+
+func TestRecordActionSuppressed(t *testing.T) {
+	opts := &Options{State: nil, Registry: prometheus.NewRegistry()}
+	p := Initialize(opts)
+	p.Stop()
+
+	p.RecordActionSuppressed("uuid1")
+	p.RecordActionSuppressed("uuid1")
+	p.RecordActionSuppressed("uuid2")
+	p.RecordActionCollected("uuid2")
+
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	w := httptest.NewRecorder()
+
+	handler := promhttp.HandlerFor(opts.Registry.(prometheus.Gatherer), promhttp.HandlerOpts{})
+	handler.ServeHTTP(w, req)
+
+	body, err := io.ReadAll(w.Result().Body)
+	require.Nil(t, err)
+	require.Contains(t, string(body), `dmh_action_suppressed_total{action="uuid1"} 2`)
+	require.NotContains(t, string(body), `dmh_action_suppressed_total{action="uuid2"}`)
+}
+
+func TestRecordVaultDecryptUnreachable(t *testing.T) {
+	opts := &Options{State: nil, Registry: prometheus.NewRegistry()}
+	p := Initialize(opts)
+	p.Stop()
+
+	p.RecordVaultDecryptUnreachable("uuid1")
+	p.RecordVaultDecryptUnreachable("uuid1")
+	p.RecordVaultDecryptUnreachable("uuid2")
+	p.RecordActionCollected("uuid2")
+
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	w := httptest.NewRecorder()
+
+	handler := promhttp.HandlerFor(opts.Registry.(prometheus.Gatherer), promhttp.HandlerOpts{})
+	handler.ServeHTTP(w, req)
+
+	body, err := io.ReadAll(w.Result().Body)
+	require.Nil(t, err)
+	require.Contains(t, string(body), `dmh_vault_decrypt_unreachable_total{action="uuid1"} 2`)
+	require.NotContains(t, string(body), `dmh_vault_decrypt_unreachable_total{action="uuid2"}`)
+}
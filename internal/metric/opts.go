@@ -1,13 +1,36 @@
 package metric
 
 import (
+	"time"
+
 	"dmh/internal/state"
+	"dmh/internal/vault"
 
 	"github.com/prometheus/client_golang/prometheus"
 )
 
+// VaultClients describes vault clients, it is implemented by vault.VaultInterface.
+type VaultClients interface {
+	ClientStatuses() []vault.ClientStatus
+}
+
 type Options struct {
 	State      state.StateInterface
 	Registry   prometheus.Registerer
 	VaultToken string
+	// Vault enables dmh_vault_client_* metrics, nil when vault component is disabled.
+	Vault VaultClients
+	// CommentLabel adds comment label to dmh_actions_by_kind, comment is truncated to maxCommentLabel.
+	CommentLabel bool
+	// SlowProbeTimeout bounds single vault secret probe of slow collector, defaultSlowProbeTimeout when 0.
+	SlowProbeTimeout time.Duration
+	// SlowProbeConcurrency is number of vault secrets probed in parallel, defaultSlowProbeConcurrency when 0.
+	SlowProbeConcurrency int
+	// Jitter is max random delay before every collection, it is capped by collection interval. 0 disables it.
+	Jitter time.Duration
+	// SlowProbeStagger is max random delay before every vault secret probe, so probes don't hit vault at once. 0 disables it.
+	SlowProbeStagger time.Duration
+	// EmptyWarnAfter is time after which DMH without pending actions (or vault without secrets) is reported
+	// by dmh_no_actions and dmh_vault_empty and logged. 0 disables it.
+	EmptyWarnAfter time.Duration
 }
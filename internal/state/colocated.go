@@ -0,0 +1,86 @@
+package state
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+
+	"dmh/internal/vault"
+)
+
+// vaultSecretUUIDs returns client and secret uuid from vault secret url (.../api/vault/store/<client>/<secret>).
+func vaultSecretUUIDs(vaultURL string) (string, string, error) {
+	u, err := url.Parse(vaultURL)
+	if err != nil {
+		return "", "", err
+	}
+	clientPath, secretUUID := path.Split(path.Clean(u.Path))
+	clientUUID := path.Base(clientPath)
+	if secretUUID == "" || clientUUID == "" || clientUUID == "/" || clientUUID == "." {
+		return "", "", fmt.Errorf("unable to find client and secret uuid in vault url %s", vaultURL)
+	}
+	return clientUUID, secretUUID, nil
+}
+
+// colocatedVault returns true when secret at vaultURL is stored in colocated vault.
+// Actions with vault_url override keep using their remote vault.
+func (s *State) colocatedVault(vaultURL string) bool {
+	if s.vault == nil {
+		return false
+	}
+	storeURL, err := url.JoinPath(s.vaultURL, "api", "vault", "store")
+	return err == nil && strings.HasPrefix(vaultURL, storeURL+"/")
+}
+
+// getColocatedVaultKey fetches released private key of action u from colocated vault.
+// Key never leaves the process, so it is not wrapped even with wrapResponse.
+func (s *State) getColocatedVaultKey(u string, vaultURL string) (string, error) {
+	clientUUID, secretUUID, err := vaultSecretUUIDs(vaultURL)
+	if err != nil {
+		return "", err
+	}
+	secret, err := s.vault.GetSecret(clientUUID, secretUUID)
+	if errors.Is(err, vault.ErrSecretNotReleased) {
+		return "", fmt.Errorf("%w: %s", ErrKeyNotReleased, u)
+	}
+	if err != nil {
+		return "", fmt.Errorf("unable to get vault data: %w", err)
+	}
+	return secret.Key, nil
+}
+
+// deleteColocatedVaultSecret deletes (or with revoke=true query revokes) secret from colocated vault.
+// Like with remote vault, secret which no longer exist is considered deleted.
+func (s *State) deleteColocatedVaultSecret(vaultURL string) error {
+	clientUUID, secretUUID, err := vaultSecretUUIDs(vaultURL)
+	if err != nil {
+		return err
+	}
+	deleteSecret := s.vault.DeleteSecret
+	if u, _ := url.Parse(vaultURL); u.Query().Get("revoke") == "true" {
+		deleteSecret = s.vault.RevokeSecret
+	}
+	err = deleteSecret(clientUUID, secretUUID)
+	if errors.Is(err, vault.ErrSecretNotReleased) {
+		return fmt.Errorf("unable to delete vault data: %w", err)
+	}
+	return nil
+}
+
+// verifyColocatedVaultKey checks that colocated vault knows about single action key.
+func (s *State) verifyColocatedVaultKey(a *EncryptedAction) error {
+	clientUUID, secretUUID, err := vaultSecretUUIDs(a.EncryptionMeta.VaultURL)
+	if err != nil {
+		return err
+	}
+	meta, err := s.vault.GetSecretMeta(clientUUID, secretUUID)
+	if err != nil {
+		return fmt.Errorf("unable to find vault data: %w", err)
+	}
+	if meta.ProcessAfter != a.ProcessAfter {
+		return fmt.Errorf("%w: vault %d, action %d", ErrProcessAfterMismatch, meta.ProcessAfter, a.ProcessAfter)
+	}
+	return nil
+}
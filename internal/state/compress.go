@@ -0,0 +1,37 @@
+package state
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+)
+
+// compressData returns gzipped data and true, or data unchanged and false when gzip does not make it smaller.
+func compressData(data string) (string, bool, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := io.WriteString(w, data); err != nil {
+		return "", false, err
+	}
+	if err := w.Close(); err != nil {
+		return "", false, err
+	}
+	if buf.Len() >= len(data) {
+		return data, false, nil
+	}
+	return buf.String(), true, nil
+}
+
+// decompressData reverses compressData.
+func decompressData(data string) (string, error) {
+	r, err := gzip.NewReader(bytes.NewReader([]byte(data)))
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	plain, err := io.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+	return string(plain), nil
+}
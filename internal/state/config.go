@@ -4,9 +4,22 @@ import (
 	"fmt"
 	"log"
 	"net/url"
+	"slices"
 	"strings"
+
+	"dmh/internal/crypt"
+	"dmh/internal/vault"
 )
 
+// defaultBackupKeep is used when state.backup_dir is set without state.backup_keep.
+const defaultBackupKeep = 10
+
+// minRecipientHashSalt is minimal length of state.recipient_hash_salt.
+const minRecipientHashSalt = 16
+
+// minSignKey is minimal length of state.sign.key.
+const minSignKey = 16
+
 // Validate checks state (dmh) component configuration.
 func (o *Options) Validate() error {
 	if o.SavePath == "" {
@@ -21,8 +34,73 @@ func (o *Options) Validate() error {
 	if _, err := url.ParseRequestURI(o.VaultURL); err != nil {
 		return fmt.Errorf("remote_vault.url must be a valid HTTP URL")
 	}
+	for _, u := range o.AdditionalVaultURLs {
+		if !validCallbackURL(u) {
+			return fmt.Errorf("remote_vault.additional_urls must contain only http or https URLs")
+		}
+	}
+	if (o.SSHRecipient != "" || o.SSHKeyFile != "") && (o.AgePluginRecipient != "" || o.AgePluginIdentity != "") {
+		return fmt.Errorf("state.ssh and state.age_plugin are mutually exclusive")
+	}
+	if o.SSHRecipient != "" || o.SSHKeyFile != "" {
+		if _, err := o.sshAge(); err != nil {
+			return err
+		}
+	}
+	if o.BackupKeep < 0 {
+		return fmt.Errorf("state.backup_keep should be greater or equal 0")
+	}
+	switch o.OnCorrupt {
+	case "", OnCorruptFail, OnCorruptBackupAndReset:
+	case OnCorruptUseBackup:
+		if o.BackupDir == "" {
+			return fmt.Errorf("state.on_corrupt %s requires state.backup_dir", OnCorruptUseBackup)
+		}
+	default:
+		return fmt.Errorf("state.on_corrupt should be %s, %s or %s", OnCorruptFail, OnCorruptBackupAndReset, OnCorruptUseBackup)
+	}
+	if o.MaxActions < 0 {
+		return fmt.Errorf("state.max_actions should be greater or equal 0")
+	}
+	if o.OverflowPolicy != "" && o.OverflowPolicy != vault.OverflowStrict && o.OverflowPolicy != vault.OverflowEvict {
+		return fmt.Errorf("state.overflow_policy should be %s or %s", vault.OverflowStrict, vault.OverflowEvict)
+	}
+	if o.RecipientHashSalt != "" && len(o.RecipientHashSalt) < minRecipientHashSalt {
+		return fmt.Errorf("state.recipient_hash_salt should have at least %d characters", minRecipientHashSalt)
+	}
+	if o.SignKey != "" && len(o.SignKey) < minSignKey {
+		return fmt.Errorf("state.sign.key should have at least %d characters", minSignKey)
+	}
+	if o.SignAllowUnsigned && o.SignKey == "" {
+		return fmt.Errorf("state.sign.allow_unsigned requires state.sign.key")
+	}
+	for i, source := range o.RequiredSources {
+		if source == "" {
+			return fmt.Errorf("alive.required_sources must not contain empty source")
+		}
+		if slices.Contains(o.RequiredSources[:i], source) {
+			return fmt.Errorf("alive.required_sources contains duplicated source %s", source)
+		}
+	}
 	if strings.HasPrefix(strings.ToLower(o.VaultURL), "http://") {
 		log.Printf("remote_vault.url uses plain http, check https://github.com/bkupidura/dead-man-hand/wiki/Security#use-tls-for-every-connection-strongly-recommended")
 	}
 	return nil
 }
+
+// sshAge returns age created from state.ssh.recipient and state.ssh.key_file.
+func (o *Options) sshAge() (crypt.SSHAgeInterface, error) {
+	var key []byte
+	if o.SSHKeyFile != "" {
+		var err error
+		key, err = crypt.ReadSSHKeyFile(o.SSHKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read state.ssh.key_file: %w", err)
+		}
+	}
+	c, err := crypt.NewSSHAge(o.SSHRecipient, key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid state.ssh config: %w", err)
+	}
+	return c, nil
+}
@@ -1,12 +1,16 @@
 package state
 
 import (
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/require"
 )
 
 func TestOptionsValidate(t *testing.T) {
+	sshKeyFile, sshRecipient := writeTestSSHKey(t, t.TempDir())
+	_, otherSSHRecipient := writeTestSSHKey(t, t.TempDir())
+	missingSSHKeyFile := filepath.Join(t.TempDir(), "missing")
 	tests := []struct {
 		inputOptions  *Options
 		expectedError string
@@ -47,6 +51,176 @@ func TestOptionsValidate(t *testing.T) {
 			},
 			expectedError: "remote_vault.url must be a valid HTTP URL",
 		},
+		{
+			inputOptions: &Options{
+				SavePath:            "state.json",
+				VaultURL:            "http://127.0.0.1:8080",
+				VaultClientUUID:     "client-uuid",
+				AdditionalVaultURLs: []string{"https://vault.example.com", "vault.example.com"},
+			},
+			expectedError: "remote_vault.additional_urls must contain only http or https URLs",
+		},
+		{
+			inputOptions: &Options{
+				SavePath:        "state.json",
+				VaultURL:        "http://127.0.0.1:8080",
+				VaultClientUUID: "client-uuid",
+				BackupDir:       "backup",
+				BackupKeep:      -1,
+			},
+			expectedError: "state.backup_keep should be greater or equal 0",
+		},
+		{
+			inputOptions: &Options{
+				SavePath:        "state.json",
+				VaultURL:        "http://127.0.0.1:8080",
+				VaultClientUUID: "client-uuid",
+				MaxActions:      -1,
+			},
+			expectedError: "state.max_actions should be greater or equal 0",
+		},
+		{
+			inputOptions: &Options{
+				SavePath:        "state.json",
+				VaultURL:        "http://127.0.0.1:8080",
+				VaultClientUUID: "client-uuid",
+				OverflowPolicy:  "lru",
+			},
+			expectedError: "state.overflow_policy should be strict or evict",
+		},
+		{
+			inputOptions: &Options{
+				SavePath:        "state.json",
+				VaultURL:        "http://127.0.0.1:8080",
+				VaultClientUUID: "client-uuid",
+				OnCorrupt:       "ignore",
+			},
+			expectedError: "state.on_corrupt should be fail, backup_and_reset or use_backup",
+		},
+		{
+			inputOptions: &Options{
+				SavePath:        "state.json",
+				VaultURL:        "http://127.0.0.1:8080",
+				VaultClientUUID: "client-uuid",
+				OnCorrupt:       OnCorruptUseBackup,
+			},
+			expectedError: "state.on_corrupt use_backup requires state.backup_dir",
+		},
+		{
+			inputOptions: &Options{
+				SavePath:        "state.json",
+				VaultURL:        "http://127.0.0.1:8080",
+				VaultClientUUID: "client-uuid",
+				OnCorrupt:       OnCorruptBackupAndReset,
+			},
+		},
+		{
+			inputOptions: &Options{
+				SavePath:        "state.json",
+				VaultURL:        "http://127.0.0.1:8080",
+				VaultClientUUID: "client-uuid",
+				RequiredSources: []string{"alice", "bob"},
+			},
+		},
+		{
+			inputOptions: &Options{
+				SavePath:        "state.json",
+				VaultURL:        "http://127.0.0.1:8080",
+				VaultClientUUID: "client-uuid",
+				RequiredSources: []string{"alice", ""},
+			},
+			expectedError: "alive.required_sources must not contain empty source",
+		},
+		{
+			inputOptions: &Options{
+				SavePath:        "state.json",
+				VaultURL:        "http://127.0.0.1:8080",
+				VaultClientUUID: "client-uuid",
+				RequiredSources: []string{"alice", "bob", "alice"},
+			},
+			expectedError: "alive.required_sources contains duplicated source alice",
+		},
+		{
+			inputOptions: &Options{
+				SavePath:        "state.json",
+				VaultURL:        "http://127.0.0.1:8080",
+				VaultClientUUID: "client-uuid",
+				SSHRecipient:    sshRecipient,
+			},
+		},
+		{
+			inputOptions: &Options{
+				SavePath:        "state.json",
+				VaultURL:        "http://127.0.0.1:8080",
+				VaultClientUUID: "client-uuid",
+				SSHRecipient:    sshRecipient,
+				SSHKeyFile:      sshKeyFile,
+			},
+		},
+		{
+			inputOptions: &Options{
+				SavePath:        "state.json",
+				VaultURL:        "http://127.0.0.1:8080",
+				VaultClientUUID: "client-uuid",
+				SSHRecipient:    otherSSHRecipient,
+				SSHKeyFile:      sshKeyFile,
+			},
+			expectedError: "invalid state.ssh config: ssh recipient does not match ssh identity",
+		},
+		{
+			inputOptions: &Options{
+				SavePath:        "state.json",
+				VaultURL:        "http://127.0.0.1:8080",
+				VaultClientUUID: "client-uuid",
+				SSHKeyFile:      missingSSHKeyFile,
+			},
+			expectedError: "unable to read state.ssh.key_file: stat " + missingSSHKeyFile + ": no such file or directory",
+		},
+		{
+			inputOptions: &Options{
+				SavePath:           "state.json",
+				VaultURL:           "http://127.0.0.1:8080",
+				VaultClientUUID:    "client-uuid",
+				SSHRecipient:       sshRecipient,
+				AgePluginRecipient: "age1yubikey1test",
+			},
+			expectedError: "state.ssh and state.age_plugin are mutually exclusive",
+		},
+		{
+			inputOptions: &Options{
+				SavePath:          "state.json",
+				VaultURL:          "http://127.0.0.1:8080",
+				VaultClientUUID:   "client-uuid",
+				RecipientHashSalt: "short",
+			},
+			expectedError: "state.recipient_hash_salt should have at least 16 characters",
+		},
+		{
+			inputOptions: &Options{
+				SavePath:          "state.json",
+				VaultURL:          "http://127.0.0.1:8080",
+				VaultClientUUID:   "client-uuid",
+				RecipientHashSalt: "0123456789abcdef",
+			},
+		},
+		{
+			inputOptions: &Options{
+				SavePath:        "state.json",
+				VaultURL:        "http://127.0.0.1:8080",
+				VaultClientUUID: "client-uuid",
+				SignKey:         "short",
+			},
+			expectedError: "state.sign.key should have at least 16 characters",
+		},
+		{
+			inputOptions: &Options{
+				SavePath:          "state.json",
+				VaultURL:          "http://127.0.0.1:8080",
+				VaultClientUUID:   "client-uuid",
+				SignAllowUnsigned: true,
+			},
+			expectedError: "state.sign.allow_unsigned requires state.sign.key",
+		},
 	}
 	for _, test := range tests {
 		err := test.inputOptions.Validate()
@@ -58,3 +232,9 @@ func TestOptionsValidate(t *testing.T) {
 		}
 	}
 }
+
+func TestOptionsValidateBackupKeepUnchanged(t *testing.T) {
+	o := &Options{SavePath: "state.json", VaultURL: "http://127.0.0.1:8080", VaultClientUUID: "client-uuid", BackupDir: "backup"}
+	require.Nil(t, o.Validate())
+	require.Equal(t, 0, o.BackupKeep)
+}
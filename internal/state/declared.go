@@ -0,0 +1,48 @@
+package state
+
+import (
+	"fmt"
+	"log"
+)
+
+// Reconcile adds declared actions (e.g. from actions config section) which are not present in State yet.
+// Actions are matched by DeclaredID, existing action is left untouched even when its declaration changed
+// or it was already fired. Actions which are no longer declared are not deleted.
+func (s *State) Reconcile(declared []*Action) error {
+	seen := map[string]bool{}
+	for _, a := range declared {
+		if a.DeclaredID == "" {
+			return fmt.Errorf("declared action must have id")
+		}
+		if seen[a.DeclaredID] {
+			return fmt.Errorf("declared action id %s is not unique", a.DeclaredID)
+		}
+		seen[a.DeclaredID] = true
+	}
+
+	for _, a := range declared {
+		s.mtx.RLock()
+		exists := s.declaredExists(a.DeclaredID)
+		s.mtx.RUnlock()
+		if exists {
+			continue
+		}
+		actionUUID, err := s.AddAction(a)
+		if err != nil {
+			return fmt.Errorf("unable to add declared action %s: %w", a.DeclaredID, err)
+		}
+		log.Printf("declared action %s added as %s", a.DeclaredID, actionUUID)
+	}
+	return nil
+}
+
+// declaredExists returns true when action with declaredID is stored in State.
+// Caller must hold State lock.
+func (s *State) declaredExists(declaredID string) bool {
+	for _, a := range s.data.Actions {
+		if a.DeclaredID == declaredID {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,54 @@
+package state
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReconcile(t *testing.T) {
+	vaultPosts := 0
+	fakeServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		vaultPosts++
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer fakeServer.Close()
+
+	s := &State{
+		data: &data{
+			LastSeen: time.Now(),
+			Actions: []*EncryptedAction{
+				{UUID: "existing", Action: Action{Kind: "mail", ProcessAfter: 10, DeclaredID: "family"}, Processed: 2},
+				{UUID: "manual", Action: Action{Kind: "mail", ProcessAfter: 10}},
+			},
+		},
+		vaultURL:        fakeServer.URL,
+		vaultClientUUID: "client-random-uuid",
+		savePath:        filepath.Join(t.TempDir(), "state.json"),
+	}
+
+	declared := []*Action{
+		{DeclaredID: "family", Kind: "mail", ProcessAfter: 24, Data: "changed"},
+		{DeclaredID: "wipe", Kind: "json_post", ProcessAfter: 96, Data: "test", Severity: SeverityDestructive},
+	}
+	require.Nil(t, s.Reconcile(declared))
+	require.Len(t, s.data.Actions, 3)
+	require.Equal(t, 1, vaultPosts)
+	require.Equal(t, 10, s.data.Actions[0].ProcessAfter)
+	require.Equal(t, "wipe", s.data.Actions[2].DeclaredID)
+	require.Equal(t, SeverityDestructive, s.data.Actions[2].Severity)
+
+	// second reconcile (e.g. restart) does not add anything
+	require.Nil(t, s.Reconcile(declared))
+	require.Len(t, s.data.Actions, 3)
+	require.Equal(t, 1, vaultPosts)
+
+	require.EqualError(t, s.Reconcile([]*Action{{Kind: "mail", ProcessAfter: 1, Data: "test"}}), "declared action must have id")
+	require.EqualError(t, s.Reconcile([]*Action{{DeclaredID: "a"}, {DeclaredID: "a"}}), "declared action id a is not unique")
+	require.ErrorContains(t, s.Reconcile([]*Action{{DeclaredID: "invalid", Kind: "mail", Data: "test"}}), "unable to add declared action invalid: process_after should be greater than 0")
+	require.Len(t, s.data.Actions, 3)
+}
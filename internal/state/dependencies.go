@@ -0,0 +1,89 @@
+package state
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrDependencyNotFound is returned when action depends on action which does not exist.
+var ErrDependencyNotFound = errors.New("dependency not found")
+
+// ErrDependencyCycle is returned when action dependencies depend on each other.
+var ErrDependencyCycle = errors.New("dependency cycle")
+
+// ValidateDependencies checks that every action from dependsOn exists in actions, can be fully processed
+// and that dependencies reachable from dependsOn don't form a cycle, so dependent action can run one day.
+func ValidateDependencies(actions []*EncryptedAction, dependsOn []string) error {
+	byUUID := make(map[string]*EncryptedAction, len(actions))
+	for _, a := range actions {
+		byUUID[a.UUID] = a
+	}
+
+	for _, u := range dependsOn {
+		dependency, ok := byUUID[u]
+		if !ok {
+			return fmt.Errorf("%w: %s", ErrDependencyNotFound, u)
+		}
+		if dependency.MinInterval > 0 {
+			return fmt.Errorf("dependency %s runs repeatedly, it is never fully processed", u)
+		}
+	}
+
+	// visiting holds actions on current DFS path, visited actions which are known to be acyclic.
+	visiting := map[string]bool{}
+	visited := map[string]bool{}
+	var visit func(string) error
+	visit = func(u string) error {
+		if visited[u] {
+			return nil
+		}
+		if visiting[u] {
+			return fmt.Errorf("%w: %s", ErrDependencyCycle, u)
+		}
+		a, ok := byUUID[u]
+		if !ok {
+			return nil
+		}
+		visiting[u] = true
+		for _, dependency := range a.DependsOn {
+			if err := visit(dependency); err != nil {
+				return err
+			}
+		}
+		visiting[u] = false
+		visited[u] = true
+		return nil
+	}
+	for _, u := range dependsOn {
+		if err := visit(u); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DependenciesReady returns true when all dependencies of action are fully processed (Processed == 2)
+// and DependsDelay passed since latest of their runs. Action without dependencies is always ready.
+// Missing dependency (e.g. deleted) is never ready.
+func (a *EncryptedAction) DependenciesReady(actions []*EncryptedAction, defaultUnit time.Duration, now time.Time) bool {
+	if len(a.DependsOn) == 0 {
+		return true
+	}
+	byUUID := make(map[string]*EncryptedAction, len(actions))
+	for _, action := range actions {
+		byUUID[action.UUID] = action
+	}
+
+	var lastRun time.Time
+	for _, u := range a.DependsOn {
+		dependency, ok := byUUID[u]
+		if !ok || dependency.Processed != 2 {
+			return false
+		}
+		if dependency.LastRun.After(lastRun) {
+			lastRun = dependency.LastRun
+		}
+	}
+	return !now.Before(lastRun.Add(time.Duration(a.DependsDelay) * a.Unit(defaultUnit)))
+}
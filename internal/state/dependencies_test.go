@@ -0,0 +1,68 @@
+package state
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateDependencies(t *testing.T) {
+	actions := []*EncryptedAction{
+		{UUID: "a"},
+		{UUID: "b", Action: Action{DependsOn: []string{"a"}}},
+		{UUID: "recurring", Action: Action{MinInterval: 1}},
+		{UUID: "cycle1", Action: Action{DependsOn: []string{"cycle2"}}},
+		{UUID: "cycle2", Action: Action{DependsOn: []string{"b", "cycle1"}}},
+		{UUID: "orphan", Action: Action{DependsOn: []string{"deleted"}}},
+	}
+	tests := []struct {
+		inputDependsOn []string
+		expectedError  error
+		expectedString string
+	}{
+		{},
+		{inputDependsOn: []string{"a", "b"}},
+		{inputDependsOn: []string{"orphan"}},
+		{inputDependsOn: []string{"missing"}, expectedError: ErrDependencyNotFound, expectedString: "dependency not found: missing"},
+		{inputDependsOn: []string{"recurring"}, expectedString: "dependency recurring runs repeatedly, it is never fully processed"},
+		{inputDependsOn: []string{"a", "cycle2"}, expectedError: ErrDependencyCycle, expectedString: "dependency cycle: cycle2"},
+	}
+	for _, test := range tests {
+		err := ValidateDependencies(actions, test.inputDependsOn)
+		if test.expectedString == "" {
+			require.Nil(t, err, test.inputDependsOn)
+			continue
+		}
+		require.EqualError(t, err, test.expectedString)
+		if test.expectedError != nil {
+			require.ErrorIs(t, err, test.expectedError)
+		}
+	}
+}
+
+func TestDependenciesReady(t *testing.T) {
+	now := time.Date(2025, 3, 26, 14, 0, 0, 0, time.UTC)
+	actions := []*EncryptedAction{
+		{UUID: "early", Processed: 2, LastRun: now.Add(-3 * time.Hour)},
+		{UUID: "late", Processed: 2, LastRun: now.Add(-time.Hour)},
+		{UUID: "executed", Processed: 1, LastRun: now.Add(-3 * time.Hour)},
+		{UUID: "waiting"},
+	}
+	tests := []struct {
+		inputAction *EncryptedAction
+		expected    bool
+	}{
+		{inputAction: &EncryptedAction{}, expected: true},
+		{inputAction: &EncryptedAction{Action: Action{DependsOn: []string{"early", "late"}}}, expected: true},
+		{inputAction: &EncryptedAction{Action: Action{DependsOn: []string{"early"}, DependsDelay: 2}}, expected: true},
+		{inputAction: &EncryptedAction{Action: Action{DependsOn: []string{"early", "late"}, DependsDelay: 2}}, expected: false},
+		{inputAction: &EncryptedAction{Action: Action{DependsOn: []string{"late"}, DependsDelay: 30, ProcessUnit: "minute"}}, expected: true},
+		{inputAction: &EncryptedAction{Action: Action{DependsOn: []string{"executed"}}}, expected: false},
+		{inputAction: &EncryptedAction{Action: Action{DependsOn: []string{"early", "waiting"}}}, expected: false},
+		{inputAction: &EncryptedAction{Action: Action{DependsOn: []string{"deleted"}}}, expected: false},
+	}
+	for _, test := range tests {
+		require.Equal(t, test.expected, test.inputAction.DependenciesReady(actions, time.Hour, now), test.inputAction.DependsOn)
+	}
+}
@@ -0,0 +1,116 @@
+package state
+
+import (
+	"sync"
+	"time"
+)
+
+// eventBufferSize is number of events buffered for single subscriber.
+const eventBufferSize = 32
+
+// Event types published by State.
+const (
+	EventActionAdded     = "action_added"
+	EventActionRun       = "action_run"
+	EventActionProcessed = "action_processed"
+	EventActionDeleted   = "action_deleted"
+	EventActionError     = "action_error"
+	// EventActionPendingConfirm is published when action requiring confirmation became due.
+	EventActionPendingConfirm = "action_pending_confirm"
+	// EventActionConfirmCancelled is published when user check-in or cancel-fire cancelled pending action.
+	EventActionConfirmCancelled = "action_confirm_cancelled"
+	// EventActionVerified is published when recipient verified delivery of action added with verification.
+	EventActionVerified = "action_verified"
+	// EventActionReceived is published when recipient acknowledged delivery of action with receipt token.
+	EventActionReceived = "action_received"
+	// EventActionSuppressed is published when recurring action run was skipped as duplicate delivery.
+	EventActionSuppressed = "action_suppressed"
+	// EventActionPaused is published when action was paused by Panic.
+	EventActionPaused = "action_paused"
+)
+
+// Event describes single change of action lifecycle.
+type Event struct {
+	Type       string    `json:"type"`            // one of Event* types
+	ActionUUID string    `json:"action_uuid"`     // uuid of changed action
+	Processed  int       `json:"processed"`       // action Processed after change
+	Step       string    `json:"step,omitempty"`  // dispatcher step which failed, only for action_error
+	Error      string    `json:"error,omitempty"` // error message, only for action_error
+	Time       time.Time `json:"time"`            // when event happened
+}
+
+// broker fans out events to subscribers.
+// Publishing never blocks, events are dropped for subscribers which do not keep up.
+type broker struct {
+	mtx         sync.Mutex
+	subscribers map[chan *Event]struct{}
+}
+
+// subscribe registers new subscriber.
+// Returned function removes subscriber and closes its channel, it is safe to call it many times.
+func (b *broker) subscribe() (<-chan *Event, func()) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	if b.subscribers == nil {
+		b.subscribers = make(map[chan *Event]struct{})
+	}
+	ch := make(chan *Event, eventBufferSize)
+	b.subscribers[ch] = struct{}{}
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			b.mtx.Lock()
+			defer b.mtx.Unlock()
+			delete(b.subscribers, ch)
+			close(ch)
+		})
+	}
+}
+
+// publish sends event to all subscribers without waiting for them.
+func (b *broker) publish(e *Event) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	for ch := range b.subscribers {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+// Subscribe returns channel with action lifecycle events and function to stop subscription.
+// Slow subscribers lose events instead of blocking State.
+func (s *State) Subscribe() (<-chan *Event, func()) {
+	return s.events.subscribe()
+}
+
+// ReportActionError publishes action_error event for action which failed in dispatcher step.
+func (s *State) ReportActionError(u string, step string, err error) {
+	processed := 0
+	if a, _ := s.GetAction(u); a != nil {
+		processed = a.Processed
+	}
+	s.publish(EventActionError, u, processed, func(e *Event) {
+		e.Step = step
+		e.Error = err.Error()
+	})
+}
+
+// publish builds event and sends it to subscribers.
+// opts can fill optional event fields.
+func (s *State) publish(eventType string, u string, processed int, opts ...func(*Event)) {
+	e := &Event{
+		Type:       eventType,
+		ActionUUID: u,
+		Processed:  processed,
+		Time:       s.now(),
+	}
+	for _, opt := range opts {
+		opt(e)
+	}
+	s.events.publish(e)
+}
@@ -0,0 +1,73 @@
+package state
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEvents(t *testing.T) {
+	mockTime := time.Date(2025, 3, 26, 14, 55, 40, 0, time.UTC)
+	timeNow = func() time.Time { return mockTime }
+	defer func() {
+		timeNow = time.Now
+	}()
+
+	s := &State{
+		savePath: filepath.Join(t.TempDir(), "state.json"),
+		data: &data{
+			Actions: []*EncryptedAction{
+				{UUID: "test1", Processed: 1},
+				{UUID: "test2"},
+				{UUID: "test3"},
+			},
+		},
+	}
+	events, unsubscribe := s.Subscribe()
+
+	require.Nil(t, s.UpdateActionLastRun("test1"))
+	s.ReportActionError("test1", "Run", fmt.Errorf("mockRun error"))
+	s.ReportActionError("missing", "GetActionLastRun", fmt.Errorf("missing action"))
+	require.Nil(t, s.DeleteAction("test1"))
+	s.DeleteAllActions(false)
+
+	expected := []*Event{
+		{Type: EventActionRun, ActionUUID: "test1", Processed: 1, Time: mockTime},
+		{Type: EventActionError, ActionUUID: "test1", Processed: 1, Step: "Run", Error: "mockRun error", Time: mockTime},
+		{Type: EventActionError, ActionUUID: "missing", Step: "GetActionLastRun", Error: "missing action", Time: mockTime},
+		{Type: EventActionDeleted, ActionUUID: "test1", Processed: 1, Time: mockTime},
+		{Type: EventActionDeleted, ActionUUID: "test2", Time: mockTime},
+		{Type: EventActionDeleted, ActionUUID: "test3", Time: mockTime},
+	}
+	for _, e := range expected {
+		require.Equal(t, e, <-events)
+	}
+
+	unsubscribe()
+	unsubscribe()
+	_, ok := <-events
+	require.False(t, ok)
+
+	// publishing without subscribers is no-op
+	s.ReportActionError("test2", "Run", fmt.Errorf("mockRun error"))
+}
+
+func TestEventsSlowSubscriber(t *testing.T) {
+	s := &State{
+		savePath: filepath.Join(t.TempDir(), "state.json"),
+		data:     &data{Actions: []*EncryptedAction{{UUID: "test"}}},
+	}
+	slow, unsubscribeSlow := s.Subscribe()
+	defer unsubscribeSlow()
+	fast, unsubscribeFast := s.Subscribe()
+	defer unsubscribeFast()
+
+	for range eventBufferSize + 10 {
+		require.Nil(t, s.UpdateActionLastRun("test"))
+		<-fast
+	}
+	require.Len(t, slow, eventBufferSize)
+}
@@ -0,0 +1,97 @@
+package state
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+// Results of fired action recorded in fired log.
+const (
+	FiredResultSuccess = "success"
+	FiredResultFailure = "failure"
+)
+
+// ErrFiredLogDisabled is returned by GetFiredLog when state.fired_log_file is not configured.
+var ErrFiredLogDisabled = errors.New("fired log is not enabled")
+
+// FiredEntry is single line of fired log.
+// It is written independently of action lifecycle, so it survives action deletion and garbage collection.
+type FiredEntry struct {
+	UUID    string    `json:"uuid"`
+	Kind    string    `json:"kind"`
+	Comment string    `json:"comment"`
+	FiredAt time.Time `json:"fired_at"`
+	Result  string    `json:"result"` // FiredResultSuccess or FiredResultFailure
+}
+
+// appendFiredLog appends run of action to fired log file, it is no-op when fired log is not enabled.
+// Failure is only logged, action was already delivered (or failed) and its state must be updated anyway.
+func (s *State) appendFiredLog(a *EncryptedAction, firedAt time.Time, result string) {
+	if s.firedLogFile == "" {
+		return
+	}
+	s.firedLogMtx.Lock()
+	defer s.firedLogMtx.Unlock()
+	if err := appendFiredEntry(s.firedLogFile, &FiredEntry{UUID: a.UUID, Kind: a.Kind, Comment: a.Comment, FiredAt: firedAt, Result: result}); err != nil {
+		log.Printf("unable to append action %s to fired log: %s", a.UUID, err)
+	}
+}
+
+// appendFiredEntry writes entry as JSON line and syncs file to disk.
+func appendFiredEntry(path string, entry *FiredEntry) error {
+	line, err := jsonMarshal(entry)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// GetFiredLog returns fired log entries fired after since (zero since returns all), oldest first.
+func (s *State) GetFiredLog(since time.Time) ([]*FiredEntry, error) {
+	if s.firedLogFile == "" {
+		return nil, ErrFiredLogDisabled
+	}
+	s.firedLogMtx.Lock()
+	defer s.firedLogMtx.Unlock()
+
+	entries := []*FiredEntry{}
+	f, err := os.Open(s.firedLogFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return entries, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		entry := &FiredEntry{}
+		if err := json.Unmarshal(scanner.Bytes(), entry); err != nil {
+			return nil, fmt.Errorf("fired log line %d is corrupted: %w", line, err)
+		}
+		if since.IsZero() || entry.FiredAt.After(since) {
+			entries = append(entries, entry)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
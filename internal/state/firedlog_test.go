@@ -0,0 +1,74 @@
+package state
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"dmh/internal/clock"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFiredLog(t *testing.T) {
+	os.Remove("test_state.json")
+	defer os.Remove("test_state.json")
+	start := time.Date(2025, 3, 26, 14, 0, 0, 0, time.UTC)
+	clk := clock.NewFake(start)
+	firedLogFile := filepath.Join(t.TempDir(), "fired.log")
+
+	s := &State{
+		data: &data{
+			Actions: []*EncryptedAction{
+				{UUID: "test", Action: Action{Kind: "mail", Comment: "first"}},
+				{UUID: "test2", Action: Action{Kind: "json_post"}},
+			},
+		},
+		savePath:     "test_state.json",
+		firedLogFile: firedLogFile,
+		clock:        clk,
+	}
+
+	entries, err := s.GetFiredLog(time.Time{})
+	require.Nil(t, err)
+	require.Empty(t, entries)
+
+	require.Nil(t, s.UpdateActionLastRun("test"))
+	clk.Advance(time.Hour)
+	require.Nil(t, s.RecordActionFailure("test2"))
+	require.Nil(t, s.DeleteAction("test"))
+
+	entries, err = s.GetFiredLog(time.Time{})
+	require.Nil(t, err)
+	require.Equal(t, []*FiredEntry{
+		{UUID: "test", Kind: "mail", Comment: "first", FiredAt: start, Result: FiredResultSuccess},
+		{UUID: "test2", Kind: "json_post", FiredAt: start.Add(time.Hour), Result: FiredResultFailure},
+	}, entries)
+
+	entries, err = s.GetFiredLog(start)
+	require.Nil(t, err)
+	require.Equal(t, []*FiredEntry{
+		{UUID: "test2", Kind: "json_post", FiredAt: start.Add(time.Hour), Result: FiredResultFailure},
+	}, entries)
+
+	require.Nil(t, os.WriteFile(firedLogFile, []byte("{broken\n"), 0600))
+	_, err = s.GetFiredLog(time.Time{})
+	require.ErrorContains(t, err, "fired log line 1 is corrupted")
+}
+
+func TestFiredLogDisabled(t *testing.T) {
+	s := &State{data: &data{}}
+	_, err := s.GetFiredLog(time.Time{})
+	require.ErrorIs(t, err, ErrFiredLogDisabled)
+}
+
+func TestNewFiredLogFile(t *testing.T) {
+	dir := t.TempDir()
+	_, err := New(&Options{SavePath: filepath.Join(dir, "state.json"), FiredLogFile: filepath.Join(dir, "missing", "fired.log")})
+	require.ErrorContains(t, err, "fired log file must be writable")
+
+	_, err = New(&Options{SavePath: filepath.Join(dir, "state.json"), FiredLogFile: filepath.Join(dir, "fired.log")})
+	require.Nil(t, err)
+	require.FileExists(t, filepath.Join(dir, "fired.log"))
+}
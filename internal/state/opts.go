@@ -1,8 +1,63 @@
 package state
 
+import (
+	"dmh/internal/clock"
+	"dmh/internal/vault"
+)
+
 type Options struct {
 	VaultURL        string
 	VaultClientUUID string
 	VaultToken      string
 	SavePath        string
+	// AdditionalVaultURLs are remote vaults which action vault_url may point to, any other override is rejected.
+	AdditionalVaultURLs []string
+	// ClearProcessedVaultURL clears EncryptionMeta.VaultURL once action key was deleted from vault.
+	ClearProcessedVaultURL bool
+	// AgePluginRecipient (e.g. age1yubikey1...) additionally encrypts new actions, so hardware token is needed to run them.
+	AgePluginRecipient string
+	// AgePluginIdentity (e.g. AGE-PLUGIN-YUBIKEY-1...) decrypts actions encrypted to AgePluginRecipient.
+	AgePluginIdentity string
+	// SSHRecipient (e.g. ssh-ed25519 AAAA...) additionally encrypts new actions, so SSH private key is needed to run them.
+	SSHRecipient string
+	// SSHKeyFile is SSH private key which decrypts actions encrypted to SSHRecipient.
+	SSHKeyFile string
+	// BackupDir stores timestamped copy of state file on saves changing actions or maintenance, backups are disabled when empty.
+	BackupDir string
+	// BackupKeep is number of newest backups kept in BackupDir, defaultBackupKeep when 0.
+	BackupKeep int
+	// OnCorrupt is OnCorruptFail (default), OnCorruptBackupAndReset or OnCorruptUseBackup, used when state file can't be decoded.
+	OnCorrupt string
+	// WrapResponse asks remote vault to encrypt released keys to ephemeral key, protecting them in transit.
+	WrapResponse bool
+	// RequiredSources are check-in sources which all must be seen, LastSeen is the oldest of them.
+	RequiredSources []string
+	// Pretty writes indented state file (and backups), easier to read by operator. Default is compact JSON.
+	Pretty bool
+	// UniqueComments rejects new action whose non empty comment is already used by action which is not fully processed.
+	UniqueComments bool
+	// MaxActions is max number of actions stored in state, 0 - unlimited.
+	MaxActions int
+	// OverflowPolicy is vault.OverflowStrict (default) or vault.OverflowEvict, used when MaxActions is reached.
+	OverflowPolicy string
+	// FiredLogFile is append-only JSON lines log of every action run, it survives action deletion. Disabled when empty.
+	FiredLogFile string
+	// RecipientHashSalt enables RecipientHash of new actions, it is HMAC key so hash can't be enumerated without it.
+	RecipientHashSalt string
+	// Recipient returns primary recipient (e.g. mail address) of action, it is hashed with RecipientHashSalt.
+	Recipient func(*Action) string
+	// Compress gzips Data of new actions before encryption, when it makes Data smaller.
+	Compress bool
+	// SignKey enables HMAC signature of state file, New refuses state file modified outside of DMH.
+	// It is dedicated key, DMH component has no key of its own (action keys are held by vault,
+	// SSH and age plugin identities are optional and may not expose key material).
+	SignKey string
+	// SignAllowUnsigned accepts state file without signature once and signs it immediately,
+	// it is used when SignKey is enabled for existing state. Otherwise unsigned state is refused.
+	SignAllowUnsigned bool
+	// Vault is vault component running in the same process, it is called directly instead of VaultURL.
+	// VaultURL is still stored in actions, so state can be used with remote vault later.
+	Vault vault.VaultInterface
+	// Clock is source of time, wall clock is used when nil. Tests use clock.FakeClock.
+	Clock clock.Clock
 }
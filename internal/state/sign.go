@@ -0,0 +1,52 @@
+package state
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+)
+
+// ErrSignatureMismatch is returned by New when state file was modified outside of DMH.
+var ErrSignatureMismatch = errors.New("state file signature does not match")
+
+// ErrSignatureMissing is returned by New when state file has no signature and unsigned state is not allowed.
+var ErrSignatureMissing = errors.New("state file is not signed")
+
+// sign returns hex HMAC-SHA256 of state data encoded without its signature.
+// Caller must hold State lock.
+func (s *State) sign() (string, error) {
+	unsigned := *s.data
+	unsigned.Signature = ""
+	encoded, err := jsonMarshal(&unsigned)
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, []byte(s.signKey))
+	mac.Write(encoded)
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// verifySignature checks signature of loaded state data.
+// Removing signature must not bypass the check, so state without signature is refused
+// unless allowUnsigned is set for one-time upgrade of state saved before signing was enabled.
+// It returns true when unsigned state was accepted, caller should sign it right away.
+func (s *State) verifySignature(allowUnsigned bool) (bool, error) {
+	if s.data.Signature == "" {
+		if !allowUnsigned {
+			return false, fmt.Errorf("%w: %s has no signature, when state.sign.key was just enabled set state.sign.allow_unsigned once to sign it", ErrSignatureMissing, s.savePath)
+		}
+		log.Printf("WARNING: state file %s is not signed, signing it now because of state.sign.allow_unsigned, disable it after this start", s.savePath)
+		return true, nil
+	}
+	expected, err := s.sign()
+	if err != nil {
+		return false, err
+	}
+	if !hmac.Equal([]byte(expected), []byte(s.data.Signature)) {
+		return false, fmt.Errorf("%w: %s was modified outside of DMH or state.sign.key changed", ErrSignatureMismatch, s.savePath)
+	}
+	return false, nil
+}
@@ -2,6 +2,10 @@ package state
 
 import (
 	"bytes"
+	"cmp"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -10,10 +14,16 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
+	"dmh/internal/clock"
 	"dmh/internal/crypt"
+	"dmh/internal/useragent"
 	"dmh/internal/vault"
 
 	"github.com/google/renameio/v2"
@@ -22,83 +32,423 @@ import (
 
 const httpClientTimeout = 15 * time.Second
 
+// Connection pool of vault HTTP client. Default transport keeps only 2 idle connections per host,
+// busy dispatcher talking to single vault would open new connection for most requests.
+const (
+	vaultMaxIdleConns        = 32
+	vaultMaxIdleConnsPerHost = 16
+	vaultIdleConnTimeout     = 90 * time.Second
+)
+
+// Action.Priority bounds.
+const (
+	minPriority = -100
+	maxPriority = 100
+)
+
+// Action.Severity values, empty Severity is stored as SeverityNotify.
+const (
+	SeverityNotify      = "notify"      // action only informs someone, e.g. mail to family
+	SeverityDestructive = "destructive" // action changes or destroys something, e.g. wipes server
+)
+
+// Options.OnCorrupt values, empty OnCorrupt behaves like OnCorruptFail.
+const (
+	OnCorruptFail           = "fail"             // refuse to start
+	OnCorruptBackupAndReset = "backup_and_reset" // move state file aside and start with empty state
+	OnCorruptUseBackup      = "use_backup"       // load newest decodable backup from BackupDir
+)
+
 var (
 	// mocks for tests
-	cryptNewAge = crypt.NewAge
-	atomicWrite = func(path string, data []byte, perm os.FileMode) error {
+	cryptNewAge       = crypt.NewAge
+	cryptNewPluginAge = crypt.NewPluginAge
+	atomicWrite       = func(path string, data []byte, perm os.FileMode) error {
 		return renameio.WriteFile(path, data, perm)
 	}
 	logFatalf   = log.Fatalf
 	osChmod     = os.Chmod
+	timeNow     = time.Now
 	jsonMarshal = json.Marshal
-	// httpClient is used for the outbound http connections.
-	httpClient = &http.Client{Timeout: httpClientTimeout}
+	// defaultVaultClient is used by State which was not created by New (e.g. in tests).
+	defaultVaultClient = newVaultClient()
 )
 
 // Action stores user actions.
 // Action is stored only in memory when created via API. It is never saved.
 type Action struct {
-	Kind         string `json:"kind" yaml:"kind"`                   // kind of action to execute (mail, bulksms, json_post)
-	ProcessAfter int    `json:"process_after" yaml:"process_after"` // number of hours (since last seen) before executing action
-	MinInterval  int    `json:"min_interval" yaml:"min_interval"`   // number of hours (since last run) before executing action AGAIN. If this is >0 action will be executed forever, use with caution!
-	Comment      string `json:"comment" yaml:"comment"`             // comment, it will NOT be encrypted
-	Data         string `json:"data" yaml:"data"`                   // json representation of data needed by kind
+	Kind         string     `json:"kind" yaml:"kind"`                             // kind of action to execute (mail, bulksms, json_post or its alias http)
+	ProcessAfter int        `json:"process_after" yaml:"process_after"`           // number of hours (since last seen) before executing action
+	MinInterval  int        `json:"min_interval" yaml:"min_interval"`             // number of hours (since last run) before executing action AGAIN. If this is >0 action will be executed forever (until user is seen again), use with caution!
+	ProcessUnit  string     `json:"process_unit,omitempty" yaml:"process_unit"`   // time unit (second, minute, hour) for ProcessAfter and MinInterval, overrides global action.process_unit
+	Deadline     *time.Time `json:"deadline,omitempty" yaml:"deadline"`           // absolute time after which action runs even if user is still seen
+	NotBefore    *time.Time `json:"not_before,omitempty" yaml:"not_before"`       // absolute time before which action never runs, even if user is not seen
+	Timezone     string     `json:"timezone,omitempty" yaml:"timezone"`           // IANA time zone in which Deadline and NotBefore were provided and are shown, they are stored in UTC
+	Priority     int        `json:"priority,omitempty" yaml:"priority"`           // actions eligible in the same dispatcher tick run from highest priority, equal priorities keep insertion order
+	DependsOn    []string   `json:"depends_on,omitempty" yaml:"depends_on"`       // uuids of actions which must be fully processed before action runs
+	DependsDelay int        `json:"depends_delay,omitempty" yaml:"depends_delay"` // number of hours (since latest dependency run) before executing action
+	DedupeWindow int        `json:"dedupe_window,omitempty" yaml:"dedupe_window"` // number of hours (since last delivery) during which recurring run with identical data is skipped
+	Severity     string     `json:"severity,omitempty" yaml:"severity"`           // SeverityNotify (default) or SeverityDestructive, destructive actions get stricter handling
+	OnSuccess    string     `json:"on_success,omitempty" yaml:"on_success"`       // URL which result is POSTed to after successful run, it will NOT be encrypted
+	OnFailure    string     `json:"on_failure,omitempty" yaml:"on_failure"`       // URL which result is POSTed to after failed run, it will NOT be encrypted
+	DeclaredID   string     `json:"declared_id,omitempty" yaml:"id"`              // stable id of action declared in actions config section, used by Reconcile
+	VaultURL     string     `json:"vault_url,omitempty" yaml:"vault_url"`         // remote vault address overriding remote_vault.url, only used when action is added (see EncryptionMeta.VaultURL)
+	Comment      string     `json:"comment" yaml:"comment"`                       // comment, it will NOT be encrypted
+	Data         string     `json:"data" yaml:"data"`                             // json representation of data needed by kind
+	Fallback     *Fallback  `json:"fallback,omitempty" yaml:"fallback"`           // delivered only when Run of Kind fails, nil disables fallback
+	ReceiptToken string     `json:"-" yaml:"-"`                                   // delivery receipt token embedded in Data, only used when action is added (see EncryptedAction.ReceiptTokenHash)
 }
 
-// Validate checks Action fields.
+// Fallback is secondary delivery of Action, used when primary Kind fails at fire time.
+// Fallback Data is encrypted exactly like Action Data.
+type Fallback struct {
+	Kind string `json:"kind" yaml:"kind"` // kind of fallback action to execute
+	Data string `json:"data" yaml:"data"` // json representation of data needed by fallback kind
+}
+
+// FallbackAction returns Action which delivers fallback, nil when Action has no fallback.
+func (a *Action) FallbackAction() *Action {
+	if a.Fallback == nil {
+		return nil
+	}
+	return &Action{
+		Kind:         a.Fallback.Kind,
+		ProcessAfter: a.ProcessAfter,
+		Comment:      a.Comment,
+		Data:         a.Fallback.Data,
+	}
+}
+
+// validCallbackURL returns true when rawURL is absolute http or https URL.
+func validCallbackURL(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// Destructive returns true when action has SeverityDestructive.
+func (a *Action) Destructive() bool {
+	return a.Severity == SeverityDestructive
+}
+
+// Validate checks Action fields, all problems are returned together in ValidationError.
 // It is shared by all action creation paths (API, CLI flags, CLI file import).
 func (a *Action) Validate() error {
+	var errs ValidationError
 	if a.Data == "" {
-		return fmt.Errorf("data is required")
+		errs.Add(fmt.Errorf("data is required"))
 	}
 	if a.Kind == "" {
-		return fmt.Errorf("kind is required")
+		errs.Add(fmt.Errorf("kind is required"))
 	}
 	if a.ProcessAfter <= 0 {
-		return fmt.Errorf("process_after should be greater than 0")
+		errs.Add(fmt.Errorf("process_after should be greater than 0"))
 	}
 	if a.MinInterval < 0 {
-		return fmt.Errorf("min_interval should be greater or equal 0")
+		errs.Add(fmt.Errorf("min_interval should be greater or equal 0"))
 	}
-	return nil
+	if _, ok := vault.ProcessUnit(a.ProcessUnit); a.ProcessUnit != "" && !ok {
+		errs.Add(fmt.Errorf("process_unit should be one of second, minute, hour"))
+	}
+	if a.Priority < minPriority || a.Priority > maxPriority {
+		errs.Add(fmt.Errorf("priority should be between %d and %d", minPriority, maxPriority))
+	}
+	// Local is time zone of DMH host, not of user.
+	if _, err := time.LoadLocation(a.Timezone); err != nil || a.Timezone == "Local" {
+		errs.Add(fmt.Errorf("timezone should be valid IANA time zone name"))
+	}
+	if a.NotBefore != nil && a.Deadline != nil && !a.NotBefore.Before(*a.Deadline) {
+		errs.Add(fmt.Errorf("not_before should be before deadline"))
+	}
+	if a.DedupeWindow < 0 {
+		errs.Add(fmt.Errorf("dedupe_window should be greater or equal 0"))
+	}
+	if a.DedupeWindow > 0 && a.DedupeWindow <= a.MinInterval {
+		errs.Add(fmt.Errorf("dedupe_window should be greater than min_interval"))
+	}
+	if a.DedupeWindow > 0 && a.MinInterval <= 0 {
+		errs.Add(fmt.Errorf("dedupe_window requires min_interval"))
+	}
+	if a.Severity != "" && a.Severity != SeverityNotify && a.Severity != SeverityDestructive {
+		errs.Add(fmt.Errorf("severity should be one of %s, %s", SeverityNotify, SeverityDestructive))
+	}
+	if a.OnSuccess != "" && !validCallbackURL(a.OnSuccess) {
+		errs.Add(fmt.Errorf("on_success should be http or https URL"))
+	}
+	if a.OnFailure != "" && !validCallbackURL(a.OnFailure) {
+		errs.Add(fmt.Errorf("on_failure should be http or https URL"))
+	}
+	if a.VaultURL != "" && !validCallbackURL(a.VaultURL) {
+		errs.Add(fmt.Errorf("vault_url should be http or https URL"))
+	}
+	if a.DependsDelay < 0 {
+		errs.Add(fmt.Errorf("depends_delay should be greater or equal 0"))
+	}
+	if a.DependsDelay > 0 && len(a.DependsOn) == 0 {
+		errs.Add(fmt.Errorf("depends_delay requires depends_on"))
+	}
+	for i, u := range a.DependsOn {
+		if u == "" {
+			errs.Add(fmt.Errorf("depends_on should not contain empty uuid"))
+			continue
+		}
+		if slices.Contains(a.DependsOn[:i], u) {
+			errs.Add(fmt.Errorf("depends_on contains %s more than once", u))
+		}
+	}
+	if a.Fallback != nil {
+		if a.Fallback.Kind == "" {
+			errs.Add(fmt.Errorf("fallback.kind is required"))
+		}
+		if a.Fallback.Data == "" {
+			errs.Add(fmt.Errorf("fallback.data is required"))
+		}
+	}
+	return errs.Err()
+}
+
+// Unit returns time unit for ProcessAfter and MinInterval.
+// defaultUnit is returned when Action does not override it with ProcessUnit.
+func (a *Action) Unit(defaultUnit time.Duration) time.Duration {
+	if unit, ok := vault.ProcessUnit(a.ProcessUnit); ok {
+		return unit
+	}
+	return defaultUnit
+}
+
+// FireAt returns when action should run for user last seen at lastSeen.
+// It is lastSeen + ProcessAfter, or Deadline when it comes earlier.
+// Action never fires before NotBefore.
+func (a *Action) FireAt(lastSeen time.Time, defaultUnit time.Duration) time.Time {
+	fireAt := lastSeen.Add(time.Duration(a.ProcessAfter) * a.Unit(defaultUnit))
+	if a.Deadline != nil && a.Deadline.Before(fireAt) {
+		fireAt = *a.Deadline
+	}
+	if a.NotBefore != nil && a.NotBefore.After(fireAt) {
+		fireAt = *a.NotBefore
+	}
+	return fireAt
 }
 
 // EncryptionMeta stores encryption metadata.
 type EncryptionMeta struct {
-	Kind     string `json:"kind"`      // kind of encryption
-	VaultURL string `json:"vault_url"` // remote vault url address
+	Kind       string `json:"kind"`                 // kind of encryption
+	VaultURL   string `json:"vault_url"`            // remote vault url address
+	Compressed bool   `json:"compressed,omitempty"` // Data was gzipped before encryption
 }
 
 // EncryptedAction stores encrypted actions.
 // Only those will be saved to disk or exposed with API.
 type EncryptedAction struct {
 	Action
-	UUID           string         `json:"uuid"`       // action random uuid
-	Processed      int            `json:"processed"`  // if action was already processed, 0 - not executed, 1 - executed, 2 - executed && priv key deleted from vault
-	LastRun        time.Time      `json:"last_run"`   // when action was last executed.
-	EncryptionMeta EncryptionMeta `json:"encryption"` // encryption metadata
+	UUID                string         `json:"uuid"`                           // action random uuid
+	Processed           int            `json:"processed"`                      // if action was already processed, 0 - not executed, 1 - executed, 2 - executed && priv key deleted from vault
+	LastRun             time.Time      `json:"last_run"`                       // when action was last executed.
+	PendingSince        *time.Time     `json:"pending_since,omitempty"`        // when action requiring confirmation became due, nil when not pending
+	FireCancelledAt     *time.Time     `json:"fire_cancelled_at,omitempty"`    // when user cancelled pending run of this action, works as check-in for this action only
+	PartialSeenAt       *time.Time     `json:"partial_seen_at,omitempty"`      // when user was seen by partial check-in (see vault.PartialSeenAt), for this action only
+	ConsecutiveFailures int            `json:"consecutive_failures,omitempty"` // number of failed runs since last successful run
+	LastFailure         *time.Time     `json:"last_failure,omitempty"`         // when last failed run happened, nil when action did not fail since last successful run
+	VerifyTokenHash     string         `json:"verify_token_hash,omitempty"`    // sha256 of delivery verification token, action never runs until recipient verifies it
+	LastDeliveredAt     *time.Time     `json:"last_delivered_at,omitempty"`    // when data was last delivered, only with DedupeWindow
+	LastDataHash        string         `json:"last_data_hash,omitempty"`       // DataHash of last delivered data, only with DedupeWindow
+	PausedAt            *time.Time     `json:"paused_at,omitempty"`            // when action was paused by Panic, paused action never runs
+	RecipientHash       string         `json:"recipient_hash,omitempty"`       // HashRecipient of primary recipient, only with state.recipient_hash_salt
+	ReceiptTokenHash    string         `json:"receipt_token_hash,omitempty"`   // sha256 of delivery receipt token, recipient acknowledges delivered data with it
+	ReceivedAt          *time.Time     `json:"received_at,omitempty"`          // when recipient last acknowledged delivery with receipt token
+	EncryptionMeta      EncryptionMeta `json:"encryption"`                     // encryption metadata
+}
+
+// PendingVerification returns true when action recipient did not verify delivery yet.
+func (a *EncryptedAction) PendingVerification() bool {
+	return a.VerifyTokenHash != ""
+}
+
+// Unacknowledged returns true when action with delivery receipt was run, but recipient did not acknowledge it since last run.
+func (a *EncryptedAction) Unacknowledged() bool {
+	if a.ReceiptTokenHash == "" || a.Processed == 0 {
+		return false
+	}
+	return a.ReceivedAt == nil || a.ReceivedAt.Before(a.LastRun)
+}
+
+// HashRecipient returns salted hash of recipient (e.g. mail address or phone number).
+// Recipient is trimmed and lowercased, so the same recipient written differently has the same hash.
+func HashRecipient(salt string, recipient string) string {
+	mac := hmac.New(sha256.New, []byte(salt))
+	mac.Write([]byte(strings.ToLower(strings.TrimSpace(recipient))))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// recipientHash returns RecipientHash of action, empty when recipient hashing is disabled or action has no recipient.
+func (s *State) recipientHash(a *Action) string {
+	if s.recipientHashSalt == "" || s.recipient == nil {
+		return ""
+	}
+	recipient := s.recipient(a)
+	if recipient == "" {
+		return ""
+	}
+	return HashRecipient(s.recipientHashSalt, recipient)
+}
+
+// Paused returns true when action was paused by Panic.
+func (a *EncryptedAction) Paused() bool {
+	return a.PausedAt != nil
+}
+
+// DataHash returns hash of decrypted action data compared by DedupeWindow.
+// Hash is salted with action uuid, so the same data of different actions can't be matched in state file.
+func (a *EncryptedAction) DataHash(data string) string {
+	sum := sha256.Sum256([]byte(a.UUID + "\x00" + data))
+	return hex.EncodeToString(sum[:])
+}
+
+// Duplicate returns true when data with dataHash was already delivered within DedupeWindow before now.
+func (a *EncryptedAction) Duplicate(dataHash string, now time.Time, defaultUnit time.Duration) bool {
+	if a.DedupeWindow <= 0 || a.LastDeliveredAt == nil || a.LastDataHash != dataHash {
+		return false
+	}
+	return now.Before(a.LastDeliveredAt.Add(time.Duration(a.DedupeWindow) * a.Unit(defaultUnit)))
+}
+
+// SeenAt returns when user was last seen from action point of view,
+// latest of global lastSeen, FireCancelledAt and PartialSeenAt.
+func (a *EncryptedAction) SeenAt(lastSeen time.Time) time.Time {
+	seenAt := lastSeen
+	for _, t := range []*time.Time{a.FireCancelledAt, a.PartialSeenAt} {
+		if t != nil && t.After(seenAt) {
+			seenAt = *t
+		}
+	}
+	return seenAt
+}
+
+// NextRun returns when dispatcher will run action if user is not seen since lastSeen.
+// extend is maintenance extension added to ProcessAfter (see Maintenance).
+// False is returned when action will not run anymore, is paused or waits for delivery verification.
+func (a *EncryptedAction) NextRun(lastSeen time.Time, extend time.Duration, defaultUnit time.Duration) (time.Time, bool) {
+	if a.Processed == 2 || (a.Processed == 1 && a.MinInterval <= 0) || a.PendingVerification() || a.Paused() {
+		return time.Time{}, false
+	}
+	next := a.FireAt(a.SeenAt(lastSeen).Add(extend), defaultUnit)
+	if a.MinInterval > 0 {
+		if afterLastRun := a.LastRun.Add(time.Duration(a.MinInterval) * a.Unit(defaultUnit)); afterLastRun.After(next) {
+			next = afterLastRun
+		}
+	}
+	return next, true
+}
+
+// VerifyResult describes outcome of vault key verification for single action.
+type VerifyResult struct {
+	UUID string // action uuid
+	Err  error  // nil when vault knows about action key (released or not)
+}
+
+// PurgeResult describes outcome of deleting all actions.
+type PurgeResult struct {
+	Deleted           int `json:"deleted"`             // number of deleted actions
+	VaultDeleteFailed int `json:"vault_delete_failed"` // number of vault secrets which could not be deleted
+	// VaultNotDeleted lists vault secrets which could not be deleted, they stay in vault until deleted manually.
+	VaultNotDeleted []*NotDeletedSecret `json:"vault_not_deleted,omitempty"`
+}
+
+// NotDeletedSecret is vault secret of deleted action which vault refused to delete.
+type NotDeletedSecret struct {
+	Action   string `json:"action"`    // UUID of deleted action
+	VaultURL string `json:"vault_url"` // vault secret URL
+	Error    string `json:"error"`
+}
+
+// PanicResult describes outcome of Panic.
+type PanicResult struct {
+	Paused            int `json:"paused"`              // number of actions paused by this call
+	VaultDeleted      int `json:"vault_deleted"`       // number of deleted vault secrets, only with purge
+	VaultDeleteFailed int `json:"vault_delete_failed"` // number of vault secrets which could not be deleted, only with purge
+}
+
+// LastSeenMeta stores where user check-in came from.
+type LastSeenMeta struct {
+	IP        string `json:"ip"`         // source address of check-in
+	UserAgent string `json:"user_agent"` // User-Agent of check-in
+}
+
+// Maintenance describes deliberate absence of user, every action fires Extend later than usual.
+// Deadline of action is not extended.
+type Maintenance struct {
+	Extend time.Duration `json:"extend"` // added to ProcessAfter of every action
+	Since  time.Time     `json:"since"`  // when maintenance was enabled
+}
+
+// Duration returns maintenance extension, 0 when maintenance is not enabled (nil).
+func (m *Maintenance) Duration() time.Duration {
+	if m == nil {
+		return 0
+	}
+	return m.Extend
 }
 
 // data stores when user was last seen and encrypted actions.
 // data will be dumped to disk in State.savePath location on every change.
 // data will be loaded from disk on startup.
 type data struct {
-	LastSeen time.Time          `json:"last_seen"` // when user was last seen
-	Actions  []*EncryptedAction `json:"actions"`   // stores all encrypted actions
+	LastSeen     time.Time          `json:"last_seen"`                // when user was last seen
+	LastSeenMeta *LastSeenMeta      `json:"last_seen_meta,omitempty"` // where user was last seen from, nil when not recorded
+	Actions      []*EncryptedAction `json:"actions"`                  // stores all encrypted actions
+	// SourcesLastSeen stores when each check-in source was last seen, used with RequiredSources.
+	SourcesLastSeen map[string]time.Time `json:"sources_last_seen,omitempty"`
+	// Maintenance extends all actions while user is deliberately off-grid, nil when not enabled.
+	Maintenance *Maintenance `json:"maintenance,omitempty"`
+	// Signature is HMAC of state data without Signature, set when state.sign.key is configured.
+	Signature string `json:"signature,omitempty"`
 }
 
 // StateInterface defines interface used by state component.
 type StateInterface interface {
-	UpdateLastSeen()
+	UpdateLastSeen(*LastSeenMeta)
+	UpdatePartialLastSeen(int, time.Duration) int
+	MarkGone()
+	UpdateSourceLastSeen(string, *LastSeenMeta) (bool, error)
+	SourceLastSeenAdvances(string) (bool, error)
 	GetLastSeen() time.Time
+	GetLastSeenMeta() *LastSeenMeta
+	SetMaintenance(time.Duration)
+	ClearMaintenance()
+	GetMaintenance() *Maintenance
 	UpdateActionLastRun(string) error
+	GetFiredLog(time.Time) ([]*FiredEntry, error)
+	RecordActionDelivery(string, string) error
+	SuppressActionRun(string) error
 	GetActionLastRun(string) (time.Time, error)
 	GetActions() []*EncryptedAction
 	GetAction(string) (*EncryptedAction, int)
-	AddAction(*Action) error
+	AddAction(*Action) (string, error)
+	AddUnverifiedAction(*Action, string) (string, error)
+	VerifyAction(string) (string, error)
+	AcknowledgeReceipt(string) (string, error)
 	DeleteAction(string) error
+	DeleteAllActions(bool) *PurgeResult
+	ReorderActions([]string) error
+	Panic(bool) *PanicResult
 	MarkActionAsProcessed(string) error
+	MarkActionPending(string) error
+	RecordActionFailure(string) error
+	CancelActionPending(string) error
 	DecryptAction(string) (*Action, error)
+	VerifyVaultKeys() []VerifyResult
+	GetVaultProcessUnit() (time.Duration, error)
+	Subscribe() (<-chan *Event, func())
+	ReportActionError(string, string, error)
+	Reconcile([]*Action) error
+	SnapshotAt(time.Time) (*Snapshot, error)
+}
+
+// Snapshot is state loaded from backup, see State.SnapshotAt.
+type Snapshot struct {
+	Time        time.Time          // when backup was written
+	LastSeen    time.Time          // when user was last seen at Time
+	Maintenance *Maintenance       // maintenance enabled at Time, nil when not enabled
+	Actions     []*EncryptedAction // actions stored at Time
 }
 
 // State stores internal state.
@@ -109,26 +459,127 @@ type State struct {
 	vaultClientUUID string
 	vaultToken      string
 	savePath        string
+	// additionalVaultURLs are allowed action vault_url overrides.
+	additionalVaultURLs []string
+	// vault is colocated vault called directly instead of HTTP, nil when remote vault is used.
+	vault vault.VaultInterface
+	// clearProcessedVaultURL drops EncryptionMeta.VaultURL of fully processed actions,
+	// ciphertext is kept but nothing probes already deleted vault secret anymore.
+	clearProcessedVaultURL bool
+	// pluginAge is used for actions encrypted to age plugin recipient, nil when not configured.
+	pluginAge crypt.PluginAgeInterface
+	// sshAge is used for actions encrypted to SSH recipient, nil when not configured.
+	sshAge crypt.SSHAgeInterface
+	// backupDir and backupKeep control timestamped state backups written by save.
+	backupDir  string
+	backupKeep int
+	// backupSum is checksum of actions and maintenance in last written backup,
+	// save skips backup when they didn't change (e.g. on check-in).
+	backupSum [sha256.Size]byte
+	// wrapResponse asks vault to encrypt released key to ephemeral identity of DecryptAction.
+	wrapResponse bool
+	// requiredSources must all check in, LastSeen is the oldest of them. Empty means any check-in counts.
+	requiredSources []string
+	// pretty writes indented JSON to state file.
+	pretty bool
+	// uniqueComments rejects new action with comment of action which is not fully processed.
+	uniqueComments bool
+	// maxActions limits number of stored actions, 0 - unlimited.
+	maxActions int
+	// overflowPolicy decides if oldest fully processed action is evicted when maxActions is reached.
+	overflowPolicy string
+	// events fans out action lifecycle events to subscribers (e.g. /api/events).
+	events broker
+	// recipientHashSalt is HMAC key of RecipientHash, RecipientHash is not computed when empty.
+	recipientHashSalt string
+	// recipient returns primary recipient of action which is hashed into RecipientHash.
+	recipient func(*Action) string
+	// firedLogFile is append-only log of action runs, disabled when empty.
+	firedLogFile string
+	firedLogMtx  sync.Mutex
+	// compress gzips Data of new actions before encryption.
+	compress bool
+	// signKey is HMAC key of state file signature, state file is not signed when empty.
+	signKey string
+	// clock is source of time for LastSeen, LastRun and other action timestamps, timeNow is used when nil.
+	clock clock.Clock
+	// httpClient is shared by all remote vault requests, so connections are pooled and kept alive.
+	httpClient *http.Client
+	// lastVaultVersion is version of last secret uploaded to vault.
+	lastVaultVersion int64
 }
 
 // New returns new instance of State.
 // It will load previously saved state if it exists.
 func New(opts *Options) (StateInterface, error) {
+	clk := opts.Clock
+	if clk == nil {
+		clk = clock.New()
+	}
 	state := &State{
 		data: &data{
-			LastSeen: time.Now(),
+			LastSeen: clk.Now(),
 			Actions:  []*EncryptedAction{},
 		},
-		vaultURL:        opts.VaultURL,
-		vaultClientUUID: opts.VaultClientUUID,
-		vaultToken:      opts.VaultToken,
-		savePath:        opts.SavePath,
+		vaultURL:               opts.VaultURL,
+		vaultClientUUID:        opts.VaultClientUUID,
+		vaultToken:             opts.VaultToken,
+		savePath:               opts.SavePath,
+		additionalVaultURLs:    opts.AdditionalVaultURLs,
+		vault:                  opts.Vault,
+		clearProcessedVaultURL: opts.ClearProcessedVaultURL,
+		backupDir:              opts.BackupDir,
+		backupKeep:             cmp.Or(opts.BackupKeep, defaultBackupKeep),
+		wrapResponse:           opts.WrapResponse,
+		requiredSources:        opts.RequiredSources,
+		pretty:                 opts.Pretty,
+		uniqueComments:         opts.UniqueComments,
+		maxActions:             opts.MaxActions,
+		overflowPolicy:         opts.OverflowPolicy,
+		firedLogFile:           opts.FiredLogFile,
+		recipientHashSalt:      opts.RecipientHashSalt,
+		recipient:              opts.Recipient,
+		compress:               opts.Compress,
+		signKey:                opts.SignKey,
+		clock:                  clk,
+		httpClient:             newVaultClient(),
+	}
+
+	if state.backupDir != "" {
+		if err := os.MkdirAll(state.backupDir, 0700); err != nil {
+			return nil, fmt.Errorf("unable to create state backup dir %s: %w", state.backupDir, err)
+		}
+	}
+
+	if state.firedLogFile != "" {
+		f, err := os.OpenFile(state.firedLogFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+		if err != nil {
+			return nil, fmt.Errorf("fired log file must be writable: %w", err)
+		}
+		f.Close()
+	}
+
+	if opts.AgePluginRecipient != "" || opts.AgePluginIdentity != "" {
+		pluginAge, err := cryptNewPluginAge(opts.AgePluginRecipient, opts.AgePluginIdentity)
+		if err != nil {
+			return nil, err
+		}
+		state.pluginAge = pluginAge
+	}
+
+	if opts.SSHRecipient != "" || opts.SSHKeyFile != "" {
+		sshAge, err := opts.sshAge()
+		if err != nil {
+			return nil, err
+		}
+		state.sshAge = sshAge
 	}
 
 	f, err := os.Open(state.savePath)
 	if err != nil {
 		if errors.Is(err, os.ErrNotExist) {
 			log.Printf("state file %s does not exist, creating new state", state.savePath)
+			state.initSourcesLastSeen()
 			return state, nil
 		}
 		return nil, fmt.Errorf("unable to open state file %s: %w", state.savePath, err)
@@ -142,17 +593,245 @@ func New(opts *Options) (StateInterface, error) {
 
 	err = json.NewDecoder(f).Decode(state.data)
 	if err != nil {
-		return nil, err
+		reset, err := state.recoverCorrupt(opts.OnCorrupt, err)
+		if err != nil {
+			return nil, err
+		}
+		if reset {
+			state.initSourcesLastSeen()
+			return state, nil
+		}
+	}
+	if state.signKey != "" {
+		unsigned, err := state.verifySignature(opts.SignAllowUnsigned)
+		if err != nil {
+			return nil, err
+		}
+		if unsigned {
+			state.mtx.Lock()
+			state.save()
+			state.mtx.Unlock()
+		}
 	}
+	state.initSourcesLastSeen()
 	return state, nil
 }
 
+// recoverCorrupt handles state file which can't be decoded according to policy.
+// It returns true when state was reset to empty one.
+func (s *State) recoverCorrupt(policy string, decodeErr error) (bool, error) {
+	decodeErr = fmt.Errorf("unable to decode state file %s: %w", s.savePath, decodeErr)
+	switch policy {
+	case OnCorruptBackupAndReset:
+		corruptPath, err := s.moveCorrupt()
+		if err != nil {
+			return false, err
+		}
+		s.data = &data{LastSeen: s.now(), Actions: []*EncryptedAction{}}
+		// Persist (and sign) empty state, state file was moved aside.
+		s.mtx.Lock()
+		s.save()
+		s.mtx.Unlock()
+		log.Printf("WARNING: %s, moved it to %s and started with empty state, all actions are lost", decodeErr, corruptPath)
+		return true, nil
+	case OnCorruptUseBackup:
+		backups, err := s.backups()
+		if err != nil {
+			return false, fmt.Errorf("%w, unable to list state backups in %s: %w", decodeErr, s.backupDir, err)
+		}
+		for i := len(backups) - 1; i >= 0; i-- {
+			backupPath := filepath.Join(s.backupDir, backups[i])
+			d, err := readStateFile(backupPath)
+			if err != nil {
+				log.Printf("unable to load state backup %s: %s", backupPath, err)
+				continue
+			}
+			corruptPath, err := s.moveCorrupt()
+			if err != nil {
+				return false, err
+			}
+			s.data = d
+			log.Printf("WARNING: %s, moved it to %s and loaded backup %s, changes made after backup are lost", decodeErr, corruptPath, backupPath)
+			return false, nil
+		}
+		return false, fmt.Errorf("%w, no usable backup in %s", decodeErr, s.backupDir)
+	default:
+		return false, decodeErr
+	}
+}
+
+// moveCorrupt renames undecodable state file to <state file>.corrupt.<RFC3339>, so it is kept for inspection.
+func (s *State) moveCorrupt() (string, error) {
+	corruptPath := s.savePath + ".corrupt." + s.now().UTC().Format(time.RFC3339)
+	if err := os.Rename(s.savePath, corruptPath); err != nil {
+		return "", fmt.Errorf("unable to move corrupted state file %s: %w", s.savePath, err)
+	}
+	return corruptPath, nil
+}
+
+// readStateFile decodes state saved in path.
+func readStateFile(path string) (*data, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	d := &data{}
+	if err := json.NewDecoder(f).Decode(d); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// initSourcesLastSeen marks required sources never seen before as seen at LastSeen,
+// so enabling required sources does not run actions immediately.
+func (s *State) initSourcesLastSeen() {
+	for _, source := range s.requiredSources {
+		if s.data.SourcesLastSeen == nil {
+			s.data.SourcesLastSeen = map[string]time.Time{}
+		}
+		if _, ok := s.data.SourcesLastSeen[source]; !ok {
+			s.data.SourcesLastSeen[source] = s.data.LastSeen
+		}
+	}
+}
+
+// now returns current time of State clock.
+func (s *State) now() time.Time {
+	if s.clock == nil {
+		return timeNow()
+	}
+	return s.clock.Now()
+}
+
 // UpdateLastSeen updates when user was last seen.
-func (s *State) UpdateLastSeen() {
+// meta is stored together with LastSeen, nil meta clears previously stored one.
+func (s *State) UpdateLastSeen(meta *LastSeenMeta) {
 	s.mtx.Lock()
 	defer s.mtx.Unlock()
 
-	s.data.LastSeen = time.Now()
+	s.updateLastSeen(s.now(), meta)
+	s.save()
+}
+
+// UpdateSourceLastSeen records check-in of source.
+// Without required sources every check-in updates LastSeen. With required sources,
+// LastSeen is the oldest check-in of required sources and true is returned only when it moved forward.
+func (s *State) UpdateSourceLastSeen(source string, meta *LastSeenMeta) (bool, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if len(s.requiredSources) > 0 && !slices.Contains(s.requiredSources, source) {
+		return false, fmt.Errorf("%w: %s", ErrUnknownSource, source)
+	}
+	now := s.now()
+	if s.data.SourcesLastSeen == nil {
+		s.data.SourcesLastSeen = map[string]time.Time{}
+	}
+	s.data.SourcesLastSeen[source] = now
+
+	lastSeen := s.sourcesLastSeen(source, now)
+	advanced := lastSeen.After(s.data.LastSeen)
+	if advanced {
+		s.updateLastSeen(lastSeen, meta)
+	}
+	s.save()
+	return advanced, nil
+}
+
+// SourceLastSeenAdvances returns true when check-in of source would move LastSeen forward, State is not changed.
+// It lets caller update vault before check-in is recorded.
+func (s *State) SourceLastSeenAdvances(source string) (bool, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	if len(s.requiredSources) > 0 && !slices.Contains(s.requiredSources, source) {
+		return false, fmt.Errorf("%w: %s", ErrUnknownSource, source)
+	}
+	return s.sourcesLastSeen(source, s.now()).After(s.data.LastSeen), nil
+}
+
+// sourcesLastSeen returns LastSeen after check-in of source at now, the oldest check-in of required sources.
+// Caller must hold State lock.
+func (s *State) sourcesLastSeen(source string, now time.Time) time.Time {
+	lastSeen := now
+	for _, required := range s.requiredSources {
+		if required == source {
+			continue
+		}
+		if seen := s.data.SourcesLastSeen[required]; seen.Before(lastSeen) {
+			lastSeen = seen
+		}
+	}
+	return lastSeen
+}
+
+// updateLastSeen sets LastSeen and cancels actions waiting for confirmation.
+// Caller must hold State write lock.
+func (s *State) updateLastSeen(lastSeen time.Time, meta *LastSeenMeta) {
+	s.data.LastSeen = lastSeen
+	s.data.LastSeenMeta = nil
+	if meta != nil {
+		metaCopy := *meta
+		s.data.LastSeenMeta = &metaCopy
+	}
+	// User check-in cancels actions waiting for confirmation.
+	for _, a := range s.data.Actions {
+		if a.PendingSince != nil {
+			a.PendingSince = nil
+			s.publish(EventActionConfirmCancelled, a.UUID, a.Processed)
+		}
+	}
+}
+
+// UpdatePartialLastSeen is partial check-in with percent (1-100), see vault.PartialSeenAt.
+// Every action is moved to percent of its own ProcessAfter from now, but never earlier than it is now.
+// Global LastSeen is not changed, Deadline is not moved. Pending confirmation of moved action is cancelled.
+// Number of moved actions is returned.
+func (s *State) UpdatePartialLastSeen(percent int, defaultUnit time.Duration) int {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	now := s.now()
+	moved := 0
+	for _, a := range s.data.Actions {
+		if a.Processed == 2 || a.Paused() {
+			continue
+		}
+		seenAt := vault.PartialSeenAt(now, time.Duration(a.ProcessAfter)*a.Unit(defaultUnit), percent)
+		if !seenAt.After(a.SeenAt(s.data.LastSeen)) {
+			continue
+		}
+		a.PartialSeenAt = &seenAt
+		moved++
+		if a.PendingSince != nil {
+			a.PendingSince = nil
+			s.publish(EventActionConfirmCancelled, a.UUID, a.Processed)
+		}
+	}
+	s.save()
+	return moved
+}
+
+// goneLastSeen is LastSeen of user marked as gone, far enough in the past to make every action due.
+var goneLastSeen = time.Unix(0, 0).UTC()
+
+// MarkGone moves LastSeen (and last check-in of every source) far into the past and drops check-ins
+// of single actions (FireCancelledAt, PartialSeenAt), so all actions become due on next dispatcher tick.
+// Next check-in (of every required source) brings user back. Actions waiting for confirmation are not cancelled.
+func (s *State) MarkGone() {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	s.data.LastSeen = goneLastSeen
+	s.data.LastSeenMeta = nil
+	for source := range s.data.SourcesLastSeen {
+		s.data.SourcesLastSeen[source] = goneLastSeen
+	}
+	for _, a := range s.data.Actions {
+		a.FireCancelledAt = nil
+		a.PartialSeenAt = nil
+	}
 	s.save()
 }
 
@@ -164,6 +843,53 @@ func (s *State) GetLastSeen() time.Time {
 	return s.data.LastSeen
 }
 
+// SetMaintenance enables maintenance, every action fires extend later until ClearMaintenance.
+// Enabling it again replaces previous extension, it does not add up.
+func (s *State) SetMaintenance(extend time.Duration) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	s.data.Maintenance = &Maintenance{Extend: extend, Since: s.now()}
+	s.save()
+}
+
+// ClearMaintenance disables maintenance, actions fire after ProcessAfter again.
+func (s *State) ClearMaintenance() {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if s.data.Maintenance == nil {
+		return
+	}
+	s.data.Maintenance = nil
+	s.save()
+}
+
+// GetMaintenance returns copy of maintenance, nil when maintenance is not enabled.
+func (s *State) GetMaintenance() *Maintenance {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	if s.data.Maintenance == nil {
+		return nil
+	}
+	maintenance := *s.data.Maintenance
+	return &maintenance
+}
+
+// GetLastSeenMeta returns copy of where user was last seen from.
+// It returns nil when meta was not recorded.
+func (s *State) GetLastSeenMeta() *LastSeenMeta {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	if s.data.LastSeenMeta == nil {
+		return nil
+	}
+	metaCopy := *s.data.LastSeenMeta
+	return &metaCopy
+}
+
 // UpdateActionLastRun updates LastRun for action.
 func (s *State) UpdateActionLastRun(u string) error {
 	s.mtx.Lock()
@@ -173,8 +899,101 @@ func (s *State) UpdateActionLastRun(u string) error {
 	if a == nil {
 		return fmt.Errorf("missing action with uuid %s", u)
 	}
-	a.LastRun = time.Now()
+	a.LastRun = s.now()
+	s.appendFiredLog(a, a.LastRun, FiredResultSuccess)
+	// Every run of action requiring confirmation must be confirmed again.
+	a.PendingSince = nil
+	a.ConsecutiveFailures = 0
+	a.LastFailure = nil
 	s.save()
+	s.publish(EventActionRun, a.UUID, a.Processed)
+	return nil
+}
+
+// RecordActionDelivery stores hash of data delivered by action run, it is used by DedupeWindow.
+func (s *State) RecordActionDelivery(u string, dataHash string) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	a, _ := s.getAction(u)
+	if a == nil {
+		return fmt.Errorf("missing action with uuid %s", u)
+	}
+	now := s.now()
+	a.LastDeliveredAt = &now
+	a.LastDataHash = dataHash
+	s.save()
+	return nil
+}
+
+// SuppressActionRun updates LastRun for action which run was skipped as duplicate delivery.
+// LastDeliveredAt is kept, so DedupeWindow is counted from last real delivery.
+func (s *State) SuppressActionRun(u string) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	a, _ := s.getAction(u)
+	if a == nil {
+		return fmt.Errorf("missing action with uuid %s", u)
+	}
+	a.LastRun = s.now()
+	s.save()
+	s.publish(EventActionSuppressed, a.UUID, a.Processed)
+	return nil
+}
+
+// RecordActionFailure counts failed run of action, counter is reset by UpdateActionLastRun.
+func (s *State) RecordActionFailure(u string) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	a, _ := s.getAction(u)
+	if a == nil {
+		return fmt.Errorf("missing action with uuid %s", u)
+	}
+	now := s.now()
+	a.ConsecutiveFailures++
+	a.LastFailure = &now
+	s.appendFiredLog(a, now, FiredResultFailure)
+	s.save()
+	return nil
+}
+
+// MarkActionPending marks action as waiting for confirmation window to pass.
+// Pending is cancelled by user check-in (UpdateLastSeen).
+func (s *State) MarkActionPending(u string) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	a, _ := s.getAction(u)
+	if a == nil {
+		return fmt.Errorf("missing action with uuid %s", u)
+	}
+	now := s.now()
+	a.PendingSince = &now
+	s.save()
+	s.publish(EventActionPendingConfirm, a.UUID, a.Processed)
+	return nil
+}
+
+// CancelActionPending cancels pending run of single action, other actions are not affected.
+// Action will be due again after ProcessAfter from now, unless user checks in.
+func (s *State) CancelActionPending(u string) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	a, _ := s.getAction(u)
+	if a == nil {
+		return fmt.Errorf("missing action with uuid %s", u)
+	}
+	if a.PendingSince == nil {
+		return fmt.Errorf("%w: %s", ErrActionNotPending, u)
+	}
+	now := s.now()
+	a.PendingSince = nil
+	a.FireCancelledAt = &now
+	s.save()
+	s.publish(EventActionConfirmCancelled, a.UUID, a.Processed)
 	return nil
 }
 
@@ -187,41 +1006,224 @@ func (s *State) GetActionLastRun(u string) (time.Time, error) {
 	if a == nil {
 		return time.Time{}, fmt.Errorf("missing action with uuid %s", u)
 	}
-	return a.LastRun, nil
+	return a.LastRun, nil
+}
+
+// ErrVaultUnreachable is returned when remote vault cant be reached.
+// DecryptAction returns it also when vault responds with server error.
+var ErrVaultUnreachable = errors.New("unable to connect to vault")
+
+// ErrUnknownSource is returned when check-in source is not one of required sources.
+var ErrUnknownSource = errors.New("unknown check-in source")
+
+// ErrActionNotPending is returned when cancelled action is not waiting for confirmation.
+var ErrActionNotPending = errors.New("action is not pending")
+
+// ErrKeyNotReleased is returned by DecryptAction when vault did not release action key yet.
+var ErrKeyNotReleased = errors.New("vault key is not released")
+
+// ErrVerifyTokenNotFound is returned when no action waits for verification with given token.
+var ErrVerifyTokenNotFound = errors.New("verification token not found")
+
+// ErrReceiptTokenNotFound is returned when no action was delivered with given receipt token.
+var ErrReceiptTokenNotFound = errors.New("receipt token not found")
+
+// ErrVaultSecretNotDeleted is returned by DeleteAction when action was deleted, but its vault secret was not.
+var ErrVaultSecretNotDeleted = errors.New("vault secret was not deleted")
+
+// ErrDuplicateComment is returned by AddAction when unique comments are enforced and comment is already used.
+var ErrDuplicateComment = errors.New("action comment already exists")
+
+// ErrVaultURLNotAllowed is returned by AddAction when action vault_url is not listed in remote_vault.additional_urls.
+var ErrVaultURLNotAllowed = errors.New("vault_url is not listed in remote_vault.additional_urls")
+
+// ErrActionLimitReached is returned by AddAction when state.max_actions is reached and no action can be evicted.
+var ErrActionLimitReached = errors.New("action limit reached")
+
+// ErrInvalidOrder is returned by ReorderActions when order is not a permutation of current actions.
+var ErrInvalidOrder = errors.New("order is not a permutation of actions")
+
+// ErrProcessAfterMismatch is returned by VerifyVaultKeys when vault secret process_after differs from action.
+var ErrProcessAfterMismatch = errors.New("vault process_after does not match action")
+
+// ErrSnapshotNotFound is returned by SnapshotAt when no backup was written before requested time.
+var ErrSnapshotNotFound = errors.New("state snapshot not found")
+
+// newVaultClient returns HTTP client of remote vault with pooled keep-alive connections.
+// Every request is bounded by httpClientTimeout and carries DMH User-Agent.
+func newVaultClient() *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConns = vaultMaxIdleConns
+	transport.MaxIdleConnsPerHost = vaultMaxIdleConnsPerHost
+	transport.IdleConnTimeout = vaultIdleConnTimeout
+	return &http.Client{Timeout: httpClientTimeout, Transport: &useragent.Transport{Base: transport}}
+}
+
+// client returns HTTP client of remote vault.
+func (s *State) client() *http.Client {
+	if s.httpClient == nil {
+		return defaultVaultClient
+	}
+	return s.httpClient
+}
+
+// vaultRequest sends HTTP request to remote vault with optional bearer token.
+// modifiers can adjust request (e.g. set headers) before it is sent.
+func (s *State) vaultRequest(method string, url string, body io.Reader, modifiers ...func(*http.Request)) (*http.Response, error) {
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	if s.vaultToken != "" {
+		req.Header.Set("Authorization", "Bearer "+s.vaultToken)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for _, modifier := range modifiers {
+		modifier(req)
+	}
+	resp, err := s.client().Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrVaultUnreachable, err)
+	}
+	return resp, nil
+}
+
+// addVaultSecret uploads secret to vault.
+func (s *State) addVaultSecret(vaultURL string, secret *vault.Secret) error {
+	if s.colocatedVault(vaultURL) {
+		clientUUID, secretUUID, err := vaultSecretUUIDs(vaultURL)
+		if err != nil {
+			return err
+		}
+		if err := s.vault.AddSecret(clientUUID, secretUUID, secret); err != nil {
+			return fmt.Errorf("unable to publish vault data: %w", err)
+		}
+		return nil
+	}
+
+	secretJson, err := jsonMarshal(secret)
+	if err != nil {
+		return err
+	}
+	resp, err := s.vaultRequest(http.MethodPost, vaultURL, bytes.NewBuffer(secretJson))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		return fmt.Errorf("unable to publish vault data, status code %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// AddAction converts Action to EncryptedAction and stores it in State, uuid of stored action is returned.
+// AddAction also uploads private encryption key to remote vault.
+func (s *State) AddAction(a *Action) (string, error) {
+	return s.addAction(a, "")
+}
+
+// AddUnverifiedAction stores Action like AddAction, but action does not run until VerifyAction is called with token.
+// verifyToken is plaintext token sent to action recipient, only its hash is stored.
+func (s *State) AddUnverifiedAction(a *Action, verifyToken string) (string, error) {
+	if verifyToken == "" {
+		return "", fmt.Errorf("verification token must be provided")
+	}
+	return s.addAction(a, tokenHash(verifyToken))
+}
+
+// tokenHash returns hex encoded sha256 of verification or receipt token.
+func tokenHash(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+// VerifyAction marks action waiting for verification with token as verified, from now dispatcher can run it.
+// Token can be used only once, uuid of verified action is returned.
+func (s *State) VerifyAction(token string) (string, error) {
+	hash := tokenHash(token)
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	for _, a := range s.data.Actions {
+		if a.VerifyTokenHash == hash {
+			a.VerifyTokenHash = ""
+			s.save()
+			s.publish(EventActionVerified, a.UUID, a.Processed)
+			return a.UUID, nil
+		}
+	}
+	return "", ErrVerifyTokenNotFound
 }
 
-// vaultRequest sends HTTP request to remote vault with optional bearer token.
-func (s *State) vaultRequest(method string, url string, body io.Reader) (*http.Response, error) {
-	req, err := http.NewRequest(method, url, body)
-	if err != nil {
-		return nil, err
+// AcknowledgeReceipt records that recipient received data of action delivered with receipt token.
+// Token stays valid, so recurring action can be acknowledged after every run, uuid of action is returned.
+func (s *State) AcknowledgeReceipt(token string) (string, error) {
+	if token == "" {
+		return "", ErrReceiptTokenNotFound
 	}
-	if s.vaultToken != "" {
-		req.Header.Set("Authorization", "Bearer "+s.vaultToken)
+	hash := tokenHash(token)
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	for _, a := range s.data.Actions {
+		if a.ReceiptTokenHash == hash {
+			now := s.now()
+			a.ReceivedAt = &now
+			s.save()
+			s.publish(EventActionReceived, a.UUID, a.Processed)
+			return a.UUID, nil
+		}
 	}
-	if body != nil {
-		req.Header.Set("Content-Type", "application/json")
+	return "", ErrReceiptTokenNotFound
+}
+
+// allowedVaultURL returns true when vaultURL is remote_vault.url or one of remote_vault.additional_urls.
+func (s *State) allowedVaultURL(vaultURL string) bool {
+	vaultURL = strings.TrimSuffix(vaultURL, "/")
+	for _, allowed := range append([]string{s.vaultURL}, s.additionalVaultURLs...) {
+		if strings.TrimSuffix(allowed, "/") == vaultURL {
+			return true
+		}
 	}
-	return httpClient.Do(req)
+	return false
 }
 
-// AddAction converts Action to EncryptedAction and stores it in State.
-// AddAction also uploads private encryption key to remote vault.
-func (s *State) AddAction(a *Action) error {
+// addAction converts Action to EncryptedAction and stores it in State.
+// Action with non empty verifyHash waits for verification.
+func (s *State) addAction(a *Action, verifyHash string) (string, error) {
 	if err := a.Validate(); err != nil {
-		return err
+		return "", err
+	}
+	// remote_vault.token is sent to override vault and DMH check-ins must reach it, so only configured vaults are allowed.
+	if a.VaultURL != "" && !s.allowedVaultURL(a.VaultURL) {
+		return "", fmt.Errorf("%w: %s", ErrVaultURLNotAllowed, a.VaultURL)
+	}
+
+	s.mtx.RLock()
+	duplicate := s.duplicateComment(a.Comment)
+	_, overflowErr := s.overflowAction()
+	s.mtx.RUnlock()
+	if duplicate {
+		return "", fmt.Errorf("%w: %s", ErrDuplicateComment, a.Comment)
+	}
+	if overflowErr != nil {
+		return "", overflowErr
 	}
 
 	c, err := cryptNewAge("")
 	if err != nil {
-		return err
+		return "", err
 	}
 
 	encryptedActionUUID := uuid.NewString()
 
-	vaultURL, err := url.JoinPath(s.vaultURL, "api", "vault", "store", s.vaultClientUUID, encryptedActionUUID)
+	vaultURL, err := url.JoinPath(cmp.Or(a.VaultURL, s.vaultURL), "api", "vault", "store", s.vaultClientUUID, encryptedActionUUID)
 	if err != nil {
-		return fmt.Errorf("unable to parse address: %s", err)
+		return "", fmt.Errorf("unable to parse address: %s", err)
 	}
 
 	encrypted := &EncryptedAction{
@@ -229,46 +1231,166 @@ func (s *State) AddAction(a *Action) error {
 			Kind:         a.Kind,
 			ProcessAfter: a.ProcessAfter,
 			MinInterval:  a.MinInterval,
+			ProcessUnit:  a.ProcessUnit,
+			Deadline:     a.Deadline,
+			NotBefore:    a.NotBefore,
+			Timezone:     a.Timezone,
+			Priority:     a.Priority,
+			DependsOn:    a.DependsOn,
+			DependsDelay: a.DependsDelay,
+			DedupeWindow: a.DedupeWindow,
+			Severity:     cmp.Or(a.Severity, SeverityNotify),
+			OnSuccess:    a.OnSuccess,
+			OnFailure:    a.OnFailure,
+			DeclaredID:   a.DeclaredID,
 			Comment:      a.Comment,
 		},
-		UUID:      encryptedActionUUID,
-		Processed: 0,
+		UUID:            encryptedActionUUID,
+		Processed:       0,
+		VerifyTokenHash: verifyHash,
+		RecipientHash:   s.recipientHash(a),
 		EncryptionMeta: EncryptionMeta{
 			Kind:     crypt.EncryptionKind,
 			VaultURL: vaultURL,
 		},
 	}
+	if a.ReceiptToken != "" {
+		encrypted.ReceiptTokenHash = tokenHash(a.ReceiptToken)
+	}
+
+	// encrypt encrypts Data and Fallback Data with the same key, so released key decrypts both.
+	encrypt := func(data string) (string, error) {
+		if s.pluginAge != nil {
+			var err error
+			data, err = s.pluginAge.Encrypt(data)
+			if err != nil {
+				return "", err
+			}
+		}
+		if s.sshAge != nil {
+			var err error
+			data, err = s.sshAge.Encrypt(data)
+			if err != nil {
+				return "", err
+			}
+		}
+		return c.Encrypt(data)
+	}
+	if s.pluginAge != nil {
+		encrypted.EncryptionMeta.Kind = crypt.PluginEncryptionKind
+	}
+	if s.sshAge != nil {
+		encrypted.EncryptionMeta.Kind = crypt.EncryptionKind + "+" + s.sshAge.Kind()
+	}
 
-	dataEncrypted, err := c.Encrypt(a.Data)
+	data := a.Data
+	if s.compress {
+		data, encrypted.EncryptionMeta.Compressed, err = compressData(data)
+		if err != nil {
+			return "", err
+		}
+	}
+	encrypted.Action.Data, err = encrypt(data)
 	if err != nil {
-		return err
+		return "", err
+	}
+	if a.Fallback != nil {
+		fallbackData, err := encrypt(a.Fallback.Data)
+		if err != nil {
+			return "", err
+		}
+		encrypted.Action.Fallback = &Fallback{Kind: a.Fallback.Kind, Data: fallbackData}
 	}
-	encrypted.Action.Data = dataEncrypted
 
 	vaultSecret := &vault.Secret{
 		Key:          c.GetPrivateKey(),
 		ProcessAfter: a.ProcessAfter,
+		ProcessUnit:  a.ProcessUnit,
+		Deadline:     a.Deadline,
+		Comment:      a.Comment,
+		Recurring:    a.MinInterval > 0,
+		Version:      s.nextVaultVersion(),
 	}
-	vaultSecretJson, err := jsonMarshal(vaultSecret)
-	if err != nil {
-		return err
+	if err := s.addVaultSecret(encrypted.EncryptionMeta.VaultURL, vaultSecret); err != nil {
+		return "", err
 	}
 
-	resp, err := s.vaultRequest(http.MethodPost, encrypted.EncryptionMeta.VaultURL, bytes.NewBuffer(vaultSecretJson))
-	if err != nil {
-		return err
+	s.mtx.Lock()
+	// Same comment could be added while vault was storing key, its key is not needed anymore.
+	if s.duplicateComment(a.Comment) {
+		s.mtx.Unlock()
+		if err := s.deleteVaultSecret(encrypted.EncryptionMeta.VaultURL); err != nil {
+			log.Printf("unable to delete vault secret of duplicated action %s: %s", encrypted.UUID, err)
+		}
+		return "", fmt.Errorf("%w: %s", ErrDuplicateComment, a.Comment)
 	}
-	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusCreated {
-		return fmt.Errorf("unable to publish vault data, status code %d", resp.StatusCode)
+	evict, err := s.overflowAction()
+	if err != nil {
+		s.mtx.Unlock()
+		if err := s.deleteVaultSecret(encrypted.EncryptionMeta.VaultURL); err != nil {
+			log.Printf("unable to delete vault secret of rejected action %s: %s", encrypted.UUID, err)
+		}
+		return "", err
 	}
-
-	s.mtx.Lock()
 	defer s.mtx.Unlock()
 
+	if evict >= 0 {
+		evicted := s.data.Actions[evict]
+		log.Printf("action limit reached, evicting fully processed action %s", evicted.UUID)
+		s.data.Actions = append(s.data.Actions[:evict], s.data.Actions[evict+1:]...)
+		s.publish(EventActionDeleted, evicted.UUID, evicted.Processed)
+	}
 	s.data.Actions = append(s.data.Actions, encrypted)
 	s.save()
-	return nil
+	s.publish(EventActionAdded, encrypted.UUID, encrypted.Processed)
+	return encryptedActionUUID, nil
+}
+
+// overflowAction returns index of action which must be evicted to store new action, -1 when there is room.
+// With vault.OverflowEvict policy fully processed action which run first is evicted.
+// ErrActionLimitReached is returned when max actions is reached and no action can be evicted.
+// Caller must hold State lock.
+func (s *State) overflowAction() (int, error) {
+	if s.maxActions == 0 || len(s.data.Actions) < s.maxActions {
+		return -1, nil
+	}
+	if s.overflowPolicy == vault.OverflowEvict {
+		oldest := -1
+		for i, a := range s.data.Actions {
+			if a.Processed == 2 && (oldest == -1 || a.LastRun.Before(s.data.Actions[oldest].LastRun)) {
+				oldest = i
+			}
+		}
+		if oldest >= 0 {
+			return oldest, nil
+		}
+	}
+	return -1, fmt.Errorf("%w (%d)", ErrActionLimitReached, s.maxActions)
+}
+
+// duplicateComment returns true when unique comments are enforced and non empty comment
+// is used by action which is not fully processed (Processed != 2).
+// Caller must hold State lock.
+func (s *State) duplicateComment(comment string) bool {
+	if !s.uniqueComments || comment == "" {
+		return false
+	}
+	for _, a := range s.data.Actions {
+		if a.Comment == comment && a.Processed != 2 {
+			return true
+		}
+	}
+	return false
+}
+
+// nextVaultVersion returns version of next secret uploaded to vault.
+// It is based on current time so it keeps growing across restarts,
+// and is strictly increasing within process.
+func (s *State) nextVaultVersion() int64 {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.lastVaultVersion = max(s.lastVaultVersion+1, s.now().UnixNano())
+	return s.lastVaultVersion
 }
 
 // GetActions returns copies of all EncryptedActions.
@@ -311,40 +1433,190 @@ func (s *State) GetAction(u string) (*EncryptedAction, int) {
 }
 
 // DeleteAction deletes actions from State.
+// Vault secret of not fully processed action is deleted best-effort, so it is not orphaned in vault.
+// Unreleased secret is revoked, vault allows it only with client token of remote_vault.client_uuid.
+// Action is deleted even when its vault secret is not, ErrVaultSecretNotDeleted is returned then.
 func (s *State) DeleteAction(u string) error {
 	s.mtx.Lock()
-	defer s.mtx.Unlock()
-
 	a, i := s.getAction(u)
 	if a == nil {
+		s.mtx.Unlock()
 		return fmt.Errorf("missing action with uuid %s", u)
 	}
 
 	s.data.Actions = append((s.data.Actions)[:i], (s.data.Actions)[i+1:]...)
 	s.save()
-	return nil
+	s.publish(EventActionDeleted, a.UUID, a.Processed)
+	s.mtx.Unlock()
 
+	if a.Processed == 2 || a.EncryptionMeta.VaultURL == "" {
+		return nil
+	}
+	if err := s.deleteVaultSecret(a.EncryptionMeta.VaultURL); err != nil {
+		if err := s.revokeVaultSecret(a.EncryptionMeta.VaultURL); err != nil {
+			return fmt.Errorf("%w: %w", ErrVaultSecretNotDeleted, err)
+		}
+	}
+	return nil
 }
 
-// MarkActionAsProcessed sets Processed to 1 or 2.
-// 1 - action was executed
-// 2 - action was executed and private key was deleted from vault.
-func (s *State) MarkActionAsProcessed(u string) error {
-	a, err := s.setActionProcessed(u, 1)
+// revokeVaultSecret deletes secret from remote vault even when it is not released yet.
+func (s *State) revokeVaultSecret(vaultURL string) error {
+	u, err := url.Parse(vaultURL)
 	if err != nil {
 		return err
 	}
+	query := u.Query()
+	query.Set("revoke", "true")
+	u.RawQuery = query.Encode()
+	return s.deleteVaultSecret(u.String())
+}
+
+// ReorderActions reorders actions to match order of uuids, every action must be listed exactly once.
+// Actions eligible at the same time run in this order (after Priority).
+func (s *State) ReorderActions(uuids []string) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if len(uuids) != len(s.data.Actions) {
+		return fmt.Errorf("%w: got %d uuids, expected %d", ErrInvalidOrder, len(uuids), len(s.data.Actions))
+	}
+	reordered := make([]*EncryptedAction, 0, len(uuids))
+	listed := map[string]bool{}
+	for _, u := range uuids {
+		if listed[u] {
+			return fmt.Errorf("%w: uuid %s listed more than once", ErrInvalidOrder, u)
+		}
+		listed[u] = true
+		a, _ := s.getAction(u)
+		if a == nil {
+			return fmt.Errorf("%w: missing action with uuid %s", ErrInvalidOrder, u)
+		}
+		reordered = append(reordered, a)
+	}
+	s.data.Actions = reordered
+	s.save()
+	return nil
+}
+
+// DeleteAllActions deletes all actions from State.
+// With deleteVaultSecrets, vault secrets of not fully processed actions are deleted best-effort,
+// like in DeleteAction secret which is not released yet is revoked. Secrets which can't be deleted are counted as failed.
+func (s *State) DeleteAllActions(deleteVaultSecrets bool) *PurgeResult {
+	s.mtx.Lock()
+	actions := s.data.Actions
+	s.data.Actions = []*EncryptedAction{}
+	s.save()
+	s.mtx.Unlock()
+
+	for _, a := range actions {
+		s.publish(EventActionDeleted, a.UUID, a.Processed)
+	}
+
+	result := &PurgeResult{Deleted: len(actions)}
+	if !deleteVaultSecrets {
+		return result
+	}
+	for _, a := range actions {
+		if a.Processed == 2 || a.EncryptionMeta.VaultURL == "" {
+			continue
+		}
+		err := s.deleteVaultSecret(a.EncryptionMeta.VaultURL)
+		if err != nil {
+			err = s.revokeVaultSecret(a.EncryptionMeta.VaultURL)
+		}
+		if err != nil {
+			log.Printf("unable to delete vault secret for action %s: %s", a.UUID, err)
+			result.VaultDeleteFailed++
+			result.VaultNotDeleted = append(result.VaultNotDeleted, &NotDeletedSecret{Action: a.UUID, VaultURL: a.EncryptionMeta.VaultURL, Error: err.Error()})
+		}
+	}
+	return result
+}
+
+// Panic pauses every action which is not fully processed, paused action never runs and is not un-paused by check-in.
+// Pending confirmation of paused action is cancelled.
+// With purge, vault secrets of paused actions are deleted best-effort (revoked when not released yet),
+// so actions can't be decrypted anymore even when state file is restored.
+func (s *State) Panic(purge bool) *PanicResult {
+	now := s.now()
+	s.mtx.Lock()
+	result := &PanicResult{}
+	paused := []*EncryptedAction{}
+	for _, a := range s.data.Actions {
+		if a.Processed == 2 {
+			continue
+		}
+		if !a.Paused() {
+			a.PausedAt = &now
+			a.PendingSince = nil
+			result.Paused++
+			s.publish(EventActionPaused, a.UUID, a.Processed)
+		}
+		paused = append(paused, a)
+	}
+	s.save()
+	s.mtx.Unlock()
+
+	if !purge {
+		return result
+	}
+	for _, a := range paused {
+		s.mtx.RLock()
+		vaultURL := a.EncryptionMeta.VaultURL
+		s.mtx.RUnlock()
+		if vaultURL == "" {
+			continue
+		}
+		err := s.deleteVaultSecret(vaultURL)
+		if err != nil {
+			err = s.revokeVaultSecret(vaultURL)
+		}
+		if err != nil {
+			log.Printf("unable to delete vault secret for action %s: %s", a.UUID, err)
+			result.VaultDeleteFailed++
+			continue
+		}
+		result.VaultDeleted++
+		s.mtx.Lock()
+		a.EncryptionMeta.VaultURL = ""
+		s.save()
+		s.mtx.Unlock()
+	}
+	return result
+}
 
-	resp, err := s.vaultRequest(http.MethodDelete, a.EncryptionMeta.VaultURL, nil)
+// deleteVaultSecret deletes secret from remote vault.
+// Secret which no longer exist in vault is considered deleted.
+func (s *State) deleteVaultSecret(vaultURL string) error {
+	if s.colocatedVault(vaultURL) {
+		return s.deleteColocatedVaultSecret(vaultURL)
+	}
+	resp, err := s.vaultRequest(http.MethodDelete, vaultURL, nil)
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
 
-	// Deletion was successful or item no longer exist in vault.
 	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
 		return fmt.Errorf("unable to delete vault data, status code %d", resp.StatusCode)
 	}
+	return nil
+}
+
+// MarkActionAsProcessed sets Processed to 1 or 2.
+// 1 - action was executed
+// 2 - action was executed and private key was deleted from vault.
+// With clearProcessedVaultURL, VaultURL is cleared when action reaches 2.
+func (s *State) MarkActionAsProcessed(u string) error {
+	a, err := s.setActionProcessed(u, 1)
+	if err != nil {
+		return err
+	}
+
+	if err := s.deleteVaultSecret(a.EncryptionMeta.VaultURL); err != nil {
+		return err
+	}
 
 	if _, err := s.setActionProcessed(u, 2); err != nil {
 		return err
@@ -364,7 +1636,11 @@ func (s *State) setActionProcessed(u string, processed int) (*EncryptedAction, e
 		return nil, fmt.Errorf("missing action with uuid %s", u)
 	}
 	a.Processed = processed
+	if processed == 2 && s.clearProcessedVaultURL {
+		a.EncryptionMeta.VaultURL = ""
+	}
 	s.save()
+	s.publish(EventActionProcessed, a.UUID, a.Processed)
 	actionCopy := *a
 	return &actionCopy, nil
 }
@@ -377,51 +1653,363 @@ func (s *State) DecryptAction(u string) (*Action, error) {
 		return nil, fmt.Errorf("missing action with uuid %s", u)
 	}
 
-	resp, err := s.vaultRequest(http.MethodGet, encryptedAction.EncryptionMeta.VaultURL, nil)
+	var key string
+	var err error
+	if s.colocatedVault(encryptedAction.EncryptionMeta.VaultURL) {
+		key, err = s.getColocatedVaultKey(u, encryptedAction.EncryptionMeta.VaultURL)
+	} else {
+		key, err = s.getVaultKey(u, encryptedAction.EncryptionMeta.VaultURL)
+	}
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unable to get vault data, status code %d", resp.StatusCode)
-	}
 
-	var vaultSecret vault.Secret
-	if err := json.NewDecoder(resp.Body).Decode(&vaultSecret); err != nil {
+	c, err := cryptNewAge(key)
+	if err != nil {
 		return nil, err
 	}
 
-	c, err := cryptNewAge(vaultSecret.Key)
-	if err != nil {
-		return nil, err
+	if encryptedAction.EncryptionMeta.Kind == crypt.PluginEncryptionKind && s.pluginAge == nil {
+		return nil, fmt.Errorf("action %s is encrypted to age plugin recipient, age plugin identity is not configured", u)
+	}
+	sshEncrypted := strings.HasPrefix(encryptedAction.EncryptionMeta.Kind, crypt.SSHEncryptionKindPrefix)
+	if sshEncrypted && s.sshAge == nil {
+		return nil, fmt.Errorf("action %s is encrypted to ssh recipient, state.ssh.key_file is not configured", u)
+	}
+	decrypt := func(data string) (string, error) {
+		plainTextData, err := c.Decrypt(data)
+		if err != nil {
+			return "", err
+		}
+		if encryptedAction.EncryptionMeta.Kind == crypt.PluginEncryptionKind {
+			return s.pluginAge.Decrypt(plainTextData)
+		}
+		if sshEncrypted {
+			return s.sshAge.Decrypt(plainTextData)
+		}
+		return plainTextData, nil
 	}
 
-	plainTextData, err := c.Decrypt(encryptedAction.Data)
+	plainTextData, err := decrypt(encryptedAction.Data)
 	if err != nil {
 		return nil, err
 	}
+	if encryptedAction.EncryptionMeta.Compressed {
+		plainTextData, err = decompressData(plainTextData)
+		if err != nil {
+			return nil, fmt.Errorf("unable to decompress action %s data: %w", u, err)
+		}
+	}
+	var fallback *Fallback
+	if encryptedAction.Fallback != nil {
+		fallbackData, err := decrypt(encryptedAction.Fallback.Data)
+		if err != nil {
+			return nil, err
+		}
+		fallback = &Fallback{Kind: encryptedAction.Fallback.Kind, Data: fallbackData}
+	}
 
 	action := &Action{
 		Kind:         encryptedAction.Kind,
 		ProcessAfter: encryptedAction.ProcessAfter,
 		MinInterval:  encryptedAction.MinInterval,
+		ProcessUnit:  encryptedAction.ProcessUnit,
+		Deadline:     encryptedAction.Deadline,
+		NotBefore:    encryptedAction.NotBefore,
+		Timezone:     encryptedAction.Timezone,
+		Priority:     encryptedAction.Priority,
+		DedupeWindow: encryptedAction.DedupeWindow,
+		Severity:     encryptedAction.Severity,
+		OnSuccess:    encryptedAction.OnSuccess,
+		OnFailure:    encryptedAction.OnFailure,
 		Comment:      encryptedAction.Comment,
 		Data:         plainTextData,
+		Fallback:     fallback,
 	}
 
 	return action, nil
 
 }
 
+// getVaultKey fetches released private key of action u from remote vault.
+func (s *State) getVaultKey(u string, vaultURL string) (string, error) {
+	// With wrapResponse vault encrypts released key to ephemeral identity,
+	// key is never sent in plain text.
+	var unwrap crypt.AgeInterface
+	var modifiers []func(*http.Request)
+	if s.wrapResponse {
+		var err error
+		unwrap, err = cryptNewAge("")
+		if err != nil {
+			return "", err
+		}
+		modifiers = append(modifiers, func(req *http.Request) {
+			req.Header.Set(vault.WrapRecipientHeader, unwrap.GetPublicKey())
+		})
+	}
+
+	resp, err := s.vaultRequest(http.MethodGet, vaultURL, nil, modifiers...)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusLocked {
+		return "", fmt.Errorf("%w: %s", ErrKeyNotReleased, u)
+	}
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return "", fmt.Errorf("%w: unable to get vault data, status code %d", ErrVaultUnreachable, resp.StatusCode)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unable to get vault data, status code %d", resp.StatusCode)
+	}
+
+	var vaultSecret vault.Secret
+	if err := json.NewDecoder(resp.Body).Decode(&vaultSecret); err != nil {
+		return "", err
+	}
+
+	key := vaultSecret.Key
+	if unwrap != nil {
+		if vaultSecret.EncryptionMeta.Kind != crypt.WrapEncryptionKind {
+			return "", fmt.Errorf("vault returned unwrapped key for action %s, remote vault does not support wrap_response", u)
+		}
+		key, err = unwrap.Decrypt(key)
+		if err != nil {
+			return "", fmt.Errorf("unable to unwrap vault key: %w", err)
+		}
+	}
+	return key, nil
+}
+
+// VerifyVaultKeys checks that remote vault knows about key of every action
+// which was not fully processed yet.
+// Locked (not released yet) keys are considered valid.
+// Vault secret process_after must match action process_after.
+func (s *State) VerifyVaultKeys() []VerifyResult {
+	results := []VerifyResult{}
+	for _, a := range s.GetActions() {
+		if a.Processed == 2 {
+			continue
+		}
+		results = append(results, VerifyResult{UUID: a.UUID, Err: s.verifyVaultKey(a)})
+	}
+	return results
+}
+
+// verifyVaultKey checks that remote vault knows about single action key.
+func (s *State) verifyVaultKey(a *EncryptedAction) error {
+	if a.EncryptionMeta.VaultURL == "" {
+		return fmt.Errorf("missing vault url")
+	}
+	if s.colocatedVault(a.EncryptionMeta.VaultURL) {
+		return s.verifyColocatedVaultKey(a)
+	}
+
+	resp, err := s.vaultRequest(http.MethodHead, a.EncryptionMeta.VaultURL, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusLocked {
+		return fmt.Errorf("unable to find vault data, status code %d", resp.StatusCode)
+	}
+	// Older vaults don't send process_after, there is nothing to compare then.
+	if header := resp.Header.Get(vault.ProcessAfterHeader); header != "" {
+		processAfter, err := strconv.Atoi(header)
+		if err != nil {
+			return fmt.Errorf("unable to parse vault process_after %q: %w", header, err)
+		}
+		if processAfter != a.ProcessAfter {
+			return fmt.Errorf("%w: vault %d, action %d", ErrProcessAfterMismatch, processAfter, a.ProcessAfter)
+		}
+	}
+	return nil
+}
+
+// GetVaultProcessUnit returns time unit used by remote vault to release secrets.
+func (s *State) GetVaultProcessUnit() (time.Duration, error) {
+	if s.vault != nil {
+		return s.vault.GetSecretProcessUnit(), nil
+	}
+	endpointAddress, err := url.JoinPath(s.vaultURL, "api", "vault", "info")
+	if err != nil {
+		return 0, fmt.Errorf("unable to parse address: %s", err)
+	}
+
+	resp, err := s.vaultRequest(http.MethodGet, endpointAddress, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("unable to get vault info, status code %d", resp.StatusCode)
+	}
+
+	var info struct {
+		ProcessUnit string `json:"process_unit"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return 0, err
+	}
+
+	unit, ok := vault.ProcessUnit(info.ProcessUnit)
+	if !ok {
+		return 0, fmt.Errorf("unknown vault process unit %s", info.ProcessUnit)
+	}
+	return unit, nil
+}
+
 // save dumps state to disk.
 // save exits the process when this is not possible.
 // Caller must hold State lock.
 func (s *State) save() {
+	s.data.Signature = ""
+	if s.signKey != "" {
+		signature, err := s.sign()
+		if err != nil {
+			logFatalf("unable to sign state: %s", err)
+		}
+		s.data.Signature = signature
+	}
 	data, err := jsonMarshal(s.data)
 	if err != nil {
 		logFatalf("unable to encode state: %s", err)
 	}
+	if s.pretty {
+		var indented bytes.Buffer
+		if err := json.Indent(&indented, data, "", "  "); err != nil {
+			logFatalf("unable to indent state: %s", err)
+		}
+		data = indented.Bytes()
+	}
 	if err := atomicWrite(s.savePath, data, 0600); err != nil {
 		logFatalf("unable to dump state: %s", err)
 	}
+	if s.backupDir != "" {
+		s.backupOnChange(data)
+	}
+}
+
+// backupOnChange calls backup only when actions or maintenance changed since last backup.
+// Check-ins change only last seen, backing them up would rotate useful backups out in minutes.
+// Caller must hold State lock.
+func (s *State) backupOnChange(data []byte) {
+	content, err := jsonMarshal(struct {
+		Actions     []*EncryptedAction
+		Maintenance *Maintenance
+	}{s.data.Actions, s.data.Maintenance})
+	if err != nil {
+		log.Printf("unable to encode state backup content: %s", err)
+		return
+	}
+	sum := sha256.Sum256(content)
+	if sum == s.backupSum {
+		return
+	}
+	if s.backup(data) {
+		s.backupSum = sum
+	}
+}
+
+// backupPrefix returns prefix of backup file names of state file.
+func (s *State) backupPrefix() string {
+	return strings.TrimSuffix(filepath.Base(s.savePath), filepath.Ext(s.savePath)) + "."
+}
+
+// backupTimeLayout is fixed-width RFC3339 with nanoseconds, unlike time.RFC3339Nano it keeps
+// trailing zeros so backup names sort lexically in time order.
+const backupTimeLayout = "2006-01-02T15:04:05.000000000Z07:00"
+
+// backupTime returns time encoded in backup name.
+// Backups written with second resolution RFC3339 names are still recognized.
+func (s *State) backupTime(name string) (time.Time, error) {
+	return time.Parse(time.RFC3339, strings.TrimSuffix(strings.TrimPrefix(name, s.backupPrefix()), ".json"))
+}
+
+// backups returns names of state backups in backupDir, oldest first.
+func (s *State) backups() ([]string, error) {
+	prefix := s.backupPrefix()
+	entries, err := os.ReadDir(s.backupDir)
+	if err != nil {
+		return nil, err
+	}
+	var backups []string
+	written := map[string]time.Time{}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		t, err := s.backupTime(name)
+		if err != nil {
+			continue
+		}
+		backups = append(backups, name)
+		written[name] = t
+	}
+	// Names with different timestamp precision do not sort lexically, sort by time instead.
+	slices.SortStableFunc(backups, func(a, b string) int {
+		return written[a].Compare(written[b])
+	})
+	return backups, nil
+}
+
+// SnapshotAt returns state from newest backup written at or before t, so it shows actions as they were at t.
+// Backups are written when actions or maintenance change, snapshots are available only when backupDir is configured
+// and only as far back as backupKeep rotation allows.
+func (s *State) SnapshotAt(t time.Time) (*Snapshot, error) {
+	if s.backupDir == "" {
+		return nil, fmt.Errorf("%w: state.backup_dir is not configured", ErrSnapshotNotFound)
+	}
+	backups, err := s.backups()
+	if err != nil {
+		return nil, fmt.Errorf("unable to list state backups in %s: %w", s.backupDir, err)
+	}
+	for i := len(backups) - 1; i >= 0; i-- {
+		// backups returns only names with valid timestamp.
+		written, _ := s.backupTime(backups[i])
+		if written.After(t) {
+			continue
+		}
+		d, err := readStateFile(filepath.Join(s.backupDir, backups[i]))
+		if err != nil {
+			return nil, fmt.Errorf("unable to load state backup %s: %w", backups[i], err)
+		}
+		return &Snapshot{Time: written, LastSeen: d.LastSeen, Maintenance: d.Maintenance, Actions: d.Actions}, nil
+	}
+	return nil, fmt.Errorf("%w: no backup before %s", ErrSnapshotNotFound, t.UTC().Format(time.RFC3339))
+}
+
+// backup writes already encoded state into backupDir as <state file name>.<RFC3339 with nanoseconds>.json
+// and removes all but backupKeep newest backups.
+// Backup is best-effort, errors are only logged. Returns false when backup was not written.
+// Caller must hold State lock.
+func (s *State) backup(data []byte) bool {
+	now := s.now().UTC()
+	backupPath := filepath.Join(s.backupDir, s.backupPrefix()+now.Format(backupTimeLayout)+".json")
+	// Never overwrite existing backup, e.g. when clock did not move between saves.
+	for {
+		if _, err := os.Stat(backupPath); errors.Is(err, os.ErrNotExist) {
+			break
+		}
+		now = now.Add(time.Nanosecond)
+		backupPath = filepath.Join(s.backupDir, s.backupPrefix()+now.Format(backupTimeLayout)+".json")
+	}
+	if err := atomicWrite(backupPath, data, 0600); err != nil {
+		log.Printf("unable to write state backup %s: %s", backupPath, err)
+		return false
+	}
+
+	backups, err := s.backups()
+	if err != nil {
+		log.Printf("unable to list state backups in %s: %s", s.backupDir, err)
+		return true
+	}
+	for len(backups) > s.backupKeep {
+		if err := os.Remove(filepath.Join(s.backupDir, backups[0])); err != nil {
+			log.Printf("unable to remove state backup %s: %s", backups[0], err)
+		}
+		backups = backups[1:]
+	}
+	return true
 }
@@ -2,19 +2,31 @@ package state
 
 import (
 	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
 	"encoding/json"
+	"encoding/pem"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"dmh/internal/clock"
 	"dmh/internal/crypt"
+	"dmh/internal/useragent"
+	"dmh/internal/vault"
 
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
 )
 
 type mockCrypt struct {
@@ -31,35 +43,51 @@ func (m *mockCrypt) Decrypt(data string) (string, error) {
 	return args.String(0), args.Error(1)
 }
 
+func (m *mockCrypt) EncryptStream(dst io.Writer, src io.Reader) error {
+	args := m.Called(dst, src)
+	return args.Error(0)
+}
+
+func (m *mockCrypt) DecryptStream(dst io.Writer, src io.Reader) error {
+	args := m.Called(dst, src)
+	return args.Error(0)
+}
+
 func (m *mockCrypt) GetPrivateKey() string {
 	args := m.Called()
 	return args.String(0)
 }
 
+func (m *mockCrypt) GetPublicKey() string {
+	args := m.Called()
+	return args.String(0)
+}
+
 func TestActionValidate(t *testing.T) {
+	notBefore := time.Date(2025, 3, 26, 14, 0, 0, 0, time.UTC)
 	tests := []struct {
 		inputAction   *Action
 		expectedError error
 	}{
 		{
 			inputAction:   &Action{Kind: "dummy", ProcessAfter: 10},
-			expectedError: fmt.Errorf("data is required"),
+			expectedError: ValidationError{fmt.Errorf("data is required")},
 		},
 		{
 			inputAction:   &Action{Data: `{"message": "test"}`, ProcessAfter: 10},
-			expectedError: fmt.Errorf("kind is required"),
+			expectedError: ValidationError{fmt.Errorf("kind is required")},
 		},
 		{
 			inputAction:   &Action{Kind: "dummy", Data: `{"message": "test"}`},
-			expectedError: fmt.Errorf("process_after should be greater than 0"),
+			expectedError: ValidationError{fmt.Errorf("process_after should be greater than 0")},
 		},
 		{
 			inputAction:   &Action{Kind: "dummy", Data: `{"message": "test"}`, ProcessAfter: -1},
-			expectedError: fmt.Errorf("process_after should be greater than 0"),
+			expectedError: ValidationError{fmt.Errorf("process_after should be greater than 0")},
 		},
 		{
 			inputAction:   &Action{Kind: "dummy", Data: `{"message": "test"}`, ProcessAfter: 10, MinInterval: -1},
-			expectedError: fmt.Errorf("min_interval should be greater or equal 0"),
+			expectedError: ValidationError{fmt.Errorf("min_interval should be greater or equal 0")},
 		},
 		{
 			inputAction: &Action{Kind: "dummy", Data: `{"message": "test"}`, ProcessAfter: 10},
@@ -67,6 +95,117 @@ func TestActionValidate(t *testing.T) {
 		{
 			inputAction: &Action{Kind: "dummy", Data: `{"message": "test"}`, ProcessAfter: 10, MinInterval: 5},
 		},
+		{
+			inputAction:   &Action{Kind: "dummy", Data: `{"message": "test"}`, ProcessAfter: 10, DependsOn: []string{"a"}, DependsDelay: -1},
+			expectedError: ValidationError{fmt.Errorf("depends_delay should be greater or equal 0")},
+		},
+		{
+			inputAction:   &Action{Kind: "dummy", Data: `{"message": "test"}`, ProcessAfter: 10, DependsDelay: 1},
+			expectedError: ValidationError{fmt.Errorf("depends_delay requires depends_on")},
+		},
+		{
+			inputAction:   &Action{Kind: "dummy", Data: `{"message": "test"}`, ProcessAfter: 10, DedupeWindow: -1},
+			expectedError: ValidationError{fmt.Errorf("dedupe_window should be greater or equal 0")},
+		},
+		{
+			inputAction:   &Action{Kind: "dummy", Data: `{"message": "test"}`, ProcessAfter: 10, DedupeWindow: 24},
+			expectedError: ValidationError{fmt.Errorf("dedupe_window requires min_interval")},
+		},
+		{
+			inputAction:   &Action{Kind: "dummy", Data: `{"message": "test"}`, ProcessAfter: 10, MinInterval: 24, DedupeWindow: 24},
+			expectedError: ValidationError{fmt.Errorf("dedupe_window should be greater than min_interval")},
+		},
+		{
+			inputAction: &Action{Kind: "dummy", Data: `{"message": "test"}`, ProcessAfter: 10, MinInterval: 24, DedupeWindow: 72},
+		},
+		{
+			inputAction:   &Action{Kind: "dummy", Data: `{"message": "test"}`, ProcessAfter: 10, Severity: "critical"},
+			expectedError: ValidationError{fmt.Errorf("severity should be one of notify, destructive")},
+		},
+		{
+			inputAction: &Action{Kind: "dummy", Data: `{"message": "test"}`, ProcessAfter: 10, Severity: SeverityDestructive},
+		},
+		{
+			inputAction: &Action{Kind: "dummy", Data: `{"message": "test"}`, ProcessAfter: 10, OnSuccess: "ftp://example.com", OnFailure: "/relative"},
+			expectedError: ValidationError{
+				fmt.Errorf("on_success should be http or https URL"),
+				fmt.Errorf("on_failure should be http or https URL"),
+			},
+		},
+		{
+			inputAction: &Action{Kind: "dummy", Data: `{"message": "test"}`, ProcessAfter: 10, OnSuccess: "https://monitoring.example.com/ping", OnFailure: "http://127.0.0.1:8080/failed"},
+		},
+		{
+			inputAction:   &Action{Kind: "dummy", Data: `{"message": "test"}`, ProcessAfter: 10, VaultURL: "vault.example.com"},
+			expectedError: ValidationError{fmt.Errorf("vault_url should be http or https URL")},
+		},
+		{
+			inputAction: &Action{Kind: "dummy", Data: `{"message": "test"}`, ProcessAfter: 10, VaultURL: "https://vault.example.com"},
+		},
+		{
+			inputAction:   &Action{Kind: "dummy", Data: `{"message": "test"}`, ProcessAfter: 10, NotBefore: &notBefore, Deadline: &notBefore},
+			expectedError: ValidationError{fmt.Errorf("not_before should be before deadline")},
+		},
+		{
+			inputAction: &Action{Kind: "dummy", Data: `{"message": "test"}`, ProcessAfter: 10, NotBefore: &notBefore},
+		},
+		{
+			inputAction: &Action{Kind: "dummy", Data: `{"message": "test"}`, ProcessAfter: 10, NotBefore: &notBefore, Timezone: "America/New_York"},
+		},
+		{
+			inputAction:   &Action{Kind: "dummy", Data: `{"message": "test"}`, ProcessAfter: 10, Timezone: "Mars/Olympus"},
+			expectedError: ValidationError{fmt.Errorf("timezone should be valid IANA time zone name")},
+		},
+		{
+			inputAction:   &Action{Kind: "dummy", Data: `{"message": "test"}`, ProcessAfter: 10, Timezone: "Local"},
+			expectedError: ValidationError{fmt.Errorf("timezone should be valid IANA time zone name")},
+		},
+		{
+			inputAction:   &Action{Kind: "dummy", Data: `{"message": "test"}`, ProcessAfter: 10, DependsOn: []string{""}},
+			expectedError: ValidationError{fmt.Errorf("depends_on should not contain empty uuid")},
+		},
+		{
+			inputAction:   &Action{Kind: "dummy", Data: `{"message": "test"}`, ProcessAfter: 10, DependsOn: []string{"a", "a"}},
+			expectedError: ValidationError{fmt.Errorf("depends_on contains a more than once")},
+		},
+		{
+			inputAction: &Action{Kind: "dummy", Data: `{"message": "test"}`, ProcessAfter: 10, DependsOn: []string{"a", "b"}, DependsDelay: 24},
+		},
+		{
+			inputAction:   &Action{Kind: "dummy", Data: `{"message": "test"}`, ProcessAfter: 10, ProcessUnit: "day"},
+			expectedError: ValidationError{fmt.Errorf("process_unit should be one of second, minute, hour")},
+		},
+		{
+			inputAction: &Action{Kind: "dummy", Data: `{"message": "test"}`, ProcessAfter: 10, ProcessUnit: "minute"},
+		},
+		{
+			inputAction:   &Action{Kind: "dummy", Data: `{"message": "test"}`, ProcessAfter: 10, Priority: -101},
+			expectedError: ValidationError{fmt.Errorf("priority should be between -100 and 100")},
+		},
+		{
+			inputAction:   &Action{Kind: "dummy", Data: `{"message": "test"}`, ProcessAfter: 10, Priority: 101},
+			expectedError: ValidationError{fmt.Errorf("priority should be between -100 and 100")},
+		},
+		{
+			inputAction: &Action{Kind: "dummy", Data: `{"message": "test"}`, ProcessAfter: 10, Priority: 100},
+		},
+		{
+			inputAction: &Action{Kind: "dummy", Data: `{"message": "test"}`, ProcessAfter: 10, Fallback: &Fallback{Kind: "dummy", Data: `{"message": "test"}`}},
+		},
+		{
+			inputAction:   &Action{Kind: "dummy", Data: `{"message": "test"}`, ProcessAfter: 10, Fallback: &Fallback{}},
+			expectedError: ValidationError{fmt.Errorf("fallback.kind is required"), fmt.Errorf("fallback.data is required")},
+		},
+		{
+			inputAction: &Action{Data: `{"message": "test"}`, MinInterval: -1, DependsOn: []string{"", ""}},
+			expectedError: ValidationError{
+				fmt.Errorf("kind is required"),
+				fmt.Errorf("process_after should be greater than 0"),
+				fmt.Errorf("min_interval should be greater or equal 0"),
+				fmt.Errorf("depends_on should not contain empty uuid"),
+				fmt.Errorf("depends_on should not contain empty uuid"),
+			},
+		},
 	}
 	for _, test := range tests {
 		err := test.inputAction.Validate()
@@ -74,6 +213,142 @@ func TestActionValidate(t *testing.T) {
 	}
 }
 
+func TestActionUnit(t *testing.T) {
+	tests := []struct {
+		inputAction      *Action
+		inputDefaultUnit time.Duration
+		expectedUnit     time.Duration
+	}{
+		{
+			inputAction:      &Action{},
+			inputDefaultUnit: time.Hour,
+			expectedUnit:     time.Hour,
+		},
+		{
+			inputAction:      &Action{ProcessUnit: "second"},
+			inputDefaultUnit: time.Hour,
+			expectedUnit:     time.Second,
+		},
+		{
+			inputAction:      &Action{ProcessUnit: "minute"},
+			inputDefaultUnit: time.Second,
+			expectedUnit:     time.Minute,
+		},
+		{
+			inputAction:      &Action{ProcessUnit: "unknown"},
+			inputDefaultUnit: time.Minute,
+			expectedUnit:     time.Minute,
+		},
+	}
+	for _, test := range tests {
+		require.Equal(t, test.expectedUnit, test.inputAction.Unit(test.inputDefaultUnit))
+	}
+}
+
+func TestActionFireAt(t *testing.T) {
+	lastSeen := time.Date(2025, 3, 26, 14, 0, 0, 0, time.UTC)
+	earlyDeadline := lastSeen.Add(time.Hour)
+	lateDeadline := lastSeen.Add(20 * time.Hour)
+	earlyNotBefore := lastSeen.Add(time.Hour)
+	lateNotBefore := lastSeen.Add(20 * time.Hour)
+	tests := []struct {
+		inputAction    *Action
+		expectedFireAt time.Time
+	}{
+		{
+			inputAction:    &Action{ProcessAfter: 10},
+			expectedFireAt: lastSeen.Add(10 * time.Hour),
+		},
+		{
+			inputAction:    &Action{ProcessAfter: 10, ProcessUnit: "minute"},
+			expectedFireAt: lastSeen.Add(10 * time.Minute),
+		},
+		{
+			inputAction:    &Action{ProcessAfter: 10, Deadline: &earlyDeadline},
+			expectedFireAt: earlyDeadline,
+		},
+		{
+			inputAction:    &Action{ProcessAfter: 10, Deadline: &lateDeadline},
+			expectedFireAt: lastSeen.Add(10 * time.Hour),
+		},
+		{
+			inputAction:    &Action{ProcessAfter: 10, NotBefore: &earlyNotBefore},
+			expectedFireAt: lastSeen.Add(10 * time.Hour),
+		},
+		{
+			inputAction:    &Action{ProcessAfter: 10, NotBefore: &lateNotBefore},
+			expectedFireAt: lateNotBefore,
+		},
+		{
+			inputAction:    &Action{ProcessAfter: 10, Deadline: &earlyDeadline, NotBefore: &lateNotBefore},
+			expectedFireAt: lateNotBefore,
+		},
+	}
+	for _, test := range tests {
+		require.Equal(t, test.expectedFireAt, test.inputAction.FireAt(lastSeen, time.Hour))
+	}
+}
+
+func TestEncryptedActionNextRun(t *testing.T) {
+	lastSeen := time.Date(2025, 3, 26, 14, 0, 0, 0, time.UTC)
+	deadline := lastSeen.Add(30 * time.Minute)
+	tests := []struct {
+		inputAction     *EncryptedAction
+		inputExtend     time.Duration
+		expectedNextRun time.Time
+		expectedOk      bool
+	}{
+		{
+			inputAction:     &EncryptedAction{Action: Action{ProcessAfter: 2}},
+			expectedNextRun: lastSeen.Add(2 * time.Hour),
+			expectedOk:      true,
+		},
+		{
+			inputAction:     &EncryptedAction{Action: Action{ProcessAfter: 30, ProcessUnit: "minute"}},
+			expectedNextRun: lastSeen.Add(30 * time.Minute),
+			expectedOk:      true,
+		},
+		{
+			inputAction:     &EncryptedAction{Action: Action{ProcessAfter: 2, Deadline: &deadline}},
+			expectedNextRun: deadline,
+			expectedOk:      true,
+		},
+		{
+			inputAction: &EncryptedAction{Action: Action{ProcessAfter: 2}, Processed: 1},
+		},
+		{
+			inputAction: &EncryptedAction{Action: Action{ProcessAfter: 2, MinInterval: 1}, Processed: 2},
+		},
+		{
+			inputAction:     &EncryptedAction{Action: Action{ProcessAfter: 2, MinInterval: 1}, Processed: 1, LastRun: lastSeen.Add(3 * time.Hour)},
+			expectedNextRun: lastSeen.Add(4 * time.Hour),
+			expectedOk:      true,
+		},
+		{
+			inputAction:     &EncryptedAction{Action: Action{ProcessAfter: 2, MinInterval: 1}, Processed: 1, LastRun: lastSeen.Add(-5 * time.Hour)},
+			expectedNextRun: lastSeen.Add(2 * time.Hour),
+			expectedOk:      true,
+		},
+		{
+			inputAction:     &EncryptedAction{Action: Action{ProcessAfter: 2}},
+			inputExtend:     24 * time.Hour,
+			expectedNextRun: lastSeen.Add(26 * time.Hour),
+			expectedOk:      true,
+		},
+		{
+			inputAction:     &EncryptedAction{Action: Action{ProcessAfter: 2, Deadline: &deadline}},
+			inputExtend:     24 * time.Hour,
+			expectedNextRun: deadline,
+			expectedOk:      true,
+		},
+	}
+	for _, test := range tests {
+		nextRun, ok := test.inputAction.NextRun(lastSeen, test.inputExtend, time.Hour)
+		require.Equal(t, test.expectedOk, ok)
+		require.Equal(t, test.expectedNextRun, nextRun)
+	}
+}
+
 func TestNew(t *testing.T) {
 	tests := []struct {
 		inputOptions          *Options
@@ -222,8 +497,191 @@ func TestUpdateLastSeen(t *testing.T) {
 		},
 		savePath: "test_state.json",
 	}
-	s.UpdateLastSeen()
+	s.UpdateLastSeen(nil)
 	require.GreaterOrEqual(t, float64(1), time.Since(s.data.LastSeen).Seconds())
+	require.Nil(t, s.data.LastSeenMeta)
+
+	meta := &LastSeenMeta{IP: "10.0.0.1", UserAgent: "test-agent"}
+	s.UpdateLastSeen(meta)
+	require.Equal(t, meta, s.data.LastSeenMeta)
+	require.NotSame(t, meta, s.data.LastSeenMeta)
+
+	s.UpdateLastSeen(nil)
+	require.Nil(t, s.data.LastSeenMeta)
+}
+
+func TestMarkGone(t *testing.T) {
+	os.Remove("test_state.json")
+	defer os.Remove("test_state.json")
+	lastSeen := time.Now().Add(-time.Hour)
+	pendingSince := lastSeen
+
+	s := &State{
+		data: &data{
+			LastSeen:     lastSeen,
+			LastSeenMeta: &LastSeenMeta{IP: "10.0.0.1"},
+			Actions: []*EncryptedAction{
+				{UUID: "test", Action: Action{ProcessAfter: 24}, PendingSince: &pendingSince},
+			},
+		},
+		savePath:        "test_state.json",
+		requiredSources: []string{"alice", "bob"},
+	}
+	s.initSourcesLastSeen()
+
+	s.MarkGone()
+	require.Equal(t, goneLastSeen, s.data.LastSeen)
+	require.Nil(t, s.data.LastSeenMeta)
+	require.Equal(t, map[string]time.Time{"alice": goneLastSeen, "bob": goneLastSeen}, s.data.SourcesLastSeen)
+	require.NotNil(t, s.data.Actions[0].PendingSince)
+	nextRun, ok := s.data.Actions[0].NextRun(s.data.LastSeen, 0, time.Hour)
+	require.True(t, ok)
+	require.True(t, nextRun.Before(time.Now()))
+
+	// One required source is not enough to come back.
+	advanced, err := s.UpdateSourceLastSeen("alice", nil)
+	require.Nil(t, err)
+	require.False(t, advanced)
+	require.Equal(t, goneLastSeen, s.data.LastSeen)
+}
+
+// TestConcurrentAccess is meant to be run with -race.
+func TestConcurrentAccess(t *testing.T) {
+	s := &State{
+		data: &data{
+			Actions: []*EncryptedAction{
+				{UUID: "test"},
+				{UUID: "test2"},
+			},
+		},
+		savePath: filepath.Join(t.TempDir(), "state.json"),
+	}
+
+	var wg sync.WaitGroup
+	for i := range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			u := []string{"test", "test2"}[i%2]
+			for range 20 {
+				s.UpdateLastSeen(&LastSeenMeta{IP: "10.0.0.1"})
+				s.GetLastSeen()
+				s.GetLastSeenMeta()
+				require.Nil(t, s.MarkActionPending(u))
+				require.Nil(t, s.UpdateActionLastRun(u))
+				_, err := s.GetActionLastRun(u)
+				require.Nil(t, err)
+				for _, a := range s.GetActions() {
+					a.Comment = "modified copy"
+				}
+				a, _ := s.GetAction(u)
+				require.NotNil(t, a)
+			}
+		}()
+	}
+	wg.Wait()
+	for _, a := range s.GetActions() {
+		require.Empty(t, a.Comment)
+	}
+}
+
+func TestUpdateSourceLastSeen(t *testing.T) {
+	os.Remove("test_state.json")
+	defer os.Remove("test_state.json")
+	lastSeen := time.Now().Add(-time.Hour)
+	pendingSince := lastSeen
+
+	s := &State{
+		data: &data{
+			LastSeen: lastSeen,
+			Actions: []*EncryptedAction{
+				{UUID: "test", PendingSince: &pendingSince},
+			},
+		},
+		savePath:        "test_state.json",
+		requiredSources: []string{"alice", "bob"},
+	}
+	s.initSourcesLastSeen()
+	require.Equal(t, map[string]time.Time{"alice": lastSeen, "bob": lastSeen}, s.data.SourcesLastSeen)
+
+	advanced, err := s.UpdateSourceLastSeen("eve", nil)
+	require.ErrorIs(t, err, ErrUnknownSource)
+	require.False(t, advanced)
+	require.NotContains(t, s.data.SourcesLastSeen, "eve")
+
+	advances, err := s.SourceLastSeenAdvances("eve")
+	require.ErrorIs(t, err, ErrUnknownSource)
+	require.False(t, advances)
+	advances, err = s.SourceLastSeenAdvances("alice")
+	require.Nil(t, err)
+	require.False(t, advances)
+
+	meta := &LastSeenMeta{IP: "10.0.0.1"}
+	advanced, err = s.UpdateSourceLastSeen("alice", meta)
+	require.Nil(t, err)
+	require.False(t, advanced)
+	require.Equal(t, lastSeen, s.data.LastSeen)
+	require.Nil(t, s.data.LastSeenMeta)
+	require.NotNil(t, s.data.Actions[0].PendingSince)
+	aliceSeen := s.data.SourcesLastSeen["alice"]
+	require.True(t, aliceSeen.After(lastSeen))
+
+	// State is not changed by SourceLastSeenAdvances.
+	advances, err = s.SourceLastSeenAdvances("bob")
+	require.Nil(t, err)
+	require.True(t, advances)
+	require.Equal(t, lastSeen, s.data.LastSeen)
+	require.Equal(t, lastSeen, s.data.SourcesLastSeen["bob"])
+
+	advanced, err = s.UpdateSourceLastSeen("bob", meta)
+	require.Nil(t, err)
+	require.True(t, advanced)
+	require.Equal(t, aliceSeen, s.data.LastSeen)
+	require.Equal(t, meta, s.data.LastSeenMeta)
+	require.Nil(t, s.data.Actions[0].PendingSince)
+
+	s.requiredSources = nil
+	advanced, err = s.UpdateSourceLastSeen("phone", nil)
+	require.Nil(t, err)
+	require.True(t, advanced)
+	require.Equal(t, s.data.SourcesLastSeen["phone"], s.data.LastSeen)
+}
+
+func TestGetLastSeenMeta(t *testing.T) {
+	s := &State{data: &data{}}
+	require.Nil(t, s.GetLastSeenMeta())
+
+	s.data.LastSeenMeta = &LastSeenMeta{IP: "10.0.0.1", UserAgent: "test-agent"}
+	meta := s.GetLastSeenMeta()
+	require.Equal(t, s.data.LastSeenMeta, meta)
+	require.NotSame(t, s.data.LastSeenMeta, meta)
+}
+
+func TestMaintenance(t *testing.T) {
+	mockTime := time.Date(2025, 3, 26, 14, 0, 0, 0, time.UTC)
+	timeNow = func() time.Time { return mockTime }
+	defer func() { timeNow = time.Now }()
+
+	savePath := filepath.Join(t.TempDir(), "state.json")
+	s := &State{data: &data{}, savePath: savePath}
+	require.Nil(t, s.GetMaintenance())
+	require.Equal(t, time.Duration(0), s.GetMaintenance().Duration())
+
+	s.SetMaintenance(14 * 24 * time.Hour)
+	maintenance := s.GetMaintenance()
+	require.Equal(t, &Maintenance{Extend: 14 * 24 * time.Hour, Since: mockTime}, maintenance)
+	require.NotSame(t, s.data.Maintenance, maintenance)
+	require.Equal(t, 14*24*time.Hour, maintenance.Duration())
+
+	loaded, err := New(&Options{SavePath: savePath})
+	require.Nil(t, err)
+	require.Equal(t, maintenance, loaded.GetMaintenance())
+
+	s.ClearMaintenance()
+	require.Nil(t, s.GetMaintenance())
+	loaded, err = New(&Options{SavePath: savePath})
+	require.Nil(t, err)
+	require.Nil(t, loaded.GetMaintenance())
 }
 
 func TestGetLastSeen(t *testing.T) {
@@ -242,6 +700,8 @@ func TestUpdateActionLastRun(t *testing.T) {
 	os.Remove("test_state.json")
 	defer os.Remove("test_state.json")
 
+	clk := clock.NewFake(time.Date(2025, 3, 26, 14, 0, 0, 0, time.UTC))
+
 	s := &State{
 		data: &data{
 			Actions: []*EncryptedAction{
@@ -249,74 +709,315 @@ func TestUpdateActionLastRun(t *testing.T) {
 			},
 		},
 		savePath: "test_state.json",
+		clock:    clk,
 	}
 	err := s.UpdateActionLastRun("non-existing")
 	require.NotNil(t, err)
 	err = s.UpdateActionLastRun("test")
 	require.Nil(t, err)
-	require.GreaterOrEqual(t, float64(1), time.Since(s.data.Actions[0].LastRun).Seconds())
+	require.Equal(t, clk.Now(), s.data.Actions[0].LastRun)
 }
 
-func TestGetActionLastRun(t *testing.T) {
+func TestNewClock(t *testing.T) {
+	clk := clock.NewFake(time.Date(2025, 3, 26, 14, 0, 0, 0, time.UTC))
+	s, err := New(&Options{SavePath: filepath.Join(t.TempDir(), "state.json"), Clock: clk})
+	require.Nil(t, err)
+	require.Equal(t, clk.Now(), s.GetLastSeen())
+
+	clk.Advance(time.Hour)
+	s.UpdateLastSeen(nil)
+	require.Equal(t, clk.Now(), s.GetLastSeen())
+}
+
+func TestMarkActionPending(t *testing.T) {
+	os.Remove("test_state.json")
+	defer os.Remove("test_state.json")
 	mockTime, err := time.Parse("2006-01-02T15:04:05.999999-07:00", "2025-03-26T14:55:40.119447+01:00")
 	require.Nil(t, err)
+	timeNow = func() time.Time { return mockTime }
+	defer func() { timeNow = time.Now }()
 
 	s := &State{
 		data: &data{
-			LastSeen: mockTime,
 			Actions: []*EncryptedAction{
-				{UUID: "test", LastRun: mockTime},
+				{UUID: "test"},
+				{UUID: "test2"},
 			},
 		},
+		savePath: "test_state.json",
 	}
-	lr, err := s.GetActionLastRun("non-existing")
-	require.NotNil(t, err)
-	require.Equal(t, time.Time{}, lr)
+	events, cancel := s.Subscribe()
+	defer cancel()
 
-	lr, err = s.GetActionLastRun("test")
-	require.Nil(t, err)
-	require.Equal(t, s.data.Actions[0].LastRun, lr)
+	require.NotNil(t, s.MarkActionPending("non-existing"))
+	require.Nil(t, s.MarkActionPending("test"))
+	require.Equal(t, mockTime, *s.data.Actions[0].PendingSince)
+	require.Equal(t, &Event{Type: EventActionPendingConfirm, ActionUUID: "test", Time: mockTime}, <-events)
+
+	require.Nil(t, s.UpdateActionLastRun("test"))
+	require.Nil(t, s.data.Actions[0].PendingSince)
+	<-events
+
+	require.Nil(t, s.MarkActionPending("test"))
+	require.Nil(t, s.MarkActionPending("test2"))
+	<-events
+	<-events
+	s.UpdateLastSeen(nil)
+	require.Nil(t, s.data.Actions[0].PendingSince)
+	require.Nil(t, s.data.Actions[1].PendingSince)
+	require.Equal(t, &Event{Type: EventActionConfirmCancelled, ActionUUID: "test", Time: mockTime}, <-events)
+	require.Equal(t, &Event{Type: EventActionConfirmCancelled, ActionUUID: "test2", Time: mockTime}, <-events)
+	require.Empty(t, events)
 }
 
-func TestVaultRequest(t *testing.T) {
-	tests := []struct {
-		method        string
-		inputToken    string
-		inputPath     string
-		inputURL      string
-		body          io.Reader
-		mockHandler   http.HandlerFunc
-		expectedError bool
-	}{
-		{
-			method:     "GET",
-			inputToken: "test-vault-token",
-			inputPath:  "/api/vault/store/client-uuid/secret-uuid",
-			mockHandler: func(w http.ResponseWriter, r *http.Request) {
-				require.Equal(t, "GET", r.Method)
-				require.Equal(t, "/api/vault/store/client-uuid/secret-uuid", r.URL.Path)
-				require.Equal(t, "Bearer test-vault-token", r.Header.Get("Authorization"))
-				require.Empty(t, r.Header.Get("Content-Type"))
-				body, err := io.ReadAll(r.Body)
-				require.Nil(t, err)
-				require.Empty(t, body)
-				w.WriteHeader(http.StatusOK)
-			},
-		},
-		{
-			method:    "GET",
-			inputPath: "/api/vault/alive/client-uuid",
-			mockHandler: func(w http.ResponseWriter, r *http.Request) {
-				require.Equal(t, "GET", r.Method)
-				require.Equal(t, "/api/vault/alive/client-uuid", r.URL.Path)
-				require.Empty(t, r.Header.Get("Authorization"))
-				require.Empty(t, r.Header.Get("Content-Type"))
-				w.WriteHeader(http.StatusOK)
+func TestCancelActionPending(t *testing.T) {
+	os.Remove("test_state.json")
+	defer os.Remove("test_state.json")
+	mockTime, err := time.Parse("2006-01-02T15:04:05.999999-07:00", "2025-03-26T14:55:40.119447+01:00")
+	require.Nil(t, err)
+	timeNow = func() time.Time { return mockTime }
+	defer func() { timeNow = time.Now }()
+
+	pendingSince := mockTime.Add(-time.Hour)
+	s := &State{
+		data: &data{
+			Actions: []*EncryptedAction{
+				{UUID: "test", PendingSince: &pendingSince},
+				{UUID: "test2", PendingSince: &pendingSince},
 			},
 		},
-		{
-			method:    "POST",
-			inputPath: "/api/vault/store/client-uuid/secret-uuid",
+		savePath: "test_state.json",
+	}
+	events, cancel := s.Subscribe()
+	defer cancel()
+
+	require.NotNil(t, s.CancelActionPending("non-existing"))
+	require.Nil(t, s.CancelActionPending("test"))
+	require.Nil(t, s.data.Actions[0].PendingSince)
+	require.Equal(t, mockTime, *s.data.Actions[0].FireCancelledAt)
+	require.Equal(t, &pendingSince, s.data.Actions[1].PendingSince)
+	require.Nil(t, s.data.Actions[1].FireCancelledAt)
+	require.Equal(t, &Event{Type: EventActionConfirmCancelled, ActionUUID: "test", Time: mockTime}, <-events)
+
+	require.ErrorIs(t, s.CancelActionPending("test"), ErrActionNotPending)
+	require.Empty(t, events)
+}
+
+func TestRecordActionFailure(t *testing.T) {
+	os.Remove("test_state.json")
+	defer os.Remove("test_state.json")
+	mockTime, err := time.Parse("2006-01-02T15:04:05.999999-07:00", "2025-03-26T14:55:40.119447+01:00")
+	require.Nil(t, err)
+	timeNow = func() time.Time { return mockTime }
+	defer func() { timeNow = time.Now }()
+
+	s := &State{
+		data: &data{
+			Actions: []*EncryptedAction{
+				{UUID: "test"},
+			},
+		},
+		savePath: "test_state.json",
+	}
+
+	require.NotNil(t, s.RecordActionFailure("non-existing"))
+	require.Nil(t, s.RecordActionFailure("test"))
+	require.Nil(t, s.RecordActionFailure("test"))
+	require.Equal(t, 2, s.data.Actions[0].ConsecutiveFailures)
+	require.Equal(t, mockTime, *s.data.Actions[0].LastFailure)
+
+	require.Nil(t, s.UpdateActionLastRun("test"))
+	require.Equal(t, 0, s.data.Actions[0].ConsecutiveFailures)
+	require.Nil(t, s.data.Actions[0].LastFailure)
+}
+
+func TestRecordActionDelivery(t *testing.T) {
+	os.Remove("test_state.json")
+	defer os.Remove("test_state.json")
+	mockTime, err := time.Parse("2006-01-02T15:04:05.999999-07:00", "2025-03-26T14:55:40.119447+01:00")
+	require.Nil(t, err)
+	timeNow = func() time.Time { return mockTime }
+	defer func() { timeNow = time.Now }()
+
+	s := &State{
+		data: &data{
+			Actions: []*EncryptedAction{
+				{UUID: "test"},
+			},
+		},
+		savePath: "test_state.json",
+	}
+
+	require.NotNil(t, s.RecordActionDelivery("non-existing", "hash"))
+	require.Nil(t, s.RecordActionDelivery("test", "hash"))
+	require.Equal(t, "hash", s.data.Actions[0].LastDataHash)
+	require.Equal(t, mockTime, *s.data.Actions[0].LastDeliveredAt)
+}
+
+func TestSuppressActionRun(t *testing.T) {
+	os.Remove("test_state.json")
+	defer os.Remove("test_state.json")
+	mockTime, err := time.Parse("2006-01-02T15:04:05.999999-07:00", "2025-03-26T14:55:40.119447+01:00")
+	require.Nil(t, err)
+	timeNow = func() time.Time { return mockTime }
+	defer func() { timeNow = time.Now }()
+	delivered := mockTime.Add(-time.Hour)
+
+	s := &State{
+		data: &data{
+			Actions: []*EncryptedAction{
+				{UUID: "test", LastDeliveredAt: &delivered, LastDataHash: "hash"},
+			},
+		},
+		savePath: "test_state.json",
+	}
+	events, cancel := s.Subscribe()
+	defer cancel()
+
+	require.NotNil(t, s.SuppressActionRun("non-existing"))
+	require.Nil(t, s.SuppressActionRun("test"))
+	require.Equal(t, mockTime, s.data.Actions[0].LastRun)
+	require.Equal(t, delivered, *s.data.Actions[0].LastDeliveredAt)
+	require.Equal(t, &Event{Type: EventActionSuppressed, ActionUUID: "test", Time: mockTime}, <-events)
+}
+
+func TestEncryptedActionDuplicate(t *testing.T) {
+	now := time.Date(2025, 3, 26, 14, 0, 0, 0, time.UTC)
+	delivered := now.Add(-2 * time.Hour)
+	a := &EncryptedAction{UUID: "test", Action: Action{MinInterval: 1, DedupeWindow: 3}, LastDeliveredAt: &delivered}
+	a.LastDataHash = a.DataHash("data")
+
+	require.NotEqual(t, a.DataHash("data"), (&EncryptedAction{UUID: "other"}).DataHash("data"))
+	require.True(t, a.Duplicate(a.DataHash("data"), now, time.Hour))
+	require.False(t, a.Duplicate(a.DataHash("changed"), now, time.Hour))
+	require.False(t, a.Duplicate(a.DataHash("data"), now.Add(time.Hour), time.Hour))
+	require.False(t, (&EncryptedAction{UUID: "test", Action: Action{DedupeWindow: 3}}).Duplicate(a.LastDataHash, now, time.Hour))
+	require.False(t, (&EncryptedAction{UUID: "test", LastDeliveredAt: &delivered, LastDataHash: a.LastDataHash}).Duplicate(a.LastDataHash, now, time.Hour))
+}
+
+func TestEncryptedActionSeenAt(t *testing.T) {
+	lastSeen := time.Date(2025, 3, 26, 14, 0, 0, 0, time.UTC)
+	earlier := lastSeen.Add(-time.Hour)
+	later := lastSeen.Add(time.Hour)
+
+	require.Equal(t, lastSeen, (&EncryptedAction{}).SeenAt(lastSeen))
+	require.Equal(t, lastSeen, (&EncryptedAction{FireCancelledAt: &earlier}).SeenAt(lastSeen))
+	require.Equal(t, later, (&EncryptedAction{FireCancelledAt: &later}).SeenAt(lastSeen))
+
+	a := &EncryptedAction{Action: Action{ProcessAfter: 1}, FireCancelledAt: &later}
+	next, ok := a.NextRun(lastSeen, 0, time.Hour)
+	require.True(t, ok)
+	require.Equal(t, later.Add(time.Hour), next)
+
+	latest := later.Add(time.Hour)
+	require.Equal(t, latest, (&EncryptedAction{FireCancelledAt: &later, PartialSeenAt: &latest}).SeenAt(lastSeen))
+	require.Equal(t, later, (&EncryptedAction{FireCancelledAt: &later, PartialSeenAt: &earlier}).SeenAt(lastSeen))
+}
+
+func TestUpdatePartialLastSeen(t *testing.T) {
+	now := time.Date(2025, 3, 26, 14, 0, 0, 0, time.UTC)
+	lastSeen := now.Add(-8 * time.Hour)
+	pendingSince := now.Add(-time.Hour)
+	s := &State{
+		data: &data{
+			LastSeen: lastSeen,
+			Actions: []*EncryptedAction{
+				{UUID: "extended", Action: Action{ProcessAfter: 10}},
+				{UUID: "pending", Action: Action{ProcessAfter: 2}, PendingSince: &pendingSince},
+				{UUID: "long", Action: Action{ProcessAfter: 100}},
+				{UUID: "minutes", Action: Action{ProcessAfter: 600, ProcessUnit: "minute"}},
+				{UUID: "processed", Action: Action{ProcessAfter: 10}, Processed: 2},
+			},
+		},
+		savePath: filepath.Join(t.TempDir(), "state.json"),
+		clock:    clock.NewFake(now),
+	}
+	actions := s.data.Actions
+
+	require.Equal(t, 3, s.UpdatePartialLastSeen(50, time.Hour))
+	require.Equal(t, lastSeen, s.data.LastSeen)
+	require.Equal(t, now.Add(-5*time.Hour), *actions[0].PartialSeenAt)
+	require.Equal(t, now.Add(-time.Hour), *actions[1].PartialSeenAt)
+	require.Nil(t, actions[1].PendingSince)
+	require.Nil(t, actions[2].PartialSeenAt)
+	require.Equal(t, now.Add(-5*time.Hour), *actions[3].PartialSeenAt)
+	require.Nil(t, actions[4].PartialSeenAt)
+
+	next, ok := actions[0].NextRun(s.data.LastSeen, 0, time.Hour)
+	require.True(t, ok)
+	require.Equal(t, now.Add(5*time.Hour), next)
+
+	// Smaller partial check-in never moves action earlier.
+	require.Equal(t, 0, s.UpdatePartialLastSeen(10, time.Hour))
+	require.Equal(t, now.Add(-5*time.Hour), *actions[0].PartialSeenAt)
+
+	s.MarkGone()
+	for _, a := range actions {
+		require.Nil(t, a.PartialSeenAt)
+		require.Nil(t, a.FireCancelledAt)
+	}
+}
+
+func TestGetActionLastRun(t *testing.T) {
+	mockTime, err := time.Parse("2006-01-02T15:04:05.999999-07:00", "2025-03-26T14:55:40.119447+01:00")
+	require.Nil(t, err)
+
+	s := &State{
+		data: &data{
+			LastSeen: mockTime,
+			Actions: []*EncryptedAction{
+				{UUID: "test", LastRun: mockTime},
+			},
+		},
+	}
+	lr, err := s.GetActionLastRun("non-existing")
+	require.NotNil(t, err)
+	require.Equal(t, time.Time{}, lr)
+
+	lr, err = s.GetActionLastRun("test")
+	require.Nil(t, err)
+	require.Equal(t, s.data.Actions[0].LastRun, lr)
+}
+
+func TestVaultRequest(t *testing.T) {
+	tests := []struct {
+		method        string
+		inputToken    string
+		inputPath     string
+		inputURL      string
+		body          io.Reader
+		mockHandler   http.HandlerFunc
+		expectedError bool
+	}{
+		{
+			method:     "GET",
+			inputToken: "test-vault-token",
+			inputPath:  "/api/vault/store/client-uuid/secret-uuid",
+			mockHandler: func(w http.ResponseWriter, r *http.Request) {
+				require.Equal(t, "GET", r.Method)
+				require.Equal(t, "/api/vault/store/client-uuid/secret-uuid", r.URL.Path)
+				require.Equal(t, "Bearer test-vault-token", r.Header.Get("Authorization"))
+				require.Empty(t, r.Header.Get("Content-Type"))
+				body, err := io.ReadAll(r.Body)
+				require.Nil(t, err)
+				require.Empty(t, body)
+				w.WriteHeader(http.StatusOK)
+			},
+		},
+		{
+			method:    "GET",
+			inputPath: "/api/vault/alive/client-uuid",
+			mockHandler: func(w http.ResponseWriter, r *http.Request) {
+				require.Equal(t, "GET", r.Method)
+				require.Equal(t, "/api/vault/alive/client-uuid", r.URL.Path)
+				require.Empty(t, r.Header.Get("Authorization"))
+				require.Empty(t, r.Header.Get("Content-Type"))
+				w.WriteHeader(http.StatusOK)
+			},
+		},
+		{
+			method:    "POST",
+			inputPath: "/api/vault/store/client-uuid/secret-uuid",
 			body:      bytes.NewBufferString(`{"test": true}`),
 			mockHandler: func(w http.ResponseWriter, r *http.Request) {
 				require.Equal(t, "POST", r.Method)
@@ -608,7 +1309,59 @@ func TestAddAction(t *testing.T) {
 					require.Equal(t, "Bearer test-vault-token", r.Header.Get("Authorization"))
 					body, err := io.ReadAll(r.Body)
 					require.Nil(t, err)
-					require.Equal(t, "{\"key\":\"AGE-SECRET-KEY-1CUGTTN4UQCDCFQAY7QM8C4RM4KGE7LN47D5SUU9MQVHEPDPWR04Q5NN5D8\",\"process_after\":10,\"encryption\":{\"kind\":\"\"}}", string(body))
+					require.Equal(t, "{\"key\":\"AGE-SECRET-KEY-1CUGTTN4UQCDCFQAY7QM8C4RM4KGE7LN47D5SUU9MQVHEPDPWR04Q5NN5D8\",\"process_after\":10,\"comment\":\"a\",\"encryption\":{\"kind\":\"\"},\"version\":1000}", string(body))
+					w.WriteHeader(http.StatusCreated)
+				}))
+				return s
+			},
+			mockCryptFunc: func(string) (crypt.AgeInterface, error) {
+				c, err := crypt.NewAge("AGE-SECRET-KEY-1CUGTTN4UQCDCFQAY7QM8C4RM4KGE7LN47D5SUU9MQVHEPDPWR04Q5NN5D8")
+				require.Nil(t, err)
+				return c, nil
+			},
+			expectedActions: []*EncryptedAction{
+				{
+					Action: Action{
+						Kind:         "mail",
+						ProcessAfter: 10,
+						Comment:      "a",
+						Data:         "encrypted",
+					},
+					Processed: 0,
+					EncryptionMeta: EncryptionMeta{
+						Kind:     "X25519",
+						VaultURL: "",
+					},
+				},
+			},
+		},
+		{
+			inputAction: []*Action{
+				{
+					Kind:         "mail",
+					ProcessAfter: 10,
+					ProcessUnit:  "minute",
+					Comment:      "a",
+					Data:         "test",
+				},
+			},
+			inputState: func() *State {
+				s := &State{
+					data: &data{
+						LastSeen: time.Now(),
+						Actions:  []*EncryptedAction{},
+					},
+					vaultURL:        "",
+					vaultClientUUID: "random-uuid",
+					savePath:        "test_state.json",
+				}
+				return s
+			},
+			fakeHTTPServer: func() *httptest.Server {
+				s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					body, err := io.ReadAll(r.Body)
+					require.Nil(t, err)
+					require.Equal(t, "{\"key\":\"AGE-SECRET-KEY-1CUGTTN4UQCDCFQAY7QM8C4RM4KGE7LN47D5SUU9MQVHEPDPWR04Q5NN5D8\",\"process_after\":10,\"process_unit\":\"minute\",\"comment\":\"a\",\"encryption\":{\"kind\":\"\"},\"version\":1000}", string(body))
 					w.WriteHeader(http.StatusCreated)
 				}))
 				return s
@@ -623,6 +1376,7 @@ func TestAddAction(t *testing.T) {
 					Action: Action{
 						Kind:         "mail",
 						ProcessAfter: 10,
+						ProcessUnit:  "minute",
 						Comment:      "a",
 						Data:         "encrypted",
 					},
@@ -705,6 +1459,8 @@ func TestAddAction(t *testing.T) {
 			},
 		},
 	}
+	timeNow = func() time.Time { return time.Unix(0, 1000) }
+	defer func() { timeNow = time.Now }()
 	for _, test := range tests {
 		os.Remove("test_state.json")
 		defer os.Remove("test_state.json")
@@ -737,11 +1493,13 @@ func TestAddAction(t *testing.T) {
 		}
 
 		for _, a := range test.inputAction {
-			err := s.AddAction(a)
+			u, err := s.AddAction(a)
 			if test.expectedError {
 				require.Error(t, err)
+				require.Empty(t, u)
 			} else {
 				require.Nil(t, err)
+				require.Equal(t, s.data.Actions[len(s.data.Actions)-1].UUID, u)
 			}
 		}
 
@@ -749,6 +1507,7 @@ func TestAddAction(t *testing.T) {
 		for i, a := range test.expectedActions {
 			require.Equal(t, a.Action.Kind, s.data.Actions[i].Action.Kind)
 			require.Equal(t, a.Action.ProcessAfter, s.data.Actions[i].Action.ProcessAfter)
+			require.Equal(t, a.Action.ProcessUnit, s.data.Actions[i].Action.ProcessUnit)
 			require.Equal(t, a.Action.Comment, s.data.Actions[i].Action.Comment)
 			require.Equal(t, 0, s.data.Actions[i].Processed)
 			require.Equal(t, a.EncryptionMeta.Kind, s.data.Actions[i].EncryptionMeta.Kind)
@@ -1061,52 +1820,346 @@ func TestDeleteAction(t *testing.T) {
 	}
 }
 
-func TestMarkActionAsProcessed(t *testing.T) {
+func TestAddActionVaultURLOverride(t *testing.T) {
+	os.Remove("test_state.json")
+	defer os.Remove("test_state.json")
+
+	var globalRequests, overrideRequests []string
+	globalVault := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		globalRequests = append(globalRequests, r.URL.Path)
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer globalVault.Close()
+	overrideVault := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "Bearer test-vault-token", r.Header.Get("Authorization"))
+		overrideRequests = append(overrideRequests, r.URL.Path)
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer overrideVault.Close()
+
+	s := &State{
+		data: &data{
+			LastSeen: time.Now(),
+			Actions:  []*EncryptedAction{},
+		},
+		vaultURL:            globalVault.URL,
+		vaultClientUUID:     "random-uuid",
+		vaultToken:          "test-vault-token",
+		savePath:            "test_state.json",
+		additionalVaultURLs: []string{overrideVault.URL + "/"},
+	}
+
+	_, err := s.AddAction(&Action{Kind: "mail", ProcessAfter: 10, Data: "test", VaultURL: "https://attacker.example.com"})
+	require.ErrorIs(t, err, ErrVaultURLNotAllowed)
+	require.Empty(t, s.data.Actions)
+
+	overrideUUID, err := s.AddAction(&Action{Kind: "mail", ProcessAfter: 10, Data: "test", VaultURL: overrideVault.URL})
+	require.Nil(t, err)
+	globalUUID, err := s.AddAction(&Action{Kind: "mail", ProcessAfter: 10, Data: "test"})
+	require.Nil(t, err)
+
+	require.Equal(t, []string{fmt.Sprintf("/api/vault/store/random-uuid/%s", overrideUUID)}, overrideRequests)
+	require.Equal(t, []string{fmt.Sprintf("/api/vault/store/random-uuid/%s", globalUUID)}, globalRequests)
+	require.Equal(t, fmt.Sprintf("%s/api/vault/store/random-uuid/%s", overrideVault.URL, overrideUUID), s.data.Actions[0].EncryptionMeta.VaultURL)
+	require.Equal(t, fmt.Sprintf("%s/api/vault/store/random-uuid/%s", globalVault.URL, globalUUID), s.data.Actions[1].EncryptionMeta.VaultURL)
+	require.Empty(t, s.data.Actions[0].Action.VaultURL)
+}
+
+func TestDeleteActionVaultSecret(t *testing.T) {
+	os.Remove("test_state.json")
+	defer os.Remove("test_state.json")
+
+	var requested []string
+	fakeVault := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, http.MethodDelete, r.Method)
+		require.Equal(t, "Bearer client-token", r.Header.Get("Authorization"))
+		requested = append(requested, r.URL.RequestURI())
+		switch {
+		case r.URL.Path == "/released":
+			w.WriteHeader(http.StatusOK)
+		case r.URL.Query().Get("revoke") != "true":
+			w.WriteHeader(http.StatusLocked)
+		case r.URL.Path == "/forbidden":
+			w.WriteHeader(http.StatusForbidden)
+		default:
+			w.WriteHeader(http.StatusOK)
+		}
+	}))
+	defer fakeVault.Close()
+
+	s := &State{
+		data: &data{
+			Actions: []*EncryptedAction{
+				{UUID: "released", EncryptionMeta: EncryptionMeta{VaultURL: fakeVault.URL + "/released"}},
+				{UUID: "unreleased", Processed: 1, EncryptionMeta: EncryptionMeta{VaultURL: fakeVault.URL + "/unreleased"}},
+				{UUID: "forbidden", EncryptionMeta: EncryptionMeta{VaultURL: fakeVault.URL + "/forbidden"}},
+				{UUID: "processed", Processed: 2, EncryptionMeta: EncryptionMeta{VaultURL: fakeVault.URL + "/processed"}},
+				{UUID: "no-url"},
+			},
+		},
+		savePath:   "test_state.json",
+		vaultToken: "client-token",
+	}
+
+	require.Nil(t, s.DeleteAction("released"))
+	require.Nil(t, s.DeleteAction("unreleased"))
+	err := s.DeleteAction("forbidden")
+	require.ErrorIs(t, err, ErrVaultSecretNotDeleted)
+	require.ErrorContains(t, err, "status code 403")
+	require.Nil(t, s.DeleteAction("processed"))
+	require.Nil(t, s.DeleteAction("no-url"))
+
+	require.Empty(t, s.data.Actions)
+	require.Equal(t, []string{
+		"/released",
+		"/unreleased",
+		"/unreleased?revoke=true",
+		"/forbidden",
+		"/forbidden?revoke=true",
+	}, requested)
+}
+
+func TestReorderActions(t *testing.T) {
+	savePath := filepath.Join(t.TempDir(), "state.json")
 	tests := []struct {
-		inputState          func() StateInterface
-		inputUUID           string
-		expectedActions     []*EncryptedAction
-		expectedError       bool
-		fakeHTTPServer      func() *httptest.Server
-		fakeHTTPServerState func(StateInterface) *httptest.Server
+		inputUUIDs    []string
+		expectedOrder []string
+		expectedError string
 	}{
 		{
-			inputState: func() StateInterface {
-				s, err := New(&Options{})
-				require.Nil(t, err)
-				return s
-			},
-			inputUUID:       "test3",
-			expectedActions: []*EncryptedAction{},
-			expectedError:   true,
+			inputUUIDs:    []string{"c", "a", "b"},
+			expectedOrder: []string{"c", "a", "b"},
 		},
 		{
-			inputState: func() StateInterface {
-				s, err := New(&Options{SavePath: "test_state.json", VaultClientUUID: "client-random-uuid"})
-				require.Nil(t, err)
-				s.(*State).data.Actions = []*EncryptedAction{
-					{
-						Action: Action{
-							Kind:         "mail",
-							ProcessAfter: 20,
-							Comment:      "test",
-							Data:         "encrypted",
-						},
-						UUID:      "test",
-						Processed: 0,
-					},
-					{
-						Action: Action{
-							Kind:         "mail",
-							ProcessAfter: 20,
-							Comment:      "test",
-							Data:         "encrypted2",
-						},
-						UUID:      "test2",
-						Processed: 0,
-						EncryptionMeta: EncryptionMeta{
-							VaultURL: "http\r",
-						},
+			inputUUIDs:    []string{"c", "a"},
+			expectedOrder: []string{"a", "b", "c"},
+			expectedError: "order is not a permutation of actions: got 2 uuids, expected 3",
+		},
+		{
+			inputUUIDs:    []string{"c", "a", "a"},
+			expectedOrder: []string{"a", "b", "c"},
+			expectedError: "order is not a permutation of actions: uuid a listed more than once",
+		},
+		{
+			inputUUIDs:    []string{"c", "a", "d"},
+			expectedOrder: []string{"a", "b", "c"},
+			expectedError: "order is not a permutation of actions: missing action with uuid d",
+		},
+	}
+	for _, test := range tests {
+		s := &State{
+			data: &data{
+				Actions: []*EncryptedAction{{UUID: "a"}, {UUID: "b"}, {UUID: "c"}},
+			},
+			savePath: savePath,
+		}
+
+		err := s.ReorderActions(test.inputUUIDs)
+		if test.expectedError == "" {
+			require.Nil(t, err)
+		} else {
+			require.ErrorIs(t, err, ErrInvalidOrder)
+			require.EqualError(t, err, test.expectedError)
+		}
+		order := []string{}
+		for _, a := range s.data.Actions {
+			order = append(order, a.UUID)
+		}
+		require.Equal(t, test.expectedOrder, order)
+	}
+
+	loaded, err := New(&Options{SavePath: savePath})
+	require.Nil(t, err)
+	order := []string{}
+	for _, a := range loaded.GetActions() {
+		order = append(order, a.UUID)
+	}
+	require.Equal(t, []string{"c", "a", "b"}, order)
+}
+
+func TestDeleteAllActions(t *testing.T) {
+	os.Remove("test_state.json")
+	defer os.Remove("test_state.json")
+
+	var deleted []string
+	fakeVault := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, http.MethodDelete, r.Method)
+		deleted = append(deleted, r.URL.RequestURI())
+		switch {
+		case r.URL.Path == "/released":
+			w.WriteHeader(http.StatusOK)
+		case r.URL.Path == "/missing":
+			w.WriteHeader(http.StatusNotFound)
+		case r.URL.Path == "/locked" && r.URL.Query().Get("revoke") == "true":
+			w.WriteHeader(http.StatusOK)
+		default:
+			w.WriteHeader(http.StatusLocked)
+		}
+	}))
+	defer fakeVault.Close()
+
+	tests := []struct {
+		inputDeleteVaultSecrets bool
+		expectedResult          *PurgeResult
+		expectedDeleted         []string
+	}{
+		{
+			inputDeleteVaultSecrets: false,
+			expectedResult:          &PurgeResult{Deleted: 6},
+		},
+		{
+			inputDeleteVaultSecrets: true,
+			expectedResult: &PurgeResult{Deleted: 6, VaultDeleteFailed: 1, VaultNotDeleted: []*NotDeletedSecret{
+				{Action: "forbidden", VaultURL: fakeVault.URL + "/forbidden", Error: "unable to delete vault data, status code 423"},
+			}},
+			expectedDeleted: []string{"/released", "/missing", "/locked", "/locked?revoke=true", "/forbidden", "/forbidden?revoke=true"},
+		},
+	}
+	for _, test := range tests {
+		deleted = nil
+		s := &State{
+			data: &data{
+				Actions: []*EncryptedAction{
+					{UUID: "released", EncryptionMeta: EncryptionMeta{VaultURL: fakeVault.URL + "/released"}},
+					{UUID: "missing", Processed: 1, EncryptionMeta: EncryptionMeta{VaultURL: fakeVault.URL + "/missing"}},
+					{UUID: "locked", EncryptionMeta: EncryptionMeta{VaultURL: fakeVault.URL + "/locked"}},
+					{UUID: "forbidden", EncryptionMeta: EncryptionMeta{VaultURL: fakeVault.URL + "/forbidden"}},
+					{UUID: "processed", Processed: 2, EncryptionMeta: EncryptionMeta{VaultURL: fakeVault.URL + "/processed"}},
+					{UUID: "no-url"},
+				},
+			},
+			savePath: "test_state.json",
+		}
+
+		result := s.DeleteAllActions(test.inputDeleteVaultSecrets)
+		require.Equal(t, test.expectedResult, result)
+		require.Equal(t, test.expectedDeleted, deleted)
+		require.Empty(t, s.data.Actions)
+	}
+}
+
+func TestPanic(t *testing.T) {
+	now := time.Date(2025, 3, 26, 14, 0, 0, 0, time.UTC)
+	earlier := now.Add(-time.Hour)
+
+	var deleted []string
+	fakeVault := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, http.MethodDelete, r.Method)
+		deleted = append(deleted, r.URL.RequestURI())
+		switch {
+		case r.URL.Path == "/released":
+			w.WriteHeader(http.StatusOK)
+		case r.URL.Path == "/locked" && r.URL.Query().Get("revoke") == "true":
+			w.WriteHeader(http.StatusOK)
+		case r.URL.Path == "/locked":
+			w.WriteHeader(http.StatusLocked)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer fakeVault.Close()
+
+	tests := []struct {
+		inputPurge      bool
+		expectedResult  *PanicResult
+		expectedDeleted []string
+	}{
+		{
+			inputPurge:     false,
+			expectedResult: &PanicResult{Paused: 4},
+		},
+		{
+			inputPurge:      true,
+			expectedResult:  &PanicResult{Paused: 4, VaultDeleted: 2, VaultDeleteFailed: 1},
+			expectedDeleted: []string{"/released", "/locked", "/locked?revoke=true", "/failing", "/failing?revoke=true"},
+		},
+	}
+	for _, test := range tests {
+		deleted = nil
+		s := &State{
+			data: &data{
+				Actions: []*EncryptedAction{
+					{UUID: "released", EncryptionMeta: EncryptionMeta{VaultURL: fakeVault.URL + "/released"}},
+					{UUID: "locked", PendingSince: &earlier, EncryptionMeta: EncryptionMeta{VaultURL: fakeVault.URL + "/locked"}},
+					{UUID: "failing", Processed: 1, EncryptionMeta: EncryptionMeta{VaultURL: fakeVault.URL + "/failing"}},
+					{UUID: "processed", Processed: 2, EncryptionMeta: EncryptionMeta{VaultURL: fakeVault.URL + "/processed"}},
+					{UUID: "no-url"},
+				},
+			},
+			savePath: filepath.Join(t.TempDir(), "state.json"),
+			clock:    clock.NewFake(now),
+		}
+
+		result := s.Panic(test.inputPurge)
+		require.Equal(t, test.expectedResult, result)
+		require.Equal(t, test.expectedDeleted, deleted)
+		for _, a := range s.data.Actions {
+			if a.UUID == "processed" {
+				require.False(t, a.Paused())
+				continue
+			}
+			require.Equal(t, &now, a.PausedAt)
+			require.Nil(t, a.PendingSince)
+			_, ok := a.NextRun(now, 0, time.Hour)
+			require.False(t, ok)
+		}
+		if test.inputPurge {
+			require.Empty(t, s.data.Actions[0].EncryptionMeta.VaultURL)
+			require.Empty(t, s.data.Actions[1].EncryptionMeta.VaultURL)
+			require.NotEmpty(t, s.data.Actions[2].EncryptionMeta.VaultURL)
+		}
+
+		// already paused actions are not counted again
+		require.Equal(t, &PanicResult{}, s.Panic(false))
+	}
+}
+
+func TestMarkActionAsProcessed(t *testing.T) {
+	tests := []struct {
+		inputState          func() StateInterface
+		inputUUID           string
+		expectedActions     []*EncryptedAction
+		expectedError       bool
+		fakeHTTPServer      func() *httptest.Server
+		fakeHTTPServerState func(StateInterface) *httptest.Server
+	}{
+		{
+			inputState: func() StateInterface {
+				s, err := New(&Options{})
+				require.Nil(t, err)
+				return s
+			},
+			inputUUID:       "test3",
+			expectedActions: []*EncryptedAction{},
+			expectedError:   true,
+		},
+		{
+			inputState: func() StateInterface {
+				s, err := New(&Options{SavePath: "test_state.json", VaultClientUUID: "client-random-uuid"})
+				require.Nil(t, err)
+				s.(*State).data.Actions = []*EncryptedAction{
+					{
+						Action: Action{
+							Kind:         "mail",
+							ProcessAfter: 20,
+							Comment:      "test",
+							Data:         "encrypted",
+						},
+						UUID:      "test",
+						Processed: 0,
+					},
+					{
+						Action: Action{
+							Kind:         "mail",
+							ProcessAfter: 20,
+							Comment:      "test",
+							Data:         "encrypted2",
+						},
+						UUID:      "test2",
+						Processed: 0,
+						EncryptionMeta: EncryptionMeta{
+							VaultURL: "http\r",
+						},
 					},
 				}
 				return s
@@ -1345,8 +2398,13 @@ func TestMarkActionAsProcessed(t *testing.T) {
 			inputUUID:       "test",
 			expectedActions: []*EncryptedAction{},
 			fakeHTTPServerState: func(s StateInterface) *httptest.Server {
+				var deleted bool
 				srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-					require.Nil(t, s.DeleteAction("test"))
+					// DeleteAction deletes vault secret with the same server.
+					if !deleted {
+						deleted = true
+						require.Nil(t, s.DeleteAction("test"))
+					}
 					w.WriteHeader(http.StatusOK)
 				}))
 				return srv
@@ -1390,10 +2448,12 @@ func TestMarkActionAsProcessed(t *testing.T) {
 
 func TestSetActionProcessed(t *testing.T) {
 	tests := []struct {
-		inputUUID         string
-		inputProcessed    int
-		expectedError     error
-		expectedProcessed int
+		inputUUID                   string
+		inputProcessed              int
+		inputClearProcessedVaultURL bool
+		expectedError               error
+		expectedProcessed           int
+		expectedVaultURL            string
 	}{
 		{
 			inputUUID:      "non-existing",
@@ -1404,11 +2464,26 @@ func TestSetActionProcessed(t *testing.T) {
 			inputUUID:         "test",
 			inputProcessed:    1,
 			expectedProcessed: 1,
+			expectedVaultURL:  "http://vault/test",
 		},
 		{
 			inputUUID:         "test",
 			inputProcessed:    2,
 			expectedProcessed: 2,
+			expectedVaultURL:  "http://vault/test",
+		},
+		{
+			inputUUID:                   "test",
+			inputProcessed:              1,
+			inputClearProcessedVaultURL: true,
+			expectedProcessed:           1,
+			expectedVaultURL:            "http://vault/test",
+		},
+		{
+			inputUUID:                   "test",
+			inputProcessed:              2,
+			inputClearProcessedVaultURL: true,
+			expectedProcessed:           2,
 		},
 	}
 	for _, test := range tests {
@@ -1418,10 +2493,11 @@ func TestSetActionProcessed(t *testing.T) {
 		s := &State{
 			data: &data{
 				Actions: []*EncryptedAction{
-					{UUID: "test", Processed: 0},
+					{UUID: "test", Processed: 0, Action: Action{Data: "encrypted"}, EncryptionMeta: EncryptionMeta{VaultURL: "http://vault/test"}},
 				},
 			},
-			savePath: "test_state.json",
+			savePath:               "test_state.json",
+			clearProcessedVaultURL: test.inputClearProcessedVaultURL,
 		}
 
 		a, err := s.setActionProcessed(test.inputUUID, test.inputProcessed)
@@ -1433,6 +2509,8 @@ func TestSetActionProcessed(t *testing.T) {
 		}
 		require.Equal(t, test.expectedProcessed, a.Processed)
 		require.Equal(t, test.expectedProcessed, s.data.Actions[0].Processed)
+		require.Equal(t, test.expectedVaultURL, s.data.Actions[0].EncryptionMeta.VaultURL)
+		require.Equal(t, "encrypted", s.data.Actions[0].Data)
 
 		// Returned action must be a copy, so callers can read it without holding State lock.
 		a.Processed = 99
@@ -1787,137 +2865,1068 @@ func TestDecryptAction(t *testing.T) {
 	}
 }
 
-func TestSave(t *testing.T) {
-	tests := []struct {
-		inputActions    []*EncryptedAction
-		expectedData    string
-		mockAtomicWrite func(string, []byte, os.FileMode) error
-		mockJsonMarshal func(any) ([]byte, error)
-		shouldPanic     bool
-	}{
-		{
-			inputActions: []*EncryptedAction{
-				{
-					Action: Action{
-						Kind:         "mail",
-						ProcessAfter: 20,
-						Comment:      "test",
-						Data:         "encrypted",
-					},
-					UUID:      "test",
-					Processed: 1,
-				},
-			},
-			mockAtomicWrite: func(string, []byte, os.FileMode) error { return fmt.Errorf("mockAtomicWrite error") },
-			shouldPanic:     true,
-		},
-		{
-			inputActions:    []*EncryptedAction{},
-			mockJsonMarshal: func(any) ([]byte, error) { return nil, fmt.Errorf("mockJsonMarshal error") },
-			shouldPanic:     true,
-		},
-		{
-			inputActions: []*EncryptedAction{},
-			mockAtomicWrite: func(string, []byte, os.FileMode) error {
-				return fmt.Errorf("mockAtomicWrite write error")
-			},
-			shouldPanic: true,
-		},
-		{
-			inputActions: []*EncryptedAction{
-				{
-					Action: Action{
-						Kind:         "mail",
-						ProcessAfter: 20,
-						Comment:      "test",
-						Data:         "encrypted",
-					},
-					UUID:      "test",
-					Processed: 1,
-				},
-				{
-					Action: Action{
-						Kind:         "mail",
-						ProcessAfter: 20,
-						Comment:      "test",
-						Data:         "encrypted2",
-					},
-					UUID:      "test2",
-					Processed: 0,
-				},
-			},
-			expectedData: `{"last_seen":"2025-03-26T14:55:40.119447+01:00","actions":[{"kind":"mail","process_after":20,"min_interval":0,"comment":"test","data":"encrypted","uuid":"test","processed":1,"last_run":"0001-01-01T00:00:00Z","encryption":{"kind":"","vault_url":""}},{"kind":"mail","process_after":20,"min_interval":0,"comment":"test","data":"encrypted2","uuid":"test2","processed":0,"last_run":"0001-01-01T00:00:00Z","encryption":{"kind":"","vault_url":""}}]}`,
-		},
-	}
-	oldAtomicWrite := atomicWrite
-	oldLogFatalf := logFatalf
-	logFatalf = func(format string, args ...any) { panic(fmt.Sprintf(format, args...)) }
-	defer func() {
-		atomicWrite = oldAtomicWrite
-		jsonMarshal = json.Marshal
-		logFatalf = oldLogFatalf
-	}()
-	for _, test := range tests {
-		atomicWrite = oldAtomicWrite
-		if test.mockAtomicWrite != nil {
-			atomicWrite = test.mockAtomicWrite
-		}
-
-		jsonMarshal = json.Marshal
-		if test.mockJsonMarshal != nil {
-			jsonMarshal = test.mockJsonMarshal
+func TestAgePluginEncryption(t *testing.T) {
+	plainData := `{"message":"test"}`
+	var vaultKey string
+	fakeServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			var secret vault.Secret
+			require.Nil(t, json.NewDecoder(r.Body).Decode(&secret))
+			vaultKey = secret.Key
+			w.WriteHeader(http.StatusCreated)
+			return
 		}
+		json.NewEncoder(w).Encode(&vault.Secret{Key: vaultKey, ProcessAfter: 10})
+	}))
+	defer fakeServer.Close()
+	os.Remove("test_state.json")
+	defer os.Remove("test_state.json")
 
-		os.Remove("test_state.json")
-		defer os.Remove("test_state.json")
-
-		mockTime, err := time.Parse("2006-01-02T15:04:05.999999-07:00", "2025-03-26T14:55:40.119447+01:00")
-		require.Nil(t, err)
-
-		s := &State{
-			data: &data{
-				LastSeen: mockTime,
-			},
-			savePath: "test_state.json",
-		}
-		s.data.Actions = test.inputActions
+	pluginAge := new(mockCrypt)
+	pluginAge.On("Encrypt", plainData).Return("plugin-encrypted", nil)
+	pluginAge.On("Decrypt", "plugin-encrypted").Return(plainData, nil)
 
-		if test.shouldPanic {
-			require.Panics(t, s.save)
-		} else {
-			s.save()
-			data, err := os.ReadFile("test_state.json")
-			require.Nil(t, err)
-			require.Equal(t, test.expectedData, string(data))
-		}
+	s := &State{
+		data:            &data{LastSeen: time.Now(), Actions: []*EncryptedAction{}},
+		vaultURL:        fakeServer.URL,
+		vaultClientUUID: "client-random-uuid",
+		savePath:        "test_state.json",
+		pluginAge:       pluginAge,
 	}
-}
+	_, err := s.AddAction(&Action{Kind: "mail", ProcessAfter: 10, Data: plainData})
+	require.Nil(t, err)
+	require.Len(t, s.data.Actions, 1)
+	a := s.data.Actions[0]
+	require.Equal(t, crypt.PluginEncryptionKind, a.EncryptionMeta.Kind)
 
-func TestAtomicWriteUsesRestrictivePermissions(t *testing.T) {
-	path := "test_perms_state.json"
-	os.Remove(path)
-	defer os.Remove(path)
+	c, err := crypt.NewAge(vaultKey)
+	require.Nil(t, err)
+	outer, err := c.Decrypt(a.Data)
+	require.Nil(t, err)
+	require.Equal(t, "plugin-encrypted", outer)
 
-	require.NoError(t, atomicWrite(path, []byte("{}"), 0600))
+	decrypted, err := s.DecryptAction(a.UUID)
+	require.Nil(t, err)
+	require.Equal(t, plainData, decrypted.Data)
 
-	info, err := os.Stat(path)
-	require.NoError(t, err)
-	require.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	s.pluginAge = nil
+	_, err = s.DecryptAction(a.UUID)
+	require.ErrorContains(t, err, "age plugin identity is not configured")
 
-	// Open failure (missing directory) must surface as an error.
-	require.Error(t, atomicWrite("nonexistent-dir/state.json", []byte("{}"), 0600))
+	failingPluginAge := new(mockCrypt)
+	failingPluginAge.On("Encrypt", plainData).Return("", fmt.Errorf("plugin not found"))
+	s.pluginAge = failingPluginAge
+	_, err = s.AddAction(&Action{Kind: "mail", ProcessAfter: 10, Data: plainData})
+	require.ErrorContains(t, err, "plugin not found")
+	require.Len(t, s.data.Actions, 1)
 }
 
-func TestNewTightensExistingFilePermissions(t *testing.T) {
-	path := "test_perms_new_state.json"
-	os.Remove(path)
-	defer os.Remove(path)
+func TestAddActionDeadline(t *testing.T) {
+	deadline := time.Date(2999, 1, 1, 0, 0, 0, 0, time.UTC)
+	var vaultSecret vault.Secret
+	fakeServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Nil(t, json.NewDecoder(r.Body).Decode(&vaultSecret))
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer fakeServer.Close()
+	os.Remove("test_state.json")
+	defer os.Remove("test_state.json")
 
-	// World-readable file left by an older version.
-	require.NoError(t, os.WriteFile(path, []byte(`{"last_seen":"2025-03-26T14:55:40.119447+01:00","actions":[]}`), 0644))
+	s := &State{
+		data:            &data{LastSeen: time.Now(), Actions: []*EncryptedAction{}},
+		vaultURL:        fakeServer.URL,
+		vaultClientUUID: "client-random-uuid",
+		savePath:        "test_state.json",
+	}
+	_, err := s.AddAction(&Action{Kind: "mail", ProcessAfter: 10, Data: "test", Deadline: &deadline})
+	require.Nil(t, err)
+	require.Equal(t, &deadline, s.data.Actions[0].Deadline)
+	require.Equal(t, &deadline, vaultSecret.Deadline)
+}
 
-	_, err := New(&Options{SavePath: path})
-	require.NoError(t, err)
+func TestAddActionRecurringSecret(t *testing.T) {
+	var vaultSecret vault.Secret
+	fakeServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Nil(t, json.NewDecoder(r.Body).Decode(&vaultSecret))
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer fakeServer.Close()
+	os.Remove("test_state.json")
+	defer os.Remove("test_state.json")
+
+	s := &State{
+		data:            &data{LastSeen: time.Now(), Actions: []*EncryptedAction{}},
+		vaultURL:        fakeServer.URL,
+		vaultClientUUID: "client-random-uuid",
+		savePath:        "test_state.json",
+	}
+	_, err := s.AddAction(&Action{Kind: "mail", ProcessAfter: 10, Data: "test"})
+	require.Nil(t, err)
+	require.False(t, vaultSecret.Recurring)
+
+	_, err = s.AddAction(&Action{Kind: "mail", ProcessAfter: 10, MinInterval: 5, Data: "test"})
+	require.Nil(t, err)
+	require.True(t, vaultSecret.Recurring)
+}
+
+func TestAddActionSeverity(t *testing.T) {
+	var vaultSecret vault.Secret
+	fakeServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			require.Nil(t, json.NewDecoder(r.Body).Decode(&vaultSecret))
+			w.WriteHeader(http.StatusCreated)
+			return
+		}
+		json.NewEncoder(w).Encode(&vaultSecret)
+	}))
+	defer fakeServer.Close()
+
+	s := &State{
+		data:            &data{LastSeen: time.Now(), Actions: []*EncryptedAction{}},
+		vaultURL:        fakeServer.URL,
+		vaultClientUUID: "client-random-uuid",
+		savePath:        filepath.Join(t.TempDir(), "state.json"),
+	}
+	_, err := s.AddAction(&Action{Kind: "mail", ProcessAfter: 10, Data: "test"})
+	require.Nil(t, err)
+	_, err = s.AddAction(&Action{Kind: "json_post", ProcessAfter: 10, Data: "test", Severity: SeverityDestructive, OnSuccess: "https://example.com/ok"})
+	require.Nil(t, err)
+
+	require.Equal(t, SeverityNotify, s.data.Actions[0].Severity)
+	require.False(t, s.data.Actions[0].Destructive())
+	require.Equal(t, SeverityDestructive, s.data.Actions[1].Severity)
+	require.True(t, s.data.Actions[1].Destructive())
+	// callback URL is stored in plaintext metadata
+	require.Equal(t, "https://example.com/ok", s.data.Actions[1].OnSuccess)
+
+	// vault keeps only secret of last added action
+	action, err := s.DecryptAction(s.data.Actions[1].UUID)
+	require.Nil(t, err)
+	require.Equal(t, SeverityDestructive, action.Severity)
+}
+
+func TestAddActionCompress(t *testing.T) {
+	var vaultSecret vault.Secret
+	fakeServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			require.Nil(t, json.NewDecoder(r.Body).Decode(&vaultSecret))
+			w.WriteHeader(http.StatusCreated)
+			return
+		}
+		json.NewEncoder(w).Encode(&vaultSecret)
+	}))
+	defer fakeServer.Close()
+
+	s := &State{
+		data:            &data{LastSeen: time.Now(), Actions: []*EncryptedAction{}},
+		vaultURL:        fakeServer.URL,
+		vaultClientUUID: "client-random-uuid",
+		savePath:        filepath.Join(t.TempDir(), "state.json"),
+		compress:        true,
+	}
+	large := strings.Repeat("Dear lawyer, please open the safe. ", 1000)
+	tests := []struct {
+		inputData          string
+		inputCompress      bool
+		expectedCompressed bool
+	}{
+		{inputData: large, inputCompress: true, expectedCompressed: true},
+		{inputData: "x", inputCompress: true},
+		{inputData: large},
+	}
+	for i, test := range tests {
+		s.compress = test.inputCompress
+		_, err := s.AddAction(&Action{Kind: "mail", ProcessAfter: 10, Data: test.inputData, Fallback: &Fallback{Kind: "dummy", Data: "fallback"}})
+		require.Nil(t, err)
+		require.Equal(t, test.expectedCompressed, s.data.Actions[i].EncryptionMeta.Compressed)
+
+		// compressed action is decrypted regardless of current setting
+		s.compress = !test.inputCompress
+		action, err := s.DecryptAction(s.data.Actions[i].UUID)
+		require.Nil(t, err)
+		require.Equal(t, test.inputData, action.Data)
+		require.Equal(t, "fallback", action.Fallback.Data)
+	}
+	require.Less(t, len(s.data.Actions[0].Data), len(s.data.Actions[2].Data))
+}
+
+func TestCompressData(t *testing.T) {
+	compressed, ok, err := compressData(strings.Repeat("a", 1000))
+	require.Nil(t, err)
+	require.True(t, ok)
+	plain, err := decompressData(compressed)
+	require.Nil(t, err)
+	require.Equal(t, strings.Repeat("a", 1000), plain)
+
+	compressed, ok, err = compressData("short")
+	require.Nil(t, err)
+	require.False(t, ok)
+	require.Equal(t, "short", compressed)
+
+	_, err = decompressData("not gzip")
+	require.Error(t, err)
+}
+
+func TestAddActionRecipientHash(t *testing.T) {
+	fakeServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer fakeServer.Close()
+
+	salt := "0123456789abcdef"
+	s := &State{
+		data:              &data{LastSeen: time.Now(), Actions: []*EncryptedAction{}},
+		vaultURL:          fakeServer.URL,
+		vaultClientUUID:   "client-random-uuid",
+		savePath:          filepath.Join(t.TempDir(), "state.json"),
+		recipientHashSalt: salt,
+		recipient: func(a *Action) string {
+			if a.Kind == "mail" {
+				return a.Data
+			}
+			return ""
+		},
+	}
+	_, err := s.AddAction(&Action{Kind: "mail", ProcessAfter: 10, Data: "Alice@Example.com"})
+	require.Nil(t, err)
+	_, err = s.AddAction(&Action{Kind: "dummy", ProcessAfter: 10, Data: "test"})
+	require.Nil(t, err)
+
+	require.Equal(t, HashRecipient(salt, "alice@example.com"), s.data.Actions[0].RecipientHash)
+	require.NotEqual(t, HashRecipient("other-salt-value", "alice@example.com"), s.data.Actions[0].RecipientHash)
+	require.Empty(t, s.data.Actions[1].RecipientHash)
+
+	s.recipientHashSalt = ""
+	_, err = s.AddAction(&Action{Kind: "mail", ProcessAfter: 10, Data: "alice@example.com"})
+	require.Nil(t, err)
+	require.Empty(t, s.data.Actions[2].RecipientHash)
+}
+
+func TestHashRecipient(t *testing.T) {
+	hash := HashRecipient("0123456789abcdef", "alice@example.com")
+	require.Len(t, hash, 64)
+	require.Equal(t, hash, HashRecipient("0123456789abcdef", " ALICE@example.com\n"))
+	require.NotEqual(t, hash, HashRecipient("0123456789abcdef", "bob@example.com"))
+}
+
+func TestAddActionFallback(t *testing.T) {
+	var vaultSecret vault.Secret
+	fakeServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			require.Nil(t, json.NewDecoder(r.Body).Decode(&vaultSecret))
+			w.WriteHeader(http.StatusCreated)
+			return
+		}
+		json.NewEncoder(w).Encode(&vaultSecret)
+	}))
+	defer fakeServer.Close()
+
+	s := &State{
+		data:            &data{LastSeen: time.Now(), Actions: []*EncryptedAction{}},
+		vaultURL:        fakeServer.URL,
+		vaultClientUUID: "client-random-uuid",
+		savePath:        filepath.Join(t.TempDir(), "state.json"),
+	}
+	fallback := &Fallback{Kind: "json_post", Data: `{"url":"https://example.com"}`}
+	_, err := s.AddAction(&Action{Kind: "mail", ProcessAfter: 10, Data: "test", Fallback: fallback})
+	require.Nil(t, err)
+
+	stored := s.data.Actions[0]
+	require.Equal(t, "json_post", stored.Fallback.Kind)
+	require.NotEqual(t, fallback.Data, stored.Fallback.Data)
+
+	action, err := s.DecryptAction(stored.UUID)
+	require.Nil(t, err)
+	require.Equal(t, "test", action.Data)
+	require.Equal(t, fallback, action.Fallback)
+	require.Equal(t, &Action{Kind: "json_post", ProcessAfter: 10, Data: fallback.Data}, action.FallbackAction())
+}
+
+// writeTestSSHKey writes new Ed25519 SSH private key into dir and returns its path and public key.
+func writeTestSSHKey(t *testing.T, dir string) (string, string) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.Nil(t, err)
+	block, err := ssh.MarshalPrivateKey(priv, "")
+	require.Nil(t, err)
+	signer, err := ssh.NewSignerFromKey(priv)
+	require.Nil(t, err)
+	path := filepath.Join(dir, "id_ed25519")
+	require.Nil(t, os.WriteFile(path, pem.EncodeToMemory(block), 0600))
+	return path, strings.TrimSpace(string(ssh.MarshalAuthorizedKey(signer.PublicKey())))
+}
+
+func TestAddActionSSH(t *testing.T) {
+	var vaultSecret vault.Secret
+	fakeServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			require.Nil(t, json.NewDecoder(r.Body).Decode(&vaultSecret))
+			w.WriteHeader(http.StatusCreated)
+			return
+		}
+		json.NewEncoder(w).Encode(&vaultSecret)
+	}))
+	defer fakeServer.Close()
+	sshKeyFile, sshRecipient := writeTestSSHKey(t, t.TempDir())
+
+	// only recipient is configured, action can be added but not decrypted.
+	opts := &Options{VaultURL: fakeServer.URL, VaultClientUUID: "client-random-uuid", SavePath: filepath.Join(t.TempDir(), "state.json"), SSHRecipient: sshRecipient}
+	s, err := New(opts)
+	require.Nil(t, err)
+	fallback := &Fallback{Kind: "json_post", Data: `{"url":"https://example.com"}`}
+	_, err = s.AddAction(&Action{Kind: "mail", ProcessAfter: 10, Data: "test", Fallback: fallback})
+	require.Nil(t, err)
+	stored := s.GetActions()[0]
+	require.Equal(t, "X25519+ssh-ed25519", stored.EncryptionMeta.Kind)
+
+	_, err = s.DecryptAction(stored.UUID)
+	require.ErrorContains(t, err, "ssh identity is not configured")
+
+	// vault key alone is not enough, data is additionally encrypted to ssh recipient.
+	c, err := crypt.NewAge(vaultSecret.Key)
+	require.Nil(t, err)
+	inner, err := c.Decrypt(stored.Data)
+	require.Nil(t, err)
+	require.NotEqual(t, "test", inner)
+
+	opts.SSHKeyFile = sshKeyFile
+	s, err = New(opts)
+	require.Nil(t, err)
+	action, err := s.DecryptAction(stored.UUID)
+	require.Nil(t, err)
+	require.Equal(t, "test", action.Data)
+	require.Equal(t, fallback, action.Fallback)
+
+	// ssh is not configured anymore.
+	opts.SSHRecipient = ""
+	opts.SSHKeyFile = ""
+	s, err = New(opts)
+	require.Nil(t, err)
+	_, err = s.DecryptAction(stored.UUID)
+	require.ErrorContains(t, err, "is encrypted to ssh recipient, state.ssh.key_file is not configured")
+}
+
+func TestAddActionUniqueComments(t *testing.T) {
+	vaultStored := 0
+	fakeServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		vaultStored++
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer fakeServer.Close()
+	os.Remove("test_state.json")
+	defer os.Remove("test_state.json")
+
+	s := &State{
+		data: &data{LastSeen: time.Now(), Actions: []*EncryptedAction{
+			{UUID: "processed", Action: Action{Kind: "mail", Comment: "processed"}, Processed: 2},
+		}},
+		vaultURL:        fakeServer.URL,
+		vaultClientUUID: "client-random-uuid",
+		savePath:        "test_state.json",
+		uniqueComments:  true,
+	}
+	u, err := s.AddAction(&Action{Kind: "mail", ProcessAfter: 10, Data: "test", Comment: "letter to lawyer"})
+	require.Nil(t, err)
+	require.Equal(t, s.data.Actions[len(s.data.Actions)-1].UUID, u)
+	_, err = s.AddAction(&Action{Kind: "mail", ProcessAfter: 10, Data: "test", Comment: "letter to lawyer"})
+	require.ErrorIs(t, err, ErrDuplicateComment)
+	require.EqualError(t, err, "action comment already exists: letter to lawyer")
+	require.Equal(t, 1, vaultStored)
+
+	_, err = s.AddAction(&Action{Kind: "mail", ProcessAfter: 10, Data: "test", Comment: "processed"})
+	require.Nil(t, err)
+	_, err = s.AddAction(&Action{Kind: "mail", ProcessAfter: 10, Data: "test"})
+	require.Nil(t, err)
+	_, err = s.AddAction(&Action{Kind: "mail", ProcessAfter: 10, Data: "test"})
+	require.Nil(t, err)
+	require.Len(t, s.data.Actions, 5)
+
+	s.uniqueComments = false
+	_, err = s.AddAction(&Action{Kind: "mail", ProcessAfter: 10, Data: "test", Comment: "letter to lawyer"})
+	require.Nil(t, err)
+}
+
+func TestAddActionMaxActions(t *testing.T) {
+	vaultStored := 0
+	fakeServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			vaultStored++
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer fakeServer.Close()
+	os.Remove("test_state.json")
+	defer os.Remove("test_state.json")
+
+	s := &State{
+		data: &data{LastSeen: time.Now(), Actions: []*EncryptedAction{
+			{UUID: "processed", Processed: 2, LastRun: time.Now()},
+			{UUID: "pending"},
+			{UUID: "processed-first", Processed: 2, LastRun: time.Now().Add(-time.Hour)},
+		}},
+		vaultURL:        fakeServer.URL,
+		vaultClientUUID: "client-random-uuid",
+		savePath:        "test_state.json",
+		maxActions:      3,
+		overflowPolicy:  vault.OverflowStrict,
+	}
+	events, cancel := s.Subscribe()
+	defer cancel()
+
+	_, err := s.AddAction(&Action{Kind: "mail", ProcessAfter: 10, Data: "test"})
+	require.ErrorIs(t, err, ErrActionLimitReached)
+	require.EqualError(t, err, "action limit reached (3)")
+	require.Equal(t, 0, vaultStored)
+
+	s.overflowPolicy = vault.OverflowEvict
+	u, err := s.AddAction(&Action{Kind: "mail", ProcessAfter: 10, Data: "test"})
+	require.Nil(t, err)
+	require.Equal(t, 1, vaultStored)
+	evicted := <-events
+	require.Equal(t, EventActionDeleted, evicted.Type)
+	require.Equal(t, "processed-first", evicted.ActionUUID)
+	require.Equal(t, EventActionAdded, (<-events).Type)
+	require.Equal(t, []string{"processed", "pending", u}, actionUUIDs(s.data.Actions))
+
+	u2, err := s.AddAction(&Action{Kind: "mail", ProcessAfter: 10, Data: "test"})
+	require.Nil(t, err)
+	require.Equal(t, []string{"pending", u, u2}, actionUUIDs(s.data.Actions))
+
+	_, err = s.AddAction(&Action{Kind: "mail", ProcessAfter: 10, Data: "test"})
+	require.ErrorIs(t, err, ErrActionLimitReached)
+	require.Equal(t, 2, vaultStored)
+}
+
+// actionUUIDs returns uuids of actions in order.
+func actionUUIDs(actions []*EncryptedAction) []string {
+	uuids := make([]string, 0, len(actions))
+	for _, a := range actions {
+		uuids = append(uuids, a.UUID)
+	}
+	return uuids
+}
+
+func TestAddUnverifiedAction(t *testing.T) {
+	fakeServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer fakeServer.Close()
+	os.Remove("test_state.json")
+	defer os.Remove("test_state.json")
+	mockTime, err := time.Parse("2006-01-02T15:04:05.999999-07:00", "2025-03-26T14:55:40.119447+01:00")
+	require.Nil(t, err)
+	timeNow = func() time.Time { return mockTime }
+	defer func() { timeNow = time.Now }()
+
+	s := &State{
+		data:            &data{LastSeen: time.Now(), Actions: []*EncryptedAction{}},
+		vaultURL:        fakeServer.URL,
+		vaultClientUUID: "client-random-uuid",
+		savePath:        "test_state.json",
+	}
+	events, cancel := s.Subscribe()
+	defer cancel()
+
+	_, err = s.AddUnverifiedAction(&Action{Kind: "mail", ProcessAfter: 10, Data: "test"}, "")
+	require.ErrorContains(t, err, "verification token must be provided")
+	_, err = s.AddUnverifiedAction(&Action{Kind: "mail", ProcessAfter: 10, Data: "test"}, "verify-token")
+	require.Nil(t, err)
+	_, err = s.AddAction(&Action{Kind: "mail", ProcessAfter: 10, Data: "test"})
+	require.Nil(t, err)
+	unverified := s.data.Actions[0]
+	require.Equal(t, EventActionAdded, (<-events).Type)
+	require.Equal(t, EventActionAdded, (<-events).Type)
+
+	// sha256 of "verify-token", plaintext token is never stored
+	require.Equal(t, "458ba985765983a9f2054fa2073b5e80e253c3e842266cbf6f10310945c374be", unverified.VerifyTokenHash)
+	require.True(t, unverified.PendingVerification())
+	require.False(t, s.data.Actions[1].PendingVerification())
+	_, ok := unverified.NextRun(mockTime, 0, time.Hour)
+	require.False(t, ok)
+
+	_, err = s.VerifyAction("wrong-token")
+	require.ErrorIs(t, err, ErrVerifyTokenNotFound)
+	_, err = s.VerifyAction("")
+	require.ErrorIs(t, err, ErrVerifyTokenNotFound)
+
+	u, err := s.VerifyAction("verify-token")
+	require.Nil(t, err)
+	require.Equal(t, unverified.UUID, u)
+	require.False(t, unverified.PendingVerification())
+	require.Equal(t, &Event{Type: EventActionVerified, ActionUUID: u, Time: mockTime}, <-events)
+	_, ok = unverified.NextRun(mockTime, 0, time.Hour)
+	require.True(t, ok)
+
+	// token can be used only once
+	_, err = s.VerifyAction("verify-token")
+	require.ErrorIs(t, err, ErrVerifyTokenNotFound)
+}
+
+func TestAcknowledgeReceipt(t *testing.T) {
+	fakeServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer fakeServer.Close()
+	os.Remove("test_state.json")
+	defer os.Remove("test_state.json")
+	mockTime, err := time.Parse("2006-01-02T15:04:05.999999-07:00", "2025-03-26T14:55:40.119447+01:00")
+	require.Nil(t, err)
+	timeNow = func() time.Time { return mockTime }
+	defer func() { timeNow = time.Now }()
+
+	s := &State{
+		data:            &data{LastSeen: time.Now(), Actions: []*EncryptedAction{}},
+		vaultURL:        fakeServer.URL,
+		vaultClientUUID: "client-random-uuid",
+		savePath:        "test_state.json",
+	}
+	events, cancel := s.Subscribe()
+	defer cancel()
+
+	_, err = s.AddAction(&Action{Kind: "mail", ProcessAfter: 10, Data: "test", ReceiptToken: "receipt-token"})
+	require.Nil(t, err)
+	_, err = s.AddAction(&Action{Kind: "mail", ProcessAfter: 10, Data: "test"})
+	require.Nil(t, err)
+	withReceipt := s.data.Actions[0]
+	require.Equal(t, EventActionAdded, (<-events).Type)
+	require.Equal(t, EventActionAdded, (<-events).Type)
+
+	// sha256 of "receipt-token", plaintext token is never stored
+	require.Equal(t, "40f8ded8544da472d303d7871502cf82c2024a13b2074947a6e617ff0a6c7ac2", withReceipt.ReceiptTokenHash)
+	require.Empty(t, withReceipt.ReceiptToken)
+	require.Empty(t, s.data.Actions[1].ReceiptTokenHash)
+
+	_, err = s.AcknowledgeReceipt("wrong-token")
+	require.ErrorIs(t, err, ErrReceiptTokenNotFound)
+	_, err = s.AcknowledgeReceipt("")
+	require.ErrorIs(t, err, ErrReceiptTokenNotFound)
+
+	u, err := s.AcknowledgeReceipt("receipt-token")
+	require.Nil(t, err)
+	require.Equal(t, withReceipt.UUID, u)
+	require.Equal(t, mockTime, *withReceipt.ReceivedAt)
+	require.Equal(t, &Event{Type: EventActionReceived, ActionUUID: u, Time: mockTime}, <-events)
+
+	// token can be used again, e.g. after next run of recurring action
+	_, err = s.AcknowledgeReceipt("receipt-token")
+	require.Nil(t, err)
+}
+
+func TestUnacknowledged(t *testing.T) {
+	now := time.Now()
+	before := now.Add(-time.Hour)
+	tests := []struct {
+		inputAction *EncryptedAction
+		expected    bool
+	}{
+		{inputAction: &EncryptedAction{Processed: 2, LastRun: now}},
+		{inputAction: &EncryptedAction{ReceiptTokenHash: "hash"}},
+		{inputAction: &EncryptedAction{ReceiptTokenHash: "hash", Processed: 2, LastRun: now}, expected: true},
+		{inputAction: &EncryptedAction{ReceiptTokenHash: "hash", Processed: 1, LastRun: now, ReceivedAt: &before}, expected: true},
+		{inputAction: &EncryptedAction{ReceiptTokenHash: "hash", Processed: 1, LastRun: before, ReceivedAt: &now}},
+		{inputAction: &EncryptedAction{ReceiptTokenHash: "hash", Processed: 2, LastRun: now, ReceivedAt: &now}},
+	}
+	for i, test := range tests {
+		require.Equal(t, test.expected, test.inputAction.Unacknowledged(), "test #%d", i)
+	}
+}
+
+func TestNewAgePlugin(t *testing.T) {
+	defer func() { cryptNewPluginAge = crypt.NewPluginAge }()
+	os.Remove("test_state.json")
+	defer os.Remove("test_state.json")
+
+	cryptNewPluginAge = func(recipient string, identity string) (crypt.PluginAgeInterface, error) {
+		return nil, fmt.Errorf("mockCryptNewPluginAge error")
+	}
+	_, err := New(&Options{SavePath: "test_state.json", AgePluginRecipient: "age1test"})
+	require.ErrorContains(t, err, "mockCryptNewPluginAge error")
+
+	pluginAge := new(mockCrypt)
+	cryptNewPluginAge = func(recipient string, identity string) (crypt.PluginAgeInterface, error) {
+		require.Equal(t, "age1test", recipient)
+		require.Equal(t, "AGE-PLUGIN-TEST-1", identity)
+		return pluginAge, nil
+	}
+	s, err := New(&Options{SavePath: "test_state.json", AgePluginRecipient: "age1test", AgePluginIdentity: "AGE-PLUGIN-TEST-1"})
+	require.Nil(t, err)
+	require.Equal(t, pluginAge, s.(*State).pluginAge)
+
+	s, err = New(&Options{SavePath: "test_state.json"})
+	require.Nil(t, err)
+	require.Nil(t, s.(*State).pluginAge)
+}
+
+func TestVerifyVaultKeys(t *testing.T) {
+	fakeVault := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, http.MethodHead, r.Method)
+		require.Equal(t, "Bearer vault-token", r.Header.Get("Authorization"))
+		switch r.URL.Path {
+		case "/released":
+			w.WriteHeader(http.StatusOK)
+		case "/locked":
+			w.WriteHeader(http.StatusLocked)
+		case "/matching":
+			w.Header().Set(vault.ProcessAfterHeader, "10")
+			w.WriteHeader(http.StatusLocked)
+		case "/mismatch":
+			w.Header().Set(vault.ProcessAfterHeader, "5")
+			w.WriteHeader(http.StatusOK)
+		case "/invalid":
+			w.Header().Set(vault.ProcessAfterHeader, "ten")
+			w.WriteHeader(http.StatusOK)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer fakeVault.Close()
+
+	s := &State{
+		data: &data{
+			Actions: []*EncryptedAction{
+				{UUID: "released", EncryptionMeta: EncryptionMeta{VaultURL: fakeVault.URL + "/released"}},
+				{UUID: "locked", EncryptionMeta: EncryptionMeta{VaultURL: fakeVault.URL + "/locked"}},
+				{UUID: "missing", EncryptionMeta: EncryptionMeta{VaultURL: fakeVault.URL + "/missing"}},
+				{UUID: "processed", Processed: 2, EncryptionMeta: EncryptionMeta{VaultURL: fakeVault.URL + "/missing"}},
+				{UUID: "no-url", Processed: 1},
+				{UUID: "broken-url", EncryptionMeta: EncryptionMeta{VaultURL: "http\r"}},
+				{UUID: "matching", Action: Action{ProcessAfter: 10}, EncryptionMeta: EncryptionMeta{VaultURL: fakeVault.URL + "/matching"}},
+				{UUID: "mismatch", Action: Action{ProcessAfter: 10}, EncryptionMeta: EncryptionMeta{VaultURL: fakeVault.URL + "/mismatch"}},
+				{UUID: "invalid", Action: Action{ProcessAfter: 10}, EncryptionMeta: EncryptionMeta{VaultURL: fakeVault.URL + "/invalid"}},
+			},
+		},
+		vaultToken: "vault-token",
+	}
+
+	results := s.VerifyVaultKeys()
+	require.Len(t, results, 8)
+	expectedErrors := map[string]string{
+		"released":   "",
+		"locked":     "",
+		"missing":    "unable to find vault data, status code 404",
+		"no-url":     "missing vault url",
+		"broken-url": "invalid control character in URL",
+		"matching":   "",
+		"mismatch":   "vault process_after does not match action: vault 5, action 10",
+		"invalid":    `unable to parse vault process_after "ten"`,
+	}
+	for _, result := range results {
+		expectedError, ok := expectedErrors[result.UUID]
+		require.True(t, ok, "unexpected result for %s", result.UUID)
+		if expectedError == "" {
+			require.Nil(t, result.Err)
+		} else {
+			require.ErrorContains(t, result.Err, expectedError)
+		}
+		if result.UUID == "mismatch" {
+			require.ErrorIs(t, result.Err, ErrProcessAfterMismatch)
+		}
+	}
+}
+
+func TestGetVaultProcessUnit(t *testing.T) {
+	tests := []struct {
+		mockHandler   http.HandlerFunc
+		inputVaultURL string
+		expectedUnit  time.Duration
+		expectedError string
+	}{
+		{
+			inputVaultURL: "http://wrong\r",
+			expectedError: "unable to parse address",
+		},
+		{
+			mockHandler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNotFound)
+			},
+			expectedError: "unable to get vault info, status code 404",
+		},
+		{
+			mockHandler: func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(`not-json`))
+			},
+			expectedError: "invalid character",
+		},
+		{
+			mockHandler: func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(`{"process_unit":"1m30s"}`))
+			},
+			expectedError: "unknown vault process unit 1m30s",
+		},
+		{
+			mockHandler: func(w http.ResponseWriter, r *http.Request) {
+				require.Equal(t, http.MethodGet, r.Method)
+				require.Equal(t, "/api/vault/info", r.URL.Path)
+				require.Equal(t, "Bearer vault-token", r.Header.Get("Authorization"))
+				w.Write([]byte(`{"process_unit":"minute"}`))
+			},
+			expectedUnit: time.Minute,
+		},
+	}
+	for _, test := range tests {
+		vaultURL := test.inputVaultURL
+		if test.mockHandler != nil {
+			fakeVault := httptest.NewServer(test.mockHandler)
+			defer fakeVault.Close()
+			vaultURL = fakeVault.URL
+		}
+
+		s := &State{vaultURL: vaultURL, vaultToken: "vault-token"}
+		unit, err := s.GetVaultProcessUnit()
+		if test.expectedError != "" {
+			require.ErrorContains(t, err, test.expectedError)
+			continue
+		}
+		require.Nil(t, err)
+		require.Equal(t, test.expectedUnit, unit)
+	}
+}
+
+func TestSave(t *testing.T) {
+	tests := []struct {
+		inputActions    []*EncryptedAction
+		expectedData    string
+		mockAtomicWrite func(string, []byte, os.FileMode) error
+		mockJsonMarshal func(any) ([]byte, error)
+		shouldPanic     bool
+	}{
+		{
+			inputActions: []*EncryptedAction{
+				{
+					Action: Action{
+						Kind:         "mail",
+						ProcessAfter: 20,
+						Comment:      "test",
+						Data:         "encrypted",
+					},
+					UUID:      "test",
+					Processed: 1,
+				},
+			},
+			mockAtomicWrite: func(string, []byte, os.FileMode) error { return fmt.Errorf("mockAtomicWrite error") },
+			shouldPanic:     true,
+		},
+		{
+			inputActions:    []*EncryptedAction{},
+			mockJsonMarshal: func(any) ([]byte, error) { return nil, fmt.Errorf("mockJsonMarshal error") },
+			shouldPanic:     true,
+		},
+		{
+			inputActions: []*EncryptedAction{},
+			mockAtomicWrite: func(string, []byte, os.FileMode) error {
+				return fmt.Errorf("mockAtomicWrite write error")
+			},
+			shouldPanic: true,
+		},
+		{
+			inputActions: []*EncryptedAction{
+				{
+					Action: Action{
+						Kind:         "mail",
+						ProcessAfter: 20,
+						Comment:      "test",
+						Data:         "encrypted",
+					},
+					UUID:      "test",
+					Processed: 1,
+				},
+				{
+					Action: Action{
+						Kind:         "mail",
+						ProcessAfter: 20,
+						Comment:      "test",
+						Data:         "encrypted2",
+					},
+					UUID:      "test2",
+					Processed: 0,
+				},
+			},
+			expectedData: `{"last_seen":"2025-03-26T14:55:40.119447+01:00","actions":[{"kind":"mail","process_after":20,"min_interval":0,"comment":"test","data":"encrypted","uuid":"test","processed":1,"last_run":"0001-01-01T00:00:00Z","encryption":{"kind":"","vault_url":""}},{"kind":"mail","process_after":20,"min_interval":0,"comment":"test","data":"encrypted2","uuid":"test2","processed":0,"last_run":"0001-01-01T00:00:00Z","encryption":{"kind":"","vault_url":""}}]}`,
+		},
+	}
+	oldAtomicWrite := atomicWrite
+	oldLogFatalf := logFatalf
+	logFatalf = func(format string, args ...any) { panic(fmt.Sprintf(format, args...)) }
+	defer func() {
+		atomicWrite = oldAtomicWrite
+		jsonMarshal = json.Marshal
+		logFatalf = oldLogFatalf
+	}()
+	for _, test := range tests {
+		atomicWrite = oldAtomicWrite
+		if test.mockAtomicWrite != nil {
+			atomicWrite = test.mockAtomicWrite
+		}
+
+		jsonMarshal = json.Marshal
+		if test.mockJsonMarshal != nil {
+			jsonMarshal = test.mockJsonMarshal
+		}
+
+		os.Remove("test_state.json")
+		defer os.Remove("test_state.json")
+
+		mockTime, err := time.Parse("2006-01-02T15:04:05.999999-07:00", "2025-03-26T14:55:40.119447+01:00")
+		require.Nil(t, err)
+
+		s := &State{
+			data: &data{
+				LastSeen: mockTime,
+			},
+			savePath: "test_state.json",
+		}
+		s.data.Actions = test.inputActions
+
+		if test.shouldPanic {
+			require.Panics(t, s.save)
+		} else {
+			s.save()
+			data, err := os.ReadFile("test_state.json")
+			require.Nil(t, err)
+			require.Equal(t, test.expectedData, string(data))
+		}
+	}
+}
+
+func TestSavePretty(t *testing.T) {
+	savePath := filepath.Join(t.TempDir(), "state.json")
+	mockTime, err := time.Parse("2006-01-02T15:04:05.999999-07:00", "2025-03-26T14:55:40.119447+01:00")
+	require.Nil(t, err)
+
+	s := &State{
+		data: &data{
+			LastSeen: mockTime,
+			Actions:  []*EncryptedAction{{Action: Action{Kind: "mail", ProcessAfter: 20, Data: "encrypted"}, UUID: "test"}},
+		},
+		savePath: savePath,
+		pretty:   true,
+	}
+	s.save()
+
+	data, err := os.ReadFile(savePath)
+	require.Nil(t, err)
+	require.True(t, strings.HasPrefix(string(data), "{\n  \"last_seen\": \"2025-03-26T14:55:40.119447+01:00\",\n  \"actions\": [\n    {\n"), string(data))
+
+	loaded, err := New(&Options{SavePath: savePath})
+	require.Nil(t, err)
+	require.Equal(t, s.data.Actions, loaded.GetActions())
+	require.True(t, mockTime.Equal(loaded.GetLastSeen()))
+}
+
+func TestSaveBackup(t *testing.T) {
+	backupDir := filepath.Join(t.TempDir(), "backup")
+	savePath := filepath.Join(t.TempDir(), "state.json")
+	mockTime := time.Date(2025, 3, 26, 14, 55, 40, 0, time.FixedZone("CET", 3600))
+	clk := clock.NewFake(mockTime)
+
+	s, err := New(&Options{SavePath: savePath, BackupDir: backupDir, BackupKeep: 3, Clock: clk})
+	require.Nil(t, err)
+	st := s.(*State)
+
+	// files not matching backup layout are never pruned.
+	require.Nil(t, os.WriteFile(filepath.Join(backupDir, "state.notes.json"), []byte("x"), 0600))
+	require.Nil(t, os.WriteFile(filepath.Join(backupDir, "other.2020-01-01T00:00:00Z.json"), []byte("x"), 0600))
+	// backup with second resolution name is older than backups written in the same second.
+	require.Nil(t, os.WriteFile(filepath.Join(backupDir, "state.2025-03-26T13:57:40Z.json"), []byte("x"), 0600))
+
+	for i := range 3 {
+		clk.Set(mockTime.Add(2*time.Minute + time.Duration(i)*time.Millisecond))
+		st.data.Actions = append(st.data.Actions, &EncryptedAction{UUID: fmt.Sprintf("uuid-%d", i)})
+		st.save()
+	}
+	// saves without clock movement never overwrite previous backup.
+	st.data.Actions = append(st.data.Actions, &EncryptedAction{UUID: "uuid-3"})
+	st.save()
+
+	entries, err := os.ReadDir(backupDir)
+	require.Nil(t, err)
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	require.Equal(t, []string{
+		"other.2020-01-01T00:00:00Z.json",
+		"state.2025-03-26T13:57:40.001000000Z.json",
+		"state.2025-03-26T13:57:40.002000000Z.json",
+		"state.2025-03-26T13:57:40.002000001Z.json",
+		"state.notes.json",
+	}, names)
+
+	saved, err := os.ReadFile(savePath)
+	require.Nil(t, err)
+	backup, err := os.ReadFile(filepath.Join(backupDir, "state.2025-03-26T13:57:40.002000001Z.json"))
+	require.Nil(t, err)
+	require.Equal(t, saved, backup)
+
+	info, err := os.Stat(filepath.Join(backupDir, "state.2025-03-26T13:57:40.002000001Z.json"))
+	require.Nil(t, err)
+	require.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	// check-in alone doesn't write backup, maintenance change does.
+	clk.Set(mockTime.Add(10 * time.Minute))
+	st.data.LastSeen = clk.Now()
+	st.save()
+	_, err = os.Stat(filepath.Join(backupDir, "state.2025-03-26T14:05:40.000000000Z.json"))
+	require.ErrorIs(t, err, os.ErrNotExist)
+	clk.Set(mockTime.Add(11 * time.Minute))
+	st.data.Maintenance = &Maintenance{}
+	st.save()
+	_, err = os.Stat(filepath.Join(backupDir, "state.2025-03-26T14:06:40.000000000Z.json"))
+	require.Nil(t, err)
+}
+
+func TestNewBackupKeepDefault(t *testing.T) {
+	s, err := New(&Options{SavePath: filepath.Join(t.TempDir(), "state.json"), BackupDir: t.TempDir()})
+	require.Nil(t, err)
+	require.Equal(t, defaultBackupKeep, s.(*State).backupKeep)
+}
+
+func TestSnapshotAt(t *testing.T) {
+	backupDir := t.TempDir()
+	s := &State{savePath: filepath.Join(t.TempDir(), "state.json"), backupDir: backupDir}
+	require.Nil(t, os.WriteFile(filepath.Join(backupDir, "state.2025-03-26T13:00:00Z.json"), []byte(`{"last_seen":"2025-03-26T12:00:00Z","actions":[{"uuid":"first"}]}`), 0600))
+	require.Nil(t, os.WriteFile(filepath.Join(backupDir, "state.2025-03-26T14:00:00Z.json"), []byte(`{"last_seen":"2025-03-26T13:30:00Z","actions":[{"uuid":"first"},{"uuid":"second"}],"maintenance":{"extend":3600000000000}}`), 0600))
+	require.Nil(t, os.WriteFile(filepath.Join(backupDir, "state.2025-03-26T15:00:00Z.json"), []byte("{broken"), 0600))
+
+	snapshot, err := s.SnapshotAt(time.Date(2025, 3, 26, 14, 30, 0, 0, time.UTC))
+	require.Nil(t, err)
+	require.Equal(t, time.Date(2025, 3, 26, 14, 0, 0, 0, time.UTC), snapshot.Time)
+	require.True(t, time.Date(2025, 3, 26, 13, 30, 0, 0, time.UTC).Equal(snapshot.LastSeen))
+	require.Equal(t, time.Hour, snapshot.Maintenance.Duration())
+	require.Len(t, snapshot.Actions, 2)
+
+	// backup written exactly at requested time is used.
+	snapshot, err = s.SnapshotAt(time.Date(2025, 3, 26, 14, 0, 0, 0, time.FixedZone("CET", 3600)))
+	require.Nil(t, err)
+	require.Equal(t, "first", snapshot.Actions[0].UUID)
+	require.Len(t, snapshot.Actions, 1)
+	require.Nil(t, snapshot.Maintenance)
+
+	_, err = s.SnapshotAt(time.Date(2025, 3, 26, 12, 0, 0, 0, time.UTC))
+	require.ErrorIs(t, err, ErrSnapshotNotFound)
+
+	_, err = s.SnapshotAt(time.Date(2025, 3, 26, 16, 0, 0, 0, time.UTC))
+	require.ErrorContains(t, err, "unable to load state backup state.2025-03-26T15:00:00Z.json")
+
+	_, err = (&State{savePath: "state.json"}).SnapshotAt(time.Now())
+	require.ErrorIs(t, err, ErrSnapshotNotFound)
+}
+
+func TestNewBackupDirError(t *testing.T) {
+	blocker := filepath.Join(t.TempDir(), "blocker")
+	require.Nil(t, os.WriteFile(blocker, []byte("x"), 0600))
+
+	_, err := New(&Options{SavePath: filepath.Join(t.TempDir(), "state.json"), BackupDir: filepath.Join(blocker, "backup"), BackupKeep: 1})
+	require.ErrorContains(t, err, "unable to create state backup dir")
+}
+
+func TestNewOnCorrupt(t *testing.T) {
+	validState := `{"last_seen":"2025-03-26T14:55:40.119447+01:00","actions":[{"uuid":"from-backup"}]}`
+	tests := []struct {
+		inputPolicy   string
+		inputBackups  map[string]string
+		expectedError string
+		expectedUUIDs []string
+	}{
+		{
+			expectedError: "unable to decode state file",
+		},
+		{
+			inputPolicy:   OnCorruptFail,
+			expectedError: "unable to decode state file",
+		},
+		{
+			inputPolicy: OnCorruptBackupAndReset,
+		},
+		{
+			inputPolicy: OnCorruptUseBackup,
+			inputBackups: map[string]string{
+				"state.2025-03-26T13:56:40Z.json": validState,
+				"state.2025-03-26T13:57:40Z.json": "{broken",
+			},
+			expectedUUIDs: []string{"from-backup"},
+		},
+		{
+			inputPolicy: OnCorruptUseBackup,
+			inputBackups: map[string]string{
+				"state.2025-03-26T13:57:40Z.json": "{broken",
+			},
+			expectedError: "no usable backup",
+		},
+	}
+	for _, test := range tests {
+		dir := t.TempDir()
+		savePath := filepath.Join(dir, "state.json")
+		backupDir := filepath.Join(dir, "backup")
+		require.Nil(t, os.MkdirAll(backupDir, 0700))
+		require.Nil(t, os.WriteFile(savePath, []byte("{broken"), 0600))
+		for name, content := range test.inputBackups {
+			require.Nil(t, os.WriteFile(filepath.Join(backupDir, name), []byte(content), 0600))
+		}
+
+		s, err := New(&Options{SavePath: savePath, BackupDir: backupDir, BackupKeep: 2, OnCorrupt: test.inputPolicy})
+		corrupt, _ := filepath.Glob(savePath + ".corrupt.*")
+		if test.expectedError != "" {
+			require.ErrorContains(t, err, test.expectedError)
+			require.Empty(t, corrupt)
+			continue
+		}
+		require.Nil(t, err)
+		var uuids []string
+		for _, a := range s.GetActions() {
+			uuids = append(uuids, a.UUID)
+		}
+		require.Equal(t, test.expectedUUIDs, uuids)
+		require.Len(t, corrupt, 1)
+		content, err := os.ReadFile(corrupt[0])
+		require.Nil(t, err)
+		require.Equal(t, "{broken", string(content))
+	}
+}
+
+func TestNewOnCorruptResetSavesState(t *testing.T) {
+	savePath := filepath.Join(t.TempDir(), "state.json")
+	require.Nil(t, os.WriteFile(savePath, []byte("{broken"), 0600))
+	opts := &Options{SavePath: savePath, OnCorrupt: OnCorruptBackupAndReset, SignKey: "0123456789abcdef"}
+
+	_, err := New(opts)
+	require.Nil(t, err)
+
+	d, err := readStateFile(savePath)
+	require.Nil(t, err)
+	require.Empty(t, d.Actions)
+	require.NotEmpty(t, d.Signature)
+
+	// saved empty state is loaded on restart without reset.
+	opts.OnCorrupt = OnCorruptFail
+	_, err = New(opts)
+	require.Nil(t, err)
+}
+
+func TestAtomicWriteUsesRestrictivePermissions(t *testing.T) {
+	path := "test_perms_state.json"
+	os.Remove(path)
+	defer os.Remove(path)
+
+	require.NoError(t, atomicWrite(path, []byte("{}"), 0600))
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	// Open failure (missing directory) must surface as an error.
+	require.Error(t, atomicWrite("nonexistent-dir/state.json", []byte("{}"), 0600))
+}
+
+func TestNewTightensExistingFilePermissions(t *testing.T) {
+	path := "test_perms_new_state.json"
+	os.Remove(path)
+	defer os.Remove(path)
+
+	// World-readable file left by an older version.
+	require.NoError(t, os.WriteFile(path, []byte(`{"last_seen":"2025-03-26T14:55:40.119447+01:00","actions":[]}`), 0644))
+
+	_, err := New(&Options{SavePath: path})
+	require.NoError(t, err)
 
 	info, err := os.Stat(path)
 	require.NoError(t, err)
@@ -1938,3 +3947,336 @@ func TestNewChmodFailureIsNotFatal(t *testing.T) {
 	_, err := New(&Options{SavePath: path})
 	require.NoError(t, err)
 }
+
+func TestVaultRequestUnreachable(t *testing.T) {
+	s := &State{}
+	_, err := s.vaultRequest("GET", "http://broken", nil)
+	require.ErrorIs(t, err, ErrVaultUnreachable)
+}
+
+func TestNewVaultClient(t *testing.T) {
+	client := newVaultClient()
+	require.Equal(t, httpClientTimeout, client.Timeout)
+	ua, ok := client.Transport.(*useragent.Transport)
+	require.True(t, ok)
+	transport, ok := ua.Base.(*http.Transport)
+	require.True(t, ok)
+	require.Equal(t, vaultMaxIdleConns, transport.MaxIdleConns)
+	require.Equal(t, vaultMaxIdleConnsPerHost, transport.MaxIdleConnsPerHost)
+	require.Equal(t, vaultIdleConnTimeout, transport.IdleConnTimeout)
+	require.NotSame(t, http.DefaultTransport, transport)
+
+	require.Same(t, defaultVaultClient, (&State{}).client())
+	s, err := New(&Options{SavePath: filepath.Join(t.TempDir(), "state.json")})
+	require.Nil(t, err)
+	require.NotNil(t, s.(*State).httpClient)
+	require.NotSame(t, defaultVaultClient, s.(*State).client())
+}
+
+func TestVaultRequestReusesConnection(t *testing.T) {
+	const parallel = 8
+	var connections, inFlight atomic.Int32
+	var release chan struct{}
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inFlight.Add(1)
+		<-release
+		w.Write([]byte(`{"unread": "body"}`))
+	}))
+	server.Config.ConnState = func(c net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			connections.Add(1)
+		}
+	}
+	server.Start()
+	defer server.Close()
+
+	s := &State{httpClient: newVaultClient()}
+	// every round keeps parallel requests in flight at once, default transport would keep only 2 of their connections
+	for range 3 {
+		release = make(chan struct{})
+		inFlight.Store(0)
+		wg := sync.WaitGroup{}
+		for range parallel {
+			wg.Go(func() {
+				resp, err := s.vaultRequest("GET", server.URL, nil)
+				require.Nil(t, err)
+				require.Nil(t, resp.Body.Close())
+			})
+		}
+		require.Eventually(t, func() bool { return inFlight.Load() == parallel }, time.Second, time.Millisecond)
+		close(release)
+		wg.Wait()
+	}
+	require.Equal(t, int32(parallel), connections.Load())
+}
+
+func TestDecryptActionWrapResponse(t *testing.T) {
+	key, err := crypt.NewAge("")
+	require.Nil(t, err)
+	encryptedData, err := key.Encrypt(`{"message":"test"}`)
+	require.Nil(t, err)
+
+	tests := []struct {
+		handler               func(http.ResponseWriter, *http.Request)
+		expectedErrorContains string
+	}{
+		{
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				recipient, err := crypt.NewRecipient(r.Header.Get(vault.WrapRecipientHeader))
+				require.Nil(t, err)
+				wrappedKey, err := recipient.Encrypt(key.GetPrivateKey())
+				require.Nil(t, err)
+				json.NewEncoder(w).Encode(&vault.Secret{Key: wrappedKey, EncryptionMeta: vault.EncryptionMeta{Kind: crypt.WrapEncryptionKind}})
+			},
+		},
+		{
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				json.NewEncoder(w).Encode(&vault.Secret{Key: key.GetPrivateKey(), EncryptionMeta: vault.EncryptionMeta{Kind: crypt.EncryptionKind}})
+			},
+			expectedErrorContains: "remote vault does not support wrap_response",
+		},
+		{
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				json.NewEncoder(w).Encode(&vault.Secret{Key: key.GetPrivateKey(), EncryptionMeta: vault.EncryptionMeta{Kind: crypt.WrapEncryptionKind}})
+			},
+			expectedErrorContains: "unable to unwrap vault key",
+		},
+	}
+	for _, test := range tests {
+		fakeServer := httptest.NewServer(http.HandlerFunc(test.handler))
+		defer fakeServer.Close()
+
+		s := &State{
+			data: &data{
+				Actions: []*EncryptedAction{
+					{
+						Action:         Action{Kind: "dummy", ProcessAfter: 10, Data: encryptedData},
+						UUID:           "test",
+						EncryptionMeta: EncryptionMeta{Kind: crypt.EncryptionKind, VaultURL: fakeServer.URL},
+					},
+				},
+			},
+			wrapResponse: true,
+		}
+		action, err := s.DecryptAction("test")
+		if test.expectedErrorContains != "" {
+			require.ErrorContains(t, err, test.expectedErrorContains)
+			continue
+		}
+		require.Nil(t, err)
+		require.Equal(t, `{"message":"test"}`, action.Data)
+	}
+}
+
+func TestDecryptActionVaultErrors(t *testing.T) {
+	tests := []struct {
+		inputStatusCode int
+		expectedError   error
+	}{
+		{inputStatusCode: http.StatusLocked, expectedError: ErrKeyNotReleased},
+		{inputStatusCode: http.StatusBadGateway, expectedError: ErrVaultUnreachable},
+		{inputStatusCode: http.StatusInternalServerError, expectedError: ErrVaultUnreachable},
+	}
+	for _, test := range tests {
+		fakeServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(test.inputStatusCode)
+		}))
+		defer fakeServer.Close()
+
+		s := &State{
+			data: &data{
+				Actions: []*EncryptedAction{
+					{
+						Action:         Action{Kind: "dummy", ProcessAfter: 10, Data: "encrypted"},
+						UUID:           "test",
+						EncryptionMeta: EncryptionMeta{Kind: crypt.EncryptionKind, VaultURL: fakeServer.URL},
+					},
+				},
+			},
+		}
+		action, err := s.DecryptAction("test")
+		require.ErrorIs(t, err, test.expectedError)
+		require.Nil(t, action)
+	}
+
+	s := &State{
+		data: &data{
+			Actions: []*EncryptedAction{
+				{UUID: "test", EncryptionMeta: EncryptionMeta{VaultURL: "http://127.0.0.1:1/unreachable"}},
+			},
+		},
+	}
+	_, err := s.DecryptAction("test")
+	require.ErrorIs(t, err, ErrVaultUnreachable)
+}
+
+func TestNextVaultVersion(t *testing.T) {
+	timeNow = func() time.Time { return time.Unix(0, 1000) }
+	defer func() { timeNow = time.Now }()
+
+	s := &State{}
+	require.Equal(t, int64(1000), s.nextVaultVersion())
+	require.Equal(t, int64(1001), s.nextVaultVersion())
+
+	timeNow = func() time.Time { return time.Unix(0, 5000) }
+	require.Equal(t, int64(5000), s.nextVaultVersion())
+
+	// clock going back does not decrease version
+	timeNow = func() time.Time { return time.Unix(0, 10) }
+	require.Equal(t, int64(5001), s.nextVaultVersion())
+}
+
+func TestVaultSecretUUIDs(t *testing.T) {
+	tests := []struct {
+		inputVaultURL      string
+		expectedClientUUID string
+		expectedSecretUUID string
+		expectedError      bool
+	}{
+		{
+			inputVaultURL:      "http://127.0.0.1:8080/api/vault/store/client/secret",
+			expectedClientUUID: "client",
+			expectedSecretUUID: "secret",
+		},
+		{
+			inputVaultURL:      "http://127.0.0.1:8080/api/vault/store/client/secret?revoke=true",
+			expectedClientUUID: "client",
+			expectedSecretUUID: "secret",
+		},
+		{
+			inputVaultURL: "http://127.0.0.1:8080",
+			expectedError: true,
+		},
+		{
+			inputVaultURL: "://wrong",
+			expectedError: true,
+		},
+	}
+	for _, test := range tests {
+		clientUUID, secretUUID, err := vaultSecretUUIDs(test.inputVaultURL)
+		if test.expectedError {
+			require.NotNil(t, err, test.inputVaultURL)
+			continue
+		}
+		require.Nil(t, err, test.inputVaultURL)
+		require.Equal(t, test.expectedClientUUID, clientUUID)
+		require.Equal(t, test.expectedSecretUUID, secretUUID)
+	}
+}
+
+func TestColocatedVault(t *testing.T) {
+	clk := clock.NewFake(time.Date(2025, 3, 26, 14, 0, 0, 0, time.UTC))
+	v, err := vault.New(&vault.Options{
+		Key:               "AGE-SECRET-KEY-1WCXTESPDAL64QQLNE6SEHHSFQVHZ2KV7KR2XCLGQ0UFSUUJXP5AS84HFG0",
+		SavePath:          filepath.Join(t.TempDir(), "vault.json"),
+		SecretProcessUnit: time.Hour,
+		Clock:             clk,
+	})
+	require.Nil(t, err)
+
+	// Nothing listens on VaultURL, every call must go to colocated vault.
+	s, err := New(&Options{
+		VaultURL:        "http://127.0.0.1:1",
+		VaultClientUUID: "client",
+		SavePath:        filepath.Join(t.TempDir(), "state.json"),
+		Vault:           v,
+		Clock:           clk,
+	})
+	require.Nil(t, err)
+
+	unit, err := s.GetVaultProcessUnit()
+	require.Nil(t, err)
+	require.Equal(t, time.Hour, unit)
+
+	u, err := s.AddAction(&Action{Kind: "dummy", ProcessAfter: 1, Data: `{"message":"test"}`})
+	require.Nil(t, err)
+	a, _ := s.GetAction(u)
+	require.Equal(t, "http://127.0.0.1:1/api/vault/store/client/"+u, a.EncryptionMeta.VaultURL)
+	for _, result := range s.VerifyVaultKeys() {
+		require.Nil(t, result.Err)
+	}
+
+	_, err = s.DecryptAction(u)
+	require.ErrorIs(t, err, ErrKeyNotReleased)
+
+	clk.Advance(2 * time.Hour)
+	action, err := s.DecryptAction(u)
+	require.Nil(t, err)
+	require.Equal(t, `{"message":"test"}`, action.Data)
+
+	require.Nil(t, s.MarkActionAsProcessed(u))
+	a, _ = s.GetAction(u)
+	require.Equal(t, 2, a.Processed)
+	_, err = v.GetSecretMeta("client", u)
+	require.NotNil(t, err)
+
+	// Unreleased secret is revoked when action is deleted.
+	u, err = s.AddAction(&Action{Kind: "dummy", ProcessAfter: 10, Data: `{"message":"test"}`})
+	require.Nil(t, err)
+	require.Nil(t, s.DeleteAction(u))
+	_, err = v.GetSecretMeta("client", u)
+	require.NotNil(t, err)
+}
+
+func TestStateSignature(t *testing.T) {
+	savePath := filepath.Join(t.TempDir(), "state.json")
+	opts := &Options{
+		VaultURL:        "http://127.0.0.1:1",
+		VaultClientUUID: "client",
+		SavePath:        savePath,
+	}
+
+	s, err := New(opts)
+	require.Nil(t, err)
+	s.UpdateLastSeen(nil)
+	unsignedFile, err := os.ReadFile(savePath)
+	require.Nil(t, err)
+	require.NotContains(t, string(unsignedFile), `"signature"`)
+
+	// Unsigned state is refused after state.sign.key is enabled, removing signature can't bypass the check.
+	opts.SignKey = "0123456789abcdef"
+	_, err = New(opts)
+	require.ErrorIs(t, err, ErrSignatureMissing)
+
+	// state.sign.allow_unsigned accepts it once and signs it right away.
+	opts.SignAllowUnsigned = true
+	_, err = New(opts)
+	require.Nil(t, err)
+	stateFile, err := os.ReadFile(savePath)
+	require.Nil(t, err)
+	require.Contains(t, string(stateFile), `"signature"`)
+
+	opts.SignAllowUnsigned = false
+	_, err = New(opts)
+	require.Nil(t, err)
+
+	var tampered map[string]any
+	require.Nil(t, json.Unmarshal(stateFile, &tampered))
+	tampered["last_seen"] = "2020-01-01T00:00:00Z"
+	tamperedFile, err := json.Marshal(tampered)
+	require.Nil(t, err)
+	require.Nil(t, os.WriteFile(savePath, tamperedFile, 0600))
+	_, err = New(opts)
+	require.ErrorIs(t, err, ErrSignatureMismatch)
+
+	delete(tampered, "signature")
+	tamperedFile, err = json.Marshal(tampered)
+	require.Nil(t, err)
+	require.Nil(t, os.WriteFile(savePath, tamperedFile, 0600))
+	_, err = New(opts)
+	require.ErrorIs(t, err, ErrSignatureMissing)
+
+	require.Nil(t, os.WriteFile(savePath, stateFile, 0600))
+	opts.SignKey = "fedcba9876543210"
+	_, err = New(opts)
+	require.ErrorIs(t, err, ErrSignatureMismatch)
+
+	// Signature is dropped when signing is disabled, so it does not go stale.
+	opts.SignKey = ""
+	s, err = New(opts)
+	require.Nil(t, err)
+	s.UpdateLastSeen(nil)
+	stateFile, err = os.ReadFile(savePath)
+	require.Nil(t, err)
+	require.NotContains(t, string(stateFile), `"signature"`)
+}
@@ -0,0 +1,44 @@
+package state
+
+import (
+	"errors"
+	"strings"
+)
+
+// ValidationError lists all problems found during validation, so they can be fixed at once.
+type ValidationError []error
+
+// Error returns all problems separated by semicolon.
+func (e ValidationError) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Unwrap returns all problems, so errors.Is and errors.As can match any of them.
+func (e ValidationError) Unwrap() []error {
+	return e
+}
+
+// Add appends err to problems. Problems from nested ValidationError are added one by one, nil err is ignored.
+func (e *ValidationError) Add(err error) {
+	if err == nil {
+		return
+	}
+	var nested ValidationError
+	if errors.As(err, &nested) && len(nested) > 0 {
+		*e = append(*e, nested...)
+		return
+	}
+	*e = append(*e, err)
+}
+
+// Err returns ValidationError, or nil when no problem was found.
+func (e ValidationError) Err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
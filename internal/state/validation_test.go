@@ -0,0 +1,23 @@
+package state
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidationError(t *testing.T) {
+	var errs ValidationError
+	require.Nil(t, errs.Err())
+
+	errNotFound := fmt.Errorf("%w: a", ErrDependencyNotFound)
+	errs.Add(nil)
+	errs.Add(fmt.Errorf("kind is required"))
+	errs.Add(ValidationError{fmt.Errorf("process_after should be greater than 0"), errNotFound})
+
+	require.Equal(t, ValidationError{fmt.Errorf("kind is required"), fmt.Errorf("process_after should be greater than 0"), errNotFound}, errs)
+	require.EqualError(t, errs.Err(), "kind is required; process_after should be greater than 0; dependency not found: a")
+	require.True(t, errors.Is(errs.Err(), ErrDependencyNotFound))
+}
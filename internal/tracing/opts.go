@@ -0,0 +1,5 @@
+package tracing
+
+type Options struct {
+	Endpoint string
+}
@@ -0,0 +1,39 @@
+package tracing
+
+import (
+	"context"
+	"log"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// ServiceName is reported as service.name resource attribute.
+const ServiceName = "dmh"
+
+// Initialize registers global OpenTelemetry tracer provider exporting spans
+// over OTLP/HTTP to Options.Endpoint (e.g. http://collector:4318).
+// Without Endpoint global tracer provider is left untouched (no-op).
+// Returned shutdown flushes buffered spans and stops exporter, call it before exit.
+func Initialize(opts *Options) (func(context.Context) error, error) {
+	noop := func(context.Context) error { return nil }
+	if opts.Endpoint == "" {
+		return noop, nil
+	}
+
+	exporter, err := otlptracehttp.New(context.Background(), otlptracehttp.WithEndpointURL(opts.Endpoint))
+	if err != nil {
+		return noop, err
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", ServiceName))),
+	)
+	otel.SetTracerProvider(tp)
+	log.Printf("starting tracing, exporting to %s", opts.Endpoint)
+	return tp.Shutdown, nil
+}
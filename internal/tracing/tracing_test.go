@@ -0,0 +1,42 @@
+package tracing
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+func TestInitialize(t *testing.T) {
+	originalProvider := otel.GetTracerProvider()
+	defer otel.SetTracerProvider(originalProvider)
+
+	tests := []struct {
+		inputOptions     *Options
+		expectedProvider bool
+	}{
+		{
+			inputOptions: &Options{},
+		},
+		{
+			inputOptions:     &Options{Endpoint: "http://127.0.0.1:4318"},
+			expectedProvider: true,
+		},
+	}
+
+	for _, test := range tests {
+		otel.SetTracerProvider(originalProvider)
+		shutdown, err := Initialize(test.inputOptions)
+		require.Nil(t, err)
+		tp, ok := otel.GetTracerProvider().(*sdktrace.TracerProvider)
+		require.Equal(t, test.expectedProvider, ok)
+		require.Nil(t, shutdown(context.Background()))
+		if ok {
+			// Stopped provider creates non-recording spans only.
+			_, span := tp.Tracer(ServiceName).Start(context.Background(), "test")
+			require.False(t, span.IsRecording())
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package useragent
+
+import (
+	"net/http"
+	"sync/atomic"
+
+	"dmh/internal/version"
+)
+
+// userAgent is User-Agent of outbound requests, default one is used when not set.
+var userAgent atomic.Pointer[string]
+
+// Default returns default User-Agent, dead-man-hand/<version>.
+func Default() string {
+	return "dead-man-hand/" + version.Version
+}
+
+// Set configures User-Agent of outbound requests, empty restores default.
+func Set(ua string) {
+	if ua == "" {
+		userAgent.Store(nil)
+		return
+	}
+	userAgent.Store(&ua)
+}
+
+// Get returns User-Agent of outbound requests.
+func Get() string {
+	if ua := userAgent.Load(); ua != nil {
+		return *ua
+	}
+	return Default()
+}
+
+// Transport sets User-Agent on every request which does not set it already,
+// so request headers provided by user (e.g. json_post headers) win.
+type Transport struct {
+	Base http.RoundTripper // http.DefaultTransport when nil
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("User-Agent") == "" {
+		// RoundTripper must not modify request, header is set on its copy.
+		req = req.Clone(req.Context())
+		req.Header.Set("User-Agent", Get())
+	}
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return base.RoundTrip(req)
+}
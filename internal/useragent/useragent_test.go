@@ -0,0 +1,55 @@
+package useragent
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"dmh/internal/version"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGet(t *testing.T) {
+	defer Set("")
+	require.Equal(t, "dead-man-hand/"+version.Version, Get())
+
+	Set("custom/1.0")
+	require.Equal(t, "custom/1.0", Get())
+
+	Set("")
+	require.Equal(t, Default(), Get())
+}
+
+func TestTransport(t *testing.T) {
+	defer Set("")
+	var received string
+	fakeServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Get("User-Agent")
+	}))
+	defer fakeServer.Close()
+	client := &http.Client{Transport: &Transport{}}
+
+	tests := []struct {
+		inputUserAgent   string
+		inputHeader      string
+		expectedReceived string
+	}{
+		{expectedReceived: Default()},
+		{inputUserAgent: "custom/1.0", expectedReceived: "custom/1.0"},
+		{inputUserAgent: "custom/1.0", inputHeader: "action/1.0", expectedReceived: "action/1.0"},
+	}
+	for _, test := range tests {
+		Set(test.inputUserAgent)
+		req, err := http.NewRequest(http.MethodGet, fakeServer.URL, nil)
+		require.Nil(t, err)
+		if test.inputHeader != "" {
+			req.Header.Set("User-Agent", test.inputHeader)
+		}
+		resp, err := client.Do(req)
+		require.Nil(t, err)
+		resp.Body.Close()
+		require.Equal(t, test.expectedReceived, received)
+		require.Equal(t, test.inputHeader, req.Header.Get("User-Agent"))
+	}
+}
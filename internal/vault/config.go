@@ -2,6 +2,7 @@ package vault
 
 import (
 	"fmt"
+	"net/url"
 
 	"dmh/internal/crypt"
 )
@@ -11,11 +12,55 @@ func (o *Options) Validate() error {
 	if o.SavePath == "" {
 		return fmt.Errorf("vault.file is required")
 	}
-	if o.Key == "" {
-		return fmt.Errorf("vault.key is required")
+	if o.Key != "" && o.SSHKeyFile != "" {
+		return fmt.Errorf("vault.key and vault.ssh_key_file are mutually exclusive")
 	}
-	if _, err := crypt.NewAge(o.Key); err != nil {
-		return fmt.Errorf("vault.key must be a valid age private key")
+	if o.SSHKeyFile != "" {
+		if _, err := loadSSHKey(o.SSHKeyFile); err != nil {
+			return err
+		}
+	} else {
+		if o.Key == "" {
+			return fmt.Errorf("vault.key is required")
+		}
+		if _, err := crypt.NewAge(o.Key); err != nil {
+			return fmt.Errorf("vault.key must be a valid age private key")
+		}
+	}
+	if o.FileKey != "" {
+		if _, err := crypt.NewAge(o.FileKey); err != nil {
+			return fmt.Errorf("vault.file_key must be a valid age private key")
+		}
+	}
+	if o.MaxSecretsPerClient < 0 {
+		return fmt.Errorf("vault.max_secrets_per_client should be greater or equal 0")
+	}
+	if o.MaxSecrets < 0 {
+		return fmt.Errorf("vault.max_secrets should be greater or equal 0")
+	}
+	if o.OverflowPolicy != "" && o.OverflowPolicy != OverflowStrict && o.OverflowPolicy != OverflowEvict {
+		return fmt.Errorf("vault.overflow_policy should be %s or %s", OverflowStrict, OverflowEvict)
+	}
+	if o.ReleaseWebhook != "" {
+		if u, err := url.ParseRequestURI(o.ReleaseWebhook); err != nil || u.Host == "" {
+			return fmt.Errorf("vault.release_webhook must be a valid HTTP URL")
+		}
+	}
+	if o.ReleaseSkew < 0 {
+		return fmt.Errorf("vault.release_skew should be greater or equal 0")
 	}
 	return nil
 }
+
+// loadSSHKey reads vault.ssh_key_file and returns age created from it.
+func loadSSHKey(path string) (crypt.SSHAgeInterface, error) {
+	key, err := crypt.ReadSSHKeyFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read vault.ssh_key_file: %w", err)
+	}
+	c, err := crypt.NewSSHAge("", key)
+	if err != nil {
+		return nil, fmt.Errorf("vault.ssh_key_file must be a valid unencrypted SSH private key: %w", err)
+	}
+	return c, nil
+}
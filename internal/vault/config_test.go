@@ -1,12 +1,19 @@
 package vault
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
 
 func TestOptionsValidate(t *testing.T) {
+	dir := t.TempDir()
+	sshKeyFile := writeTestSSHKey(t, dir)
+	invalidSSHKeyFile := filepath.Join(dir, "invalid")
+	require.Nil(t, os.WriteFile(invalidSSHKeyFile, []byte("invalid"), 0600))
 	tests := []struct {
 		inputOptions  *Options
 		expectedError string
@@ -36,6 +43,83 @@ func TestOptionsValidate(t *testing.T) {
 			},
 			expectedError: "vault.key must be a valid age private key",
 		},
+		{
+			inputOptions: &Options{
+				SavePath:    "vault.json",
+				Key:         "AGE-SECRET-KEY-1GEUMZFAZD42WGZFGATTTJHV4SURK8LU507QVCAKXKJP6UTFMJTCS0E3QJ4",
+				EncryptFile: true,
+				FileKey:     "not-a-valid-age-key",
+			},
+			expectedError: "vault.file_key must be a valid age private key",
+		},
+		{
+			inputOptions: &Options{
+				SavePath:            "vault.json",
+				Key:                 "AGE-SECRET-KEY-1GEUMZFAZD42WGZFGATTTJHV4SURK8LU507QVCAKXKJP6UTFMJTCS0E3QJ4",
+				MaxSecretsPerClient: -1,
+			},
+			expectedError: "vault.max_secrets_per_client should be greater or equal 0",
+		},
+		{
+			inputOptions: &Options{
+				SavePath:   "vault.json",
+				Key:        "AGE-SECRET-KEY-1GEUMZFAZD42WGZFGATTTJHV4SURK8LU507QVCAKXKJP6UTFMJTCS0E3QJ4",
+				MaxSecrets: -1,
+			},
+			expectedError: "vault.max_secrets should be greater or equal 0",
+		},
+		{
+			inputOptions: &Options{
+				SavePath:    "vault.json",
+				Key:         "AGE-SECRET-KEY-1GEUMZFAZD42WGZFGATTTJHV4SURK8LU507QVCAKXKJP6UTFMJTCS0E3QJ4",
+				ReleaseSkew: -time.Second,
+			},
+			expectedError: "vault.release_skew should be greater or equal 0",
+		},
+		{
+			inputOptions: &Options{
+				SavePath:       "vault.json",
+				Key:            "AGE-SECRET-KEY-1GEUMZFAZD42WGZFGATTTJHV4SURK8LU507QVCAKXKJP6UTFMJTCS0E3QJ4",
+				OverflowPolicy: "lru",
+			},
+			expectedError: "vault.overflow_policy should be strict or evict",
+		},
+		{
+			inputOptions: &Options{
+				SavePath:       "vault.json",
+				Key:            "AGE-SECRET-KEY-1GEUMZFAZD42WGZFGATTTJHV4SURK8LU507QVCAKXKJP6UTFMJTCS0E3QJ4",
+				ReleaseWebhook: "dmh.example.com/webhook",
+			},
+			expectedError: "vault.release_webhook must be a valid HTTP URL",
+		},
+		{
+			inputOptions: &Options{
+				SavePath:   "vault.json",
+				SSHKeyFile: sshKeyFile,
+			},
+		},
+		{
+			inputOptions: &Options{
+				SavePath:   "vault.json",
+				Key:        "AGE-SECRET-KEY-1GEUMZFAZD42WGZFGATTTJHV4SURK8LU507QVCAKXKJP6UTFMJTCS0E3QJ4",
+				SSHKeyFile: sshKeyFile,
+			},
+			expectedError: "vault.key and vault.ssh_key_file are mutually exclusive",
+		},
+		{
+			inputOptions: &Options{
+				SavePath:   "vault.json",
+				SSHKeyFile: filepath.Join(dir, "missing"),
+			},
+			expectedError: "unable to read vault.ssh_key_file: stat " + filepath.Join(dir, "missing") + ": no such file or directory",
+		},
+		{
+			inputOptions: &Options{
+				SavePath:   "vault.json",
+				SSHKeyFile: invalidSSHKeyFile,
+			},
+			expectedError: "vault.ssh_key_file must be a valid unencrypted SSH private key: invalid ssh identity: ssh: no key found",
+		},
 	}
 	for _, test := range tests {
 		err := test.inputOptions.Validate()
@@ -0,0 +1,122 @@
+package vault
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"dmh/internal/useragent"
+)
+
+// Supported vault.key_source values.
+const (
+	KeySourceConfig    = "config"    // key is inline in vault.key
+	KeySourceFile      = "file"      // key is read from vault.key_file
+	KeySourceHashiCorp = "hashicorp" // key is read from HashiCorp Vault KV v2 secret
+)
+
+// hashiCorpTimeout bounds single HashiCorp Vault request.
+const hashiCorpTimeout = 10 * time.Second
+
+var (
+	// mocks for tests
+	httpClient = &http.Client{Timeout: hashiCorpTimeout, Transport: &useragent.Transport{}}
+)
+
+// HashiCorpConfig describes HashiCorp Vault KV v2 secret holding age key.
+type HashiCorpConfig struct {
+	Address string // e.g. https://vault.example.com:8200
+	Token   string // token allowed to read Path
+	Path    string // KV v2 API path without /v1/, e.g. secret/data/dmh
+	Field   string // secret field with age key, default key
+}
+
+// KeySource describes where vault age key is loaded from at startup.
+type KeySource struct {
+	Source    string // one of KeySource*, default KeySourceConfig
+	Key       string // used by KeySourceConfig
+	File      string // used by KeySourceFile
+	HashiCorp HashiCorpConfig
+}
+
+// ResolveKey returns age private key from configured source.
+// Only returned key is kept, nothing is written back to config.
+func (k *KeySource) ResolveKey() (string, error) {
+	switch k.Source {
+	case "", KeySourceConfig:
+		return k.Key, nil
+	case KeySourceFile:
+		return readKeyFile(k.File)
+	case KeySourceHashiCorp:
+		return readHashiCorpKey(&k.HashiCorp)
+	default:
+		return "", fmt.Errorf("unknown vault.key_source %s, supported are %s, %s, %s", k.Source, KeySourceConfig, KeySourceFile, KeySourceHashiCorp)
+	}
+}
+
+// readKeyFile reads key from file which must not be accessible by group or others.
+func readKeyFile(path string) (string, error) {
+	if path == "" {
+		return "", fmt.Errorf("vault.key_file is required")
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", fmt.Errorf("unable to stat vault.key_file: %w", err)
+	}
+	if perm := info.Mode().Perm(); perm&0077 != 0 {
+		return "", fmt.Errorf("vault.key_file %s permissions %#o are too open, it should be 600 or stricter", path, perm)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("unable to read vault.key_file: %w", err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// readHashiCorpKey reads key from HashiCorp Vault KV v2 secret.
+func readHashiCorpKey(c *HashiCorpConfig) (string, error) {
+	if c.Address == "" || c.Token == "" || c.Path == "" {
+		return "", fmt.Errorf("vault.hashicorp.address, vault.hashicorp.token and vault.hashicorp.path are required")
+	}
+	field := c.Field
+	if field == "" {
+		field = "key"
+	}
+
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/v1/%s", strings.TrimSuffix(c.Address, "/"), strings.TrimPrefix(c.Path, "/")), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", c.Token)
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("unable to reach HashiCorp Vault: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("HashiCorp Vault returned %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var secret struct {
+		Data struct {
+			Data map[string]any `json:"data"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &secret); err != nil {
+		return "", fmt.Errorf("unable to decode HashiCorp Vault response: %w", err)
+	}
+	key, ok := secret.Data.Data[field].(string)
+	if !ok || key == "" {
+		return "", fmt.Errorf("HashiCorp Vault secret %s has no %s field", c.Path, field)
+	}
+	return strings.TrimSpace(key), nil
+}
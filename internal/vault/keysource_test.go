@@ -0,0 +1,113 @@
+package vault
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testAgeKey = "AGE-SECRET-KEY-1WCXTESPDAL64QQLNE6SEHHSFQVHZ2KV7KR2XCLGQ0UFSUUJXP5AS84HFG0"
+
+func TestResolveKey(t *testing.T) {
+	temp := t.TempDir()
+	keyFile := filepath.Join(temp, "key")
+	require.Nil(t, os.WriteFile(keyFile, []byte(testAgeKey+"\n"), 0600))
+	openKeyFile := filepath.Join(temp, "open-key")
+	require.Nil(t, os.WriteFile(openKeyFile, []byte(testAgeKey), 0644))
+	require.Nil(t, os.Chmod(openKeyFile, 0644))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "token" {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"errors":["permission denied"]}`))
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/secret/data/dmh":
+			fmt.Fprintf(w, `{"data":{"data":{"key":"%s","other":"value"}}}`, testAgeKey)
+		case "/v1/secret/data/broken":
+			w.Write([]byte(`{"data":`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		inputKeySource        *KeySource
+		expectedKey           string
+		expectedErrorContains string
+	}{
+		{
+			inputKeySource: &KeySource{Key: testAgeKey},
+			expectedKey:    testAgeKey,
+		},
+		{
+			inputKeySource: &KeySource{Source: KeySourceConfig, Key: testAgeKey},
+			expectedKey:    testAgeKey,
+		},
+		{
+			inputKeySource:        &KeySource{Source: "awskms"},
+			expectedErrorContains: "unknown vault.key_source awskms",
+		},
+		{
+			inputKeySource: &KeySource{Source: KeySourceFile, File: keyFile},
+			expectedKey:    testAgeKey,
+		},
+		{
+			inputKeySource:        &KeySource{Source: KeySourceFile},
+			expectedErrorContains: "vault.key_file is required",
+		},
+		{
+			inputKeySource:        &KeySource{Source: KeySourceFile, File: filepath.Join(temp, "missing")},
+			expectedErrorContains: "unable to stat vault.key_file",
+		},
+		{
+			inputKeySource:        &KeySource{Source: KeySourceFile, File: openKeyFile},
+			expectedErrorContains: "permissions 0644 are too open",
+		},
+		{
+			inputKeySource: &KeySource{Source: KeySourceHashiCorp, HashiCorp: HashiCorpConfig{Address: server.URL + "/", Token: "token", Path: "/secret/data/dmh"}},
+			expectedKey:    testAgeKey,
+		},
+		{
+			inputKeySource: &KeySource{Source: KeySourceHashiCorp, HashiCorp: HashiCorpConfig{Address: server.URL, Token: "token", Path: "secret/data/dmh", Field: "other"}},
+			expectedKey:    "value",
+		},
+		{
+			inputKeySource:        &KeySource{Source: KeySourceHashiCorp, HashiCorp: HashiCorpConfig{Address: server.URL, Token: "token", Path: "secret/data/dmh", Field: "missing"}},
+			expectedErrorContains: "HashiCorp Vault secret secret/data/dmh has no missing field",
+		},
+		{
+			inputKeySource:        &KeySource{Source: KeySourceHashiCorp, HashiCorp: HashiCorpConfig{Address: server.URL, Token: "wrong", Path: "secret/data/dmh"}},
+			expectedErrorContains: `HashiCorp Vault returned 403: {"errors":["permission denied"]}`,
+		},
+		{
+			inputKeySource:        &KeySource{Source: KeySourceHashiCorp, HashiCorp: HashiCorpConfig{Address: server.URL, Token: "token", Path: "secret/data/broken"}},
+			expectedErrorContains: "unable to decode HashiCorp Vault response",
+		},
+		{
+			inputKeySource:        &KeySource{Source: KeySourceHashiCorp, HashiCorp: HashiCorpConfig{Address: server.URL}},
+			expectedErrorContains: "vault.hashicorp.address, vault.hashicorp.token and vault.hashicorp.path are required",
+		},
+		{
+			inputKeySource:        &KeySource{Source: KeySourceHashiCorp, HashiCorp: HashiCorpConfig{Address: "http://127.0.0.1:1", Token: "token", Path: "secret/data/dmh"}},
+			expectedErrorContains: "unable to reach HashiCorp Vault",
+		},
+	}
+	for _, test := range tests {
+		key, err := test.inputKeySource.ResolveKey()
+		if test.expectedErrorContains != "" {
+			require.ErrorContains(t, err, test.expectedErrorContains)
+			require.Equal(t, "", key)
+			continue
+		}
+		require.Nil(t, err)
+		require.Equal(t, test.expectedKey, key)
+	}
+}
@@ -2,10 +2,24 @@ package vault
 
 import (
 	"time"
+
+	"dmh/internal/clock"
 )
 
 type Options struct {
-	Key               string
-	SavePath          string
-	SecretProcessUnit time.Duration
+	Key                 string
+	SSHKeyFile          string // SSH private key (Ed25519 or RSA) used instead of Key
+	SavePath            string
+	SecretProcessUnit   time.Duration
+	MaxSecretsPerClient int
+	MaxSecrets          int
+	OverflowPolicy      string                                      // OverflowStrict (default) or OverflowEvict, used when secret limit is reached
+	OnSecretRelease     func(clientUUID string)                     // called after every released secret fetch, optional
+	Pretty              bool                                        // write indented vault file instead of compact JSON
+	EncryptFile         bool                                        // encrypt whole vault file, not only secret keys
+	FileKey             string                                      // age key used to encrypt vault file, Key is used when empty
+	ReleaseSkew         time.Duration                               // added to secret release time, covers clock skew between DMH and vault
+	OnClockSkew         func(clientUUID string, skew time.Duration) // called when client reports its clock, optional
+	ReleaseWebhook      string                                      // URL which gets POST when secret becomes releasable, optional
+	Clock               clock.Clock                                 // source of time, wall clock when nil
 }
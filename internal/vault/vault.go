@@ -1,19 +1,31 @@
 package vault
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"log"
+	"math"
 	"os"
+	"slices"
+	"strings"
 	"sync"
 	"time"
 
+	"dmh/internal/clock"
 	"dmh/internal/crypt"
 
 	"github.com/google/renameio/v2"
 )
 
+// encryptedFileMagic prefixes encrypted vault file, files without it are loaded as plain JSON.
+const encryptedFileMagic = "DMH-VAULT-AGE\n"
+
+// releaseEventsSize is number of release events kept in memory.
+const releaseEventsSize = 100
+
 var (
 	// mocks for tests
 	atomicWrite = func(path string, data []byte, perm os.FileMode) error {
@@ -25,10 +37,86 @@ var (
 	logFatalf   = log.Fatalf
 )
 
+// processUnits maps supported process_unit names into time units.
+var processUnits = map[string]time.Duration{
+	"second": time.Second,
+	"minute": time.Minute,
+	"hour":   time.Hour,
+}
+
+// ProcessUnit returns time unit for process_unit name.
+// It returns false when name is not one of second, minute, hour.
+func ProcessUnit(name string) (time.Duration, bool) {
+	unit, ok := processUnits[name]
+	return unit, ok
+}
+
+// ProcessUnitName returns process_unit name for time unit.
+// Units without name are returned as duration string.
+func ProcessUnitName(unit time.Duration) string {
+	for name, d := range processUnits {
+		if d == unit {
+			return name
+		}
+	}
+	return unit.String()
+}
+
+// WrapRecipientHeader carries age public key of requester.
+// When provided, released secret key is encrypted to it before it leaves vault.
+const WrapRecipientHeader = "X-Vault-Wrap-Recipient"
+
+// ProcessAfterHeader carries secret process_after in HEAD responses,
+// so DMH can check it matches action without releasing secret.
+const ProcessAfterHeader = "X-Vault-Process-After"
+
+// ClientTimeHeader carries DMH clock (RFC3339Nano) in alive requests, so vault can detect clock skew.
+const ClientTimeHeader = "X-Vault-Client-Time"
+
+// clockSkewWarning is skew between client and vault clocks which is logged.
+const clockSkewWarning = time.Minute
+
 // ErrSecretNotReleased is returned when a secret exists but its release time has
 // not passed yet.
 var ErrSecretNotReleased = errors.New("is not released yet")
 
+// NotReleasedError wraps ErrSecretNotReleased with time left until secret release.
+type NotReleasedError struct {
+	ClientUUID string
+	SecretUUID string
+	Remaining  time.Duration
+}
+
+// Error returns error message.
+func (e *NotReleasedError) Error() string {
+	return fmt.Sprintf("secret %s/%s %s", e.ClientUUID, e.SecretUUID, ErrSecretNotReleased)
+}
+
+// Unwrap allows errors.Is(err, ErrSecretNotReleased).
+func (e *NotReleasedError) Unwrap() error {
+	return ErrSecretNotReleased
+}
+
+// ErrSecretReleased is returned when secret can't be changed because it was already released.
+var ErrSecretReleased = errors.New("is already released")
+
+// ErrSecretExists is returned when secret with the same clientUUID+secretUUID is already stored.
+var ErrSecretExists = errors.New("already exists")
+
+// ErrSecretVersionStale is returned when secret version is not greater than
+// last version stored for client, e.g. when old request is replayed.
+var ErrSecretVersionStale = errors.New("version is stale")
+
+// ErrSecretLimitReached is returned when adding a secret would exceed the
+// per-client or global secret limit.
+var ErrSecretLimitReached = errors.New("secret limit reached")
+
+// Overflow policies decide what happens when secret (or action) limit is reached.
+const (
+	OverflowStrict = "strict" // new entry is rejected
+	OverflowEvict  = "evict"  // oldest finished entry is removed to make room, new entry is rejected when there is none
+)
+
 // EncryptionMeta stores information about encryption.
 type EncryptionMeta struct {
 	Kind string `json:"kind"`
@@ -36,33 +124,109 @@ type EncryptionMeta struct {
 
 // Secret stores single private key and information when it can be released.
 // Secret will be released after ProcessAfter * hour from LastSeen reported to Vault.
+// ProcessUnit overrides Vault time unit for single secret.
+// Deadline releases secret at given time even if client is still seen.
 type Secret struct {
 	Key            string         `json:"key"`
 	ProcessAfter   int            `json:"process_after"`
+	ProcessUnit    string         `json:"process_unit,omitempty"`
+	Deadline       *time.Time     `json:"deadline,omitempty"`
+	Comment        string         `json:"comment,omitempty"`   // optional non-sensitive label for operator, never affects release
+	Recurring      bool           `json:"recurring,omitempty"` // secret of recurring action, it stays in vault after release and is never stale
 	EncryptionMeta EncryptionMeta `json:"encryption"`
+	Version        int64          `json:"version,omitempty"` // increasing upload version, only used by AddSecret
+	SeenAt         *time.Time     `json:"seen_at,omitempty"` // when client was seen by partial check-in, for this secret only
+}
+
+// SecretStatus describes if secret is released, without its key.
+type SecretStatus struct {
+	Released            bool `json:"released"`
+	SecondsUntilRelease int  `json:"seconds_until_release"` // 0 when released
+}
+
+// ClientStatus describes when client was last seen and if any of its secrets is already released.
+type ClientStatus struct {
+	ClientUUID string
+	LastSeen   time.Time
+	Stale      bool // client is silent long enough that at least one secret is released
+	Secrets    int  // number of secrets stored for client
 }
 
 // VaultData stores Secrets for single clientUUID.
 type VaultData struct {
-	LastSeen time.Time          `json:"last_seen"` // when client was last seen
-	Secrets  map[string]*Secret `json:"secrets"`   // stores secrets for client, string index is secret-uuid
+	LastSeen    time.Time          `json:"last_seen"`              // when client was last seen
+	Secrets     map[string]*Secret `json:"secrets"`                // stores secrets for client, string index is secret-uuid
+	LastVersion int64              `json:"last_version,omitempty"` // highest secret version added by client
+	Extend      time.Duration      `json:"extend,omitempty"`       // maintenance extension set by client, added to ProcessAfter of every secret
+}
+
+// seenAt returns when client was last seen from secret point of view, later of LastSeen and secret SeenAt,
+// moved by maintenance extension. Secret is released relative to it.
+func (d *VaultData) seenAt(secret *Secret) time.Time {
+	seenAt := d.LastSeen
+	if secret.SeenAt != nil && secret.SeenAt.After(seenAt) {
+		seenAt = *secret.SeenAt
+	}
+	return seenAt.Add(d.Extend)
+}
+
+// ReleaseEvent describes single secret fetched from Vault after its release.
+type ReleaseEvent struct {
+	ClientUUID string    `json:"client_uuid"`
+	SecretUUID string    `json:"secret_uuid"`
+	Time       time.Time `json:"time"`
 }
 
 // Vault internal data.
 type Vault struct {
-	mtx               sync.RWMutex
-	data              map[string]*VaultData // stores vault data string index is client-uuid
-	key               string                // Vault uses this key to encrypt all secrets before storing them on disk
-	savePath          string                // Vault will dump and loads its state from this file
-	secretProcessUnit time.Duration         // time unit used to decide when key should be released.
+	mtx                 sync.RWMutex
+	data                map[string]*VaultData // stores vault data string index is client-uuid
+	key                 string                // Vault uses this key to encrypt all secrets before storing them on disk
+	sshAge              crypt.SSHAgeInterface // used instead of key when vault uses SSH key, nil otherwise
+	savePath            string                // Vault will dump and loads its state from this file
+	secretProcessUnit   time.Duration         // time unit used to decide when key should be released.
+	maxSecretsPerClient int                   // max number of secrets stored for single clientUUID, 0 - unlimited
+	maxSecrets          int                   // max number of secrets stored for all clients, 0 - unlimited
+	overflowPolicy      string                // OverflowStrict or OverflowEvict
+	onSecretRelease     func(string)          // called with clientUUID after secret release
+	pretty              bool                  // Vault file is written as indented JSON
+	encryptFile         bool                  // Vault file is encrypted with fileKey
+	fileKey             string                // Vault file encryption key, key is used when empty
+	releaseSkew         time.Duration         // secrets are released releaseSkew later than LastSeen allows
+	onClockSkew         func(string, time.Duration)
+	eventsMtx           sync.Mutex
+	releaseEvents       []ReleaseEvent // ring buffer with last releaseEventsSize release events
+	releaseEventsNext   int            // index in releaseEvents where next event will be stored
+	clock               clock.Clock    // source of time for LastSeen and release decisions, wall clock when nil
+}
+
+// clk returns Vault clock.
+func (v *Vault) clk() clock.Clock {
+	if v.clock == nil {
+		return clock.New()
+	}
+	return v.clock
 }
 
 // VaultInterface describes Vault.
 type VaultInterface interface {
 	UpdateLastSeen(string)
+	UpdatePartialLastSeen(string, int) error
+	MarkGone(string) error
+	SetExtend(string, time.Duration)
 	GetSecret(string, string) (*Secret, error)
 	AddSecret(string, string, *Secret) error
 	DeleteSecret(string, string) error
+	RevokeSecret(string, string) error
+	ExtendSecret(string, string, int) error
+	ReleaseAll(string) error
+	GetReleaseEvents() []ReleaseEvent
+	GetSecretProcessUnit() time.Duration
+	GetSecretMeta(string, string) (*Secret, error)
+	GetSecretStatus(string, string) (*SecretStatus, error)
+	StaleSecrets(time.Duration) []string
+	ClientStatuses() []ClientStatus
+	ObserveClientClock(string, time.Time) time.Duration
 }
 
 // New returns new instance of VaultInterface.
@@ -72,15 +236,33 @@ func New(opts *Options) (VaultInterface, error) {
 		return nil, fmt.Errorf("SecretProcessUnit must be bigger than second")
 	}
 	v := &Vault{
-		data:              map[string]*VaultData{},
-		key:               opts.Key,
-		savePath:          opts.SavePath,
-		secretProcessUnit: opts.SecretProcessUnit,
+		data:                map[string]*VaultData{},
+		key:                 opts.Key,
+		savePath:            opts.SavePath,
+		secretProcessUnit:   opts.SecretProcessUnit,
+		maxSecretsPerClient: opts.MaxSecretsPerClient,
+		maxSecrets:          opts.MaxSecrets,
+		overflowPolicy:      opts.OverflowPolicy,
+		onSecretRelease:     opts.OnSecretRelease,
+		pretty:              opts.Pretty,
+		encryptFile:         opts.EncryptFile,
+		fileKey:             opts.FileKey,
+		releaseSkew:         opts.ReleaseSkew,
+		onClockSkew:         opts.OnClockSkew,
+		clock:               opts.Clock,
+	}
+	if opts.SSHKeyFile != "" {
+		sshAge, err := loadSSHKey(opts.SSHKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		v.sshAge = sshAge
 	}
 	f, err := os.Open(v.savePath)
 	if err != nil {
 		if errors.Is(err, os.ErrNotExist) {
 			log.Printf("vault file %s does not exist, creating new vault", v.savePath)
+			v.startReleaseWebhook(opts.ReleaseWebhook)
 			return v, nil
 		}
 		return nil, fmt.Errorf("unable to open vault file %s: %w", v.savePath, err)
@@ -92,20 +274,147 @@ func New(opts *Options) (VaultInterface, error) {
 		log.Printf("unable to change vault file permissions to 600: %s", err)
 	}
 
-	err = json.NewDecoder(f).Decode(&v.data)
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read vault file %s: %w", v.savePath, err)
+	}
+	// Encrypted file is always decrypted, so vault.encrypt_file can be disabled without manual migration.
+	if encrypted, ok := bytes.CutPrefix(data, []byte(encryptedFileMagic)); ok {
+		data, err = v.decryptFile(encrypted)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = json.NewDecoder(bytes.NewReader(data)).Decode(&v.data)
 	if err != nil {
 		return nil, err
 	}
+	v.startReleaseWebhook(opts.ReleaseWebhook)
 	return v, nil
 }
 
+// startReleaseWebhook starts posting secret releases to webhook, nothing is started when webhook is empty.
+func (v *Vault) startReleaseWebhook(webhook string) {
+	if webhook != "" {
+		go v.notifyReleases(webhook, make(chan bool))
+	}
+}
+
+// secretCrypter encrypts secret keys and vault file.
+type secretCrypter interface {
+	Encrypt(string) (string, error)
+	Decrypt(string) (string, error)
+}
+
+// secretCrypt returns crypt used to encrypt secret keys and EncryptionMeta.Kind of secrets encrypted with it.
+func (v *Vault) secretCrypt() (secretCrypter, string, error) {
+	if v.sshAge != nil {
+		return v.sshAge, v.sshAge.Kind(), nil
+	}
+	c, err := cryptNewAge(v.key)
+	if err != nil {
+		return nil, "", err
+	}
+	return c, crypt.EncryptionKind, nil
+}
+
+// fileCrypt returns crypt used to encrypt vault file.
+func (v *Vault) fileCrypt() (secretCrypter, error) {
+	if v.fileKey == "" {
+		c, _, err := v.secretCrypt()
+		return c, err
+	}
+	return cryptNewAge(v.fileKey)
+}
+
+// decryptFile decrypts vault file content stored after encryptedFileMagic.
+func (v *Vault) decryptFile(encrypted []byte) ([]byte, error) {
+	age, err := v.fileCrypt()
+	if err != nil {
+		return nil, fmt.Errorf("unable to decrypt vault file: %w", err)
+	}
+	data, err := age.Decrypt(string(bytes.TrimSpace(encrypted)))
+	if err != nil {
+		return nil, fmt.Errorf("unable to decrypt vault file: %w", err)
+	}
+	return []byte(data), nil
+}
+
 // UpdateLastSeen updates when clientUUID was last seen by vault.
 func (v *Vault) UpdateLastSeen(clientUUID string) {
 	v.mtx.Lock()
 	defer v.mtx.Unlock()
 
 	v.ensureClientUUID(clientUUID)
-	v.data[clientUUID].LastSeen = time.Now()
+	v.data[clientUUID].LastSeen = v.clk().Now()
+	v.save()
+}
+
+// PartialSeenAt returns when client is considered seen by partial check-in with percent (1-100) at now,
+// for secret (or action) released window after client was seen.
+// Remaining time is percent of window, e.g. 50% check-in leaves half of window.
+func PartialSeenAt(now time.Time, window time.Duration, percent int) time.Time {
+	return now.Add(-window * time.Duration(100-percent) / 100)
+}
+
+// UpdatePartialLastSeen is partial check-in of clientUUID, see PartialSeenAt.
+// Release of every unreleased secret is moved to percent of its own window from now, but never earlier.
+// LastSeen is not changed, already released secrets stay released and Deadline is not moved.
+func (v *Vault) UpdatePartialLastSeen(clientUUID string, percent int) error {
+	if percent < 1 || percent > 100 {
+		return fmt.Errorf("percent should be between 1 and 100")
+	}
+
+	v.mtx.Lock()
+	defer v.mtx.Unlock()
+
+	v.ensureClientUUID(clientUUID)
+	clientData := v.data[clientUUID]
+	now := v.clk().Now()
+	for _, secret := range clientData.Secrets {
+		if now.After(v.releaseAt(clientData.seenAt(secret), secret)) {
+			continue
+		}
+		seenAt := PartialSeenAt(now, v.releaseAfter(secret), percent)
+		if seenAt.After(clientData.LastSeen) && (secret.SeenAt == nil || seenAt.After(*secret.SeenAt)) {
+			secret.SeenAt = &seenAt
+		}
+	}
+	v.save()
+	return nil
+}
+
+// goneLastSeen is LastSeen of client marked as gone, far enough in the past to release every secret.
+var goneLastSeen = time.Unix(0, 0).UTC()
+
+// MarkGone moves LastSeen of clientUUID far into the past and drops partial check-ins,
+// so all its secrets are released until client is seen again.
+// Unknown client is not created, error is returned instead.
+func (v *Vault) MarkGone(clientUUID string) error {
+	v.mtx.Lock()
+	defer v.mtx.Unlock()
+
+	clientData, ok := v.data[clientUUID]
+	if !ok {
+		return fmt.Errorf("client %s is missing", clientUUID)
+	}
+	clientData.LastSeen = goneLastSeen
+	for _, secret := range clientData.Secrets {
+		secret.SeenAt = nil
+	}
+	v.save()
+	log.Printf("client %s marked as gone", clientUUID)
+	return nil
+}
+
+// SetExtend sets maintenance extension of clientUUID, 0 disables it.
+// Secrets are released extend later, Deadline is not extended.
+func (v *Vault) SetExtend(clientUUID string, extend time.Duration) {
+	v.mtx.Lock()
+	defer v.mtx.Unlock()
+
+	v.ensureClientUUID(clientUUID)
+	v.data[clientUUID].Extend = extend
 	v.save()
 }
 
@@ -121,19 +430,21 @@ func (v *Vault) GetSecret(clientUUID string, secretUUID string) (*Secret, error)
 		return nil, fmt.Errorf("secret %s/%s is missing", clientUUID, secretUUID)
 	}
 
-	lastSeen := clientData.LastSeen
-
-	now := time.Now()
+	now := v.clk().Now()
 	secret, ok := clientData.Secrets[secretUUID]
 	if !ok {
 		return nil, fmt.Errorf("secret %s/%s is missing", clientUUID, secretUUID)
 	}
 
-	if now.Sub(lastSeen) <= time.Duration(secret.ProcessAfter)*v.secretProcessUnit {
-		return nil, fmt.Errorf("secret %s/%s %w", clientUUID, secretUUID, ErrSecretNotReleased)
+	if releaseAt := v.releaseAt(clientData.seenAt(secret), secret); !now.After(releaseAt) {
+		return nil, &NotReleasedError{
+			ClientUUID: clientUUID,
+			SecretUUID: secretUUID,
+			Remaining:  releaseAt.Sub(now),
+		}
 	}
 
-	c, err := cryptNewAge(v.key)
+	c, _, err := v.secretCrypt()
 	if err != nil {
 		return nil, err
 	}
@@ -146,27 +457,158 @@ func (v *Vault) GetSecret(clientUUID string, secretUUID string) (*Secret, error)
 	s := &Secret{
 		Key:            decryptedKey,
 		ProcessAfter:   secret.ProcessAfter,
+		ProcessUnit:    secret.ProcessUnit,
+		Deadline:       secret.Deadline,
+		Comment:        secret.Comment,
 		EncryptionMeta: secret.EncryptionMeta,
 	}
 
+	v.recordRelease(clientUUID, secretUUID)
+
 	return s, nil
 }
 
+// GetSecretMeta returns secret without key, released or not.
+// It is not counted as secret release.
+func (v *Vault) GetSecretMeta(clientUUID string, secretUUID string) (*Secret, error) {
+	v.mtx.RLock()
+	defer v.mtx.RUnlock()
+
+	clientData, ok := v.data[clientUUID]
+	if !ok {
+		return nil, fmt.Errorf("secret %s/%s is missing", clientUUID, secretUUID)
+	}
+	secret, ok := clientData.Secrets[secretUUID]
+	if !ok {
+		return nil, fmt.Errorf("secret %s/%s is missing", clientUUID, secretUUID)
+	}
+	return &Secret{
+		ProcessAfter:   secret.ProcessAfter,
+		ProcessUnit:    secret.ProcessUnit,
+		Deadline:       secret.Deadline,
+		Comment:        secret.Comment,
+		EncryptionMeta: secret.EncryptionMeta,
+	}, nil
+}
+
+// GetSecretStatus returns if secret is released and how long until it is released.
+// Key is never decrypted and it is not counted as secret release.
+func (v *Vault) GetSecretStatus(clientUUID string, secretUUID string) (*SecretStatus, error) {
+	v.mtx.RLock()
+	defer v.mtx.RUnlock()
+
+	clientData, ok := v.data[clientUUID]
+	if !ok {
+		return nil, fmt.Errorf("secret %s/%s is missing", clientUUID, secretUUID)
+	}
+	secret, ok := clientData.Secrets[secretUUID]
+	if !ok {
+		return nil, fmt.Errorf("secret %s/%s is missing", clientUUID, secretUUID)
+	}
+	remaining := v.releaseAt(clientData.seenAt(secret), secret).Sub(v.clk().Now())
+	if remaining < 0 {
+		return &SecretStatus{Released: true}, nil
+	}
+	return &SecretStatus{SecondsUntilRelease: max(int(math.Ceil(remaining.Seconds())), 1)}, nil
+}
+
+// StaleSecrets returns clientUUID/secretUUID of secrets released more than olderThan ago.
+// Client did not send heartbeat since, and DMH did not delete secret after running action,
+// so secret is most likely orphaned. Recurring secrets are kept after release on purpose and are skipped.
+func (v *Vault) StaleSecrets(olderThan time.Duration) []string {
+	v.mtx.RLock()
+	defer v.mtx.RUnlock()
+
+	stale := []string{}
+	deadline := v.clk().Now().Add(-olderThan)
+	for clientUUID, clientData := range v.data {
+		for secretUUID, secret := range clientData.Secrets {
+			if !secret.Recurring && v.releaseAt(clientData.seenAt(secret), secret).Before(deadline) {
+				stale = append(stale, clientUUID+"/"+secretUUID)
+			}
+		}
+	}
+	slices.Sort(stale)
+	return stale
+}
+
+// ClientStatuses returns status of every client, sorted by clientUUID.
+// Release is decided exactly like in GetSecret, so partial check-ins, maintenance extension and Deadline are honored.
+func (v *Vault) ClientStatuses() []ClientStatus {
+	v.mtx.RLock()
+	defer v.mtx.RUnlock()
+
+	now := v.clk().Now()
+	statuses := make([]ClientStatus, 0, len(v.data))
+	for clientUUID, clientData := range v.data {
+		status := ClientStatus{ClientUUID: clientUUID, LastSeen: clientData.LastSeen, Secrets: len(clientData.Secrets)}
+		for _, secret := range clientData.Secrets {
+			if now.After(v.releaseAt(clientData.seenAt(secret), secret)) {
+				status.Stale = true
+				break
+			}
+		}
+		statuses = append(statuses, status)
+	}
+	slices.SortFunc(statuses, func(a, b ClientStatus) int { return strings.Compare(a.ClientUUID, b.ClientUUID) })
+	return statuses
+}
+
+// GetSecretProcessUnit returns time unit used to decide when secret is released.
+func (v *Vault) GetSecretProcessUnit() time.Duration {
+	return v.secretProcessUnit
+}
+
+// GetReleaseEvents returns last release events, oldest first.
+func (v *Vault) GetReleaseEvents() []ReleaseEvent {
+	v.eventsMtx.Lock()
+	defer v.eventsMtx.Unlock()
+
+	events := make([]ReleaseEvent, 0, len(v.releaseEvents))
+	if len(v.releaseEvents) == releaseEventsSize {
+		events = append(events, v.releaseEvents[v.releaseEventsNext:]...)
+		events = append(events, v.releaseEvents[:v.releaseEventsNext]...)
+		return events
+	}
+	return append(events, v.releaseEvents...)
+}
+
 // AddSecret adds secret to Vault.
 // If secret for clientUUID+secretUUID already exists it will NOT be overridden.
 // Secrets will be encrypted with Vault.key before storing.
+// AddSecret fails with ErrSecretExists when secret is already stored and with
+// ErrSecretLimitReached when per-client or global limit is reached.
+// With OverflowEvict policy, oldest released secret is removed instead, limit is reached only when there is none.
+// Versioned secret (Version > 0) fails with ErrSecretVersionStale unless its version is
+// greater than any version added by client before, so replayed upload can't recreate deleted secret.
+// Secrets without version are accepted for older clients.
 func (v *Vault) AddSecret(clientUUID string, secretUUID string, secret *Secret) error {
 	v.mtx.Lock()
 	defer v.mtx.Unlock()
 
-	v.ensureClientUUID(clientUUID)
+	// Client is stored only with accepted secret, rejected upload must not create it.
+	clientData, ok := v.data[clientUUID]
+	if !ok {
+		clientData = v.newClientData()
+	}
 
-	_, ok := v.data[clientUUID].Secrets[secretUUID]
-	if ok {
-		return fmt.Errorf("secret %s/%s already exists", clientUUID, secretUUID)
+	if _, ok := clientData.Secrets[secretUUID]; ok {
+		return fmt.Errorf("secret %s/%s %w", clientUUID, secretUUID, ErrSecretExists)
 	}
 
-	c, err := cryptNewAge(v.key)
+	if secret.Version != 0 && secret.Version <= clientData.LastVersion {
+		return fmt.Errorf("secret %s/%s %w (%d <= %d)", clientUUID, secretUUID, ErrSecretVersionStale, secret.Version, clientData.LastVersion)
+	}
+
+	if v.maxSecretsPerClient > 0 && len(clientData.Secrets) >= v.maxSecretsPerClient && !v.evictReleased(clientUUID) {
+		return fmt.Errorf("client %s %w (%d)", clientUUID, ErrSecretLimitReached, v.maxSecretsPerClient)
+	}
+
+	if v.maxSecrets > 0 && v.countSecrets() >= v.maxSecrets && !v.evictReleased("") {
+		return fmt.Errorf("vault %w (%d)", ErrSecretLimitReached, v.maxSecrets)
+	}
+
+	c, kind, err := v.secretCrypt()
 	if err != nil {
 		return err
 	}
@@ -179,10 +621,16 @@ func (v *Vault) AddSecret(clientUUID string, secretUUID string, secret *Secret)
 	encryptedSecret := &Secret{
 		Key:            encryptedKey,
 		ProcessAfter:   secret.ProcessAfter,
-		EncryptionMeta: EncryptionMeta{Kind: crypt.EncryptionKind},
+		ProcessUnit:    secret.ProcessUnit,
+		Deadline:       secret.Deadline,
+		Comment:        secret.Comment,
+		Recurring:      secret.Recurring,
+		EncryptionMeta: EncryptionMeta{Kind: kind},
 	}
 
-	v.data[clientUUID].Secrets[secretUUID] = encryptedSecret
+	clientData.Secrets[secretUUID] = encryptedSecret
+	clientData.LastVersion = max(clientData.LastVersion, secret.Version)
+	v.data[clientUUID] = clientData
 	v.save()
 	return nil
 }
@@ -193,6 +641,22 @@ func (v *Vault) AddSecret(clientUUID string, secretUUID string, secret *Secret)
 // Secret can be deleted only after releasing.
 // Secret is considered released when clientUUID was not seen Secret.LastSeen number of hours.
 func (v *Vault) DeleteSecret(clientUUID string, secretUUID string) error {
+	return v.deleteSecret(clientUUID, secretUUID, false)
+}
+
+// RevokeSecret removes secret from Vault even when it is not released yet.
+// It is used when owner of clientUUID deletes not fired action, so its secret is not orphaned.
+func (v *Vault) RevokeSecret(clientUUID string, secretUUID string) error {
+	return v.deleteSecret(clientUUID, secretUUID, true)
+}
+
+// ExtendSecret adds extra to ProcessAfter of secret, so it is released later.
+// extra is in secret process unit. Released secret can't be extended, Deadline is not extended.
+func (v *Vault) ExtendSecret(clientUUID string, secretUUID string, extra int) error {
+	if extra <= 0 {
+		return fmt.Errorf("extra should be greater than 0")
+	}
+
 	v.mtx.Lock()
 	defer v.mtx.Unlock()
 
@@ -200,18 +664,68 @@ func (v *Vault) DeleteSecret(clientUUID string, secretUUID string) error {
 	if !ok {
 		return fmt.Errorf("secret %s/%s is missing", clientUUID, secretUUID)
 	}
+	secret, ok := clientData.Secrets[secretUUID]
+	if !ok {
+		return fmt.Errorf("secret %s/%s is missing", clientUUID, secretUUID)
+	}
+	if v.clk().Now().After(v.releaseAt(clientData.seenAt(secret), secret)) {
+		return fmt.Errorf("secret %s/%s %w", clientUUID, secretUUID, ErrSecretReleased)
+	}
+
+	secret.ProcessAfter += extra
+	v.save()
+	return nil
+}
+
+// ReleaseAll makes every secret of clientUUID releasable immediately, regardless of ProcessAfter and LastSeen.
+// Deadline of unreleased secrets is moved to now, already released secrets are not changed.
+func (v *Vault) ReleaseAll(clientUUID string) error {
+	v.mtx.Lock()
+	defer v.mtx.Unlock()
+
+	clientData, ok := v.data[clientUUID]
+	if !ok {
+		return fmt.Errorf("client %s is missing", clientUUID)
+	}
+	now := v.clk().Now()
+	// releaseAt adds releaseSkew to Deadline, so it is subtracted to release now.
+	deadline := now.Add(-v.releaseSkew)
+	released := 0
+	for _, secret := range clientData.Secrets {
+		if now.After(v.releaseAt(clientData.seenAt(secret), secret)) {
+			continue
+		}
+		secret.Deadline = &deadline
+		released++
+	}
+	v.save()
+	log.Printf("released all secrets of client %s, %d secrets were not released before", clientUUID, released)
+	return nil
+}
 
-	lastSeen := clientData.LastSeen
+// deleteSecret removes secret from Vault, unreleased secret is removed only with revoke.
+func (v *Vault) deleteSecret(clientUUID string, secretUUID string, revoke bool) error {
+	v.mtx.Lock()
+	defer v.mtx.Unlock()
 
-	now := time.Now()
+	clientData, ok := v.data[clientUUID]
+	if !ok {
+		return fmt.Errorf("secret %s/%s is missing", clientUUID, secretUUID)
+	}
+
+	now := v.clk().Now()
 
 	secret, ok := clientData.Secrets[secretUUID]
 	if !ok {
 		return fmt.Errorf("secret %s/%s is missing", clientUUID, secretUUID)
 	}
 
-	if now.Sub(lastSeen) <= time.Duration(secret.ProcessAfter)*v.secretProcessUnit {
-		return fmt.Errorf("secret %s/%s %w", clientUUID, secretUUID, ErrSecretNotReleased)
+	if releaseAt := v.releaseAt(clientData.seenAt(secret), secret); !revoke && !now.After(releaseAt) {
+		return &NotReleasedError{
+			ClientUUID: clientUUID,
+			SecretUUID: secretUUID,
+			Remaining:  releaseAt.Sub(now),
+		}
 	}
 
 	delete(clientData.Secrets, secretUUID)
@@ -224,11 +738,114 @@ func (v *Vault) DeleteSecret(clientUUID string, secretUUID string) error {
 func (v *Vault) ensureClientUUID(clientUUID string) {
 	_, ok := v.data[clientUUID]
 	if !ok {
-		v.data[clientUUID] = &VaultData{
-			LastSeen: time.Now(),
-			Secrets:  map[string]*Secret{},
+		v.data[clientUUID] = v.newClientData()
+	}
+}
+
+// newClientData returns data of new client, seen now.
+func (v *Vault) newClientData() *VaultData {
+	return &VaultData{
+		LastSeen: v.clk().Now(),
+		Secrets:  map[string]*Secret{},
+	}
+}
+
+// recordRelease stores release event and notifies onSecretRelease.
+func (v *Vault) recordRelease(clientUUID string, secretUUID string) {
+	v.eventsMtx.Lock()
+	defer v.eventsMtx.Unlock()
+
+	event := ReleaseEvent{
+		ClientUUID: clientUUID,
+		SecretUUID: secretUUID,
+		Time:       v.clk().Now(),
+	}
+	if len(v.releaseEvents) < releaseEventsSize {
+		v.releaseEvents = append(v.releaseEvents, event)
+	} else {
+		v.releaseEvents[v.releaseEventsNext] = event
+	}
+	v.releaseEventsNext = (v.releaseEventsNext + 1) % releaseEventsSize
+
+	if v.onSecretRelease != nil {
+		v.onSecretRelease(clientUUID)
+	}
+}
+
+// releaseAfter returns how long after LastSeen secret is released.
+// Secret ProcessUnit is used when set, Vault secretProcessUnit otherwise.
+func (v *Vault) releaseAfter(secret *Secret) time.Duration {
+	unit := v.secretProcessUnit
+	if secretUnit, ok := ProcessUnit(secret.ProcessUnit); ok {
+		unit = secretUnit
+	}
+	return time.Duration(secret.ProcessAfter) * unit
+}
+
+// releaseAt returns when secret is released for client last seen at lastSeen.
+// Secret Deadline wins when it comes earlier, releaseSkew is added to both.
+func (v *Vault) releaseAt(lastSeen time.Time, secret *Secret) time.Time {
+	releaseAt := lastSeen.Add(v.releaseAfter(secret))
+	if secret.Deadline != nil && secret.Deadline.Before(releaseAt) {
+		releaseAt = *secret.Deadline
+	}
+	return releaseAt.Add(v.releaseSkew)
+}
+
+// ObserveClientClock compares clock reported by clientUUID with vault clock and returns skew.
+// Positive skew means client clock is ahead of vault. Skew bigger than clockSkewWarning
+// (or releaseSkew when it is bigger) is logged, as secrets may be released at wrong time.
+func (v *Vault) ObserveClientClock(clientUUID string, clientTime time.Time) time.Duration {
+	skew := clientTime.Sub(v.clk().Now())
+	if abs := skew.Abs(); abs > max(clockSkewWarning, v.releaseSkew) {
+		log.Printf("clock of client %s is %s off vault clock, secrets may be released at wrong time", clientUUID, skew.Round(time.Second))
+	}
+	if v.onClockSkew != nil {
+		v.onClockSkew(clientUUID, skew)
+	}
+	return skew
+}
+
+// evictReleased removes secret which was released first, only secrets of clientUUID are considered
+// when it is not empty. It returns false when overflow policy is not OverflowEvict or no secret is released.
+// Caller must hold Vault write lock.
+func (v *Vault) evictReleased(clientUUID string) bool {
+	if v.overflowPolicy != OverflowEvict {
+		return false
+	}
+	var oldestClient, oldestSecret string
+	var oldestReleaseAt time.Time
+	now := v.clk().Now()
+	for c, clientData := range v.data {
+		if clientUUID != "" && c != clientUUID {
+			continue
+		}
+		for s, secret := range clientData.Secrets {
+			releaseAt := v.releaseAt(clientData.seenAt(secret), secret)
+			if !now.After(releaseAt) {
+				continue
+			}
+			if oldestSecret == "" || releaseAt.Before(oldestReleaseAt) {
+				oldestClient, oldestSecret, oldestReleaseAt = c, s, releaseAt
+			}
 		}
 	}
+	if oldestSecret == "" {
+		return false
+	}
+	log.Printf("secret limit reached, evicting secret %s/%s released at %s", oldestClient, oldestSecret, oldestReleaseAt.Format(time.RFC3339))
+	delete(v.data[oldestClient].Secrets, oldestSecret)
+	return true
+}
+
+// countSecrets returns number of secrets stored for all clients.
+// Caller must hold Vault lock.
+func (v *Vault) countSecrets() int {
+	var count int
+	for _, clientData := range v.data {
+		count += len(clientData.Secrets)
+	}
+	return count
 }
 
 // save dumps vault to disk.
@@ -239,6 +856,24 @@ func (v *Vault) save() {
 	if err != nil {
 		logFatalf("unable to encode state: %s", err)
 	}
+	if v.pretty {
+		var indented bytes.Buffer
+		if err := json.Indent(&indented, data, "", "  "); err != nil {
+			logFatalf("unable to indent state: %s", err)
+		}
+		data = indented.Bytes()
+	}
+	if v.encryptFile {
+		age, err := v.fileCrypt()
+		if err != nil {
+			logFatalf("unable to encrypt state: %s", err)
+		}
+		encrypted, err := age.Encrypt(string(data))
+		if err != nil {
+			logFatalf("unable to encrypt state: %s", err)
+		}
+		data = []byte(encryptedFileMagic + encrypted)
+	}
 	if err := atomicWrite(v.savePath, data, 0600); err != nil {
 		logFatalf("unable to dump state: %s", err)
 	}
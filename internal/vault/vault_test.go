@@ -1,16 +1,26 @@
 package vault
 
 import (
+	"crypto/ed25519"
+	"crypto/rand"
 	"encoding/json"
+	"encoding/pem"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"dmh/internal/clock"
 	"dmh/internal/crypt"
 
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
 )
 
 type mockCrypt struct {
@@ -27,11 +37,26 @@ func (m *mockCrypt) Decrypt(data string) (string, error) {
 	return args.String(0), args.Error(1)
 }
 
+func (m *mockCrypt) EncryptStream(dst io.Writer, src io.Reader) error {
+	args := m.Called(dst, src)
+	return args.Error(0)
+}
+
+func (m *mockCrypt) DecryptStream(dst io.Writer, src io.Reader) error {
+	args := m.Called(dst, src)
+	return args.Error(0)
+}
+
 func (m *mockCrypt) GetPrivateKey() string {
 	args := m.Called()
 	return args.String(0)
 }
 
+func (m *mockCrypt) GetPublicKey() string {
+	args := m.Called()
+	return args.String(0)
+}
+
 func TestNew(t *testing.T) {
 	vaultFile := "test_vault.json"
 	tests := []struct {
@@ -190,6 +215,69 @@ func TestUpdateLastSeen(t *testing.T) {
 
 }
 
+func TestMarkGone(t *testing.T) {
+	savePath := filepath.Join(t.TempDir(), "vault.json")
+	v := &Vault{
+		data: map[string]*VaultData{
+			"testClientUUID": {
+				LastSeen: time.Now(),
+				Secrets: map[string]*Secret{
+					"testSecretUUID": {Key: "encrypted", ProcessAfter: 24},
+				},
+			},
+		},
+		savePath:          savePath,
+		secretProcessUnit: time.Hour,
+	}
+	_, err := v.GetSecretStatus("testClientUUID", "testSecretUUID")
+	require.Nil(t, err)
+	require.Empty(t, v.StaleSecrets(0))
+
+	require.Nil(t, v.MarkGone("testClientUUID"))
+	require.Equal(t, goneLastSeen, v.data["testClientUUID"].LastSeen)
+	require.Equal(t, []string{"testClientUUID/testSecretUUID"}, v.StaleSecrets(0))
+
+	v.UpdateLastSeen("testClientUUID")
+	require.Empty(t, v.StaleSecrets(0))
+
+	require.EqualError(t, v.MarkGone("newClientUUID"), "client newClientUUID is missing")
+	require.NotContains(t, v.data, "newClientUUID")
+}
+
+func TestSetExtend(t *testing.T) {
+	savePath := filepath.Join(t.TempDir(), "vault.json")
+	v := &Vault{
+		data: map[string]*VaultData{
+			"testClientUUID": {
+				LastSeen: time.Now().Add(-2 * time.Hour),
+				Secrets: map[string]*Secret{
+					"testSecretUUID": {Key: "encrypted", ProcessAfter: 1},
+				},
+			},
+		},
+		savePath:          savePath,
+		secretProcessUnit: time.Hour,
+	}
+	require.Equal(t, []string{"testClientUUID/testSecretUUID"}, v.StaleSecrets(0))
+
+	v.SetExtend("testClientUUID", 24*time.Hour)
+	_, err := v.GetSecret("testClientUUID", "testSecretUUID")
+	var notReleased *NotReleasedError
+	require.ErrorAs(t, err, &notReleased)
+	require.InDelta(t, (23 * time.Hour).Seconds(), notReleased.Remaining.Seconds(), 5)
+	require.Empty(t, v.StaleSecrets(0))
+
+	loaded, err := New(&Options{SavePath: savePath, SecretProcessUnit: time.Hour})
+	require.Nil(t, err)
+	require.Equal(t, 24*time.Hour, loaded.(*Vault).data["testClientUUID"].Extend)
+
+	v.SetExtend("testClientUUID", 0)
+	require.Equal(t, []string{"testClientUUID/testSecretUUID"}, v.StaleSecrets(0))
+
+	v.SetExtend("newClientUUID", time.Hour)
+	require.Equal(t, time.Hour, v.data["newClientUUID"].Extend)
+}
+
 func TestGetSecret(t *testing.T) {
 	tests := []struct {
 		inputVault      func() *Vault
@@ -293,7 +381,7 @@ func TestGetSecret(t *testing.T) {
 			},
 			inputClientUUID: "testClientUUID",
 			inputSecretUUID: "testSecretUUID",
-			expectedError:   fmt.Errorf("secret testClientUUID/testSecretUUID %w", ErrSecretNotReleased),
+			expectedError:   &NotReleasedError{ClientUUID: "testClientUUID", SecretUUID: "testSecretUUID"},
 		},
 		{
 			inputVault: func() *Vault {
@@ -327,7 +415,7 @@ func TestGetSecret(t *testing.T) {
 			},
 			inputClientUUID: "testClientUUID2",
 			inputSecretUUID: "testSecretUUID2",
-			expectedError:   fmt.Errorf("secret testClientUUID2/testSecretUUID2 %w", ErrSecretNotReleased),
+			expectedError:   &NotReleasedError{ClientUUID: "testClientUUID2", SecretUUID: "testSecretUUID2"},
 		},
 		{
 			inputVault: func() *Vault {
@@ -361,7 +449,7 @@ func TestGetSecret(t *testing.T) {
 			},
 			inputClientUUID: "testClientUUID",
 			inputSecretUUID: "testSecretUUID",
-			expectedError:   fmt.Errorf("secret testClientUUID/testSecretUUID %w", ErrSecretNotReleased),
+			expectedError:   &NotReleasedError{ClientUUID: "testClientUUID", SecretUUID: "testSecretUUID"},
 		},
 		{
 			inputVault: func() *Vault {
@@ -530,9 +618,106 @@ func TestGetSecret(t *testing.T) {
 			}()
 		}
 		v := test.inputVault()
+		var released []string
+		v.onSecretRelease = func(clientUUID string) {
+			released = append(released, clientUUID)
+		}
 		secret, err := v.GetSecret(test.inputClientUUID, test.inputSecretUUID)
+		var notReleased *NotReleasedError
+		if errors.As(err, &notReleased) {
+			require.Greater(t, notReleased.Remaining, time.Duration(0))
+			notReleased.Remaining = 0
+		}
 		require.Equal(t, test.expectedError, err)
 		require.Equal(t, test.expectedSecret, secret)
+		events := v.GetReleaseEvents()
+		if test.expectedSecret == nil {
+			require.Empty(t, events)
+			require.Empty(t, released)
+			continue
+		}
+		require.Len(t, events, 1)
+		require.Equal(t, test.inputClientUUID, events[0].ClientUUID)
+		require.Equal(t, test.inputSecretUUID, events[0].SecretUUID)
+		require.Equal(t, []string{test.inputClientUUID}, released)
+	}
+}
+
+// TestConcurrentAccess is meant to be run with -race.
+func TestConcurrentAccess(t *testing.T) {
+	v, err := New(&Options{
+		Key:               "AGE-SECRET-KEY-1WCXTESPDAL64QQLNE6SEHHSFQVHZ2KV7KR2XCLGQ0UFSUUJXP5AS84HFG0",
+		SavePath:          filepath.Join(t.TempDir(), "vault.json"),
+		SecretProcessUnit: time.Second,
+	})
+	require.Nil(t, err)
+
+	var wg sync.WaitGroup
+	for i := range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			clientUUID := fmt.Sprintf("client%d", i%3)
+			for j := range 5 {
+				secretUUID := fmt.Sprintf("secret%d-%d", i, j)
+				require.Nil(t, v.AddSecret(clientUUID, secretUUID, &Secret{Key: "key", Deadline: &time.Time{}}))
+				v.UpdateLastSeen(clientUUID)
+				secret, err := v.GetSecret(clientUUID, secretUUID)
+				require.Nil(t, err)
+				require.Equal(t, "key", secret.Key)
+				v.GetReleaseEvents()
+				require.Nil(t, v.DeleteSecret(clientUUID, secretUUID))
+			}
+		}()
+	}
+	wg.Wait()
+	require.Zero(t, v.(*Vault).countSecrets())
+}
+
+func TestGetReleaseEvents(t *testing.T) {
+	tests := []struct {
+		inputReleases       int
+		expectedLen         int
+		expectedFirstSecret string
+		expectedLastSecret  string
+	}{
+		{
+			inputReleases: 0,
+			expectedLen:   0,
+		},
+		{
+			inputReleases:       3,
+			expectedLen:         3,
+			expectedFirstSecret: "secret-0",
+			expectedLastSecret:  "secret-2",
+		},
+		{
+			inputReleases:       releaseEventsSize,
+			expectedLen:         releaseEventsSize,
+			expectedFirstSecret: "secret-0",
+			expectedLastSecret:  fmt.Sprintf("secret-%d", releaseEventsSize-1),
+		},
+		{
+			inputReleases:       releaseEventsSize + 5,
+			expectedLen:         releaseEventsSize,
+			expectedFirstSecret: "secret-5",
+			expectedLastSecret:  fmt.Sprintf("secret-%d", releaseEventsSize+4),
+		},
+	}
+
+	for _, test := range tests {
+		v := &Vault{}
+		for i := 0; i < test.inputReleases; i++ {
+			v.recordRelease("client", fmt.Sprintf("secret-%d", i))
+		}
+		events := v.GetReleaseEvents()
+		require.NotNil(t, events)
+		require.Len(t, events, test.expectedLen)
+		if test.expectedLen == 0 {
+			continue
+		}
+		require.Equal(t, test.expectedFirstSecret, events[0].SecretUUID)
+		require.Equal(t, test.expectedLastSecret, events[len(events)-1].SecretUUID)
 	}
 }
 
@@ -583,7 +768,7 @@ func TestAddSecret(t *testing.T) {
 				Key:          "test2",
 				ProcessAfter: 10,
 			},
-			expectedError: fmt.Errorf("secret testClientUUID/testSecretUUID already exists"),
+			expectedError: fmt.Errorf("secret testClientUUID/testSecretUUID %w", ErrSecretExists),
 		},
 		{
 			inputVault: func() *Vault {
@@ -714,6 +899,97 @@ func TestAddSecret(t *testing.T) {
 				EncryptionMeta: EncryptionMeta{Kind: "X25519"},
 			},
 		},
+		{
+			inputVault: func() *Vault {
+				v := &Vault{
+					savePath: "test_vault.json",
+					data: map[string]*VaultData{
+						"testClientUUID": {
+							LastSeen: time.Now(),
+							Secrets: map[string]*Secret{
+								"testSecretUUID": {Key: "test", ProcessAfter: 10},
+							},
+						},
+					},
+					key:                 "AGE-SECRET-KEY-1GEUMZFAZD42WGZFGATTTJHV4SURK8LU507QVCAKXKJP6UTFMJTCS0E3QJ4",
+					secretProcessUnit:   time.Hour,
+					maxSecretsPerClient: 1,
+				}
+				return v
+			},
+			inputClientUUID: "testClientUUID",
+			inputSecretUUID: "testSecretUUID2",
+			inputSecret: &Secret{
+				Key:          "test2",
+				ProcessAfter: 10,
+			},
+			expectedError: fmt.Errorf("client testClientUUID %w (1)", ErrSecretLimitReached),
+		},
+		{
+			inputVault: func() *Vault {
+				v := &Vault{
+					savePath: "test_vault.json",
+					data: map[string]*VaultData{
+						"testClientUUID": {
+							LastSeen: time.Now().Add(-24 * time.Hour),
+							Secrets: map[string]*Secret{
+								"testSecretUUID": {Key: "test", ProcessAfter: 10},
+							},
+						},
+					},
+					key:                 "AGE-SECRET-KEY-1GEUMZFAZD42WGZFGATTTJHV4SURK8LU507QVCAKXKJP6UTFMJTCS0E3QJ4",
+					secretProcessUnit:   time.Hour,
+					maxSecretsPerClient: 2,
+				}
+				return v
+			},
+			inputClientUUID: "testClientUUID",
+			inputSecretUUID: "testSecretUUID2",
+			inputSecret: &Secret{
+				Key:          "test2",
+				ProcessAfter: 10,
+				Comment:      "letter to lawyer",
+			},
+			expectedSecret: &Secret{
+				Key:            "test2",
+				ProcessAfter:   10,
+				Comment:        "letter to lawyer",
+				EncryptionMeta: EncryptionMeta{Kind: "X25519"},
+			},
+		},
+		{
+			inputVault: func() *Vault {
+				v := &Vault{
+					savePath: "test_vault.json",
+					data: map[string]*VaultData{
+						"testClientUUID": {
+							LastSeen: time.Now(),
+							Secrets: map[string]*Secret{
+								"testSecretUUID": {Key: "test", ProcessAfter: 10},
+							},
+						},
+						"testClientUUID2": {
+							LastSeen: time.Now(),
+							Secrets: map[string]*Secret{
+								"testSecretUUID2": {Key: "test", ProcessAfter: 10},
+							},
+						},
+					},
+					key:                 "AGE-SECRET-KEY-1GEUMZFAZD42WGZFGATTTJHV4SURK8LU507QVCAKXKJP6UTFMJTCS0E3QJ4",
+					secretProcessUnit:   time.Hour,
+					maxSecretsPerClient: 2,
+					maxSecrets:          2,
+				}
+				return v
+			},
+			inputClientUUID: "testClientUUID3",
+			inputSecretUUID: "testSecretUUID3",
+			inputSecret: &Secret{
+				Key:          "test3",
+				ProcessAfter: 10,
+			},
+			expectedError: fmt.Errorf("vault %w (2)", ErrSecretLimitReached),
+		},
 	}
 	vaultFile := "test_vault.json"
 	os.Remove(vaultFile)
@@ -727,8 +1003,12 @@ func TestAddSecret(t *testing.T) {
 			}()
 		}
 		v := test.inputVault()
+		_, clientExisted := v.data[test.inputClientUUID]
 		err := v.AddSecret(test.inputClientUUID, test.inputSecretUUID, test.inputSecret)
 		require.Equal(t, test.expectedError, err)
+		if err != nil && !clientExisted {
+			require.NotContains(t, v.data, test.inputClientUUID)
+		}
 		if err == nil {
 			secret, err := v.GetSecret(test.inputClientUUID, test.inputSecretUUID)
 			require.Nil(t, err)
@@ -742,6 +1022,52 @@ func TestAddSecret(t *testing.T) {
 	}
 }
 
+func TestAddSecretOverflowEvict(t *testing.T) {
+	vaultFile := "test_vault.json"
+	os.Remove(vaultFile)
+	defer os.Remove(vaultFile)
+
+	deadline := time.Now().Add(-20 * time.Hour)
+	v := &Vault{
+		savePath: vaultFile,
+		data: map[string]*VaultData{
+			"testClientUUID": {
+				LastSeen: time.Now().Add(-24 * time.Hour),
+				Secrets: map[string]*Secret{
+					"released":       {Key: "test", ProcessAfter: 10},
+					"released-first": {Key: "test", ProcessAfter: 10, Deadline: &deadline},
+				},
+			},
+			"testClientUUID2": {
+				LastSeen: time.Now(),
+				Secrets: map[string]*Secret{
+					"pending": {Key: "test", ProcessAfter: 10},
+				},
+			},
+		},
+		key:               "AGE-SECRET-KEY-1GEUMZFAZD42WGZFGATTTJHV4SURK8LU507QVCAKXKJP6UTFMJTCS0E3QJ4",
+		secretProcessUnit: time.Hour,
+		maxSecrets:        3,
+		overflowPolicy:    OverflowEvict,
+	}
+
+	require.Nil(t, v.AddSecret("testClientUUID2", "new", &Secret{Key: "test", ProcessAfter: 10}))
+	require.NotContains(t, v.data["testClientUUID"].Secrets, "released-first")
+	require.Contains(t, v.data["testClientUUID"].Secrets, "released")
+	require.Equal(t, 3, v.countSecrets())
+
+	v.maxSecretsPerClient = 2
+	require.Equal(t, fmt.Errorf("client testClientUUID2 %w (2)", ErrSecretLimitReached), v.AddSecret("testClientUUID2", "new2", &Secret{Key: "test", ProcessAfter: 10}))
+
+	require.Nil(t, v.AddSecret("testClientUUID3", "new3", &Secret{Key: "test", ProcessAfter: 10}))
+	require.NotContains(t, v.data["testClientUUID"].Secrets, "released")
+	require.Equal(t, fmt.Errorf("vault %w (3)", ErrSecretLimitReached), v.AddSecret("testClientUUID3", "new4", &Secret{Key: "test", ProcessAfter: 10}))
+
+	v.overflowPolicy = OverflowStrict
+	v.data["testClientUUID2"].LastSeen = time.Now().Add(-24 * time.Hour)
+	require.Equal(t, fmt.Errorf("vault %w (3)", ErrSecretLimitReached), v.AddSecret("testClientUUID3", "new4", &Secret{Key: "test", ProcessAfter: 10}))
+}
+
 func TestDeleteSecret(t *testing.T) {
 	tests := []struct {
 		inputVault      func() *Vault
@@ -830,7 +1156,7 @@ func TestDeleteSecret(t *testing.T) {
 			},
 			inputClientUUID: "testClientUUID",
 			inputSecretUUID: "testSecretUUID",
-			expectedError:   fmt.Errorf("secret testClientUUID/testSecretUUID %w", ErrSecretNotReleased),
+			expectedError:   &NotReleasedError{ClientUUID: "testClientUUID", SecretUUID: "testSecretUUID"},
 			expectedSecrets: map[string]*Secret{
 				"testSecretUUID": {
 					Key:          "test",
@@ -878,7 +1204,7 @@ func TestDeleteSecret(t *testing.T) {
 			},
 			inputClientUUID: "testClientUUID",
 			inputSecretUUID: "testSecretUUID",
-			expectedError:   fmt.Errorf("secret testClientUUID/testSecretUUID %w", ErrSecretNotReleased),
+			expectedError:   &NotReleasedError{ClientUUID: "testClientUUID", SecretUUID: "testSecretUUID"},
 			expectedSecrets: map[string]*Secret{
 				"testSecretUUID": {
 					Key:          "test",
@@ -986,6 +1312,11 @@ func TestDeleteSecret(t *testing.T) {
 	for _, test := range tests {
 		v := test.inputVault()
 		err := v.DeleteSecret(test.inputClientUUID, test.inputSecretUUID)
+		var notReleased *NotReleasedError
+		if errors.As(err, &notReleased) {
+			require.Greater(t, notReleased.Remaining, time.Duration(0))
+			notReleased.Remaining = 0
+		}
 		require.Equal(t, test.expectedError, err)
 		if test.expectedSecrets == nil {
 			require.NotContains(t, v.data, test.inputClientUUID)
@@ -995,6 +1326,144 @@ func TestDeleteSecret(t *testing.T) {
 	}
 }
 
+func TestSavePretty(t *testing.T) {
+	savePath := filepath.Join(t.TempDir(), "vault.json")
+	mockTime, err := time.Parse("2006-01-02T15:04:05.999999-07:00", "2025-03-26T14:55:40.119447+01:00")
+	require.Nil(t, err)
+
+	v := &Vault{
+		data: map[string]*VaultData{
+			"testClientUUID": {
+				LastSeen: mockTime,
+				Secrets: map[string]*Secret{
+					"testSecret1": {Key: "encrypted", ProcessAfter: 10, EncryptionMeta: EncryptionMeta{Kind: "X25519"}},
+				},
+			},
+		},
+		savePath: savePath,
+		pretty:   true,
+	}
+	v.save()
+
+	data, err := os.ReadFile(savePath)
+	require.Nil(t, err)
+	require.Equal(t, `{
+  "testClientUUID": {
+    "last_seen": "2025-03-26T14:55:40.119447+01:00",
+    "secrets": {
+      "testSecret1": {
+        "key": "encrypted",
+        "process_after": 10,
+        "encryption": {
+          "kind": "X25519"
+        }
+      }
+    }
+  }
+}`, string(data))
+
+	loaded, err := New(&Options{SavePath: savePath, SecretProcessUnit: time.Hour})
+	require.Nil(t, err)
+	require.Equal(t, v.data["testClientUUID"].Secrets, loaded.(*Vault).data["testClientUUID"].Secrets)
+}
+
+func TestSaveEncryptFile(t *testing.T) {
+	key := "AGE-SECRET-KEY-1WCXTESPDAL64QQLNE6SEHHSFQVHZ2KV7KR2XCLGQ0UFSUUJXP5AS84HFG0"
+	fileKey := "AGE-SECRET-KEY-1GEUMZFAZD42WGZFGATTTJHV4SURK8LU507QVCAKXKJP6UTFMJTCS0E3QJ4"
+	mockTime, err := time.Parse("2006-01-02T15:04:05.999999-07:00", "2025-03-26T14:55:40.119447+01:00")
+	require.Nil(t, err)
+	data := map[string]*VaultData{
+		"testClientUUID": {
+			LastSeen: mockTime,
+			Secrets: map[string]*Secret{
+				"testSecret1": {Key: "encrypted", ProcessAfter: 10},
+			},
+		},
+	}
+
+	tests := []struct {
+		inputFileKey string
+	}{
+		{inputFileKey: ""},
+		{inputFileKey: fileKey},
+	}
+	for _, test := range tests {
+		savePath := filepath.Join(t.TempDir(), "vault.json")
+
+		// plain vault file is loaded and encrypted on next save.
+		v := &Vault{data: data, savePath: savePath}
+		v.save()
+		loaded, err := New(&Options{Key: key, SavePath: savePath, SecretProcessUnit: time.Hour, EncryptFile: true, FileKey: test.inputFileKey})
+		require.Nil(t, err)
+		loaded.(*Vault).save()
+
+		content, err := os.ReadFile(savePath)
+		require.Nil(t, err)
+		require.True(t, strings.HasPrefix(string(content), encryptedFileMagic))
+		require.NotContains(t, string(content), "testClientUUID")
+
+		loaded, err = New(&Options{Key: key, SavePath: savePath, SecretProcessUnit: time.Hour, FileKey: test.inputFileKey})
+		require.Nil(t, err)
+		require.Equal(t, data["testClientUUID"].Secrets, loaded.(*Vault).data["testClientUUID"].Secrets)
+
+		// disabled encrypt_file writes plain vault file again.
+		loaded.(*Vault).save()
+		content, err = os.ReadFile(savePath)
+		require.Nil(t, err)
+		require.Contains(t, string(content), "testClientUUID")
+	}
+
+	savePath := filepath.Join(t.TempDir(), "vault.json")
+	v := &Vault{data: data, savePath: savePath, key: key, encryptFile: true, fileKey: fileKey}
+	v.save()
+	_, err = New(&Options{Key: key, SavePath: savePath, SecretProcessUnit: time.Hour})
+	require.ErrorContains(t, err, "unable to decrypt vault file")
+}
+
+// writeTestSSHKey writes new Ed25519 SSH private key into dir and returns its path.
+func writeTestSSHKey(t *testing.T, dir string) string {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.Nil(t, err)
+	block, err := ssh.MarshalPrivateKey(priv, "")
+	require.Nil(t, err)
+	path := filepath.Join(dir, "id_ed25519")
+	require.Nil(t, os.WriteFile(path, pem.EncodeToMemory(block), 0600))
+	return path
+}
+
+func TestSSHKeyFile(t *testing.T) {
+	dir := t.TempDir()
+	savePath := filepath.Join(dir, "vault.json")
+	keyFile := writeTestSSHKey(t, dir)
+
+	v, err := New(&Options{SSHKeyFile: keyFile, SavePath: savePath, SecretProcessUnit: time.Second, EncryptFile: true})
+	require.Nil(t, err)
+	require.Nil(t, v.AddSecret("testClientUUID", "testSecretUUID", &Secret{Key: "AGE-SECRET-KEY-1", ProcessAfter: 1}))
+	stored := v.(*Vault).data["testClientUUID"].Secrets["testSecretUUID"]
+	require.Equal(t, crypt.SSHEd25519EncryptionKind, stored.EncryptionMeta.Kind)
+	require.NotEqual(t, "AGE-SECRET-KEY-1", stored.Key)
+
+	content, err := os.ReadFile(savePath)
+	require.Nil(t, err)
+	require.True(t, strings.HasPrefix(string(content), encryptedFileMagic))
+
+	// vault file and secrets are decrypted with the same SSH key after restart.
+	v, err = New(&Options{SSHKeyFile: keyFile, SavePath: savePath, SecretProcessUnit: time.Second})
+	require.Nil(t, err)
+	v.(*Vault).data["testClientUUID"].LastSeen = time.Now().Add(-time.Hour)
+	secret, err := v.GetSecret("testClientUUID", "testSecretUUID")
+	require.Nil(t, err)
+	require.Equal(t, "AGE-SECRET-KEY-1", secret.Key)
+	require.Equal(t, crypt.SSHEd25519EncryptionKind, secret.EncryptionMeta.Kind)
+
+	// other SSH key can't decrypt vault file.
+	_, err = New(&Options{SSHKeyFile: writeTestSSHKey(t, t.TempDir()), SavePath: savePath, SecretProcessUnit: time.Second})
+	require.ErrorContains(t, err, "unable to decrypt vault file")
+
+	_, err = New(&Options{SSHKeyFile: filepath.Join(dir, "missing"), SavePath: savePath, SecretProcessUnit: time.Second})
+	require.ErrorContains(t, err, "unable to read vault.ssh_key_file")
+}
+
 func TestSave(t *testing.T) {
 	tests := []struct {
 		inputData       func() map[string]*VaultData
@@ -1164,3 +1633,502 @@ func TestNewChmodFailureIsNotFatal(t *testing.T) {
 	_, err := New(&Options{SavePath: path, SecretProcessUnit: time.Hour})
 	require.NoError(t, err)
 }
+
+func TestReleaseAfter(t *testing.T) {
+	tests := []struct {
+		inputSecret   *Secret
+		expectedAfter time.Duration
+	}{
+		{
+			inputSecret:   &Secret{ProcessAfter: 10},
+			expectedAfter: 10 * time.Hour,
+		},
+		{
+			inputSecret:   &Secret{ProcessAfter: 10, ProcessUnit: "minute"},
+			expectedAfter: 10 * time.Minute,
+		},
+		{
+			inputSecret:   &Secret{ProcessAfter: 3, ProcessUnit: "second"},
+			expectedAfter: 3 * time.Second,
+		},
+		{
+			inputSecret:   &Secret{ProcessAfter: 2, ProcessUnit: "unknown"},
+			expectedAfter: 2 * time.Hour,
+		},
+	}
+
+	for _, test := range tests {
+		v := &Vault{secretProcessUnit: time.Hour}
+		require.Equal(t, test.expectedAfter, v.releaseAfter(test.inputSecret))
+	}
+}
+
+func TestProcessUnitName(t *testing.T) {
+	tests := []struct {
+		inputUnit    time.Duration
+		expectedName string
+	}{
+		{time.Second, "second"},
+		{time.Minute, "minute"},
+		{time.Hour, "hour"},
+		{90 * time.Second, "1m30s"},
+	}
+
+	for _, test := range tests {
+		require.Equal(t, test.expectedName, ProcessUnitName(test.inputUnit))
+		if unit, ok := ProcessUnit(test.expectedName); ok {
+			require.Equal(t, test.inputUnit, unit)
+		}
+	}
+}
+
+func TestGetSecretProcessUnit(t *testing.T) {
+	v := &Vault{secretProcessUnit: time.Minute}
+	require.Equal(t, time.Minute, v.GetSecretProcessUnit())
+}
+
+func TestNotReleasedError(t *testing.T) {
+	now := time.Date(2025, 3, 26, 14, 0, 0, 0, time.UTC)
+	v := &Vault{
+		data: map[string]*VaultData{
+			"testClientUUID": {
+				LastSeen: now.Add(-4 * time.Minute),
+				Secrets: map[string]*Secret{
+					"testSecretUUID": {ProcessAfter: 10, ProcessUnit: "minute"},
+				},
+			},
+		},
+		secretProcessUnit: time.Hour,
+		clock:             clock.NewFake(now),
+	}
+
+	_, err := v.GetSecret("testClientUUID", "testSecretUUID")
+	require.ErrorIs(t, err, ErrSecretNotReleased)
+	require.EqualError(t, err, "secret testClientUUID/testSecretUUID is not released yet")
+
+	var notReleased *NotReleasedError
+	require.ErrorAs(t, err, &notReleased)
+	require.Equal(t, 6*time.Minute, notReleased.Remaining)
+}
+
+func TestReleaseAt(t *testing.T) {
+	lastSeen := time.Date(2025, 3, 26, 14, 0, 0, 0, time.UTC)
+	earlyDeadline := lastSeen.Add(time.Hour)
+	lateDeadline := lastSeen.Add(20 * time.Hour)
+	tests := []struct {
+		inputSecret       *Secret
+		inputReleaseSkew  time.Duration
+		expectedReleaseAt time.Time
+	}{
+		{
+			inputSecret:       &Secret{ProcessAfter: 10},
+			expectedReleaseAt: lastSeen.Add(10 * time.Hour),
+		},
+		{
+			inputSecret:       &Secret{ProcessAfter: 10, Deadline: &earlyDeadline},
+			expectedReleaseAt: earlyDeadline,
+		},
+		{
+			inputSecret:       &Secret{ProcessAfter: 10, Deadline: &lateDeadline},
+			expectedReleaseAt: lastSeen.Add(10 * time.Hour),
+		},
+		{
+			inputSecret:       &Secret{ProcessAfter: 10},
+			inputReleaseSkew:  30 * time.Second,
+			expectedReleaseAt: lastSeen.Add(10*time.Hour + 30*time.Second),
+		},
+		{
+			inputSecret:       &Secret{ProcessAfter: 10, Deadline: &earlyDeadline},
+			inputReleaseSkew:  30 * time.Second,
+			expectedReleaseAt: earlyDeadline.Add(30 * time.Second),
+		},
+	}
+
+	for _, test := range tests {
+		v := &Vault{secretProcessUnit: time.Hour, releaseSkew: test.inputReleaseSkew}
+		require.Equal(t, test.expectedReleaseAt, v.releaseAt(lastSeen, test.inputSecret))
+	}
+}
+
+func TestObserveClientClock(t *testing.T) {
+	tests := []struct {
+		inputOffset time.Duration
+	}{
+		{inputOffset: 0},
+		{inputOffset: 5 * time.Minute},
+		{inputOffset: -5 * time.Minute},
+	}
+
+	for _, test := range tests {
+		var reportedClient string
+		var reportedSkew time.Duration
+		v := &Vault{onClockSkew: func(clientUUID string, skew time.Duration) {
+			reportedClient = clientUUID
+			reportedSkew = skew
+		}}
+		skew := v.ObserveClientClock("client-uuid", time.Now().Add(test.inputOffset))
+		require.InDelta(t, test.inputOffset.Seconds(), skew.Seconds(), 1)
+		require.Equal(t, "client-uuid", reportedClient)
+		require.Equal(t, skew, reportedSkew)
+	}
+}
+
+func TestDeleteSecretDeadline(t *testing.T) {
+	vaultFile := "test_vault.json"
+	os.Remove(vaultFile)
+	defer os.Remove(vaultFile)
+
+	passedDeadline := time.Now().Add(-time.Minute)
+	futureDeadline := time.Now().Add(time.Hour)
+	v := &Vault{
+		data: map[string]*VaultData{
+			"testClientUUID": {
+				LastSeen: time.Now(),
+				Secrets: map[string]*Secret{
+					"passed": {ProcessAfter: 10, Deadline: &passedDeadline},
+					"future": {ProcessAfter: 10, Deadline: &futureDeadline},
+				},
+			},
+		},
+		secretProcessUnit: time.Hour,
+		savePath:          vaultFile,
+	}
+
+	require.Nil(t, v.DeleteSecret("testClientUUID", "passed"))
+
+	err := v.DeleteSecret("testClientUUID", "future")
+	var notReleased *NotReleasedError
+	require.ErrorAs(t, err, &notReleased)
+	require.InDelta(t, time.Hour, notReleased.Remaining, float64(time.Second))
+	require.Contains(t, v.data["testClientUUID"].Secrets, "future")
+}
+
+func TestRevokeSecret(t *testing.T) {
+	vaultFile := "test_vault.json"
+	os.Remove(vaultFile)
+	defer os.Remove(vaultFile)
+
+	v := &Vault{
+		data: map[string]*VaultData{
+			"testClientUUID": {
+				LastSeen: time.Now(),
+				Secrets: map[string]*Secret{
+					"unreleased": {ProcessAfter: 10},
+				},
+			},
+		},
+		secretProcessUnit: time.Hour,
+		savePath:          vaultFile,
+	}
+
+	var notReleased *NotReleasedError
+	require.ErrorAs(t, v.DeleteSecret("testClientUUID", "unreleased"), &notReleased)
+	require.Nil(t, v.RevokeSecret("testClientUUID", "unreleased"))
+	require.NotContains(t, v.data["testClientUUID"].Secrets, "unreleased")
+	require.EqualError(t, v.RevokeSecret("testClientUUID", "unreleased"), "secret testClientUUID/unreleased is missing")
+}
+
+func TestExtendSecret(t *testing.T) {
+	vaultFile := "test_vault.json"
+	os.Remove(vaultFile)
+	defer os.Remove(vaultFile)
+
+	v := &Vault{
+		data: map[string]*VaultData{
+			"testClientUUID": {
+				LastSeen: time.Now().Add(-2 * time.Hour),
+				Secrets: map[string]*Secret{
+					"unreleased": {ProcessAfter: 10},
+					"released":   {ProcessAfter: 1},
+				},
+			},
+		},
+		secretProcessUnit: time.Hour,
+		savePath:          vaultFile,
+	}
+
+	require.Nil(t, v.ExtendSecret("testClientUUID", "unreleased", 5))
+	require.Equal(t, 15, v.data["testClientUUID"].Secrets["unreleased"].ProcessAfter)
+	require.ErrorIs(t, v.ExtendSecret("testClientUUID", "released", 5), ErrSecretReleased)
+	require.Equal(t, 1, v.data["testClientUUID"].Secrets["released"].ProcessAfter)
+	require.EqualError(t, v.ExtendSecret("testClientUUID", "missing", 5), "secret testClientUUID/missing is missing")
+	require.EqualError(t, v.ExtendSecret("missingClientUUID", "unreleased", 5), "secret missingClientUUID/unreleased is missing")
+	require.EqualError(t, v.ExtendSecret("testClientUUID", "unreleased", 0), "extra should be greater than 0")
+}
+
+func TestPartialSeenAt(t *testing.T) {
+	now := time.Date(2025, 3, 26, 14, 0, 0, 0, time.UTC)
+	require.Equal(t, now.Add(-5*time.Hour), PartialSeenAt(now, 10*time.Hour, 50))
+	require.Equal(t, now.Add(-9*time.Hour), PartialSeenAt(now, 10*time.Hour, 10))
+	require.Equal(t, now, PartialSeenAt(now, 10*time.Hour, 100))
+}
+
+func TestUpdatePartialLastSeen(t *testing.T) {
+	now := time.Date(2025, 3, 26, 14, 0, 0, 0, time.UTC)
+	deadline := now.Add(time.Hour)
+	v := &Vault{
+		data: map[string]*VaultData{
+			"testClientUUID": {
+				LastSeen: now.Add(-8 * time.Hour),
+				Secrets: map[string]*Secret{
+					"extended": {ProcessAfter: 10},
+					"released": {ProcessAfter: 2},
+					"long":     {ProcessAfter: 100},
+					"deadline": {ProcessAfter: 10, Deadline: &deadline},
+				},
+			},
+		},
+		secretProcessUnit: time.Hour,
+		savePath:          filepath.Join(t.TempDir(), "vault.json"),
+		clock:             clock.NewFake(now),
+	}
+	secrets := v.data["testClientUUID"].Secrets
+
+	require.EqualError(t, v.UpdatePartialLastSeen("testClientUUID", 0), "percent should be between 1 and 100")
+	require.EqualError(t, v.UpdatePartialLastSeen("testClientUUID", 101), "percent should be between 1 and 100")
+
+	require.Nil(t, v.UpdatePartialLastSeen("testClientUUID", 50))
+	require.Equal(t, now.Add(-5*time.Hour), *secrets["extended"].SeenAt)
+	require.Nil(t, secrets["released"].SeenAt)
+	// 50% of 100h window is less than remaining 92h, release is never moved earlier.
+	require.Nil(t, secrets["long"].SeenAt)
+	require.Equal(t, now.Add(-5*time.Hour), *secrets["deadline"].SeenAt)
+	require.Equal(t, now.Add(-8*time.Hour), v.data["testClientUUID"].LastSeen)
+
+	status, err := v.GetSecretStatus("testClientUUID", "extended")
+	require.Nil(t, err)
+	require.False(t, status.Released)
+	require.Equal(t, now.Add(5*time.Hour), v.releaseAt(v.data["testClientUUID"].seenAt(secrets["extended"]), secrets["extended"]))
+	require.Equal(t, deadline, v.releaseAt(v.data["testClientUUID"].seenAt(secrets["deadline"]), secrets["deadline"]))
+
+	// Smaller partial check-in does not move release earlier.
+	require.Nil(t, v.UpdatePartialLastSeen("testClientUUID", 20))
+	require.Equal(t, now.Add(-5*time.Hour), *secrets["extended"].SeenAt)
+
+	require.Nil(t, v.MarkGone("testClientUUID"))
+	require.Nil(t, secrets["extended"].SeenAt)
+	require.Nil(t, secrets["deadline"].SeenAt)
+
+	require.Nil(t, v.UpdatePartialLastSeen("newClientUUID", 50))
+	require.Contains(t, v.data, "newClientUUID")
+}
+
+func TestReleaseAll(t *testing.T) {
+	vaultFile := "test_vault.json"
+	os.Remove(vaultFile)
+	defer os.Remove(vaultFile)
+
+	now := time.Date(2025, 3, 26, 14, 0, 0, 0, time.UTC)
+	clk := clock.NewFake(now)
+	v := &Vault{
+		data: map[string]*VaultData{
+			"testClientUUID": {
+				LastSeen: now.Add(-2 * time.Hour),
+				Secrets: map[string]*Secret{
+					"unreleased": {ProcessAfter: 10},
+					"released":   {ProcessAfter: 1},
+				},
+			},
+			"otherClientUUID": {
+				LastSeen: now,
+				Secrets: map[string]*Secret{
+					"unreleased": {ProcessAfter: 10},
+				},
+			},
+		},
+		secretProcessUnit: time.Hour,
+		releaseSkew:       time.Minute,
+		savePath:          vaultFile,
+		clock:             clk,
+	}
+
+	require.EqualError(t, v.ReleaseAll("missingClientUUID"), "client missingClientUUID is missing")
+	require.Nil(t, v.ReleaseAll("testClientUUID"))
+	require.Nil(t, v.data["testClientUUID"].Secrets["released"].Deadline)
+	require.Nil(t, v.data["otherClientUUID"].Secrets["unreleased"].Deadline)
+
+	clk.Advance(time.Second)
+	_, err := v.GetSecret("otherClientUUID", "unreleased")
+	require.ErrorIs(t, err, ErrSecretNotReleased)
+	unreleased := v.data["testClientUUID"].Secrets["unreleased"]
+	require.Equal(t, now, v.releaseAt(v.data["testClientUUID"].seenAt(unreleased), unreleased))
+	require.True(t, clk.Now().After(v.releaseAt(v.data["testClientUUID"].seenAt(unreleased), unreleased)))
+}
+
+func TestGetSecretMeta(t *testing.T) {
+	deadline := time.Now().Add(time.Hour)
+	v := &Vault{
+		data: map[string]*VaultData{
+			"testClientUUID": {
+				LastSeen: time.Now(),
+				Secrets: map[string]*Secret{
+					"locked": {Key: "encrypted", ProcessAfter: 10, ProcessUnit: "minute", Deadline: &deadline, Comment: "test"},
+				},
+			},
+		},
+		secretProcessUnit: time.Hour,
+	}
+
+	secret, err := v.GetSecretMeta("testClientUUID", "locked")
+	require.Nil(t, err)
+	require.Equal(t, &Secret{ProcessAfter: 10, ProcessUnit: "minute", Deadline: &deadline, Comment: "test"}, secret)
+	require.Empty(t, v.GetReleaseEvents())
+
+	_, err = v.GetSecretMeta("testClientUUID", "missing")
+	require.ErrorContains(t, err, "secret testClientUUID/missing is missing")
+	_, err = v.GetSecretMeta("missingClientUUID", "locked")
+	require.ErrorContains(t, err, "secret missingClientUUID/locked is missing")
+}
+
+func TestGetSecretStatus(t *testing.T) {
+	now := time.Now()
+	deadline := now.Add(90 * time.Second)
+	v := &Vault{
+		data: map[string]*VaultData{
+			"testClientUUID": {
+				LastSeen: now,
+				Secrets: map[string]*Secret{
+					"locked":   {Key: "encrypted", ProcessAfter: 2},
+					"deadline": {Key: "encrypted", ProcessAfter: 2, Deadline: &deadline},
+					"released": {Key: "encrypted", ProcessAfter: 0, Deadline: &now},
+				},
+			},
+		},
+		secretProcessUnit: time.Hour,
+		clock:             clock.NewFake(now.Add(time.Millisecond)),
+	}
+
+	status, err := v.GetSecretStatus("testClientUUID", "locked")
+	require.Nil(t, err)
+	require.Equal(t, &SecretStatus{SecondsUntilRelease: 7200}, status)
+	status, err = v.GetSecretStatus("testClientUUID", "deadline")
+	require.Nil(t, err)
+	require.Equal(t, &SecretStatus{SecondsUntilRelease: 90}, status)
+	status, err = v.GetSecretStatus("testClientUUID", "released")
+	require.Nil(t, err)
+	require.Equal(t, &SecretStatus{Released: true}, status)
+	// status check is not secret release
+	require.Empty(t, v.GetReleaseEvents())
+
+	_, err = v.GetSecretStatus("testClientUUID", "missing")
+	require.ErrorContains(t, err, "secret testClientUUID/missing is missing")
+	_, err = v.GetSecretStatus("missingClientUUID", "locked")
+	require.ErrorContains(t, err, "secret missingClientUUID/locked is missing")
+}
+
+func TestStaleSecrets(t *testing.T) {
+	now := time.Now()
+	v := &Vault{
+		data: map[string]*VaultData{
+			"seen": {
+				LastSeen: now,
+				Secrets: map[string]*Secret{
+					"locked":   {ProcessAfter: 1},
+					"released": {ProcessAfter: 0},
+				},
+			},
+			"gone": {
+				LastSeen: now.Add(-10 * time.Hour),
+				Secrets: map[string]*Secret{
+					"b": {ProcessAfter: 1},
+					"a": {ProcessAfter: 2},
+					"c": {ProcessAfter: 9},
+					"d": {ProcessAfter: 1, Recurring: true},
+				},
+			},
+		},
+		secretProcessUnit: time.Hour,
+	}
+
+	require.Equal(t, []string{"gone/a", "gone/b"}, v.StaleSecrets(2*time.Hour))
+	require.Equal(t, []string{"gone/a", "gone/b", "gone/c"}, v.StaleSecrets(30*time.Minute))
+	require.Equal(t, []string{}, v.StaleSecrets(24*time.Hour))
+}
+
+func TestClientStatuses(t *testing.T) {
+	now := time.Now()
+	partialSeenAt := now.Add(-30 * time.Minute)
+	deadline := now.Add(-time.Minute)
+	v := &Vault{
+		data: map[string]*VaultData{
+			"seen": {
+				LastSeen: now,
+				Secrets: map[string]*Secret{
+					"locked": {ProcessAfter: 1},
+				},
+			},
+			"gone": {
+				LastSeen: now.Add(-2 * time.Hour),
+				Secrets: map[string]*Secret{
+					"locked":   {ProcessAfter: 9},
+					"released": {ProcessAfter: 1},
+				},
+			},
+			"extended": {
+				LastSeen: now.Add(-2 * time.Hour),
+				Extend:   2 * time.Hour,
+				Secrets: map[string]*Secret{
+					"locked": {ProcessAfter: 1},
+				},
+			},
+			"partial": {
+				LastSeen: now.Add(-2 * time.Hour),
+				Secrets: map[string]*Secret{
+					"locked": {ProcessAfter: 1, SeenAt: &partialSeenAt},
+				},
+			},
+			"deadline": {
+				LastSeen: now,
+				Secrets: map[string]*Secret{
+					"released": {ProcessAfter: 1, Deadline: &deadline},
+				},
+			},
+			"empty": {
+				LastSeen: now.Add(-24 * time.Hour),
+				Secrets:  map[string]*Secret{},
+			},
+		},
+		secretProcessUnit: time.Hour,
+	}
+
+	require.Equal(t, []ClientStatus{
+		{ClientUUID: "deadline", LastSeen: now, Stale: true, Secrets: 1},
+		{ClientUUID: "empty", LastSeen: now.Add(-24 * time.Hour)},
+		{ClientUUID: "extended", LastSeen: now.Add(-2 * time.Hour), Secrets: 1},
+		{ClientUUID: "gone", LastSeen: now.Add(-2 * time.Hour), Stale: true, Secrets: 2},
+		{ClientUUID: "partial", LastSeen: now.Add(-2 * time.Hour), Secrets: 1},
+		{ClientUUID: "seen", LastSeen: now, Secrets: 1},
+	}, v.ClientStatuses())
+	require.Equal(t, []ClientStatus{}, (&Vault{data: map[string]*VaultData{}}).ClientStatuses())
+}
+
+func TestAddSecretVersion(t *testing.T) {
+	vaultFile := filepath.Join(t.TempDir(), "vault.json")
+	v := &Vault{
+		data:              map[string]*VaultData{},
+		savePath:          vaultFile,
+		secretProcessUnit: time.Hour,
+	}
+
+	require.Nil(t, v.AddSecret("client", "first", &Secret{Key: "key", ProcessAfter: 1, Version: 10}))
+	require.Equal(t, int64(10), v.data["client"].LastVersion)
+	require.Zero(t, v.data["client"].Secrets["first"].Version)
+
+	require.ErrorIs(t, v.AddSecret("client", "second", &Secret{Key: "key", ProcessAfter: 1, Version: 10}), ErrSecretVersionStale)
+	require.ErrorIs(t, v.AddSecret("client", "second", &Secret{Key: "key", ProcessAfter: 1, Version: 9}), ErrSecretVersionStale)
+	require.NotContains(t, v.data["client"].Secrets, "second")
+
+	// other clients have own versions
+	require.Nil(t, v.AddSecret("other", "second", &Secret{Key: "key", ProcessAfter: 1, Version: 5}))
+
+	// unversioned secret is accepted and keeps last version
+	require.Nil(t, v.AddSecret("client", "unversioned", &Secret{Key: "key", ProcessAfter: 1}))
+	require.Equal(t, int64(10), v.data["client"].LastVersion)
+
+	// replayed upload can't recreate deleted secret
+	delete(v.data["client"].Secrets, "first")
+	require.ErrorIs(t, v.AddSecret("client", "first", &Secret{Key: "key", ProcessAfter: 1, Version: 10}), ErrSecretVersionStale)
+
+	require.Nil(t, v.AddSecret("client", "third", &Secret{Key: "key", ProcessAfter: 1, Version: 11}))
+	require.Equal(t, int64(11), v.data["client"].LastVersion)
+}
@@ -0,0 +1,88 @@
+package vault
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"time"
+)
+
+var (
+	// mocks for tests
+	releaseWebhookInterval = time.Minute
+)
+
+// ReleaseWebhookEvent is posted to vault.release_webhook when secret becomes releasable.
+type ReleaseWebhookEvent struct {
+	Client     string    `json:"client"`
+	Secret     string    `json:"secret"`
+	ReleasedAt time.Time `json:"released_at"`
+}
+
+// notifyReleases periodically posts secrets which became releasable since previous scan to webhook.
+// Secrets released before vault start are not posted. Webhook failures are logged, event is not retried.
+func (v *Vault) notifyReleases(webhook string, chStop chan bool) {
+	log.Printf("starting vault release webhook")
+	ticker := v.clk().NewTicker(releaseWebhookInterval)
+	defer ticker.Stop()
+	lastScan := v.clk().Now()
+	for {
+		select {
+		case now := <-ticker.C():
+			for _, event := range v.releasedBetween(lastScan, now) {
+				if err := postReleaseWebhook(webhook, event); err != nil {
+					log.Printf("unable to post release of secret %s/%s to webhook: %s", event.Client, event.Secret, err)
+				}
+			}
+			lastScan = now
+		// used only for tests
+		case <-chStop:
+			return
+		}
+	}
+}
+
+// releasedBetween returns secrets which release time is after from and not after to, oldest first.
+func (v *Vault) releasedBetween(from time.Time, to time.Time) []ReleaseWebhookEvent {
+	v.mtx.RLock()
+	defer v.mtx.RUnlock()
+
+	events := []ReleaseWebhookEvent{}
+	for clientUUID, clientData := range v.data {
+		for secretUUID, secret := range clientData.Secrets {
+			releaseAt := v.releaseAt(clientData.seenAt(secret), secret)
+			if releaseAt.After(from) && !releaseAt.After(to) {
+				events = append(events, ReleaseWebhookEvent{Client: clientUUID, Secret: secretUUID, ReleasedAt: releaseAt})
+			}
+		}
+	}
+	slices.SortFunc(events, func(a, b ReleaseWebhookEvent) int {
+		return a.ReleasedAt.Compare(b.ReleasedAt)
+	})
+	return events
+}
+
+// postReleaseWebhook sends single release event to webhook, any 2xx response is success.
+func postReleaseWebhook(webhook string, event ReleaseWebhookEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, webhook, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("received wrong status code %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package vault
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReleasedBetween(t *testing.T) {
+	now := time.Now()
+	deadline := now.Add(-30 * time.Minute)
+	v := &Vault{
+		data: map[string]*VaultData{
+			"client": {
+				LastSeen: now.Add(-10 * time.Hour),
+				Secrets: map[string]*Secret{
+					"now":      {ProcessAfter: 10},
+					"deadline": {ProcessAfter: 100, Deadline: &deadline},
+					"pending":  {ProcessAfter: 11},
+					"old":      {ProcessAfter: 8},
+				},
+			},
+			"client2": {
+				LastSeen: now.Add(-10 * time.Hour).Add(-time.Minute),
+				Secrets: map[string]*Secret{
+					"now": {ProcessAfter: 10},
+				},
+			},
+		},
+		secretProcessUnit: time.Hour,
+	}
+
+	require.Equal(t, []ReleaseWebhookEvent{
+		{Client: "client", Secret: "deadline", ReleasedAt: deadline},
+		{Client: "client2", Secret: "now", ReleasedAt: now.Add(-time.Minute)},
+		{Client: "client", Secret: "now", ReleasedAt: now},
+	}, v.releasedBetween(now.Add(-time.Hour), now))
+	require.Empty(t, v.releasedBetween(now, now.Add(30*time.Minute)))
+}
+
+func TestNotifyReleases(t *testing.T) {
+	events := make(chan ReleaseWebhookEvent, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, http.MethodPost, r.Method)
+		require.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		var event ReleaseWebhookEvent
+		require.Nil(t, json.NewDecoder(r.Body).Decode(&event))
+		events <- event
+		if event.Secret == "failing" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	releaseWebhookInterval = 10 * time.Millisecond
+	defer func() { releaseWebhookInterval = time.Minute }()
+
+	v := &Vault{
+		data: map[string]*VaultData{
+			"client": {
+				LastSeen: time.Now().Add(-10 * time.Second).Add(50 * time.Millisecond),
+				Secrets: map[string]*Secret{
+					"released": {ProcessAfter: 5},
+					"failing":  {ProcessAfter: 10},
+					"soon":     {ProcessAfter: 10},
+				},
+			},
+		},
+		secretProcessUnit: time.Second,
+	}
+
+	chStop := make(chan bool)
+	go v.notifyReleases(server.URL, chStop)
+
+	posted := []string{}
+	for range 2 {
+		select {
+		case event := <-events:
+			require.Equal(t, "client", event.Client)
+			posted = append(posted, event.Secret)
+		case <-time.After(time.Second):
+			t.Fatalf("release was not posted, got %v", posted)
+		}
+	}
+	require.ElementsMatch(t, []string{"failing", "soon"}, posted)
+	chStop <- true
+	require.Empty(t, events)
+}
+
+func TestPostReleaseWebhook(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	require.EqualError(t, postReleaseWebhook(server.URL, ReleaseWebhookEvent{}), "received wrong status code 502")
+	require.Error(t, postReleaseWebhook("http://127.0.0.1:0", ReleaseWebhookEvent{}))
+}
@@ -0,0 +1,29 @@
+package version
+
+import "runtime"
+
+// Version is DMH version, Commit and Date describe the build. They are set at build time:
+// go build -ldflags "-X dmh/internal/version.Version=v1.2.3 -X dmh/internal/version.Commit=abc1234 -X dmh/internal/version.Date=2025-03-26T14:00:00Z"
+var (
+	Version = "dev"
+	Commit  = "unknown"
+	Date    = "unknown"
+)
+
+// Info describes DMH build.
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	Date      string `json:"date"`
+	GoVersion string `json:"go_version"`
+}
+
+// Get returns Info of running binary.
+func Get() Info {
+	return Info{Version: Version, Commit: Commit, Date: Date, GoVersion: runtime.Version()}
+}
+
+// String returns human readable build description, e.g. "v1.2.3 (commit abc1234, built 2025-03-26T14:00:00Z, go1.25.0)".
+func (i Info) String() string {
+	return i.Version + " (commit " + i.Commit + ", built " + i.Date + ", " + i.GoVersion + ")"
+}
@@ -0,0 +1,14 @@
+package version
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGet(t *testing.T) {
+	info := Get()
+	require.Equal(t, Info{Version: "dev", Commit: "unknown", Date: "unknown", GoVersion: runtime.Version()}, info)
+	require.Equal(t, "dev (commit unknown, built unknown, "+runtime.Version()+")", info.String())
+}
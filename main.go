@@ -1,27 +1,139 @@
 package main
 
 import (
+	"cmp"
+	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"slices"
+	"syscall"
 	"time"
 
 	"dmh/internal/api"
+	"dmh/internal/auth"
+	"dmh/internal/clock"
 	"dmh/internal/execute"
 	"dmh/internal/metric"
 	"dmh/internal/state"
+	"dmh/internal/tracing"
+	"dmh/internal/useragent"
 	"dmh/internal/vault"
+	"dmh/internal/version"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// shutdownTimeout bounds graceful shutdown of HTTP server and tracing exporter.
+const shutdownTimeout = 15 * time.Second
+
+// defaultActionRunTimeout bounds single action run when action.run_timeout is not set.
+const defaultActionRunTimeout = 60 * time.Second
+
+// defaultEmptyWarnAfter is time after which empty DMH or vault is reported when metrics.empty_warn_after is not set.
+const defaultEmptyWarnAfter = 24 * time.Hour
+
+// confirmPolicy describes actions which require confirmation before they run.
+// Due action is marked as pending and runs only when Window passes without user check-in.
+type confirmPolicy struct {
+	Kinds       []string
+	Destructive bool // every action with destructive severity requires confirmation, regardless of kind
+	Window      time.Duration
+}
+
+// requires returns true when action kind or severity requires confirmation.
+func (p confirmPolicy) requires(a *state.Action) bool {
+	return slices.Contains(p.Kinds, a.Kind) || (p.Destructive && a.Destructive())
+}
+
+// failureBackoff delays retries of action which Run keeps failing.
+type failureBackoff struct {
+	After   int           // consecutive failures before backoff starts, 0 disables backoff
+	Initial time.Duration // delay after After failures, doubled with every next failure
+	Max     time.Duration // delay cap
+}
+
+// retryAt returns when action which failed can run again.
+// Zero time is returned when backoff is disabled or action did not fail enough times.
+func (b failureBackoff) retryAt(a *state.EncryptedAction) time.Time {
+	if b.After <= 0 || a.ConsecutiveFailures < b.After || a.LastFailure == nil {
+		return time.Time{}
+	}
+	delay := b.Initial
+	for i := b.After; i < a.ConsecutiveFailures && delay < b.Max; i++ {
+		delay *= 2
+	}
+	return a.LastFailure.Add(min(delay, b.Max))
+}
+
+// serverTLS describes TLS of DMH HTTP server, plaintext HTTP is served when CertFile is empty.
+type serverTLS struct {
+	CertFile   string
+	KeyFile    string
+	MinVersion uint16
+}
+
+// listenAndServe starts server with TLS when certificate is configured.
+func (t serverTLS) listenAndServe(server *http.Server) error {
+	if t.CertFile == "" {
+		return server.ListenAndServe()
+	}
+	server.TLSConfig = &tls.Config{MinVersion: t.MinVersion}
+	return server.ListenAndServeTLS(t.CertFile, t.KeyFile)
+}
+
+// vaultDowntime tracks how long remote vault was unreachable when decrypting actions.
+// Once it exceeds Max, instance is reported as not ready until vault responds again,
+// so operator knows actions can't run even when they are due.
+type vaultDowntime struct {
+	Max       time.Duration // 0 disables readiness alert
+	Readiness *api.Readiness
+	since     time.Time // first unreachable decrypt since vault last responded
+	alerted   bool
+}
+
+// observe records result of single decrypt attempt finished at now.
+// Nil vaultDowntime ignores all attempts.
+func (d *vaultDowntime) observe(err error, now time.Time) {
+	if d == nil || d.Max <= 0 {
+		return
+	}
+	if !errors.Is(err, state.ErrVaultUnreachable) {
+		if d.alerted {
+			log.Printf("remote vault is reachable again, actions can be decrypted")
+			d.Readiness.SetReady(api.ReadyRemoteVaultLink)
+		}
+		d.since = time.Time{}
+		d.alerted = false
+		return
+	}
+	if d.since.IsZero() {
+		d.since = now
+	}
+	if !d.alerted && now.Sub(d.since) > d.Max {
+		log.Printf("remote vault is unreachable for more than %s, due actions can't be decrypted", d.Max)
+		d.Readiness.SetNotReady(api.ReadyRemoteVaultLink)
+		d.alerted = true
+	}
+}
+
 var (
 	getActionsInterval     = 5
 	getActionsIntervalUnit = time.Minute
 	actionProcessUnit      = time.Hour
+	// remoteVaultProbeInterval is delay between remote vault probes until first success.
+	remoteVaultProbeInterval = 10 * time.Second
 	// mocks for tests
 	stateNew         = state.New
 	executeNew       = execute.New
+	executeSelfTest  = execute.SelfTest
 	vaultNew         = vault.New
 	metricInitialize = metric.Initialize
 )
@@ -34,62 +146,138 @@ func main() {
 		configFile = "config.yaml"
 	}
 
-	k := readConfig(configFile)
+	k := readConfig(configFile, os.Getenv("DMH_CONFIG_DIR"))
 
 	enabledComponents := k.Strings("components")
 
 	actionProcessUnit = processUnit(k)
 
 	authConfig := getAuthConfig(k)
+	var tokens *auth.TokenStore
+	if authConfig.Enabled {
+		var err error
+		tokens, err = auth.NewTokenStore(authConfig.Bearer.Tokens, authConfig.Bearer.RotationFile)
+		if err != nil {
+			log.Panicf("unable to load bearer tokens: %s", err)
+		}
+	}
+
+	useragent.Set(k.String("http.user_agent"))
+	log.Printf("starting dead-man-hand %s", version.Get())
+
+	shutdownTracing, err := tracing.Initialize(&tracing.Options{Endpoint: k.String("otel.endpoint")})
+	if err != nil {
+		log.Panicf("unable to initialize tracing: %s", err)
+	}
+
+	var readyComponents []string
+	if slices.Contains(enabledComponents, "dmh") {
+		readyComponents = append(readyComponents, api.ReadyState, api.ReadyRemoteVaultProbe)
+	}
+	if slices.Contains(enabledComponents, "vault") {
+		readyComponents = append(readyComponents, api.ReadyVault)
+	}
+	readiness := api.NewReadiness(readyComponents...)
 
 	var s state.StateInterface
 	var v vault.VaultInterface
 	var e execute.ExecuteInterface
-	var err error
+	var m *metric.PromCollector
+	// Vault starts first, so colocated DMH can call it directly. Metric collector needs state,
+	// it is created later - vault callbacks fire only after HTTP server and dispatcher are started.
+	if slices.Contains(enabledComponents, "vault") {
+		log.Printf("starting vault component")
+		vaultOpts := vaultOptions(k)
+		vaultOpts.OnSecretRelease = func(clientUUID string) { m.RecordVaultSecretRelease(clientUUID) }
+		vaultOpts.OnClockSkew = func(clientUUID string, skew time.Duration) { m.SetVaultClientClockSkew(clientUUID, skew) }
+		v, err = vaultNew(vaultOpts)
+		if err != nil {
+			log.Panicf("unable to create vault: %s", err)
+		}
+		readiness.SetReady(api.ReadyVault)
+	}
+
 	if slices.Contains(enabledComponents, "dmh") {
 		log.Printf("starting DMH component")
-		s, err = stateNew(stateOptions(k))
+		stateOpts := stateOptions(k)
+		if inProcessVault(k) {
+			log.Printf("calling colocated vault directly, remote_vault.url is not used")
+			stateOpts.Vault = v
+		}
+		s, err = stateNew(stateOpts)
 		if err != nil {
 			log.Panicf("unable to create state: %s", err)
 		}
+		if declared := declaredActions(k); len(declared) > 0 {
+			if err := s.Reconcile(declared); err != nil {
+				log.Printf("unable to reconcile declared actions: %s", err)
+			}
+		}
+		readiness.SetReady(api.ReadyState)
 
-		e, err = executeNew(&execute.Options{
+		executeOpts := &execute.Options{
 			BulkSMSConf:     getBulkSMSConfig(k),
 			MailConf:        getMailConfig(k),
+			JSONPostConf:    getJSONPostConfig(k),
+			JournalConf:     getJournalConfig(k),
+			FileWriteConf:   getFileWriteConfig(k),
 			SignedURLSecret: authConfig.SignedURL.Secret,
 			SignedURLTTL:    authConfig.SignedURL.TTL,
-		})
+			TestMode:        getTestModeConfig(k),
+			AllowedKinds:    k.Strings("execute.allowed_kinds"),
+			Mode:            k.String("execute.mode"),
+			QueueConf:       getQueueConfig(k),
+		}
+		e, err = executeNew(executeOpts)
 		if err != nil {
 			log.Panicf("unable to create execute: %s", err)
 		}
+		actionCallbacks = callbackConfig{JSONPost: executeOpts.JSONPostConf, Disabled: executeOpts.TestMode.Enabled}
+		selfTestExecute(executeOpts, validateOnStart(k), k.Bool("execute.validate_probe"))
 	}
 
-	if slices.Contains(enabledComponents, "vault") {
-		log.Printf("starting vault component")
-		v, err = vaultNew(vaultOptions(k))
-		if err != nil {
-			log.Panicf("unable to create vault: %s", err)
+	m = metricInitialize(metricOptions(k, s, v))
+
+	if slices.Contains(enabledComponents, "dmh") {
+		if k.Bool("state.verify_vault_keys") {
+			go verifyVaultKeys(s, m)
+		}
+		go checkVaultProcessUnit(s, m, actionProcessUnit)
+		go probeRemoteVault(s, readiness)
+		clk := clock.New()
+		go dispatcher(s, e, m, actionProcessUnit, actionRunTimeout(k), getConfirmPolicy(k, actionProcessUnit), getFailureBackoff(k), &vaultDowntime{Max: maxVaultDowntime(k), Readiness: readiness}, dispatchJitter(k), clk, make(chan bool))
+		if gcAfter := actionsGCAfter(k, actionProcessUnit); gcAfter > 0 {
+			go actionsGC(s, m, gcAfter, clk, make(chan bool))
 		}
 	}
 
-	m := metricInitialize(&metric.Options{State: s, VaultToken: k.String("remote_vault.token")})
-
-	if slices.Contains(enabledComponents, "dmh") {
-		go dispatcher(s, e, m, actionProcessUnit, make(chan bool))
+	if interval := reconcileInterval(k); interval > 0 {
+		go reconcile(s, v, m, interval, make(chan bool))
 	}
 
 	httpRouter := api.NewRouter(&api.Options{
-		State:           s,
-		Vault:           v,
-		Execute:         e,
-		Auth:            authConfig,
-		VaultURL:        k.String("remote_vault.url"),
-		VaultClientUUID: k.String("remote_vault.client_uuid"),
-		VaultToken:      k.String("remote_vault.token"),
-		DMHEnabled:      slices.Contains(enabledComponents, "dmh"),
-		VaultEnabled:    slices.Contains(enabledComponents, "vault"),
-		Debug:           k.Bool("debug"),
-		Metric:          m,
+		State:               s,
+		Vault:               v,
+		Execute:             e,
+		Auth:                authConfig,
+		VaultURL:            k.String("remote_vault.url"),
+		AdditionalVaultURLs: additionalVaultURLs(k),
+		VaultClientUUID:     k.String("remote_vault.client_uuid"),
+		VaultToken:          k.String("remote_vault.token"),
+		DMHEnabled:          slices.Contains(enabledComponents, "dmh"),
+		VaultEnabled:        slices.Contains(enabledComponents, "vault"),
+		Debug:               k.Bool("debug"),
+		Metric:              m,
+		LastSeenMeta:        getLastSeenMetaConfig(k),
+		RequiredSources:     requiredSources(k),
+		ActionProcessUnit:   actionProcessUnit,
+		EventsEnabled:       k.Bool("state.events.enabled"),
+		Readiness:           readiness,
+		Tokens:              tokens,
+		ActionVerifyURL:     k.String("action.verify.public_url"),
+		MaxBodyBytes:        maxBodyBytes(k),
+		ActionMaxDataBytes:  actionMaxDataBytes(k),
+		AliveCronToken:      aliveCronToken(k),
 	})
 
 	httpServer := &http.Server{
@@ -100,57 +288,344 @@ func main() {
 		IdleTimeout:  60 * time.Second,
 	}
 
-	log.Fatal(httpServer.ListenAndServe())
+	serverTLS := getServerTLS(k)
+	if serverTLS.CertFile != "" {
+		log.Printf("serving HTTPS with certificate %s", serverTLS.CertFile)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- serverTLS.listenAndServe(httpServer)
+	}()
+	select {
+	case err := <-serverErr:
+		log.Fatal(err)
+	case <-ctx.Done():
+	}
+
+	// Graceful shutdown lets in-flight requests finish and flushes buffered spans.
+	log.Printf("shutting down dead-man-hand")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := httpServer.Shutdown(shutdownCtx); err != nil {
+		log.Printf("unable to shutdown http server: %s", err)
+	}
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		log.Printf("unable to shutdown tracing: %s", err)
+	}
+}
+
+// verifyVaultKeys checks once that remote vault knows about every action key.
+// Actions with missing keys are logged and reported with dmh_missing_secrets_total.
+func verifyVaultKeys(s state.StateInterface, m *metric.PromCollector) {
+	for _, result := range s.VerifyVaultKeys() {
+		if result.Err != nil {
+			log.Printf("unable to verify vault key for action %s: %s", result.UUID, result.Err)
+			m.UpdateDMHMissingSecrets(result.UUID, 1)
+		}
+	}
 }
 
-func dispatcher(s state.StateInterface, e execute.ExecuteInterface, m *metric.PromCollector, actionProcessUnit time.Duration, chStop chan bool) {
-	processActionsTicker := time.NewTicker(time.Duration(getActionsInterval) * getActionsIntervalUnit)
+// reconcile periodically checks that actions and vault secrets stay consistent.
+// DMH side is checked when s is not nil, vault side when v is not nil.
+func reconcile(s state.StateInterface, v vault.VaultInterface, m *metric.PromCollector, interval time.Duration, chStop chan bool) {
+	reconcileTicker := time.NewTicker(interval)
 	for {
 		select {
-		case <-processActionsTicker.C:
-			for _, a := range s.GetActions() {
-				if a.Processed == 2 {
+		case <-reconcileTicker.C:
+			if s != nil {
+				reconcileState(s, m)
+			}
+			if v != nil {
+				reconcileVault(v, m, interval)
+			}
+		// used only for tests
+		case <-chStop:
+			return
+		}
+	}
+}
+
+// reconcileState checks that vault secret of every not fired action exists and has matching process_after.
+// Mismatches are logged and counted in dmh_reconcile_mismatch_total.
+func reconcileState(s state.StateInterface, m *metric.PromCollector) {
+	for _, result := range s.VerifyVaultKeys() {
+		if result.Err == nil {
+			continue
+		}
+		mismatchType := "missing_secret"
+		if errors.Is(result.Err, state.ErrProcessAfterMismatch) {
+			mismatchType = "process_after"
+		}
+		log.Printf("reconcile: action %s is inconsistent with vault (%s): %s", result.UUID, mismatchType, result.Err)
+		m.RecordReconcileMismatch(mismatchType)
+	}
+}
+
+// reconcileVault flags secrets which stayed in vault longer than interval after release,
+// their client stopped sending heartbeats and DMH did not delete them after action run.
+// Number of stale secrets is gauge, the same secret is found again on every tick until it is deleted.
+func reconcileVault(v vault.VaultInterface, m *metric.PromCollector, interval time.Duration) {
+	stale := v.StaleSecrets(interval)
+	for _, secret := range stale {
+		log.Printf("reconcile: vault secret %s was released more than %s ago and was not deleted", secret, interval)
+	}
+	m.SetReconcileStaleSecrets(len(stale))
+}
+
+// actionsGC periodically removes fully processed actions, see collectActions.
+func actionsGC(s state.StateInterface, m *metric.PromCollector, gcAfter time.Duration, clk clock.Clock, chStop chan bool) {
+	gcTicker := clk.NewTicker(time.Duration(getActionsInterval) * getActionsIntervalUnit)
+	defer gcTicker.Stop()
+	for {
+		select {
+		case <-gcTicker.C():
+			collectActions(s, m, gcAfter, clk.Now())
+		// used only for tests
+		case <-chStop:
+			return
+		}
+	}
+}
+
+// collectActions deletes actions with deleted vault key (Processed 2) which last run more than gcAfter before now.
+// Per action metrics of deleted actions are dropped.
+func collectActions(s state.StateInterface, m *metric.PromCollector, gcAfter time.Duration, now time.Time) {
+	for _, a := range s.GetActions() {
+		if a.Processed != 2 || now.Before(a.LastRun.Add(gcAfter)) {
+			continue
+		}
+		if err := s.DeleteAction(a.UUID); err != nil {
+			log.Printf("unable to garbage collect action %s: %s", a.UUID, err)
+			continue
+		}
+		log.Printf("garbage collected processed action %s (kind:%s, comment:%s)", a.UUID, a.Kind, a.Comment)
+		m.RecordActionCollected(a.UUID)
+	}
+}
+
+// probeRemoteVault requests remote vault info until it succeeds once, then marks remote vault probe as ready.
+func probeRemoteVault(s state.StateInterface, readiness *api.Readiness) {
+	for {
+		_, err := s.GetVaultProcessUnit()
+		if err == nil {
+			readiness.SetReady(api.ReadyRemoteVaultProbe)
+			return
+		}
+		log.Printf("remote vault is not reachable yet: %s", err)
+		time.Sleep(remoteVaultProbeInterval)
+	}
+}
+
+// checkVaultProcessUnit compares remote vault process unit with DMH action.process_unit.
+// On mismatch secrets would be released too early or too late, this is logged and
+// reported with dmh_vault_process_unit_mismatch.
+func checkVaultProcessUnit(s state.StateInterface, m *metric.PromCollector, actionProcessUnit time.Duration) {
+	vaultProcessUnit, err := s.GetVaultProcessUnit()
+	if err != nil {
+		log.Printf("unable to check vault process unit: %s", err)
+		return
+	}
+	if vaultProcessUnit != actionProcessUnit {
+		log.Printf("vault process unit %s differs from action.process_unit %s, secrets will be released at wrong time", vault.ProcessUnitName(vaultProcessUnit), vault.ProcessUnitName(actionProcessUnit))
+		m.SetVaultProcessUnitMismatch(true)
+		return
+	}
+	m.SetVaultProcessUnitMismatch(false)
+}
+
+// startActionSpan starts span for single dispatcher step of action.
+func startActionSpan(ctx context.Context, tracer trace.Tracer, name string, a *state.EncryptedAction) trace.Span {
+	_, span := tracer.Start(ctx, name, trace.WithAttributes(
+		attribute.String("action.uuid", a.UUID),
+		attribute.String("action.kind", a.Kind),
+	))
+	return span
+}
+
+// endSpan marks span as errored when err is not nil and ends it.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// selfTestExecute checks execute plugins at startup, so misconfiguration is not discovered when action fires.
+// Empty mode disables self-test, failed self-test is logged in warn mode and stops DMH in fail mode.
+func selfTestExecute(opts *execute.Options, mode string, probe bool) {
+	if mode == "" {
+		return
+	}
+	if err := executeSelfTest(context.Background(), opts, probe); err != nil {
+		if mode == "fail" {
+			log.Panicf("execute self-test failed: %s", err)
+		}
+		log.Printf("WARNING: execute self-test failed, actions may not be delivered: %s", err)
+		return
+	}
+	log.Printf("execute self-test passed")
+}
+
+// reportActionError records failed dispatcher step in metrics and publishes it as State event.
+func reportActionError(s state.StateInterface, m *metric.PromCollector, actionUUID string, step string, err error) {
+	m.UpdateDMHActionErrors(actionUUID, step, 1)
+	s.ReportActionError(actionUUID, step, err)
+}
+
+// dispatcher runs actions when user was not seen for long enough.
+// Every tick is traced with single span, with child span per DecryptAction/Run/MarkActionAsProcessed.
+// Spans are no-op unless tracing was initialized.
+// Every action Run is cancelled after runTimeout, so hung external service can't block next actions.
+// Actions of kinds from confirm policy are first marked as pending, they run after confirm window.
+// Action which Run fails runs its fallback, when it has one. Temporary failure (execute.ErrTemporary) is retried with primary plugin.
+// Action which Run keeps failing is not retried until its backoff passes.
+// LastSeen is checked on every tick, recurring action (MinInterval > 0) stops running as soon as user is seen again.
+// Actions waiting for delivery verification never run.
+// Recurring action with dedupe window is skipped when identical data was delivered within the window.
+// Action with dependencies runs only after all of them were fully processed and its depends delay passed.
+// Decrypt attempts failing on unreachable vault are counted and tracked by downtime.
+// Every run waits random delay up to jitter (wall time), so colocated instances don't fire at the same instant.
+// All timing decisions use clk, so tests can drive dispatcher with clock.FakeClock.
+func dispatcher(s state.StateInterface, e execute.ExecuteInterface, m *metric.PromCollector, actionProcessUnit time.Duration, runTimeout time.Duration, confirm confirmPolicy, backoff failureBackoff, downtime *vaultDowntime, jitter time.Duration, clk clock.Clock, chStop chan bool) {
+	tracer := otel.Tracer(tracing.ServiceName)
+	processActionsTicker := clk.NewTicker(time.Duration(getActionsInterval) * getActionsIntervalUnit)
+	defer processActionsTicker.Stop()
+	for {
+		select {
+		case tick := <-processActionsTicker.C():
+			// Tick time is used for whole tick, so fake clock moved by test can't change it mid tick.
+			now := tick
+			if delay := clock.Jitter(jitter); delay > 0 {
+				if !clock.Sleep(delay, chStop) {
+					return
+				}
+				now = clk.Now()
+			}
+			ctx, tickSpan := tracer.Start(context.Background(), "dispatcher.tick")
+			actions := s.GetActions()
+			// Higher priority actions run first, stable sort keeps insertion order for equal priorities.
+			slices.SortStableFunc(actions, func(a, b *state.EncryptedAction) int {
+				return cmp.Compare(b.Priority, a.Priority)
+			})
+			for _, a := range actions {
+				// Gauge follows backoff window on every tick, it is cleared once window passes,
+				// whatever happens with action later (run, check-in, pause).
+				retryAt := backoff.retryAt(a)
+				m.SetActionBackoff(a.UUID, now.Before(retryAt))
+				if a.Processed == 2 || a.PendingVerification() || a.Paused() || !a.DependenciesReady(actions, actionProcessUnit, now) {
 					continue
 				}
-				now := time.Now()
-				if now.Sub(s.GetLastSeen()) > time.Duration(a.ProcessAfter)*actionProcessUnit {
+				unit := a.Unit(actionProcessUnit)
+				lastSeen := s.GetLastSeen()
+				// Maintenance moves ProcessAfter of every action, Deadline fires action even when user keeps checking in.
+				if now.After(a.FireAt(a.SeenAt(lastSeen).Add(s.GetMaintenance().Duration()), actionProcessUnit)) {
 					lastRun, err := s.GetActionLastRun(a.UUID)
 					if err != nil {
 						log.Printf("unable to get action last run  %s: %s", a.UUID, err)
-						m.UpdateDMHActionErrors(a.UUID, "GetActionLastRun", 1)
+						reportActionError(s, m, a.UUID, "GetActionLastRun", err)
 						continue
 					}
-					if now.Sub(lastRun) > time.Duration(a.MinInterval)*actionProcessUnit {
+					if now.Sub(lastRun) > time.Duration(a.MinInterval)*unit {
 						if a.Processed == 0 {
+							if confirm.requires(&a.Action) {
+								if a.PendingSince == nil {
+									log.Printf("action %s (kind:%s, severity:%s, comment:%s) requires confirmation, it will run after %s unless user checks in", a.UUID, a.Kind, a.Severity, a.Comment, confirm.Window)
+									if err := s.MarkActionPending(a.UUID); err != nil {
+										log.Printf("unable to mark action %s as pending: %s", a.UUID, err)
+										reportActionError(s, m, a.UUID, "MarkActionPending", err)
+									}
+									continue
+								}
+								if now.Before(a.PendingSince.Add(confirm.Window)) {
+									continue
+								}
+							}
+							if now.Before(retryAt) {
+								continue
+							}
 							log.Printf("running action %s (kind:%s, comment:%s)", a.UUID, a.Kind, a.Comment)
+							span := startActionSpan(ctx, tracer, "DecryptAction", a)
 							decryptedAction, err := s.DecryptAction(a.UUID)
+							endSpan(span, err)
+							downtime.observe(err, clk.Now())
+							if errors.Is(err, state.ErrVaultUnreachable) {
+								m.RecordVaultDecryptUnreachable(a.UUID)
+							}
 							if err != nil {
 								log.Printf("unable to decrypt action %s: %s", a.UUID, err)
-								m.UpdateDMHActionErrors(a.UUID, "DecryptAction", 1)
+								reportActionError(s, m, a.UUID, "DecryptAction", err)
+								continue
+							}
+							dataHash := a.DataHash(decryptedAction.Data)
+							if a.Duplicate(dataHash, now, actionProcessUnit) {
+								log.Printf("skipping action %s, identical data was delivered within dedupe window", a.UUID)
+								m.RecordActionSuppressed(a.UUID)
+								if err := s.SuppressActionRun(a.UUID); err != nil {
+									log.Printf("unable to suppress action run %s: %s", a.UUID, err)
+									reportActionError(s, m, a.UUID, "SuppressActionRun", err)
+								}
 								continue
 							}
 
-							if err := e.Run(decryptedAction); err != nil {
-								log.Printf("unable to run action %s: %s", a.UUID, err)
-								m.UpdateDMHActionErrors(a.UUID, "Run", 1)
+							span = startActionSpan(ctx, tracer, "Run", a)
+							runCtx, cancel := context.WithTimeout(ctx, runTimeout)
+							runCtx = execute.WithRunMeta(runCtx, execute.RunMeta{UUID: a.UUID, Comment: a.Comment, LastSeen: lastSeen})
+							err = e.Run(runCtx, decryptedAction)
+							cancel()
+							endSpan(span, err)
+							step, path := "Run", "primary"
+							if errors.Is(err, execute.ErrTemporary) {
+								// e.g. SMTP greylisting, primary plugin is expected to pass on retry, fallback is not needed.
+								step = "RunTemporary"
+							} else if fallback := decryptedAction.FallbackAction(); err != nil && fallback != nil {
+								log.Printf("unable to run action %s: %s, running fallback (kind:%s)", a.UUID, err, fallback.Kind)
+								reportActionError(s, m, a.UUID, step, err)
+								step, path = "RunFallback", "fallback"
+								span = startActionSpan(ctx, tracer, step, a)
+								runCtx, cancel := context.WithTimeout(ctx, runTimeout)
+								runCtx = execute.WithRunMeta(runCtx, execute.RunMeta{UUID: a.UUID, Comment: a.Comment, LastSeen: lastSeen})
+								err = e.Run(runCtx, fallback)
+								cancel()
+								endSpan(span, err)
+							}
+							notifyActionCallback(a, path, err, now)
+							if err != nil {
+								log.Printf("unable to run action %s (%s): %s", a.UUID, path, err)
+								reportActionError(s, m, a.UUID, step, err)
+								if err := s.RecordActionFailure(a.UUID); err != nil {
+									log.Printf("unable to record action failure %s: %s", a.UUID, err)
+								}
 								continue
 							}
+							m.RecordActionRun(a.UUID, path)
+							if a.DedupeWindow > 0 {
+								if err := s.RecordActionDelivery(a.UUID, dataHash); err != nil {
+									log.Printf("unable to record action delivery %s: %s", a.UUID, err)
+								}
+							}
 							if err := s.UpdateActionLastRun(a.UUID); err != nil {
 								log.Printf("unable to update action last run %s: %s", a.UUID, err)
-								m.UpdateDMHActionErrors(a.UUID, "UpdateActionLastRun", 1)
+								reportActionError(s, m, a.UUID, "UpdateActionLastRun", err)
 								continue
 							}
 						}
 						if a.MinInterval <= 0 {
-							if err := s.MarkActionAsProcessed(a.UUID); err != nil {
+							span := startActionSpan(ctx, tracer, "MarkActionAsProcessed", a)
+							err := s.MarkActionAsProcessed(a.UUID)
+							endSpan(span, err)
+							if err != nil {
 								log.Printf("unable to mark action %s as processed: %s", a.UUID, err)
-								m.UpdateDMHActionErrors(a.UUID, "MarkActionAsProcessed", 1)
+								reportActionError(s, m, a.UUID, "MarkActionAsProcessed", err)
 								continue
 							}
 						}
 					}
 				}
 			}
+			tickSpan.End()
 		// used only for tests
 		case <-chStop:
 			return
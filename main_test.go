@@ -4,14 +4,18 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"regexp"
 	"testing"
 	"time"
 
+	"dmh/internal/api"
+	"dmh/internal/clock"
 	"dmh/internal/execute"
 	"dmh/internal/metric"
 	"dmh/internal/state"
@@ -21,29 +25,81 @@ import (
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 )
 
 type mockState struct {
 	mock.Mock
 }
 
-func (m *mockState) UpdateLastSeen() {
+func (m *mockState) UpdateLastSeen(meta *state.LastSeenMeta) {
+	m.Called(meta)
+}
+
+func (m *mockState) MarkGone() {
 	m.Called()
 }
 
+func (m *mockState) UpdatePartialLastSeen(percent int, defaultUnit time.Duration) int {
+	args := m.Called(percent, defaultUnit)
+	return args.Int(0)
+}
+
 func (m *mockState) GetLastSeen() time.Time {
 	args := m.Called()
 	return args.Get(0).(time.Time)
 }
 
+func (m *mockState) GetLastSeenMeta() *state.LastSeenMeta {
+	args := m.Called()
+	if args.Get(0) == nil {
+		return nil
+	}
+	return args.Get(0).(*state.LastSeenMeta)
+}
+
+func (m *mockState) SetMaintenance(extend time.Duration) {
+	m.Called(extend)
+}
+
+func (m *mockState) ClearMaintenance() {
+	m.Called()
+}
+
+func (m *mockState) GetMaintenance() *state.Maintenance {
+	args := m.Called()
+	if args.Get(0) == nil {
+		return nil
+	}
+	return args.Get(0).(*state.Maintenance)
+}
+
 func (m *mockState) GetActions() []*state.EncryptedAction {
 	args := m.Called()
 	return args.Get(0).([]*state.EncryptedAction)
 }
 
-func (m *mockState) AddAction(action *state.Action) error {
+func (m *mockState) AddAction(action *state.Action) (string, error) {
 	args := m.Called(action)
-	return args.Error(0)
+	return args.String(0), args.Error(1)
+}
+
+func (m *mockState) AddUnverifiedAction(action *state.Action, verifyToken string) (string, error) {
+	args := m.Called(action, verifyToken)
+	return args.String(0), args.Error(1)
+}
+
+func (m *mockState) VerifyAction(verifyToken string) (string, error) {
+	args := m.Called(verifyToken)
+	return args.String(0), args.Error(1)
+}
+
+func (m *mockState) AcknowledgeReceipt(receiptToken string) (string, error) {
+	args := m.Called(receiptToken)
+	return args.String(0), args.Error(1)
 }
 
 func (m *mockState) GetAction(uuid string) (*state.EncryptedAction, int) {
@@ -59,11 +115,46 @@ func (m *mockState) DeleteAction(uuid string) error {
 	return args.Error(0)
 }
 
+func (m *mockState) DeleteAllActions(deleteVaultSecrets bool) *state.PurgeResult {
+	args := m.Called(deleteVaultSecrets)
+	return args.Get(0).(*state.PurgeResult)
+}
+
+func (m *mockState) ReorderActions(uuids []string) error {
+	args := m.Called(uuids)
+	return args.Error(0)
+}
+
 func (m *mockState) MarkActionAsProcessed(uuid string) error {
 	args := m.Called(uuid)
 	return args.Error(0)
 }
 
+func (m *mockState) MarkActionPending(uuid string) error {
+	args := m.Called(uuid)
+	return args.Error(0)
+}
+
+func (m *mockState) RecordActionFailure(uuid string) error {
+	args := m.Called(uuid)
+	return args.Error(0)
+}
+
+func (m *mockState) UpdateSourceLastSeen(source string, meta *state.LastSeenMeta) (bool, error) {
+	args := m.Called(source, meta)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *mockState) SourceLastSeenAdvances(source string) (bool, error) {
+	args := m.Called(source)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *mockState) CancelActionPending(uuid string) error {
+	args := m.Called(uuid)
+	return args.Error(0)
+}
+
 func (m *mockState) DecryptAction(uuid string) (*state.Action, error) {
 	args := m.Called(uuid)
 	if args.Get(0) == nil {
@@ -77,20 +168,95 @@ func (m *mockState) UpdateActionLastRun(uuid string) error {
 	return args.Error(0)
 }
 
+func (m *mockState) Panic(purge bool) *state.PanicResult {
+	args := m.Called(purge)
+	return args.Get(0).(*state.PanicResult)
+}
+
+func (m *mockState) Reconcile(declared []*state.Action) error {
+	args := m.Called(declared)
+	return args.Error(0)
+}
+
+func (m *mockState) SnapshotAt(t time.Time) (*state.Snapshot, error) {
+	args := m.Called(t)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*state.Snapshot), args.Error(1)
+}
+
+func (m *mockState) GetFiredLog(since time.Time) ([]*state.FiredEntry, error) {
+	args := m.Called(since)
+	return args.Get(0).([]*state.FiredEntry), args.Error(1)
+}
+
+func (m *mockState) RecordActionDelivery(uuid string, dataHash string) error {
+	args := m.Called(uuid, dataHash)
+	return args.Error(0)
+}
+
+func (m *mockState) SuppressActionRun(uuid string) error {
+	args := m.Called(uuid)
+	return args.Error(0)
+}
+
 func (m *mockState) GetActionLastRun(uuid string) (time.Time, error) {
 	args := m.Called(uuid)
 	return args.Get(0).(time.Time), args.Error(1)
 }
 
+func (m *mockState) VerifyVaultKeys() []state.VerifyResult {
+	args := m.Called()
+	return args.Get(0).([]state.VerifyResult)
+}
+
+func (m *mockState) GetVaultProcessUnit() (time.Duration, error) {
+	args := m.Called()
+	return args.Get(0).(time.Duration), args.Error(1)
+}
+
+func (m *mockState) Subscribe() (<-chan *state.Event, func()) {
+	args := m.Called()
+	return args.Get(0).(<-chan *state.Event), args.Get(1).(func())
+}
+
+func (m *mockState) ReportActionError(uuid string, step string, err error) {
+	m.Called(uuid, step, err)
+}
+
 type mockExecute struct {
 	mock.Mock
 }
 
-func (e *mockExecute) Run(action *state.Action) error {
+func (e *mockExecute) Run(ctx context.Context, action *state.Action) error {
+	args := e.Called(ctx, action)
+	return args.Error(0)
+}
+
+func (e *mockExecute) RunVerification(ctx context.Context, action *state.Action, link string) error {
+	args := e.Called(ctx, action, link)
+	return args.Error(0)
+}
+
+func (e *mockExecute) Validate(action *state.Action) error {
 	args := e.Called(action)
 	return args.Error(0)
 }
 
+func (e *mockExecute) Preview(action *state.Action) ([]execute.Recipient, error) {
+	args := e.Called(action)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]execute.Recipient), args.Error(1)
+}
+
+func (e *mockExecute) KindEnabled(kind string) error {
+	args := e.Called(kind)
+	return args.Error(0)
+}
+
 func TestReadingConfig(t *testing.T) {
 	tests := []struct {
 		inputConfig  func()
@@ -364,6 +530,40 @@ func TestComponentsErrors(t *testing.T) {
 	}
 }
 
+func TestSelfTestExecute(t *testing.T) {
+	tests := []struct {
+		inputMode       string
+		mockSelfTestErr error
+		expectedCalls   int
+		shouldPanic     bool
+	}{
+		{inputMode: ""},
+		{inputMode: "warn", expectedCalls: 1},
+		{inputMode: "warn", mockSelfTestErr: fmt.Errorf("mail: unable to connect"), expectedCalls: 1},
+		{inputMode: "fail", expectedCalls: 1},
+		{inputMode: "fail", mockSelfTestErr: fmt.Errorf("mail: unable to connect"), expectedCalls: 1, shouldPanic: true},
+	}
+	defer func() {
+		executeSelfTest = execute.SelfTest
+	}()
+	for _, test := range tests {
+		var calls int
+		executeSelfTest = func(ctx context.Context, opts *execute.Options, probe bool) error {
+			calls++
+			require.True(t, probe)
+			return test.mockSelfTestErr
+		}
+		if test.shouldPanic {
+			require.Panics(t, func() {
+				selfTestExecute(&execute.Options{}, test.inputMode, true)
+			})
+		} else {
+			selfTestExecute(&execute.Options{}, test.inputMode, true)
+		}
+		require.Equal(t, test.expectedCalls, calls)
+	}
+}
+
 func TestDispatcher(t *testing.T) {
 	tests := []struct {
 		inputState           func() state.StateInterface
@@ -415,7 +615,9 @@ func TestDispatcher(t *testing.T) {
 					{Processed: 0, UUID: "test-uuid", Action: state.Action{ProcessAfter: 10}},
 				})
 				s.On("GetLastSeen").Return(mockTime)
+				s.On("GetMaintenance").Return(nil)
 				s.On("GetActionLastRun", "test-uuid").Return(time.Time{}, fmt.Errorf("mockGetActionLastRun"))
+				s.On("ReportActionError", "test-uuid", "GetActionLastRun", mock.Anything).Return()
 				return s
 			},
 			inputExecute: func() execute.ExecuteInterface {
@@ -423,14 +625,124 @@ func TestDispatcher(t *testing.T) {
 				return e
 			},
 			expectedStateCalls: map[string]int{
-				"GetActions":       1,
-				"GetLastSeen":      1,
-				"GetActionLastRun": 1,
+				"GetActions":        1,
+				"GetLastSeen":       1,
+				"GetActionLastRun":  1,
+				"ReportActionError": 1,
 			},
 			expectedMetrics: []string{
 				`dmh_action_errors_total{action="test-uuid",error="GetActionLastRun"} 1`,
 			},
 		},
+		{
+			inputState: func() state.StateInterface {
+				s := new(mockState)
+				s.On("GetActions").Return([]*state.EncryptedAction{
+					{Processed: 0, UUID: "test-uuid", Action: state.Action{ProcessAfter: 10, ProcessUnit: "minute"}},
+				})
+				s.On("GetLastSeen").Return(time.Now().Add(-30 * time.Second))
+				s.On("GetMaintenance").Return(nil)
+				return s
+			},
+			inputExecute: func() execute.ExecuteInterface {
+				e := new(mockExecute)
+				return e
+			},
+			expectedStateCalls: map[string]int{
+				"GetActions":       1,
+				"GetLastSeen":      1,
+				"GetActionLastRun": 0,
+			},
+		},
+		{
+			inputState: func() state.StateInterface {
+				deadline := time.Now().Add(-time.Second)
+				s := new(mockState)
+				s.On("GetActions").Return([]*state.EncryptedAction{
+					{Processed: 0, UUID: "test-uuid", Action: state.Action{ProcessAfter: 10, Deadline: &deadline}},
+				})
+				s.On("GetLastSeen").Return(time.Now())
+				s.On("GetMaintenance").Return(nil)
+				s.On("GetActionLastRun", "test-uuid").Return(time.Time{}, fmt.Errorf("mockGetActionLastRun"))
+				s.On("ReportActionError", "test-uuid", "GetActionLastRun", mock.Anything).Return()
+				return s
+			},
+			inputExecute: func() execute.ExecuteInterface {
+				e := new(mockExecute)
+				return e
+			},
+			expectedStateCalls: map[string]int{
+				"GetActions":        1,
+				"GetLastSeen":       1,
+				"GetActionLastRun":  1,
+				"ReportActionError": 1,
+			},
+		},
+		{
+			inputState: func() state.StateInterface {
+				deadline := time.Now().Add(time.Hour)
+				s := new(mockState)
+				s.On("GetActions").Return([]*state.EncryptedAction{
+					{Processed: 0, UUID: "test-uuid", Action: state.Action{ProcessAfter: 10, Deadline: &deadline}},
+				})
+				s.On("GetLastSeen").Return(time.Now())
+				s.On("GetMaintenance").Return(nil)
+				return s
+			},
+			inputExecute: func() execute.ExecuteInterface {
+				e := new(mockExecute)
+				return e
+			},
+			expectedStateCalls: map[string]int{
+				"GetActions":       1,
+				"GetLastSeen":      1,
+				"GetActionLastRun": 0,
+			},
+		},
+		{
+			inputState: func() state.StateInterface {
+				notBefore := time.Now().Add(time.Hour)
+				s := new(mockState)
+				s.On("GetActions").Return([]*state.EncryptedAction{
+					{Processed: 0, UUID: "test-uuid", Action: state.Action{ProcessAfter: 1, ProcessUnit: "second", NotBefore: &notBefore}},
+				})
+				s.On("GetLastSeen").Return(time.Now().Add(-time.Hour))
+				s.On("GetMaintenance").Return(nil)
+				return s
+			},
+			inputExecute: func() execute.ExecuteInterface {
+				e := new(mockExecute)
+				return e
+			},
+			expectedStateCalls: map[string]int{
+				"GetActions":       1,
+				"GetLastSeen":      1,
+				"GetActionLastRun": 0,
+			},
+		},
+		{
+			inputState: func() state.StateInterface {
+				s := new(mockState)
+				s.On("GetActions").Return([]*state.EncryptedAction{
+					{Processed: 0, UUID: "test-uuid", Action: state.Action{ProcessAfter: 10, ProcessUnit: "second"}},
+				})
+				s.On("GetLastSeen").Return(time.Now().Add(-30 * time.Second))
+				s.On("GetMaintenance").Return(nil)
+				s.On("GetActionLastRun", "test-uuid").Return(time.Time{}, fmt.Errorf("mockGetActionLastRun"))
+				s.On("ReportActionError", "test-uuid", "GetActionLastRun", mock.Anything).Return()
+				return s
+			},
+			inputExecute: func() execute.ExecuteInterface {
+				e := new(mockExecute)
+				return e
+			},
+			expectedStateCalls: map[string]int{
+				"GetActions":        1,
+				"GetLastSeen":       1,
+				"GetActionLastRun":  1,
+				"ReportActionError": 1,
+			},
+		},
 		{
 			inputState: func() state.StateInterface {
 				mockTime, err := time.Parse("2006-01-02T15:04:05.999999-07:00", "2025-03-26T14:55:40.119447+01:00")
@@ -442,8 +754,10 @@ func TestDispatcher(t *testing.T) {
 					{Processed: 0, UUID: "test-uuid", Action: state.Action{ProcessAfter: 10}},
 				})
 				s.On("GetLastSeen").Return(mockTime)
+				s.On("GetMaintenance").Return(nil)
 				s.On("GetActionLastRun", "test-uuid").Return(mockTime, nil)
 				s.On("DecryptAction", "test-uuid").Return(nil, fmt.Errorf("mockDecryptAction error"))
+				s.On("ReportActionError", "test-uuid", "DecryptAction", mock.Anything).Return()
 				return s
 			},
 			inputExecute: func() execute.ExecuteInterface {
@@ -451,10 +765,11 @@ func TestDispatcher(t *testing.T) {
 				return e
 			},
 			expectedStateCalls: map[string]int{
-				"GetActions":       1,
-				"GetLastSeen":      1,
-				"GetActionLastRun": 1,
-				"DecryptAction":    1,
+				"GetActions":        1,
+				"GetLastSeen":       1,
+				"GetActionLastRun":  1,
+				"DecryptAction":     1,
+				"ReportActionError": 1,
 			},
 			expectedMetrics: []string{
 				`dmh_action_errors_total{action="test-uuid",error="DecryptAction"} 1`,
@@ -471,20 +786,25 @@ func TestDispatcher(t *testing.T) {
 					{Processed: 0, UUID: "test-uuid", Action: state.Action{ProcessAfter: 10, Kind: "dummy", Data: `{"message": "test"}`}},
 				})
 				s.On("GetLastSeen").Return(mockTime)
+				s.On("GetMaintenance").Return(nil)
 				s.On("GetActionLastRun", "test-uuid").Return(mockTime, nil)
 				s.On("DecryptAction", "test-uuid").Return(&state.Action{ProcessAfter: 10, Kind: "dummy", Data: `{"message": "test"}`}, nil)
+				s.On("ReportActionError", "test-uuid", "Run", mock.Anything).Return()
+				s.On("RecordActionFailure", "test-uuid").Return(nil)
 				return s
 			},
 			inputExecute: func() execute.ExecuteInterface {
 				e := new(mockExecute)
-				e.On("Run", &state.Action{ProcessAfter: 10, Kind: "dummy", Data: `{"message": "test"}`}).Return(fmt.Errorf("mockRun error"))
+				e.On("Run", mock.Anything, &state.Action{ProcessAfter: 10, Kind: "dummy", Data: `{"message": "test"}`}).Return(fmt.Errorf("mockRun error"))
 				return e
 			},
 			expectedStateCalls: map[string]int{
-				"GetActions":       1,
-				"GetLastSeen":      1,
-				"GetActionLastRun": 1,
-				"DecryptAction":    1,
+				"GetActions":          1,
+				"GetLastSeen":         1,
+				"GetActionLastRun":    1,
+				"DecryptAction":       1,
+				"ReportActionError":   1,
+				"RecordActionFailure": 1,
 			},
 			expectedExecuteCalls: map[string]int{
 				"Run": 1,
@@ -504,14 +824,16 @@ func TestDispatcher(t *testing.T) {
 					{Processed: 0, UUID: "test-uuid", Action: state.Action{ProcessAfter: 10, Kind: "dummy", Data: `{"message": "test"}`}},
 				})
 				s.On("GetLastSeen").Return(mockTime)
+				s.On("GetMaintenance").Return(nil)
 				s.On("GetActionLastRun", "test-uuid").Return(mockTime, nil)
 				s.On("DecryptAction", "test-uuid").Return(&state.Action{ProcessAfter: 10, Kind: "dummy", Data: `{"message": "test"}`}, nil)
 				s.On("UpdateActionLastRun", "test-uuid").Return(fmt.Errorf("mockUpdateActionLastRun error"))
+				s.On("ReportActionError", "test-uuid", "UpdateActionLastRun", mock.Anything).Return()
 				return s
 			},
 			inputExecute: func() execute.ExecuteInterface {
 				e := new(mockExecute)
-				e.On("Run", &state.Action{ProcessAfter: 10, Kind: "dummy", Data: `{"message": "test"}`}).Return(nil)
+				e.On("Run", mock.Anything, &state.Action{ProcessAfter: 10, Kind: "dummy", Data: `{"message": "test"}`}).Return(nil)
 				return e
 			},
 			expectedActions: func() []*state.EncryptedAction {
@@ -527,6 +849,7 @@ func TestDispatcher(t *testing.T) {
 				"GetActionLastRun":    1,
 				"DecryptAction":       1,
 				"UpdateActionLastRun": 1,
+				"ReportActionError":   1,
 			},
 			expectedExecuteCalls: map[string]int{
 				"Run": 1,
@@ -551,15 +874,17 @@ func TestDispatcher(t *testing.T) {
 					{Processed: 0, UUID: "test-uuid", LastRun: mockTime, Action: state.Action{ProcessAfter: 10, Kind: "dummy", Data: `{"message": "test"}`}},
 				}).Once()
 				s.On("GetLastSeen").Return(mockTime)
+				s.On("GetMaintenance").Return(nil)
 				s.On("GetActionLastRun", "test-uuid").Return(mockTime, nil)
 				s.On("DecryptAction", "test-uuid").Return(&state.Action{ProcessAfter: 10, Kind: "dummy", Data: `{"message": "test"}`}, nil)
 				s.On("UpdateActionLastRun", "test-uuid").Return(nil)
 				s.On("MarkActionAsProcessed", "test-uuid").Return(fmt.Errorf("mockMarkActionAsProcessed error"))
+				s.On("ReportActionError", "test-uuid", "MarkActionAsProcessed", mock.Anything).Return()
 				return s
 			},
 			inputExecute: func() execute.ExecuteInterface {
 				e := new(mockExecute)
-				e.On("Run", &state.Action{ProcessAfter: 10, Kind: "dummy", Data: `{"message": "test"}`}).Return(nil)
+				e.On("Run", mock.Anything, &state.Action{ProcessAfter: 10, Kind: "dummy", Data: `{"message": "test"}`}).Return(nil)
 				return e
 			},
 			expectedActions: func() []*state.EncryptedAction {
@@ -578,6 +903,7 @@ func TestDispatcher(t *testing.T) {
 				"DecryptAction":         1,
 				"UpdateActionLastRun":   1,
 				"MarkActionAsProcessed": 1,
+				"ReportActionError":     1,
 			},
 			expectedExecuteCalls: map[string]int{
 				"Run": 1,
@@ -602,6 +928,7 @@ func TestDispatcher(t *testing.T) {
 					{Processed: 2, UUID: "test-uuid", LastRun: mockTime, Action: state.Action{ProcessAfter: 10, Kind: "dummy", Data: `{"message": "test"}`}},
 				}).Once()
 				s.On("GetLastSeen").Return(mockTime)
+				s.On("GetMaintenance").Return(nil)
 				s.On("GetActionLastRun", "test-uuid").Return(mockTime, nil)
 				s.On("DecryptAction", "test-uuid").Return(&state.Action{ProcessAfter: 10, Kind: "dummy", Data: `{"message": "test"}`}, nil)
 				s.On("UpdateActionLastRun", "test-uuid").Return(nil)
@@ -610,7 +937,7 @@ func TestDispatcher(t *testing.T) {
 			},
 			inputExecute: func() execute.ExecuteInterface {
 				e := new(mockExecute)
-				e.On("Run", &state.Action{ProcessAfter: 10, Kind: "dummy", Data: `{"message": "test"}`}).Return(nil)
+				e.On("Run", mock.Anything, &state.Action{ProcessAfter: 10, Kind: "dummy", Data: `{"message": "test"}`}).Return(nil)
 				return e
 			},
 			expectedActions: func() []*state.EncryptedAction {
@@ -650,6 +977,7 @@ func TestDispatcher(t *testing.T) {
 					{Processed: 0, UUID: "test-uuid", LastRun: mockTime, Action: state.Action{ProcessAfter: 10, MinInterval: 10, Kind: "dummy", Data: `{"message": "test"}`}},
 				}).Once()
 				s.On("GetLastSeen").Return(mockTime)
+				s.On("GetMaintenance").Return(nil)
 				s.On("GetActionLastRun", "test-uuid").Return(mockTime, nil)
 				s.On("DecryptAction", "test-uuid").Return(&state.Action{ProcessAfter: 10, MinInterval: 10, Kind: "dummy", Data: `{"message": "test"}`}, nil)
 				s.On("UpdateActionLastRun", "test-uuid").Return(nil)
@@ -657,7 +985,7 @@ func TestDispatcher(t *testing.T) {
 			},
 			inputExecute: func() execute.ExecuteInterface {
 				e := new(mockExecute)
-				e.On("Run", &state.Action{ProcessAfter: 10, MinInterval: 10, Kind: "dummy", Data: `{"message": "test"}`}).Return(nil)
+				e.On("Run", mock.Anything, &state.Action{ProcessAfter: 10, MinInterval: 10, Kind: "dummy", Data: `{"message": "test"}`}).Return(nil)
 				return e
 			},
 			expectedActions: func() []*state.EncryptedAction {
@@ -693,7 +1021,7 @@ func TestDispatcher(t *testing.T) {
 		mOpts := &metric.Options{State: s, Registry: prometheus.NewRegistry()}
 		m := metric.Initialize(mOpts)
 		chStop := make(chan bool)
-		go dispatcher(s, e, m, time.Second, chStop)
+		go dispatcher(s, e, m, time.Second, time.Minute, confirmPolicy{}, failureBackoff{}, nil, 0, clock.New(), chStop)
 		time.Sleep(time.Duration(3) * getActionsIntervalUnit)
 		chStop <- true
 		m.Stop()
@@ -725,3 +1053,956 @@ func TestDispatcher(t *testing.T) {
 		}
 	}
 }
+
+func TestDispatcherPriority(t *testing.T) {
+	mockTime, err := time.Parse("2006-01-02T15:04:05.999999-07:00", "2025-03-26T14:55:40.119447+01:00")
+	require.Nil(t, err)
+
+	getActionsInterval = 2
+	getActionsIntervalUnit = time.Second
+	defer func() {
+		getActionsInterval = 5
+		getActionsIntervalUnit = time.Minute
+	}()
+
+	s := new(mockState)
+	s.On("GetActions").Return([]*state.EncryptedAction{
+		{UUID: "first", Action: state.Action{ProcessAfter: 10, MinInterval: 10, Kind: "dummy"}},
+		{UUID: "low", Action: state.Action{ProcessAfter: 10, MinInterval: 10, Kind: "dummy", Priority: -10}},
+		{UUID: "high", Action: state.Action{ProcessAfter: 10, MinInterval: 10, Kind: "dummy", Priority: 10}},
+		{UUID: "second", Action: state.Action{ProcessAfter: 10, MinInterval: 10, Kind: "dummy"}},
+	})
+	s.On("GetLastSeen").Return(mockTime)
+	s.On("GetMaintenance").Return(nil)
+	e := new(mockExecute)
+	for _, u := range []string{"first", "low", "high", "second"} {
+		s.On("GetActionLastRun", u).Return(time.Time{}, nil)
+		s.On("DecryptAction", u).Return(&state.Action{Kind: "dummy", Data: u}, nil)
+		s.On("UpdateActionLastRun", u).Return(nil)
+		e.On("Run", mock.Anything, &state.Action{Kind: "dummy", Data: u}).Return(nil)
+	}
+
+	m := metric.Initialize(&metric.Options{State: s, Registry: prometheus.NewRegistry()})
+	chStop := make(chan bool)
+	go dispatcher(s, e, m, time.Second, time.Minute, confirmPolicy{}, failureBackoff{}, nil, 0, clock.New(), chStop)
+	time.Sleep(time.Duration(3) * getActionsIntervalUnit)
+	chStop <- true
+	m.Stop()
+
+	var order []string
+	for _, call := range e.Calls {
+		order = append(order, call.Arguments.Get(1).(*state.Action).Data)
+	}
+	require.Equal(t, []string{"high", "first", "second", "low"}, order)
+}
+
+func TestDispatcherRunTimeout(t *testing.T) {
+	mockTime, err := time.Parse("2006-01-02T15:04:05.999999-07:00", "2025-03-26T14:55:40.119447+01:00")
+	require.Nil(t, err)
+
+	getActionsInterval = 2
+	getActionsIntervalUnit = time.Second
+	defer func() {
+		getActionsInterval = 5
+		getActionsIntervalUnit = time.Minute
+	}()
+
+	s := new(mockState)
+	s.On("GetActions").Return([]*state.EncryptedAction{
+		{UUID: "test-uuid", Action: state.Action{ProcessAfter: 10, Kind: "dummy"}},
+	})
+	s.On("GetLastSeen").Return(mockTime)
+	s.On("GetMaintenance").Return(nil)
+	s.On("GetActionLastRun", "test-uuid").Return(time.Time{}, nil)
+	s.On("DecryptAction", "test-uuid").Return(&state.Action{Kind: "dummy"}, nil)
+	s.On("ReportActionError", "test-uuid", "Run", context.DeadlineExceeded).Return()
+	s.On("RecordActionFailure", "test-uuid").Return(nil)
+	e := new(mockExecute)
+	e.On("Run", mock.Anything, &state.Action{Kind: "dummy"}).Run(func(args mock.Arguments) {
+		// hung plugin, it returns only when context is done
+		<-args.Get(0).(context.Context).Done()
+	}).Return(context.DeadlineExceeded)
+
+	m := metric.Initialize(&metric.Options{State: s, Registry: prometheus.NewRegistry()})
+	chStop := make(chan bool)
+	go dispatcher(s, e, m, time.Second, 100*time.Millisecond, confirmPolicy{}, failureBackoff{}, nil, 0, clock.New(), chStop)
+	time.Sleep(time.Duration(3) * getActionsIntervalUnit)
+	chStop <- true
+	m.Stop()
+
+	e.AssertNumberOfCalls(t, "Run", 1)
+	s.AssertNumberOfCalls(t, "ReportActionError", 1)
+	s.AssertNotCalled(t, "UpdateActionLastRun", mock.Anything)
+}
+
+func TestDispatcherConfirm(t *testing.T) {
+	mockTime, err := time.Parse("2006-01-02T15:04:05.999999-07:00", "2025-03-26T14:55:40.119447+01:00")
+	require.Nil(t, err)
+	pendingRecently := time.Now().Add(-time.Minute)
+	pendingLongAgo := time.Now().Add(-time.Hour)
+	cancelledAt := time.Now()
+
+	getActionsInterval = 2
+	getActionsIntervalUnit = time.Second
+	defer func() {
+		getActionsInterval = 5
+		getActionsIntervalUnit = time.Minute
+	}()
+
+	s := new(mockState)
+	s.On("GetActions").Return([]*state.EncryptedAction{
+		{UUID: "new", Action: state.Action{ProcessAfter: 10, MinInterval: 10, Kind: "mail"}},
+		{UUID: "waiting", Action: state.Action{ProcessAfter: 10, MinInterval: 10, Kind: "mail"}, PendingSince: &pendingRecently},
+		{UUID: "confirmed", Action: state.Action{ProcessAfter: 10, MinInterval: 10, Kind: "mail"}, PendingSince: &pendingLongAgo},
+		{UUID: "other", Action: state.Action{ProcessAfter: 10, MinInterval: 10, Kind: "dummy"}},
+		{UUID: "cancelled", Action: state.Action{ProcessAfter: 10, MinInterval: 10, Kind: "mail"}, FireCancelledAt: &cancelledAt},
+		{UUID: "destructive", Action: state.Action{ProcessAfter: 10, MinInterval: 10, Kind: "dummy", Severity: state.SeverityDestructive}},
+	})
+	s.On("GetLastSeen").Return(mockTime)
+	s.On("GetMaintenance").Return(nil)
+	s.On("MarkActionPending", "new").Return(nil)
+	s.On("MarkActionPending", "destructive").Return(nil)
+	e := new(mockExecute)
+	for _, u := range []string{"new", "waiting", "confirmed", "other", "destructive"} {
+		s.On("GetActionLastRun", u).Return(time.Time{}, nil)
+	}
+	for _, u := range []string{"confirmed", "other"} {
+		s.On("DecryptAction", u).Return(&state.Action{Kind: "dummy", Data: u}, nil)
+		s.On("UpdateActionLastRun", u).Return(nil)
+		e.On("Run", mock.Anything, &state.Action{Kind: "dummy", Data: u}).Return(nil)
+	}
+
+	m := metric.Initialize(&metric.Options{State: s, Registry: prometheus.NewRegistry()})
+	chStop := make(chan bool)
+	go dispatcher(s, e, m, time.Second, time.Minute, confirmPolicy{Kinds: []string{"mail"}, Destructive: true, Window: 10 * time.Minute}, failureBackoff{}, nil, 0, clock.New(), chStop)
+	time.Sleep(time.Duration(3) * getActionsIntervalUnit)
+	chStop <- true
+	m.Stop()
+
+	s.AssertCalled(t, "MarkActionPending", "new")
+	s.AssertNotCalled(t, "DecryptAction", "new")
+	s.AssertNotCalled(t, "DecryptAction", "waiting")
+	s.AssertNotCalled(t, "MarkActionPending", "cancelled")
+	s.AssertCalled(t, "MarkActionPending", "destructive")
+	s.AssertNotCalled(t, "DecryptAction", "destructive")
+	e.AssertNumberOfCalls(t, "Run", 2)
+}
+
+func TestDispatcherPaused(t *testing.T) {
+	mockTime, err := time.Parse("2006-01-02T15:04:05.999999-07:00", "2025-03-26T14:55:40.119447+01:00")
+	require.Nil(t, err)
+	pausedAt := time.Now()
+
+	getActionsInterval = 2
+	getActionsIntervalUnit = time.Second
+	defer func() {
+		getActionsInterval = 5
+		getActionsIntervalUnit = time.Minute
+	}()
+
+	s := new(mockState)
+	s.On("GetActions").Return([]*state.EncryptedAction{
+		{UUID: "paused", Action: state.Action{ProcessAfter: 10, MinInterval: 10, Kind: "dummy"}, PausedAt: &pausedAt},
+		{UUID: "armed", Action: state.Action{ProcessAfter: 10, MinInterval: 10, Kind: "dummy"}},
+	})
+	s.On("GetLastSeen").Return(mockTime)
+	s.On("GetMaintenance").Return(nil)
+	s.On("GetActionLastRun", "armed").Return(time.Time{}, nil)
+	s.On("DecryptAction", "armed").Return(&state.Action{Kind: "dummy", Data: "armed"}, nil)
+	s.On("UpdateActionLastRun", "armed").Return(nil)
+	e := new(mockExecute)
+	e.On("Run", mock.Anything, &state.Action{Kind: "dummy", Data: "armed"}).Return(nil)
+
+	m := metric.Initialize(&metric.Options{State: s, Registry: prometheus.NewRegistry()})
+	chStop := make(chan bool)
+	go dispatcher(s, e, m, time.Second, time.Minute, confirmPolicy{}, failureBackoff{}, nil, 0, clock.New(), chStop)
+	time.Sleep(time.Duration(3) * getActionsIntervalUnit)
+	chStop <- true
+	m.Stop()
+
+	s.AssertNotCalled(t, "GetActionLastRun", "paused")
+	s.AssertNotCalled(t, "DecryptAction", "paused")
+	e.AssertNumberOfCalls(t, "Run", 1)
+}
+
+func TestDispatcherBackoff(t *testing.T) {
+	mockTime, err := time.Parse("2006-01-02T15:04:05.999999-07:00", "2025-03-26T14:55:40.119447+01:00")
+	require.Nil(t, err)
+	failedRecently := time.Now().Add(-time.Minute)
+	failedLongAgo := time.Now().Add(-time.Hour)
+
+	getActionsInterval = 2
+	getActionsIntervalUnit = time.Second
+	defer func() {
+		getActionsInterval = 5
+		getActionsIntervalUnit = time.Minute
+	}()
+
+	s := new(mockState)
+	s.On("GetActions").Return([]*state.EncryptedAction{
+		{UUID: "backoff", Action: state.Action{ProcessAfter: 10, MinInterval: 10, Kind: "dummy"}, ConsecutiveFailures: 3, LastFailure: &failedRecently},
+		{UUID: "retry", Action: state.Action{ProcessAfter: 10, MinInterval: 10, Kind: "dummy"}, ConsecutiveFailures: 3, LastFailure: &failedLongAgo},
+	})
+	s.On("GetLastSeen").Return(mockTime)
+	s.On("GetMaintenance").Return(nil)
+	e := new(mockExecute)
+	for _, u := range []string{"backoff", "retry"} {
+		s.On("GetActionLastRun", u).Return(time.Time{}, nil)
+	}
+	s.On("DecryptAction", "retry").Return(&state.Action{Kind: "dummy", Data: "retry"}, nil)
+	// failing run leaves gauge cleared, backoff window of retry has passed.
+	e.On("Run", mock.Anything, &state.Action{Kind: "dummy", Data: "retry"}).Return(fmt.Errorf("run failed"))
+	s.On("ReportActionError", "retry", "Run", mock.Anything).Return()
+	s.On("RecordActionFailure", "retry").Return(nil)
+
+	registry := prometheus.NewRegistry()
+	m := metric.Initialize(&metric.Options{State: s, Registry: registry})
+	m.SetActionBackoff("retry", true)
+	chStop := make(chan bool)
+	go dispatcher(s, e, m, time.Second, time.Minute, confirmPolicy{}, failureBackoff{After: 2, Initial: 5 * time.Minute, Max: 30 * time.Minute}, nil, 0, clock.New(), chStop)
+	time.Sleep(time.Duration(3) * getActionsIntervalUnit)
+	chStop <- true
+	m.Stop()
+
+	s.AssertNotCalled(t, "DecryptAction", "backoff")
+	e.AssertNumberOfCalls(t, "Run", 1)
+
+	families, err := registry.Gather()
+	require.Nil(t, err)
+	var inBackoff []string
+	for _, family := range families {
+		if family.GetName() != "dmh_action_backoff" {
+			continue
+		}
+		for _, sample := range family.GetMetric() {
+			inBackoff = append(inBackoff, sample.GetLabel()[0].GetValue())
+		}
+	}
+	require.Equal(t, []string{"backoff"}, inBackoff)
+}
+
+func TestDispatcherFallback(t *testing.T) {
+	mockTime, err := time.Parse("2006-01-02T15:04:05.999999-07:00", "2025-03-26T14:55:40.119447+01:00")
+	require.Nil(t, err)
+
+	getActionsInterval = 2
+	getActionsIntervalUnit = time.Second
+	defer func() {
+		getActionsInterval = 5
+		getActionsIntervalUnit = time.Minute
+	}()
+
+	recovered := &state.Action{Kind: "mail", Data: "recovered", Fallback: &state.Fallback{Kind: "json_post", Data: "recovered-fallback"}}
+	failed := &state.Action{Kind: "mail", Data: "failed", Fallback: &state.Fallback{Kind: "json_post", Data: "failed-fallback"}}
+	s := new(mockState)
+	s.On("GetActions").Return([]*state.EncryptedAction{
+		{UUID: "recovered", Action: state.Action{ProcessAfter: 10, Kind: "mail"}},
+		{UUID: "failed", Action: state.Action{ProcessAfter: 10, Kind: "mail"}},
+	})
+	s.On("GetLastSeen").Return(mockTime)
+	s.On("GetMaintenance").Return(nil)
+	for _, u := range []string{"recovered", "failed"} {
+		s.On("GetActionLastRun", u).Return(time.Time{}, nil)
+		s.On("ReportActionError", u, "Run", mock.Anything).Return()
+	}
+	s.On("DecryptAction", "recovered").Return(recovered, nil)
+	s.On("DecryptAction", "failed").Return(failed, nil)
+	s.On("UpdateActionLastRun", "recovered").Return(nil)
+	s.On("MarkActionAsProcessed", "recovered").Return(nil)
+	s.On("ReportActionError", "failed", "RunFallback", mock.Anything).Return()
+	s.On("RecordActionFailure", "failed").Return(nil)
+	e := new(mockExecute)
+	e.On("Run", mock.Anything, recovered).Return(fmt.Errorf("smtp down"))
+	e.On("Run", mock.Anything, recovered.FallbackAction()).Return(nil)
+	e.On("Run", mock.Anything, failed).Return(fmt.Errorf("smtp down"))
+	e.On("Run", mock.Anything, failed.FallbackAction()).Return(fmt.Errorf("webhook down"))
+
+	m := metric.Initialize(&metric.Options{State: s, Registry: prometheus.NewRegistry()})
+	chStop := make(chan bool)
+	go dispatcher(s, e, m, time.Second, time.Minute, confirmPolicy{}, failureBackoff{}, nil, 0, clock.New(), chStop)
+	time.Sleep(time.Duration(3) * getActionsIntervalUnit)
+	chStop <- true
+	m.Stop()
+
+	e.AssertNumberOfCalls(t, "Run", 4)
+	s.AssertCalled(t, "MarkActionAsProcessed", "recovered")
+	s.AssertCalled(t, "ReportActionError", "failed", "RunFallback", mock.Anything)
+	s.AssertCalled(t, "RecordActionFailure", "failed")
+	s.AssertNotCalled(t, "UpdateActionLastRun", "failed")
+	s.AssertNotCalled(t, "RecordActionFailure", "recovered")
+}
+
+func TestDispatcherTemporaryFailure(t *testing.T) {
+	start := time.Date(2025, 3, 26, 14, 0, 0, 0, time.UTC)
+	clk := clock.NewFake(start)
+
+	greylisted := &state.Action{Kind: "mail", Data: "greylisted", Fallback: &state.Fallback{Kind: "json_post", Data: "fallback"}}
+	s := new(mockState)
+	s.On("GetActions").Return([]*state.EncryptedAction{
+		{UUID: "greylisted", Action: state.Action{ProcessAfter: 1, Kind: "mail"}},
+	})
+	s.On("GetLastSeen").Return(start)
+	s.On("GetMaintenance").Return(nil)
+	s.On("GetActionLastRun", "greylisted").Return(time.Time{}, nil)
+	s.On("DecryptAction", "greylisted").Return(greylisted, nil)
+	s.On("ReportActionError", "greylisted", "RunTemporary", mock.Anything).Return()
+	s.On("RecordActionFailure", "greylisted").Return(nil)
+	e := new(mockExecute)
+	e.On("Run", mock.Anything, greylisted).Return(fmt.Errorf("%w: 451 greylisted", execute.ErrTemporary))
+
+	m := metric.Initialize(&metric.Options{State: s, Registry: prometheus.NewRegistry()})
+	chStop := make(chan bool)
+	go dispatcher(s, e, m, time.Hour, time.Minute, confirmPolicy{}, failureBackoff{}, nil, 0, clk, chStop)
+
+	clk.WaitForTickers(1)
+	clk.Advance(65 * time.Minute)
+	chStop <- true
+	m.Stop()
+
+	// fallback is not run, primary plugin is retried later
+	e.AssertNumberOfCalls(t, "Run", 1)
+	e.AssertNotCalled(t, "Run", mock.Anything, greylisted.FallbackAction())
+	s.AssertCalled(t, "ReportActionError", "greylisted", "RunTemporary", mock.Anything)
+	s.AssertCalled(t, "RecordActionFailure", "greylisted")
+	s.AssertNotCalled(t, "MarkActionAsProcessed", "greylisted")
+}
+
+func TestDispatcherDedupe(t *testing.T) {
+	mockTime, err := time.Parse("2006-01-02T15:04:05.999999-07:00", "2025-03-26T14:55:40.119447+01:00")
+	require.Nil(t, err)
+	delivered := time.Now().Add(-time.Hour)
+
+	getActionsInterval = 2
+	getActionsIntervalUnit = time.Second
+	defer func() {
+		getActionsInterval = 5
+		getActionsIntervalUnit = time.Minute
+	}()
+
+	duplicate := &state.EncryptedAction{UUID: "duplicate", Action: state.Action{ProcessAfter: 10, MinInterval: 10, DedupeWindow: 7200, Kind: "dummy"}, LastDeliveredAt: &delivered}
+	duplicate.LastDataHash = duplicate.DataHash("same")
+	changed := &state.EncryptedAction{UUID: "changed", Action: state.Action{ProcessAfter: 10, MinInterval: 10, DedupeWindow: 7200, Kind: "dummy"}, LastDeliveredAt: &delivered}
+	changed.LastDataHash = changed.DataHash("old")
+	s := new(mockState)
+	s.On("GetActions").Return([]*state.EncryptedAction{duplicate, changed})
+	s.On("GetLastSeen").Return(mockTime)
+	s.On("GetMaintenance").Return(nil)
+	for _, u := range []string{"duplicate", "changed"} {
+		s.On("GetActionLastRun", u).Return(time.Time{}, nil)
+	}
+	s.On("DecryptAction", "duplicate").Return(&state.Action{Kind: "dummy", Data: "same"}, nil)
+	s.On("DecryptAction", "changed").Return(&state.Action{Kind: "dummy", Data: "new"}, nil)
+	s.On("SuppressActionRun", "duplicate").Return(nil)
+	s.On("RecordActionDelivery", "changed", changed.DataHash("new")).Return(nil)
+	s.On("UpdateActionLastRun", "changed").Return(nil)
+	e := new(mockExecute)
+	e.On("Run", mock.Anything, &state.Action{Kind: "dummy", Data: "new"}).Return(nil)
+
+	m := metric.Initialize(&metric.Options{State: s, Registry: prometheus.NewRegistry()})
+	chStop := make(chan bool)
+	go dispatcher(s, e, m, time.Second, time.Minute, confirmPolicy{}, failureBackoff{}, nil, 0, clock.New(), chStop)
+	time.Sleep(time.Duration(3) * getActionsIntervalUnit)
+	chStop <- true
+	m.Stop()
+
+	s.AssertCalled(t, "SuppressActionRun", "duplicate")
+	s.AssertCalled(t, "RecordActionDelivery", "changed", changed.DataHash("new"))
+	s.AssertNotCalled(t, "UpdateActionLastRun", "duplicate")
+	e.AssertNotCalled(t, "Run", mock.Anything, &state.Action{Kind: "dummy", Data: "same"})
+}
+
+func TestDispatcherFakeClock(t *testing.T) {
+	start := time.Date(2025, 3, 26, 14, 0, 0, 0, time.UTC)
+	deadline := start.Add(90 * time.Minute)
+	notBefore := start.Add(2 * time.Hour)
+	clk := clock.NewFake(start)
+
+	s := new(mockState)
+	s.On("GetActions").Return([]*state.EncryptedAction{
+		{UUID: "deadline", Action: state.Action{ProcessAfter: 100, Kind: "dummy", Deadline: &deadline}},
+		{UUID: "not-before", Action: state.Action{ProcessAfter: 1, Kind: "dummy", NotBefore: &notBefore}},
+	})
+	s.On("GetLastSeen").Return(start)
+	s.On("GetMaintenance").Return(nil)
+	s.On("GetActionLastRun", "deadline").Return(time.Time{}, nil)
+	s.On("DecryptAction", "deadline").Return(&state.Action{Kind: "dummy", Data: "deadline"}, nil)
+	s.On("UpdateActionLastRun", "deadline").Return(nil)
+	s.On("MarkActionAsProcessed", "deadline").Return(nil)
+	e := new(mockExecute)
+	e.On("Run", mock.Anything, &state.Action{Kind: "dummy", Data: "deadline"}).Return(nil)
+
+	m := metric.Initialize(&metric.Options{State: s, Registry: prometheus.NewRegistry()})
+	chStop := make(chan bool)
+	go dispatcher(s, e, m, time.Hour, time.Minute, confirmPolicy{}, failureBackoff{}, nil, 0, clk, chStop)
+
+	clk.WaitForTickers(1)
+	// Ticks every 5 minutes, deadline passes between 90th and 95th minute tick.
+	clk.Advance(90 * time.Minute)
+	e.AssertNotCalled(t, "Run", mock.Anything, mock.Anything)
+	clk.Advance(5 * time.Minute)
+	chStop <- true
+	m.Stop()
+
+	e.AssertNumberOfCalls(t, "Run", 1)
+	s.AssertNumberOfCalls(t, "DecryptAction", 1)
+	s.AssertNotCalled(t, "GetActionLastRun", "not-before")
+}
+
+func TestDispatcherJitter(t *testing.T) {
+	start := time.Date(2025, 3, 26, 14, 0, 0, 0, time.UTC)
+	clk := clock.NewFake(start)
+
+	s := new(mockState)
+	s.On("GetActions").Return([]*state.EncryptedAction{
+		{UUID: "due", Action: state.Action{ProcessAfter: 1, Kind: "dummy"}},
+	})
+	s.On("GetLastSeen").Return(start)
+	s.On("GetMaintenance").Return(nil)
+	s.On("GetActionLastRun", "due").Return(time.Time{}, nil)
+	s.On("DecryptAction", "due").Return(&state.Action{Kind: "dummy", Data: "due"}, nil)
+	s.On("UpdateActionLastRun", "due").Return(nil)
+	s.On("MarkActionAsProcessed", "due").Return(nil)
+	ran := make(chan bool, 1)
+	e := new(mockExecute)
+	e.On("Run", mock.Anything, &state.Action{Kind: "dummy", Data: "due"}).Return(nil).Run(func(mock.Arguments) { ran <- true })
+
+	m := metric.Initialize(&metric.Options{State: s, Registry: prometheus.NewRegistry()})
+	chStop := make(chan bool)
+	go dispatcher(s, e, m, time.Hour, time.Minute, confirmPolicy{}, failureBackoff{}, nil, 50*time.Millisecond, clk, chStop)
+
+	clk.WaitForTickers(1)
+	clk.Advance(65 * time.Minute)
+	// run is delayed by jitter after tick was received
+	select {
+	case <-ran:
+	case <-time.After(time.Second):
+		t.Fatal("action did not run")
+	}
+	chStop <- true
+	m.Stop()
+
+	e.AssertNumberOfCalls(t, "Run", 1)
+}
+
+func TestDispatcherPendingVerification(t *testing.T) {
+	mockTime, err := time.Parse("2006-01-02T15:04:05.999999-07:00", "2025-03-26T14:55:40.119447+01:00")
+	require.Nil(t, err)
+
+	getActionsInterval = 2
+	getActionsIntervalUnit = time.Second
+	defer func() {
+		getActionsInterval = 5
+		getActionsIntervalUnit = time.Minute
+	}()
+
+	s := new(mockState)
+	s.On("GetActions").Return([]*state.EncryptedAction{
+		{UUID: "unverified", Action: state.Action{ProcessAfter: 10, Kind: "dummy"}, VerifyTokenHash: "hash"},
+	})
+	s.On("GetLastSeen").Return(mockTime)
+	s.On("GetMaintenance").Return(nil)
+	e := new(mockExecute)
+
+	m := metric.Initialize(&metric.Options{State: s, Registry: prometheus.NewRegistry()})
+	chStop := make(chan bool)
+	go dispatcher(s, e, m, time.Second, time.Minute, confirmPolicy{}, failureBackoff{}, nil, 0, clock.New(), chStop)
+	time.Sleep(time.Duration(3) * getActionsIntervalUnit)
+	chStop <- true
+	m.Stop()
+
+	s.AssertNotCalled(t, "GetActionLastRun", "unverified")
+	s.AssertNotCalled(t, "DecryptAction", "unverified")
+	e.AssertNotCalled(t, "Run", mock.Anything, mock.Anything)
+}
+
+func TestDispatcherDependencies(t *testing.T) {
+	mockTime, err := time.Parse("2006-01-02T15:04:05.999999-07:00", "2025-03-26T14:55:40.119447+01:00")
+	require.Nil(t, err)
+
+	getActionsInterval = 2
+	getActionsIntervalUnit = time.Second
+	defer func() {
+		getActionsInterval = 5
+		getActionsIntervalUnit = time.Minute
+	}()
+
+	s := new(mockState)
+	s.On("GetActions").Return([]*state.EncryptedAction{
+		{UUID: "done", Action: state.Action{ProcessAfter: 10, Kind: "dummy"}, Processed: 2, LastRun: time.Now().Add(-time.Hour)},
+		{UUID: "recent", Action: state.Action{ProcessAfter: 10, Kind: "dummy"}, Processed: 2, LastRun: time.Now()},
+		{UUID: "unverified", Action: state.Action{ProcessAfter: 10, Kind: "dummy"}, VerifyTokenHash: "hash"},
+		{UUID: "ready", Action: state.Action{ProcessAfter: 10, Kind: "dummy", DependsOn: []string{"done"}, DependsDelay: 60}},
+		{UUID: "delayed", Action: state.Action{ProcessAfter: 10, Kind: "dummy", DependsOn: []string{"done", "recent"}, DependsDelay: 60}},
+		{UUID: "blocked", Action: state.Action{ProcessAfter: 10, Kind: "dummy", DependsOn: []string{"done", "unverified"}}},
+		{UUID: "orphan", Action: state.Action{ProcessAfter: 10, Kind: "dummy", DependsOn: []string{"deleted"}}},
+	})
+	s.On("GetLastSeen").Return(mockTime)
+	s.On("GetMaintenance").Return(nil)
+	s.On("GetActionLastRun", "ready").Return(time.Time{}, nil)
+	s.On("DecryptAction", "ready").Return(&state.Action{Kind: "dummy", Data: "ready"}, nil)
+	s.On("UpdateActionLastRun", "ready").Return(nil)
+	s.On("MarkActionAsProcessed", "ready").Return(nil)
+	e := new(mockExecute)
+	e.On("Run", mock.Anything, &state.Action{Kind: "dummy", Data: "ready"}).Return(nil)
+
+	m := metric.Initialize(&metric.Options{State: s, Registry: prometheus.NewRegistry()})
+	chStop := make(chan bool)
+	go dispatcher(s, e, m, time.Second, time.Minute, confirmPolicy{}, failureBackoff{}, nil, 0, clock.New(), chStop)
+	time.Sleep(time.Duration(3) * getActionsIntervalUnit)
+	chStop <- true
+	m.Stop()
+
+	for _, u := range []string{"delayed", "blocked", "orphan"} {
+		s.AssertNotCalled(t, "GetActionLastRun", u)
+		s.AssertNotCalled(t, "DecryptAction", u)
+	}
+	e.AssertCalled(t, "Run", mock.Anything, &state.Action{Kind: "dummy", Data: "ready"})
+}
+
+func TestDispatcherMaintenance(t *testing.T) {
+	getActionsInterval = 2
+	getActionsIntervalUnit = time.Second
+	defer func() {
+		getActionsInterval = 5
+		getActionsIntervalUnit = time.Minute
+	}()
+
+	deadline := time.Now().Add(-time.Minute)
+	s := new(mockState)
+	s.On("GetActions").Return([]*state.EncryptedAction{
+		{UUID: "extended", Action: state.Action{ProcessAfter: 10, Kind: "dummy"}},
+		{UUID: "deadline", Action: state.Action{ProcessAfter: 10, Kind: "dummy", Deadline: &deadline}},
+	})
+	s.On("GetLastSeen").Return(time.Now().Add(-time.Hour))
+	s.On("GetMaintenance").Return(&state.Maintenance{Extend: 14 * 24 * time.Hour})
+	s.On("GetActionLastRun", "deadline").Return(time.Time{}, nil)
+	s.On("DecryptAction", "deadline").Return(&state.Action{Kind: "dummy", Data: "deadline"}, nil)
+	s.On("UpdateActionLastRun", "deadline").Return(nil)
+	s.On("MarkActionAsProcessed", "deadline").Return(nil)
+	e := new(mockExecute)
+	e.On("Run", mock.Anything, &state.Action{Kind: "dummy", Data: "deadline"}).Return(nil)
+
+	m := metric.Initialize(&metric.Options{State: s, Registry: prometheus.NewRegistry()})
+	chStop := make(chan bool)
+	go dispatcher(s, e, m, time.Second, time.Minute, confirmPolicy{}, failureBackoff{}, nil, 0, clock.New(), chStop)
+	time.Sleep(time.Duration(3) * getActionsIntervalUnit)
+	chStop <- true
+	m.Stop()
+
+	s.AssertNotCalled(t, "GetActionLastRun", "extended")
+	s.AssertNotCalled(t, "DecryptAction", "extended")
+	e.AssertCalled(t, "Run", mock.Anything, &state.Action{Kind: "dummy", Data: "deadline"})
+}
+
+func TestDispatcherRecurringStopsWhenSeen(t *testing.T) {
+	getActionsInterval = 1
+	getActionsIntervalUnit = time.Second
+	defer func() {
+		getActionsInterval = 5
+		getActionsIntervalUnit = time.Minute
+	}()
+
+	s := new(mockState)
+	s.On("GetActions").Return([]*state.EncryptedAction{
+		{UUID: "recurring", Action: state.Action{ProcessAfter: 10, MinInterval: 1, ProcessUnit: "second", Kind: "dummy"}},
+	})
+	s.On("GetMaintenance").Return(nil)
+	// User is missing during first tick and checks in right after recurring action run.
+	s.On("GetLastSeen").Return(time.Now().Add(-time.Hour)).Once()
+	s.On("GetLastSeen").Return(time.Now())
+	s.On("GetActionLastRun", "recurring").Return(time.Time{}, nil)
+	s.On("DecryptAction", "recurring").Return(&state.Action{Kind: "dummy", Data: "recurring"}, nil)
+	s.On("UpdateActionLastRun", "recurring").Return(nil)
+	e := new(mockExecute)
+	e.On("Run", mock.Anything, &state.Action{Kind: "dummy", Data: "recurring"}).Return(nil)
+
+	m := metric.Initialize(&metric.Options{State: s, Registry: prometheus.NewRegistry()})
+	chStop := make(chan bool)
+	go dispatcher(s, e, m, time.Second, time.Minute, confirmPolicy{}, failureBackoff{}, nil, 0, clock.New(), chStop)
+	time.Sleep(time.Duration(4) * getActionsIntervalUnit)
+	chStop <- true
+	m.Stop()
+
+	e.AssertNumberOfCalls(t, "Run", 1)
+	s.AssertNumberOfCalls(t, "DecryptAction", 1)
+	s.AssertNotCalled(t, "MarkActionAsProcessed", "recurring")
+
+	// Action was evaluated in later ticks too, it did not run as user was seen.
+	var lastSeenCalls int
+	for _, call := range s.Calls {
+		if call.Method == "GetLastSeen" {
+			lastSeenCalls++
+		}
+	}
+	require.Greater(t, lastSeenCalls, 1)
+}
+
+func TestDispatcherVaultUnreachable(t *testing.T) {
+	mockTime, err := time.Parse("2006-01-02T15:04:05.999999-07:00", "2025-03-26T14:55:40.119447+01:00")
+	require.Nil(t, err)
+
+	getActionsInterval = 2
+	getActionsIntervalUnit = time.Second
+	defer func() {
+		getActionsInterval = 5
+		getActionsIntervalUnit = time.Minute
+	}()
+
+	s := new(mockState)
+	s.On("GetActions").Return([]*state.EncryptedAction{
+		{UUID: "unreachable", Action: state.Action{ProcessAfter: 10, Kind: "dummy"}},
+		{UUID: "locked", Action: state.Action{ProcessAfter: 10, Kind: "dummy"}},
+	})
+	s.On("GetLastSeen").Return(mockTime)
+	s.On("GetMaintenance").Return(nil)
+	s.On("GetActionLastRun", mock.Anything).Return(time.Time{}, nil)
+	s.On("DecryptAction", "unreachable").Return(nil, fmt.Errorf("%w: connection refused", state.ErrVaultUnreachable))
+	s.On("DecryptAction", "locked").Return(nil, fmt.Errorf("%w: locked", state.ErrKeyNotReleased))
+	s.On("ReportActionError", mock.Anything, "DecryptAction", mock.Anything).Return()
+	e := new(mockExecute)
+
+	mOpts := &metric.Options{State: s, Registry: prometheus.NewRegistry()}
+	m := metric.Initialize(mOpts)
+	chStop := make(chan bool)
+	go dispatcher(s, e, m, time.Second, time.Minute, confirmPolicy{}, failureBackoff{}, nil, 0, clock.New(), chStop)
+	time.Sleep(time.Duration(3) * getActionsIntervalUnit)
+	chStop <- true
+	m.Stop()
+
+	e.AssertNotCalled(t, "Run", mock.Anything, mock.Anything)
+
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	w := httptest.NewRecorder()
+	handler := promhttp.HandlerFor(mOpts.Registry.(prometheus.Gatherer), promhttp.HandlerOpts{})
+	handler.ServeHTTP(w, req)
+
+	body, err := io.ReadAll(w.Result().Body)
+	require.Nil(t, err)
+	require.Contains(t, string(body), `dmh_vault_decrypt_unreachable_total{action="unreachable"} 1`)
+	require.NotContains(t, string(body), `dmh_vault_decrypt_unreachable_total{action="locked"}`)
+}
+
+func TestVaultDowntimeObserve(t *testing.T) {
+	unreachable := fmt.Errorf("%w: connection refused", state.ErrVaultUnreachable)
+	readiness := api.NewReadiness()
+	d := &vaultDowntime{Max: time.Hour, Readiness: readiness}
+	now := time.Date(2025, 3, 26, 14, 0, 0, 0, time.UTC)
+
+	d.observe(unreachable, now)
+	require.Equal(t, now, d.since)
+	require.Empty(t, readiness.Pending())
+
+	d.observe(unreachable, now.Add(time.Hour))
+	require.Empty(t, readiness.Pending())
+	d.observe(unreachable, now.Add(2*time.Hour))
+	require.Equal(t, []string{api.ReadyRemoteVaultLink}, readiness.Pending())
+
+	// vault answered, even with error
+	d.observe(fmt.Errorf("%w: locked", state.ErrKeyNotReleased), now.Add(3*time.Hour))
+	require.True(t, d.since.IsZero())
+	require.Empty(t, readiness.Pending())
+
+	d.observe(nil, now.Add(4*time.Hour))
+	require.Empty(t, readiness.Pending())
+
+	// disabled
+	d = &vaultDowntime{Readiness: readiness}
+	d.observe(unreachable, now)
+	require.True(t, d.since.IsZero())
+	var nilDowntime *vaultDowntime
+	nilDowntime.observe(unreachable, now)
+}
+
+func TestFailureBackoffRetryAt(t *testing.T) {
+	lastFailure := time.Date(2025, 3, 26, 14, 0, 0, 0, time.UTC)
+	backoff := failureBackoff{After: 2, Initial: time.Minute, Max: 10 * time.Minute}
+	tests := []struct {
+		inputBackoff  failureBackoff
+		inputFailures int
+		inputLast     *time.Time
+		expected      time.Time
+	}{
+		{
+			inputBackoff:  backoff,
+			inputFailures: 1,
+			inputLast:     &lastFailure,
+		},
+		{
+			inputBackoff:  backoff,
+			inputFailures: 2,
+			inputLast:     &lastFailure,
+			expected:      lastFailure.Add(time.Minute),
+		},
+		{
+			inputBackoff:  backoff,
+			inputFailures: 4,
+			inputLast:     &lastFailure,
+			expected:      lastFailure.Add(4 * time.Minute),
+		},
+		{
+			inputBackoff:  backoff,
+			inputFailures: 20,
+			inputLast:     &lastFailure,
+			expected:      lastFailure.Add(10 * time.Minute),
+		},
+		{
+			inputBackoff:  backoff,
+			inputFailures: 5,
+		},
+		{
+			inputBackoff:  failureBackoff{Initial: time.Minute, Max: time.Hour},
+			inputFailures: 5,
+			inputLast:     &lastFailure,
+		},
+	}
+	for _, test := range tests {
+		a := &state.EncryptedAction{ConsecutiveFailures: test.inputFailures, LastFailure: test.inputLast}
+		require.Equal(t, test.expected, test.inputBackoff.retryAt(a), "failures %d", test.inputFailures)
+	}
+}
+
+func TestDispatcherTracing(t *testing.T) {
+	originalProvider := otel.GetTracerProvider()
+	defer otel.SetTracerProvider(originalProvider)
+
+	mockTime, err := time.Parse("2006-01-02T15:04:05.999999-07:00", "2025-03-26T14:55:40.119447+01:00")
+	require.Nil(t, err)
+
+	sr := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr)))
+
+	getActionsInterval = 2
+	getActionsIntervalUnit = time.Second
+	defer func() {
+		getActionsInterval = 5
+		getActionsIntervalUnit = time.Minute
+	}()
+
+	s := new(mockState)
+	s.On("GetActions").Return([]*state.EncryptedAction{
+		{Processed: 0, UUID: "test-uuid", Action: state.Action{ProcessAfter: 10, Kind: "dummy"}},
+	})
+	s.On("GetLastSeen").Return(mockTime)
+	s.On("GetMaintenance").Return(nil)
+	s.On("GetActionLastRun", "test-uuid").Return(mockTime, nil)
+	s.On("DecryptAction", "test-uuid").Return(&state.Action{ProcessAfter: 10, Kind: "dummy"}, nil)
+	s.On("UpdateActionLastRun", "test-uuid").Return(nil)
+	s.On("MarkActionAsProcessed", "test-uuid").Return(fmt.Errorf("mockMarkActionAsProcessed error"))
+	s.On("ReportActionError", "test-uuid", "MarkActionAsProcessed", mock.Anything).Return()
+	e := new(mockExecute)
+	e.On("Run", mock.Anything, &state.Action{ProcessAfter: 10, Kind: "dummy"}).Return(nil)
+
+	m := metric.Initialize(&metric.Options{State: s, Registry: prometheus.NewRegistry()})
+	chStop := make(chan bool)
+	go dispatcher(s, e, m, time.Second, time.Minute, confirmPolicy{}, failureBackoff{}, nil, 0, clock.New(), chStop)
+	time.Sleep(time.Duration(3) * getActionsIntervalUnit)
+	chStop <- true
+	m.Stop()
+
+	spans := sr.Ended()
+	require.Len(t, spans, 4)
+	expectedNames := []string{"DecryptAction", "Run", "MarkActionAsProcessed", "dispatcher.tick"}
+	for i, span := range spans {
+		require.Equal(t, expectedNames[i], span.Name())
+		if span.Name() == "dispatcher.tick" {
+			continue
+		}
+		require.Equal(t, spans[3].SpanContext().SpanID(), span.Parent().SpanID())
+		attrs := map[string]string{}
+		for _, attr := range span.Attributes() {
+			attrs[string(attr.Key)] = attr.Value.AsString()
+		}
+		require.Equal(t, map[string]string{"action.uuid": "test-uuid", "action.kind": "dummy"}, attrs)
+	}
+	require.Equal(t, codes.Unset, spans[1].Status().Code)
+	require.Equal(t, codes.Error, spans[2].Status().Code)
+	require.Equal(t, "mockMarkActionAsProcessed error", spans[2].Status().Description)
+}
+
+func TestCheckVaultProcessUnit(t *testing.T) {
+	tests := []struct {
+		inputVaultUnit  time.Duration
+		inputVaultErr   error
+		inputActionUnit time.Duration
+		expectedMetric  string
+	}{
+		{
+			inputVaultErr:   fmt.Errorf("unable to get vault info, status code 404"),
+			inputActionUnit: time.Hour,
+			expectedMetric:  "dmh_vault_process_unit_mismatch 0",
+		},
+		{
+			inputVaultUnit:  time.Hour,
+			inputActionUnit: time.Hour,
+			expectedMetric:  "dmh_vault_process_unit_mismatch 0",
+		},
+		{
+			inputVaultUnit:  time.Minute,
+			inputActionUnit: time.Hour,
+			expectedMetric:  "dmh_vault_process_unit_mismatch 1",
+		},
+	}
+	for _, test := range tests {
+		s := new(mockState)
+		s.On("GetVaultProcessUnit").Return(test.inputVaultUnit, test.inputVaultErr)
+		mOpts := &metric.Options{Registry: prometheus.NewRegistry()}
+		m := metric.Initialize(mOpts)
+		m.Stop()
+
+		checkVaultProcessUnit(s, m, test.inputActionUnit)
+		s.AssertNumberOfCalls(t, "GetVaultProcessUnit", 1)
+
+		req := httptest.NewRequest("GET", "/metrics", nil)
+		w := httptest.NewRecorder()
+
+		handler := promhttp.HandlerFor(mOpts.Registry.(prometheus.Gatherer), promhttp.HandlerOpts{})
+		handler.ServeHTTP(w, req)
+
+		body, err := io.ReadAll(w.Result().Body)
+		require.Nil(t, err)
+		require.Contains(t, string(body), test.expectedMetric)
+	}
+}
+
+func TestProbeRemoteVault(t *testing.T) {
+	remoteVaultProbeInterval = time.Millisecond
+	defer func() { remoteVaultProbeInterval = 10 * time.Second }()
+
+	s := new(mockState)
+	s.On("GetVaultProcessUnit").Return(time.Duration(0), fmt.Errorf("connection refused")).Twice()
+	s.On("GetVaultProcessUnit").Return(time.Hour, nil).Once()
+	readiness := api.NewReadiness(api.ReadyState, api.ReadyRemoteVaultProbe)
+
+	probeRemoteVault(s, readiness)
+	s.AssertNumberOfCalls(t, "GetVaultProcessUnit", 3)
+	require.Equal(t, []string{api.ReadyState}, readiness.Pending())
+}
+
+func TestCollectActions(t *testing.T) {
+	now := time.Date(2025, 3, 26, 14, 0, 0, 0, time.UTC)
+	s := new(mockState)
+	s.On("GetActions").Return([]*state.EncryptedAction{
+		{UUID: "old", Processed: 2, LastRun: now.Add(-48 * time.Hour)},
+		{UUID: "recent", Processed: 2, LastRun: now.Add(-time.Hour)},
+		{UUID: "not-processed", Processed: 0},
+		{UUID: "recurring", Processed: 1, LastRun: now.Add(-48 * time.Hour)},
+		{UUID: "legacy", Processed: 2},
+		{UUID: "broken", Processed: 2},
+	})
+	s.On("DeleteAction", "old").Return(nil)
+	s.On("DeleteAction", "legacy").Return(nil)
+	s.On("DeleteAction", "broken").Return(fmt.Errorf("missing action with uuid broken"))
+	mOpts := &metric.Options{Registry: prometheus.NewRegistry()}
+	m := metric.Initialize(mOpts)
+	m.Stop()
+	m.UpdateDMHActionErrors("old", "Run", 1)
+	m.UpdateDMHActionErrors("recent", "Run", 1)
+
+	collectActions(s, m, 24*time.Hour, now)
+	s.AssertNumberOfCalls(t, "DeleteAction", 3)
+	s.AssertNotCalled(t, "DeleteAction", "recent")
+
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	w := httptest.NewRecorder()
+	handler := promhttp.HandlerFor(mOpts.Registry.(prometheus.Gatherer), promhttp.HandlerOpts{})
+	handler.ServeHTTP(w, req)
+
+	body, err := io.ReadAll(w.Result().Body)
+	require.Nil(t, err)
+	require.Contains(t, string(body), "dmh_actions_collected_total 2")
+	require.Contains(t, string(body), `dmh_action_errors_total{action="recent",error="Run"} 1`)
+	require.NotContains(t, string(body), `dmh_action_errors_total{action="old"`)
+}
+
+func TestVerifyVaultKeys(t *testing.T) {
+	tests := []struct {
+		inputResults    []state.VerifyResult
+		expectedMetrics []string
+		missingMetrics  []string
+	}{
+		{
+			inputResults: []state.VerifyResult{},
+		},
+		{
+			inputResults: []state.VerifyResult{
+				{UUID: "uuid1"},
+				{UUID: "uuid2", Err: fmt.Errorf("unable to find vault data, status code 404")},
+				{UUID: "uuid3", Err: fmt.Errorf("missing vault url")},
+			},
+			expectedMetrics: []string{
+				`dmh_missing_secrets_total{action="uuid2"} 1`,
+				`dmh_missing_secrets_total{action="uuid3"} 1`,
+			},
+			missingMetrics: []string{
+				`dmh_missing_secrets_total{action="uuid1"}`,
+			},
+		},
+	}
+	for _, test := range tests {
+		s := new(mockState)
+		s.On("VerifyVaultKeys").Return(test.inputResults)
+		mOpts := &metric.Options{Registry: prometheus.NewRegistry()}
+		m := metric.Initialize(mOpts)
+		m.Stop()
+
+		verifyVaultKeys(s, m)
+		s.AssertNumberOfCalls(t, "VerifyVaultKeys", 1)
+
+		req := httptest.NewRequest("GET", "/metrics", nil)
+		w := httptest.NewRecorder()
+
+		handler := promhttp.HandlerFor(mOpts.Registry.(prometheus.Gatherer), promhttp.HandlerOpts{})
+		handler.ServeHTTP(w, req)
+
+		body, err := io.ReadAll(w.Result().Body)
+		require.Nil(t, err)
+		for _, expectedMetric := range test.expectedMetrics {
+			require.Contains(t, string(body), expectedMetric)
+		}
+		for _, missingMetric := range test.missingMetrics {
+			require.NotContains(t, string(body), missingMetric)
+		}
+	}
+}
+
+func TestReconcile(t *testing.T) {
+	s := new(mockState)
+	s.On("VerifyVaultKeys").Return([]state.VerifyResult{
+		{UUID: "ok"},
+		{UUID: "missing", Err: fmt.Errorf("unable to find vault data, status code 404")},
+		{UUID: "mismatch", Err: fmt.Errorf("%w: vault 1, action 2", state.ErrProcessAfterMismatch)},
+	})
+	v, err := vault.New(&vault.Options{SavePath: filepath.Join(t.TempDir(), "vault.json"), SecretProcessUnit: time.Hour})
+	require.Nil(t, err)
+	passedDeadline := time.Now().Add(-time.Hour)
+	require.Nil(t, v.AddSecret("client", "released", &vault.Secret{Key: "key", ProcessAfter: 10, Deadline: &passedDeadline}))
+	require.Nil(t, v.AddSecret("client", "locked", &vault.Secret{Key: "key", ProcessAfter: 10}))
+	require.Nil(t, v.AddSecret("client", "recurring", &vault.Secret{Key: "key", ProcessAfter: 10, Deadline: &passedDeadline, Recurring: true}))
+	mOpts := &metric.Options{Registry: prometheus.NewRegistry()}
+	m := metric.Initialize(mOpts)
+	m.Stop()
+
+	chStop := make(chan bool)
+	go reconcile(s, v, m, 10*time.Millisecond, chStop)
+	time.Sleep(15 * time.Millisecond)
+	chStop <- true
+	s.AssertNumberOfCalls(t, "VerifyVaultKeys", 1)
+
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	w := httptest.NewRecorder()
+	handler := promhttp.HandlerFor(mOpts.Registry.(prometheus.Gatherer), promhttp.HandlerOpts{})
+	handler.ServeHTTP(w, req)
+
+	body, err := io.ReadAll(w.Result().Body)
+	require.Nil(t, err)
+	require.Contains(t, string(body), `dmh_reconcile_mismatch_total{type="missing_secret"} 1`)
+	require.Contains(t, string(body), `dmh_reconcile_mismatch_total{type="process_after"} 1`)
+	require.Contains(t, string(body), "dmh_reconcile_stale_secrets 1")
+	require.NotContains(t, string(body), `type="stale_secret"`)
+
+	// components which are not enabled are skipped
+	chStop = make(chan bool)
+	go reconcile(nil, nil, m, 10*time.Millisecond, chStop)
+	time.Sleep(15 * time.Millisecond)
+	chStop <- true
+}